@@ -0,0 +1,163 @@
+// Package audit records who pushed, pulled, deleted or logged in, and when
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/telemetry"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultBufferSize = 1024
+	maxBatchSize      = 128
+	defaultPageSize   = 50
+)
+
+type Logger interface {
+	// Record queues the event for the current request, it never blocks the request path.
+	// The actor is the authenticated user in the request context, if any
+	Record(ctx echo.Context, action types.AuditAction, namespace, reference string)
+
+	// AuditLog - GET /admin/audit?namespace=&actor=&since=&n=&last=
+	AuditLog(ctx echo.Context) error
+
+	// Close flushes the queued events and stops the background writer
+	Close()
+}
+
+type auditLogger struct {
+	store  postgres.AuditStore
+	logger telemetry.Logger
+	events chan *types.AuditEvent
+	done   chan struct{}
+}
+
+func New(store postgres.AuditStore, logger telemetry.Logger) Logger {
+	a := &auditLogger{
+		store:  store,
+		logger: logger,
+		events: make(chan *types.AuditEvent, defaultBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	go a.run()
+	return a
+}
+
+func (a *auditLogger) Record(ctx echo.Context, action types.AuditAction, namespace, reference string) {
+	event := &types.AuditEvent{
+		CreatedAt: time.Now(),
+		Action:    action,
+		Namespace: namespace,
+		Reference: reference,
+		SourceIP:  ctx.RealIP(),
+	}
+
+	if user, ok := ctx.Get(types.UserContextKey).(*types.User); ok {
+		event.ActorId = user.Id
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		// dropping an audit event is better than stalling a push or pull
+		color.Red("audit log buffer is full, dropping event: %s %s:%s", action, namespace, reference)
+	}
+}
+
+func (a *auditLogger) Close() {
+	close(a.events)
+	<-a.done
+}
+
+// run writes the events in batches, a batch is flushed as soon as the channel is drained or the batch is full
+func (a *auditLogger) run() {
+	defer close(a.done)
+
+	batch := make([]*types.AuditEvent, 0, maxBatchSize)
+	for event := range a.events {
+		batch = append(batch, event)
+
+	drain:
+		for len(batch) < maxBatchSize {
+			select {
+			case e, ok := <-a.events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+
+		if err := a.store.AddAuditEvents(context.Background(), batch); err != nil {
+			color.Red("error writing audit events: %s", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+func (a *auditLogger) AuditLog(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	filter := &types.AuditLogFilter{
+		Namespace: ctx.QueryParam("namespace"),
+		ActorId:   ctx.QueryParam("actor"),
+	}
+
+	if since := ctx.QueryParam("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+				"error":   err.Error(),
+				"message": "since must be an RFC3339 timestamp",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+		filter.Since = t
+	}
+
+	pageSize := int64(defaultPageSize)
+	if n := ctx.QueryParam("n"); n != "" {
+		ps, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+		pageSize = ps
+	}
+
+	var offset int64
+	if last := ctx.QueryParam("last"); last != "" {
+		o, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+		offset = o
+	}
+
+	events, err := a.store.GetAuditEvents(ctx.Request().Context(), filter, pageSize, offset)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"events": events,
+	})
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Log(echo.Context, error) {}
+
+// auditStore keeps the events in memory, GetAuditEvents filters them like the store's query does
+type auditStore struct {
+	mu       sync.Mutex
+	events   []*types.AuditEvent
+	pageSize int64
+	offset   int64
+}
+
+func (s *auditStore) AddAuditEvents(_ context.Context, events []*types.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		copied := *event
+		s.events = append(s.events, &copied)
+	}
+	return nil
+}
+
+func (s *auditStore) GetAuditEvents(
+	_ context.Context, filter *types.AuditLogFilter, pageSize, offset int64,
+) ([]*types.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pageSize, s.offset = pageSize, offset
+	events := []*types.AuditEvent{}
+	for _, event := range s.events {
+		if (filter.Namespace != "" && event.Namespace != filter.Namespace) ||
+			(filter.ActorId != "" && event.ActorId != filter.ActorId) ||
+			event.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func record(a Logger, user *types.User, action types.AuditAction, namespace, reference string) {
+	req := httptest.NewRequest(http.MethodPut, "/v2/"+namespace+"/manifests/"+reference, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	ctx := echo.New().NewContext(req, httptest.NewRecorder())
+	if user != nil {
+		ctx.Set(types.UserContextKey, user)
+	}
+	a.Record(ctx, action, namespace, reference)
+}
+
+func TestRecordWritesEvents(t *testing.T) {
+	store := &auditStore{}
+	a := New(store, nopLogger{})
+
+	record(a, &types.User{Id: "johndoe"}, types.AuditActionPush, "johndoe/alpine", "latest")
+	record(a, nil, types.AuditActionPull, "johndoe/alpine", "latest")
+	// Close flushes the queued events
+	a.Close()
+
+	if len(store.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(store.events))
+	}
+	push, pull := store.events[0], store.events[1]
+	if push.Action != types.AuditActionPush || push.ActorId != "johndoe" || push.Namespace != "johndoe/alpine" ||
+		push.Reference != "latest" || push.SourceIP != "10.0.0.1" || push.CreatedAt.IsZero() {
+		t.Errorf("got push event %+v", push)
+	}
+	if pull.Action != types.AuditActionPull || pull.ActorId != "" {
+		t.Errorf("got pull event %+v, want an anonymous pull", pull)
+	}
+}
+
+func TestAuditLogFilters(t *testing.T) {
+	now := time.Now()
+	store := &auditStore{events: []*types.AuditEvent{
+		{CreatedAt: now.Add(-time.Hour * 48), Action: types.AuditActionPush, Namespace: "johndoe/alpine", ActorId: "johndoe"},
+		{CreatedAt: now.Add(-time.Hour), Action: types.AuditActionPull, Namespace: "johndoe/alpine", ActorId: "janedoe"},
+		{CreatedAt: now, Action: types.AuditActionPush, Namespace: "janedoe/busybox", ActorId: "janedoe"},
+	}}
+	a := &auditLogger{store: store, logger: nopLogger{}}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "no filters", want: 3},
+		{name: "namespace", query: "namespace=johndoe/alpine", want: 2},
+		{name: "actor", query: "actor=janedoe", want: 2},
+		{name: "namespace and actor", query: "namespace=johndoe/alpine&actor=janedoe", want: 1},
+		{name: "since", query: "since=" + now.Add(-time.Hour*24).UTC().Format(time.RFC3339), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/audit?"+tt.query, nil), rec)
+			if err := a.AuditLog(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var body struct {
+				Events []*types.AuditEvent `json:"events"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Events) != tt.want {
+				t.Errorf("got %d events, want %d", len(body.Events), tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditLogPagination(t *testing.T) {
+	store := &auditStore{}
+	a := &auditLogger{store: store, logger: nopLogger{}}
+
+	tests := []struct {
+		query      string
+		want       int
+		wantSize   int64
+		wantOffset int64
+	}{
+		{query: "", want: http.StatusOK, wantSize: defaultPageSize},
+		{query: "n=10&last=20", want: http.StatusOK, wantSize: 10, wantOffset: 20},
+		{query: "n=ten", want: http.StatusBadRequest},
+		{query: "last=twenty", want: http.StatusBadRequest},
+		{query: "since=yesterday", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		store.pageSize, store.offset = 0, 0
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/audit?"+tt.query, nil), rec)
+		if err := a.AuditLog(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("%q: got status %d, want %d", tt.query, rec.Code, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK && (store.pageSize != tt.wantSize || store.offset != tt.wantOffset) {
+			t.Errorf("%q: got page size %d and offset %d, want %d and %d", tt.query, store.pageSize, store.offset,
+				tt.wantSize, tt.wantOffset)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultUsersPageSize = 10
+
+// ListUsers - GET /admin/users?search=<username or email>&n=<page size>&last=<offset>
+func (a *auth) ListUsers(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	pageSize := int64(defaultUsersPageSize)
+	if n := ctx.QueryParam("n"); n != "" {
+		ps, err := strconv.ParseInt(n, 10, 64)
+		if err != nil || ps <= 0 {
+			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+				"error": "n must be a positive number",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+		pageSize = ps
+	}
+
+	var offset int64
+	if last := ctx.QueryParam("last"); last != "" {
+		o, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || o < 0 {
+			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+				"error": "last must be a positive number",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+		offset = o
+	}
+
+	users, total, err := a.pgStore.GetUsers(ctx.Request().Context(), ctx.QueryParam("search"), pageSize, offset)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"users": users,
+		"total": total,
+	})
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// DeactivateUser - POST /admin/users/:username/deactivate
+// the user can't sign in anymore and their sessions are revoked, their tokens stop working right away
+func (a *auth) DeactivateUser(ctx echo.Context) error {
+	return a.setUserActive(ctx, false)
+}
+
+// ReactivateUser - POST /admin/users/:username/reactivate
+func (a *auth) ReactivateUser(ctx echo.Context) error {
+	return a.setUserActive(ctx, true)
+}
+
+func (a *auth) setUserActive(ctx echo.Context, active bool) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, err := a.pgStore.GetUser(ctx.Request().Context(), ctx.Param("username"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error getting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = a.pgStore.SetUserActive(ctx.Request().Context(), user.Id, active); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error updating user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if !active {
+		if err = a.pgStore.DeleteAllSessions(ctx.Request().Context(), user.Id); err != nil {
+			echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+				"error":   err.Error(),
+				"message": "user deactivated, but their sessions could not be deleted",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+	}
+	a.userCache.invalidate(user.Id)
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// DeleteUser - DELETE /admin/users/:username
+// deletes the user along with their sessions and repositories, the layers no other repository uses are deleted too
+func (a *auth) DeleteUser(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, err := a.pgStore.GetUser(ctx.Request().Context(), ctx.Param("username"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error getting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	txn, err := a.pgStore.NewTxn(ctx.Request().Context())
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	manifests, err := a.pgStore.DeleteUserWithRepositories(ctx.Request().Context(), txn, user)
+	var orphans []string
+	if err == nil {
+		orphans, err = a.deleteRepositoryObjects(ctx.Request().Context(), txn, manifests)
+	}
+	if err != nil {
+		_ = a.pgStore.Abort(ctx.Request().Context(), txn)
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error deleting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = a.pgStore.Commit(ctx.Request().Context(), txn); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error deleting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+	a.userCache.invalidate(user.Id)
+
+	// a DFS object which fails to be deleted is only leaked, the user is gone already
+	err = registry.DeleteObjects(ctx.Request().Context(), a.dfs, orphans)
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, err)
+	return echoErr
+}
+
+// deleteRepositoryObjects deletes the layers of the deleted manifests which nothing else uses, and returns the DFS
+// keys of the manifests and layers, to be deleted once the txn is committed
+func (a *auth) deleteRepositoryObjects(ctx context.Context, txn pgx.Tx, manifests []*types.ConfigV2) ([]string, error) {
+	seen := make(map[string]bool)
+	var digests, keys []string
+	for _, manifest := range manifests {
+		manifestKeys, err := registry.ManifestObjectKeys(ctx, a.pgStore, txn, manifest.Namespace, manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, manifestKeys...)
+		if manifest.Reference != "" && manifest.Reference != manifest.Digest {
+			keys = append(keys, registry.TagObjectKeys(manifest.Namespace, manifest.Reference)...)
+		}
+
+		for _, dig := range manifest.Layers {
+			if !seen[dig] {
+				seen[dig] = true
+				digests = append(digests, dig)
+			}
+		}
+	}
+
+	layers, err := registry.DeleteUnreferencedLayers(ctx, a.pgStore, txn, digests)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, registry.LayerObjectKeys(ctx, a.pgStore, layers)...), nil
+}
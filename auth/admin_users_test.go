@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// deleteUserStore deletes the repositories of the user, the reference counts are what's left once they're gone.
+// The txns are nil
+type deleteUserStore struct {
+	*userStore
+	manifests     []*types.ConfigV2
+	manifestRefs  map[string]int64
+	layerRefs     map[string]int64
+	layers        map[string]*types.LayerV2
+	deletedLayers []string
+	committedTxns int
+}
+
+func (s *deleteUserStore) NewTxn(context.Context) (pgx.Tx, error)             { return nil, nil }
+func (s *deleteUserStore) Abort(context.Context, pgx.Tx) error                { return nil }
+func (s *deleteUserStore) DeleteBlobV2(context.Context, pgx.Tx, string) error { return nil }
+
+func (s *deleteUserStore) Commit(context.Context, pgx.Tx) error {
+	s.committedTxns++
+	return nil
+}
+
+func (s *deleteUserStore) DeleteUserWithRepositories(
+	context.Context, pgx.Tx, *types.User,
+) ([]*types.ConfigV2, error) {
+	return s.manifests, nil
+}
+
+func (s *deleteUserStore) GetManifestReferenceCount(_ context.Context, _ pgx.Tx, digest string) (int64, error) {
+	return s.manifestRefs[digest], nil
+}
+
+func (s *deleteUserStore) GetLayerReferenceCount(_ context.Context, _ pgx.Tx, digest string) (int64, error) {
+	return s.layerRefs[digest], nil
+}
+
+func (s *deleteUserStore) GetLayer(_ context.Context, digest string) (*types.LayerV2, error) {
+	if layer, ok := s.layers[digest]; ok {
+		return layer, nil
+	}
+
+	return nil, postgres.ErrNotFound
+}
+
+func (s *deleteUserStore) DeleteLayerV2(_ context.Context, _ pgx.Tx, digest string) error {
+	s.deletedLayers = append(s.deletedLayers, digest)
+	return nil
+}
+
+func (s *deleteUserStore) GetCompressedLayer(context.Context, string) (*types.CompressedLayer, error) {
+	return nil, postgres.ErrNotFound
+}
+
+// TestDeleteUserDeletesObjects deletes a user with two repositories. The base layer and the busybox manifest are
+// pushed by another user too, so their objects are kept
+func TestDeleteUserDeletesObjects(t *testing.T) {
+	store := &deleteUserStore{
+		userStore: &userStore{users: map[string]*types.User{
+			"johndoe": {Id: "johndoe", Username: "johndoe", Email: "johndoe@openregistry.dev"},
+		}},
+		manifests: []*types.ConfigV2{
+			{
+				Namespace: "johndoe/alpine",
+				Reference: "latest",
+				Digest:    "sha256:alpine",
+				Layers:    []string{"sha256:base", "sha256:app"},
+			},
+			{Namespace: "johndoe/busybox", Digest: "sha256:busybox", Layers: []string{"sha256:base"}},
+		},
+		manifestRefs: map[string]int64{"sha256:busybox": 1},
+		layerRefs:    map[string]int64{"sha256:base": 1},
+		layers: map[string]*types.LayerV2{
+			"sha256:base": {Digest: "sha256:base", UUID: "base-uuid"},
+			"sha256:app":  {Digest: "sha256:app", UUID: "app-uuid"},
+		},
+	}
+	storage := memory.New()
+	a := newTestAuth(store)
+	a.dfs = storage
+
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/admin/users/johndoe", nil), rec)
+	ctx.SetParamNames("username")
+	ctx.SetParamValues("johndoe")
+	if err := a.DeleteUser(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if store.committedTxns != 1 {
+		t.Fatalf("got %d txns committed, want 1", store.committedTxns)
+	}
+	if len(store.deletedLayers) != 1 || store.deletedLayers[0] != "sha256:app" {
+		t.Errorf("got layers %v deleted, want sha256:app", store.deletedLayers)
+	}
+
+	want := map[string]int{
+		registry.GetManifestIdentifier("johndoe/alpine", "sha256:alpine"):   1,
+		registry.GetManifestIdentifier("johndoe/alpine", "latest"):          1,
+		registry.GetManifestContentIdentifier("sha256:alpine"):              1,
+		registry.GetManifestIdentifier("johndoe/busybox", "sha256:busybox"): 1,
+		registry.GetManifestContentIdentifier("sha256:busybox"):             0,
+		registry.GetLayerIdentifier("app-uuid"):                             1,
+		registry.GetLayerIdentifier("base-uuid"):                            0,
+	}
+	for key, deletes := range want {
+		if got := storage.Deletes(key); got != deletes {
+			t.Errorf("got %d deletes of %s, want %d", got, key, deletes)
+		}
+	}
+}
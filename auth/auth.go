@@ -1,12 +1,18 @@
 package auth
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"github.com/containerish/OpenRegistry/audit"
 	"github.com/containerish/OpenRegistry/config"
+	dfsImpl "github.com/containerish/OpenRegistry/dfs"
 	"github.com/containerish/OpenRegistry/services/email"
 	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/telemetry"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
 	gh "github.com/google/go-github/v42/github"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/oauth2"
@@ -21,10 +27,16 @@ type Authentication interface {
 	Token(ctx echo.Context) error
 	JWT() echo.MiddlewareFunc
 	JWTRest() echo.MiddlewareFunc
+	JWTOptional() echo.MiddlewareFunc
 	ACL() echo.MiddlewareFunc
+	RequireRole(role string) echo.MiddlewareFunc
 	LoginWithGithub(ctx echo.Context) error
 	GithubLoginCallbackHandler(ctx echo.Context) error
+	LinkGithub(ctx echo.Context) error
+	UnlinkGithub(ctx echo.Context) error
 	ExpireSessions(ctx echo.Context) error
+	ListSessions(ctx echo.Context) error
+	RevokeSession(ctx echo.Context) error
 	SignOut(ctx echo.Context) error
 	ReadUserWithSession(ctx echo.Context) error
 	RenewAccessToken(ctx echo.Context) error
@@ -33,13 +45,31 @@ type Authentication interface {
 	ResetForgottenPassword(ctx echo.Context) error
 	ForgotPassword(ctx echo.Context) error
 	Invites(ctx echo.Context) error
+	// CapturedEmails lists the emails kept in the capture email mode, for the tests
+	CapturedEmails(ctx echo.Context) error
+
+	// organizations
+	CreateOrganization(ctx echo.Context) error
+	ListOrganizationMembers(ctx echo.Context) error
+	SetOrganizationMember(ctx echo.Context) error
+	DeleteOrganizationMember(ctx echo.Context) error
+
+	// admin only user management
+	ListUsers(ctx echo.Context) error
+	DeactivateUser(ctx echo.Context) error
+	ReactivateUser(ctx echo.Context) error
+	DeleteUser(ctx echo.Context) error
 }
 
 // New is the constructor function returns an Authentication implementation
 func New(
 	c *config.OpenRegistryConfig,
 	pgStore postgres.PersistentStore,
+	dfs dfsImpl.DFS,
 	logger telemetry.Logger,
+	auditLogger audit.Logger,
+	passwordPolicy *types.PasswordPolicy,
+	emailClient email.MailService,
 ) Authentication {
 
 	githubOAuth := &oauth2.Config{
@@ -50,18 +80,23 @@ func New(
 	}
 
 	ghClient := gh.NewClient(nil)
-	emailClient := email.New(c.Email, c.WebAppEndpoint)
 
 	a := &auth{
 		c:               c,
 		pgStore:         pgStore,
+		dfs:             dfs,
 		logger:          logger,
 		github:          githubOAuth,
 		ghClient:        ghClient,
-		oauthStateStore: make(map[string]time.Time),
+		oauthStateStore: make(map[string]oauthState),
 		emailClient:     emailClient,
+		mu:              &sync.RWMutex{},
+		userCache:       newUserCache(userCacheTTL),
+		auditLogger:     auditLogger,
+		passwordPolicy:  passwordPolicy,
 	}
 
+	a.seedAdmins()
 	go a.StateTokenCleanup()
 
 	return a
@@ -73,9 +108,23 @@ type (
 		logger          telemetry.Logger
 		github          *oauth2.Config
 		ghClient        *gh.Client
-		oauthStateStore map[string]time.Time
+		oauthStateStore map[string]oauthState
 		c               *config.OpenRegistryConfig
 		emailClient     email.MailService
+		mu              *sync.RWMutex
+		userCache       *userCache
+		auditLogger     audit.Logger
+		passwordPolicy  *types.PasswordPolicy
+		// dfs is where the objects of the deleted users' repositories are deleted from
+		dfs dfsImpl.DFS
+	}
+
+	// oauthState holds the PKCE code verifier for a pending OAuth login, keyed by the state token
+	oauthState struct {
+		expiresAt    time.Time
+		codeVerifier string
+		// linkUserId is set when the user links their GitHub account, rather than signing in with it
+		linkUserId string
 	}
 )
 
@@ -84,10 +133,32 @@ func (a *auth) StateTokenCleanup() {
 	// tick every 10 minutes, delete ant oauth state tokens which are older than 10 mins
 	// duration = 10mins, because github short lived code is valid for 10 mins
 	for range time.Tick(time.Second * 10) {
-		for key, t := range a.oauthStateStore {
-			if time.Now().Unix() > t.Unix() {
+		a.mu.Lock()
+		for key, state := range a.oauthStateStore {
+			if time.Now().Unix() > state.expiresAt.Unix() {
 				delete(a.oauthStateStore, key)
 			}
 		}
+		a.mu.Unlock()
+	}
+}
+
+// seedAdmins grants the admin role to the users listed as admins in the config, or to the first user when there are
+// none. It runs on startup, so a user listed later is only granted the role on the next start
+func (a *auth) seedAdmins() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if len(a.c.Admins) == 0 {
+		if err := a.pgStore.GrantRoleToFirstUser(ctx, types.RoleAdmin); err != nil {
+			color.Red("error granting the admin role to the first user: %s", err)
+		}
+		return
+	}
+
+	for _, username := range a.c.Admins {
+		if err := a.pgStore.GrantRole(ctx, username, types.RoleAdmin); err != nil {
+			color.Red("error granting the admin role to %s: %s", username, err)
+		}
 	}
 }
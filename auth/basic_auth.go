@@ -69,7 +69,7 @@ func (a *auth) BasicAuth() echo.MiddlewareFunc {
 			}()
 
 			if ctx.Request().RequestURI == "/v2/" {
-				_, err := a.validateUser(username, password)
+				_, err := a.validateUser(ctx.Request().Context(), username, password)
 				if err != nil {
 					a.logger.Log(ctx, err)
 					return false, ctx.NoContent(http.StatusUnauthorized)
@@ -80,7 +80,7 @@ func (a *auth) BasicAuth() echo.MiddlewareFunc {
 			}
 
 			usernameFromNameSpace := ctx.Param("username")
-			if usernameFromNameSpace != username {
+			if !a.canAccessNamespace(ctx.Request().Context(), usernameFromNameSpace, username, true) {
 				var errMsg registry.RegistryErrors
 				errMsg.Errors = append(errMsg.Errors, registry.RegistryError{
 					Code:    registry.RegistryErrorCodeDenied,
@@ -90,7 +90,7 @@ func (a *auth) BasicAuth() echo.MiddlewareFunc {
 				a.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 				return false, ctx.JSON(http.StatusForbidden, errMsg)
 			}
-			resp, err := a.validateUser(username, password)
+			resp, err := a.validateUser(ctx.Request().Context(), username, password)
 			if err != nil {
 				a.logger.Log(ctx, err)
 				return false, err
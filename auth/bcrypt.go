@@ -1,12 +1,26 @@
 package auth
 
 import (
+	"github.com/containerish/OpenRegistry/types"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const bcryptMinCost = 6
+const (
+	bcryptMinCost = 6
+	// dummyPasswordHash is compared against when there's no user to sign in as, so that unknown users take as long
+	// as wrong passwords. It must be hashed with bcryptMinCost
+	dummyPasswordHash = "$2a$06$ldFAuA8uKcVvrZjOxffEneivL.FFacMKHj5rorhDqwn4iTX4x3fwG"
+)
+
+// compareHashAndPassword is replaced by the tests to count the comparisons
+var compareHashAndPassword = bcrypt.CompareHashAndPassword //nolint
 
 func (a *auth) hashPassword(password string) (string, error) {
+	return HashPassword(password)
+}
+
+// HashPassword returns the bcrypt hash of password, it's exported for seeding users outside the http handlers
+func HashPassword(password string) (string, error) {
 	// Convert password string to byte slice
 	var passwordBytes = []byte(password)
 
@@ -17,6 +31,17 @@ func (a *auth) hashPassword(password string) (string, error) {
 }
 
 func (a *auth) verifyPassword(hashedPassword, currPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(currPassword))
+	err := compareHashAndPassword([]byte(hashedPassword), []byte(currPassword))
 	return err == nil
 }
+
+// verifyUserPassword runs a bcrypt comparison even when the user is nil or has no password, e.g. signed up with
+// OAuth, so that the response time doesn't tell whether the user exists
+func (a *auth) verifyUserPassword(user *types.User, password string) bool {
+	if user == nil || user.Password == "" {
+		a.verifyPassword(dummyPasswordHash, password)
+		return false
+	}
+
+	return a.verifyPassword(user.Password, password)
+}
@@ -2,11 +2,17 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -15,52 +21,161 @@ import (
 
 func (a *auth) LoginWithGithub(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
-	state, err := uuid.NewRandom()
-	if err != nil {
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+	return a.redirectToGithub(ctx, "")
+}
+
+// LinkGithub - GET /auth/github/link
+// links the GitHub account the user signs in with to the signed in user, instead of signing in with it
+func (a *auth) LinkGithub(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 			"error":   err.Error(),
-			"message": "error generating random id for github login",
+			"message": "missing authentication information",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
-	a.oauthStateStore[state.String()] = time.Now().Add(time.Minute * 10)
-	url := a.github.AuthCodeURL(state.String(), oauth2.AccessTypeOffline)
-	a.logger.Log(ctx, nil)
-	return ctx.Redirect(http.StatusTemporaryRedirect, url)
+
+	return a.redirectToGithub(ctx, user.Id)
 }
 
-func (a *auth) GithubLoginCallbackHandler(ctx echo.Context) error {
+// UnlinkGithub - DELETE /auth/github/link
+// the user must have a password, so that they can still sign in afterwards
+func (a *auth) UnlinkGithub(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	stateToken := ctx.FormValue("state")
-	_, ok := a.oauthStateStore[stateToken]
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
 	if !ok {
-		err := fmt.Errorf("INVALID_STATE_TOKEN")
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 			"error":   err.Error(),
-			"message": "missing or invalid state token",
+			"message": "missing authentication information",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	// no need to compare the stateToken from QueryParam \w stateToken from a.oauthStateStore
-	// the key is the actual token :p
-	delete(a.oauthStateStore, stateToken)
+	userWithPassword, err := a.pgStore.GetUserById(ctx.Request().Context(), user.Id, true)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error getting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
 
-	code := ctx.FormValue("code")
-	token, err := a.github.Exchange(context.Background(), code)
+	if userWithPassword.Password == "" {
+		err = fmt.Errorf("ERR_PASSWORD_NOT_SET")
+		echoErr := ctx.JSON(http.StatusConflict, echo.Map{
+			"error":   err.Error(),
+			"message": "set a password before unlinking GitHub, it's the only way to sign in to this account",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = a.pgStore.UnlinkOAuthIdentity(ctx.Request().Context(), user.Id, types.OAuthProviderGithub); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error unlinking GitHub account",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+	a.userCache.invalidate(user.Id)
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// redirectToGithub starts the OAuth flow, the GitHub account is linked to linkUserId rather than signed in with
+// when it's set
+func (a *auth) redirectToGithub(ctx echo.Context, linkUserId string) error {
+	state, err := uuid.NewRandom()
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error":   err.Error(),
-			"message": "github exchange error",
-			"code":    "GITHUB_EXCHANGE_ERR",
+			"message": "error generating random id for github login",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	codeVerifier, err := newCodeVerifier()
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error generating pkce code verifier for github login",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
+	expiresAt := time.Now().Add(time.Minute * 10)
+	a.mu.Lock()
+	a.oauthStateStore[state.String()] = oauthState{
+		expiresAt:    expiresAt,
+		codeVerifier: codeVerifier,
+		linkUserId:   linkUserId,
+	}
+	a.mu.Unlock()
+
+	// the state is also bound to the browser via cookie, so that a callback initiated by someone else's
+	// login attempt (login CSRF) is rejected
+	ctx.SetCookie(a.createCookie(OAuthStateCookieKey, state.String(), true, expiresAt))
+
+	authURL := a.github.AuthCodeURL(
+		state.String(),
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", codeChallengeS256(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	a.logger.Log(ctx, nil)
+	return ctx.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+func (a *auth) GithubLoginCallbackHandler(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	stateToken := ctx.FormValue("state")
+	stateCookie, err := ctx.Cookie(OAuthStateCookieKey)
+	if err != nil || stateToken == "" || stateCookie.Value != stateToken {
+		return a.githubCallbackError(ctx, fmt.Errorf("INVALID_STATE_TOKEN"))
+	}
+
+	a.mu.Lock()
+	state, ok := a.oauthStateStore[stateToken]
+	// state tokens are single use
+	delete(a.oauthStateStore, stateToken)
+	a.mu.Unlock()
+
+	// expire the state cookie, it's no longer needed
+	ctx.SetCookie(a.createCookie(OAuthStateCookieKey, "", true, time.Unix(0, 0)))
+
+	if !ok || time.Now().After(state.expiresAt) {
+		return a.githubCallbackError(ctx, fmt.Errorf("INVALID_STATE_TOKEN"))
+	}
+
+	code := ctx.FormValue("code")
+	token, err := a.github.Exchange(
+		ctx.Request().Context(),
+		code,
+		oauth2.SetAuthURLParam("code_verifier", state.codeVerifier),
+	)
+	if err != nil {
+		return a.githubCallbackError(ctx, fmt.Errorf("GITHUB_EXCHANGE_ERR: %w", err))
+	}
+
 	req, err := a.ghClient.NewRequest(http.MethodGet, "/user", nil)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusPreconditionFailed, echo.Map{
@@ -86,18 +201,18 @@ func (a *auth) GithubLoginCallbackHandler(ctx echo.Context) error {
 	}
 
 	oauthUser.Username = oauthUser.Login
-	id, err := uuid.NewRandom()
+	oauthUser.OAuthProvider = types.OAuthProviderGithub
+
+	if state.linkUserId != "" {
+		return a.linkGithubIdentity(ctx, state.linkUserId, &oauthUser)
+	}
+
+	user, err := a.githubUser(ctx.Request().Context(), &oauthUser)
 	if err != nil {
-		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   err.Error(),
-			"message": "error creating oauth user id",
-		})
-		a.logger.Log(ctx, err)
-		return echoErr
+		return a.githubCallbackError(ctx, err)
 	}
-	oauthUser.Id = id.String()
 
-	accessToken, refreshToken, err := a.SignOAuthToken(oauthUser.Id, token)
+	accessToken, refreshToken, err := a.SignOAuthToken(user.Id, token)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error": err.Error(),
@@ -107,14 +222,6 @@ func (a *auth) GithubLoginCallbackHandler(ctx echo.Context) error {
 		return echoErr
 	}
 
-	oauthUser.Password = refreshToken
-	if err = a.pgStore.AddOAuthUser(ctx.Request().Context(), &oauthUser); err != nil {
-		redirectPath := fmt.Sprintf("%s%s?error=%s", a.c.WebAppEndpoint, a.c.WebAppErrorRedirectPath, err.Error())
-		echoErr := ctx.Redirect(http.StatusTemporaryRedirect, redirectPath)
-		a.logger.Log(ctx, err)
-		return echoErr
-	}
-
 	sessionId, err := uuid.NewRandom()
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
@@ -124,28 +231,97 @@ func (a *auth) GithubLoginCallbackHandler(ctx echo.Context) error {
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
-	err = a.pgStore.AddSession(ctx.Request().Context(), sessionId.String(), refreshToken, oauthUser.Username)
+	err = a.addSession(ctx, sessionId.String(), refreshToken, user.Username)
 	if err != nil {
-		echoErr := ctx.Redirect(http.StatusTemporaryRedirect, a.c.WebAppErrorRedirectPath)
-		a.logger.Log(ctx, err)
-		return echoErr
+		return a.githubCallbackError(ctx, err)
 	}
-	val := fmt.Sprintf("%s:%s", sessionId, oauthUser.Id)
+	val := fmt.Sprintf("%s:%s", sessionId, user.Id)
 
 	sessionCookie := a.createCookie("session_id", val, false, time.Now().Add(time.Hour*750))
-	accessCookie := a.createCookie("access", accessToken, true, time.Now().Add(time.Hour*750))
-	refreshCookie := a.createCookie("refresh", refreshToken, true, time.Now().Add(time.Hour*750))
+	accessCookie := a.createCookie(AccessCookieKey, accessToken, true, time.Now().Add(time.Hour*750))
+	refreshCookie := a.createCookie(RefreshCookKey, refreshToken, true, time.Now().Add(time.Hour*750))
 
 	ctx.SetCookie(accessCookie)
 	ctx.SetCookie(refreshCookie)
 	ctx.SetCookie(sessionCookie)
+	ctx.Set(types.UserContextKey, user)
+	a.auditLogger.Record(ctx, types.AuditActionLogin, "", "")
 
 	err = ctx.Redirect(http.StatusTemporaryRedirect, a.c.WebAppRedirectURL)
 	a.logger.Log(ctx, nil)
 	return err
 }
 
+// githubUser finds the user who linked the GitHub account, or else the user with the same email, who gets the
+// account linked. A new user is only added when neither exists
+func (a *auth) githubUser(ctx context.Context, oauthUser *types.User) (*types.User, error) {
+	user, err := a.pgStore.GetUserByOAuthIdentity(ctx, types.OAuthProviderGithub, oauthUser.OAuthID)
+	if err == nil || !errors.Is(err, postgres.ErrNotFound) {
+		return user, err
+	}
+
+	if oauthUser.Email != "" {
+		user, err = a.pgStore.GetUser(ctx, oauthUser.Email, false)
+		if err == nil {
+			err = a.pgStore.LinkOAuthIdentity(ctx, user.Id, types.OAuthProviderGithub, oauthUser.OAuthID)
+			return user, err
+		}
+		if !errors.Is(err, postgres.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	if err = a.pgStore.AddOAuthUser(ctx, oauthUser); err != nil {
+		return nil, err
+	}
+
+	return a.pgStore.GetUserById(ctx, oauthUser.Id, false)
+}
+
+// linkGithubIdentity ends the OAuth flow started by LinkGithub, the user stays signed in as they were
+func (a *auth) linkGithubIdentity(ctx echo.Context, userId string, oauthUser *types.User) error {
+	err := a.pgStore.LinkOAuthIdentity(ctx.Request().Context(), userId, types.OAuthProviderGithub, oauthUser.OAuthID)
+	if errors.Is(err, postgres.ErrConflict) {
+		err = fmt.Errorf("ERR_GITHUB_ACCOUNT_LINKED_TO_ANOTHER_USER")
+	}
+	if err != nil {
+		return a.githubCallbackError(ctx, err)
+	}
+	a.userCache.invalidate(userId)
+
+	echoErr := ctx.Redirect(http.StatusTemporaryRedirect, a.c.WebAppRedirectURL)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// githubCallbackError sends the user back to the web app with the error, since the callback is a browser redirect
+func (a *auth) githubCallbackError(ctx echo.Context, err error) error {
+	redirectPath := fmt.Sprintf(
+		"%s%s?error=%s", a.c.WebAppEndpoint, a.c.WebAppErrorRedirectPath, url.QueryEscape(err.Error()),
+	)
+	echoErr := ctx.Redirect(http.StatusTemporaryRedirect, redirectPath)
+	a.logger.Log(ctx, err)
+	return echoErr
+}
+
+// newCodeVerifier returns a high entropy PKCE code verifier (RFC 7636, section 4.1)
+func newCodeVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("ERR_GENERATE_CODE_VERIFIER: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// codeChallengeS256 derives the PKCE code challenge from the code verifier (RFC 7636, section 4.2)
+func codeChallengeS256(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 const (
+	OAuthStateCookieKey = "oauth_state"
 	AccessCookieMaxAge  = int(time.Second * 3600)
 	RefreshCookieMaxAge = int(AccessCookieMaxAge * 3600)
 )
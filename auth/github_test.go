@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/audit"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	gh "github.com/google/go-github/v42/github"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+type nopAudit struct {
+	audit.Logger
+}
+
+func (nopAudit) Record(echo.Context, types.AuditAction, string, string) {}
+
+// githubStore has the user who linked the GitHub account 42
+type githubStore struct {
+	*userStore
+	sessions int
+}
+
+func (s *githubStore) GetUserByOAuthIdentity(_ context.Context, _ string, oauthId int) (*types.User, error) {
+	if oauthId != 42 {
+		return nil, postgres.ErrNotFound
+	}
+	return s.GetUserById(context.Background(), "johndoe", false)
+}
+
+func (s *githubStore) AddSession(context.Context, string, string, string, string, string) error {
+	s.sessions++
+	return nil
+}
+
+// githubServer mocks the OAuth token endpoint and the user API of GitHub, it records the code verifiers it's sent
+type githubServer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	codeVerifiers []string
+}
+
+func newGithubServer(t *testing.T) *githubServer {
+	s := &githubServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		s.mu.Lock()
+		s.codeVerifiers = append(s.codeVerifiers, r.PostForm.Get("code_verifier"))
+		s.mu.Unlock()
+		if r.PostForm.Get("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "gho_token",
+			"token_type":   "bearer",
+		})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(AuthorizationHeaderKey) != "token gho_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "johndoe"})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newGithubAuth(t *testing.T, server *githubServer) (*auth, *githubStore) {
+	store := &githubStore{userStore: &userStore{users: map[string]*types.User{
+		"johndoe": {Id: "johndoe", Username: "johndoe", IsActive: true},
+	}}}
+
+	ghClient := gh.NewClient(server.Client())
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghClient.BaseURL = baseURL
+
+	a := newTestAuth(store)
+	a.c = &config.OpenRegistryConfig{
+		Environment:             config.Local,
+		Registry:                &config.Registry{Host: "localhost", Port: 5000, SigningSecret: "signing-secret"},
+		WebAppEndpoint:          "http://localhost:3000",
+		WebAppRedirectURL:       "http://localhost:3000/repositories",
+		WebAppErrorRedirectPath: "/auth/error",
+	}
+	a.github = &oauth2.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   server.URL + "/login/oauth/authorize",
+			TokenURL:  server.URL + "/login/oauth/access_token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+	a.ghClient = ghClient
+	a.oauthStateStore = make(map[string]oauthState)
+	a.mu = &sync.RWMutex{}
+	a.auditLogger = nopAudit{}
+	return a, store
+}
+
+// startGithubLogin returns the state and the code challenge sent to GitHub, and the state cookie
+func startGithubLogin(t *testing.T, a *auth) (string, string, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/auth/github/login", nil), rec)
+	if err := a.LoginWithGithub(ctx); err != nil {
+		t.Fatal(err)
+	}
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method := location.Query().Get("code_challenge_method"); method != "S256" {
+		t.Fatalf("got code challenge method %q, want S256", method)
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == OAuthStateCookieKey {
+			return location.Query().Get("state"), location.Query().Get("code_challenge"), cookie
+		}
+	}
+	t.Fatal("the state cookie isn't set")
+	return "", "", nil
+}
+
+// githubCallback returns the URL the callback redirects to
+func githubCallback(
+	t *testing.T, a *auth, state, code string, cookie *http.Cookie,
+) (*url.URL, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/auth/github/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	if err := a.GithubLoginCallbackHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusTemporaryRedirect)
+	}
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location, rec
+}
+
+func TestGithubCallbackStateMismatch(t *testing.T) {
+	server := newGithubServer(t)
+	a, store := newGithubAuth(t, server)
+	state, _, cookie := startGithubLogin(t, a)
+	_, _, otherCookie := startGithubLogin(t, a)
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie *http.Cookie
+	}{
+		{name: "cookie of another login", state: state, cookie: otherCookie},
+		{name: "no cookie", state: state},
+		{name: "unknown state", state: "unknown", cookie: &http.Cookie{Name: OAuthStateCookieKey, Value: "unknown"}},
+		{name: "no state", cookie: cookie},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, _ := githubCallback(t, a, tt.state, "valid-code", tt.cookie)
+			if location.Path != "/auth/error" || location.Query().Get("error") != "INVALID_STATE_TOKEN" {
+				t.Errorf("got redirect to %s, want the INVALID_STATE_TOKEN error", location)
+			}
+		})
+	}
+
+	if len(server.codeVerifiers) != 0 || store.sessions != 0 {
+		t.Errorf("got %d code exchanges and %d sessions, want none", len(server.codeVerifiers), store.sessions)
+	}
+}
+
+func TestGithubCallbackExchangesCodeWithVerifier(t *testing.T) {
+	server := newGithubServer(t)
+	a, store := newGithubAuth(t, server)
+	state, challenge, cookie := startGithubLogin(t, a)
+
+	location, rec := githubCallback(t, a, state, "valid-code", cookie)
+	if location.String() != a.c.WebAppRedirectURL {
+		t.Fatalf("got redirect to %s, want %s", location, a.c.WebAppRedirectURL)
+	}
+	if len(server.codeVerifiers) != 1 {
+		t.Fatalf("got %d code exchanges, want 1", len(server.codeVerifiers))
+	}
+	sum := sha256.Sum256([]byte(server.codeVerifiers[0]))
+	if got := base64.RawURLEncoding.EncodeToString(sum[:]); got != challenge {
+		t.Errorf("got a code verifier whose challenge is %s, want %s", got, challenge)
+	}
+	if store.sessions != 1 {
+		t.Errorf("got %d sessions, want 1", store.sessions)
+	}
+	signedIn := false
+	for _, c := range rec.Result().Cookies() {
+		signedIn = signedIn || (c.Name == AccessCookieKey && c.Value != "")
+	}
+	if !signedIn {
+		t.Error("the access cookie isn't set")
+	}
+
+	// the state is single use
+	location, _ = githubCallback(t, a, state, "valid-code", cookie)
+	if location.Query().Get("error") != "INVALID_STATE_TOKEN" {
+		t.Errorf("got redirect to %s replaying the state, want the INVALID_STATE_TOKEN error", location)
+	}
+}
+
+func TestGithubCallbackRejectedCode(t *testing.T) {
+	server := newGithubServer(t)
+	a, store := newGithubAuth(t, server)
+	state, _, cookie := startGithubLogin(t, a)
+
+	location, _ := githubCallback(t, a, state, "invalid-code", cookie)
+	if !strings.HasPrefix(location.Query().Get("error"), "GITHUB_EXCHANGE_ERR") {
+		t.Errorf("got redirect to %s, want the GITHUB_EXCHANGE_ERR error", location)
+	}
+	if store.sessions != 0 {
+		t.Errorf("got %d sessions, want none", store.sessions)
+	}
+}
+
+// oauthStore keeps the linked identities of the users, by GitHub id, and finds the users by email
+type oauthStore struct {
+	*userStore
+	identities map[int]string
+	added      int
+}
+
+func (s *oauthStore) GetUserByOAuthIdentity(ctx context.Context, _ string, oauthId int) (*types.User, error) {
+	userId, ok := s.identities[oauthId]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return s.GetUserById(ctx, userId, false)
+}
+
+func (s *oauthStore) GetUser(_ context.Context, identifier string, _ bool) (*types.User, error) {
+	for _, user := range s.users {
+		if user.Email == identifier || user.Username == identifier {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (s *oauthStore) LinkOAuthIdentity(_ context.Context, userId, _ string, oauthId int) error {
+	if linked, ok := s.identities[oauthId]; ok && linked != userId {
+		return postgres.ErrConflict
+	}
+	s.identities[oauthId] = userId
+	return nil
+}
+
+func (s *oauthStore) AddOAuthUser(_ context.Context, u *types.User) error {
+	s.added++
+	u.Id = u.Username
+	s.users[u.Id] = u
+	s.identities[u.OAuthID] = u.Id
+	return nil
+}
+
+func TestGithubUserUpsert(t *testing.T) {
+	tests := []struct {
+		name      string
+		oauthUser types.User
+		wantUser  string
+		wantAdded int
+	}{
+		{
+			name:      "linked identity",
+			oauthUser: types.User{OAuthID: 42, Username: "johndoe-gh", Email: "other@example.com"},
+			wantUser:  "johndoe",
+		},
+		{
+			name:      "existing account with the same email",
+			oauthUser: types.User{OAuthID: 43, Username: "janedoe-gh", Email: "jane@example.com"},
+			wantUser:  "janedoe",
+		},
+		{
+			name:      "new account",
+			oauthUser: types.User{OAuthID: 44, Username: "newcomer", Email: "newcomer@example.com"},
+			wantUser:  "newcomer",
+			wantAdded: 1,
+		},
+		{
+			name:      "new account without an email",
+			oauthUser: types.User{OAuthID: 45, Username: "private-email"},
+			wantUser:  "private-email",
+			wantAdded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &oauthStore{
+				userStore: &userStore{users: map[string]*types.User{
+					"johndoe": {Id: "johndoe", Username: "johndoe", Email: "john@example.com"},
+					"janedoe": {Id: "janedoe", Username: "janedoe", Email: "jane@example.com"},
+				}},
+				identities: map[int]string{42: "johndoe"},
+			}
+			a := newTestAuth(store)
+
+			oauthUser := tt.oauthUser
+			oauthUser.OAuthProvider = types.OAuthProviderGithub
+			user, err := a.githubUser(context.Background(), &oauthUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Id != tt.wantUser || store.added != tt.wantAdded {
+				t.Errorf("got user %s and %d users added, want %s and %d", user.Id, store.added, tt.wantUser, tt.wantAdded)
+			}
+			if store.identities[tt.oauthUser.OAuthID] != tt.wantUser {
+				t.Errorf("got the GitHub account linked to %q, want %s",
+					store.identities[tt.oauthUser.OAuthID], tt.wantUser)
+			}
+			if len(store.users) != 2+tt.wantAdded {
+				t.Errorf("got %d users, want %d", len(store.users), 2+tt.wantAdded)
+			}
+
+			// the next login finds the same user
+			again := tt.oauthUser
+			if user, err = a.githubUser(context.Background(), &again); err != nil || user.Id != tt.wantUser {
+				t.Errorf("got user %v and error %v for the next login, want %s", user, err, tt.wantUser)
+			}
+			if store.added != tt.wantAdded {
+				t.Errorf("got %d users added after the next login, want %d", store.added, tt.wantAdded)
+			}
+		})
+	}
+}
@@ -88,3 +88,20 @@ func (a *auth) verifyEmail(email string) error {
 
 	return nil
 }
+
+// CapturedEmails lists the emails kept by the capture email mode, the ones sent to the address in the "to" query
+// param when it's set
+func (a *auth) CapturedEmails(ctx echo.Context) error {
+	messages, ok := a.emailClient.CapturedEmails(ctx.QueryParam("to"))
+	if !ok {
+		err := fmt.Errorf("ERR_EMAIL_CAPTURE_DISABLED")
+		echoErr := ctx.JSON(http.StatusNotFound, echo.Map{
+			"error":   err.Error(),
+			"message": "emails are only captured in the capture email mode",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	return ctx.JSON(http.StatusOK, messages)
+}
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/containerish/OpenRegistry/config"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/oauth2"
@@ -13,6 +15,10 @@ type Claims struct {
 	jwt.StandardClaims
 	Type   string
 	Access AccessList
+	// TokenVersion is bumped for a user on every password change, tokens carrying an older version are rejected
+	TokenVersion int `json:"token_version"`
+	// Roles are informative, RequireRole checks the roles stored for the user
+	Roles []string `json:"roles,omitempty"`
 }
 
 type PlatformClaims struct {
@@ -31,27 +37,116 @@ type ServiceClaims struct {
 	Access AccessList
 }
 
-func (a *auth) newPublicPullToken() (string, error) {
+// PublicPullUserId is the subject of the anonymous pull tokens, it doesn't belong to any user in the store
+const PublicPullUserId = "public_pull_user"
+
+// the values of Claims.Type, the type decides how long the token lives (see newClaims). Anonymous tokens are issued
+// without credentials and only grant pull
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeRefresh    = "refresh"
+	TokenTypeService    = "service"
+	TokenTypeShortLived = "short-lived"
+	TokenTypeAnonymous  = "anonymous"
+
+	defaultAnonymousTokenTTL = time.Minute * 5
+)
+
+// NewAccessToken returns a signed access token for the user, scopes are the repositories and actions it grants.
+// Without scopes the token can push to and pull from the user's namespace
+func NewAccessToken(cfg *config.OpenRegistryConfig, user *types.User, scopes AccessList) (string, error) {
+	if scopes == nil {
+		scopes = userAccess(user.Username)
+	}
+
+	claims := newClaims(cfg, user.Id, TokenTypeAccess, user.TokenVersion, user.Roles, scopes)
+	return signClaims(cfg, &claims)
+}
+
+// NewRefreshToken returns a signed refresh token for the user, it's only meant to get new access tokens
+func NewRefreshToken(cfg *config.OpenRegistryConfig, user *types.User) (string, error) {
+	claims := newClaims(cfg, user.Id, TokenTypeRefresh, user.TokenVersion, user.Roles, userAccess(user.Username))
+	return signClaims(cfg, &claims)
+}
+
+// ParseAndValidate checks the signature, the signing method, the expiry and the issuer of the token. It doesn't
+// check the token against the store, e.g. the token version of the user
+func ParseAndValidate(cfg *config.OpenRegistryConfig, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("ERR_UNEXPECTED_SIGNING_METHOD: %s", t.Method.Alg())
+		}
+		return []byte(cfg.Registry.SigningSecret), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERR_PARSE_TOKEN: %w", err)
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("ERR_INVALID_TOKEN")
+	}
+	if !claims.VerifyIssuer(cfg.Endpoint(), true) {
+		return nil, fmt.Errorf("ERR_INVALID_TOKEN_ISSUER: %s", claims.Issuer)
+	}
+
+	return claims, nil
+}
+
+func signClaims(cfg *config.OpenRegistryConfig, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	sign, err := token.SignedString([]byte(cfg.Registry.SigningSecret))
+	if err != nil {
+		return "", fmt.Errorf("ERR_SIGN_TOKEN: %w", err)
+	}
+
+	return sign, nil
+}
+
+// userAccess is what the tokens issued to a user grant by default, push and pull on their own namespace
+func userAccess(username string) AccessList {
+	return AccessList{
+		{
+			Type:    "repository",
+			Name:    fmt.Sprintf("%s/*", username),
+			Actions: []string{"push", "pull"},
+		},
+	}
+}
+
+// newPublicPullToken issues an anonymous token which can only pull namespace, the caller checks that the
+// repository is public. The token is short-lived, see Registry.AnonymousTokenTTL
+func (a *auth) newPublicPullToken(namespace string) (string, time.Duration, error) {
 	acl := AccessList{
 		{
 			Type:    "repository",
-			Name:    "*/*",
+			Name:    namespace,
 			Actions: []string{"pull"},
 		},
 	}
 
-	claims := a.createClaims("public_pull_user", "", acl)
+	ttl := a.anonymousTokenTTL()
+	claims := newClaims(a.c, PublicPullUserId, TokenTypeAnonymous, 0, nil, acl)
+	claims.ExpiresAt = time.Now().Add(ttl).Unix()
 
-	// TODO (jay-dee7)- handle this properly, check for errors and don't set defaults for actions
-	claims.Access[0].Actions = []string{"pull"}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	sign, err := token.SignedString([]byte(a.c.Registry.SigningSecret))
+	sign, err := signClaims(a.c, &claims)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	return sign, nil
+	return sign, ttl, nil
+}
+
+func (a *auth) anonymousTokenTTL() time.Duration {
+	if a.c.Registry.AnonymousTokenTTL > 0 {
+		return a.c.Registry.AnonymousTokenTTL
+	}
+
+	return defaultAnonymousTokenTTL
+}
+
+// isAnonymous is true for the tokens issued by newPublicPullToken, including the ones issued before they had a type
+func (c *Claims) isAnonymous() bool {
+	return c.Type == TokenTypeAnonymous || c.Id == PublicPullUserId
 }
 
 func (a *auth) SignOAuthToken(userId string, payload *oauth2.Token) (string, string, error) {
@@ -80,40 +175,15 @@ func (a *auth) newOAuthToken(userId string, payload *oauth2.Token) (string, stri
 
 // nolint
 func (a *auth) newServiceToken(u types.User) (string, error) {
-	acl := AccessList{
-		{
-			Type:    "repository",
-			Name:    fmt.Sprintf("%s/*", u.Username),
-			Actions: []string{"push", "pull"},
-		},
-	}
-	claims := a.createClaims(u.Id, "service", acl)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	sign, err := token.SignedString([]byte(a.c.Registry.SigningSecret))
-	if err != nil {
-		return "", fmt.Errorf("error signing secret %w", err)
-	}
-
-	return sign, nil
+	claims := newClaims(a.c, u.Id, TokenTypeService, u.TokenVersion, u.Roles, userAccess(u.Username))
+	return signClaims(a.c, &claims)
 }
 
-func (a *auth) newWebLoginToken(userId, username, tokenType string) (string, error) {
-	acl := AccessList{
-		{
-			Type:    "repository",
-			Name:    fmt.Sprintf("%s/*", username),
-			Actions: []string{"push", "pull"},
-		},
-	}
-	claims := a.createClaims(userId, tokenType, acl)
-	raw := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := raw.SignedString([]byte(a.c.Registry.SigningSecret))
-	if err != nil {
-		return "", err
-	}
-
-	return token, nil
+func (a *auth) newWebLoginToken(
+	userId, username, tokenType string, tokenVersion int, roles []string,
+) (string, error) {
+	claims := newClaims(a.c, userId, tokenType, tokenVersion, roles, userAccess(username))
+	return signClaims(a.c, &claims)
 }
 
 // nolint
@@ -174,30 +244,6 @@ func (a *auth) createRefreshClaims(userId string) RefreshClaims {
 	return claims
 }
 
-func (a *auth) newToken(u *types.User) (string, error) {
-	//for now we're sending same name for sub and name.
-	//TODO when repositories need collaborators
-
-	acl := AccessList{
-		{
-			Type:    "repository",
-			Name:    fmt.Sprintf("%s/*", u.Username),
-			Actions: []string{"push", "pull"},
-		},
-	}
-	claims := a.createClaims(u.Id, "access", acl)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-
-	// Generate encoded token and send it as response.
-	t, err := token.SignedString([]byte(a.c.Registry.SigningSecret))
-	if err != nil {
-		return "", err
-
-	}
-
-	return t, nil
-}
-
 /*
 claims format
 
@@ -221,34 +267,37 @@ claims format
 	    ]
 	}
 */
-func (a *auth) createClaims(id, tokenType string, acl AccessList) Claims {
-
+func newClaims(
+	cfg *config.OpenRegistryConfig, id, tokenType string, tokenVersion int, roles []string, acl AccessList,
+) Claims {
 	tokenLife := time.Now().Add(time.Minute * 10).Unix()
 	switch tokenType {
-	case "access":
+	case TokenTypeAccess:
 		// TODO (jay-dee7)
 		// token can live for month now, but must be addressed when we implement PASETO
 		tokenLife = time.Now().Add(time.Hour * 750).Unix()
-	case "refresh":
+	case TokenTypeRefresh:
 		tokenLife = time.Now().Add(time.Hour * 750).Unix()
-	case "service":
+	case TokenTypeService:
 		tokenLife = time.Now().Add(time.Hour * 750).Unix()
-	case "short-lived":
+	case TokenTypeShortLived:
 		tokenLife = time.Now().Add(time.Minute * 30).Unix()
 	}
 
 	claims := Claims{
 		StandardClaims: jwt.StandardClaims{
-			Audience:  a.c.Endpoint(),
+			Audience:  cfg.Endpoint(),
 			ExpiresAt: tokenLife,
 			Id:        id,
 			IssuedAt:  time.Now().Unix(),
-			Issuer:    a.c.Endpoint(),
+			Issuer:    cfg.Endpoint(),
 			NotBefore: time.Now().Unix(),
 			Subject:   id,
 		},
-		Access: acl,
-		Type:   tokenType,
+		Access:       acl,
+		Type:         tokenType,
+		TokenVersion: tokenVersion,
+		Roles:        roles,
 	}
 	return claims
 }
@@ -258,3 +307,24 @@ type AccessList []struct {
 	Name    string   `json:"name"`
 	Actions []string `json:"actions"`
 }
+
+// grants is true when the list allows action on the repository namespace, a name ending with /* covers all the
+// repositories under it
+func (l AccessList) grants(namespace, action string) bool {
+	for _, access := range l {
+		if access.Type != "repository" {
+			continue
+		}
+		if access.Name != namespace &&
+			!(strings.HasSuffix(access.Name, "/*") && strings.HasPrefix(namespace, strings.TrimSuffix(access.Name, "*"))) {
+			continue
+		}
+		for _, a := range access.Actions {
+			if a == action {
+				return true
+			}
+		}
+	}
+
+	return false
+}
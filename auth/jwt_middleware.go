@@ -20,7 +20,7 @@ const (
 
 // JWT basically uses the default JWT middleware by echo, but has a slightly different skipper func
 func (a *auth) JWT() echo.MiddlewareFunc {
-	return middleware.JWTWithConfig(middleware.JWTConfig{
+	jwtMiddleware := middleware.JWTWithConfig(middleware.JWTConfig{
 		Skipper: func(ctx echo.Context) bool {
 			if strings.HasPrefix(ctx.Request().RequestURI, "/auth") {
 				return false
@@ -58,6 +58,10 @@ func (a *auth) JWT() echo.MiddlewareFunc {
 		Claims:         &Claims{},
 		TokenLookup:    fmt.Sprintf("cookie:%s,header:%s", AccessCookieKey, echo.HeaderAuthorization),
 	})
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return jwtMiddleware(a.validateTokenUser(hf))
+	}
 }
 
 // ACL implies a basic Access Control List on protected resources
@@ -68,7 +72,7 @@ func (a *auth) ACL() echo.MiddlewareFunc {
 
 			m := ctx.Request().Method
 			if m == http.MethodGet || m == http.MethodHead {
-				return hf(ctx)
+				return a.pullACL(ctx, hf)
 			}
 
 			token, ok := ctx.Get("user").(*jwt.Token)
@@ -82,6 +86,11 @@ func (a *auth) ACL() echo.MiddlewareFunc {
 				a.logger.Log(ctx, fmt.Errorf("ACL: invalid claims"))
 				return ctx.NoContent(http.StatusUnauthorized)
 			}
+			// anonymous tokens only grant pull, whatever the repository allows
+			if claims.isAnonymous() {
+				a.logger.Log(ctx, fmt.Errorf("ACL: anonymous token can't push"))
+				return ctx.NoContent(http.StatusUnauthorized)
+			}
 
 			username := ctx.Param("username")
 
@@ -90,7 +99,8 @@ func (a *auth) ACL() echo.MiddlewareFunc {
 				a.logger.Log(ctx, err)
 				return ctx.NoContent(http.StatusUnauthorized)
 			}
-			if user.Username == username {
+			if a.canAccessNamespace(ctx.Request().Context(), username, user.Username, true) {
+				a.authorizeBlobMount(ctx, user)
 				return hf(ctx)
 			}
 
@@ -102,7 +112,7 @@ func (a *auth) ACL() echo.MiddlewareFunc {
 
 // JWT basically uses the default JWT middleware by echo, but has a slightly different skipper func
 func (a *auth) JWTRest() echo.MiddlewareFunc {
-	return middleware.JWTWithConfig(middleware.JWTConfig{
+	jwtMiddleware := middleware.JWTWithConfig(middleware.JWTConfig{
 		BeforeFunc:     middleware.DefaultJWTConfig.BeforeFunc,
 		SuccessHandler: middleware.DefaultJWTConfig.SuccessHandler,
 		ErrorHandler:   nil,
@@ -122,4 +132,146 @@ func (a *auth) JWTRest() echo.MiddlewareFunc {
 		SigningMethod:  jwt.SigningMethodHS256.Name,
 		Claims:         &Claims{},
 	})
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return jwtMiddleware(a.validateTokenUser(hf))
+	}
+}
+
+// JWTOptional verifies the token like JWTRest when the request has one, in the access cookie or the Authorization
+// header. The requests without a token go through anonymously, for the handlers which show more to signed in users
+func (a *auth) JWTOptional() echo.MiddlewareFunc {
+	jwtMiddleware := middleware.JWTWithConfig(middleware.JWTConfig{
+		Skipper: func(ctx echo.Context) bool {
+			if ctx.Request().Header.Get(echo.HeaderAuthorization) != "" {
+				return false
+			}
+			_, err := ctx.Cookie(AccessCookieKey)
+			return err != nil
+		},
+		BeforeFunc:     middleware.DefaultJWTConfig.BeforeFunc,
+		SuccessHandler: middleware.DefaultJWTConfig.SuccessHandler,
+		ErrorHandler:   nil,
+		ErrorHandlerWithContext: func(err error, ctx echo.Context) error {
+			ctx.Set(types.HandlerStartTime, time.Now())
+			a.logger.Log(ctx, err)
+			return ctx.JSON(http.StatusUnauthorized, echo.Map{
+				"error":   err.Error(),
+				"message": "invalid authentication information",
+			})
+		},
+		KeyFunc:        middleware.DefaultJWTConfig.KeyFunc,
+		ParseTokenFunc: middleware.DefaultJWTConfig.ParseTokenFunc,
+		SigningKey:     []byte(a.c.Registry.SigningSecret),
+		SigningKeys:    map[string]interface{}{},
+		SigningMethod:  jwt.SigningMethodHS256.Name,
+		Claims:         &Claims{},
+		TokenLookup:    fmt.Sprintf("cookie:%s,header:%s", AccessCookieKey, echo.HeaderAuthorization),
+	})
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return jwtMiddleware(a.validateTokenUser(hf))
+	}
+}
+
+// UserID returns the id of the user of the request's token, once the JWT middleware verified it. The requests
+// without a token, or with an anonymous one, have no user
+func UserID(ctx echo.Context) (string, bool) {
+	token, ok := ctx.Get("user").(*jwt.Token)
+	if !ok {
+		return "", false
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.isAnonymous() || claims.Id == "" {
+		return "", false
+	}
+
+	return claims.Id, true
+}
+
+// validateTokenUser runs after the JWT signature has been verified and makes sure that the token still belongs to an
+// active user, and was issued after the user's last password change
+func (a *auth) validateTokenUser(hf echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		// JWT auth was skipped for this request
+		token, ok := ctx.Get("user").(*jwt.Token)
+		if !ok {
+			return hf(ctx)
+		}
+
+		claims, ok := token.Claims.(*Claims)
+		if !ok || claims.isAnonymous() {
+			return hf(ctx)
+		}
+
+		ctx.Set(types.HandlerStartTime, time.Now())
+		user, err := a.getTokenUser(ctx.Request().Context(), claims.Id)
+		if err != nil {
+			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+				"error":   err.Error(),
+				"message": "user not found, unauthorised",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+
+		if !user.IsActive {
+			err = fmt.Errorf("ERR_USER_INACTIVE")
+			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+				"error":   err.Error(),
+				"message": "account is inactive, unauthorised",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+
+		if claims.TokenVersion != user.TokenVersion {
+			err = fmt.Errorf("ERR_TOKEN_VERSION_MISMATCH")
+			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+				"error":   err.Error(),
+				"message": "token has been revoked, please sign in again",
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+
+		ctx.Set(types.UserContextKey, user)
+		return hf(ctx)
+	}
+}
+
+// RequireRole must be used after JWT/JWTRest, it only lets through the users who have the role. The roles are read
+// from the store (through the user cache) rather than the token, so revoking a role doesn't wait for tokens to expire
+func (a *auth) RequireRole(role string) echo.MiddlewareFunc {
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			user, ok := ctx.Get(types.UserContextKey).(*types.User)
+			if !ok {
+				ctx.Set(types.HandlerStartTime, time.Now())
+				err := fmt.Errorf("ERR_UNAUTHORIZED")
+				echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+					"error":   err.Error(),
+					"message": "missing authentication information",
+				})
+				a.logger.Log(ctx, err)
+				return echoErr
+			}
+
+			for _, r := range user.Roles {
+				if r == role {
+					return hf(ctx)
+				}
+			}
+
+			ctx.Set(types.HandlerStartTime, time.Now())
+			err := fmt.Errorf("ERR_FORBIDDEN")
+			echoErr := ctx.JSON(http.StatusForbidden, echo.Map{
+				"error":   err.Error(),
+				"message": fmt.Sprintf("%s role required", role),
+			})
+			a.logger.Log(ctx, err)
+			return echoErr
+		}
+	}
 }
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Log(echo.Context, error) {}
+
+// userStore only implements the user lookups of the store, the other methods panic
+type userStore struct {
+	postgres.PersistentStore
+	users   map[string]*types.User
+	lookups int
+}
+
+func (s *userStore) GetUserById(_ context.Context, userId string, _ bool) (*types.User, error) {
+	s.lookups++
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func newTestAuth(store postgres.PersistentStore) *auth {
+	return &auth{
+		pgStore:   store,
+		logger:    nopLogger{},
+		userCache: newUserCache(userCacheTTL),
+	}
+}
+
+// serveWithToken runs validateTokenUser as if JWT had verified a token with the claims
+func serveWithToken(a *auth, claims *Claims) int {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	ctx.Set("user", &jwt.Token{Claims: claims, Valid: true})
+
+	handler := a.validateTokenUser(func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	})
+	if err := handler(ctx); err != nil {
+		e.HTTPErrorHandler(err, ctx)
+	}
+
+	return rec.Code
+}
+
+func tokenClaims(userId string, tokenVersion int) *Claims {
+	claims := &Claims{Type: TokenTypeAccess, TokenVersion: tokenVersion}
+	claims.Id = userId
+	claims.Subject = userId
+	return claims
+}
+
+func TestValidateTokenUser(t *testing.T) {
+	store := &userStore{users: map[string]*types.User{
+		"active":   {Id: "active", Username: "active", IsActive: true, TokenVersion: 2},
+		"inactive": {Id: "inactive", Username: "inactive", IsActive: false},
+	}}
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   int
+	}{
+		{name: "current token", claims: tokenClaims("active", 2), want: http.StatusOK},
+		{name: "token issued before a password change", claims: tokenClaims("active", 1), want: http.StatusUnauthorized},
+		{name: "deactivated user", claims: tokenClaims("inactive", 0), want: http.StatusUnauthorized},
+		{name: "deleted user", claims: tokenClaims("deleted", 0), want: http.StatusUnauthorized},
+		{
+			name:   "anonymous pull token",
+			claims: &Claims{Type: TokenTypeAnonymous, StandardClaims: jwt.StandardClaims{Id: PublicPullUserId}},
+			want:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithToken(newTestAuth(store), tt.claims); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTokenUserRevokedOnPasswordChange(t *testing.T) {
+	store := &userStore{users: map[string]*types.User{
+		"user": {Id: "user", Username: "user", IsActive: true, TokenVersion: 1},
+	}}
+	a := newTestAuth(store)
+	claims := tokenClaims("user", 1)
+
+	if got := serveWithToken(a, claims); got != http.StatusOK {
+		t.Fatalf("got status %d before the password change, want %d", got, http.StatusOK)
+	}
+
+	// what a password reset does: bump the version in the store and drop the cached user
+	store.users["user"].TokenVersion++
+	a.userCache.invalidate("user")
+
+	if got := serveWithToken(a, claims); got != http.StatusUnauthorized {
+		t.Errorf("got status %d after the password change, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestValidateTokenUserDeactivated(t *testing.T) {
+	store := &userStore{users: map[string]*types.User{
+		"user": {Id: "user", Username: "user", IsActive: true},
+	}}
+	a := newTestAuth(store)
+	claims := tokenClaims("user", 0)
+
+	if got := serveWithToken(a, claims); got != http.StatusOK {
+		t.Fatalf("got status %d before deactivation, want %d", got, http.StatusOK)
+	}
+
+	store.users["user"].IsActive = false
+	a.userCache.invalidate("user")
+
+	if got := serveWithToken(a, claims); got != http.StatusUnauthorized {
+		t.Errorf("got status %d for a deactivated user's token, want %d", got, http.StatusUnauthorized)
+	}
+	if store.lookups != 2 {
+		t.Errorf("got %d store lookups, want 2 (the user is cached between requests)", store.lookups)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name string
+		user *types.User
+		want int
+	}{
+		{name: "admin", user: &types.User{Id: "admin", Roles: []string{"user", types.RoleAdmin}}, want: http.StatusOK},
+		{name: "user", user: &types.User{Id: "user", Roles: []string{"user"}}, want: http.StatusForbidden},
+		{name: "user without roles", user: &types.User{Id: "user"}, want: http.StatusForbidden},
+		{name: "anonymous", want: http.StatusUnauthorized},
+	}
+
+	a := newTestAuth(&userStore{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/admin/users", nil), rec)
+			if tt.user != nil {
+				ctx.Set(types.UserContextKey, tt.user)
+			}
+
+			handler := a.RequireRole(types.RoleAdmin)(func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusOK)
+			})
+			if err := handler(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/golang-jwt/jwt"
+)
+
+func newTokenConfig() *config.OpenRegistryConfig {
+	return &config.OpenRegistryConfig{
+		Environment: config.Local,
+		Registry:    &config.Registry{Host: "localhost", Port: 5000, SigningSecret: "signing-secret"},
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	cfg := newTokenConfig()
+	user := &types.User{Id: "user-id", Username: "johndoe", TokenVersion: 3, Roles: []string{types.RoleAdmin}}
+	scopes := AccessList{{Type: "repository", Name: "johndoe/alpine", Actions: []string{"pull"}}}
+
+	tests := []struct {
+		name       string
+		sign       func() (string, error)
+		wantType   string
+		wantAccess AccessList
+	}{
+		{
+			name:       "access token with scopes",
+			sign:       func() (string, error) { return NewAccessToken(cfg, user, scopes) },
+			wantType:   TokenTypeAccess,
+			wantAccess: scopes,
+		},
+		{
+			name:       "access token for the user's namespace",
+			sign:       func() (string, error) { return NewAccessToken(cfg, user, nil) },
+			wantType:   TokenTypeAccess,
+			wantAccess: userAccess(user.Username),
+		},
+		{
+			name:       "refresh token",
+			sign:       func() (string, error) { return NewRefreshToken(cfg, user) },
+			wantType:   TokenTypeRefresh,
+			wantAccess: userAccess(user.Username),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Unix()
+			token, err := tt.sign()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ParseAndValidate(cfg, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Type != tt.wantType || claims.Id != user.Id || claims.Subject != user.Id {
+				t.Errorf("got type %q for %q, want %q for %q", claims.Type, claims.Subject, tt.wantType, user.Id)
+			}
+			if claims.TokenVersion != user.TokenVersion || !reflect.DeepEqual(claims.Roles, user.Roles) {
+				t.Errorf("got version %d and roles %v, want %d and %v",
+					claims.TokenVersion, claims.Roles, user.TokenVersion, user.Roles)
+			}
+			if !reflect.DeepEqual(claims.Access, tt.wantAccess) {
+				t.Errorf("got access %+v, want %+v", claims.Access, tt.wantAccess)
+			}
+			if claims.Issuer != cfg.Endpoint() || claims.Audience != cfg.Endpoint() {
+				t.Errorf("got issuer %q and audience %q, want %q", claims.Issuer, claims.Audience, cfg.Endpoint())
+			}
+			if claims.IssuedAt < before || claims.ExpiresAt <= claims.IssuedAt {
+				t.Errorf("got issued at %d and expires at %d, want a live token", claims.IssuedAt, claims.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestParseAndValidateRejects(t *testing.T) {
+	cfg := newTokenConfig()
+	user := &types.User{Id: "user-id", Username: "johndoe"}
+
+	otherSecret := newTokenConfig()
+	otherSecret.Registry.SigningSecret = "other-secret"
+	otherIssuer := newTokenConfig()
+	otherIssuer.Registry.Port = 5001
+
+	expired := newClaims(cfg, user.Id, TokenTypeAccess, 0, nil, nil)
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		sign    func() (string, error)
+		wantErr string
+	}{
+		{
+			name:    "other secret",
+			sign:    func() (string, error) { return NewAccessToken(otherSecret, user, nil) },
+			wantErr: "ERR_PARSE_TOKEN",
+		},
+		{
+			name:    "other issuer",
+			sign:    func() (string, error) { return NewAccessToken(otherIssuer, user, nil) },
+			wantErr: "ERR_INVALID_TOKEN_ISSUER",
+		},
+		{
+			name:    "expired",
+			sign:    func() (string, error) { return signClaims(cfg, &expired) },
+			wantErr: "ERR_PARSE_TOKEN",
+		},
+		{
+			name: "other signing method",
+			sign: func() (string, error) {
+				claims := newClaims(cfg, user.Id, TokenTypeAccess, 0, nil, nil)
+				return jwt.NewWithClaims(jwt.SigningMethodHS512, &claims).SignedString([]byte(cfg.Registry.SigningSecret))
+			},
+			wantErr: "ERR_UNEXPECTED_SIGNING_METHOD",
+		},
+		{
+			name:    "not a token",
+			sign:    func() (string, error) { return "not-a-token", nil },
+			wantErr: "ERR_PARSE_TOKEN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.sign()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ParseAndValidate(cfg, token)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got claims %+v and error %v, want %s", claims, err, tt.wantErr)
+			}
+		})
+	}
+}
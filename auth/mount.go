@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// authorizeBlobMount lets the registry mount a blob from the repository in the from query param only when the user
+// can pull from it. A denied mount isn't an error, the registry starts a regular upload instead, so that the
+// response doesn't reveal whether the blob exists in a repository the user can't access
+func (a *auth) authorizeBlobMount(ctx echo.Context, user *types.User) {
+	from := ctx.QueryParam("from")
+	if ctx.Request().Method != http.MethodPost || ctx.QueryParam("mount") == "" || from == "" {
+		return
+	}
+
+	if a.canPull(ctx.Request().Context(), from, user) {
+		ctx.Set(types.BlobMountAllowedKey, true)
+	}
+}
+
+// canPull applies the same rules as the pull ACL to any repository, user is nil for anonymous requests
+func (a *auth) canPull(ctx context.Context, namespace string, user *types.User) bool {
+	visibility, err := a.pgStore.GetRepositoryVisibility(ctx, namespace)
+	if err != nil {
+		return false
+	}
+	if visibility != types.RepositoryVisibilityPrivate {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+
+	owner := strings.SplitN(namespace, "/", 2)[0]
+	return a.canAccessNamespace(ctx, owner, user.Username, false)
+}
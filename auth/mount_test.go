@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthorizeBlobMount(t *testing.T) {
+	a := newVisibilityAuth("janedoe/private", "johndoe/private")
+	johndoe := &types.User{Id: "johndoe", Username: "johndoe"}
+
+	tests := []struct {
+		name  string
+		query string
+		user  *types.User
+		want  bool
+	}{
+		{name: "public repository", query: "?mount=sha256:abc&from=janedoe/public", user: johndoe, want: true},
+		{name: "own private repository", query: "?mount=sha256:abc&from=johndoe/private", user: johndoe, want: true},
+		{name: "private repository of another user", query: "?mount=sha256:abc&from=janedoe/private", user: johndoe},
+		{name: "anonymous from a public repository", query: "?mount=sha256:abc&from=janedoe/public", want: true},
+		{name: "anonymous from a private repository", query: "?mount=sha256:abc&from=johndoe/private"},
+		{name: "no from", query: "?mount=sha256:abc", user: johndoe},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v2/johndoe/alpine/blobs/uploads/"+tt.query, nil)
+		ctx := echo.New().NewContext(req, httptest.NewRecorder())
+		a.authorizeBlobMount(ctx, tt.user)
+
+		if allowed, _ := ctx.Get(types.BlobMountAllowedKey).(bool); allowed != tt.want {
+			t.Errorf("%s: got the mount allowed %t, want %t", tt.name, allowed, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// canAccessNamespace reports whether the user can push to (or pull the private repositories of) the owner's
+// namespace, the owner is either the user themselves or an organization they're a member of
+func (a *auth) canAccessNamespace(ctx context.Context, owner, username string, push bool) bool {
+	if owner == username {
+		return true
+	}
+
+	role, err := a.pgStore.GetOrganizationRole(ctx, owner, username)
+	if err != nil {
+		return false
+	}
+
+	if push {
+		return role.CanPush()
+	}
+	return role.CanPull()
+}
+
+// CreateOrganization - POST /orgs {"name": "<organization>"}
+// the user creating the organization is its first owner
+func (a *auth) CreateOrganization(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "missing authentication information",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	var org types.Organization
+	if err := ctx.Bind(&org); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid request body",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err := org.Validate(); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	org.CreatedAt = time.Now()
+	if err := a.pgStore.CreateOrganization(ctx.Request().Context(), &org, user); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrConflict) {
+			status = http.StatusConflict
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error creating organization",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusCreated, org)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// ListOrganizationMembers - GET /orgs/:org/members
+// every member can list the members of the organization
+func (a *auth) ListOrganizationMembers(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	org := ctx.Param("org")
+	if _, ok := a.organizationRole(ctx, org); !ok {
+		return nil
+	}
+
+	members, err := a.pgStore.GetOrganizationMembers(ctx.Request().Context(), org)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"organization": org,
+		"members":      members,
+	})
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// SetOrganizationMember - PUT /orgs/:org/members/:username {"role": "owner" | "member" | "reader"}
+// adds the user to the organization or changes their role, only owners can manage the members
+func (a *auth) SetOrganizationMember(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	org := ctx.Param("org")
+	if !a.requireOrganizationOwner(ctx, org) {
+		return nil
+	}
+
+	var body struct {
+		Role types.OrganizationRole `json:"role"`
+	}
+	if err := ctx.Bind(&body); err != nil || !body.Role.IsValid() {
+		err = fmt.Errorf("role must be one of owner, member or reader")
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	member, err := a.pgStore.GetUser(ctx.Request().Context(), ctx.Param("username"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error getting user",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = a.pgStore.SetOrganizationMember(ctx.Request().Context(), org, member.Id, body.Role); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error setting organization member",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// DeleteOrganizationMember - DELETE /orgs/:org/members/:username
+func (a *auth) DeleteOrganizationMember(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	org := ctx.Param("org")
+	if !a.requireOrganizationOwner(ctx, org) {
+		return nil
+	}
+
+	member, err := a.pgStore.GetUser(ctx.Request().Context(), ctx.Param("username"), false)
+	if err == nil {
+		err = a.pgStore.DeleteOrganizationMember(ctx.Request().Context(), org, member.Id)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error deleting organization member",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// organizationRole returns the role of the authenticated user in the organization. The error response is
+// written when the user isn't a member, non members can't tell the organization exists
+func (a *auth) organizationRole(ctx echo.Context, org string) (types.OrganizationRole, bool) {
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		_ = ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "missing authentication information",
+		})
+		a.logger.Log(ctx, err)
+		return "", false
+	}
+
+	role, err := a.pgStore.GetOrganizationRole(ctx.Request().Context(), org, user.Username)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		_ = ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "organization not found",
+		})
+		a.logger.Log(ctx, err)
+		return "", false
+	}
+
+	return role, true
+}
+
+func (a *auth) requireOrganizationOwner(ctx echo.Context, org string) bool {
+	role, ok := a.organizationRole(ctx, org)
+	if !ok {
+		return false
+	}
+
+	if role != types.OrganizationRoleOwner {
+		err := fmt.Errorf("ERR_FORBIDDEN")
+		_ = ctx.JSON(http.StatusForbidden, echo.Map{
+			"error":   err.Error(),
+			"message": "only the owners can manage the members of the organization",
+		})
+		a.logger.Log(ctx, err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// organizationStore holds the members of the organizations, by organization and username
+type organizationStore struct {
+	*visibilityStore
+	roles map[string]map[string]types.OrganizationRole
+}
+
+func (s *organizationStore) GetOrganizationRole(
+	_ context.Context, org, username string,
+) (types.OrganizationRole, error) {
+	role, ok := s.roles[org][username]
+	if !ok {
+		return "", postgres.ErrNotFound
+	}
+	return role, nil
+}
+
+// newOrganizationAuth has the acme organization, owned by alice with bob as a member and carol as a reader. dave
+// isn't a member. The acme/private repository is private
+func newOrganizationAuth() *auth {
+	a := newVisibilityAuth("acme/private")
+	visibility := a.pgStore.(*visibilityStore)
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		visibility.users[username] = &types.User{Id: username, Username: username, IsActive: true}
+	}
+
+	a.pgStore = &organizationStore{
+		visibilityStore: visibility,
+		roles: map[string]map[string]types.OrganizationRole{
+			"acme": {
+				"alice": types.OrganizationRoleOwner,
+				"bob":   types.OrganizationRoleMember,
+				"carol": types.OrganizationRoleReader,
+			},
+		},
+	}
+	return a
+}
+
+// push runs the ACL for a manifest push to namespace with an access token of the user
+func push(a *auth, namespace, userID string) int {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/v2/"+namespace+"/manifests/latest", nil)
+	ctx := e.NewContext(req, rec)
+	parts := strings.SplitN(namespace, "/", 2)
+	ctx.SetParamNames("username", "imagename")
+	ctx.SetParamValues(parts[0], parts[1])
+	ctx.Set("user", &jwt.Token{Claims: tokenClaims(userID, 0), Valid: true})
+
+	handler := a.ACL()(func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusCreated)
+	})
+	if err := handler(ctx); err != nil {
+		e.HTTPErrorHandler(err, ctx)
+	}
+	return rec.Code
+}
+
+func TestOrganizationPush(t *testing.T) {
+	a := newOrganizationAuth()
+
+	tests := []struct {
+		user      string
+		namespace string
+		want      int
+	}{
+		{user: "alice", namespace: "acme/app", want: http.StatusCreated},
+		{user: "bob", namespace: "acme/app", want: http.StatusCreated},
+		{user: "carol", namespace: "acme/app", want: http.StatusUnauthorized},
+		{user: "dave", namespace: "acme/app", want: http.StatusUnauthorized},
+		{user: "dave", namespace: "dave/app", want: http.StatusCreated},
+		{user: "bob", namespace: "dave/app", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if got := push(a, tt.namespace, tt.user); got != tt.want {
+			t.Errorf("%s pushing to %s: got status %d, want %d", tt.user, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestOrganizationPrivatePull(t *testing.T) {
+	a := newOrganizationAuth()
+
+	tests := []struct {
+		user string
+		want int
+	}{
+		{user: "alice", want: http.StatusOK},
+		{user: "bob", want: http.StatusOK},
+		{user: "carol", want: http.StatusOK},
+		{user: "dave", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		user := &types.User{Id: tt.user, Username: tt.user}
+		if got := pull(a, "acme/private", nil, user).Code; got != tt.want {
+			t.Errorf("%s pulling acme/private: got status %d, want %d", tt.user, got, tt.want)
+		}
+	}
+}
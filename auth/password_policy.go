@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// LoadPasswordPolicy builds the password policy from the config, the default policy is used when there's none
+func LoadPasswordPolicy(c *config.PasswordPolicy) (*types.PasswordPolicy, error) {
+	if c == nil {
+		return types.DefaultPasswordPolicy(), nil
+	}
+
+	defaults := types.DefaultPasswordPolicy()
+	policy := &types.PasswordPolicy{
+		MinLength: c.MinLength,
+		MaxLength: c.MaxLength,
+	}
+	if policy.MinLength == 0 {
+		policy.MinLength = defaults.MinLength
+	}
+	if policy.MaxLength == 0 {
+		policy.MaxLength = defaults.MaxLength
+	}
+	if policy.MinLength > policy.MaxLength {
+		return nil, fmt.Errorf("password policy: min_length is greater than max_length")
+	}
+
+	for _, class := range c.RequiredClasses {
+		switch class {
+		case types.PasswordClassLowercase:
+			policy.RequireLowercase = true
+		case types.PasswordClassUppercase:
+			policy.RequireUppercase = true
+		case types.PasswordClassNumber:
+			policy.RequireNumber = true
+		case types.PasswordClassSpecial:
+			policy.RequireSpecial = true
+		default:
+			return nil, fmt.Errorf("password policy: unknown class: %s", class)
+		}
+	}
+
+	if c.CommonPasswordsFile != "" {
+		commonPasswords, err := readCommonPasswords(c.CommonPasswordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("password policy: %w", err)
+		}
+		policy.CommonPasswords = commonPasswords
+	}
+
+	return policy, nil
+}
+
+// readCommonPasswords reads one password per line, the blank lines are skipped
+func readCommonPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			passwords[strings.ToLower(password)] = struct{}{}
+		}
+	}
+
+	return passwords, scanner.Err()
+}
+
+// invalidPassword responds with the requirements the password doesn't meet
+func (a *auth) invalidPassword(ctx echo.Context, err error) error {
+	unmet := []string{err.Error()}
+	var policyErr *types.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		unmet = policyErr.Unmet
+	}
+
+	echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+		"error":        "ERR_INVALID_PASSWORD",
+		"message":      "password doesn't meet the requirements",
+		"requirements": unmet,
+	})
+	a.logger.Log(ctx, err)
+	return echoErr
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	commonPasswords := filepath.Join(t.TempDir(), "common-passwords.txt")
+	if err := os.WriteFile(commonPasswords, []byte("password\n\n  Letmein123  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPasswordPolicy(&config.PasswordPolicy{
+		CommonPasswordsFile: commonPasswords,
+		RequiredClasses:     []string{"number"},
+		MinLength:           10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{password: "correcthorse1", valid: true},
+		{password: "short1", valid: false},
+		{password: "correcthorse", valid: false},
+		{password: "LETMEIN123", valid: false},
+	}
+	for _, tt := range tests {
+		if err = policy.Validate(tt.password); (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %t", tt.password, err, tt.valid)
+		}
+	}
+
+	invalid := []*config.PasswordPolicy{
+		{MinLength: 20, MaxLength: 10},
+		{RequiredClasses: []string{"emoji"}},
+		{CommonPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")},
+	}
+	for _, c := range invalid {
+		if _, err = LoadPasswordPolicy(c); err == nil {
+			t.Errorf("got no error loading %+v", c)
+		}
+	}
+}
+
+func TestInvalidPasswordResponse(t *testing.T) {
+	policy, err := LoadPasswordPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/auth/signup", nil), rec)
+	if err = newTestAuth(nil).invalidPassword(ctx, policy.Validate("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	want := `{"error":"ERR_INVALID_PASSWORD","message":"password doesn't meet the requirements","requirements":` +
+		`["uppercase letter missing","atleast one numeric character required","special character missing",` +
+		`"password length must be between 8 to 64 characters long"]}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("got body %s, want %s", rec.Body, want)
+	}
+}
@@ -1,19 +1,20 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/types"
-	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 )
 
 func (a *auth) RenewAccessToken(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	c, err := ctx.Cookie("refresh")
+	c, err := ctx.Cookie(RefreshCookKey)
 	if err != nil {
 		if err == http.ErrNoCookie {
 			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
@@ -31,50 +32,53 @@ func (a *auth) RenewAccessToken(ctx echo.Context) error {
 		return echoErr
 	}
 	refreshCookie := c.Value
-	var claims Claims
-	tkn, err := jwt.ParseWithClaims(refreshCookie, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(a.c.Registry.SigningSecret), nil
-	})
+	claims, err := ParseAndValidate(a.c, refreshCookie)
 	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
-				"error":   err.Error(),
-				"message": "signature error, unauthorised",
-			})
-			a.logger.Log(ctx, err)
-			return echoErr
-		}
-
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 			"error":   err.Error(),
-			"message": "error parsing claims",
+			"message": "invalid token, unauthorised",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	if !tkn.Valid {
-		err := fmt.Errorf("invalid token, Unauthorised")
+	userId := claims.Id
+	user, err := a.pgStore.GetUserById(ctx.Request().Context(), userId, false)
+	if err != nil {
 		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 			"error":   err.Error(),
-			"message": "invalid token, unauthorised",
+			"message": "user not found in database, unauthorised",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	userId := claims.Id
-	user, err := a.pgStore.GetUserById(ctx.Request().Context(), userId, false)
-	if err != nil {
+	// refresh tokens issued before the last password change must not mint new access tokens
+	if claims.TokenVersion != user.TokenVersion {
+		err = fmt.Errorf("ERR_TOKEN_VERSION_MISMATCH")
 		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 			"error":   err.Error(),
-			"message": "user not found in database, unauthorised",
+			"message": "token has been revoked, please sign in again",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	// the refresh token stops working once its session is revoked
+	if err = a.pgStore.TouchSession(ctx.Request().Context(), refreshCookie); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusUnauthorized
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "session has been revoked, please sign in again",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	tokenString, err := a.newWebLoginToken(userId, user.Username, "access")
+	tokenString, err := a.newWebLoginToken(userId, user.Username, TokenTypeAccess, user.TokenVersion, user.Roles)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
@@ -84,7 +88,7 @@ func (a *auth) RenewAccessToken(ctx echo.Context) error {
 		return echoErr
 	}
 
-	accessCookie := a.createCookie("access", tokenString, true, time.Now().Add(time.Hour))
+	accessCookie := a.createCookie(AccessCookieKey, tokenString, true, time.Now().Add(time.Hour))
 	ctx.SetCookie(accessCookie)
 	err = ctx.NoContent(http.StatusNoContent)
 	a.logger.Log(ctx, err)
@@ -7,9 +7,9 @@ import (
 	"net/http"
 
 	"github.com/containerish/OpenRegistry/services/email"
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/golang-jwt/jwt"
-	"github.com/jackc/pgx/v4"
 	"github.com/labstack/echo/v4"
 )
 
@@ -59,14 +59,8 @@ func (a *auth) ResetForgottenPassword(ctx echo.Context) error {
 		return echoErr
 	}
 
-	if err = types.ValidatePassword(pwd.NewPassword); err != nil {
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-			"message": `password must be alphanumeric, at least 8 chars long, must have at least one special character 
-and an uppercase letter`,
-		})
-		a.logger.Log(ctx, err)
-		return echoErr
+	if err = a.passwordPolicy.Validate(pwd.NewPassword); err != nil {
+		return a.invalidPassword(ctx, err)
 	}
 
 	if a.verifyPassword(user.Password, pwd.NewPassword) {
@@ -99,6 +93,8 @@ and an uppercase letter`,
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
+	// password change bumps the token version, drop the cached copy so that old tokens are rejected right away
+	a.userCache.invalidate(userId)
 
 	err = ctx.JSON(http.StatusAccepted, echo.Map{
 		"message": "password changed successfully",
@@ -185,14 +181,8 @@ func (a *auth) ResetPassword(ctx echo.Context) error {
 		return echoErr
 	}
 
-	if err = types.ValidatePassword(pwd.NewPassword); err != nil {
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-			"error": err.Error(),
-			"message": `password must be alphanumeric, at least 8 chars long, must have at least one special character 
-and an uppercase letter`,
-		})
-		a.logger.Log(ctx, err)
-		return echoErr
+	if err = a.passwordPolicy.Validate(pwd.NewPassword); err != nil {
+		return a.invalidPassword(ctx, err)
 	}
 
 	if err = a.pgStore.UpdateUserPWD(ctx.Request().Context(), userId, hashPassword); err != nil {
@@ -203,6 +193,8 @@ and an uppercase letter`,
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
+	// password change bumps the token version, drop the cached copy so that old tokens are rejected right away
+	a.userCache.invalidate(userId)
 
 	err = ctx.JSON(http.StatusAccepted, echo.Map{
 		"message": "password changed successfully",
@@ -224,7 +216,7 @@ func (a *auth) ForgotPassword(ctx echo.Context) error {
 
 	user, err := a.pgStore.GetUser(ctx.Request().Context(), userEmail, false)
 	if err != nil {
-		if errors.Unwrap(err) == pgx.ErrNoRows {
+		if errors.Is(err, postgres.ErrNotFound) {
 			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 				"error":   err.Error(),
 				"message": "user does not exist with this email",
@@ -247,7 +239,7 @@ func (a *auth) ForgotPassword(ctx echo.Context) error {
 		})
 	}
 
-	token, err := a.newWebLoginToken(user.Id, user.Username, "short-lived")
+	token, err := a.newWebLoginToken(user.Id, user.Username, TokenTypeShortLived, user.TokenVersion, user.Roles)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
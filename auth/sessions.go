@@ -1,12 +1,14 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -100,3 +102,108 @@ func (a *auth) ExpireSessions(ctx echo.Context) error {
 	a.logger.Log(ctx, err)
 	return err
 }
+
+// ListSessions - GET /auth/sessions
+// lists the signed in user's sessions, so they can spot the devices they don't recognise
+func (a *auth) ListSessions(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "missing authentication information",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	sessions, err := a.pgStore.ListSessions(ctx.Request().Context(), user.Id)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error listing sessions",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if cookie, err := ctx.Cookie("session_id"); err == nil {
+		currentId := strings.Split(cookie.Value, ":")[0]
+		for _, session := range sessions {
+			session.Current = session.Id == currentId
+		}
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"sessions": sessions,
+	})
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// RevokeSession - DELETE /auth/sessions/:id
+// signs the device out, its refresh token stops working. The user's other sessions are left as they are
+func (a *auth) RevokeSession(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		err := fmt.Errorf("ERR_UNAUTHORIZED")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "missing authentication information",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	sessionId := ctx.Param("id")
+	if _, err := uuid.Parse(sessionId); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid session id",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	session, err := a.pgStore.GetSession(ctx.Request().Context(), sessionId)
+	// other users' sessions are reported as not found
+	if err == nil && session.Owner != user.Id {
+		err = fmt.Errorf("ERR_SESSION_NOT_FOUND: %w", postgres.ErrNotFound)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{
+			"error":   err.Error(),
+			"message": "error getting session",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = a.pgStore.DeleteSession(ctx.Request().Context(), session.Id, user.Id); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "could not delete session",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	a.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// addSession records the device the user signed in from along with the session
+func (a *auth) addSession(ctx echo.Context, id, refreshToken, username string) error {
+	return a.pgStore.AddSession(
+		ctx.Request().Context(), id, refreshToken, username, ctx.Request().UserAgent(), ctx.RealIP(),
+	)
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	laptopSession = "6b1c1a5e-2f0b-4d7e-9b0a-9f5f3c1e0a01"
+	phoneSession  = "6b1c1a5e-2f0b-4d7e-9b0a-9f5f3c1e0a02"
+	otherSession  = "6b1c1a5e-2f0b-4d7e-9b0a-9f5f3c1e0a03"
+)
+
+// sessionStore keeps the sessions by id
+type sessionStore struct {
+	*userStore
+	sessions map[string]*types.Session
+}
+
+func (s *sessionStore) GetSession(_ context.Context, sessionId string) (*types.Session, error) {
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *sessionStore) ListSessions(_ context.Context, userId string) ([]*types.Session, error) {
+	sessions := []*types.Session{}
+	for _, id := range []string{laptopSession, phoneSession, otherSession} {
+		if session, ok := s.sessions[id]; ok && session.Owner == userId {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *sessionStore) TouchSession(_ context.Context, refreshToken string) error {
+	for _, session := range s.sessions {
+		if session.RefreshToken == refreshToken {
+			return nil
+		}
+	}
+	return postgres.ErrNotFound
+}
+
+func (s *sessionStore) DeleteSession(_ context.Context, sessionId, userId string) error {
+	if session, ok := s.sessions[sessionId]; ok && session.Owner == userId {
+		delete(s.sessions, sessionId)
+	}
+	return nil
+}
+
+// newSessionAuth signs johndoe in on a laptop and a phone, janedoe has a session too
+func newSessionAuth(t *testing.T) (*auth, *sessionStore) {
+	store := &sessionStore{
+		userStore: &userStore{users: map[string]*types.User{
+			"johndoe": {Id: "johndoe", Username: "johndoe", IsActive: true},
+			"janedoe": {Id: "janedoe", Username: "janedoe", IsActive: true},
+		}},
+		sessions: map[string]*types.Session{},
+	}
+	a := newTestAuth(store)
+	a.c = &config.OpenRegistryConfig{
+		Environment: config.Local,
+		Registry:    &config.Registry{Host: "localhost", Port: 5000, SigningSecret: "signing-secret"},
+	}
+
+	for i, id := range []string{laptopSession, phoneSession, otherSession} {
+		owner := "johndoe"
+		if id == otherSession {
+			owner = "janedoe"
+		}
+		// the tokens signed within the same second are the same, unless they're issued at different times
+		claims := newClaims(a.c, owner, TokenTypeRefresh, 0, nil, userAccess(owner))
+		claims.IssuedAt -= int64(i)
+		refreshToken, err := signClaims(a.c, &claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.sessions[id] = &types.Session{Id: id, Owner: owner, RefreshToken: refreshToken, UserAgent: id}
+	}
+	return a, store
+}
+
+func sessionContext(a *auth, method, target, currentSession string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: currentSession + ":johndoe"})
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(req, rec)
+	user, _ := a.pgStore.GetUserById(context.Background(), "johndoe", false)
+	ctx.Set(types.UserContextKey, user)
+	return ctx, rec
+}
+
+func listSessions(t *testing.T, a *auth) []types.Session {
+	t.Helper()
+
+	ctx, rec := sessionContext(a, http.MethodGet, "/auth/sessions", laptopSession)
+	if err := a.ListSessions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d listing the sessions, want %d", rec.Code, http.StatusOK)
+	}
+	var body struct {
+		Sessions []types.Session `json:"sessions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Sessions
+}
+
+func renew(t *testing.T, a *auth, refreshToken string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/renew", nil)
+	req.AddCookie(&http.Cookie{Name: RefreshCookKey, Value: refreshToken})
+	rec := httptest.NewRecorder()
+	if err := a.RenewAccessToken(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	a, store := newSessionAuth(t)
+	phoneToken := store.sessions[phoneSession].RefreshToken
+	laptopToken := store.sessions[laptopSession].RefreshToken
+
+	sessions := listSessions(t, a)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want the 2 of the user", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.Id == laptopSession) {
+			t.Errorf("session %s: got current %t, want only the laptop's session current", session.Id, session.Current)
+		}
+	}
+
+	ctx, rec := sessionContext(a, http.MethodDelete, "/auth/sessions/"+phoneSession, laptopSession)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(phoneSession)
+	if err := a.RevokeSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d revoking the session, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	sessions = listSessions(t, a)
+	if len(sessions) != 1 || sessions[0].Id != laptopSession {
+		t.Errorf("got sessions %v after the revocation, want only the laptop's", sessions)
+	}
+	if code := renew(t, a, phoneToken); code != http.StatusUnauthorized {
+		t.Errorf("got status %d renewing with the revoked session, want %d", code, http.StatusUnauthorized)
+	}
+	if code := renew(t, a, laptopToken); code != http.StatusNoContent {
+		t.Errorf("got status %d renewing with the other session, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestRevokeSessionNotFound(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionId string
+		want      int
+	}{
+		{name: "session of another user", sessionId: otherSession, want: http.StatusNotFound},
+		{name: "unknown session", sessionId: "6b1c1a5e-2f0b-4d7e-9b0a-9f5f3c1e0aff", want: http.StatusNotFound},
+		{name: "invalid id", sessionId: "not-a-uuid", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, store := newSessionAuth(t)
+			ctx, rec := sessionContext(a, http.MethodDelete, "/auth/sessions/"+tt.sessionId, laptopSession)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(tt.sessionId)
+			if err := a.RevokeSession(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+			if len(store.sessions) != 3 {
+				t.Errorf("got %d sessions left, want all 3", len(store.sessions))
+			}
+		})
+	}
+}
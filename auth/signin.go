@@ -7,9 +7,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v4"
 	"github.com/labstack/echo/v4"
 )
 
@@ -43,17 +43,7 @@ func (a *auth) SignIn(ctx echo.Context) error {
 	}
 
 	userFromDb, err := a.pgStore.GetUser(ctx.Request().Context(), key, true)
-	if err != nil {
-
-		if errors.Unwrap(err) == pgx.ErrNoRows {
-			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-				"error":   err.Error(),
-				"message": "user not found",
-			})
-			a.logger.Log(ctx, err)
-			return echoErr
-		}
-
+	if err != nil && !errors.Is(err, postgres.ErrNotFound) {
 		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error":   err.Error(),
 			"message": "database error, failed to get user",
@@ -62,27 +52,31 @@ func (a *auth) SignIn(ctx echo.Context) error {
 		return echoErr
 	}
 
-	if !userFromDb.IsActive {
-		err = fmt.Errorf("account is inactive, please check your email and verify your account")
+	// unknown users and wrong passwords get the same response, after the same bcrypt comparison
+	if !a.verifyUserPassword(userFromDb, user.Password) {
+		if err == nil {
+			err = fmt.Errorf("password is incorrect")
+		}
 		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "ERR_USER_INACTIVE",
-			"message": err.Error(),
+			"error":   "ERR_INVALID_CREDENTIALS",
+			"message": "username or password is incorrect",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	if !a.verifyPassword(userFromDb.Password, user.Password) {
-		err = fmt.Errorf("password is incorrect")
+	// only tell the account is inactive to whoever knows its password
+	if !userFromDb.IsActive {
+		err = fmt.Errorf("account is inactive, please check your email and verify your account")
 		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "ERR_INCORRECT_PASSWORD",
+			"error":   "ERR_USER_INACTIVE",
 			"message": err.Error(),
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
 
-	access, err := a.newWebLoginToken(userFromDb.Id, userFromDb.Username, "access")
+	access, err := NewAccessToken(a.c, userFromDb, nil)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
@@ -92,7 +86,7 @@ func (a *auth) SignIn(ctx echo.Context) error {
 		return echoErr
 	}
 
-	refresh, err := a.newWebLoginToken(userFromDb.Id, userFromDb.Username, "refresh")
+	refresh, err := NewRefreshToken(a.c, userFromDb)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
@@ -110,7 +104,7 @@ func (a *auth) SignIn(ctx echo.Context) error {
 			"message": "error creating session id",
 		})
 	}
-	if err = a.pgStore.AddSession(ctx.Request().Context(), id.String(), refresh, userFromDb.Username); err != nil {
+	if err = a.addSession(ctx, id.String(), refresh, userFromDb.Username); err != nil {
 		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error":   err.Error(),
 			"message": "error creating session",
@@ -121,12 +115,14 @@ func (a *auth) SignIn(ctx echo.Context) error {
 
 	sessionId := fmt.Sprintf("%s:%s", id, userFromDb.Id)
 	sessionCookie := a.createCookie("session_id", sessionId, false, time.Now().Add(time.Hour*750))
-	accessCookie := a.createCookie("access", access, true, time.Now().Add(time.Hour*750))
-	refreshCookie := a.createCookie("refresh", refresh, true, time.Now().Add(time.Hour*750))
+	accessCookie := a.createCookie(AccessCookieKey, access, true, time.Now().Add(time.Hour*750))
+	refreshCookie := a.createCookie(RefreshCookKey, refresh, true, time.Now().Add(time.Hour*750))
 
 	ctx.SetCookie(accessCookie)
 	ctx.SetCookie(refreshCookie)
 	ctx.SetCookie(sessionCookie)
+	ctx.Set(types.UserContextKey, userFromDb)
+	a.auditLogger.Record(ctx, types.AuditActionLogin, "", "")
 	err = ctx.JSON(http.StatusOK, echo.Map{
 		"token":   access,
 		"refresh": refresh,
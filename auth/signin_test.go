@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *userStore) GetUser(_ context.Context, identifier string, _ bool) (*types.User, error) {
+	for _, user := range s.users {
+		if user.Username == identifier || user.Email == identifier {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, postgres.ErrNotFound
+}
+
+// countComparisons records the cost of the hashes compared until the test ends
+func countComparisons(t *testing.T) *[]int {
+	costs := &[]int{}
+	compare := compareHashAndPassword
+	compareHashAndPassword = func(hashedPassword, password []byte) error {
+		cost, err := bcrypt.Cost(hashedPassword)
+		if err != nil {
+			t.Errorf("compared against an invalid hash: %s", err)
+		}
+		*costs = append(*costs, cost)
+		return compare(hashedPassword, password)
+	}
+	t.Cleanup(func() { compareHashAndPassword = compare })
+
+	return costs
+}
+
+func newSignInStore(t *testing.T) *userStore {
+	hash, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &userStore{users: map[string]*types.User{
+		"active":   {Id: "active", Username: "active", Email: "active@openregistry.dev", Password: hash, IsActive: true},
+		"inactive": {Id: "inactive", Username: "inactive", Email: "inactive@openregistry.dev", Password: hash},
+		"oauth":    {Id: "oauth", Username: "oauth", Email: "oauth@openregistry.dev", IsActive: true},
+	}}
+}
+
+// TestSignInInvalidCredentials checks that whether the user exists doesn't change the response, nor the number
+// and cost of the bcrypt comparisons made, which the response time depends on
+func TestSignInInvalidCredentials(t *testing.T) {
+	a := newTestAuth(newSignInStore(t))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "unknown user", username: "unknown", password: "correct-password"},
+		{name: "wrong password", username: "active", password: "wrong-password"},
+		{name: "user without a password", username: "oauth", password: "wrong-password"},
+		{name: "inactive user with a wrong password", username: "inactive", password: "wrong-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs := countComparisons(t)
+
+			body := `{"username":"` + tt.username + `","email":"user@openregistry.dev","password":"` + tt.password + `"}`
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/auth/signin", strings.NewReader(body))
+			if err := a.SignIn(e.NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "ERR_INVALID_CREDENTIALS") {
+				t.Errorf("got %d %s, want %d with ERR_INVALID_CREDENTIALS", rec.Code, rec.Body, http.StatusUnauthorized)
+			}
+			if len(*costs) != 1 || (*costs)[0] != bcryptMinCost {
+				t.Errorf("got comparisons with the costs %v, want a single one with cost %d", *costs, bcryptMinCost)
+			}
+		})
+	}
+}
+
+func TestValidateUserInvalidCredentials(t *testing.T) {
+	a := newTestAuth(newSignInStore(t))
+
+	for _, username := range []string{"unknown", "active", "oauth"} {
+		t.Run(username, func(t *testing.T) {
+			costs := countComparisons(t)
+
+			_, err := a.validateUser(context.Background(), username, "wrong-password")
+			if err == nil || err.Error() != "invalid username or password" {
+				t.Errorf("got error %v, want invalid username or password", err)
+			}
+			if len(*costs) != 1 || (*costs)[0] != bcryptMinCost {
+				t.Errorf("got comparisons with the costs %v, want a single one with cost %d", *costs, bcryptMinCost)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -39,6 +40,21 @@ func (a *auth) SignUp(ctx echo.Context) error {
 		return echoErr
 	}
 
+	if err := a.passwordPolicy.Validate(u.Password); err != nil {
+		return a.invalidPassword(ctx, err)
+	}
+
+	// users and organizations share the namespace
+	if _, err := a.pgStore.GetOrganization(ctx.Request().Context(), u.Username); err == nil {
+		err = fmt.Errorf("ERR_USERNAME_TAKEN")
+		echoErr := ctx.JSON(http.StatusConflict, echo.Map{
+			"error":   err.Error(),
+			"message": "username already exists",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
 	passwordHash, err := a.hashPassword(u.Password)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
@@ -77,8 +93,8 @@ func (a *auth) SignUp(ctx echo.Context) error {
 
 	err = a.pgStore.AddUser(ctx.Request().Context(), newUser)
 	if err != nil {
-		if strings.Contains(err.Error(), postgres.ErrDuplicateConstraintUsername) {
-			echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+		if errors.Is(err, postgres.ErrConflict) && strings.Contains(err.Error(), postgres.ErrDuplicateConstraintUsername) {
+			echoErr := ctx.JSON(http.StatusConflict, echo.Map{
 				"error":   err.Error(),
 				"message": "username already exists",
 			})
@@ -86,8 +102,8 @@ func (a *auth) SignUp(ctx echo.Context) error {
 			return echoErr
 		}
 
-		if strings.Contains(err.Error(), postgres.ErrDuplicateConstraintEmail) {
-			echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+		if errors.Is(err, postgres.ErrConflict) && strings.Contains(err.Error(), postgres.ErrDuplicateConstraintEmail) {
+			echoErr := ctx.JSON(http.StatusConflict, echo.Map{
 				"error":   err.Error(),
 				"message": "this email already taken, try sign in?",
 			})
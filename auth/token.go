@@ -58,7 +58,7 @@ func (a *auth) Token(ctx echo.Context) error {
 			return err
 		}
 
-		creds, err := a.validateUser(username, password)
+		creds, err := a.validateUser(ctx.Request().Context(), username, password)
 		if err != nil {
 			echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
 				"error":   err.Error(),
@@ -83,26 +83,50 @@ func (a *auth) Token(ctx echo.Context) error {
 		return echoErr
 	}
 
-	// issue a free-public token to pull any repository
-	// TODO (jay-dee7) - this should be restricted to only public repositories in the future
-	if len(scope.Actions) == 1 && scope.Actions["pull"] {
-		token, err := a.newPublicPullToken()
-		if err != nil {
-			echoErr := ctx.NoContent(http.StatusInternalServerError)
-			a.logger.Log(ctx, err)
-			return echoErr
-		}
+	// anonymous tokens can only pull, and only public repositories
+	if len(scope.Actions) != 1 || !scope.Actions["pull"] {
+		err = fmt.Errorf("ERR_ANONYMOUS_SCOPE")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "credentials are required for actions other than pull",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
 
-		echoErr := ctx.JSON(http.StatusOK, echo.Map{
-			"token": token,
+	visibility, err := a.pgStore.GetRepositoryVisibility(ctx.Request().Context(), scope.Name)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error checking repository visibility",
 		})
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
+	if visibility == types.RepositoryVisibilityPrivate {
+		err = fmt.Errorf("ERR_PRIVATE_REPOSITORY")
+		echoErr := ctx.JSON(http.StatusUnauthorized, echo.Map{
+			"error":   err.Error(),
+			"message": "credentials are required to pull a private repository",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	token, ttl, err := a.newPublicPullToken(scope.Name)
+	if err != nil {
+		echoErr := ctx.NoContent(http.StatusInternalServerError)
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
 
-	err = ctx.NoContent(http.StatusUnauthorized)
-	a.logger.Log(ctx, err)
-	return err
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"token":      token,
+		"expires_in": int(ttl.Seconds()),
+		"issued_at":  time.Now(),
+	})
+	a.logger.Log(ctx, nil)
+	return echoErr
 }
 
 func (a *auth) getCredsFromHeader(r *http.Request) (string, string, error) {
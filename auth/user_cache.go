@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+)
+
+const userCacheTTL = time.Second * 30
+
+type (
+	// userCache keeps users looked up for JWT validation around for a short while, so that every
+	// authenticated request doesn't have to hit the database
+	userCache struct {
+		mu    *sync.RWMutex
+		users map[string]cachedUser
+		ttl   time.Duration
+	}
+
+	cachedUser struct {
+		expiresAt time.Time
+		user      *types.User
+	}
+)
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{
+		mu:    &sync.RWMutex{},
+		users: make(map[string]cachedUser),
+		ttl:   ttl,
+	}
+}
+
+func (c *userCache) get(userId string) (*types.User, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.users[userId]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.user, true
+}
+
+func (c *userCache) set(user *types.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users[user.Id] = cachedUser{expiresAt: time.Now().Add(c.ttl), user: user}
+}
+
+// invalidate must be called whenever a user changes in a way that affects their tokens (password, status)
+func (c *userCache) invalidate(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.users, userId)
+}
+
+// getTokenUser returns the user for the token subject, from cache if possible
+func (a *auth) getTokenUser(ctx context.Context, userId string) (*types.User, error) {
+	if user, ok := a.userCache.get(userId); ok {
+		return user, nil
+	}
+
+	user, err := a.pgStore.GetUserById(ctx, userId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	a.userCache.set(user)
+	return user, nil
+}
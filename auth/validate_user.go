@@ -2,27 +2,30 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/labstack/echo/v4"
 )
 
-func (a *auth) validateUser(username, password string) (map[string]interface{}, error) {
+func (a *auth) validateUser(ctx context.Context, username, password string) (map[string]interface{}, error) {
 	if username == "" || password == "" {
 		return nil, fmt.Errorf("Email/Password cannot be empty")
 	}
 
-	userFromDb, err := a.pgStore.GetUser(context.Background(), username, true)
-	if err != nil {
+	userFromDb, err := a.pgStore.GetUser(ctx, username, true)
+	if err != nil && !errors.Is(err, postgres.ErrNotFound) {
 		return nil, err
 	}
 
-	if !a.verifyPassword(userFromDb.Password, password) {
-		return nil, fmt.Errorf("invalid password")
+	// unknown users and wrong passwords get the same error, after the same bcrypt comparison
+	if !a.verifyUserPassword(userFromDb, password) {
+		return nil, fmt.Errorf("invalid username or password")
 	}
 
-	token, err := a.newToken(userFromDb)
+	token, err := NewAccessToken(a.c, userFromDb, nil)
 	if err != nil {
 		return nil, err
 	}
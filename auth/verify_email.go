@@ -75,7 +75,7 @@ func (a *auth) VerifyEmail(ctx echo.Context) error {
 		return echoErr
 	}
 
-	access, err := a.newWebLoginToken(userId, user.Username, "access")
+	access, err := a.newWebLoginToken(userId, user.Username, TokenTypeAccess, user.TokenVersion, user.Roles)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
@@ -84,7 +84,7 @@ func (a *auth) VerifyEmail(ctx echo.Context) error {
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
-	refresh, err := a.newWebLoginToken(userId, user.Username, "refresh")
+	refresh, err := a.newWebLoginToken(userId, user.Username, TokenTypeRefresh, user.TokenVersion, user.Roles)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error":   err.Error(),
@@ -103,7 +103,7 @@ func (a *auth) VerifyEmail(ctx echo.Context) error {
 		a.logger.Log(ctx, err)
 		return echoErr
 	}
-	if err = a.pgStore.AddSession(ctx.Request().Context(), id.String(), refresh, user.Username); err != nil {
+	if err = a.addSession(ctx, id.String(), refresh, user.Username); err != nil {
 		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error":   err.Error(),
 			"message": "error creating session",
@@ -114,8 +114,8 @@ func (a *auth) VerifyEmail(ctx echo.Context) error {
 
 	sessionId := fmt.Sprintf("%s:%s", id, userId)
 	sessionCookie := a.createCookie("session_id", sessionId, false, time.Now().Add(time.Hour*750))
-	accessCookie := a.createCookie("access", access, true, time.Now().Add(time.Hour))
-	refreshCookie := a.createCookie("refresh", refresh, true, time.Now().Add(time.Hour*750))
+	accessCookie := a.createCookie(AccessCookieKey, access, true, time.Now().Add(time.Hour))
+	refreshCookie := a.createCookie(RefreshCookKey, refresh, true, time.Now().Add(time.Hour*750))
 
 	ctx.SetCookie(accessCookie)
 	ctx.SetCookie(refreshCookie)
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// pullACL lets anyone pull from a public repository, private repositories can only be pulled by their owner.
+// Anonymous requests (and the public pull tokens) for a private repository get a Bearer challenge, so that the
+// docker client can retry with the user's credentials. So do the public pull tokens issued for another repository
+func (a *auth) pullACL(ctx echo.Context, hf echo.HandlerFunc) error {
+	username := ctx.Param("username")
+	namespace := types.Namespace(ctx)
+
+	// an anonymous token only pulls the repository it was issued for, even a public one
+	if token, ok := ctx.Get("user").(*jwt.Token); ok {
+		claims, ok := token.Claims.(*Claims)
+		if ok && claims.isAnonymous() && !claims.Access.grants(namespace, "pull") {
+			return a.pullUnauthorized(ctx, namespace)
+		}
+	}
+
+	visibility, err := a.pgStore.GetRepositoryVisibility(ctx.Request().Context(), namespace)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error":   err.Error(),
+			"message": "error checking repository visibility",
+		})
+		a.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if visibility != types.RepositoryVisibilityPrivate {
+		return hf(ctx)
+	}
+
+	user, ok := ctx.Get(types.UserContextKey).(*types.User)
+	if !ok {
+		return a.pullUnauthorized(ctx, namespace)
+	}
+
+	if !a.canAccessNamespace(ctx.Request().Context(), username, user.Username, false) {
+		var errMsg registry.RegistryErrors
+		errMsg.Errors = append(errMsg.Errors, registry.RegistryError{
+			Code:    registry.RegistryErrorCodeDenied,
+			Message: "requested access to the resource is denied",
+			Detail:  map[string]interface{}{"namespace": namespace},
+		})
+		echoErr := ctx.JSON(http.StatusForbidden, errMsg)
+		a.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	return hf(ctx)
+}
+
+// pullUnauthorized challenges the client for a token which can pull namespace
+func (a *auth) pullUnauthorized(ctx echo.Context, namespace string) error {
+	ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, a.pullChallenge(namespace))
+	var errMsg registry.RegistryErrors
+	errMsg.Errors = append(errMsg.Errors, registry.RegistryError{
+		Code:    registry.RegistryErrorCodeUnauthorized,
+		Message: "authentication required",
+		Detail:  map[string]interface{}{"namespace": namespace},
+	})
+	echoErr := ctx.JSON(http.StatusUnauthorized, errMsg)
+	a.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+	return echoErr
+}
+
+func (a *auth) pullChallenge(namespace string) string {
+	return fmt.Sprintf(
+		`Bearer realm="%s/token",service="%s",scope="repository:%s:pull"`,
+		a.c.Endpoint(), a.c.Endpoint(), namespace,
+	)
+}
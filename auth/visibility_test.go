@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// visibilityStore only implements the lookups of pullACL, the other methods panic
+type visibilityStore struct {
+	*userStore
+	private map[string]bool
+}
+
+func (s *visibilityStore) GetRepositoryVisibility(
+	_ context.Context, namespace string,
+) (types.RepositoryVisibility, error) {
+	if s.private[namespace] {
+		return types.RepositoryVisibilityPrivate, nil
+	}
+
+	return types.RepositoryVisibilityPublic, nil
+}
+
+func (s *visibilityStore) GetOrganizationRole(context.Context, string, string) (types.OrganizationRole, error) {
+	return "", postgres.ErrNotFound
+}
+
+func newVisibilityAuth(private ...string) *auth {
+	store := &visibilityStore{userStore: &userStore{users: map[string]*types.User{}}, private: map[string]bool{}}
+	for _, namespace := range private {
+		store.private[namespace] = true
+	}
+
+	a := newTestAuth(store)
+	a.c = &config.OpenRegistryConfig{
+		Environment: config.Local,
+		Registry:    &config.Registry{Host: "localhost", Port: 5000},
+	}
+	return a
+}
+
+// anonymousToken is what newPublicPullToken issues for namespace
+func anonymousToken(namespace string) *jwt.Token {
+	claims := &Claims{
+		Type: TokenTypeAnonymous,
+		Access: AccessList{
+			{Type: "repository", Name: namespace, Actions: []string{"pull"}},
+		},
+	}
+	claims.Id = PublicPullUserId
+	return &jwt.Token{Claims: claims, Valid: true}
+}
+
+// pull runs pullACL for a manifest pull of namespace, token and user are set like the auth middlewares do
+func pull(a *auth, namespace string, token *jwt.Token, user *types.User) *httptest.ResponseRecorder {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/v2/"+namespace+"/manifests/latest", nil), rec)
+	parts := strings.SplitN(namespace, "/", 2)
+	ctx.SetParamNames("username", "imagename")
+	ctx.SetParamValues(parts[0], parts[1])
+	if token != nil {
+		ctx.Set("user", token)
+	}
+	if user != nil {
+		ctx.Set(types.UserContextKey, user)
+	}
+
+	err := a.pullACL(ctx, func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	})
+	if err != nil {
+		e.HTTPErrorHandler(err, ctx)
+	}
+	return rec
+}
+
+func TestPullVisibility(t *testing.T) {
+	a := newVisibilityAuth("johndoe/private")
+	owner := &types.User{Id: "johndoe", Username: "johndoe"}
+	other := &types.User{Id: "janedoe", Username: "janedoe"}
+
+	tests := []struct {
+		name      string
+		namespace string
+		token     *jwt.Token
+		user      *types.User
+		want      int
+	}{
+		{name: "anonymous pull of a public repository", namespace: "johndoe/public", want: http.StatusOK},
+		{
+			name:      "public pull token of a public repository",
+			namespace: "johndoe/public",
+			token:     anonymousToken("johndoe/public"),
+			want:      http.StatusOK,
+		},
+		{name: "other user pulling a public repository", namespace: "johndoe/public", user: other, want: http.StatusOK},
+		{name: "anonymous pull of a private repository", namespace: "johndoe/private", want: http.StatusUnauthorized},
+		{
+			name:      "public pull token of a private repository",
+			namespace: "johndoe/private",
+			token:     anonymousToken("johndoe/private"),
+			want:      http.StatusUnauthorized,
+		},
+		{name: "owner pulling a private repository", namespace: "johndoe/private", user: owner, want: http.StatusOK},
+		{
+			name:      "other user pulling a private repository",
+			namespace: "johndoe/private",
+			user:      other,
+			want:      http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := pull(a, tt.namespace, tt.token, tt.user)
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			// the anonymous requests are challenged, so that docker retries with the user's credentials
+			challenge := rec.Header().Get(echo.HeaderWWWAuthenticate)
+			if tt.want == http.StatusUnauthorized && !strings.Contains(challenge, "repository:"+tt.namespace+":pull") {
+				t.Errorf("got challenge %q, want one for %s", challenge, tt.namespace)
+			}
+		})
+	}
+}
+
+func TestAnonymousTokenScope(t *testing.T) {
+	a := newVisibilityAuth()
+
+	if rec := pull(a, "johndoe/alpine", anonymousToken("johndoe/alpine"), nil); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d pulling with a token for the repository, want %d", rec.Code, http.StatusOK)
+	}
+
+	// the repository is public, but the token was issued for another one
+	rec := pull(a, "johndoe/alpine", anonymousToken("johndoe/busybox"), nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d pulling with a token for another repository, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if challenge := rec.Header().Get(echo.HeaderWWWAuthenticate); !strings.Contains(challenge,
+		`scope="repository:johndoe/alpine:pull"`) {
+		t.Errorf("got challenge %q, want one for the pulled repository", challenge)
+	}
+
+	pushOnly := anonymousToken("johndoe/alpine")
+	pushOnly.Claims.(*Claims).Access[0].Actions = []string{"push"}
+	if rec = pull(a, "johndoe/alpine", pushOnly, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d pulling with a token without pull, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAccessListGrants(t *testing.T) {
+	acl := AccessList{
+		{Type: "repository", Name: "johndoe/*", Actions: []string{"push", "pull"}},
+		{Type: "repository", Name: "janedoe/alpine", Actions: []string{"pull"}},
+	}
+
+	tests := []struct {
+		namespace string
+		action    string
+		want      bool
+	}{
+		{namespace: "johndoe/alpine", action: "pull", want: true},
+		{namespace: "johndoe/tools/alpine", action: "push", want: true},
+		{namespace: "johndoe2/alpine", action: "pull"},
+		{namespace: "janedoe/alpine", action: "pull", want: true},
+		{namespace: "janedoe/alpine", action: "push"},
+		{namespace: "janedoe/busybox", action: "pull"},
+	}
+
+	for _, tt := range tests {
+		if got := acl.grants(tt.namespace, tt.action); got != tt.want {
+			t.Errorf("%s:%s: got %t, want %t", tt.namespace, tt.action, got, tt.want)
+		}
+	}
+}
+
+// TestPrivatePullChallenge pulls a manifest which doesn't exist from a private repository, the anonymous client is
+// challenged before the registry could tell it the manifest is unknown
+func TestPrivatePullChallenge(t *testing.T) {
+	a := newVisibilityAuth("johndoe/private")
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/v2/johndoe/private/manifests/missing", nil), rec)
+	ctx.SetParamNames("username", "imagename")
+	ctx.SetParamValues("johndoe", "private")
+
+	err := a.pullACL(ctx, func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusNotFound, registry.RegistryErrors{
+			Errors: []registry.RegistryError{{Code: registry.RegistryErrorCodeManifestUnknown}},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+	want := `Bearer realm="http://localhost:5000/token",service="http://localhost:5000",` +
+		`scope="repository:johndoe/private:pull"`
+	if got := rec.Header().Get(echo.HeaderWWWAuthenticate); got != want {
+		t.Errorf("got challenge %q, want %q", got, want)
+	}
+	var errs registry.RegistryErrors
+	if err = json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs.Errors) != 1 || errs.Errors[0].Code != registry.RegistryErrorCodeUnauthorized {
+		t.Errorf("got errors %+v, want UNAUTHORIZED", errs.Errors)
+	}
+}
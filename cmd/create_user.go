@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newCreateUserCmd() *cobra.Command {
+	var username, email, password string
+
+	createUserCmd := &cobra.Command{
+		Use:   "create-user",
+		Short: "Create an active user, e.g. to seed the admin account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			passwordPolicy, err := auth.LoadPasswordPolicy(cfg.PasswordPolicy)
+			if err != nil {
+				return err
+			}
+			if err = passwordPolicy.Validate(password); err != nil {
+				return fmt.Errorf("invalid password: %w", err)
+			}
+
+			passwordHash, err := auth.HashPassword(password)
+			if err != nil {
+				return fmt.Errorf("error hashing password: %w", err)
+			}
+
+			pgStore, err := postgres.New(cfg.StoreConfig)
+			if err != nil {
+				return err
+			}
+			defer pgStore.Close()
+
+			user := &types.User{
+				Username: username,
+				Email:    email,
+				Password: passwordHash,
+				IsActive: true,
+			}
+			if err = pgStore.AddUser(cmd.Context(), user); err != nil {
+				return err
+			}
+
+			color.Green("created user: %s (%s)", user.Username, user.Id)
+			return nil
+		},
+	}
+
+	createUserCmd.Flags().StringVar(&username, "username", "", "username for the new user")
+	createUserCmd.Flags().StringVar(&email, "email", "", "email address for the new user")
+	createUserCmd.Flags().StringVar(&password, "password", "", "password for the new user")
+	_ = createUserCmd.MarkFlagRequired("username")
+	_ = createUserCmd.MarkFlagRequired("email")
+	_ = createUserCmd.MarkFlagRequired("password")
+	return createUserCmd
+}
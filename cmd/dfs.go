@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/dfs/filebase"
+)
+
+// newDFS is used by every sub-command which reads or deletes objects, so that they all apply the key layout
+func newDFS(cfg *config.OpenRegistryConfig) (dfs.DFS, error) {
+	layout, err := dfs.NewKeyLayout(cfg.DFS.KeyLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	return dfs.WithTracing(dfs.WithKeyLayout(filebase.New(cfg.DFS.S3Any), layout)), nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/containerish/OpenRegistry/registry/v2/gc"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newGCCmd() *cobra.Command {
+	var gracePeriod time.Duration
+	var dryRun bool
+
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Garbage collect the blobs that are not referenced by any manifest",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			pgStore, err := postgres.New(cfg.StoreConfig)
+			if err != nil {
+				return err
+			}
+			defer pgStore.Close()
+
+			storage, err := newDFS(cfg)
+			if err != nil {
+				return err
+			}
+
+			report, err := gc.New(pgStore, storage).Run(cmd.Context(), gracePeriod, dryRun)
+			if err != nil {
+				return err
+			}
+
+			for _, digest := range report.Removed {
+				color.Yellow("removed: %s", digest)
+			}
+			color.Green("scanned %d layers, removed %d (dry run: %t)", report.Scanned, len(report.Removed), dryRun)
+			return nil
+		},
+	}
+
+	gcCmd.Flags().DurationVar(&gracePeriod, "grace-period", time.Hour*24, "only collect blobs older than this")
+	gcCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the blobs that would be collected")
+	return gcCmd
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/containerish/OpenRegistry/db"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd() *cobra.Command {
+	var migrationsPath string
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending database migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			version, err := postgres.Migrate(cmd.Context(), cfg.StoreConfig, migrationsFS(migrationsPath))
+			if err != nil {
+				return err
+			}
+
+			color.Green("database schema is at version: %d", version)
+			return nil
+		},
+	}
+
+	migrateCmd.PersistentFlags().StringVar(
+		&migrationsPath, "path", "", "directory containing the migration files, defaults to the embedded migrations",
+	)
+	migrateCmd.AddCommand(newMigrateDownCmd(&migrationsPath))
+	return migrateCmd
+}
+
+func newMigrateDownCmd(migrationsPath *string) *cobra.Command {
+	var steps int
+
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the last applied database migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			version, err := postgres.MigrateDown(cmd.Context(), cfg.StoreConfig, migrationsFS(*migrationsPath), steps)
+			if err != nil {
+				return err
+			}
+
+			color.Green("database schema is at version: %d", version)
+			return nil
+		},
+	}
+
+	downCmd.Flags().IntVar(&steps, "steps", 1, "number of migrations to roll back")
+	return downCmd
+}
+
+func migrationsFS(path string) fs.FS {
+	if path != "" {
+		return os.DirFS(path)
+	}
+
+	return db.Migrations()
+}
@@ -0,0 +1,37 @@
+// Package cmd contains the OpenRegistry command line interface
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/spf13/cobra"
+)
+
+// NewRootCmd returns the openregistry command tree. Running it without a sub-command starts the server
+func NewRootCmd() *cobra.Command {
+	serveCmd := newServeCmd()
+
+	rootCmd := &cobra.Command{
+		Use:           "openregistry",
+		Short:         "OpenRegistry is a decentralized, OCI compliant container registry",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          serveCmd.RunE,
+	}
+
+	// the server flags are accepted without the serve sub-command too
+	rootCmd.Flags().AddFlagSet(serveCmd.Flags())
+	rootCmd.AddCommand(serveCmd, newMigrateCmd(), newGCCmd(), newCreateUserCmd())
+	return rootCmd
+}
+
+// loadConfig is used by every sub-command, so that they all read the configuration the same way
+func loadConfig() (*config.OpenRegistryConfig, error) {
+	cfg, err := config.ReadYamlConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading cfg file: %w", err)
+	}
+
+	return cfg, nil
+}
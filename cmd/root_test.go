@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandTree(t *testing.T) {
+	root := NewRootCmd()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"serve"}, want: "serve"},
+		{args: []string{"migrate"}, want: "migrate"},
+		{args: []string{"migrate", "down"}, want: "down"},
+		{args: []string{"gc"}, want: "gc"},
+		{args: []string{"create-user"}, want: "create-user"},
+		{args: []string{}, want: "openregistry"},
+	}
+
+	for _, tt := range tests {
+		cmd, _, err := root.Find(tt.args)
+		if err != nil {
+			t.Fatalf("%v: %s", tt.args, err)
+		}
+		if cmd.Name() != tt.want {
+			t.Errorf("%v: got command %s, want %s", tt.args, cmd.Name(), tt.want)
+		}
+	}
+}
+
+func TestFlagParsing(t *testing.T) {
+	root := NewRootCmd()
+
+	gc, _, err := root.Find([]string{"gc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gc.ParseFlags([]string{"--grace-period", "2h", "--dry-run"}); err != nil {
+		t.Fatal(err)
+	}
+	if gracePeriod, _ := gc.Flags().GetDuration("grace-period"); gracePeriod != time.Hour*2 {
+		t.Errorf("got grace period %s, want 2h", gracePeriod)
+	}
+	if dryRun, _ := gc.Flags().GetBool("dry-run"); !dryRun {
+		t.Error("got dry run false, want true")
+	}
+
+	down, _, err := root.Find([]string{"migrate", "down"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps, _ := down.Flags().GetInt("steps"); steps != 1 {
+		t.Errorf("got %d steps by default, want 1", steps)
+	}
+	if err = down.ParseFlags([]string{"--steps", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if steps, _ := down.Flags().GetInt("steps"); steps != 3 {
+		t.Errorf("got %d steps, want 3", steps)
+	}
+
+	// the server flags are accepted without the serve sub-command
+	if err = root.ParseFlags([]string{"--skip-checks"}); err != nil {
+		t.Fatal(err)
+	}
+	if skip, _ := root.Flags().GetBool("skip-checks"); !skip {
+		t.Error("got skip checks false on the root command, want true")
+	}
+}
+
+// TestCreateUserRequiredFlags checks that the missing flags are reported before the config is read
+func TestCreateUserRequiredFlags(t *testing.T) {
+	root := NewRootCmd()
+	root.SetArgs([]string{"create-user", "--username", "johndoe"})
+
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "required flag") ||
+		!strings.Contains(err.Error(), "email") || !strings.Contains(err.Error(), "password") {
+		t.Errorf("got error %v, want the email and password flags required", err)
+	}
+}
+
+func TestUnknownFlag(t *testing.T) {
+	root := NewRootCmd()
+	root.SetArgs([]string{"gc", "--unknown"})
+
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "unknown flag") {
+		t.Errorf("got error %v, want an unknown flag error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/db"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+)
+
+const selfCheckTimeout = time.Second * 30
+
+// selfCheck verifies the database schema and the DFS before the server starts, so that a misconfigured
+// deployment fails to start rather than failing the first requests. The database connection itself is checked
+// when the store is created
+func selfCheck(ctx context.Context, cfg *config.OpenRegistryConfig, storage dfs.DFS) error {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+
+	if err := postgres.CheckSchema(ctx, cfg.StoreConfig, db.Migrations()); err != nil {
+		return fmt.Errorf("ERR_SELF_CHECK_DATABASE: %w", err)
+	}
+
+	if err := checkDFS(ctx, storage); err != nil {
+		return fmt.Errorf("ERR_SELF_CHECK_DFS: %w", err)
+	}
+
+	color.Green("startup self-check passed")
+	return nil
+}
+
+// checkDFS uploads a small probe object, reads it back and deletes it
+func checkDFS(ctx context.Context, storage dfs.DFS) error {
+	key := fmt.Sprintf("self-check/%s", uuid.NewString())
+	probe := []byte("OpenRegistry self-check " + key)
+
+	if _, err := storage.Upload(ctx, key, digest.FromBytes(probe), probe); err != nil {
+		return err
+	}
+	defer func() {
+		if err := storage.DeleteObject(context.Background(), key); err != nil {
+			color.Yellow("error deleting the self-check probe %s: %s", key, err)
+		}
+	}()
+
+	rc, err := storage.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	bz, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bz, probe) {
+		return fmt.Errorf("the probe read back from %s doesn't match the one uploaded", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+)
+
+var errDFSDown = errors.New("dfs is down")
+
+// downDFS fails every upload, as if the DFS couldn't be reached
+type downDFS struct {
+	*memory.DFS
+}
+
+func (downDFS) Upload(context.Context, string, string, []byte) (string, error) {
+	return "", errDFSDown
+}
+
+// corruptDFS reads back something else than what was uploaded
+type corruptDFS struct {
+	*memory.DFS
+}
+
+func (corruptDFS) Download(context.Context, string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("something else")), nil
+}
+
+func TestCheckDFS(t *testing.T) {
+	storage := memory.New()
+	if err := checkDFS(context.Background(), storage); err != nil {
+		t.Fatalf("got error %v checking a working DFS", err)
+	}
+	if keys := storage.Keys(); len(keys) != 0 {
+		t.Errorf("got objects %v left, want the probe deleted", keys)
+	}
+
+	if err := checkDFS(context.Background(), downDFS{memory.New()}); !errors.Is(err, errDFSDown) {
+		t.Errorf("got error %v checking a DFS which is down, want %v", err, errDFSDown)
+	}
+
+	corrupt := corruptDFS{memory.New()}
+	if err := checkDFS(context.Background(), corrupt); err == nil {
+		t.Error("got no error checking a DFS which doesn't read back the probe")
+	}
+	if keys := corrupt.Keys(); len(keys) != 0 {
+		t.Errorf("got objects %v left, want the probe deleted", keys)
+	}
+}
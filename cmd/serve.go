@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/containerish/OpenRegistry/audit"
+	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/db"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/registry/v2/builds"
+	"github.com/containerish/OpenRegistry/registry/v2/extensions"
+	"github.com/containerish/OpenRegistry/registry/v2/retention"
+	"github.com/containerish/OpenRegistry/router"
+	"github.com/containerish/OpenRegistry/services/email"
+	"github.com/containerish/OpenRegistry/stats"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/telemetry"
+	fluentbit "github.com/containerish/OpenRegistry/telemetry/fluent-bit"
+	"github.com/containerish/OpenRegistry/telemetry/tracing"
+	"github.com/containerish/OpenRegistry/webhooks"
+	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	letsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+	// blobs are sent in a single request body, so the read and write timeouts must allow for large layers
+	// on slow links. Slow clients are still cut off while sending the headers
+	defaultReadTimeout       = time.Minute * 30
+	defaultWriteTimeout      = time.Minute * 30
+	defaultIdleTimeout       = time.Minute * 2
+	defaultReadHeaderTimeout = time.Second * 10
+)
+
+func newServeCmd() *cobra.Command {
+	var skipChecks bool
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the OpenRegistry server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			return serve(cmd.Context(), cfg, skipChecks)
+		},
+	}
+
+	serveCmd.Flags().BoolVar(
+		&skipChecks, "skip-checks", false, "start without checking the database schema and the DFS first",
+	)
+	return serveCmd
+}
+
+func serve(ctx context.Context, cfg *config.OpenRegistryConfig, skipChecks bool) error {
+	e := echo.New()
+
+	shutdownTracing, err := tracing.Setup(cfg.Telemetry)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			color.Red("error flushing traces: %s", err)
+		}
+	}()
+
+	if cfg.StoreConfig.AutoMigrate {
+		version, err := postgres.Migrate(ctx, cfg.StoreConfig, db.Migrations())
+		if err != nil {
+			return fmt.Errorf("ERR_PG_MIGRATE: %w", err)
+		}
+		color.Green("database schema is at version: %d", version)
+	}
+
+	pgStore, err := postgres.New(cfg.StoreConfig)
+	if err != nil {
+		return fmt.Errorf("ERR_PG_CONN: %w", err)
+	}
+	defer pgStore.Close()
+
+	fluentBitCollector, err := fluentbit.New(cfg)
+	if err != nil {
+		return fmt.Errorf("error initializing fluentbit collector: %w", err)
+	}
+
+	logger := telemetry.ZLogger(fluentBitCollector, cfg.Environment, cfg.LogConfig)
+	auditLogger := audit.New(pgStore, logger)
+	defer auditLogger.Close()
+
+	webhookNotifier := webhooks.New(cfg.Webhooks, pgStore)
+	defer webhookNotifier.Close()
+
+	statsRecorder := stats.New(pgStore)
+	defer statsRecorder.Close()
+
+	passwordPolicy, err := auth.LoadPasswordPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		return err
+	}
+	emailClient, err := email.New(cfg.Email, cfg.WebAppEndpoint)
+	if err != nil {
+		return err
+	}
+
+	storage, err := newDFS(cfg)
+	if err != nil {
+		return err
+	}
+	if !skipChecks {
+		if err = selfCheck(ctx, cfg, storage); err != nil {
+			return err
+		}
+	}
+	authSvc := auth.New(cfg, pgStore, storage, logger, auditLogger, passwordPolicy, emailClient)
+
+	reg, err := registry.NewRegistry(pgStore, storage, logger, cfg, auditLogger, webhookNotifier, statsRecorder)
+	if err != nil {
+		return fmt.Errorf("error creating new container registry: %w", err)
+	}
+	defer reg.Close()
+
+	ext, err := extensions.New(pgStore, logger)
+	if err != nil {
+		return fmt.Errorf("error creating new container registry extensions api: %w", err)
+	}
+
+	retentionEvaluator := retention.New(cfg.Retention, pgStore, storage, logger)
+	defer retentionEvaluator.Close()
+
+	readOnly := router.NewReadOnlyMode(cfg.Registry.ReadOnly, logger)
+	stopReload := reloadReadOnlyOnSIGHUP(readOnly)
+	defer stopReload()
+
+	buildTracker := builds.New(pgStore, logger)
+	router.Register(cfg, e, reg, authSvc, ext, auditLogger, retentionEvaluator, buildTracker, readOnly)
+	return fmt.Errorf("error initialising OpenRegistry Server: %w", buildHTTPServer(cfg, e))
+}
+
+func buildHTTPServer(cfg *config.OpenRegistryConfig, e *echo.Echo) error {
+	color.Green("Environment: %s", cfg.Environment)
+	color.Green("Service Endpoint: %s\n", cfg.Endpoint())
+
+	configureHTTPServer(e.Server, cfg.Registry)
+	configureHTTPServer(e.TLSServer, cfg.Registry)
+	e.DisableHTTP2 = cfg.Registry.DisableHTTP2
+
+	if !cfg.Registry.TLS.Enabled() {
+		return e.Start(cfg.Registry.Address())
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.Registry)
+	if err != nil {
+		return err
+	}
+	e.TLSServer.Addr = cfg.Registry.Address()
+	e.TLSServer.TLSConfig = tlsConfig
+
+	if cfg.Registry.TLS.ACMEEnabled() {
+		configureACME(&e.AutoTLSManager, cfg.Registry)
+		tlsConfig.GetCertificate = e.AutoTLSManager.GetCertificate
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+		if cfg.Registry.TLS.HTTPPort != 0 {
+			go serveHTTPSRedirect(cfg.Registry, e.AutoTLSManager.HTTPHandler)
+		}
+
+		return e.StartServer(e.TLSServer)
+	}
+
+	// fail on startup rather than on the first handshake
+	cert, key, err := cfg.Registry.TLS.Load()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return err
+	}
+	tlsConfig.Certificates = []tls.Certificate{certificate}
+
+	if cfg.Registry.TLS.HTTPPort != 0 {
+		go serveHTTPSRedirect(cfg.Registry, nil)
+	}
+
+	return e.StartServer(e.TLSServer)
+}
+
+// newTLSConfig applies the minimum TLS version, echo.StartTLS and StartAutoTLS would replace the config of the
+// server, so the TLS server is started with StartServer and the config negotiates HTTP/2 itself
+func newTLSConfig(registry *config.Registry) (*tls.Config, error) {
+	minVersion, err := registry.TLS.MinTLSVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion} //nolint:gosec // the version is set by the config
+	if !registry.DisableHTTP2 {
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2")
+	}
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, "http/1.1")
+
+	return tlsConfig, nil
+}
+
+func configureHTTPServer(s *http.Server, registry *config.Registry) {
+	s.ReadTimeout = durationOrDefault(registry.ReadTimeout, defaultReadTimeout)
+	s.WriteTimeout = durationOrDefault(registry.WriteTimeout, defaultWriteTimeout)
+	s.IdleTimeout = durationOrDefault(registry.IdleTimeout, defaultIdleTimeout)
+	s.ReadHeaderTimeout = durationOrDefault(registry.ReadHeaderTimeout, defaultReadHeaderTimeout)
+
+	s.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	if registry.MaxHeaderBytes > 0 {
+		s.MaxHeaderBytes = registry.MaxHeaderBytes
+	}
+}
+
+func durationOrDefault(d, defaultDuration time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+
+	return defaultDuration
+}
+
+// configureACME only allows certificates for the registry DNS address, so that random SNI values can't
+// exhaust the Let's Encrypt rate limits
+func configureACME(m *autocert.Manager, registry *config.Registry) {
+	acmeCfg := registry.TLS.ACME
+	m.Prompt = autocert.AcceptTOS
+	m.HostPolicy = autocert.HostWhitelist(registry.DNSAddress)
+	m.Email = acmeCfg.Email
+
+	if acmeCfg.CacheDir != "" {
+		m.Cache = autocert.DirCache(acmeCfg.CacheDir)
+	}
+
+	if acmeCfg.Staging {
+		m.Client = &acme.Client{DirectoryURL: letsEncryptStagingURL}
+	}
+
+	color.Green("requesting TLS certificates for %s from Let's Encrypt", registry.DNSAddress)
+}
+
+// serveHTTPSRedirect redirects the plain HTTP requests to the same path on the HTTPS listener. wrap, if set,
+// wraps the redirect handler, e.g. to answer the ACME HTTP-01 challenges
+func serveHTTPSRedirect(registry *config.Registry, wrap func(fallback http.Handler) http.Handler) {
+	redirect := echo.New()
+	redirect.Any("/*", func(ctx echo.Context) error {
+		host, _, err := net.SplitHostPort(ctx.Request().Host)
+		if err != nil {
+			host = ctx.Request().Host
+		}
+
+		if registry.Port != 443 {
+			host = net.JoinHostPort(host, strconv.FormatUint(uint64(registry.Port), 10))
+		}
+
+		return ctx.Redirect(http.StatusMovedPermanently, "https://"+host+ctx.Request().RequestURI)
+	})
+
+	var handler http.Handler = redirect
+	if wrap != nil {
+		handler = wrap(redirect)
+	}
+
+	addr := net.JoinHostPort(registry.Host, strconv.FormatUint(uint64(registry.TLS.HTTPPort), 10))
+	color.Green("redirecting HTTP requests on %s to HTTPS", addr)
+	server := &http.Server{Addr: addr, Handler: handler}
+	configureHTTPServer(server, registry)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		color.Red("error serving HTTP to HTTPS redirect: %s", err)
+	}
+}
+
+// reloadReadOnlyOnSIGHUP reads the config again on SIGHUP and applies its read-only flag, the rest of the config
+// needs a restart
+func reloadReadOnlyOnSIGHUP(readOnly *router.ReadOnlyMode) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			cfg, err := loadConfig()
+			if err != nil {
+				color.Red("error reloading the config: %s", err)
+				continue
+			}
+			readOnly.Set(cfg.Registry.ReadOnly)
+			color.Yellow("config reloaded, read-only mode: %t", cfg.Registry.ReadOnly)
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// selfSignedCert returns a PEM encoded certificate and key for 127.0.0.1
+func selfSignedCert(t *testing.T) (cert, key []byte) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "openregistry.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key
+}
+
+// startTLSServer serves e with buildHTTPServer on a random port and returns its address
+func startTLSServer(t *testing.T, cfg *config.OpenRegistryConfig, e *echo.Echo) string {
+	t.Helper()
+
+	e.HideBanner = true
+	e.HidePort = true
+	errs := make(chan error, 1)
+	go func() { errs <- buildHTTPServer(cfg, e) }()
+	t.Cleanup(func() { _ = e.Shutdown(context.Background()) })
+
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errs:
+			t.Fatalf("the server stopped: %s", err)
+		default:
+		}
+		if addr := e.TLSListenerAddr(); addr != nil {
+			return addr.String()
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("the server didn't start listening")
+	return ""
+}
+
+func TestTLSHandshake(t *testing.T) {
+	cert, key := selfSignedCert(t)
+	cfg := &config.OpenRegistryConfig{
+		Registry: &config.Registry{
+			Host: "127.0.0.1",
+			TLS:  config.TLS{PubKey: string(cert), PrivateKey: string(key), MinVersion: "1.3"},
+		},
+	}
+	e := echo.New()
+	e.GET("/v2/", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "{}")
+	})
+	addr := startTLSServer(t, cfg, e)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(cert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + addr + "/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "{}" {
+		t.Errorf("got %d %s, want 200", resp.StatusCode, body)
+	}
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("got TLS state %+v, want TLS 1.3", resp.TLS)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("got protocol %s, want HTTP/2", resp.Proto)
+	}
+
+	// the certificate isn't trusted by default
+	if _, err = tls.Dial("tcp", addr, &tls.Config{MinVersion: tls.VersionTLS12}); err == nil {
+		t.Error("got a handshake without trusting the certificate")
+	}
+
+	// the versions below MinVersion are rejected
+	_, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12})
+	if err == nil {
+		t.Error("got a TLS 1.2 handshake, want it rejected")
+	}
+}
+
+func TestInvalidKeyPair(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	_, otherKey := selfSignedCert(t)
+	cfg := &config.OpenRegistryConfig{
+		Registry: &config.Registry{
+			Host: "127.0.0.1",
+			TLS:  config.TLS{PubKey: string(cert), PrivateKey: string(otherKey)},
+		},
+	}
+
+	if err := buildHTTPServer(cfg, echo.New()); err == nil {
+		t.Fatal("got no error starting with a mismatched key pair")
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	var m autocert.Manager
+	configureACME(&m, &config.Registry{
+		DNSAddress: "registry.openregistry.test",
+		TLS:        config.TLS{ACME: &config.ACME{Enabled: true, Email: "admin@openregistry.test"}},
+	})
+
+	if err := m.HostPolicy(context.Background(), "registry.openregistry.test"); err != nil {
+		t.Errorf("got error %s for the registry address, want it allowed", err)
+	}
+	for _, host := range []string{"openregistry.test", "evil.registry.openregistry.test", "random.example.com"} {
+		if err := m.HostPolicy(context.Background(), host); err == nil {
+			t.Errorf("%s: got the host allowed, want it rejected", host)
+		}
+	}
+	if m.Email != "admin@openregistry.test" || m.Client != nil {
+		t.Errorf("got email %s and client %v, want the configured email and the production directory", m.Email, m.Client)
+	}
+}
+
+func TestACMEStaging(t *testing.T) {
+	var m autocert.Manager
+	configureACME(&m, &config.Registry{
+		DNSAddress: "registry.openregistry.test",
+		TLS:        config.TLS{ACME: &config.ACME{Enabled: true, Staging: true, CacheDir: t.TempDir()}},
+	})
+
+	if m.Client == nil || m.Client.DirectoryURL != letsEncryptStagingURL {
+		t.Errorf("got client %+v, want the staging directory", m.Client)
+	}
+	if m.Cache == nil {
+		t.Error("got no certificate cache with a cache dir")
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	var defaults http.Server
+	configureHTTPServer(&defaults, &config.Registry{})
+	if defaults.ReadTimeout != defaultReadTimeout || defaults.WriteTimeout != defaultWriteTimeout ||
+		defaults.IdleTimeout != defaultIdleTimeout || defaults.ReadHeaderTimeout != defaultReadHeaderTimeout {
+		t.Errorf("got timeouts read %s, write %s, idle %s and read header %s, want the defaults",
+			defaults.ReadTimeout, defaults.WriteTimeout, defaults.IdleTimeout, defaults.ReadHeaderTimeout)
+	}
+	if defaults.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+		t.Errorf("got max header bytes %d, want %d", defaults.MaxHeaderBytes, http.DefaultMaxHeaderBytes)
+	}
+
+	var configured http.Server
+	configureHTTPServer(&configured, &config.Registry{
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute * 2,
+		IdleTimeout:       time.Second * 30,
+		ReadHeaderTimeout: time.Second * 5,
+		MaxHeaderBytes:    1 << 16,
+	})
+	if configured.ReadTimeout != time.Minute || configured.WriteTimeout != time.Minute*2 ||
+		configured.IdleTimeout != time.Second*30 || configured.ReadHeaderTimeout != time.Second*5 {
+		t.Errorf("got timeouts read %s, write %s, idle %s and read header %s, want the configured ones",
+			configured.ReadTimeout, configured.WriteTimeout, configured.IdleTimeout, configured.ReadHeaderTimeout)
+	}
+	if configured.MaxHeaderBytes != 1<<16 {
+		t.Errorf("got max header bytes %d, want %d", configured.MaxHeaderBytes, 1<<16)
+	}
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	cert, key := selfSignedCert(t)
+	cfg := &config.OpenRegistryConfig{
+		Registry: &config.Registry{
+			Host:              "127.0.0.1",
+			TLS:               config.TLS{PubKey: string(cert), PrivateKey: string(key)},
+			ReadHeaderTimeout: time.Millisecond * 100,
+		},
+	}
+	e := echo.New()
+	addr := startTLSServer(t, cfg, e)
+	if e.TLSServer.ReadHeaderTimeout != time.Millisecond*100 || e.Server.ReadHeaderTimeout != time.Millisecond*100 {
+		t.Fatalf("got read header timeouts %s and %s, want the configured one",
+			e.TLSServer.ReadHeaderTimeout, e.Server.ReadHeaderTimeout)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(cert)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the request line is sent, the headers never are
+	if _, err = io.WriteString(conn, "GET /v2/ HTTP/1.1\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err = io.ReadAll(conn); err != nil {
+		t.Fatalf("got error %s, want the server to close the connection", err)
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
@@ -28,11 +31,25 @@ type (
 		WebAppErrorRedirectPath string      `yaml:"web_app_error_redirect_path" mapstructure:"web_app_error_redirect_path"`
 		Environment             Environment `yaml:"environment" mapstructure:"environment" validate:"required"`
 		Debug                   bool        `yaml:"debug" mapstructure:"debug"`
+		// Admins are granted the admin role on startup, which allows them to use the /admin APIs. The first user to
+		// sign up is granted the role when the list is empty
+		Admins       []string      `yaml:"admins" mapstructure:"admins"`
+		Webhooks     []*Webhook    `yaml:"webhooks" mapstructure:"webhooks" validate:"dive"`
+		ContentTrust *ContentTrust `yaml:"content_trust" mapstructure:"content_trust"`
+		Quota        *Quota        `yaml:"quota" mapstructure:"quota"`
+		Telemetry    *Telemetry    `yaml:"telemetry" mapstructure:"telemetry"`
+		Retention    *Retention    `yaml:"retention" mapstructure:"retention"`
+		// PasswordPolicy - the default policy is used without it
+		PasswordPolicy *PasswordPolicy `yaml:"password_policy" mapstructure:"password_policy"`
 	}
 
 	DFS struct {
 		Skynet *Skynet          `yaml:"skynet" mapstructure:"skynet"`
 		S3Any  *S3CompatibleDFS `yaml:"s3_any" mapstructure:"s3_any"`
+		// KeyLayout is a text/template mapping the keys of the objects to the keys they're stored at, see
+		// dfs.KeyFields. It's checked on startup, empty stores the objects at the keys the registry uses. The objects
+		// stored before it's set are still read and deleted at the registry keys
+		KeyLayout string `yaml:"key_layout" mapstructure:"key_layout"`
 	}
 
 	S3CompatibleDFS struct {
@@ -45,18 +62,134 @@ type (
 	}
 
 	Registry struct {
-		TLS           TLS      `yaml:"tls" mapstructure:"tls" validate:"-"`
-		DNSAddress    string   `yaml:"dns_address" mapstructure:"dns_address" validate:"required"`
-		FQDN          string   `yaml:"fqdn" mapstructure:"fqdn" validate:"required"`
-		SigningSecret string   `yaml:"jwt_signing_secret" mapstructure:"jwt_signing_secret" validate:"required"`
-		Host          string   `yaml:"host" mapstructure:"host" validate:"required"`
-		Services      []string `yaml:"services" mapstructure:"services" validate:"-"`
-		Port          uint     `yaml:"port" mapstructure:"port" validate:"required"`
+		TLS        TLS    `yaml:"tls" mapstructure:"tls" validate:"-"`
+		DNSAddress string `yaml:"dns_address" mapstructure:"dns_address" validate:"required"`
+		FQDN       string `yaml:"fqdn" mapstructure:"fqdn" validate:"required"`
+		// SigningSecret signs the JWTs with HS256, it needs 32 bytes outside the local and CI environments. It's read
+		// from the OPENREGISTRY_JWT_SIGNING_SECRET env variable or from SigningSecretFile when they're set
+		//nolint
+		SigningSecret     string   `yaml:"jwt_signing_secret" mapstructure:"jwt_signing_secret" validate:"required,signing_secret"`
+		SigningSecretFile string   `yaml:"jwt_signing_secret_file" mapstructure:"jwt_signing_secret_file"`
+		Host              string   `yaml:"host" mapstructure:"host" validate:"required"`
+		Services          []string `yaml:"services" mapstructure:"services" validate:"-"`
+		Port              uint     `yaml:"port" mapstructure:"port" validate:"required"`
+		// the timeouts and MaxHeaderBytes are applied to the HTTP(S) server, a zero value uses the registry default
+		ReadTimeout       time.Duration `yaml:"read_timeout" mapstructure:"read_timeout"`
+		WriteTimeout      time.Duration `yaml:"write_timeout" mapstructure:"write_timeout"`
+		IdleTimeout       time.Duration `yaml:"idle_timeout" mapstructure:"idle_timeout"`
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" mapstructure:"read_header_timeout"`
+		MaxHeaderBytes    int           `yaml:"max_header_bytes" mapstructure:"max_header_bytes"`
+		// DisableHTTP2 only serves HTTP/1.1 over TLS, HTTP/2 is negotiated by default
+		DisableHTTP2 bool `yaml:"disable_http2" mapstructure:"disable_http2"`
+		// RecompressLayers gzip compresses the layers pushed as plain tar archives in the background, the compressed
+		// copy replaces the layer. It's served compressed to the clients which accept gzip, decoded to the others
+		RecompressLayers bool `yaml:"recompress_layers" mapstructure:"recompress_layers"`
+		// MaxNamespaceDepth is the number of path components a repository name can have, e.g. team/project/app
+		// has three. Zero uses the registry default
+		MaxNamespaceDepth int `yaml:"max_namespace_depth" mapstructure:"max_namespace_depth" validate:"gte=0"`
+		// DefaultPageSize is used by the catalog and tags list when the n query param is missing, n is capped at
+		// MaxPageSize. Zero uses the registry default
+		DefaultPageSize int64 `yaml:"default_page_size" mapstructure:"default_page_size" validate:"gte=0"`
+		MaxPageSize     int64 `yaml:"max_page_size" mapstructure:"max_page_size" validate:"gte=0"`
+		// DeleteUntaggedManifests deletes a manifest along with its last tag, by default it stays pullable by digest
+		DeleteUntaggedManifests bool `yaml:"delete_untagged_manifests" mapstructure:"delete_untagged_manifests"`
+		// EnableProfiling serves the pprof profiles and the runtime metrics (expvar) under /debug, to admins only
+		EnableProfiling bool `yaml:"enable_profiling" mapstructure:"enable_profiling"`
+		// MaxConcurrentRequests caps the /v2 requests handled at once, there are no limits without it
+		MaxConcurrentRequests *ConcurrencyLimit `yaml:"max_concurrent_requests" mapstructure:"max_concurrent_requests"`
+		// MaxConcurrentDownloadsPerClient caps the blob downloads served at once to a single client, a user or an
+		// IP for the anonymous pulls, and MaxConcurrentDownloads the ones served to all of them. The downloads over
+		// a limit wait up to DownloadQueueTimeout, then get 429 (or 503 for the global limit). Zero doesn't limit them
+		//nolint
+		MaxConcurrentDownloadsPerClient int `yaml:"max_concurrent_downloads_per_client" mapstructure:"max_concurrent_downloads_per_client" validate:"gte=0"`
+		//nolint
+		MaxConcurrentDownloads int `yaml:"max_concurrent_downloads" mapstructure:"max_concurrent_downloads" validate:"gte=0"`
+		//nolint
+		DownloadQueueTimeout time.Duration `yaml:"download_queue_timeout" mapstructure:"download_queue_timeout" validate:"gte=0"`
+		// RateLimit throttles the /v2 requests, the anonymous ones harder than the authenticated ones. There are no
+		// limits without it
+		RateLimit *RateLimit `yaml:"rate_limit" mapstructure:"rate_limit"`
+		// ReadOnly rejects the pushes and deletes with 405 while the pulls are served, e.g. during maintenance. It's
+		// applied again when the config is reloaded (SIGHUP), and admins can toggle it at runtime
+		ReadOnly bool `yaml:"read_only" mapstructure:"read_only"`
+		// UploadStagingDir stages the chunks of the uploads in files on local disk, which are uploaded to the DFS once
+		// the upload is complete. By default every chunk is uploaded to the DFS as a part of a multipart upload
+		UploadStagingDir string `yaml:"upload_staging_dir" mapstructure:"upload_staging_dir"`
+		// UploadPartsInStore keeps the part list of the chunked uploads in the upload sessions table only, each chunk
+		// appends its parts to it. The memory held by an upload then doesn't grow with its number of parts
+		UploadPartsInStore bool `yaml:"upload_parts_in_store" mapstructure:"upload_parts_in_store"`
+		// MaxBodySize caps the request bodies, in bytes, except for the blob uploads. Manifests can always be up to
+		// 4MiB. Zero uses the registry default
+		MaxBodySize int64 `yaml:"max_body_size" mapstructure:"max_body_size" validate:"gte=0"`
+		// AnonymousTokenTTL is the lifetime of the pull tokens /token issues without credentials, they're scoped to the
+		// requested public repository. Zero uses the registry default
+		AnonymousTokenTTL time.Duration `yaml:"anonymous_token_ttl" mapstructure:"anonymous_token_ttl" validate:"gte=0"`
+		// TrustedProxies are the CIDRs (or IPs) of the load balancers in front of the registry, the client IP is read
+		// from X-Forwarded-For or X-Real-IP only for the requests they send. Without it the headers are ignored
+		TrustedProxies []string `yaml:"trusted_proxies" mapstructure:"trusted_proxies" validate:"dive,cidr|ip"`
+		// ImageConfigCacheSize is the number of parsed image configs the config endpoint keeps in memory, the least
+		// recently read ones are evicted. Zero uses the registry default
+		ImageConfigCacheSize int `yaml:"image_config_cache_size" mapstructure:"image_config_cache_size" validate:"gte=0"`
+		// DownloadURLTTL is the lifetime of the pre-signed URLs the blobs download-url endpoint returns. Zero uses the
+		// registry default
+		DownloadURLTTL time.Duration `yaml:"download_url_ttl" mapstructure:"download_url_ttl" validate:"gte=0"`
+		// RedirectBlobPulls answers the blob pulls with a 307 to a pre-signed DFS URL, or to the DFS link resolver
+		// when the DFS can't sign URLs, so that the blobs don't go through the registry. The blobs are streamed
+		// (and their digest checked) by the registry when it's off or the DFS isn't publicly fetchable
+		RedirectBlobPulls bool `yaml:"redirect_blob_pulls" mapstructure:"redirect_blob_pulls"`
+		// AllowedMediaTypes rejects the manifests whose media type, config media type or layer media types aren't in
+		// the list, an entry ending with * allows the media types starting with it. Every media type is allowed
+		// without it
+		AllowedMediaTypes []string `yaml:"allowed_media_types" mapstructure:"allowed_media_types"`
+		// RegistryClientUserAgents are the User-Agent prefixes of the registry clients (docker/, containerd/ ...),
+		// their /v2 requests skip the browser-oriented middlewares like CORS. Empty uses the registry defaults
+		RegistryClientUserAgents []string `yaml:"registry_client_user_agents" mapstructure:"registry_client_user_agents"`
+	}
+
+	// ConcurrencyLimit - reads (GET and HEAD) and writes have separate limits, zero doesn't limit them. A request
+	// over the limit waits up to QueueTimeout for another one to finish, then gets 503 with Retry-After
+	ConcurrencyLimit struct {
+		QueueTimeout time.Duration `yaml:"queue_timeout" mapstructure:"queue_timeout"`
+		Reads        int           `yaml:"reads" mapstructure:"reads" validate:"gte=0"`
+		Writes       int           `yaml:"writes" mapstructure:"writes" validate:"gte=0"`
+	}
+
+	// RateLimit - the requests without a valid token (or with an anonymous one) are limited per IP, the
+	// authenticated ones per user
+	RateLimit struct {
+		Anonymous     RateLimitBucket `yaml:"anonymous" mapstructure:"anonymous"`
+		Authenticated RateLimitBucket `yaml:"authenticated" mapstructure:"authenticated"`
 	}
 
+	// RateLimitBucket - Rate is the requests per second, Burst the requests allowed at once on top of it (it
+	// defaults to the rate). A zero rate doesn't limit the requests. The idle clients are forgotten after ExpiresIn
+	RateLimitBucket struct {
+		Rate      float64       `yaml:"rate" mapstructure:"rate" validate:"gte=0"`
+		Burst     int           `yaml:"burst" mapstructure:"burst" validate:"gte=0"`
+		ExpiresIn time.Duration `yaml:"expires_in" mapstructure:"expires_in"`
+	}
+
+	// TLS - PrivateKey and PubKey are either paths to PEM files or the PEM encoded key and certificate.
+	// The registry is served over HTTPS when both are set
 	TLS struct {
 		PrivateKey string `yaml:"priv_key" mapstructure:"priv_key"`
 		PubKey     string `yaml:"pub_key" mapstructure:"pub_key"`
+		// ACME gets the certificate for DNSAddress from Let's Encrypt instead, PrivateKey and PubKey are then ignored
+		ACME *ACME `yaml:"acme" mapstructure:"acme"`
+		// HTTPPort serves plain HTTP on this port as well, redirecting every request to HTTPS
+		HTTPPort uint `yaml:"http_port" mapstructure:"http_port"`
+		// MinVersion is the lowest TLS version accepted, 1.0 to 1.3. It defaults to 1.2 in production and to the Go
+		// default otherwise
+		MinVersion string `yaml:"min_version" mapstructure:"min_version"`
+	}
+
+	ACME struct {
+		// CacheDir stores the issued certificates across restarts, they are requested again on every start without it
+		CacheDir string `yaml:"cache_dir" mapstructure:"cache_dir"`
+		Email    string `yaml:"email" mapstructure:"email" validate:"omitempty,email"`
+		// Staging uses the Let's Encrypt staging environment, its certificates aren't trusted but the rate limits are higher
+		Staging bool `yaml:"staging" mapstructure:"staging"`
+		Enabled bool `yaml:"enabled" mapstructure:"enabled"`
 	}
 
 	Skynet struct {
@@ -64,6 +197,18 @@ type (
 		EndpointPath    string `yaml:"endpoint_path" mapstructure:"endpoint_path"`
 		ApiKey          string `yaml:"api_key" mapstructure:"api_key"`
 		CustomUserAgent string `yaml:"custom_user_agent" mapstructure:"custom_user_agent"`
+		// PortalURLs are tried, in round robin, when the primary portal (SkynetPortalURL) fails
+		PortalURLs []string `yaml:"portal_urls" mapstructure:"portal_urls" validate:"dive,url"`
+		// CircuitBreaker stops calling the portal for a while after consecutive failures. It only applies to
+		// skynet.Client, which the registry doesn't serve blobs through yet
+		CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker" mapstructure:"circuit_breaker"`
+	}
+
+	// CircuitBreaker opens after FailureThreshold consecutive failures, calls then fail fast for OpenTimeout
+	// before a single probe call is let through (half-open) to check if the service recovered
+	CircuitBreaker struct {
+		OpenTimeout      time.Duration `yaml:"open_timeout" mapstructure:"open_timeout"`
+		FailureThreshold uint32        `yaml:"failure_threshold" mapstructure:"failure_threshold"`
 	}
 
 	Log struct {
@@ -72,6 +217,13 @@ type (
 		AuthMethod string `yaml:"auth_method" mapstructure:"auth_method"`
 		Username   string `yaml:"username" mapstructure:"username"`
 		Password   string `yaml:"password" mapstructure:"password"`
+		// Level is one of trace, debug, info, warn or error. It defaults to info in production and to trace in the
+		// other environments
+		Level string `yaml:"level" mapstructure:"level" validate:"omitempty,oneof=trace debug info warn error"`
+		// TimeFormat of the log lines is either rfc3339 (the default) or unix
+		TimeFormat string `yaml:"time_format" mapstructure:"time_format" validate:"omitempty,oneof=rfc3339 unix"`
+		// DebugSampleRate only logs one in DebugSampleRate trace and debug lines, 0 and 1 log every line
+		DebugSampleRate uint32 `yaml:"debug_sample_rate" mapstructure:"debug_sample_rate"`
 	}
 
 	Store struct {
@@ -81,6 +233,8 @@ type (
 		Password string `yaml:"password" mapstructure:"password" validate:"required"`
 		Database string `yaml:"name" mapstructure:"name" validate:"required"`
 		Port     int    `yaml:"port" mapstructure:"port" validate:"required"`
+		// AutoMigrate applies the pending migrations on server startup
+		AutoMigrate bool `yaml:"auto_migrate" mapstructure:"auto_migrate"`
 	}
 
 	GithubOAuth struct {
@@ -88,24 +242,160 @@ type (
 		ClientSecret string `yaml:"client_secret" mapstructure:"client_secret" validate:"required"`
 	}
 
+	// Webhook receives a signed JSON payload for the registry events (push, delete)
+	Webhook struct {
+		URL string `yaml:"url" mapstructure:"url" validate:"required,url"`
+		// Secret is used to sign the payload with HMAC-SHA256
+		Secret string `yaml:"secret" mapstructure:"secret" validate:"required"`
+		// Events limits the event types sent to this webhook, all events are sent when empty
+		Events []string `yaml:"events" mapstructure:"events"`
+	}
+
+	// ContentTrust configures the signing policy enforced on manifest pushes. Policies are either
+	// "none" (default) or "require-signature"
+	ContentTrust struct {
+		//nolint
+		DefaultPolicy string `yaml:"default_policy" mapstructure:"default_policy" validate:"omitempty,oneof=none require-signature"`
+		// Repositories maps a repository (username/imagename) to the policy enforced on it
+		//nolint
+		Repositories map[string]string `yaml:"repositories" mapstructure:"repositories" validate:"dive,oneof=none require-signature"`
+	}
+
+	// Quota limits the storage (in bytes) used by the layers of a repository or by all the repositories of a user.
+	// A limit of 0 means unlimited
+	Quota struct {
+		// Namespaces and Users override the default limits for a repository (username/imagename) or a user
+		Namespaces            map[string]int64 `yaml:"namespaces" mapstructure:"namespaces"`
+		Users                 map[string]int64 `yaml:"users" mapstructure:"users"`
+		DefaultNamespaceLimit int64            `yaml:"default_namespace_limit" mapstructure:"default_namespace_limit"`
+		DefaultUserLimit      int64            `yaml:"default_user_limit" mapstructure:"default_user_limit"`
+	}
+
+	// Telemetry exports the traces of the HTTP handlers, database queries and DFS calls to an OTLP/HTTP collector
+	Telemetry struct {
+		// Headers are sent with every export request, e.g. the API key of a hosted collector
+		Headers map[string]string `yaml:"headers" mapstructure:"headers"`
+		// Endpoint is the base URL of the collector (e.g http://localhost:4318), spans are sent to <endpoint>/v1/traces
+		Endpoint    string `yaml:"endpoint" mapstructure:"endpoint" validate:"omitempty,url"`
+		ServiceName string `yaml:"service_name" mapstructure:"service_name"`
+		// SampleRatio is the fraction of the traces started by OpenRegistry that are exported, all of them when 0
+		SampleRatio float64 `yaml:"sample_ratio" mapstructure:"sample_ratio" validate:"gte=0,lte=1"`
+		Enabled     bool    `yaml:"enabled" mapstructure:"enabled"`
+	}
+
+	// Retention applies the retention policies of every repository on a schedule, the admin API can apply them
+	// on demand even when the schedule is disabled
+	Retention struct {
+		Interval time.Duration `yaml:"interval" mapstructure:"interval"`
+		// DryRun only logs what the scheduled runs would delete
+		DryRun  bool `yaml:"dry_run" mapstructure:"dry_run"`
+		Enabled bool `yaml:"enabled" mapstructure:"enabled"`
+	}
+
+	// PasswordPolicy is checked when users sign up or change their password. Without it, passwords need 8 to 64
+	// characters with a lowercase and an uppercase letter, a number and a special character
+	PasswordPolicy struct {
+		// CommonPasswordsFile lists the passwords nobody can use, one per line
+		CommonPasswordsFile string `yaml:"common_passwords_file" mapstructure:"common_passwords_file"`
+		// RequiredClasses are any of lowercase, uppercase, number and special
+		//nolint
+		RequiredClasses []string `yaml:"required_classes" mapstructure:"required_classes" validate:"dive,oneof=lowercase uppercase number special"`
+		// zero uses the defaults, 8 and 64
+		MinLength int `yaml:"min_length" mapstructure:"min_length" validate:"gte=0"`
+		MaxLength int `yaml:"max_length" mapstructure:"max_length" validate:"gte=0"`
+	}
+
 	OAuth struct {
 		Github GithubOAuth `yaml:"github" mapstructure:"github"`
 	}
 
+	// Email is sent with the Provider, sendgrid (default), smtp or ses. SendGrid renders the emails from its
+	// template ids, the emails sent with SMTP and SES, and the SendGrid ones without a template id, are rendered
+	// by OpenRegistry from its embedded HTML templates
 	Email struct {
-		ApiKey                string `yaml:"api_key" mapstructure:"api_key" validate:"required"`
-		SendAs                string `yaml:"send_as" mapstructure:"send_as" validate:"required"`
-		VerifyEmailTemplateId string `yaml:"verify_template_id" mapstructure:"verify_template_id" validate:"required"`
+		SMTP     *SMTP  `yaml:"smtp" mapstructure:"smtp" validate:"required_if=Provider smtp"`
+		SES      *SES   `yaml:"ses" mapstructure:"ses" validate:"required_if=Provider ses"`
+		Provider string `yaml:"provider" mapstructure:"provider" validate:"omitempty,oneof=sendgrid smtp ses"`
+		// Mode is live to send the emails, log to only log them or capture to keep the last CaptureSize of them in
+		// memory, they're listed to admins by the /internal/emails endpoint. Capture is only allowed in the Local and
+		// CI environments. It's log by default in the Local and CI environments, live otherwise
+		Mode string `yaml:"mode" mapstructure:"mode" validate:"omitempty,oneof=live log capture"`
+		// zero keeps the last 100 emails
+		CaptureSize int `yaml:"capture_size" mapstructure:"capture_size" validate:"gte=0"`
 		//nolint
-		ForgotPasswordTemplateId string `yaml:"forgot_password_template_id" mapstructure:"forgot_password_template_id" validate:"required"`
-		WelcomeEmailTemplateId   string `yaml:"welcome_template_id" mapstructure:"welcome_template_id" validate:"required"`
+		ApiKey string `yaml:"api_key" mapstructure:"api_key" validate:"required_unless=Provider smtp Provider ses Mode log Mode capture"`
+		SendAs string `yaml:"send_as" mapstructure:"send_as" validate:"required"`
+		// TemplatesDir overrides the embedded templates with the files of the same name, welcome.html,
+		// verify_email.html and reset_password.html
+		TemplatesDir             string `yaml:"templates_dir" mapstructure:"templates_dir"`
+		VerifyEmailTemplateId    string `yaml:"verify_template_id" mapstructure:"verify_template_id"`
+		ForgotPasswordTemplateId string `yaml:"forgot_password_template_id" mapstructure:"forgot_password_template_id"`
+		WelcomeEmailTemplateId   string `yaml:"welcome_template_id" mapstructure:"welcome_template_id"`
 	}
+
+	// SMTP sends the emails through a mail server, with STARTTLS when the server supports it. Username and
+	// Password are optional, they're sent with PLAIN auth
+	SMTP struct {
+		Host     string `yaml:"host" mapstructure:"host" validate:"required"`
+		Username string `yaml:"username" mapstructure:"username"`
+		Password string `yaml:"password" mapstructure:"password"`
+		Port     int    `yaml:"port" mapstructure:"port" validate:"required,gt=0,lte=65535"`
+	}
+
+	// SES sends the emails with the Amazon SES v2 API. The AWS default credential chain is used when the keys
+	// aren't set
+	SES struct {
+		Region    string `yaml:"region" mapstructure:"region" validate:"required"`
+		AccessKey string `yaml:"access_key" mapstructure:"access_key"`
+		SecretKey string `yaml:"secret_key" mapstructure:"secret_key"`
+	}
+)
+
+const (
+	EmailModeLive    = "live"
+	EmailModeLog     = "log"
+	EmailModeCapture = "capture"
 )
 
 func (r *Registry) Address() string {
 	return fmt.Sprintf("%s:%d", r.Host, r.Port)
 }
 
+func (t *TLS) Enabled() bool {
+	return t.ACMEEnabled() || (t.PrivateKey != "" && t.PubKey != "")
+}
+
+func (t *TLS) ACMEEnabled() bool {
+	return t.ACME != nil && t.ACME.Enabled
+}
+
+// Load returns the PEM encoded certificate and key, read from disk unless they are set inline
+func (t *TLS) Load() (cert []byte, key []byte, err error) {
+	cert, err = readPEM(t.PubKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERR_READ_TLS_CERT: %w", err)
+	}
+
+	key, err = readPEM(t.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERR_READ_TLS_KEY: %w", err)
+	}
+
+	if _, err = tls.X509KeyPair(cert, key); err != nil {
+		return nil, nil, fmt.Errorf("ERR_INVALID_TLS_KEY_PAIR: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+func readPEM(pathOrPEM string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(pathOrPEM), "-----BEGIN") {
+		return []byte(pathOrPEM), nil
+	}
+
+	return os.ReadFile(pathOrPEM)
+}
+
 func NewStoreConfig() (*Store, error) {
 	viper.SetEnvPrefix("OPEN_REGISTRY")
 	viper.AutomaticEnv()
@@ -136,6 +426,9 @@ func (oc *OpenRegistryConfig) Validate() error {
 	if err := enTranslations.RegisterDefaultTranslations(v, trans); err != nil {
 		return err
 	}
+	if err := registerSigningSecretValidation(v, trans); err != nil {
+		return err
+	}
 
 	var e error
 	e = multierror.Append(e, translateError(v.Struct(oc), trans))
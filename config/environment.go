@@ -0,0 +1,95 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// tlsVersions are the values of TLS.MinVersion
+var tlsVersions = map[string]uint16{ //nolint
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ApplyEnvironmentDefaults fills in the settings whose default depends on the environment, the ones set in the config
+// are kept. It fails when the production settings are unsafe, e.g. emails which are logged rather than sent, so that
+// they fail the startup. The signing secret is read from the environment or its file here, a weak one fails the
+// startup in production (Validate checks it in staging too)
+func (oc *OpenRegistryConfig) ApplyEnvironmentDefaults() error {
+	if oc.LogConfig == nil {
+		oc.LogConfig = &Log{}
+	}
+	if oc.LogConfig.Level == "" {
+		switch oc.Environment {
+		case Production:
+			oc.LogConfig.Level = "info"
+		case Local, CI:
+			oc.LogConfig.Level = "debug"
+		}
+	}
+
+	if oc.Email != nil && oc.Email.Mode == "" {
+		oc.Email.Mode = EmailModeLive
+		if oc.Environment == Local || oc.Environment == CI {
+			oc.Email.Mode = EmailModeLog
+		}
+	}
+
+	if oc.Registry != nil {
+		if err := oc.Registry.loadSigningSecret(); err != nil {
+			return err
+		}
+		if oc.Registry.TLS.MinVersion == "" && oc.Environment == Production {
+			oc.Registry.TLS.MinVersion = "1.2"
+		}
+		if _, err := oc.Registry.TLS.MinTLSVersion(); err != nil {
+			return err
+		}
+	}
+
+	// the captured emails hold the verification and password reset links, they're only kept for the tests
+	if oc.Email != nil && oc.Email.Mode == EmailModeCapture && oc.Environment != Local && oc.Environment != CI {
+		return fmt.Errorf("ERR_EMAIL_MODE: the capture mode is only allowed in the local and CI environments")
+	}
+
+	if oc.Environment == Production {
+		return oc.checkProductionSecrets()
+	}
+
+	return nil
+}
+
+func (oc *OpenRegistryConfig) checkProductionSecrets() error {
+	if oc.Registry != nil && !isStrongSigningSecret(oc.Registry.SigningSecret) {
+		return fmt.Errorf(
+			"ERR_WEAK_SIGNING_SECRET: the jwt_signing_secret must be at least %d bytes long with %d distinct characters",
+			minSigningSecretLength, minSigningSecretChars,
+		)
+	}
+	if oc.Email != nil {
+		if oc.Email.Mode != EmailModeLive {
+			return fmt.Errorf("ERR_EMAIL_MODE: emails must be sent (live mode) in production, got %s", oc.Email.Mode)
+		}
+		if (oc.Email.Provider == "" || oc.Email.Provider == "sendgrid") && oc.Email.ApiKey == "" {
+			return fmt.Errorf("ERR_MISSING_EMAIL_API_KEY: the sendgrid api_key is required in production")
+		}
+	}
+
+	return nil
+}
+
+// MinTLSVersion returns the tls.Config MinVersion, zero for the Go default
+func (t *TLS) MinTLSVersion() (uint16, error) {
+	if t.MinVersion == "" {
+		return 0, nil
+	}
+
+	version, ok := tlsVersions[t.MinVersion]
+	if !ok {
+		return 0, fmt.Errorf("ERR_INVALID_TLS_VERSION: min_version must be one of 1.0, 1.1, 1.2 or 1.3, got %s", t.MinVersion)
+	}
+
+	return version, nil
+}
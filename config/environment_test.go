@@ -0,0 +1,119 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestApplyEnvironmentDefaultsCaptureMode(t *testing.T) {
+	tests := []struct {
+		environment Environment
+		wantErr     bool
+	}{
+		{environment: Local},
+		{environment: CI},
+		{environment: Staging, wantErr: true},
+		{environment: Production, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment.String(), func(t *testing.T) {
+			oc := &OpenRegistryConfig{
+				Environment: tt.environment,
+				Email:       &Email{Mode: EmailModeCapture, ApiKey: "api-key"},
+			}
+			if err := oc.ApplyEnvironmentDefaults(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyEnvironmentDefaultsEmailMode(t *testing.T) {
+	tests := map[Environment]string{Local: EmailModeLog, CI: EmailModeLog, Staging: EmailModeLive}
+	for environment, want := range tests {
+		oc := &OpenRegistryConfig{Environment: environment, Email: &Email{}}
+		if err := oc.ApplyEnvironmentDefaults(); err != nil {
+			t.Fatal(err)
+		}
+		if oc.Email.Mode != want {
+			t.Errorf("%s: got email mode %s, want %s", environment, oc.Email.Mode, want)
+		}
+	}
+}
+
+// validateSecret runs the signing secret validation of Validate on the secret alone
+func validateSecret(t *testing.T, environment Environment, secret string) error {
+	t.Helper()
+
+	v := validator.New()
+	english := en.New()
+	trans, _ := ut.New(english, english).GetTranslator("en")
+	if err := registerSigningSecretValidation(v, trans); err != nil {
+		t.Fatal(err)
+	}
+
+	oc := &OpenRegistryConfig{Environment: environment, Registry: &Registry{SigningSecret: secret}}
+	return v.StructPartial(oc, "Registry.SigningSecret")
+}
+
+func TestValidateSigningSecret(t *testing.T) {
+	const strong = "k7Qp2vXz9LmN4rTb8WcY1sHd6FgJ3aEu"
+	tests := []struct {
+		name        string
+		environment Environment
+		secret      string
+		wantErr     bool
+	}{
+		{name: "short secret in production", environment: Production, secret: "abc", wantErr: true},
+		{name: "short secret in staging", environment: Staging, secret: "abc", wantErr: true},
+		{name: "repeated characters in production", environment: Production, secret: strings.Repeat("ab", 20), wantErr: true},
+		{name: "strong secret in production", environment: Production, secret: strong},
+		{name: "short secret in local", environment: Local, secret: "abc"},
+		{name: "short secret in CI", environment: CI, secret: "abc"},
+		{name: "missing secret in local", environment: Local, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSecret(t, tt.environment, tt.secret); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyEnvironmentDefaultsSigningSecret(t *testing.T) {
+	tests := []struct {
+		environment Environment
+		secret      string
+		wantErr     bool
+	}{
+		{environment: Production, secret: "abc", wantErr: true},
+		{environment: Production, secret: strings.Repeat("ab", 20), wantErr: true},
+		{environment: Production, secret: "k7Qp2vXz9LmN4rTb8WcY1sHd6FgJ3aEu"},
+		{environment: Local, secret: "abc"},
+	}
+
+	for _, tt := range tests {
+		oc := &OpenRegistryConfig{Environment: tt.environment, Registry: &Registry{SigningSecret: tt.secret}}
+		if err := oc.ApplyEnvironmentDefaults(); (err != nil) != tt.wantErr {
+			t.Errorf("%s with secret %s: got error %v, want error %t", tt.environment, tt.secret, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyEnvironmentDefaultsSigningSecretFromEnv(t *testing.T) {
+	t.Setenv(SigningSecretEnv, "abc")
+	oc := &OpenRegistryConfig{
+		Environment: Production,
+		Registry:    &Registry{SigningSecret: "k7Qp2vXz9LmN4rTb8WcY1sHd6FgJ3aEu"},
+	}
+	if err := oc.ApplyEnvironmentDefaults(); err == nil {
+		t.Error("the short secret of the environment was accepted")
+	}
+}
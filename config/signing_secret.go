@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// SigningSecretEnv overrides the jwt_signing_secret and jwt_signing_secret_file of the config
+	SigningSecretEnv = "OPENREGISTRY_JWT_SIGNING_SECRET"
+
+	signingSecretTag = "signing_secret"
+	// minSigningSecretLength is the length, in bytes, of the HS256 key, shorter secrets are easier to brute force
+	minSigningSecretLength = 32
+	// minSigningSecretChars rejects the secrets that are long enough but repeat a few characters, e.g. aaaa...
+	minSigningSecretChars = 10
+)
+
+// loadSigningSecret reads the signing secret from the environment or from SigningSecretFile, so that it doesn't have
+// to be committed along with the config. The environment takes precedence over the file, and the file over the
+// inline secret
+func (r *Registry) loadSigningSecret() error {
+	if secret := os.Getenv(SigningSecretEnv); secret != "" {
+		r.SigningSecret = secret
+		return nil
+	}
+
+	if r.SigningSecretFile != "" {
+		secret, err := os.ReadFile(r.SigningSecretFile)
+		if err != nil {
+			return fmt.Errorf("ERR_READ_SIGNING_SECRET: %w", err)
+		}
+		r.SigningSecret = strings.TrimRight(string(secret), "\r\n")
+	}
+
+	return nil
+}
+
+// validateSigningSecret requires minSigningSecretLength bytes and minSigningSecretChars distinct characters, except in
+// the local and CI environments
+func validateSigningSecret(fl validator.FieldLevel) bool {
+	if oc, ok := fl.Top().Interface().(*OpenRegistryConfig); ok && (oc.Environment == Local || oc.Environment == CI) {
+		return true
+	}
+
+	return isStrongSigningSecret(fl.Field().String())
+}
+
+func isStrongSigningSecret(secret string) bool {
+	if len(secret) < minSigningSecretLength {
+		return false
+	}
+
+	chars := make(map[rune]struct{})
+	for _, c := range secret {
+		chars[c] = struct{}{}
+	}
+
+	return len(chars) >= minSigningSecretChars
+}
+
+func registerSigningSecretValidation(v *validator.Validate, trans ut.Translator) error {
+	if err := v.RegisterValidation(signingSecretTag, validateSigningSecret); err != nil {
+		return err
+	}
+
+	return v.RegisterTranslation(
+		signingSecretTag,
+		trans,
+		func(ut ut.Translator) error {
+			return ut.Add(signingSecretTag, fmt.Sprintf(
+				"{0} must be at least %d bytes long with %d distinct characters outside the local and CI environments",
+				minSigningSecretLength,
+				minSigningSecretChars,
+			), true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			msg, err := ut.T(signingSecretTag, fe.Field())
+			if err != nil {
+				return fe.Error()
+			}
+			return msg
+		},
+	)
+}
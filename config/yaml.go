@@ -23,6 +23,9 @@ func ReadYamlConfig() (*OpenRegistryConfig, error) {
 			return nil, err
 		}
 
+		if err = registryConfig.ApplyEnvironmentDefaults(); err != nil {
+			return nil, err
+		}
 		if err = registryConfig.Validate(); err != nil {
 			return nil, err
 		}
@@ -46,6 +49,9 @@ func ReadYamlConfig() (*OpenRegistryConfig, error) {
 		registryConfig.DFS.S3Any.ChunkSize = 1024 * 1024 * 20
 	}
 
+	if err := registryConfig.ApplyEnvironmentDefaults(); err != nil {
+		return nil, err
+	}
 	if err := registryConfig.Validate(); err != nil {
 		return nil, err
 	}
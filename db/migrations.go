@@ -0,0 +1,22 @@
+// Package db holds the versioned database migrations, they are embedded in the binary so that
+// `openregistry migrate` doesn't need the migration files on disk
+package db
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS //nolint
+
+// Migrations returns the embedded migration files, the file names are <version>_<title>.(up|down).sql
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		// only possible if the directory in the embed pattern changes
+		panic(err)
+	}
+
+	return sub
+}
@@ -0,0 +1 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "token_version" int NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS "audit_log" (
+	"id" bigserial PRIMARY KEY,
+	"actor" text,
+	"action" text NOT NULL,
+	"namespace" text,
+	"reference" text,
+	"source_ip" text,
+	"created_at" timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_namespace_idx ON audit_log (namespace);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "webhook_dead_letters" (
+	"id" bigserial PRIMARY KEY,
+	"url" text NOT NULL,
+	"event_type" text NOT NULL,
+	"payload" jsonb NOT NULL,
+	"error" text,
+	"attempts" int,
+	"created_at" timestamp NOT NULL
+);
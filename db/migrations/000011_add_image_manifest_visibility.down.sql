@@ -0,0 +1 @@
+ALTER TABLE "image_manifest" DROP COLUMN IF EXISTS "visibility";
@@ -0,0 +1 @@
+ALTER TABLE "image_manifest" ADD COLUMN IF NOT EXISTS "visibility" text NOT NULL DEFAULT 'public';
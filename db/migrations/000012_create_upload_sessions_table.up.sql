@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "upload_sessions" (
+	"upload_id" text PRIMARY KEY,
+	"layer_key" text NOT NULL,
+	"namespace" text NOT NULL,
+	"parts" jsonb NOT NULL DEFAULT '[]',
+	"part_count" bigint NOT NULL DEFAULT 0,
+	"received" bigint NOT NULL DEFAULT 0,
+	"created_at" timestamp NOT NULL,
+	"updated_at" timestamp NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS "repository_stats" (
+	"namespace" text PRIMARY KEY,
+	"pull_count" bigint NOT NULL DEFAULT 0,
+	"layer_pull_count" bigint NOT NULL DEFAULT 0,
+	"push_count" bigint NOT NULL DEFAULT 0,
+	"last_pulled_at" timestamp,
+	"last_pushed_at" timestamp
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "compressed_layer" (
+	"digest" text PRIMARY KEY REFERENCES layer(digest) ON DELETE CASCADE,
+	"compressed_digest" text NOT NULL,
+	"uuid" uuid NOT NULL,
+	"sky_link" text NOT NULL,
+	"encoding" text NOT NULL,
+	"size" bigint NOT NULL,
+	"created_at" timestamp
+);
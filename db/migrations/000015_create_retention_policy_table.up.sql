@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "retention_policy" (
+	"namespace" text PRIMARY KEY,
+	"tag_pattern" text NOT NULL DEFAULT '',
+	"keep_last" int NOT NULL DEFAULT 0,
+	"max_tag_age_days" int NOT NULL DEFAULT 0,
+	"untagged_max_age_days" int NOT NULL DEFAULT 0,
+	"created_at" timestamp,
+	"updated_at" timestamp
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "organization_members";
+DROP TABLE IF EXISTS "organizations";
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS "organizations" (
+	"name" text PRIMARY KEY,
+	"created_at" timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "organization_members" (
+	"organization" text NOT NULL REFERENCES organizations(name) ON DELETE CASCADE,
+	"user_id" uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	"role" text NOT NULL,
+	"created_at" timestamp NOT NULL,
+	"updated_at" timestamp NOT NULL,
+	PRIMARY KEY ("organization", "user_id")
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
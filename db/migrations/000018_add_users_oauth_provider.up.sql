@@ -0,0 +1,5 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "oauth_provider" text;
+-- every oauth user so far signed in with github
+UPDATE "users" SET "oauth_provider" = 'github' WHERE "oauth_id" IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "users_oauth_identity_idx" ON "users" ("oauth_provider", "oauth_id")
+	WHERE "oauth_provider" IS NOT NULL;
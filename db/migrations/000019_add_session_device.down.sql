@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "session_owner_idx";
+ALTER TABLE "session" DROP COLUMN IF EXISTS "last_used_at";
+ALTER TABLE "session" DROP COLUMN IF EXISTS "created_at";
+ALTER TABLE "session" DROP COLUMN IF EXISTS "ip_address";
+ALTER TABLE "session" DROP COLUMN IF EXISTS "user_agent";
@@ -0,0 +1,5 @@
+ALTER TABLE "session" ADD COLUMN IF NOT EXISTS "user_agent" text NOT NULL DEFAULT '';
+ALTER TABLE "session" ADD COLUMN IF NOT EXISTS "ip_address" text NOT NULL DEFAULT '';
+ALTER TABLE "session" ADD COLUMN IF NOT EXISTS "created_at" timestamp NOT NULL DEFAULT now();
+ALTER TABLE "session" ADD COLUMN IF NOT EXISTS "last_used_at" timestamp NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS "session_owner_idx" ON "session" ("owner");
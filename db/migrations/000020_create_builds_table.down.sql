@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "builds_namespace_idx";
+DROP TABLE IF EXISTS builds;
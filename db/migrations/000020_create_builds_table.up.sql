@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "builds" (
+	"id" uuid PRIMARY KEY,
+	"namespace" text NOT NULL,
+	"commit_sha" text NOT NULL,
+	"status" text NOT NULL DEFAULT 'queued',
+	"logs_url" text NOT NULL DEFAULT '',
+	"created_at" timestamp NOT NULL,
+	"updated_at" timestamp NOT NULL,
+	"started_at" timestamp,
+	"finished_at" timestamp
+);
+CREATE INDEX IF NOT EXISTS "builds_namespace_idx" ON "builds" ("namespace", "created_at" DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE "config" DROP COLUMN IF EXISTS "config_size";
+ALTER TABLE "config" DROP COLUMN IF EXISTS "config_digest";
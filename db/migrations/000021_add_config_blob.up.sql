@@ -0,0 +1,2 @@
+ALTER TABLE "config" ADD COLUMN IF NOT EXISTS "config_digest" text NOT NULL DEFAULT '';
+ALTER TABLE "config" ADD COLUMN IF NOT EXISTS "config_size" bigint NOT NULL DEFAULT 0;
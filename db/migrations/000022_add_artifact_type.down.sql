@@ -0,0 +1 @@
+ALTER TABLE "config" DROP COLUMN IF EXISTS "artifact_type";
@@ -0,0 +1 @@
+ALTER TABLE "config" ADD COLUMN IF NOT EXISTS "artifact_type" text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE "config" ALTER COLUMN "created_at" DROP NOT NULL, ALTER COLUMN "created_at" DROP DEFAULT,
+	ALTER COLUMN "updated_at" DROP NOT NULL, ALTER COLUMN "updated_at" DROP DEFAULT;
@@ -0,0 +1,5 @@
+UPDATE "config" SET "created_at" = coalesce("created_at", "updated_at", now()),
+	"updated_at" = coalesce("updated_at", "created_at", now())
+	WHERE "created_at" IS NULL OR "updated_at" IS NULL;
+ALTER TABLE "config" ALTER COLUMN "created_at" SET DEFAULT now(), ALTER COLUMN "created_at" SET NOT NULL,
+	ALTER COLUMN "updated_at" SET DEFAULT now(), ALTER COLUMN "updated_at" SET NOT NULL;
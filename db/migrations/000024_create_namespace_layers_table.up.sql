@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "namespace_layers" (
+	"namespace" text NOT NULL,
+	"digest" text NOT NULL REFERENCES "layer" ("digest") ON DELETE CASCADE,
+	"created_at" timestamp NOT NULL DEFAULT now(),
+	PRIMARY KEY ("namespace", "digest")
+);
+
+INSERT INTO "namespace_layers" ("namespace", "digest")
+SELECT DISTINCT c.namespace, l.digest FROM "config" c CROSS JOIN LATERAL unnest(c.layers) AS u(digest)
+JOIN "layer" l ON l.digest = u.digest
+ON CONFLICT DO NOTHING;
@@ -2,17 +2,26 @@ package dfs
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 
 	"github.com/SkynetLabs/go-skynet/v2"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/containerish/OpenRegistry/types"
 )
 
+// ErrPresignUnsupported is returned by the backends which can't sign URLs, the objects are then served by the registry
+var ErrPresignUnsupported = errors.New("ERR_PRESIGN_UNSUPPORTED") //nolint
+
+// ErrRangeUnsupported is returned by the backends which can't read a byte range of an object, the registry then
+// downloads the object and skips the bytes before the range
+var ErrRangeUnsupported = errors.New("ERR_RANGE_UNSUPPORTED") //nolint
+
 type DFS interface {
 	Upload(ctx context.Context, namespace, digest string, content []byte) (string, error)
 	// MultipartUpload returns uploadid or error
-	CreateMultipartUpload(namespace string) (string, error)
+	CreateMultipartUpload(ctx context.Context, namespace string) (string, error)
 	UploadPart(
 		ctx context.Context,
 		uploadId string,
@@ -32,10 +41,21 @@ type DFS interface {
 		finalDigest string,
 		completedParts []s3types.CompletedPart,
 	) (string, error)
+	// AbortMultipartUpload drops the parts uploaded so far, aborting an upload which doesn't exist isn't an error
+	AbortMultipartUpload(ctx context.Context, uploadId, key string) error
 	Download(ctx context.Context, path string) (io.ReadCloser, error)
+	// DownloadRange reads length bytes of the object stored at path, from offset, or returns ErrRangeUnsupported
+	DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
 	DownloadDir(skynetLink, dir string) error
 	List(path string) ([]*types.Metadata, error)
 	AddImage(ns string, mf, l map[string][]byte) (string, error)
-	Metadata(skylink string) (*skynet.Metadata, error)
-	GetUploadProgress(identifier, uploadID string) (*types.ObjectMetadata, error)
+	Metadata(ctx context.Context, skylink string) (*skynet.Metadata, error)
+	GetUploadProgress(ctx context.Context, identifier, uploadID string) (*types.ObjectMetadata, error)
+	// Exists reports whether an object is stored at key, it doesn't retry like Metadata does
+	Exists(ctx context.Context, key string) (bool, error)
+	// DeleteObject removes the object stored at key, deleting an object which doesn't exist isn't an error
+	DeleteObject(ctx context.Context, key string) error
+	// PresignedURL returns a URL the object stored at key can be downloaded from without credentials until it
+	// expires, or ErrPresignUnsupported
+	PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
 }
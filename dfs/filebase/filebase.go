@@ -3,6 +3,7 @@ package filebase
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -18,19 +19,21 @@ import (
 )
 
 type filebase struct {
-	client *s3.Client
-	bucket string
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
 }
 
 func New(cfg *config.S3CompatibleDFS) dfs.DFS {
 	client := dfs.NewS3Client(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey)
 	return &filebase{
-		client: client,
-		bucket: cfg.BucketName,
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		bucket:  cfg.BucketName,
 	}
 }
 
-func (fb *filebase) CreateMultipartUpload(layerKey string) (string, error) {
+func (fb *filebase) CreateMultipartUpload(ctx context.Context, layerKey string) (string, error) {
 	input := &s3.CreateMultipartUploadInput{
 		Bucket:            &fb.bucket,
 		Key:               &layerKey,
@@ -39,7 +42,7 @@ func (fb *filebase) CreateMultipartUpload(layerKey string) (string, error) {
 		ContentEncoding:   aws.String("gzip"),
 		StorageClass:      s3types.StorageClassStandard,
 	}
-	upload, err := fb.client.CreateMultipartUpload(context.Background(), input)
+	upload, err := fb.client.CreateMultipartUpload(ctx, input)
 	if err != nil {
 		return "", err
 	}
@@ -168,6 +171,28 @@ func (fb *filebase) Download(ctx context.Context, path string) (io.ReadCloser, e
 
 	return resp.Body, nil
 }
+
+// DownloadRange is a GET of the object with a Range header. Some S3 compatible backends ignore the header and send
+// the whole object, the body is dropped then and ErrRangeUnsupported returned
+func (fb *filebase) DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	resp, err := fb.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &fb.bucket,
+		Key:    &path,
+		Range:  &byteRange,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_OBJECT_RANGE: %w", err)
+	}
+
+	if aws.ToString(resp.ContentRange) == "" {
+		_ = resp.Body.Close()
+		return nil, dfs.ErrRangeUnsupported
+	}
+
+	return resp.Body, nil
+}
+
 func (fb *filebase) DownloadDir(skynetLink, dir string) error {
 	return nil
 }
@@ -181,12 +206,12 @@ func (fb *filebase) AddImage(ns string, mf, l map[string][]byte) (string, error)
 // Metadata API returns the HEADERS for an object. This object can be a manifest or a layer.
 // This API is usually a little behind when it comes to fetching the details for an uploaded object.
 // This is why we put it in a retry loop and break it as soon as we get the data
-func (fb *filebase) Metadata(identifier string) (*skynet.Metadata, error) {
+func (fb *filebase) Metadata(ctx context.Context, identifier string) (*skynet.Metadata, error) {
 	var resp *s3.HeadObjectOutput
 	var err error
 
 	for i := 3; i > 0; i-- {
-		resp, err = fb.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		resp, err = fb.client.HeadObject(ctx, &s3.HeadObjectInput{
 			Bucket:       &fb.bucket,
 			Key:          &identifier,
 			ChecksumMode: s3types.ChecksumModeEnabled,
@@ -211,8 +236,8 @@ func (fb *filebase) Metadata(identifier string) (*skynet.Metadata, error) {
 	}, nil
 }
 
-func (fb *filebase) GetUploadProgress(identifier, uploadID string) (*types.ObjectMetadata, error) {
-	partsResp, err := fb.client.ListParts(context.Background(), &s3.ListPartsInput{
+func (fb *filebase) GetUploadProgress(ctx context.Context, identifier, uploadID string) (*types.ObjectMetadata, error) {
+	partsResp, err := fb.client.ListParts(ctx, &s3.ListPartsInput{
 		Bucket:   &fb.bucket,
 		Key:      &identifier,
 		UploadId: &uploadID,
@@ -230,3 +255,70 @@ func (fb *filebase) GetUploadProgress(identifier, uploadID string) (*types.Objec
 		ContentLength: int(uploadedSize),
 	}, nil
 }
+
+func (fb *filebase) AbortMultipartUpload(ctx context.Context, uploadId, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := fb.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &fb.bucket,
+		Key:      &key,
+		UploadId: &uploadId,
+	})
+	if err != nil {
+		var noSuchUpload *s3types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			return nil
+		}
+		return fmt.Errorf("ERR_ABORT_UPLOAD: %w", err)
+	}
+
+	return nil
+}
+
+func (fb *filebase) DeleteObject(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := fb.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &fb.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fmt.Errorf("ERR_DELETE_OBJECT: %w", err)
+	}
+
+	return nil
+}
+
+func (fb *filebase) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := fb.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &fb.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("ERR_HEAD_OBJECT: %w", err)
+	}
+
+	return true, nil
+}
+
+// PresignedURL signs a GET of the object with the credentials of the registry, the signature is computed locally
+func (fb *filebase) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := fb.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &fb.bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("ERR_PRESIGN_GET_OBJECT: %w", err)
+	}
+
+	return req.URL, nil
+}
@@ -0,0 +1,281 @@
+package dfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// DefaultKeyLayout stores the objects at the keys the registry uses for them, i.e. layers/<id> for the layers and
+// manifests/<digest> for the manifests, which were stored at <namespace>/manifests/<reference> before
+const DefaultKeyLayout = "{{.Key}}"
+
+// KeyFields are the fields available to a key layout template:
+//
+//	Key       the key the registry uses, e.g. layers/<id>
+//	Kind      layers or manifests, empty for the other objects
+//	Namespace the repository of a manifest stored by reference, empty for the other objects
+//	ID        the upload id of a layer, the digest or reference of a manifest, the key for the other objects
+//
+// The shard function returns the first n characters of a string, e.g. {{shard 2 .ID}}. The key of a layer is the
+// random id of the upload which stored it, not its digest, so a layout can't place the layers by digest, e.g.
+// blobs/<algo>/<first2>/<digest>: the digest isn't known when the upload starts
+type KeyFields struct {
+	Key       string
+	Kind      string
+	Namespace string
+	ID        string
+}
+
+// KeyLayout maps the keys the registry uses to the keys the objects are stored at, e.g.
+// openregistry/{{.Kind}}/{{shard 2 .ID}}/{{.Key}}. The new objects are stored with the layout, the ones stored before
+// it was set stay at the registry keys, where they're read and deleted from when the layout's key misses (see
+// WithKeyLayout). Changing a layout for another one means moving the objects to their new keys
+type KeyLayout struct {
+	tmpl   *template.Template
+	layout string
+}
+
+// NewKeyLayout parses the layout and checks that it maps distinct objects to distinct keys, so that an invalid
+// layout fails the startup. An empty layout is DefaultKeyLayout
+func NewKeyLayout(layout string) (*KeyLayout, error) {
+	if layout == "" {
+		layout = DefaultKeyLayout
+	}
+
+	tmpl, err := template.New("key_layout").Funcs(template.FuncMap{"shard": shard}).Option("missingkey=error").
+		Parse(layout)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_INVALID_KEY_LAYOUT: %w", err)
+	}
+
+	l := &KeyLayout{tmpl: tmpl, layout: layout}
+	samples := []string{
+		"layers/0b8d3d2e-5b4a-4a4a-9a0c-3c1f0f4f2a11",
+		"layers/7f6e8a1c-2d3b-4c5d-8e9f-0a1b2c3d4e5f",
+		"johndoe/alpine/manifests/latest",
+		"johndoe/alpine/manifests/sha256:3f2b7a1d",
+		"janedoe/alpine/manifests/latest",
+		"manifests/sha256:3f2b7a1d",
+		"manifests/sha256:9c4e5d6f",
+	}
+	keys := make(map[string]bool, len(samples))
+	for _, sample := range samples {
+		key, err := l.key(sample)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_INVALID_KEY_LAYOUT: %w", err)
+		}
+		if key == "" || strings.HasPrefix(key, "/") || keys[key] {
+			return nil, fmt.Errorf("ERR_INVALID_KEY_LAYOUT: %q maps %s to the key %q", layout, sample, key)
+		}
+		keys[key] = true
+	}
+
+	return l, nil
+}
+
+// Key returns the key the object the registry calls key is stored at. The layout was checked by NewKeyLayout,
+// key falls back to the registry key if it fails nonetheless
+func (l *KeyLayout) Key(key string) string {
+	mapped, err := l.key(key)
+	if err != nil || mapped == "" {
+		return key
+	}
+
+	return mapped
+}
+
+func (l *KeyLayout) key(key string) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := l.tmpl.Execute(buf, keyFields(key)); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// keyFields splits the registry keys, they're built by GetLayerIdentifier, GetManifestContentIdentifier and
+// GetManifestIdentifier
+func keyFields(key string) KeyFields {
+	if id := strings.TrimPrefix(key, "layers/"); id != key {
+		return KeyFields{Key: key, Kind: "layers", ID: id}
+	}
+
+	if id := strings.TrimPrefix(key, "manifests/"); id != key {
+		return KeyFields{Key: key, Kind: "manifests", ID: id}
+	}
+
+	if i := strings.LastIndex(key, "/manifests/"); i > 0 {
+		return KeyFields{
+			Key:       key,
+			Kind:      "manifests",
+			Namespace: key[:i],
+			ID:        key[i+len("/manifests/"):],
+		}
+	}
+
+	return KeyFields{Key: key, ID: key}
+}
+
+func shard(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(s) {
+		n = len(s)
+	}
+
+	return s[:n]
+}
+
+// keyLayoutDFS applies a KeyLayout to the keys of all the calls to dfs. The objects stored before the layout was set
+// are at the registry keys, the reads fall back to them when the layout's key misses, and the deletes delete both
+type keyLayoutDFS struct {
+	dfs    DFS
+	layout *KeyLayout
+}
+
+// WithKeyLayout returns dfs as is for the default layout
+func WithKeyLayout(dfs DFS, layout *KeyLayout) DFS {
+	if layout == nil || layout.layout == DefaultKeyLayout {
+		return dfs
+	}
+
+	return &keyLayoutDFS{dfs: dfs, layout: layout}
+}
+
+func (k *keyLayoutDFS) Upload(ctx context.Context, namespace, digest string, content []byte) (string, error) {
+	return k.dfs.Upload(ctx, k.layout.Key(namespace), digest, content)
+}
+
+func (k *keyLayoutDFS) CreateMultipartUpload(ctx context.Context, namespace string) (string, error) {
+	return k.dfs.CreateMultipartUpload(ctx, k.layout.Key(namespace))
+}
+
+func (k *keyLayoutDFS) UploadPart(
+	ctx context.Context,
+	uploadId string,
+	key string,
+	digest string,
+	partNumber int64,
+	content io.ReadSeeker,
+	contentLength int64,
+) (s3types.CompletedPart, error) {
+	return k.dfs.UploadPart(ctx, uploadId, k.layout.Key(key), digest, partNumber, content, contentLength)
+}
+
+func (k *keyLayoutDFS) CompleteMultipartUploadInput(
+	ctx context.Context,
+	uploadId string,
+	key string,
+	finalDigest string,
+	completedParts []s3types.CompletedPart,
+) (string, error) {
+	return k.dfs.CompleteMultipartUploadInput(ctx, uploadId, k.layout.Key(key), finalDigest, completedParts)
+}
+
+func (k *keyLayoutDFS) AbortMultipartUpload(ctx context.Context, uploadId, key string) error {
+	return k.dfs.AbortMultipartUpload(ctx, uploadId, k.layout.Key(key))
+}
+
+// moved is true when the layout maps the key to another one, the object can be at either of them then
+func (k *keyLayoutDFS) moved(key string) bool {
+	return k.layout.Key(key) != key
+}
+
+func (k *keyLayoutDFS) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := k.dfs.Download(ctx, k.layout.Key(path))
+	if err != nil && k.moved(path) {
+		if legacyRC, legacyErr := k.dfs.Download(ctx, path); legacyErr == nil {
+			return legacyRC, nil
+		}
+	}
+
+	return rc, err
+}
+
+func (k *keyLayoutDFS) DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := k.dfs.DownloadRange(ctx, k.layout.Key(path), offset, length)
+	if err != nil && !errors.Is(err, ErrRangeUnsupported) && k.moved(path) {
+		if legacyRC, legacyErr := k.dfs.DownloadRange(ctx, path, offset, length); legacyErr == nil {
+			return legacyRC, nil
+		}
+	}
+
+	return rc, err
+}
+
+func (k *keyLayoutDFS) DownloadDir(skynetLink, dir string) error {
+	return k.dfs.DownloadDir(skynetLink, dir)
+}
+
+func (k *keyLayoutDFS) List(path string) ([]*types.Metadata, error) {
+	return k.dfs.List(k.layout.Key(path))
+}
+
+func (k *keyLayoutDFS) AddImage(ns string, mf, l map[string][]byte) (string, error) {
+	return k.dfs.AddImage(ns, mf, l)
+}
+
+func (k *keyLayoutDFS) Metadata(ctx context.Context, skylink string) (*skynet.Metadata, error) {
+	metadata, err := k.dfs.Metadata(ctx, k.layout.Key(skylink))
+	if err != nil && k.moved(skylink) {
+		if legacyMetadata, legacyErr := k.dfs.Metadata(ctx, skylink); legacyErr == nil {
+			return legacyMetadata, nil
+		}
+	}
+
+	return metadata, err
+}
+
+func (k *keyLayoutDFS) GetUploadProgress(
+	ctx context.Context,
+	identifier, uploadID string,
+) (*types.ObjectMetadata, error) {
+	return k.dfs.GetUploadProgress(ctx, k.layout.Key(identifier), uploadID)
+}
+
+func (k *keyLayoutDFS) Exists(ctx context.Context, key string) (bool, error) {
+	exists, err := k.dfs.Exists(ctx, k.layout.Key(key))
+	if err == nil && !exists && k.moved(key) {
+		return k.dfs.Exists(ctx, key)
+	}
+
+	return exists, err
+}
+
+// DeleteObject deletes the object at both keys, deleting a key which has no object isn't an error
+func (k *keyLayoutDFS) DeleteObject(ctx context.Context, key string) error {
+	if err := k.dfs.DeleteObject(ctx, k.layout.Key(key)); err != nil {
+		return err
+	}
+
+	if k.moved(key) {
+		return k.dfs.DeleteObject(ctx, key)
+	}
+
+	return nil
+}
+
+// PresignedURL signs the key the object is at, a URL is signed whether or not there's an object
+func (k *keyLayoutDFS) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	mapped := k.layout.Key(key)
+	if k.moved(key) {
+		if exists, err := k.dfs.Exists(ctx, mapped); err == nil && !exists {
+			if exists, err = k.dfs.Exists(ctx, key); err == nil && exists {
+				mapped = key
+			}
+		}
+	}
+
+	return k.dfs.PresignedURL(ctx, mapped, expires)
+}
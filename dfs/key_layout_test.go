@@ -0,0 +1,124 @@
+package dfs_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+)
+
+func TestKeyLayout(t *testing.T) {
+	tests := []struct {
+		layout string
+		key    string
+		want   string
+	}{
+		{layout: "", key: "layers/0b8d3d2e", want: "layers/0b8d3d2e"},
+		{layout: "openregistry/{{.Key}}", key: "layers/0b8d3d2e", want: "openregistry/layers/0b8d3d2e"},
+		{
+			layout: "{{.Kind}}/{{shard 2 .ID}}/{{.Key}}",
+			key:    "layers/0b8d3d2e",
+			want:   "layers/0b/layers/0b8d3d2e",
+		},
+		{
+			layout: "{{.Kind}}/{{shard 9 .ID}}/{{.Key}}",
+			key:    "manifests/sha256:3f2b7a1d",
+			want:   "manifests/sha256:3f/manifests/sha256:3f2b7a1d",
+		},
+		{
+			layout: "{{.Kind}}/{{if .Namespace}}{{.Namespace}}/{{end}}{{.ID}}",
+			key:    "johndoe/alpine/manifests/latest",
+			want:   "manifests/johndoe/alpine/latest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			layout, err := dfs.NewKeyLayout(tt.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := layout.Key(tt.key); got != tt.want {
+				t.Errorf("got key %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKeyLayoutInvalid(t *testing.T) {
+	for _, layout := range []string{
+		"{{.Key",
+		"{{.Digest}}",
+		"static",
+		"{{.Kind}}",
+		"/{{.Key}}",
+		// the manifests of two repositories with the same reference
+		"{{.Kind}}/{{.ID}}",
+	} {
+		if _, err := dfs.NewKeyLayout(layout); err == nil {
+			t.Errorf("%q: got no error, want the layout rejected", layout)
+		}
+	}
+}
+
+// TestKeyLayoutFallback reads and deletes an object stored at its registry key, before the layout was set
+func TestKeyLayoutFallback(t *testing.T) {
+	ctx := context.Background()
+	layout, err := dfs.NewKeyLayout("openregistry/{{.Key}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := memory.New()
+	storage.Put("layers/legacy", []byte("legacy layer"))
+	withLayout := dfs.WithKeyLayout(storage, layout)
+	if _, err = withLayout.Upload(ctx, "layers/new", "", []byte("new layer")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"layers/legacy", "layers/new"} {
+		if exists, existsErr := withLayout.Exists(ctx, key); existsErr != nil || !exists {
+			t.Errorf("%s: got exists %t and error %v, want it to exist", key, exists, existsErr)
+		}
+		if _, metadataErr := withLayout.Metadata(ctx, key); metadataErr != nil {
+			t.Errorf("%s: got error %v reading the metadata", key, metadataErr)
+		}
+
+		rc, downloadErr := withLayout.Download(ctx, key)
+		if downloadErr != nil {
+			t.Fatalf("%s: got error %v downloading it", key, downloadErr)
+		}
+		content, _ := io.ReadAll(rc)
+		_ = rc.Close()
+
+		rc, downloadErr = withLayout.DownloadRange(ctx, key, 0, 3)
+		if downloadErr != nil {
+			t.Fatalf("%s: got error %v downloading a range", key, downloadErr)
+		}
+		part, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if string(part) != string(content[:3]) {
+			t.Errorf("%s: got range %q, want %q", key, part, content[:3])
+		}
+	}
+
+	if keys := storage.Keys(); len(keys) != 2 || keys[0] != "layers/legacy" || keys[1] != "openregistry/layers/new" {
+		t.Errorf("got keys %v, want the new object stored with the layout", keys)
+	}
+
+	if exists, _ := withLayout.Exists(ctx, "layers/missing"); exists {
+		t.Error("got a missing object to exist")
+	}
+
+	if err = withLayout.DeleteObject(ctx, "layers/legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if storage.Deletes("layers/legacy") != 1 || storage.Deletes("openregistry/layers/legacy") != 1 {
+		t.Error("the object wasn't deleted at both keys")
+	}
+	if exists, _ := withLayout.Exists(ctx, "layers/legacy"); exists {
+		t.Error("the legacy object still exists after the delete")
+	}
+}
@@ -0,0 +1,310 @@
+// Package memory is a DFS keeping the objects in memory, for the tests and the integration suite. It counts the
+// calls made to it so that tests can assert how the registry uses the storage
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// ErrNotFound is returned for the objects and uploads the DFS doesn't have
+var ErrNotFound = errors.New("ERR_OBJECT_NOT_FOUND") //nolint
+
+type (
+	// DFS is safe for concurrent use. Ranged reads are served unless RangeUnsupported is set, the registry then falls
+	// back to downloading whole objects. MinPartSize is enforced like S3 does, every part of a multipart upload but
+	// the last must be at least that big
+	DFS struct {
+		mu      *sync.Mutex
+		objects map[string][]byte
+		uploads map[string]*multipartUpload
+		calls   map[string]int
+		deletes map[string]int
+		nextID  int
+
+		RangeUnsupported bool
+		MinPartSize      int
+	}
+
+	multipartUpload struct {
+		key   string
+		parts map[int32][]byte
+	}
+)
+
+func New() *DFS {
+	return &DFS{
+		mu:      &sync.Mutex{},
+		objects: make(map[string][]byte),
+		uploads: make(map[string]*multipartUpload),
+		calls:   make(map[string]int),
+		deletes: make(map[string]int),
+	}
+}
+
+// Calls returns the number of calls made to the DFS method (e.g. "DownloadRange")
+func (m *DFS) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.calls[method]
+}
+
+// Deletes returns the number of times DeleteObject was called for the key
+func (m *DFS) Deletes(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deletes[key]
+}
+
+// Keys returns the keys of the stored objects, sorted
+func (m *DFS) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Put stores an object directly, without going through an upload
+func (m *DFS) Put(key string, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = append([]byte(nil), content...)
+}
+
+func (m *DFS) call(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[method]++
+}
+
+func (m *DFS) Upload(_ context.Context, key, _ string, content []byte) (string, error) {
+	m.call("Upload")
+	m.Put(key, content)
+	return key, nil
+}
+
+func (m *DFS) CreateMultipartUpload(_ context.Context, key string) (string, error) {
+	m.call("CreateMultipartUpload")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	uploadID := strconv.Itoa(m.nextID)
+	m.uploads[uploadID] = &multipartUpload{key: key, parts: make(map[int32][]byte)}
+	return uploadID, nil
+}
+
+func (m *DFS) UploadPart(
+	_ context.Context,
+	uploadId string,
+	_ string,
+	digest string,
+	partNumber int64,
+	content io.ReadSeeker,
+	_ int64,
+) (s3types.CompletedPart, error) {
+	m.call("UploadPart")
+
+	part, err := io.ReadAll(content)
+	if err != nil {
+		return s3types.CompletedPart{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadId]
+	if !ok {
+		return s3types.CompletedPart{}, fmt.Errorf("%w: upload %s", ErrNotFound, uploadId)
+	}
+	upload.parts[int32(partNumber)] = part
+
+	return s3types.CompletedPart{
+		ChecksumSHA256: aws.String(digest),
+		ETag:           aws.String(strconv.FormatInt(partNumber, 10)),
+		PartNumber:     int32(partNumber),
+	}, nil
+}
+
+func (m *DFS) CompleteMultipartUploadInput(
+	_ context.Context,
+	uploadId string,
+	key string,
+	_ string,
+	completedParts []s3types.CompletedPart,
+) (string, error) {
+	m.call("CompleteMultipartUploadInput")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadId]
+	if !ok {
+		return "", fmt.Errorf("%w: upload %s", ErrNotFound, uploadId)
+	}
+
+	content := &bytes.Buffer{}
+	for i, completed := range completedParts {
+		part, ok := upload.parts[completed.PartNumber]
+		if !ok {
+			return "", fmt.Errorf("%w: part %d of upload %s", ErrNotFound, completed.PartNumber, uploadId)
+		}
+		if i < len(completedParts)-1 && len(part) < m.MinPartSize {
+			return "", fmt.Errorf("ERR_ENTITY_TOO_SMALL: part %d of upload %s is %d bytes", completed.PartNumber,
+				uploadId, len(part))
+		}
+		content.Write(part)
+	}
+
+	m.objects[key] = content.Bytes()
+	delete(m.uploads, uploadId)
+	return key, nil
+}
+
+func (m *DFS) AbortMultipartUpload(_ context.Context, uploadId, _ string) error {
+	m.call("AbortMultipartUpload")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uploads, uploadId)
+	return nil
+}
+
+// Uploads returns the number of multipart uploads which are neither complete nor aborted
+func (m *DFS) Uploads() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.uploads)
+}
+
+func (m *DFS) object(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return content, nil
+}
+
+func (m *DFS) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	m.call("Download")
+
+	content, err := m.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (m *DFS) DownloadRange(_ context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	m.call("DownloadRange")
+	if m.RangeUnsupported {
+		return nil, dfs.ErrRangeUnsupported
+	}
+
+	content, err := m.object(key)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset+length > int64(len(content)) {
+		return nil, fmt.Errorf("ERR_INVALID_RANGE: %d-%d of %d bytes", offset, offset+length-1, len(content))
+	}
+
+	return io.NopCloser(bytes.NewReader(content[offset : offset+length])), nil
+}
+
+func (m *DFS) DownloadDir(_, _ string) error {
+	return fmt.Errorf("ERR_UNSUPPORTED: the memory DFS has no directories")
+}
+
+func (m *DFS) List(_ string) ([]*types.Metadata, error) {
+	return nil, nil
+}
+
+func (m *DFS) AddImage(_ string, _, _ map[string][]byte) (string, error) {
+	return "", fmt.Errorf("ERR_UNSUPPORTED: the memory DFS doesn't store images as directories")
+}
+
+func (m *DFS) Metadata(_ context.Context, key string) (*skynet.Metadata, error) {
+	m.call("Metadata")
+
+	content, err := m.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &skynet.Metadata{
+		ContentType:   "application/octet-stream",
+		Etag:          key,
+		Skylink:       key,
+		ContentLength: len(content),
+	}, nil
+}
+
+func (m *DFS) GetUploadProgress(_ context.Context, _, uploadID string) (*types.ObjectMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("%w: upload %s", ErrNotFound, uploadID)
+	}
+
+	size := 0
+	for _, part := range upload.parts {
+		size += len(part)
+	}
+
+	return &types.ObjectMetadata{ContentLength: size}, nil
+}
+
+func (m *DFS) Exists(_ context.Context, key string) (bool, error) {
+	m.call("Exists")
+
+	_, err := m.object(key)
+	return err == nil, nil
+}
+
+func (m *DFS) DeleteObject(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls["DeleteObject"]++
+	m.deletes[key]++
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *DFS) PresignedURL(_ context.Context, _ string, _ time.Duration) (string, error) {
+	return "", dfs.ErrPresignUnsupported
+}
@@ -0,0 +1,189 @@
+package dfs
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/telemetry/tracing"
+	"github.com/containerish/OpenRegistry/types"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	attributeKey      = attribute.Key("dfs.key")
+	attributeUploadID = attribute.Key("dfs.upload_id")
+)
+
+// tracedDFS wraps a DFS and records a span for each call, as a child of the span in the context. The calls which
+// only the Skynet backend serves don't take a context, they show up as their own traces
+type tracedDFS struct {
+	dfs DFS
+}
+
+// WithTracing returns dfs as is when tracing is disabled
+func WithTracing(dfs DFS) DFS {
+	if !tracing.Enabled() {
+		return dfs
+	}
+
+	return &tracedDFS{dfs: dfs}
+}
+
+func (t *tracedDFS) Upload(ctx context.Context, namespace, digest string, content []byte) (string, error) {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.Upload",
+		tracing.AttributeNamespace.String(namespace),
+		tracing.AttributeDigest.String(digest),
+	)
+	link, err := t.dfs.Upload(ctx, namespace, digest, content)
+	tracing.EndSpan(span, err)
+	return link, err
+}
+
+func (t *tracedDFS) CreateMultipartUpload(ctx context.Context, namespace string) (string, error) {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.CreateMultipartUpload",
+		attributeKey.String(namespace),
+	)
+	uploadID, err := t.dfs.CreateMultipartUpload(ctx, namespace)
+	tracing.EndSpan(span, err)
+	return uploadID, err
+}
+
+func (t *tracedDFS) UploadPart(
+	ctx context.Context,
+	uploadId string,
+	key string,
+	digest string,
+	partNumber int64,
+	content io.ReadSeeker,
+	contentLength int64,
+) (s3types.CompletedPart, error) {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.UploadPart",
+		attributeKey.String(key),
+		attributeUploadID.String(uploadId),
+		tracing.AttributeDigest.String(digest),
+		attribute.Int64("dfs.part_number", partNumber),
+		attribute.Int64("dfs.content_length", contentLength),
+	)
+	part, err := t.dfs.UploadPart(ctx, uploadId, key, digest, partNumber, content, contentLength)
+	tracing.EndSpan(span, err)
+	return part, err
+}
+
+func (t *tracedDFS) CompleteMultipartUploadInput(
+	ctx context.Context,
+	uploadId string,
+	key string,
+	finalDigest string,
+	completedParts []s3types.CompletedPart,
+) (string, error) {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.CompleteMultipartUpload",
+		attributeKey.String(key),
+		attributeUploadID.String(uploadId),
+		tracing.AttributeDigest.String(finalDigest),
+		attribute.Int("dfs.parts", len(completedParts)),
+	)
+	link, err := t.dfs.CompleteMultipartUploadInput(ctx, uploadId, key, finalDigest, completedParts)
+	tracing.EndSpan(span, err)
+	return link, err
+}
+
+func (t *tracedDFS) AbortMultipartUpload(ctx context.Context, uploadId, key string) error {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.AbortMultipartUpload",
+		attributeKey.String(key),
+		attributeUploadID.String(uploadId),
+	)
+	err := t.dfs.AbortMultipartUpload(ctx, uploadId, key)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedDFS) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	ctx, span := tracing.StartSpan(ctx, "dfs.Download", attributeKey.String(path))
+	rc, err := t.dfs.Download(ctx, path)
+	tracing.EndSpan(span, err)
+	return rc, err
+}
+
+func (t *tracedDFS) DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	ctx, span := tracing.StartSpan(ctx, "dfs.DownloadRange", attributeKey.String(path))
+	rc, err := t.dfs.DownloadRange(ctx, path, offset, length)
+	tracing.EndSpan(span, err)
+	return rc, err
+}
+
+func (t *tracedDFS) DownloadDir(skynetLink, dir string) error {
+	_, span := tracing.StartSpan(context.Background(), "dfs.DownloadDir", attributeKey.String(skynetLink))
+	err := t.dfs.DownloadDir(skynetLink, dir)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedDFS) List(path string) ([]*types.Metadata, error) {
+	_, span := tracing.StartSpan(context.Background(), "dfs.List", attributeKey.String(path))
+	list, err := t.dfs.List(path)
+	tracing.EndSpan(span, err)
+	return list, err
+}
+
+func (t *tracedDFS) AddImage(ns string, mf, l map[string][]byte) (string, error) {
+	_, span := tracing.StartSpan(context.Background(), "dfs.AddImage", tracing.AttributeNamespace.String(ns))
+	link, err := t.dfs.AddImage(ns, mf, l)
+	tracing.EndSpan(span, err)
+	return link, err
+}
+
+func (t *tracedDFS) Metadata(ctx context.Context, skylink string) (*skynet.Metadata, error) {
+	ctx, span := tracing.StartSpan(ctx, "dfs.Metadata", attributeKey.String(skylink))
+	metadata, err := t.dfs.Metadata(ctx, skylink)
+	tracing.EndSpan(span, err)
+	return metadata, err
+}
+
+func (t *tracedDFS) GetUploadProgress(
+	ctx context.Context,
+	identifier, uploadID string,
+) (*types.ObjectMetadata, error) {
+	ctx, span := tracing.StartSpan(
+		ctx,
+		"dfs.GetUploadProgress",
+		attributeKey.String(identifier),
+		attributeUploadID.String(uploadID),
+	)
+	metadata, err := t.dfs.GetUploadProgress(ctx, identifier, uploadID)
+	tracing.EndSpan(span, err)
+	return metadata, err
+}
+
+func (t *tracedDFS) DeleteObject(ctx context.Context, key string) error {
+	ctx, span := tracing.StartSpan(ctx, "dfs.DeleteObject", attributeKey.String(key))
+	err := t.dfs.DeleteObject(ctx, key)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedDFS) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "dfs.Exists", attributeKey.String(key))
+	exists, err := t.dfs.Exists(ctx, key)
+	tracing.EndSpan(span, err)
+	return exists, err
+}
+
+func (t *tracedDFS) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	ctx, span := tracing.StartSpan(ctx, "dfs.PresignedURL", attributeKey.String(key))
+	url, err := t.dfs.PresignedURL(ctx, key, expires)
+	tracing.EndSpan(span, err)
+	return url, err
+}
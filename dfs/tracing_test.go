@@ -0,0 +1,61 @@
+package dfs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/telemetry/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracingNestsSpans checks that the DFS spans are children of the span of the request they are made for
+func TestTracingNestsSpans(t *testing.T) {
+	ctx := context.Background()
+	shutdown, err := tracing.Setup(&config.Telemetry{Enabled: true, Endpoint: "http://localhost:4318"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = shutdown(ctx) }()
+
+	// the spans are recorded instead of exported
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { _ = provider.Shutdown(ctx) }()
+	otel.SetTracerProvider(provider)
+
+	storage := dfs.WithTracing(memory.New())
+	requestCtx, requestSpan := tracing.StartSpan(ctx, "GET /v2/")
+	uploadID, err := storage.CreateMultipartUpload(requestCtx, "layers/traced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storage.GetUploadProgress(requestCtx, "layers/traced", uploadID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storage.Upload(requestCtx, "layers/traced", "", []byte("traced layer")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storage.Metadata(requestCtx, "layers/traced"); err != nil {
+		t.Fatal(err)
+	}
+	requestSpan.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("got %d spans, want 5", len(spans))
+	}
+	for _, span := range spans[:4] {
+		if span.Parent().SpanID() != requestSpan.SpanContext().SpanID() {
+			t.Errorf("%s: got parent %s, want the request span %s",
+				span.Name(), span.Parent().SpanID(), requestSpan.SpanContext().SpanID())
+		}
+		if span.SpanContext().TraceID() != requestSpan.SpanContext().TraceID() {
+			t.Errorf("%s: got trace %s, want the trace of the request", span.Name(), span.SpanContext().TraceID())
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// waitForAuditEvents polls the audit log until it has want events matching the filter, they're written in the
+// background
+func waitForAuditEvents(t *testing.T, filter *types.AuditLogFilter, want int) []*types.AuditEvent {
+	t.Helper()
+
+	var events []*types.AuditEvent
+	for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); time.Sleep(time.Millisecond * 50) {
+		var err error
+		events, err = testServer.store.GetAuditEvents(context.Background(), filter, 50, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) >= want {
+			break
+		}
+	}
+
+	if len(events) != want {
+		t.Fatalf("got %d audit events for %+v, want %d", len(events), filter, want)
+	}
+	return events
+}
+
+func TestPushIsAudited(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	name := repository(t, "audited")
+	img := newImage(t, randomBlob(t, 256))
+	pushImage(t, name, img, "v1")
+
+	events := waitForAuditEvents(t, &types.AuditLogFilter{Namespace: name, ActorId: testServer.user.Id}, 1)
+	if events[0].Action != types.AuditActionPush || events[0].Reference != "v1" {
+		t.Errorf("got event %+v, want the push of v1", events[0])
+	}
+
+	// the filters narrow the log down
+	waitForAuditEvents(t, &types.AuditLogFilter{Namespace: name, Since: start}, 1)
+	waitForAuditEvents(t, &types.AuditLogFilter{Namespace: name, Since: time.Now().Add(time.Hour)}, 0)
+	waitForAuditEvents(t, &types.AuditLogFilter{Namespace: name, ActorId: "00000000-0000-0000-0000-000000000000"}, 0)
+}
@@ -0,0 +1,219 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+type (
+	descriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int    `json:"size"`
+	}
+
+	manifest struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Config        descriptor   `json:"config"`
+		Layers        []descriptor `json:"layers"`
+	}
+
+	// image is what pushImage uploads, the manifest references the config and layers by digest
+	image struct {
+		config   []byte
+		layers   [][]byte
+		manifest []byte
+		digest   string
+	}
+)
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// repository returns a name under the test user which no other test uses, path is the rest of the name,
+// e.g. group/image
+func repository(t *testing.T, path string) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%s/%s%s", testServer.user.Username, path, hex.EncodeToString(suffix))
+}
+
+// do sends the request with the test user's token, the body of the response is read and closed
+func do(t *testing.T, method, path string, header http.Header, body []byte) (*http.Response, []byte) {
+	t.Helper()
+
+	return doWithToken(t, testServer.token, method, path, header, body)
+}
+
+// doWithToken sends the request anonymously when the token is empty
+func doWithToken(
+	t *testing.T, token, method, path string, header http.Header, body []byte,
+) (*http.Response, []byte) {
+	t.Helper()
+
+	url := path
+	if !strings.HasPrefix(path, "http") {
+		url = testServer.http.URL + path
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, content
+}
+
+func expectStatus(t *testing.T, resp *http.Response, body []byte, want int) {
+	t.Helper()
+
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s: got status %d, want %d: %s",
+			resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+// pushBlob uploads the blob in a single POST
+func pushBlob(t *testing.T, name string, content []byte) {
+	t.Helper()
+
+	path := fmt.Sprintf("/v2/%s/blobs/uploads/?digest=%s", name, digestOf(content))
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, body := do(t, http.MethodPost, path, header, content)
+	expectStatus(t, resp, body, http.StatusCreated)
+}
+
+// pushBlobChunked uploads the blob in two PATCH requests, then closes the upload with the digest
+func pushBlobChunked(t *testing.T, name string, content []byte) {
+	t.Helper()
+
+	resp, body := do(t, http.MethodPost, fmt.Sprintf("/v2/%s/blobs/uploads/", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+	location := resp.Header.Get("Location")
+
+	half := len(content) / 2
+	for _, chunk := range []struct{ start, end int }{{0, half}, {half, len(content)}} {
+		header := http.Header{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {fmt.Sprintf("%d-%d", chunk.start, chunk.end-1)},
+		}
+		resp, body = do(t, http.MethodPatch, location, header, content[chunk.start:chunk.end])
+		expectStatus(t, resp, body, http.StatusAccepted)
+		if want := fmt.Sprintf("0-%d", chunk.end-1); resp.Header.Get("Range") != want {
+			t.Errorf("got Range %s after a chunk, want %s", resp.Header.Get("Range"), want)
+		}
+		location = resp.Header.Get("Location")
+	}
+
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	resp, body = do(t, http.MethodPut, location+separator+"digest="+digestOf(content), nil, nil)
+	expectStatus(t, resp, body, http.StatusCreated)
+}
+
+func randomBlob(t *testing.T, size int) []byte {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+// newImage has a random config, so that its digest is unique, and the given layers
+func newImage(t *testing.T, layers ...[]byte) *image {
+	config := []byte(fmt.Sprintf(
+		`{"architecture":"amd64","os":"linux","config":{"Labels":{"nonce":"%x"}},"rootfs":{"type":"layers"}}`,
+		randomBlob(t, 8),
+	))
+
+	m := manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config:        descriptor{MediaType: mediaTypeOCIConfig, Digest: digestOf(config), Size: len(config)},
+	}
+	for _, layer := range layers {
+		m.Layers = append(m.Layers, descriptor{MediaType: mediaTypeOCILayer, Digest: digestOf(layer), Size: len(layer)})
+	}
+
+	content, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &image{config: config, layers: layers, manifest: content, digest: digestOf(content)}
+}
+
+// pushImage uploads the blobs of the image and tags its manifest with every tag
+func pushImage(t *testing.T, name string, img *image, tags ...string) {
+	t.Helper()
+
+	for _, layer := range img.layers {
+		pushBlob(t, name, layer)
+	}
+	pushBlob(t, name, img.config)
+
+	for _, tag := range tags {
+		putManifest(t, name, tag, img.manifest)
+	}
+}
+
+func putManifest(t *testing.T, name, reference string, content []byte) {
+	t.Helper()
+
+	header := http.Header{"Content-Type": {mediaTypeOCIManifest}}
+	path := fmt.Sprintf("/v2/%s/manifests/%s", name, reference)
+	resp, body := do(t, http.MethodPut, path, header, content)
+	expectStatus(t, resp, body, http.StatusCreated)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != digestOf(content) {
+		t.Errorf("got Docker-Content-Digest %s, want %s", got, digestOf(content))
+	}
+}
+
+func getManifest(t *testing.T, name, reference string) (*http.Response, []byte) {
+	t.Helper()
+
+	header := http.Header{"Accept": {mediaTypeOCIManifest}}
+	return do(t, http.MethodGet, fmt.Sprintf("/v2/%s/manifests/%s", name, reference), header, nil)
+}
@@ -0,0 +1,196 @@
+//go:build integration
+// +build integration
+
+// Package integration runs the distribution API of a full OpenRegistry server, wired as cmd/serve does, against
+// a test Postgres and an in-memory DFS. Run it with `make integration`, the database is set with the
+// OPENREGISTRY_TEST_DB_* variables (see testStoreConfig) and is migrated by the suite
+package integration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/audit"
+	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/db"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/registry/v2/builds"
+	"github.com/containerish/OpenRegistry/registry/v2/extensions"
+	"github.com/containerish/OpenRegistry/registry/v2/retention"
+	"github.com/containerish/OpenRegistry/router"
+	"github.com/containerish/OpenRegistry/services/email"
+	"github.com/containerish/OpenRegistry/stats"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/containerish/OpenRegistry/webhooks"
+	"github.com/labstack/echo/v4"
+)
+
+// testServer is shared by the tests, each test pushes to repositories of its own under the test user
+var testServer *server //nolint
+
+type (
+	server struct {
+		cfg   *config.OpenRegistryConfig
+		store postgres.PersistentStore
+		dfs   *memory.DFS
+		http  *httptest.Server
+		user  *types.User
+		token string
+	}
+
+	nopLogger struct{}
+)
+
+func (nopLogger) Log(echo.Context, error) {}
+
+func TestMain(m *testing.M) {
+	s, shutdown, err := newServer(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error starting the integration server: %s\n", err)
+		os.Exit(1)
+	}
+
+	testServer = s
+	code := m.Run()
+	shutdown()
+	os.Exit(code)
+}
+
+// testStoreConfig defaults to the database of the Makefile, with the open_registry_test name
+func testStoreConfig() *config.Store {
+	port, err := strconv.Atoi(env("OPENREGISTRY_TEST_DB_PORT", "5432"))
+	if err != nil {
+		port = 5432
+	}
+
+	return &config.Store{
+		Kind:     "postgres",
+		User:     env("OPENREGISTRY_TEST_DB_USER", "postgres"),
+		Password: env("OPENREGISTRY_TEST_DB_PASSWORD", "postgres"),
+		Host:     env("OPENREGISTRY_TEST_DB_HOST", "0.0.0.0"),
+		Database: env("OPENREGISTRY_TEST_DB_NAME", "open_registry_test"),
+		Port:     port,
+	}
+}
+
+func env(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func newServer(ctx context.Context) (*server, func(), error) {
+	cfg := &config.OpenRegistryConfig{
+		Registry: &config.Registry{
+			DNSAddress:    "localhost",
+			FQDN:          "localhost",
+			SigningSecret: "integration-tests-signing-secret",
+			Host:          "localhost",
+			Port:          5000,
+		},
+		StoreConfig:    testStoreConfig(),
+		SkynetConfig:   &config.Skynet{SkynetPortalURL: "http://localhost"},
+		DFS:            &config.DFS{S3Any: &config.S3CompatibleDFS{DFSLinkResolver: "http://localhost"}},
+		OAuth:          &config.OAuth{},
+		Email:          &config.Email{Mode: config.EmailModeLog},
+		WebAppEndpoint: "http://localhost:3000",
+		Environment:    config.Local,
+	}
+	if err := cfg.ApplyEnvironmentDefaults(); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := postgres.Migrate(ctx, cfg.StoreConfig, db.Migrations()); err != nil {
+		return nil, nil, fmt.Errorf("ERR_PG_MIGRATE: %w", err)
+	}
+	pgStore, err := postgres.New(cfg.StoreConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERR_PG_CONN: %w", err)
+	}
+
+	logger := nopLogger{}
+	auditLogger := audit.New(pgStore, logger)
+	webhookNotifier := webhooks.New(cfg.Webhooks, pgStore)
+	statsRecorder := stats.New(pgStore)
+	emailClient, err := email.New(cfg.Email, cfg.WebAppEndpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	storage := memory.New()
+	authSvc := auth.New(cfg, pgStore, storage, logger, auditLogger, types.DefaultPasswordPolicy(), emailClient)
+	reg, err := registry.NewRegistry(pgStore, storage, logger, cfg, auditLogger, webhookNotifier, statsRecorder)
+	if err != nil {
+		return nil, nil, err
+	}
+	ext, err := extensions.New(pgStore, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	retentionEvaluator := retention.New(cfg.Retention, pgStore, storage, logger)
+
+	e := echo.New()
+	readOnly := router.NewReadOnlyMode(false, logger)
+	router.Register(cfg, e, reg, authSvc, ext, auditLogger, retentionEvaluator, builds.New(pgStore, logger), readOnly)
+
+	user, err := newTestUser(ctx, pgStore, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := auth.NewAccessToken(cfg, user, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &server{
+		cfg:   cfg,
+		store: pgStore,
+		dfs:   storage,
+		http:  httptest.NewServer(e),
+		user:  user,
+		token: token,
+	}
+	shutdown := func() {
+		s.http.Close()
+		reg.Close()
+		retentionEvaluator.Close()
+		statsRecorder.Close()
+		webhookNotifier.Close()
+		auditLogger.Close()
+		pgStore.Close()
+	}
+
+	return s, shutdown, nil
+}
+
+// newTestUser signs up a user with a random name, so that the suite can run again on the same database. The
+// name ends with the suffix
+func newTestUser(ctx context.Context, store postgres.PersistentStore, suffix string) (*types.User, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	username := "integration" + hex.EncodeToString(random) + suffix
+	user := &types.User{
+		Username: username,
+		Email:    username + "@openregistry.dev",
+		Password: "unused-password",
+		IsActive: true,
+	}
+	if err := store.AddUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return store.GetUser(ctx, username, false)
+}
@@ -0,0 +1,76 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/db"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TestMigrateDownAndUp rolls back the last two migrations of the test database, then applies them again
+func TestMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	cfg := testServer.cfg.StoreConfig
+
+	latest, err := postgres.Migrate(ctx, cfg, db.Migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = postgres.CheckSchema(ctx, cfg, db.Migrations()); err != nil {
+		t.Fatalf("got error %v checking the migrated schema", err)
+	}
+
+	version, err := postgres.MigrateDown(ctx, cfg, db.Migrations(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latest-2 {
+		t.Fatalf("got version %d after rolling back two migrations, want %d", version, latest-2)
+	}
+	if err = postgres.CheckSchema(ctx, cfg, db.Migrations()); err == nil {
+		t.Error("the rolled back schema passed the check")
+	}
+
+	if version, err = postgres.Migrate(ctx, cfg, db.Migrations()); err != nil || version != latest {
+		t.Fatalf("got version %d and error %v migrating again, want %d", version, err, latest)
+	}
+	if err = postgres.CheckSchema(ctx, cfg, db.Migrations()); err != nil {
+		t.Errorf("got error %v checking the schema migrated again", err)
+	}
+}
+
+// TestCheckSchemaMissing checks an empty database, as if the server was started before the migrations ever ran
+func TestCheckSchemaMissing(t *testing.T) {
+	ctx := context.Background()
+	cfg := *testServer.cfg.StoreConfig
+
+	conn, err := pgxpool.Connect(ctx, cfg.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg.Database = testServer.cfg.StoreConfig.Database + "_empty"
+	if _, err = conn.Exec(ctx, "drop database if exists "+cfg.Database); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(ctx, "create database "+cfg.Database); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := conn.Exec(ctx, "drop database if exists "+cfg.Database); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	err = postgres.CheckSchema(ctx, &cfg, db.Migrations())
+	if err == nil || !strings.Contains(err.Error(), "ERR_SCHEMA_OUTDATED: schema is at version 0") {
+		t.Errorf("got error %v checking the empty database, want ERR_SCHEMA_OUTDATED", err)
+	}
+}
@@ -0,0 +1,638 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+func TestPushPull(t *testing.T) {
+	name := repository(t, "alpine")
+	img := newImage(t, randomBlob(t, 1024), randomBlob(t, 2048))
+	pushImage(t, name, img, "latest")
+
+	for _, reference := range []string{"latest", img.digest} {
+		resp, body := getManifest(t, name, reference)
+		expectStatus(t, resp, body, http.StatusOK)
+		if !bytes.Equal(body, img.manifest) {
+			t.Errorf("%s: got manifest %s, want %s", reference, body, img.manifest)
+		}
+		if got := resp.Header.Get("Docker-Content-Digest"); got != img.digest {
+			t.Errorf("%s: got Docker-Content-Digest %s, want %s", reference, got, img.digest)
+		}
+		if got := resp.Header.Get("Content-Type"); got != mediaTypeOCIManifest {
+			t.Errorf("%s: got Content-Type %s, want %s", reference, got, mediaTypeOCIManifest)
+		}
+	}
+
+	for _, blob := range append(img.layers, img.config) {
+		resp, body := do(t, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(blob)), nil, nil)
+		expectStatus(t, resp, body, http.StatusOK)
+		if !bytes.Equal(body, blob) {
+			t.Errorf("got %d bytes for blob %s, want the %d bytes pushed", len(body), digestOf(blob), len(blob))
+		}
+		if got := resp.Header.Get("Docker-Content-Digest"); got != digestOf(blob) {
+			t.Errorf("got Docker-Content-Digest %s, want %s", got, digestOf(blob))
+		}
+	}
+}
+
+func TestPushChunked(t *testing.T) {
+	name := repository(t, "chunked")
+	layer := randomBlob(t, 4096)
+	pushBlobChunked(t, name, layer)
+
+	resp, body := do(t, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(layer)), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	if !bytes.Equal(body, layer) {
+		t.Errorf("got %d bytes for the chunked blob, want the %d bytes pushed", len(body), len(layer))
+	}
+
+	img := newImage(t, layer)
+	pushBlob(t, name, img.config)
+	putManifest(t, name, "chunked", img.manifest)
+}
+
+func TestHead(t *testing.T) {
+	name := repository(t, "head")
+	layer := randomBlob(t, 512)
+	img := newImage(t, layer)
+	pushImage(t, name, img, "v1")
+
+	resp, body := do(t, http.MethodHead, fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(layer)), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(layer)) {
+		t.Errorf("got blob Content-Length %s, want %d", got, len(layer))
+	}
+	if got := resp.Header.Get("Docker-Content-Digest"); got != digestOf(layer) {
+		t.Errorf("got blob Docker-Content-Digest %s, want %s", got, digestOf(layer))
+	}
+	if len(body) != 0 {
+		t.Errorf("got a %d bytes body for HEAD", len(body))
+	}
+
+	header := http.Header{"Accept": {mediaTypeOCIManifest}}
+	resp, body = do(t, http.MethodHead, fmt.Sprintf("/v2/%s/manifests/v1", name), header, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != img.digest {
+		t.Errorf("got manifest Docker-Content-Digest %s, want %s", got, img.digest)
+	}
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(img.manifest)) {
+		t.Errorf("got manifest Content-Length %s, want %d", got, len(img.manifest))
+	}
+
+	unknown := digestOf(randomBlob(t, 16))
+	resp, body = do(t, http.MethodHead, fmt.Sprintf("/v2/%s/blobs/%s", name, unknown), nil, nil)
+	expectStatus(t, resp, body, http.StatusNotFound)
+	resp, body = do(t, http.MethodHead, fmt.Sprintf("/v2/%s/manifests/unknown", name), header, nil)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestCatalog(t *testing.T) {
+	names := []string{repository(t, "catalog"), repository(t, "catalog")}
+	for _, name := range names {
+		pushImage(t, name, newImage(t, randomBlob(t, 256)), "latest")
+	}
+
+	path := fmt.Sprintf("/v2/_catalog?n=1000&ns=%s", testServer.user.Username)
+	resp, body := do(t, http.MethodGet, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string]bool{}
+	for _, repository := range catalog.Repositories {
+		listed[repository] = true
+	}
+	for _, name := range names {
+		if !listed[name] {
+			t.Errorf("%s isn't in the catalog %v", name, catalog.Repositories)
+		}
+	}
+}
+
+func TestTagsList(t *testing.T) {
+	name := repository(t, "tags")
+	pushImage(t, name, newImage(t, randomBlob(t, 256)), "v2", "v1", "latest")
+
+	resp, body := do(t, http.MethodGet, fmt.Sprintf("/v2/%s/tags/list", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	var tags struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tags.Tags)
+	if want := []string{"latest", "v1", "v2"}; tags.Name != name || !reflect.DeepEqual(tags.Tags, want) {
+		t.Errorf("got %s tags %v, want %s tags %v", tags.Name, tags.Tags, name, want)
+	}
+
+	resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/tags/list?n=1", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	if resp.Header.Get("Link") == "" {
+		t.Error("got no Link header for the first page of tags")
+	}
+}
+
+func TestDeleteManifest(t *testing.T) {
+	name := repository(t, "delete")
+	img := newImage(t, randomBlob(t, 256))
+	pushImage(t, name, img, "latest")
+
+	// the manifest is still tagged
+	path := fmt.Sprintf("/v2/%s/manifests/%s", name, img.digest)
+	resp, body := do(t, http.MethodDelete, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/latest", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+	resp, body = do(t, http.MethodDelete, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+
+	for _, reference := range []string{"latest", img.digest} {
+		resp, body = getManifest(t, name, reference)
+		expectStatus(t, resp, body, http.StatusNotFound)
+	}
+}
+
+func TestDeleteOneOfTwoTags(t *testing.T) {
+	name := repository(t, "twotags")
+	layer := randomBlob(t, 256)
+	img := newImage(t, layer)
+	pushImage(t, name, img, "v1", "latest")
+
+	resp, body := do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/v1", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+
+	resp, body = getManifest(t, name, "v1")
+	expectStatus(t, resp, body, http.StatusNotFound)
+	resp, body = getManifest(t, name, "latest")
+	expectStatus(t, resp, body, http.StatusOK)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != img.digest {
+		t.Errorf("got Docker-Content-Digest %s for the remaining tag, want %s", got, img.digest)
+	}
+	resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(layer)), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestDeleteTagKeepsDigestPullable(t *testing.T) {
+	name := repository(t, "untagged")
+	img := newImage(t, randomBlob(t, 256))
+	pushImage(t, name, img, "latest")
+
+	resp, body := do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/latest", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+
+	resp, body = getManifest(t, name, img.digest)
+	expectStatus(t, resp, body, http.StatusOK)
+	if !bytes.Equal(body, img.manifest) {
+		t.Errorf("got manifest %s by digest, want %s", body, img.manifest)
+	}
+}
+
+func TestDeleteLastTagWithDeleteUntaggedManifests(t *testing.T) {
+	testServer.cfg.Registry.DeleteUntaggedManifests = true
+	t.Cleanup(func() { testServer.cfg.Registry.DeleteUntaggedManifests = false })
+
+	name := repository(t, "untagged")
+	img := newImage(t, randomBlob(t, 256))
+	pushImage(t, name, img, "v1", "latest")
+
+	// the manifest is deleted along with its last tag only
+	resp, body := do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/v1", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+	resp, body = getManifest(t, name, img.digest)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	resp, body = do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/latest", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+	resp, body = getManifest(t, name, img.digest)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestDeleteSharedBaseLayer(t *testing.T) {
+	base := randomBlob(t, 512)
+	first, second := newImage(t, base, randomBlob(t, 256)), newImage(t, base, randomBlob(t, 256))
+	firstName, secondName := repository(t, "base"), repository(t, "base")
+	pushImage(t, firstName, first, "latest")
+	pushImage(t, secondName, second, "latest")
+
+	resp, body := do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/latest", firstName), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+	resp, body = do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/%s", firstName, first.digest), nil, nil)
+	expectStatus(t, resp, body, http.StatusAccepted)
+
+	// the second image still uses the base layer
+	resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", secondName, digestOf(base)), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	resp, body = do(t, http.MethodDelete, fmt.Sprintf("/v2/%s/blobs/%s", secondName, digestOf(base)), nil, nil)
+	expectStatus(t, resp, body, http.StatusConflict)
+}
+
+func TestDeleteReferencedConfigBlob(t *testing.T) {
+	name := repository(t, "config")
+	img := newImage(t, randomBlob(t, 256))
+	pushImage(t, name, img, "latest")
+
+	path := fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(img.config))
+	resp, body := do(t, http.MethodDelete, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusConflict)
+
+	resp, body = do(t, http.MethodGet, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+}
+
+func TestPushPullNestedNamespace(t *testing.T) {
+	// config is a route segment too, the name is resolved from the end of the path
+	for _, path := range []string{"group/sub/image", "group/config/image"} {
+		name := repository(t, path)
+		layer := randomBlob(t, 512)
+		img := newImage(t, layer)
+		pushImage(t, name, img, "tag")
+
+		resp, body := getManifest(t, name, "tag")
+		expectStatus(t, resp, body, http.StatusOK)
+		if !bytes.Equal(body, img.manifest) {
+			t.Errorf("%s: got manifest %s, want %s", name, body, img.manifest)
+		}
+		resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", name, digestOf(layer)), nil, nil)
+		expectStatus(t, resp, body, http.StatusOK)
+
+		resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/tags/list", name), nil, nil)
+		expectStatus(t, resp, body, http.StatusOK)
+		var tags struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &tags); err != nil {
+			t.Fatal(err)
+		}
+		if tags.Name != name {
+			t.Errorf("got tags of %s, want %s", tags.Name, name)
+		}
+	}
+}
+
+func TestManifestDigestHeader(t *testing.T) {
+	name := repository(t, "digest")
+	img := newImage(t, randomBlob(t, 512))
+	pushImage(t, name, img)
+	sum := sha512.Sum512(img.manifest)
+	sha512Digest := "sha512:" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		clientDigest string
+		want         int
+	}{
+		{clientDigest: img.digest, want: http.StatusCreated},
+		{clientDigest: sha512Digest, want: http.StatusCreated},
+		{clientDigest: digestOf([]byte("another manifest")), want: http.StatusBadRequest},
+		{clientDigest: "md5:" + hex.EncodeToString(sum[:16]), want: http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		header := http.Header{"Content-Type": {mediaTypeOCIManifest}, "Docker-Content-Digest": {tt.clientDigest}}
+		tag := fmt.Sprintf("v%d", i)
+		resp, body := do(t, http.MethodPut, fmt.Sprintf("/v2/%s/manifests/%s", name, tag), header, img.manifest)
+		expectStatus(t, resp, body, tt.want)
+
+		if tt.want == http.StatusCreated {
+			// the manifest is stored by its canonical digest whatever algorithm the client used
+			if got := resp.Header.Get("Docker-Content-Digest"); got != img.digest {
+				t.Errorf("%s: got Docker-Content-Digest %s, want %s", tt.clientDigest, got, img.digest)
+			}
+			continue
+		}
+
+		if !bytes.Contains(body, []byte("DIGEST_INVALID")) {
+			t.Errorf("%s: got %s, want DIGEST_INVALID", tt.clientDigest, body)
+		}
+		resp, body = getManifest(t, name, tag)
+		expectStatus(t, resp, body, http.StatusNotFound)
+	}
+}
+
+// catalogAs lists the repositories of the user ns as the owner of the token, anonymously without one
+func catalogAs(t *testing.T, token, ns, query string) ([]string, int64) {
+	t.Helper()
+
+	path := fmt.Sprintf("/v2/_catalog?ns=%s&%s", ns, query)
+	resp, body := doWithToken(t, token, http.MethodGet, path, nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+		Total        int64    `json:"total"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if header := resp.Header.Get("X-Total-Count"); header != strconv.FormatInt(catalog.Total, 10) {
+		t.Errorf("got X-Total-Count %s, want the total %d", header, catalog.Total)
+	}
+	return catalog.Repositories, catalog.Total
+}
+
+func TestCatalogHidesPrivateRepositories(t *testing.T) {
+	ctx := context.Background()
+	public, private := repository(t, "public"), repository(t, "private")
+	pushImage(t, public, newImage(t, randomBlob(t, 256)), "latest")
+	pushImage(t, private, newImage(t, randomBlob(t, 256)), "latest")
+	if err := testServer.store.SetRepositoryVisibility(ctx, private, types.RepositoryVisibilityPrivate); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := newTestUser(ctx, testServer.store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := auth.NewAccessToken(testServer.cfg, other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		viewer      string
+		token       string
+		wantPrivate bool
+	}{
+		{viewer: "anonymous"},
+		{viewer: "another user", token: otherToken},
+		{viewer: "owner", token: testServer.token, wantPrivate: true},
+	}
+
+	for _, tt := range tests {
+		repositories, _ := catalogAs(t, tt.token, testServer.user.Username, "n=1000")
+		listed := map[string]bool{}
+		for _, name := range repositories {
+			listed[name] = true
+		}
+		if !listed[public] {
+			t.Errorf("%s: got catalog %v, want the public repository %s", tt.viewer, repositories, public)
+		}
+		if listed[private] != tt.wantPrivate {
+			t.Errorf("%s: got the private repository listed %t, want %t", tt.viewer, listed[private], tt.wantPrivate)
+		}
+	}
+}
+
+func TestCatalogTotalMatchesFilteredResult(t *testing.T) {
+	ctx := context.Background()
+	owner, err := newTestUser(ctx, testServer.store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerToken, err := auth.NewAccessToken(testServer.cfg, owner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var public []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		namespace := owner.Username + "/" + name
+		addRepository(t, namespace)
+		if name == "b" || name == "d" {
+			err = testServer.store.SetRepositoryVisibility(ctx, namespace, types.RepositoryVisibilityPrivate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		public = append(public, namespace)
+	}
+
+	tests := []struct {
+		viewer    string
+		token     string
+		wantTotal int64
+	}{
+		{viewer: "anonymous", wantTotal: 3},
+		{viewer: "owner", token: ownerToken, wantTotal: 5},
+	}
+
+	for _, tt := range tests {
+		var listed []string
+		for offset := 0; offset < 6; offset += 2 {
+			page, total := catalogAs(t, tt.token, owner.Username, fmt.Sprintf("n=2&last=%d", offset))
+			if total != tt.wantTotal {
+				t.Errorf("%s: got total %d on the page at %d, want %d", tt.viewer, total, offset, tt.wantTotal)
+			}
+			listed = append(listed, page...)
+		}
+		if int64(len(listed)) != tt.wantTotal {
+			t.Errorf("%s: got %d repositories over the pages %v, want the total %d",
+				tt.viewer, len(listed), listed, tt.wantTotal)
+		}
+		if tt.token == "" && !reflect.DeepEqual(listed, public) {
+			t.Errorf("%s: got repositories %v, want the public ones %v", tt.viewer, listed, public)
+		}
+	}
+}
+
+func TestBlobsExist(t *testing.T) {
+	name := repository(t, "exists")
+	present := [][]byte{randomBlob(t, 256), randomBlob(t, 512)}
+	for _, blob := range present {
+		pushBlob(t, name, blob)
+	}
+	absent := []string{digestOf(randomBlob(t, 64)), digestOf(randomBlob(t, 64))}
+
+	digests := []string{absent[0], digestOf(present[0]), absent[1], digestOf(present[1])}
+	request, err := json.Marshal(digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/v2/%s/blobs/exists", name)
+	resp, body := do(t, http.MethodPost, path, http.Header{"Content-Type": {"application/json"}}, request)
+	expectStatus(t, resp, body, http.StatusOK)
+
+	var result struct {
+		Exists  []string `json:"exists"`
+		Missing []string `json:"missing"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result.Exists)
+	wantExists := []string{digestOf(present[0]), digestOf(present[1])}
+	sort.Strings(wantExists)
+	if !reflect.DeepEqual(result.Exists, wantExists) {
+		t.Errorf("got existing blobs %v, want %v", result.Exists, wantExists)
+	}
+	// the missing digests are in the order of the request
+	if !reflect.DeepEqual(result.Missing, absent) {
+		t.Errorf("got missing blobs %v, want %v", result.Missing, absent)
+	}
+
+	tooMany := make([]string, 1001)
+	for i := range tooMany {
+		tooMany[i] = absent[0]
+	}
+	for _, invalid := range [][]string{{"sha256:nothex"}, tooMany} {
+		if request, err = json.Marshal(invalid); err != nil {
+			t.Fatal(err)
+		}
+		resp, body = do(t, http.MethodPost, path, http.Header{"Content-Type": {"application/json"}}, request)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
+
+func TestGetRepository(t *testing.T) {
+	name := repository(t, "nested")
+	layers := [][]byte{randomBlob(t, 512), randomBlob(t, 256)}
+	img := newImage(t, layers...)
+	pushImage(t, name, img, "v1", "latest")
+	other := newImage(t, layers[0])
+	pushImage(t, name, other, "v2")
+
+	resp, body := do(t, http.MethodGet, fmt.Sprintf("/v2/%s/repository", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	var repo types.Repository
+	if err := json.Unmarshal(body, &repo); err != nil {
+		t.Fatal(err)
+	}
+
+	if repo.Namespace != name {
+		t.Errorf("got namespace %s, want %s", repo.Namespace, name)
+	}
+	if len(repo.Tags) != 3 {
+		t.Errorf("got %d tags, want 3", len(repo.Tags))
+	}
+	if len(repo.Manifests) != 2 {
+		t.Fatalf("got %d manifests, want 2", len(repo.Manifests))
+	}
+
+	manifests := make(map[string]*types.ManifestDescriptor)
+	for _, m := range repo.Manifests {
+		manifests[m.Digest] = m
+	}
+	for _, want := range []struct {
+		img  *image
+		tags []string
+	}{{img: img, tags: []string{"latest", "v1"}}, {img: other, tags: []string{"v2"}}} {
+		m, ok := manifests[want.img.digest]
+		if !ok {
+			t.Errorf("manifest %s is missing", want.img.digest)
+			continue
+		}
+		sort.Strings(m.Tags)
+		if !reflect.DeepEqual(m.Tags, want.tags) {
+			t.Errorf("%s: got tags %v, want %v", m.Digest, m.Tags, want.tags)
+		}
+		if m.MediaType != mediaTypeOCIManifest {
+			t.Errorf("%s: got media type %s, want %s", m.Digest, m.MediaType, mediaTypeOCIManifest)
+		}
+
+		// the media types of the blobs are the Content-Type of their upload, only the digests and sizes are checked
+		wantConfig := &types.Descriptor{Digest: digestOf(want.img.config), Size: int64(len(want.img.config))}
+		if !reflect.DeepEqual(m.Config, wantConfig) {
+			t.Errorf("%s: got config %+v, want %+v", m.Digest, m.Config, wantConfig)
+		}
+
+		size := wantConfig.Size
+		if len(m.Layers) != len(want.img.layers) {
+			t.Errorf("%s: got %d layers, want %d", m.Digest, len(m.Layers), len(want.img.layers))
+			continue
+		}
+		for i, layer := range want.img.layers {
+			if m.Layers[i].Digest != digestOf(layer) || m.Layers[i].Size != int64(len(layer)) {
+				t.Errorf("%s: got layer %+v, want %s of %d bytes", m.Digest, m.Layers[i], digestOf(layer), len(layer))
+			}
+			size += int64(len(layer))
+		}
+		if m.Size != size {
+			t.Errorf("%s: got size %d, want %d", m.Digest, m.Size, size)
+		}
+	}
+
+	resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/repository", repository(t, "absent")), nil, nil)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
+
+func TestPushPullArtifact(t *testing.T) {
+	const sbom = "application/vnd.example.sbom.v1+json"
+
+	name := repository(t, "artifact")
+	config, layer := []byte("{}"), []byte(`{"packages":[]}`)
+	pushBlob(t, name, config)
+	pushBlob(t, name, layer)
+	content, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIManifest,
+		"artifactType":  sbom,
+		"config":        descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: digestOf(config), Size: 2},
+		"layers":        []descriptor{{MediaType: sbom, Digest: digestOf(layer), Size: len(layer)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putManifest(t, name, "sbom", content)
+
+	resp, body := getManifest(t, name, "sbom")
+	expectStatus(t, resp, body, http.StatusOK)
+	if !bytes.Equal(body, content) {
+		t.Errorf("got manifest %s, want %s", body, content)
+	}
+
+	resp, body = do(t, http.MethodGet, fmt.Sprintf("/v2/%s/repository", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	var repo types.Repository
+	if err = json.Unmarshal(body, &repo); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Manifests) != 1 || repo.Manifests[0].ArtifactType != sbom {
+		t.Errorf("got manifests %+v, want the artifact with the artifactType %s", repo.Manifests, sbom)
+	}
+}
+
+func TestPushTimes(t *testing.T) {
+	name := repository(t, "times")
+	pushImage(t, name, newImage(t, randomBlob(t, 128)), "tag")
+	// Last-Modified has a precision of a second
+	time.Sleep(time.Millisecond * 1100)
+	pushImage(t, name, newImage(t, randomBlob(t, 128)), "tag")
+
+	resp, body := do(t, http.MethodGet, fmt.Sprintf("/v2/%s/tags/detail", name), nil, nil)
+	expectStatus(t, resp, body, http.StatusOK)
+	var detail struct {
+		Tags []*types.ConfigV2 `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &detail); err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Tags) != 1 {
+		t.Fatalf("got tags %+v, want one", detail.Tags)
+	}
+	tag := detail.Tags[0]
+	if tag.CreatedAt.IsZero() || !tag.UpdatedAt.After(tag.CreatedAt.Add(time.Second)) {
+		t.Errorf("got created_at %s and updated_at %s, want the tag created by the first push and updated by the second",
+			tag.CreatedAt, tag.UpdatedAt)
+	}
+
+	resp, body = getManifest(t, name, "tag")
+	expectStatus(t, resp, body, http.StatusOK)
+	if got, want := resp.Header.Get("Last-Modified"), tag.UpdatedAt.UTC().Format(http.TimeFormat); got != want {
+		t.Errorf("got Last-Modified %q, want %q", got, want)
+	}
+}
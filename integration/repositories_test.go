@@ -0,0 +1,167 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type repositoryPage struct {
+	Repositories []*types.PublicRepository `json:"repositories"`
+	Total        int64                     `json:"total"`
+}
+
+// browseAll pages through the list at path with pages of n repositories, path already has a query
+func browseAll(t *testing.T, token, path string, n int) []*types.PublicRepository {
+	t.Helper()
+
+	var all []*types.PublicRepository
+	var total int64 = -1
+	for offset := 0; total < 0 || int64(offset) < total; offset += n {
+		resp, body := doWithToken(t, token, http.MethodGet, fmt.Sprintf("%s&n=%d&last=%d", path, n, offset), nil, nil)
+		expectStatus(t, resp, body, http.StatusOK)
+
+		var page repositoryPage
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		if total >= 0 && page.Total != total {
+			t.Fatalf("got total %d at offset %d, want the total of the first page %d", page.Total, offset, total)
+		}
+		total = page.Total
+		if len(page.Repositories) > n {
+			t.Fatalf("got %d repositories on a page of %d", len(page.Repositories), n)
+		}
+		all = append(all, page.Repositories...)
+	}
+
+	if int64(len(all)) != total {
+		t.Fatalf("got %d repositories over the pages, want the total %d", len(all), total)
+	}
+	return all
+}
+
+// namespacesOf keeps the repositories of the owner, in the order they were listed
+func namespacesOf(repositories []*types.PublicRepository, owner string) []string {
+	namespaces := []string{}
+	for _, repository := range repositories {
+		if len(repository.Namespace) > len(owner) && repository.Namespace[:len(owner)+1] == owner+"/" {
+			namespaces = append(namespaces, repository.Namespace)
+		}
+	}
+	return namespaces
+}
+
+func TestPublicRepositoriesSortingAndPagination(t *testing.T) {
+	ctx := context.Background()
+	owner, err := newTestUser(ctx, testServer.store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pulls := map[string]int64{"a": 20, "b": 30, "c": 10, "private": 40}
+	for _, name := range []string{"a", "b", "c", "private"} {
+		namespace := owner.Username + "/" + name
+		addRepository(t, namespace)
+		err = testServer.store.AddRepositoryStats(ctx, []*types.RepositoryStats{
+			{Namespace: namespace, PullCount: pulls[name]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = testServer.store.SetRepositoryVisibility(ctx, owner.Username+"/private", types.RepositoryVisibilityPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := func(names ...string) []string {
+		for i := range names {
+			names[i] = owner.Username + "/" + names[i]
+		}
+		return names
+	}
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: "recent", want: name("c", "b", "a")},
+		{sort: "", want: name("c", "b", "a")},
+		{sort: "popular", want: name("b", "a", "c")},
+	}
+
+	for _, tt := range tests {
+		repositories := browseAll(t, "", "/api/v1/repositories?sort="+tt.sort, 3)
+		if got := namespacesOf(repositories, owner.Username); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort %q: got %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"sort=stars", "n=0", "n=-1", "last=-1"} {
+		resp, body := doWithToken(t, "", http.MethodGet, "/api/v1/repositories?"+query, nil, nil)
+		expectStatus(t, resp, body, http.StatusBadRequest)
+	}
+}
+
+func TestUserRepositoriesHidePrivateOnes(t *testing.T) {
+	ctx := context.Background()
+	owner, err := newTestUser(ctx, testServer.store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerToken, err := auth.NewAccessToken(testServer.cfg, owner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "private"} {
+		addRepository(t, owner.Username+"/"+name)
+	}
+	err = testServer.store.SetRepositoryVisibility(ctx, owner.Username+"/private", types.RepositoryVisibilityPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/api/v1/users/%s/repositories?", owner.Username)
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{name: "anonymous", want: []string{"a", "b"}},
+		{name: "another user", token: testServer.token, want: []string{"a", "b"}},
+		{name: "owner", token: ownerToken, want: []string{"a", "b", "private"}},
+	}
+
+	for _, tt := range tests {
+		visibility := map[string]types.RepositoryVisibility{}
+		for _, repository := range browseAll(t, tt.token, path, 1) {
+			visibility[strings.TrimPrefix(repository.Namespace, owner.Username+"/")] = repository.Visibility
+		}
+		got := make([]string, 0, len(visibility))
+		for name := range visibility {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got repositories %v, want %v", tt.name, got, tt.want)
+		}
+		if v, ok := visibility["private"]; ok && v != types.RepositoryVisibilityPrivate {
+			t.Errorf("%s: got visibility %q for the private repository", tt.name, v)
+		}
+	}
+
+	resp, body := doWithToken(t, "", http.MethodGet, "/api/v1/users/"+owner.Username+"missing/repositories", nil, nil)
+	expectStatus(t, resp, body, http.StatusNotFound)
+}
@@ -0,0 +1,123 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/google/uuid"
+)
+
+// addRepository stores a tagged manifest for the namespace, as a push does
+func addRepository(t *testing.T, namespace string) {
+	ctx := context.Background()
+	txn, err := testServer.store.NewTxn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	digest := digestOf([]byte(namespace))
+	err = testServer.store.SetManifest(ctx, txn, &types.ImageManifestV2{
+		Uuid:          uuid.NewString(),
+		Namespace:     namespace,
+		MediaType:     mediaTypeOCIManifest,
+		SchemaVersion: 2,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	for _, reference := range []string{"latest", digest} {
+		if err != nil {
+			break
+		}
+		err = testServer.store.SetConfig(ctx, txn, types.ConfigV2{
+			UUID:      uuid.NewString(),
+			Namespace: namespace,
+			Reference: reference,
+			Digest:    digest,
+			MediaType: mediaTypeOCIManifest,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	if err != nil {
+		_ = testServer.store.Abort(ctx, txn)
+		t.Fatal(err)
+	}
+	if err = testServer.store.Commit(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDeleteUserWithRepositories deletes a user whose name would match another one's if _ were a wildcard, e.g.
+// integration1234a_b and integration1234axb
+func TestDeleteUserWithRepositories(t *testing.T) {
+	ctx := context.Background()
+	deleted, err := newTestUser(ctx, testServer.store, "a_b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := &types.User{
+		Username: strings.TrimSuffix(deleted.Username, "a_b") + "axb",
+		Email:    "axb-" + deleted.Email,
+		Password: "unused-password",
+		IsActive: true,
+	}
+	if err = testServer.store.AddUser(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+	addRepository(t, deleted.Username+"/alpine")
+	addRepository(t, kept.Username+"/alpine")
+
+	txn, err := testServer.store.NewTxn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testServer.store.DeleteUserWithRepositories(ctx, txn, deleted); err != nil {
+		_ = testServer.store.Abort(ctx, txn)
+		t.Fatal(err)
+	}
+	if err = testServer.store.Commit(ctx, txn); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testServer.store.GetManifestByReference(ctx, deleted.Username+"/alpine", "latest")
+	if !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("got %v for the deleted user's repository, want %v", err, postgres.ErrNotFound)
+	}
+	if _, err = testServer.store.GetManifestByReference(ctx, kept.Username+"/alpine", "latest"); err != nil {
+		t.Errorf("the other user's repository was deleted: %s", err)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := testServer.store.GetUser(ctx, "integration-unknown-user", false); !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("got %v for an unknown user, want ErrNotFound", err)
+	}
+	if _, err := testServer.store.GetLayer(ctx, digestOf([]byte("unknown layer"))); !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("got %v for an unknown layer, want ErrNotFound", err)
+	}
+
+	duplicate := &types.User{
+		Username: testServer.user.Username,
+		Email:    testServer.user.Email,
+		Password: "unused-password",
+		IsActive: true,
+	}
+	err := testServer.store.AddUser(ctx, duplicate)
+	if !errors.Is(err, postgres.ErrConflict) {
+		t.Errorf("got %v adding a user with a taken name, want ErrConflict", err)
+	}
+	if errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("got %v matching ErrNotFound too", err)
+	}
+}
@@ -1,32 +1,157 @@
+// Package ratelimiter throttles the requests of every client, keyed by user for the authenticated requests and by
+// IP for the other ones, and by IP for the requests which fail the authentication
 package ratelimiter
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/registry/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
 )
 
-func New() echo.MiddlewareFunc {
-	storeConfig := middleware.RateLimiterMemoryStoreConfig{
-		Rate:      3,
-		Burst:     0,
-		ExpiresIn: time.Hour * 10,
-	}
-
-	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
-		Skipper:    middleware.DefaultSkipper,
-		BeforeFunc: nil,
-		IdentifierExtractor: func(ctx echo.Context) (string, error) {
-			return ctx.RealIP(), nil
-		},
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(storeConfig),
-		ErrorHandler: func(ctx echo.Context, err error) error {
-			return ctx.JSON(http.StatusForbidden, echo.Map{"error": "Too many requests, try after some time!"})
-		},
-		DenyHandler: func(ctx echo.Context, identifier string, err error) error {
-			return ctx.JSON(http.StatusForbidden, echo.Map{"error": "Too many requests, try after some time!"})
-		},
+// UserIdentifier returns the id of the user who made the request, false for the anonymous requests
+type UserIdentifier func(ctx echo.Context) (string, bool)
+
+type bucket struct {
+	store      middleware.RateLimiterStore
+	retryAfter string
+}
+
+// New must run after the authentication middlewares, so that userID can tell who made the request
+func New(cfg *config.RateLimit, userID UserIdentifier) echo.MiddlewareFunc {
+	if cfg == nil {
+		cfg = &config.RateLimit{}
+	}
+
+	anonymous := newBucket(cfg.Anonymous)
+	authenticated := newBucket(cfg.Authenticated)
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			b, identifier := anonymous, "ip:"+ctx.RealIP()
+			if id, ok := userID(ctx); ok {
+				b, identifier = authenticated, "user:"+id
+			}
+			if b == nil {
+				return hf(ctx)
+			}
+
+			allowed, err := b.store.Allow(identifier)
+			if err != nil || allowed {
+				return hf(ctx)
+			}
+
+			return tooManyRequests(ctx, b)
+		}
+	}
+}
+
+// Unauthorized must run before the authentication middlewares. The requests they reject never reach New, so it
+// counts them against the anonymous bucket of the client's IP and rejects the IP once the bucket is empty, this
+// throttles the guessing of passwords and tokens
+func Unauthorized(cfg *config.RateLimit) echo.MiddlewareFunc {
+	if cfg == nil {
+		cfg = &config.RateLimit{}
+	}
+
+	b := newBucket(cfg.Anonymous)
+	if b == nil {
+		return func(hf echo.HandlerFunc) echo.HandlerFunc {
+			return hf
+		}
+	}
+	f := &failures{
+		bucket:  b,
+		blocked: make(map[string]time.Time),
+		penalty: time.Duration(math.Max(1, math.Ceil(1/cfg.Anonymous.Rate))) * time.Second,
+	}
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			identifier := "ip:" + ctx.RealIP()
+			if f.isBlocked(identifier, time.Now()) {
+				return tooManyRequests(ctx, b)
+			}
+
+			err := hf(ctx)
+			status := ctx.Response().Status
+			if httpErr, ok := err.(*echo.HTTPError); ok && !ctx.Response().Committed {
+				status = httpErr.Code
+			}
+			if status == http.StatusUnauthorized {
+				f.fail(identifier, time.Now())
+			}
+			return err
+		}
+	}
+}
+
+// failures holds the IPs which ran out of tokens with the requests that failed the authentication
+type failures struct {
+	*bucket
+	mu      sync.Mutex
+	blocked map[string]time.Time
+	penalty time.Duration
+}
+
+func (f *failures) isBlocked(identifier string, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	until, ok := f.blocked[identifier]
+	if ok && !now.Before(until) {
+		delete(f.blocked, identifier)
+		return false
+	}
+	return ok
+}
+
+func (f *failures) fail(identifier string, now time.Time) {
+	if allowed, err := f.store.Allow(identifier); err != nil || allowed {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, until := range f.blocked {
+		if !now.Before(until) {
+			delete(f.blocked, id)
+		}
+	}
+	f.blocked[identifier] = now.Add(f.penalty)
+}
+
+func tooManyRequests(ctx echo.Context, b *bucket) error {
+	ctx.Response().Header().Set(echo.HeaderRetryAfter, b.retryAfter)
+	return ctx.JSON(http.StatusTooManyRequests, registry.RegistryErrors{
+		Errors: []registry.RegistryError{{
+			Code:    registry.RegistryErrorCodeTooManyRequests,
+			Message: fmt.Sprintf("too many requests, retry in %s seconds", b.retryAfter),
+		}},
 	})
 }
+
+// newBucket returns nil when the requests aren't limited
+func newBucket(cfg config.RateLimitBucket) *bucket {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+
+	return &bucket{
+		store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(cfg.Rate),
+			Burst:     cfg.Burst,
+			ExpiresIn: cfg.ExpiresIn,
+		}),
+		// the time it takes for a token to be added to the bucket
+		retryAfter: strconv.Itoa(int(math.Max(1, math.Ceil(1/cfg.Rate)))),
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/labstack/echo/v4"
+)
+
+// newServer limits the requests like the /v2 router, the requests with an Authorization header of "valid" are
+// authenticated as the user in it, the other requests with one are rejected with 401
+func newServer(cfg *config.RateLimit) *echo.Echo {
+	e := echo.New()
+	authenticate := func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			switch ctx.Request().Header.Get(echo.HeaderAuthorization) {
+			case "":
+			case "valid":
+				ctx.Set("user", "johndoe")
+			default:
+				return ctx.NoContent(http.StatusUnauthorized)
+			}
+			return hf(ctx)
+		}
+	}
+	userID := func(ctx echo.Context) (string, bool) {
+		id, ok := ctx.Get("user").(string)
+		return id, ok
+	}
+
+	e.GET("/v2/", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}, Unauthorized(cfg), authenticate, New(cfg, userID))
+	return e
+}
+
+func request(e *echo.Echo, ip, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+	req.RemoteAddr = ip + ":1234"
+	if authorization != "" {
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAnonymousAndAuthenticatedLimits(t *testing.T) {
+	e := newServer(&config.RateLimit{
+		Anonymous:     config.RateLimitBucket{Rate: 0.001, Burst: 2},
+		Authenticated: config.RateLimitBucket{Rate: 0.001, Burst: 5},
+	})
+
+	for i := 0; i < 2; i++ {
+		if rec := request(e, "10.0.0.1", ""); rec.Code != http.StatusOK {
+			t.Fatalf("anonymous request %d: got status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+	rec := request(e, "10.0.0.1", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get(echo.HeaderRetryAfter) == "" {
+		t.Fatalf("got status %d and Retry-After %q over the anonymous limit, want %d with a Retry-After",
+			rec.Code, rec.Header().Get(echo.HeaderRetryAfter), http.StatusTooManyRequests)
+	}
+	if rec = request(e, "10.0.0.2", ""); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d for another IP, want %d", rec.Code, http.StatusOK)
+	}
+
+	// the authenticated user has a bucket of their own, which isn't drained by the anonymous requests of the IP
+	for i := 0; i < 5; i++ {
+		if rec = request(e, "10.0.0.1", "valid"); rec.Code != http.StatusOK {
+			t.Fatalf("authenticated request %d: got status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+	if rec = request(e, "10.0.0.1", "valid"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d over the authenticated limit, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestUnauthorizedRequestsAreCounted(t *testing.T) {
+	e := newServer(&config.RateLimit{
+		Anonymous:     config.RateLimitBucket{Rate: 0.001, Burst: 3},
+		Authenticated: config.RateLimitBucket{Rate: 0.001, Burst: 10},
+	})
+
+	for i := 0; i < 3; i++ {
+		if rec := request(e, "10.0.0.1", "wrong password"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got status %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	// the bucket is empty with the fourth failure, the IP is rejected from then on, even with valid credentials
+	if rec := request(e, "10.0.0.1", "wrong password"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	for _, authorization := range []string{"wrong password", "valid"} {
+		rec := request(e, "10.0.0.1", authorization)
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get(echo.HeaderRetryAfter) == "" {
+			t.Errorf("%s: got status %d and Retry-After %q, want %d with a Retry-After", authorization, rec.Code,
+				rec.Header().Get(echo.HeaderRetryAfter), http.StatusTooManyRequests)
+		}
+	}
+
+	if rec := request(e, "10.0.0.2", "valid"); rec.Code != http.StatusOK {
+		t.Errorf("got status %d for another IP, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestNoLimits(t *testing.T) {
+	e := newServer(nil)
+	for i := 0; i < 20; i++ {
+		if rec := request(e, "10.0.0.1", "wrong password"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got status %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package registry
+
+const (
+	// MediaTypeOCIEmpty is the config of the OCI artifacts which have no config, their artifactType says what they
+	// are instead
+	MediaTypeOCIEmpty = "application/vnd.oci.empty.v1+json"
+
+	// emptyConfigDigest and emptyConfigSize describe the content of the empty config: {}
+	emptyConfigDigest = "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	emptyConfigSize   = 2
+)
+
+// isEmptyConfig reports whether the config is the well known empty config, which clients don't always push since
+// its content is implied by its digest
+func isEmptyConfig(config Config) bool {
+	return config.MediaType == MediaTypeOCIEmpty && config.Digest == emptyConfigDigest && config.Size == emptyConfigSize
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+func TestArtifactPushPull(t *testing.T) {
+	const sbom = "application/vnd.example.sbom.v1+json"
+
+	store, storage := newPushStore(), memory.New()
+	r := newPushRegistry(t, store, storage)
+	content := artifactManifest(sbom, sbom)
+	if rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, content); rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d pushing the artifact, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if got := store.manifests["v1"].ArtifactType; got != sbom {
+		t.Errorf("got stored artifactType %q, want %q", got, sbom)
+	}
+
+	for _, ref := range []string{"v1", digest.FromBytes(content)} {
+		ctx, rec := manifestContext(http.MethodGet, ref)
+		if err := r.PullManifest(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d: %s", ref, rec.Code, http.StatusOK, rec.Body)
+		}
+		// the manifest is served as pushed, artifactType included
+		if !bytes.Equal(rec.Body.Bytes(), content) {
+			t.Errorf("%s: got manifest %s, want %s", ref, rec.Body, content)
+		}
+		var manifest ImageManifest
+		if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if manifest.ArtifactType != sbom {
+			t.Errorf("%s: got artifactType %q, want %q", ref, manifest.ArtifactType, sbom)
+		}
+	}
+
+	ctx, rec := manifestContext(http.MethodGet, "v1")
+	if err := r.GetImageConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var errs RegistryErrors
+	if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || len(errs.Errors) != 1 || errs.Errors[0].Code != RegistryErrorCodeUnsupported {
+		t.Errorf("got status %d and errors %+v for the config of the artifact, want UNSUPPORTED", rec.Code, errs.Errors)
+	}
+}
+
+func TestArtifactTypeInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{
+			name: "empty config without artifactType",
+			content: []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,`+
+				`"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[]}`,
+				mediaTypeOCIManifest, MediaTypeOCIEmpty, emptyConfigDigest, emptyConfigSize)),
+		},
+		{name: "artifactType isn't a media type", content: artifactManifest("sbom", "application/octet-stream")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPushStore()
+			r := newPushRegistry(t, store, memory.New())
+
+			rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, tt.content)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			var errs RegistryErrors
+			if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			if len(errs.Errors) != 1 || errs.Errors[0].Code != RegistryErrorCodeManifestInvalid {
+				t.Errorf("got errors %+v, want MANIFEST_INVALID", errs.Errors)
+			}
+			if len(store.manifests) != 0 {
+				t.Errorf("got %d manifests stored, want none", len(store.manifests))
+			}
+		})
+	}
+}
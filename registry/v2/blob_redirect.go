@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
+)
+
+// blobObject is a blob as it's stored in the DFS. digest is the one the client asked for, contentDigest is the
+// digest of the stored bytes, they differ for the compressed copies of the layers. decode is the encoding of a
+// compressed copy which is sent decoded, contentDigest and size are then the ones of the decoded layer
+type blobObject struct {
+	key           string
+	dfsLink       string
+	digest        string
+	contentDigest string
+	encoding      string
+	decode        string
+	size          int64
+}
+
+// serveBlob redirects the client to the DFS with Registry.RedirectBlobPulls, the client checks the digest then.
+// Otherwise, or when the DFS isn't publicly fetchable, the blob is streamed through the registry, or the part of it
+// the Range header asks for
+func (r *registry) serveBlob(ctx echo.Context, blob *blobObject) error {
+	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", blob.size))
+	ctx.Response().Header().Set("Docker-Content-Digest", blob.digest)
+
+	namespace := types.Namespace(ctx)
+	// the DFS would send the encoded bytes without their Content-Encoding, or undecoded
+	if r.config.Registry.RedirectBlobPulls && blob.encoding == "" && blob.decode == "" {
+		if url, ok := r.blobRedirectURL(ctx, blob); ok {
+			ctx.Response().Header().Set("status", "307")
+			r.stats.RecordLayerPull(namespace)
+			r.metrics.observeTransfer(ctx, namespace, transferKindBlob, transferDirectionPull, blob.size)
+			r.logger.Log(ctx, nil)
+			return ctx.Redirect(http.StatusTemporaryRedirect, url)
+		}
+	}
+
+	// the compressed copies are always sent whole, a range of the encoded bytes isn't a range of the layer
+	if blob.encoding == "" && blob.decode == "" {
+		ctx.Response().Header().Set("Accept-Ranges", "bytes")
+		offset, length, ok, err := parseByteRange(ctx.Request().Header.Get("Range"), blob.size)
+		if err != nil {
+			ctx.Response().Header().Del("Content-Length")
+			ctx.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", blob.size))
+			errMsg := r.errorResponse(RegistryErrorCodeRangeInvalid, err.Error(), echo.Map{
+				"digest": blob.digest,
+				"range":  ctx.Request().Header.Get("Range"),
+			})
+			echoErr := ctx.JSONBlob(http.StatusRequestedRangeNotSatisfiable, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+		if ok {
+			return r.serveBlobRange(ctx, blob, offset, length)
+		}
+	}
+
+	rc, err := r.dfs.Download(ctx.Request().Context(), blob.key)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), echo.Map{"digest": blob.digest})
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	defer rc.Close()
+
+	var content io.Reader = rc
+	if blob.decode != "" {
+		decoded, err := decodeLayer(blob.decode, rc)
+		if err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{"digest": blob.digest})
+			echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+		defer decoded.Close()
+		content = decoded
+	}
+
+	if blob.encoding != "" {
+		ctx.Response().Header().Set("Content-Encoding", blob.encoding)
+	}
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	digester := digest.NewDigester(digest.AlgorithmOf(blob.contentDigest))
+	n, err := io.Copy(ctx.Response(), io.TeeReader(content, digester))
+	if err == nil && n == blob.size && digester.Digest() != blob.contentDigest {
+		err = fmt.Errorf("ERR_BLOB_DIGEST_MISMATCH: %s: computed %s", blob.contentDigest, digester.Digest())
+	}
+	if err != nil {
+		// the status was sent, cutting the connection short is the only way to tell the client
+		r.logger.Log(ctx, fmt.Errorf("ERR_STREAM_BLOB: %w", err))
+		panic(http.ErrAbortHandler)
+	}
+
+	r.stats.RecordLayerPull(namespace)
+	r.metrics.observeTransfer(ctx, namespace, transferKindBlob, transferDirectionPull, n)
+	r.logger.Log(ctx, nil)
+	return nil
+}
+
+// serveBlobRange streams length bytes of the blob from offset, they're read from the DFS directly when it supports
+// ranged reads. Otherwise the blob is downloaded and the bytes before the range skipped. The digest of a partial blob
+// can't be checked, the client checks the digest of the blob once it has all of it
+func (r *registry) serveBlobRange(ctx echo.Context, blob *blobObject, offset, length int64) error {
+	rc, err := r.dfs.DownloadRange(ctx.Request().Context(), blob.key, offset, length)
+	if errors.Is(err, dfs.ErrRangeUnsupported) {
+		rc, err = r.dfs.Download(ctx.Request().Context(), blob.key)
+		if err == nil {
+			if _, err = io.CopyN(io.Discard, rc, offset); err != nil {
+				_ = rc.Close()
+			}
+		}
+	}
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), echo.Map{"digest": blob.digest})
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	defer rc.Close()
+
+	header := ctx.Response().Header()
+	header.Set("Content-Length", fmt.Sprintf("%d", length))
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, blob.size))
+	ctx.Response().WriteHeader(http.StatusPartialContent)
+
+	n, err := io.CopyN(ctx.Response(), rc, length)
+	if err != nil {
+		// the status was sent, cutting the connection short is the only way to tell the client
+		r.logger.Log(ctx, fmt.Errorf("ERR_STREAM_BLOB_RANGE: %w", err))
+		panic(http.ErrAbortHandler)
+	}
+
+	namespace := types.Namespace(ctx)
+	r.stats.RecordLayerPull(namespace)
+	r.metrics.observeTransfer(ctx, namespace, transferKindBlob, transferDirectionPull, n)
+	r.logger.Log(ctx, nil)
+	return nil
+}
+
+// blobRedirectURL is a pre-signed URL, or the DFS link resolver URL for the backends which can't sign. ok is false
+// when the blob can only be served by the registry
+func (r *registry) blobRedirectURL(ctx echo.Context, blob *blobObject) (string, bool) {
+	url, err := r.dfs.PresignedURL(ctx.Request().Context(), blob.key, r.downloadURLTTL())
+	if err == nil {
+		return url, true
+	}
+	if !errors.Is(err, dfs.ErrPresignUnsupported) {
+		color.Red("error signing the download URL of %s, streaming it instead: %s", blob.digest, err)
+		return "", false
+	}
+
+	if blob.dfsLink == "" || r.config.DFS.S3Any == nil || r.config.DFS.S3Any.DFSLinkResolver == "" {
+		return "", false
+	}
+	return r.getDownloadableURLFromDFSLink(blob.dfsLink), true
+}
@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/dfs/filebase"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestServeBlobRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	blob := &blobObject{
+		key:           "layers/range-test",
+		digest:        digest.FromBytes(content),
+		contentDigest: digest.FromBytes(content),
+		size:          int64(len(content)),
+	}
+
+	tests := []struct {
+		name             string
+		rangeHeader      string
+		rangeUnsupported bool
+		wantStatus       int
+		wantBody         []byte
+		wantContentRange string
+		wantCode         string
+		wantRangedReads  int
+		wantDownloads    int
+	}{
+		{
+			name:          "whole blob",
+			wantStatus:    http.StatusOK,
+			wantBody:      content,
+			wantDownloads: 1,
+		},
+		{
+			name:             "ranged read",
+			rangeHeader:      "bytes=5-9",
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         content[5:10],
+			wantContentRange: "bytes 5-9/20",
+			wantRangedReads:  1,
+		},
+		{
+			name:             "suffix range",
+			rangeHeader:      "bytes=-4",
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         content[16:],
+			wantContentRange: "bytes 16-19/20",
+			wantRangedReads:  1,
+		},
+		{
+			name:             "fallback to the whole object",
+			rangeHeader:      "bytes=5-9",
+			rangeUnsupported: true,
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         content[5:10],
+			wantContentRange: "bytes 5-9/20",
+			wantRangedReads:  1,
+			wantDownloads:    1,
+		},
+		{
+			name:             "fallback to the end of the object",
+			rangeHeader:      "bytes=15-",
+			rangeUnsupported: true,
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         content[15:],
+			wantContentRange: "bytes 15-19/20",
+			wantRangedReads:  1,
+			wantDownloads:    1,
+		},
+		{
+			name:             "range past the end",
+			rangeHeader:      "bytes=20-",
+			wantStatus:       http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: "bytes */20",
+			wantCode:         RegistryErrorCodeRangeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memory.New()
+			storage.RangeUnsupported = tt.rangeUnsupported
+			storage.Put(blob.key, content)
+			r := newTestRegistry(nil, storage)
+
+			ctx, rec := newTestContext(http.MethodGet, "/v2/johndoe/alpine/blobs/"+blob.digest, "johndoe/alpine")
+			if tt.rangeHeader != "" {
+				ctx.Request().Header.Set("Range", tt.rangeHeader)
+			}
+			if err := r.serveBlob(ctx, blob); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != nil && !bytes.Equal(rec.Body.Bytes(), tt.wantBody) {
+				t.Errorf("got body %q, want %q", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantContentRange {
+				t.Errorf("got Content-Range %q, want %q", got, tt.wantContentRange)
+			}
+			if tt.wantCode != "" {
+				var errs RegistryErrors
+				if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+					t.Fatal(err)
+				}
+				if len(errs.Errors) != 1 || errs.Errors[0].Code != tt.wantCode {
+					t.Errorf("got errors %+v, want %s", errs.Errors, tt.wantCode)
+				}
+			}
+			if got := storage.Calls("DownloadRange"); got != tt.wantRangedReads {
+				t.Errorf("got %d ranged reads, want %d", got, tt.wantRangedReads)
+			}
+			if got := storage.Calls("Download"); got != tt.wantDownloads {
+				t.Errorf("got %d downloads, want %d", got, tt.wantDownloads)
+			}
+		})
+	}
+}
+
+func TestServeBlobRedirect(t *testing.T) {
+	content := []byte("redirected layer")
+	blob := &blobObject{
+		key:           "layers/redirect-test",
+		dfsLink:       "redirect-test-link",
+		digest:        digest.FromBytes(content),
+		contentDigest: digest.FromBytes(content),
+		size:          int64(len(content)),
+	}
+	signer := filebase.New(&config.S3CompatibleDFS{
+		Endpoint:   "https://s3.test",
+		AccessKey:  "access-key",
+		SecretKey:  "secret-key",
+		BucketName: "layers",
+	})
+
+	tests := []struct {
+		name     string
+		redirect bool
+		signer   dfs.DFS
+		resolver string
+		encoding string
+		// wantLocation is a prefix of the Location header, the signed URLs differ every second
+		wantLocation string
+	}{
+		{
+			name:   "disabled",
+			signer: signer,
+		},
+		{
+			name:         "signed URL",
+			redirect:     true,
+			signer:       signer,
+			wantLocation: "https://",
+		},
+		{
+			name:         "DFS link resolver",
+			redirect:     true,
+			resolver:     "https://gateway.test",
+			wantLocation: "https://gateway.test/redirect-test-link",
+		},
+		{
+			// the memory DFS can't sign URLs and there's no resolver, the registry is the only way to the blob
+			name:     "not publicly fetchable",
+			redirect: true,
+		},
+		{
+			name:     "compressed copy",
+			redirect: true,
+			signer:   signer,
+			encoding: "zstd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memory.New()
+			storage.Put(blob.key, content)
+			r := newTestRegistry(nil, storage)
+			r.config.Registry.RedirectBlobPulls = tt.redirect
+			r.config.DFS = &config.DFS{S3Any: &config.S3CompatibleDFS{DFSLinkResolver: tt.resolver}}
+			if tt.signer != nil {
+				r.dfs = &signingDFS{DFS: storage, signer: tt.signer}
+			}
+
+			served := *blob
+			served.encoding = tt.encoding
+			ctx, rec := newTestContext(http.MethodGet, "/v2/johndoe/alpine/blobs/"+blob.digest, "johndoe/alpine")
+			if err := r.serveBlob(ctx, &served); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantLocation == "" {
+				if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), content) {
+					t.Fatalf("got status %d and body %q, want the blob streamed by the registry", rec.Code, rec.Body)
+				}
+				if got := storage.Calls("Download"); got != 1 {
+					t.Errorf("got %d downloads, want 1", got)
+				}
+				return
+			}
+
+			if rec.Code != http.StatusTemporaryRedirect {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusTemporaryRedirect)
+			}
+			location := rec.Header().Get(echo.HeaderLocation)
+			if !strings.HasPrefix(location, tt.wantLocation) {
+				t.Errorf("got Location %q, want %q", location, tt.wantLocation)
+			}
+			if tt.signer != nil {
+				signed, err := url.Parse(location)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasSuffix(signed.Path, "/"+blob.key) || signed.Query().Get("X-Amz-Signature") == "" {
+					t.Errorf("got Location %q, want the signed URL of %s", location, blob.key)
+				}
+			}
+			if got := rec.Header().Get("Docker-Content-Digest"); got != blob.digest {
+				t.Errorf("got Docker-Content-Digest %q, want %q", got, blob.digest)
+			}
+			if got := storage.Calls("Download"); got != 0 || rec.Body.Len() != 0 {
+				t.Errorf("got %d downloads and a body of %d bytes, want none", got, rec.Body.Len())
+			}
+		})
+	}
+}
@@ -2,16 +2,18 @@ package registry
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/fatih/color"
 	"github.com/labstack/echo/v4"
-	"github.com/opencontainers/go-digest"
 )
 
 func (b *blobs) errorResponse(code, msg string, detail map[string]interface{}) []byte {
@@ -47,7 +49,21 @@ func (b *blobs) HEAD(ctx echo.Context) error {
 		return ctx.NoContent(http.StatusNotFound)
 	}
 
-	metadata, err := b.registry.dfs.Metadata(GetLayerIdentifier(layerRef.UUID))
+	if setETag(ctx, layerRef.Digest) {
+		return b.registry.notModified(ctx, layerRef.Digest)
+	}
+
+	// a layer replaced by its compressed copy is sent decoded unless the client accepts the encoding, which the
+	// Content-Length of a HEAD can't tell. It's the size of the layer, like the Docker-Content-Digest
+	if b.registry.compressedLayer(ctx.Request().Context(), layerRef.Digest) != nil {
+		ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", layerRef.Size))
+		ctx.Response().Header().Set("Docker-Content-Digest", digest)
+		err = ctx.String(http.StatusOK, "OK")
+		b.registry.logger.Log(ctx, nil)
+		return err
+	}
+
+	metadata, err := b.registry.dfs.Metadata(ctx.Request().Context(), GetLayerIdentifier(layerRef.UUID))
 	if err != nil {
 		details := echo.Map{
 			"error":   err.Error(),
@@ -74,37 +90,16 @@ these will be part of the txn in StartUpload
 func (b *blobs) UploadBlob(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	contentRange := ctx.Request().Header.Get("Content-Range")
 	identifier := ctx.Param("uuid")
 	layerKey := GetLayerIdentifierFromTrakcingID(identifier)
 	uploadID := GetUploadIDFromTrakcingID(identifier)
+	ctx.Response().Header().Set("Docker-Upload-UUID", identifier)
 
 	if contentRange == "" {
-		buf := &bytes.Buffer{}
-		_, err := io.Copy(buf, ctx.Request().Body)
-		if err != nil {
-			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-				"error":   err.Error(),
-				"message": "error copying body to buffer",
-			})
-			b.registry.logger.Log(ctx, err)
-			return echoErr
-		}
+		parts, n, tail, err := b.uploadParts(ctx.Request().Context(), uploadID, layerKey, ctx.Request().Body, false)
 		_ = ctx.Request().Body.Close()
-
-		checksum := digest.FromBytes(buf.Bytes())
-
-		b.blobCounter[uploadID]++
-		part, err := b.registry.dfs.UploadPart(
-			ctx.Request().Context(),
-			uploadID,
-			GetLayerIdentifier(layerKey),
-			checksum.String(),
-			b.blobCounter[uploadID],
-			bytes.NewReader(buf.Bytes()),
-			int64(buf.Len()),
-		)
 		if err != nil {
 			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
 				"error":   err.Error(),
@@ -114,62 +109,57 @@ func (b *blobs) UploadBlob(ctx echo.Context) error {
 			return echoErr
 		}
 
-		b.mu.Lock()
-		b.layerParts[uploadID] = append(b.layerParts[uploadID], part)
-		b.mu.Unlock()
+		b.addParts(uploadID, parts, n, tail)
 
 		locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, identifier)
 		ctx.Response().Header().Set("Location", locationHeader)
-		b.layerLengthCounter[uploadID] = int64(buf.Len())
-		ctx.Response().Header().Set("Range", fmt.Sprintf("0-%d", b.layerLengthCounter[uploadID]-1))
+		ctx.Response().Header().Set("Range", uploadedRange(b.received(uploadID)))
+		b.registry.saveUploadSession(ctx.Request().Context(), namespace, identifier)
 		err = ctx.NoContent(http.StatusAccepted)
 		b.registry.logger.Log(ctx, nil)
 		return err
 	}
 
-	var start, end int64
-	// 0-90
-	if _, err := fmt.Sscanf(contentRange, "%d-%d", &start, &end); err != nil {
+	start, end, err := parseContentRange(contentRange)
+	if err != nil {
 		details := map[string]interface{}{
-			"error":        err.Error(),
 			"message":      "content range is invalid",
 			"contentRange": contentRange,
 		}
-		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadUnknown, err.Error(), details)
-		echoErr := ctx.JSONBlob(http.StatusRequestedRangeNotSatisfiable, errMsg)
+		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadInvalid, err.Error(), details)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		b.registry.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	if start != b.layerLengthCounter[uploadID] {
-		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadUnknown, "content range mismatch", nil)
+	if start > end {
+		details := map[string]interface{}{
+			"contentRange": contentRange,
+		}
+		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadInvalid, "content range start is after its end", details)
 		echoErr := ctx.JSONBlob(http.StatusRequestedRangeNotSatisfiable, errMsg)
 		b.registry.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	buf := &bytes.Buffer{}
-	_, err := io.Copy(buf, ctx.Request().Body)
-	if err != nil {
-		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-			"error":   err.Error(),
-			"message": "error copying body to buffer",
-		})
-		b.registry.logger.Log(ctx, err)
+	// chunks must be uploaded in order, each one starting right after the bytes received so far
+	received := b.received(uploadID)
+	if start != received {
+		details := map[string]interface{}{
+			"contentRange":  contentRange,
+			"expectedStart": received,
+		}
+		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadInvalid, "content range mismatch", details)
+		ctx.Response().Header().Set("Range", uploadedRange(received))
+		echoErr := ctx.JSONBlob(http.StatusRequestedRangeNotSatisfiable, errMsg)
+		b.registry.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	checksum := digest.FromBytes(buf.Bytes())
-	b.blobCounter[uploadID]++
-	part, err := b.registry.dfs.UploadPart(
-		ctx.Request().Context(),
-		uploadID,
-		GetLayerIdentifier(layerKey),
-		checksum.String(),
-		b.blobCounter[uploadID],
-		bytes.NewReader(buf.Bytes()),
-		int64(buf.Len()),
-	)
+	// read one byte past the range, so that a body longer than the range is caught too
+	expected := end - start + 1
+	body := io.LimitReader(ctx.Request().Body, expected+1)
+	parts, n, tail, err := b.uploadParts(ctx.Request().Context(), uploadID, layerKey, body, false)
 	defer ctx.Request().Body.Close()
 	if err != nil {
 		errMsg := b.errorResponse(
@@ -182,15 +172,145 @@ func (b *blobs) UploadBlob(ctx echo.Context) error {
 		return echoErr
 	}
 
-	b.mu.Lock()
-	b.layerParts[uploadID] = append(b.layerParts[uploadID], part)
-	b.layerLengthCounter[uploadID] += int64(buf.Len())
-	b.mu.Unlock()
+	// the parts are not added to the upload, a retry of this chunk overwrites them
+	if n != expected {
+		b.discardParts(uploadID)
+		details := map[string]interface{}{
+			"contentRange": contentRange,
+			"received":     n,
+		}
+		errMsg := b.errorResponse(RegistryErrorCodeBlobUploadInvalid, "chunk size does not match content range", details)
+		echoErr := ctx.JSONBlob(http.StatusRequestedRangeNotSatisfiable, errMsg)
+		b.registry.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	b.addParts(uploadID, parts, n, tail)
 
 	locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, identifier)
 	ctx.Response().Header().Set("Location", locationHeader)
-	ctx.Response().Header().Set("Range", fmt.Sprintf("0-%d", b.layerLengthCounter[uploadID]-1))
+	ctx.Response().Header().Set("Range", uploadedRange(b.received(uploadID)))
+	b.registry.saveUploadSession(ctx.Request().Context(), namespace, identifier)
 	echoErr := ctx.NoContent(http.StatusAccepted)
 	b.registry.logger.Log(ctx, nil)
 	return echoErr
 }
+
+// uploadParts streams body to the DFS as parts of the configured chunk size, so that only a single part is held in
+// memory no matter how large the chunk sent by the client is. Every part but the last must be at least 5MiB big on
+// S3, so the bytes past the last full part (the tail) aren't uploaded until the final chunk: they're returned, and
+// the next chunk is appended to them. The parts are numbered after the ones already added to the upload, they only
+// become part of the upload, along with the tail, once they are passed to addParts. n is the bytes read from body.
+// An empty body uploads no parts, so an empty chunk doesn't advance the upload and its Range stays as it was (0-0
+// for the first)
+func (b *blobs) uploadParts(
+	ctx context.Context,
+	uploadID string,
+	layerKey string,
+	body io.Reader,
+	final bool,
+) (parts []s3types.CompletedPart, n int64, tail []byte, err error) {
+	// staged uploads have no parts until they're complete
+	if b.registry.stager != nil {
+		n, err = b.registry.stager.write(uploadID, body)
+		return nil, n, nil, err
+	}
+
+	b.mu.RLock()
+	partNumber := b.blobCounter[uploadID]
+	pending := b.layerTails[uploadID]
+	b.mu.RUnlock()
+
+	// the chunk is hashed as it's read, the hash only moves forward once the chunk is accepted by addParts. The
+	// tail was hashed along with the chunk it came with
+	if running := b.registry.uploadDigestFor(uploadID); running != nil {
+		w, err := running.begin()
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		body = io.TeeReader(body, w)
+	}
+
+	content := io.MultiReader(bytes.NewReader(pending), body)
+	read := int64(0)
+	chunk := make([]byte, b.registry.chunkSize())
+	for {
+		size, readErr := io.ReadFull(content, chunk)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return nil, 0, nil, fmt.Errorf("ERR_READ_BLOB_CHUNK: %w", readErr)
+		}
+		read += int64(size)
+		if size == 0 {
+			return parts, read - int64(len(pending)), nil, nil
+		}
+		// a short read means the body is done, the rest waits for the next chunk unless this one is the last
+		if readErr != nil && !final {
+			return parts, read - int64(len(pending)), append([]byte(nil), chunk[:size]...), nil
+		}
+
+		partNumber++
+		part, uploadErr := b.registry.dfs.UploadPart(
+			ctx,
+			uploadID,
+			GetLayerIdentifier(layerKey),
+			digest.FromBytes(chunk[:size]),
+			partNumber,
+			bytes.NewReader(chunk[:size]),
+			int64(size),
+		)
+		if uploadErr != nil {
+			return nil, 0, nil, uploadErr
+		}
+		parts = append(parts, part)
+
+		if readErr != nil {
+			return parts, read - int64(len(pending)), nil, nil
+		}
+	}
+}
+
+// addParts accepts the chunk read by uploadParts, tail replaces the bytes of the upload not uploaded yet
+func (b *blobs) addParts(uploadID string, parts []s3types.CompletedPart, n int64, tail []byte) {
+	if b.registry.stager != nil {
+		b.registry.stager.commit(uploadID)
+	}
+	if running := b.registry.uploadDigestFor(uploadID); running != nil {
+		running.commit()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.layerParts[uploadID] = append(b.layerParts[uploadID], parts...)
+	b.blobCounter[uploadID] += int64(len(parts))
+	b.layerLengthCounter[uploadID] += n
+	if len(tail) > 0 {
+		b.layerTails[uploadID] = tail
+	} else {
+		delete(b.layerTails, uploadID)
+	}
+	if upload, ok := b.registry.uploads[uploadID]; ok {
+		upload.updatedAt = time.Now()
+		b.registry.uploads[uploadID] = upload
+	}
+}
+
+// discardParts drops the chunk written to a staged upload, or hashed into the running digest, by the last
+// uploadParts. The DFS parts need no cleanup since they're overwritten by the next chunk, which starts from the
+// same tail
+func (b *blobs) discardParts(uploadID string) {
+	if b.registry.stager != nil {
+		b.registry.stager.rollback(uploadID)
+	}
+	if running := b.registry.uploadDigestFor(uploadID); running != nil {
+		running.rollback()
+	}
+}
+
+// received returns the bytes received so far for the upload
+func (b *blobs) received(uploadID string) int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.layerLengthCounter[uploadID]
+}
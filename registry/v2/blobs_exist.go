@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBlobsExistDigests bounds the number of digests checked by a single BlobsExist request
+const maxBlobsExistDigests = 1000
+
+// BlobsExist checks a list of digests at once, so that clients can skip uploading the layers the
+// registry already has instead of making a HEAD request for each one
+// POST /v2/<name>/blobs/exists
+// ["sha256:...", "sha256:..."]
+func (r *registry) BlobsExist(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	var digests []string
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&digests); err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, "body must be a JSON array of digests", echo.Map{
+			"error": err.Error(),
+		})
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	_ = ctx.Request().Body.Close()
+
+	if len(digests) > maxBlobsExistDigests {
+		errMsg := r.errorResponse(
+			RegistryErrorCodeDigestInvalid,
+			fmt.Sprintf("at most %d digests can be checked at once", maxBlobsExistDigests),
+			echo.Map{"count": len(digests)},
+		)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	for _, dig := range digests {
+		if err := digest.Validate(dig); err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), echo.Map{
+				"digest": dig,
+			})
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+	}
+
+	existing, err := r.store.GetExistingLayers(ctx.Request().Context(), digests)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	found := make(map[string]bool, len(existing))
+	for _, dig := range existing {
+		found[dig] = true
+	}
+
+	missing := []string{}
+	for _, dig := range digests {
+		if !found[dig] {
+			missing = append(missing, dig)
+		}
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"exists":  existing,
+		"missing": missing,
+	})
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+// TestChunkedUploadBuffersTails sends chunks which aren't aligned on the part size, the DFS rejects an upload with
+// a part smaller than the part size but for the last
+func TestChunkedUploadBuffersTails(t *testing.T) {
+	const chunkSize = 8
+	tests := []struct {
+		name   string
+		chunks []int
+		final  int
+	}{
+		{name: "short chunks", chunks: []int{3, 2, 4, 1}, final: 0},
+		{name: "long chunks", chunks: []int{13, 19, 5}, final: 6},
+		{name: "aligned then not", chunks: []int{8, 16, 9}, final: 7},
+		{name: "final chunk only", final: 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memory.New()
+			store := newUploadStore()
+			r := newTestRegistry(store, storage)
+			withChunkSize(r, storage, chunkSize)
+
+			size := tt.final
+			for _, n := range tt.chunks {
+				size += n
+			}
+			layer := bytes.Repeat([]byte("0123456789abcdefghij"), size/20+1)[:size]
+
+			uuid := startUpload(t, r, testNamespace, "")
+			offset := 0
+			for _, n := range tt.chunks {
+				patchChunk(t, r, uuid, offset, layer[offset:offset+n])
+				offset += n
+			}
+			dig := digest.FromBytes(layer)
+			if code := completeUpload(t, r, uuid, dig, layer[offset:]); code != http.StatusCreated {
+				t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+			}
+
+			stored, ok := store.layers[dig]
+			if !ok {
+				t.Fatal("the layer wasn't stored")
+			}
+			if stored.Size != size {
+				t.Errorf("got size %d for the layer, want %d", stored.Size, size)
+			}
+			rc, err := storage.Download(context.Background(), GetLayerIdentifier(stored.UUID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if computed, err := digest.FromReader(digest.Canonical, rc); err != nil || computed != dig {
+				t.Errorf("got digest %s and error %v for the stored layer, want %s", computed, err, dig)
+			}
+			if want := (size + chunkSize - 1) / chunkSize; storage.Calls("UploadPart") != want {
+				t.Errorf("got %d parts uploaded, want %d", storage.Calls("UploadPart"), want)
+			}
+		})
+	}
+}
+
+// TestEmptyChunk sends an empty PATCH as the first chunk of an upload and after one, it doesn't advance the upload
+func TestEmptyChunk(t *testing.T) {
+	r := newTestRegistry(newUploadStore(), memory.New())
+	uuid := startUpload(t, r, testNamespace, "")
+
+	patchEmpty := func(contentRange string) (int, string) {
+		ctx, rec := uploadContext(http.MethodPatch, testNamespace, uuid, nil)
+		if contentRange != "" {
+			ctx.Request().Header.Set("Content-Range", contentRange)
+		}
+		if err := r.b.UploadBlob(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, rec.Header().Get("Range")
+	}
+
+	if code, received := patchEmpty(""); code != http.StatusAccepted || received != "0-0" {
+		t.Fatalf("got status %d and Range %s for the first chunk, want %d and 0-0", code, received, http.StatusAccepted)
+	}
+
+	chunk := []byte("the first chunk")
+	patchChunk(t, r, uuid, 0, chunk)
+	want := uploadedRange(int64(len(chunk)))
+	if code, received := patchEmpty(""); code != http.StatusAccepted || received != want {
+		t.Fatalf("got status %d and Range %s after a chunk, want %d and %s", code, received, http.StatusAccepted, want)
+	}
+
+	// an empty body doesn't match any content range, the upload stays where it was
+	contentRange := fmt.Sprintf("%d-%d", len(chunk), len(chunk))
+	if code, _ := patchEmpty(contentRange); code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("got status %d for an empty chunk with a content range, want %d", code,
+			http.StatusRequestedRangeNotSatisfiable)
+	}
+	if code, received := uploadProgress(t, r, uuid); code != http.StatusNoContent || received != want {
+		t.Errorf("got status %d and Range %s, want %d and %s", code, received, http.StatusNoContent, want)
+	}
+
+	dig := digest.FromBytes(chunk)
+	if code := completeUpload(t, r, uuid, dig, nil); code != http.StatusCreated {
+		t.Errorf("got status %d completing the upload, want %d", code, http.StatusCreated)
+	}
+}
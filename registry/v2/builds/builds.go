@@ -0,0 +1,241 @@
+// Package builds tracks the builds of a repository, from queued to success or failed
+package builds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/telemetry"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultListLimit = 25
+	maxListLimit     = 100
+)
+
+type Tracker interface {
+	// ListBuilds - GET /v2/<name>/builds?status=<status>&n=<limit>
+	ListBuilds(ctx echo.Context) error
+	// GetBuild - GET /v2/<name>/builds/<id>
+	GetBuild(ctx echo.Context) error
+	// CreateBuild - POST /v2/<name>/builds, the build is queued
+	CreateBuild(ctx echo.Context) error
+	// UpdateBuild - PATCH /v2/<name>/builds/<id>, reports the progress of a build
+	UpdateBuild(ctx echo.Context) error
+}
+
+type tracker struct {
+	store  postgres.BuildStore
+	logger telemetry.Logger
+}
+
+func New(store postgres.BuildStore, logger telemetry.Logger) Tracker {
+	return &tracker{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (t *tracker) ListBuilds(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	limit, err := limitParam(ctx)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	status := types.BuildStatus(ctx.QueryParam("status"))
+	if status != "" && !status.IsValid() {
+		err = fmt.Errorf("invalid build status: %s", status)
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	builds, err := t.store.GetBuilds(ctx.Request().Context(), types.Namespace(ctx), status, limit)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"builds": builds,
+	})
+	t.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (t *tracker) GetBuild(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	build, err := t.store.GetBuild(ctx.Request().Context(), types.Namespace(ctx), ctx.Param("id"))
+	if err != nil {
+		echoErr := ctx.JSON(errorStatus(err), echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, build)
+	t.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (t *tracker) CreateBuild(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	var build types.Build
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&build); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid build",
+		})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+	_ = ctx.Request().Body.Close()
+
+	if err := build.Validate(); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid build",
+		})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	build.ID = id.String()
+	build.Namespace = types.Namespace(ctx)
+	build.Status = types.BuildStatusQueued
+	build.CreatedAt = time.Now()
+	build.UpdatedAt = build.CreatedAt
+	build.StartedAt = nil
+	build.FinishedAt = nil
+	if err = t.store.CreateBuild(ctx.Request().Context(), &build); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusCreated, build)
+	t.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (t *tracker) UpdateBuild(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	var update types.BuildUpdate
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&update); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid build update",
+		})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+	_ = ctx.Request().Body.Close()
+
+	if err := update.Validate(); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid build update",
+		})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	build, err := t.store.GetBuild(ctx.Request().Context(), types.Namespace(ctx), ctx.Param("id"))
+	if err != nil {
+		echoErr := ctx.JSON(errorStatus(err), echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	previous := build.Status
+	if err = transition(build, &update, time.Now()); err != nil {
+		echoErr := ctx.JSON(http.StatusConflict, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid build status transition",
+		})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	if err = t.store.UpdateBuildStatus(ctx.Request().Context(), build, previous); err != nil {
+		echoErr := ctx.JSON(errorStatus(err), echo.Map{"error": err.Error()})
+		t.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, build)
+	t.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// transition moves the build to the status of the update, stamping when it started or finished
+func transition(build *types.Build, update *types.BuildUpdate, now time.Time) error {
+	if !build.Status.CanTransitionTo(update.Status) {
+		return fmt.Errorf("ERR_BUILD_STATUS_TRANSITION: build can't go from %s to %s", build.Status, update.Status)
+	}
+
+	build.Status = update.Status
+	build.UpdatedAt = now
+	if update.LogsURL != "" {
+		build.LogsURL = update.LogsURL
+	}
+
+	switch {
+	case update.Status == types.BuildStatusRunning:
+		build.StartedAt = &now
+	case update.Status.IsFinished():
+		build.FinishedAt = &now
+	}
+
+	return nil
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, postgres.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func limitParam(ctx echo.Context) (int, error) {
+	param := ctx.QueryParam("n")
+	if param == "" {
+		return defaultListLimit, nil
+	}
+
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit: %s", param)
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	return limit, nil
+}
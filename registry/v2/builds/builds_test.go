@@ -0,0 +1,253 @@
+package builds
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	nopLogger struct{}
+
+	// buildStore keeps the builds in memory, like the builds table does
+	buildStore struct {
+		mu     sync.Mutex
+		builds map[string]types.Build
+	}
+)
+
+func (nopLogger) Log(echo.Context, error) {}
+
+func (s *buildStore) CreateBuild(_ context.Context, build *types.Build) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.builds[build.ID] = *build
+	return nil
+}
+
+func (s *buildStore) GetBuild(_ context.Context, namespace, id string) (*types.Build, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	build, ok := s.builds[id]
+	if !ok || build.Namespace != namespace {
+		return nil, postgres.ErrNotFound
+	}
+	return &build, nil
+}
+
+func (s *buildStore) GetBuilds(
+	_ context.Context, namespace string, status types.BuildStatus, limit int,
+) ([]*types.Build, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	builds := []*types.Build{}
+	for _, build := range s.builds {
+		build := build
+		if build.Namespace == namespace && (status == "" || build.Status == status) {
+			builds = append(builds, &build)
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].CreatedAt.After(builds[j].CreatedAt) })
+	if len(builds) > limit {
+		builds = builds[:limit]
+	}
+	return builds, nil
+}
+
+func (s *buildStore) UpdateBuildStatus(_ context.Context, build *types.Build, previous types.BuildStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.builds[build.ID]
+	if !ok {
+		return postgres.ErrNotFound
+	}
+	if stored.Status != previous {
+		return postgres.ErrConflict
+	}
+	s.builds[build.ID] = *build
+	return nil
+}
+
+func newBuildServer() (*echo.Echo, *buildStore) {
+	store := &buildStore{builds: map[string]types.Build{}}
+	t := New(store, nopLogger{})
+
+	e := echo.New()
+	e.GET("/v2/:username/:imagename/builds", t.ListBuilds)
+	e.POST("/v2/:username/:imagename/builds", t.CreateBuild)
+	e.GET("/v2/:username/:imagename/builds/:id", t.GetBuild)
+	e.PATCH("/v2/:username/:imagename/builds/:id", t.UpdateBuild)
+	return e, store
+}
+
+func request(t *testing.T, e *echo.Echo, method, target, body string, v interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if v != nil && rec.Code < http.StatusBadRequest {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func createBuild(t *testing.T, e *echo.Echo, namespace, commit string) *types.Build {
+	t.Helper()
+
+	var build types.Build
+	code := request(t, e, http.MethodPost, "/v2/"+namespace+"/builds", `{"commit":"`+commit+`"}`, &build)
+	if code != http.StatusCreated {
+		t.Fatalf("got status %d creating the build, want %d", code, http.StatusCreated)
+	}
+	return &build
+}
+
+func TestBuildStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []types.BuildStatus
+		// wantCodes are the statuses of the updates, in order
+		wantCodes []int
+	}{
+		{
+			name:      "success",
+			statuses:  []types.BuildStatus{types.BuildStatusRunning, types.BuildStatusSuccess},
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "failed",
+			statuses:  []types.BuildStatus{types.BuildStatusRunning, types.BuildStatusFailed},
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "queued to success",
+			statuses:  []types.BuildStatus{types.BuildStatusSuccess},
+			wantCodes: []int{http.StatusConflict},
+		},
+		{
+			name:      "back to running",
+			statuses:  []types.BuildStatus{types.BuildStatusRunning, types.BuildStatusFailed, types.BuildStatusRunning},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusConflict},
+		},
+		{
+			name:      "back to queued",
+			statuses:  []types.BuildStatus{types.BuildStatusRunning, types.BuildStatusQueued},
+			wantCodes: []int{http.StatusOK, http.StatusConflict},
+		},
+		{
+			name:      "unknown status",
+			statuses:  []types.BuildStatus{"paused"},
+			wantCodes: []int{http.StatusConflict},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, store := newBuildServer()
+			build := createBuild(t, e, "johndoe/alpine", "abc123")
+			if build.Status != types.BuildStatusQueued || build.StartedAt != nil || build.FinishedAt != nil {
+				t.Fatalf("got %+v, want a queued build", build)
+			}
+
+			for i, status := range tt.statuses {
+				var updated types.Build
+				body := `{"status":"` + string(status) + `","logs_url":"https://ci.test/builds/1"}`
+				code := request(t, e, http.MethodPatch, "/v2/johndoe/alpine/builds/"+build.ID, body, &updated)
+				if code != tt.wantCodes[i] {
+					t.Fatalf("update %d to %s: got status %d, want %d", i, status, code, tt.wantCodes[i])
+				}
+				if code != http.StatusOK {
+					continue
+				}
+
+				if updated.Status != status || updated.LogsURL != "https://ci.test/builds/1" {
+					t.Errorf("update %d: got %+v, want the build %s with the logs link", i, updated, status)
+				}
+				if status == types.BuildStatusRunning && updated.StartedAt == nil {
+					t.Errorf("update %d: got no started_at for the running build", i)
+				}
+				if status.IsFinished() && (updated.FinishedAt == nil || updated.StartedAt == nil) {
+					t.Errorf("update %d: got started_at %v and finished_at %v, want both", i,
+						updated.StartedAt, updated.FinishedAt)
+				}
+			}
+
+			// the rejected updates didn't change the stored build
+			var got types.Build
+			if code := request(t, e, http.MethodGet, "/v2/johndoe/alpine/builds/"+build.ID, "", &got); code != http.StatusOK {
+				t.Fatalf("got status %d getting the build, want %d", code, http.StatusOK)
+			}
+			if stored := store.builds[build.ID]; got.Status != stored.Status {
+				t.Errorf("got status %s, want the stored %s", got.Status, stored.Status)
+			}
+		})
+	}
+}
+
+func TestListBuilds(t *testing.T) {
+	e, _ := newBuildServer()
+	first := createBuild(t, e, "johndoe/alpine", "commit-1")
+	second := createBuild(t, e, "johndoe/alpine", "commit-2")
+	third := createBuild(t, e, "johndoe/alpine", "commit-3")
+	createBuild(t, e, "johndoe/busybox", "commit-4")
+	body := `{"status":"running"}`
+	if code := request(t, e, http.MethodPatch, "/v2/johndoe/alpine/builds/"+second.ID, body, nil); code != http.StatusOK {
+		t.Fatalf("got status %d starting the build, want %d", code, http.StatusOK)
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     []string
+	}{
+		{query: "", wantCode: http.StatusOK, want: []string{third.ID, second.ID, first.ID}},
+		{query: "?n=2", wantCode: http.StatusOK, want: []string{third.ID, second.ID}},
+		{query: "?status=running", wantCode: http.StatusOK, want: []string{second.ID}},
+		{query: "?status=queued&n=1", wantCode: http.StatusOK, want: []string{third.ID}},
+		{query: "?status=success", wantCode: http.StatusOK, want: []string{}},
+		{query: "?status=paused", wantCode: http.StatusBadRequest},
+		{query: "?n=0", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		var list struct {
+			Builds []*types.Build `json:"builds"`
+		}
+		code := request(t, e, http.MethodGet, "/v2/johndoe/alpine/builds"+tt.query, "", &list)
+		if code != tt.wantCode {
+			t.Errorf("%q: got status %d, want %d", tt.query, code, tt.wantCode)
+			continue
+		}
+
+		got := []string{}
+		for _, build := range list.Builds {
+			got = append(got, build.ID)
+		}
+		if tt.want != nil && strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got builds %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// a build is only found in its repository
+	code := request(t, e, http.MethodGet, "/v2/johndoe/busybox/builds/"+first.ID, "", nil)
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d getting the build from another repository, want %d", code, http.StatusNotFound)
+	}
+}
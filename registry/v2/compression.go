@@ -0,0 +1,302 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+)
+
+// Layer media types for plain tar archives, these are the ones worth compressing
+const (
+	MediaTypeOCILayerTar    = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeDockerLayerTar = "application/vnd.docker.image.rootfs.diff.tar"
+)
+
+const (
+	// sniffLength is enough to see the tar header magic at offset 257
+	sniffLength = 512
+	// compressionQueueLength is the number of layers waiting to be compressed, see queueCompression
+	compressionQueueLength = 64
+)
+
+// LayerCompressor compresses the layers that are pushed uncompressed, the compressed copy replaces the layer
+type LayerCompressor interface {
+	Compress(dst io.Writer, src io.Reader) error
+	// Encoding is the Content-Encoding the compressed layer is served with
+	Encoding() string
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+func NewGzipCompressor(level int) LayerCompressor {
+	return &gzipCompressor{level: level}
+}
+
+func (g *gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	zw, err := gzip.NewWriterLevel(dst, g.level)
+	if err != nil {
+		return fmt.Errorf("ERR_GZIP_WRITER: %w", err)
+	}
+
+	if _, err = io.Copy(zw, src); err != nil {
+		return fmt.Errorf("ERR_GZIP_COMPRESS: %w", err)
+	}
+
+	return zw.Close()
+}
+
+func (g *gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+// needsCompression checks the media type first. Clients usually upload blobs as application/octet-stream,
+// in which case the content has to look like a tar archive. Gzip and zstd streams are never compressed again
+func needsCompression(mediaType string, head []byte) bool {
+	if bytes.HasPrefix(head, []byte{0x1f, 0x8b}) || bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return false
+	}
+
+	switch strings.TrimSpace(strings.Split(mediaType, ";")[0]) {
+	case MediaTypeOCILayerTar, MediaTypeDockerLayerTar:
+		return true
+	case "", "application/octet-stream":
+		return len(head) >= 262 && string(head[257:262]) == "ustar"
+	default:
+		return false
+	}
+}
+
+// decodeLayer reads a compressed copy back as the layer it was made from
+func decodeLayer(encoding string, src io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_GZIP_READER: %w", err)
+		}
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("ERR_UNKNOWN_ENCODING: %s", encoding)
+	}
+}
+
+// acceptsEncoding parses the Accept-Encoding header, the encoding is accepted when it's listed with a quality above
+// zero, or when * is and the encoding isn't listed
+func acceptsEncoding(header, encoding string) bool {
+	wildcard := false
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		accepted := true
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+				q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+
+		switch name := strings.TrimSpace(params[0]); {
+		case strings.EqualFold(name, encoding):
+			return accepted
+		case name == "*":
+			wildcard = accepted
+		}
+	}
+
+	return wildcard
+}
+
+// compressLayer stores a compressed copy of an uncompressed layer and returns nil when the layer doesn't need to be
+// compressed. The compressed copy is streamed to the DFS part by part, the upload is aborted if it fails half way
+func (r *registry) compressLayer(ctx context.Context, layer *types.LayerV2) (*types.CompressedLayer, error) {
+	rc, err := r.dfs.Download(ctx, GetLayerIdentifier(layer.UUID))
+	if err != nil {
+		return nil, fmt.Errorf("ERR_DOWNLOAD_LAYER: %w", err)
+	}
+	defer rc.Close()
+
+	src := bufio.NewReaderSize(rc, sniffLength)
+	head, err := src.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("ERR_READ_LAYER: %w", err)
+	}
+	if !needsCompression(layer.MediaType, head) {
+		return nil, nil
+	}
+
+	id, err := CreateIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	key := GetLayerIdentifier(id)
+
+	uploadID, err := r.dfs.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := r.dfs.AbortMultipartUpload(ctx, uploadID, key); err != nil {
+			color.Red("error aborting the compression of layer %s: %s", layer.Digest, err)
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	// closing the reader unblocks the compressor when the upload fails half way
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(r.compressor.Compress(pw, src))
+	}()
+
+	digester := digest.NewDigester(digest.Canonical)
+	compressed := io.TeeReader(pr, digester)
+
+	var parts []s3types.CompletedPart
+	var size int64
+	chunk := make([]byte, r.chunkSize())
+	for partNumber := int64(1); ; partNumber++ {
+		n, readErr := io.ReadFull(compressed, chunk)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return nil, fmt.Errorf("ERR_COMPRESS_LAYER: %w", readErr)
+		}
+		if n == 0 {
+			break
+		}
+
+		part, uploadErr := r.dfs.UploadPart(
+			ctx,
+			uploadID,
+			key,
+			digest.FromBytes(chunk[:n]),
+			partNumber,
+			bytes.NewReader(chunk[:n]),
+			int64(n),
+		)
+		if uploadErr != nil {
+			return nil, uploadErr
+		}
+
+		parts = append(parts, part)
+		size += int64(n)
+		if readErr != nil {
+			break
+		}
+	}
+
+	compressedDigest := digester.Digest()
+	dfsLink, err := r.dfs.CompleteMultipartUploadInput(ctx, uploadID, key, compressedDigest, parts)
+	if err != nil {
+		return nil, err
+	}
+	completed = true
+
+	return &types.CompressedLayer{
+		Digest:           layer.Digest,
+		CompressedDigest: compressedDigest,
+		UUID:             id,
+		DFSLink:          dfsLink,
+		Encoding:         r.compressor.Encoding(),
+		Size:             size,
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+// compressedLayer returns the compressed copy which replaced the layer, nil when the layer is stored as it was
+// pushed. It's looked up even when RecompressLayers is disabled, the layers compressed before are only stored so
+func (r *registry) compressedLayer(ctx context.Context, dig string) *types.CompressedLayer {
+	compressed, err := r.store.GetCompressedLayer(ctx, dig)
+	if err != nil {
+		return nil
+	}
+
+	return compressed
+}
+
+// startCompressor compresses the queued layers one at a time, off the request path, until Close
+func (r *registry) startCompressor() {
+	r.compressions = make(chan *types.LayerV2, compressionQueueLength)
+	r.stopCompressor = make(chan struct{})
+	r.compressorDone = make(chan struct{})
+
+	go func() {
+		defer close(r.compressorDone)
+
+		for {
+			select {
+			case layer := <-r.compressions:
+				r.recompressLayer(context.Background(), layer)
+			case <-r.stopCompressor:
+				return
+			}
+		}
+	}()
+}
+
+// queueCompression never blocks the upload, the layer is kept as it was pushed when the queue is full
+func (r *registry) queueCompression(layer *types.LayerV2) {
+	if r.compressor == nil {
+		return
+	}
+
+	select {
+	case r.compressions <- layer:
+	default:
+		color.Yellow("compression queue is full, layer %s is stored as it was pushed", layer.Digest)
+	}
+}
+
+// recompressLayer replaces the layer with its compressed copy, so that it's stored once. It's best effort, the
+// layer is served as it was pushed when compressing it fails
+func (r *registry) recompressLayer(ctx context.Context, layer *types.LayerV2) {
+	compressed, err := r.compressLayer(ctx, layer)
+	if err != nil {
+		color.Red("error compressing layer %s: %s", layer.Digest, err)
+		return
+	}
+	if compressed == nil {
+		return
+	}
+
+	// the layer may have been deleted meanwhile, the copy is dropped when it can't be recorded
+	if err = r.setCompressedLayer(ctx, compressed); err != nil {
+		color.Red("error saving compressed layer %s: %s", layer.Digest, err)
+		if err = r.dfs.DeleteObject(ctx, GetLayerIdentifier(compressed.UUID)); err != nil {
+			color.Red("error deleting compressed layer %s: %s", layer.Digest, err)
+		}
+		return
+	}
+
+	if err = r.dfs.DeleteObject(ctx, GetLayerIdentifier(layer.UUID)); err != nil {
+		color.Red("error deleting layer %s, replaced by its compressed copy: %s", layer.Digest, err)
+	}
+}
+
+func (r *registry) setCompressedLayer(ctx context.Context, compressed *types.CompressedLayer) error {
+	txn, err := r.store.NewTxn(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = r.store.SetCompressedLayer(ctx, txn, compressed); err != nil {
+		_ = r.store.Abort(ctx, txn)
+		return err
+	}
+
+	return r.store.Commit(ctx, txn)
+}
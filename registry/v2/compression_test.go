@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// compressionStore keeps the compressed copies of the layers
+type compressionStore struct {
+	*uploadStore
+	compressed map[string]*types.CompressedLayer
+}
+
+func (s *compressionStore) GetLayer(_ context.Context, dig string) (*types.LayerV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	layer, ok := s.layers[dig]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return layer, nil
+}
+
+func (s *compressionStore) SetCompressedLayer(_ context.Context, _ pgx.Tx, layer *types.CompressedLayer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compressed[layer.Digest] = layer
+	return nil
+}
+
+func (s *compressionStore) GetCompressedLayer(_ context.Context, dig string) (*types.CompressedLayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	layer, ok := s.compressed[dig]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return layer, nil
+}
+
+// failingPartsDFS fails every part upload
+type failingPartsDFS struct {
+	*memory.DFS
+}
+
+func (failingPartsDFS) UploadPart(
+	context.Context, string, string, string, int64, io.ReadSeeker, int64,
+) (s3types.CompletedPart, error) {
+	return s3types.CompletedPart{}, errors.New("part upload failed")
+}
+
+func tarLayer(t *testing.T) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	content := bytes.Repeat([]byte("a layer compresses well "), 100)
+	if err := tw.WriteHeader(&tar.Header{Name: "layer.txt", Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func pullLayer(t *testing.T, r *registry, dig, acceptEncoding string) *http.Response {
+	t.Helper()
+
+	ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/blobs/"+dig, testNamespace)
+	ctx.SetParamNames("username", "imagename", "digest")
+	ctx.SetParamValues("johndoe", "alpine", dig)
+	ctx.Request().Header.Set("Accept-Encoding", acceptEncoding)
+	if err := r.PullLayer(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Result()
+}
+
+func TestPullRecompressedLayer(t *testing.T) {
+	storage := memory.New()
+	store := &compressionStore{uploadStore: newUploadStore(), compressed: map[string]*types.CompressedLayer{}}
+	r := newTestRegistry(store, storage)
+	r.compressor = NewGzipCompressor(gzip.BestCompression)
+	// the layers are compressed by the test instead of the background compressor
+	r.compressions = make(chan *types.LayerV2, 1)
+
+	layer := tarLayer(t)
+	dig := digest.FromBytes(layer)
+	if code, _ := pushLayer(t, r, testNamespace, layer); code != http.StatusCreated {
+		t.Fatalf("got status %d pushing the layer, want %d", code, http.StatusCreated)
+	}
+	if _, ok := store.compressed[dig]; ok {
+		t.Fatal("the layer was compressed by the push")
+	}
+
+	pushed := <-r.compressions
+	r.recompressLayer(context.Background(), pushed)
+	compressed, ok := store.compressed[dig]
+	if !ok {
+		t.Fatal("the compressed copy wasn't recorded")
+	}
+	if compressed.Size >= int64(len(layer)) {
+		t.Errorf("got %d bytes compressed, want less than the %d bytes of the layer", compressed.Size, len(layer))
+	}
+	if keys := storage.Keys(); len(keys) != 1 || keys[0] != GetLayerIdentifier(compressed.UUID) {
+		t.Errorf("got the objects %v, want the compressed copy to replace the layer", keys)
+	}
+
+	res := pullLayer(t, r, dig, "br;q=1.0, gzip;q=0.8")
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got status %d and Content-Encoding %q, want %d and gzip",
+			res.StatusCode, res.Header.Get("Content-Encoding"), http.StatusOK)
+	}
+	if digest.FromBytes(body) != compressed.CompressedDigest {
+		t.Errorf("got digest %s for the body, want the compressed digest %s",
+			digest.FromBytes(body), compressed.CompressedDigest)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("the body isn't gzip: %s", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(decoded, layer) {
+		t.Errorf("got error %v decoding the body, want the layer", err)
+	}
+	if res.Header.Get(HeaderDockerContentDigest) != dig {
+		t.Errorf("got Docker-Content-Digest %s, want the digest of the layer %s",
+			res.Header.Get(HeaderDockerContentDigest), dig)
+	}
+
+	// gzip;q=0 refuses gzip, the layer is decoded
+	res = pullLayer(t, r, dig, "gzip;q=0, identity")
+	body, _ = io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, layer) {
+		t.Errorf("got status %d, Content-Encoding %q and %d bytes, want %d and the %d bytes of the layer",
+			res.StatusCode, res.Header.Get("Content-Encoding"), len(body), http.StatusOK, len(layer))
+	}
+}
+
+func TestCompressLayerAbortsFailedUpload(t *testing.T) {
+	storage := memory.New()
+	r := newTestRegistry(newUploadStore(), storage)
+	r.dfs = failingPartsDFS{storage}
+	r.compressor = NewGzipCompressor(gzip.DefaultCompression)
+
+	layer := &types.LayerV2{Digest: digest.FromBytes(tarLayer(t)), UUID: "uncompressed"}
+	storage.Put(GetLayerIdentifier(layer.UUID), tarLayer(t))
+
+	if _, err := r.compressLayer(context.Background(), layer); err == nil {
+		t.Fatal("got no error with the parts failing to upload")
+	}
+	if storage.Uploads() != 0 || storage.Calls("AbortMultipartUpload") != 1 {
+		t.Errorf("got %d uploads left and %d aborts, want the upload aborted",
+			storage.Uploads(), storage.Calls("AbortMultipartUpload"))
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "gzip", want: true},
+		{header: "GZIP", want: true},
+		{header: "deflate, gzip;q=1.0, *;q=0.5", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "gzip;q=0.0, deflate", want: false},
+		{header: "*", want: true},
+		{header: "*;q=0", want: false},
+		{header: "gzip;q=0, *", want: false},
+		{header: "br, x-gzipped", want: false},
+		{header: "identity", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, "gzip"); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, gzip) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseContentRange parses the Content-Range header of a chunk upload. Clients send it as "start-end",
+// "bytes start-end" or "bytes start-end/total" (the total is ignored, it's usually "*"). The range is inclusive
+func parseContentRange(contentRange string) (start int64, end int64, err error) {
+	value := strings.TrimSpace(contentRange)
+	value = strings.TrimSpace(strings.TrimPrefix(value, "bytes"))
+	value = strings.TrimPrefix(value, "=")
+
+	if i := strings.Index(value, "/"); i != -1 {
+		value = value[:i]
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("ERR_INVALID_CONTENT_RANGE: expected <start>-<end>, got: %s", contentRange)
+	}
+
+	start, err = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("ERR_INVALID_CONTENT_RANGE: invalid start: %s", contentRange)
+	}
+
+	end, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ERR_INVALID_CONTENT_RANGE: invalid end: %s", contentRange)
+	}
+
+	return start, end, nil
+}
+
+// uploadedRange returns the value of the Range header for an upload that has received n bytes. Range is inclusive,
+// an upload without any bytes yet is reported as 0-0
+func uploadedRange(n int64) string {
+	if n <= 0 {
+		return "0-0"
+	}
+
+	return fmt.Sprintf("0-%d", n-1)
+}
+
+// errRangeNotSatisfiable is returned for the ranges which start past the end of the blob
+var errRangeNotSatisfiable = errors.New("ERR_RANGE_NOT_SATISFIABLE") //nolint
+
+// parseByteRange parses the Range header of a blob pull into the offset and length of the range, clamped to size.
+// It supports a single range: start-end, start- and the suffix range -n. ok is false when there's no range to serve,
+// i.e. no header, a header which can't be parsed or multiple ranges, the whole blob is sent then
+func parseByteRange(header string, size int64) (offset int64, length int64, ok bool, err error) {
+	value := strings.TrimSpace(header)
+	if !strings.HasPrefix(value, "bytes=") || strings.Contains(value, ",") {
+		return 0, 0, false, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false, nil
+	}
+	startValue, endValue := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	// -n is the last n bytes
+	if startValue == "" {
+		n, parseErr := strconv.ParseInt(endValue, 10, 64)
+		if parseErr != nil || n <= 0 {
+			return 0, 0, false, nil
+		}
+		if n > size {
+			n = size
+		}
+		if n == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		return size - n, n, true, nil
+	}
+
+	start, parseErr := strconv.ParseInt(startValue, 10, 64)
+	if parseErr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+
+	end := size - 1
+	if endValue != "" {
+		end, parseErr = strconv.ParseInt(endValue, 10, 64)
+		if parseErr != nil || end < start {
+			return 0, 0, false, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+
+	return start, end - start + 1, true, nil
+}
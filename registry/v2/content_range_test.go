@@ -0,0 +1,96 @@
+package registry
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantEnd   int64
+		wantErr   bool
+	}{
+		{header: "0-1023", wantStart: 0, wantEnd: 1023},
+		{header: "1024-2047", wantStart: 1024, wantEnd: 2047},
+		{header: "bytes 0-1023", wantStart: 0, wantEnd: 1023},
+		{header: "bytes=0-1023", wantStart: 0, wantEnd: 1023},
+		{header: "bytes 0-1023/4096", wantStart: 0, wantEnd: 1023},
+		{header: "bytes 0-1023/*", wantStart: 0, wantEnd: 1023},
+		{header: " 5 - 9 ", wantStart: 5, wantEnd: 9},
+		// the handler rejects a start after the end, the parser doesn't
+		{header: "10-5", wantStart: 10, wantEnd: 5},
+		{header: "", wantErr: true},
+		{header: "0", wantErr: true},
+		{header: "0-1-2", wantErr: true},
+		{header: "a-10", wantErr: true},
+		{header: "0-b", wantErr: true},
+		{header: "-1-10", wantErr: true},
+		{header: "bytes */4096", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, end, err := parseContentRange(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("got %d-%d, want %d-%d", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestUploadedRange(t *testing.T) {
+	tests := map[int64]string{0: "0-0", 1: "0-0", 1024: "0-1023"}
+	for received, want := range tests {
+		if got := uploadedRange(received); got != want {
+			t.Errorf("%d bytes received: got %s, want %s", received, got, want)
+		}
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		wantOffset int64
+		wantLength int64
+		wantOK     bool
+		wantErr    bool
+	}{
+		{header: "bytes=0-99", wantOffset: 0, wantLength: 100, wantOK: true},
+		{header: "bytes=10-19", wantOffset: 10, wantLength: 10, wantOK: true},
+		{header: "bytes=90-", wantOffset: 90, wantLength: 10, wantOK: true},
+		{header: "bytes=-10", wantOffset: 90, wantLength: 10, wantOK: true},
+		{header: "bytes=-1000", wantOffset: 0, wantLength: 100, wantOK: true},
+		{header: "bytes=50-1000", wantOffset: 50, wantLength: 50, wantOK: true},
+		{header: " bytes=1-1 ", wantOffset: 1, wantLength: 1, wantOK: true},
+		// the whole blob is sent for the headers which aren't a single range
+		{header: ""},
+		{header: "0-99"},
+		{header: "items=0-99"},
+		{header: "bytes=0-9,20-29"},
+		{header: "bytes=a-9"},
+		{header: "bytes=9-0"},
+		{header: "bytes=-0"},
+		{header: "bytes=100-", wantErr: true},
+		{header: "bytes=150-200", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			offset, length, ok, err := parseByteRange(tt.header, 100)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %t, want %t", ok, tt.wantOK)
+			}
+			if offset != tt.wantOffset || length != tt.wantLength {
+				t.Errorf("got %d bytes from %d, want %d bytes from %d", length, offset, tt.wantLength, tt.wantOffset)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// maxDescriptorTreeDepth bounds the recursion into indexes, an index can't reference itself through its digest
+// but nothing stops a chain of indexes
+const maxDescriptorTreeDepth = 4
+
+// ManifestTree returns the descriptors of the manifest and of everything it references, i.e. the manifests of an
+// index and the config and layers of every image manifest
+// GET /v2/<name>/manifests/<reference>/tree
+func (r *registry) ManifestTree(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	ref := ctx.Param("reference")
+
+	manifest, err := r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	tree := r.manifestNode(ctx.Request().Context(), manifest, 0, map[string]bool{})
+	echoErr := ctx.JSON(http.StatusOK, tree)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// manifestNode reads the manifest from the DFS and resolves its children, visited holds the digests of the
+// indexes on the path from the root, so that a cycle stops the recursion
+func (r *registry) manifestNode(
+	ctx context.Context, manifest *types.ConfigV2, depth int, visited map[string]bool,
+) *types.DescriptorNode {
+	node := &types.DescriptorNode{
+		MediaType: manifest.MediaType,
+		Digest:    manifest.Digest,
+		Kind:      "manifest",
+		Size:      int64(manifest.Size),
+	}
+
+	rc, err := DownloadManifest(ctx, r.dfs, manifest)
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	bz, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Size = int64(len(bz))
+
+	if !isManifestList(manifest.MediaType) {
+		var image ImageManifest
+		if err = json.Unmarshal(bz, &image); err != nil {
+			node.Error = err.Error()
+			return node
+		}
+
+		node.Children = append(node.Children, &types.DescriptorNode{
+			MediaType: image.Config.MediaType,
+			Digest:    image.Config.Digest,
+			Kind:      "config",
+			Size:      int64(image.Config.Size),
+		})
+		for _, layer := range image.Layers {
+			node.Children = append(node.Children, &types.DescriptorNode{
+				MediaType: layer.MediaType,
+				Digest:    layer.Digest,
+				Kind:      "layer",
+				Size:      int64(layer.Size),
+			})
+		}
+		return node
+	}
+
+	node.Kind = "index"
+	var index ManifestList
+	if err = json.Unmarshal(bz, &index); err != nil {
+		node.Error = err.Error()
+		return node
+	}
+
+	visited[manifest.Digest] = true
+	defer delete(visited, manifest.Digest)
+	for _, m := range index.Manifests {
+		child := &types.DescriptorNode{
+			MediaType: m.MediaType,
+			Digest:    m.Digest,
+			Kind:      "manifest",
+			Size:      int64(m.Size),
+		}
+
+		switch {
+		case visited[m.Digest]:
+			child.Error = "the index references itself"
+		case depth+1 >= maxDescriptorTreeDepth:
+			child.Error = fmt.Sprintf("indexes are resolved %d levels deep at most", maxDescriptorTreeDepth)
+		default:
+			sub, err := r.store.GetManifestByReference(ctx, manifest.Namespace, m.Digest)
+			if err != nil {
+				child.Error = err.Error()
+				break
+			}
+			child = r.manifestNode(ctx, sub, depth+1, visited)
+		}
+
+		if m.Platform.Os != "" || m.Platform.Architecture != "" {
+			child.Platform = strings.TrimSuffix(
+				strings.Join([]string{m.Platform.Os, m.Platform.Architecture, m.Platform.Variant}, "/"), "/",
+			)
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+const mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+// putManifest stores the manifest under the references, its digest is returned
+func putManifest(
+	store *integrityStore, storage *memory.DFS, mediaType, content string, references ...string,
+) string {
+	dig := digest.FromBytes([]byte(content))
+	for _, ref := range append(references, dig) {
+		store.manifests[ref] = &types.ConfigV2{Namespace: testNamespace, Reference: ref, Digest: dig, MediaType: mediaType}
+	}
+	storage.Put(GetManifestContentIdentifier(dig), []byte(content))
+	return dig
+}
+
+// imageManifest is an OCI image manifest with a config and a layer of the given sizes
+func imageManifest(name string, configSize, layerSize int) string {
+	return fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":%q,"size":%d}]}`,
+		mediaTypeOCIManifest, digest.FromBytes([]byte(name+" config")), configSize,
+		digest.FromBytes([]byte(name+" layer")), layerSize)
+}
+
+func manifestTree(t *testing.T, store *integrityStore, storage *memory.DFS, ref string) *types.DescriptorNode {
+	t.Helper()
+
+	r := newTestRegistry(store, storage)
+	ctx, rec := manifestContext(http.MethodGet, ref)
+	if err := r.ManifestTree(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var tree types.DescriptorNode
+	if err := json.Unmarshal(rec.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	return &tree
+}
+
+// imageNode is the node of the manifest returned by imageManifest
+func imageNode(name string, size int, platform string, configSize, layerSize int64) *types.DescriptorNode {
+	return &types.DescriptorNode{
+		MediaType: mediaTypeOCIManifest,
+		Digest:    digest.FromBytes([]byte(imageManifest(name, int(configSize), int(layerSize)))),
+		Kind:      "manifest",
+		Size:      int64(size),
+		Platform:  platform,
+		Children: []*types.DescriptorNode{
+			{
+				MediaType: "application/vnd.oci.image.config.v1+json",
+				Digest:    digest.FromBytes([]byte(name + " config")),
+				Kind:      "config",
+				Size:      configSize,
+			},
+			{
+				MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+				Digest:    digest.FromBytes([]byte(name + " layer")),
+				Kind:      "layer",
+				Size:      layerSize,
+			},
+		},
+	}
+}
+
+func TestManifestTreeSingleArch(t *testing.T) {
+	store, storage := newIntegrityStore(), memory.New()
+	manifest := imageManifest("amd64", 120, 2048)
+	putManifest(store, storage, mediaTypeOCIManifest, manifest, "latest")
+
+	want := imageNode("amd64", len(manifest), "", 120, 2048)
+	if got := manifestTree(t, store, storage, "latest"); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("got tree %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestManifestTreeIndex(t *testing.T) {
+	store, storage := newIntegrityStore(), memory.New()
+	amd64 := imageManifest("amd64", 120, 2048)
+	arm64 := imageManifest("arm64", 130, 4096)
+	amd64Digest := putManifest(store, storage, mediaTypeOCIManifest, amd64)
+	arm64Digest := putManifest(store, storage, mediaTypeOCIManifest, arm64)
+	missing := digest.FromBytes([]byte("a manifest that was never pushed"))
+
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"os":"linux","architecture":"amd64"}},`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}},`+
+		`{"mediaType":%q,"digest":%q,"size":10,"platform":{"os":"linux","architecture":"s390x"}}]}`,
+		MediaTypeOCIImageIndex,
+		mediaTypeOCIManifest, amd64Digest, len(amd64),
+		mediaTypeOCIManifest, arm64Digest, len(arm64),
+		mediaTypeOCIManifest, missing)
+	indexDigest := putManifest(store, storage, MediaTypeOCIImageIndex, index, "latest")
+
+	tree := manifestTree(t, store, storage, "latest")
+	if tree.Kind != "index" || tree.Digest != indexDigest || tree.Size != int64(len(index)) || len(tree.Children) != 3 {
+		t.Fatalf("got the root %s %s of %d bytes with %d children, want the index with 3", tree.Kind, tree.Digest,
+			tree.Size, len(tree.Children))
+	}
+
+	for i, want := range []*types.DescriptorNode{
+		imageNode("amd64", len(amd64), "linux/amd64", 120, 2048),
+		imageNode("arm64", len(arm64), "linux/arm64/v8", 130, 4096),
+	} {
+		if !reflect.DeepEqual(tree.Children[i], want) {
+			gotJSON, _ := json.Marshal(tree.Children[i])
+			wantJSON, _ := json.Marshal(want)
+			t.Errorf("got child %d %s, want %s", i, gotJSON, wantJSON)
+		}
+	}
+
+	// a manifest which isn't in the store is reported in place, without failing the tree
+	if unknown := tree.Children[2]; unknown.Digest != missing || unknown.Error == "" || unknown.Platform != "linux/s390x" {
+		t.Errorf("got child %+v, want the unknown manifest with an error", unknown)
+	}
+}
@@ -0,0 +1,114 @@
+// Package digest computes the content addressable identifiers (<algorithm>:<hex>) of blobs and manifests
+package digest
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+
+	// Canonical is the algorithm used when the client doesn't ask for a specific one
+	Canonical = SHA256
+)
+
+// Available reports whether the algorithm is supported
+func (a Algorithm) Available() bool {
+	return a == SHA256 || a == SHA512
+}
+
+// AlgorithmOf returns the algorithm part of dig, e.g. sha256 for sha256:<hex>
+func AlgorithmOf(dig string) Algorithm {
+	return Algorithm(strings.SplitN(dig, ":", 2)[0])
+}
+
+// New returns a new hash for the algorithm, or nil if the algorithm isn't supported
+func New(algo Algorithm) hash.Hash {
+	switch algo {
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// Digester computes the digest of everything written to it, it's meant to be used with io.MultiWriter or
+// io.TeeReader so that the content is hashed while it's being copied
+type Digester struct {
+	hash hash.Hash
+	algo Algorithm
+}
+
+// NewDigester returns a Digester for the algorithm, unsupported algorithms fall back to Canonical
+func NewDigester(algo Algorithm) *Digester {
+	if !algo.Available() {
+		algo = Canonical
+	}
+
+	return &Digester{algo: algo, hash: New(algo)}
+}
+
+func (d *Digester) Write(p []byte) (int, error) {
+	return d.hash.Write(p)
+}
+
+// Digest returns the digest of the content written so far
+func (d *Digester) Digest() string {
+	return string(d.algo) + ":" + hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// FromBytes returns the Canonical digest of bz
+func FromBytes(bz []byte) string {
+	d := NewDigester(Canonical)
+	_, _ = d.Write(bz)
+	return d.Digest()
+}
+
+// FromReader returns the digest of everything read from r, without buffering the content
+func FromReader(algo Algorithm, r io.Reader) (string, error) {
+	if !algo.Available() {
+		return "", fmt.Errorf("ERR_UNSUPPORTED_DIGEST_ALGORITHM: %s", algo)
+	}
+
+	d := NewDigester(algo)
+	if _, err := io.Copy(d, r); err != nil {
+		return "", fmt.Errorf("ERR_DIGEST_READER: %w", err)
+	}
+
+	return d.Digest(), nil
+}
+
+// Validate checks that dig is of the form <algorithm>:<hex>, with a supported algorithm and a hex part
+// of the right length
+func Validate(dig string) error {
+	parts := strings.SplitN(dig, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("ERR_INVALID_DIGEST: %s", dig)
+	}
+
+	algo := Algorithm(parts[0])
+	if !algo.Available() {
+		return fmt.Errorf("ERR_UNSUPPORTED_DIGEST_ALGORITHM: %s", algo)
+	}
+
+	if len(parts[1]) != New(algo).Size()*2 {
+		return fmt.Errorf("ERR_INVALID_DIGEST_LENGTH: %s", dig)
+	}
+
+	if _, err := hex.DecodeString(parts[1]); err != nil || strings.ToLower(parts[1]) != parts[1] {
+		return fmt.Errorf("ERR_INVALID_DIGEST_HEX: %s", dig)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package digest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// largeInput is bigger than the buffers io.Copy and the DFS parts use, so that it's hashed in many writes
+func largeInput(t *testing.T) []byte {
+	t.Helper()
+
+	bz := make([]byte, 12<<20+7)
+	if _, err := rand.New(rand.NewSource(1)).Read(bz); err != nil {
+		t.Fatal(err)
+	}
+	return bz
+}
+
+func TestStreamedMatchesBuffered(t *testing.T) {
+	bz := largeInput(t)
+	sum256 := sha256.Sum256(bz)
+	sum512 := sha512.Sum512(bz)
+	want := map[Algorithm]string{
+		SHA256: "sha256:" + hex.EncodeToString(sum256[:]),
+		SHA512: "sha512:" + hex.EncodeToString(sum512[:]),
+	}
+
+	for algo, buffered := range want {
+		t.Run(string(algo), func(t *testing.T) {
+			streamed, err := FromReader(algo, bytes.NewReader(bz))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if streamed != buffered {
+				t.Errorf("got streamed digest %s, want the buffered digest %s", streamed, buffered)
+			}
+
+			// the chunks of an upload are of any size, the digest doesn't depend on how the content is split
+			d := NewDigester(algo)
+			for rest, size := bz, 1; len(rest) > 0; size = size*3 + 1 {
+				n := size
+				if n > len(rest) {
+					n = len(rest)
+				}
+				_, _ = d.Write(rest[:n])
+				rest = rest[n:]
+			}
+			if d.Digest() != buffered {
+				t.Errorf("got digest %s written in chunks, want %s", d.Digest(), buffered)
+			}
+
+			// hashed while being copied, as the uploads are
+			d = NewDigester(algo)
+			if _, err = io.Copy(io.Discard, io.TeeReader(bytes.NewReader(bz), d)); err != nil {
+				t.Fatal(err)
+			}
+			if d.Digest() != buffered {
+				t.Errorf("got digest %s through a TeeReader, want %s", d.Digest(), buffered)
+			}
+		})
+	}
+
+	if got := FromBytes(bz); got != want[SHA256] {
+		t.Errorf("got FromBytes digest %s, want %s", got, want[SHA256])
+	}
+}
+
+func TestFromReaderUnsupportedAlgorithm(t *testing.T) {
+	_, err := FromReader("md5", strings.NewReader("content"))
+	if err == nil || !strings.HasPrefix(err.Error(), "ERR_UNSUPPORTED_DIGEST_ALGORITHM") {
+		t.Errorf("got error %v, want ERR_UNSUPPORTED_DIGEST_ALGORITHM", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		dig     string
+		wantErr string
+	}{
+		{dig: FromBytes([]byte("content"))},
+		{dig: "sha512:" + strings.Repeat("a", 128)},
+		{dig: "sha256", wantErr: "ERR_INVALID_DIGEST"},
+		{dig: "md5:" + strings.Repeat("a", 32), wantErr: "ERR_UNSUPPORTED_DIGEST_ALGORITHM"},
+		{dig: "sha256:" + strings.Repeat("a", 63), wantErr: "ERR_INVALID_DIGEST_LENGTH"},
+		{dig: "sha256:" + strings.Repeat("A", 64), wantErr: "ERR_INVALID_DIGEST_HEX"},
+		{dig: "sha256:" + strings.Repeat("z", 64), wantErr: "ERR_INVALID_DIGEST_HEX"},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.dig)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: got error %v", tt.dig, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got error %v, want %s", tt.dig, err, tt.wantErr)
+		}
+	}
+}
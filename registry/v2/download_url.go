@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultDownloadURLTTL = time.Minute * 15
+
+// BlobDownloadURL returns a pre-signed URL the blob can be fetched from straight from the DFS, so that large blobs
+// don't go through the registry. When the DFS can't sign URLs, or the layer is stored compressed (the DFS would send
+// the compressed bytes), the registry blob endpoint is returned instead.
+// Only the blobs used by a manifest of the repository are signed, the ACL was checked for the repository
+// GET /v2/<name>/blobs/<digest>/download-url
+func (r *registry) BlobDownloadURL(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	dig := ctx.Param("digest")
+
+	layer, err := r.repositoryLayer(ctx, namespace, dig)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), echo.Map{"digest": dig})
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	ttl := r.downloadURLTTL()
+	download := &types.BlobDownloadURL{Digest: layer.Digest, Size: layer.Size}
+	signedAt := time.Now()
+	url, err := "", dfs.ErrPresignUnsupported
+	if r.compressedLayer(ctx.Request().Context(), layer.Digest) == nil {
+		url, err = r.dfs.PresignedURL(ctx.Request().Context(), GetLayerIdentifier(layer.UUID), ttl)
+	}
+	switch {
+	case err == nil:
+		expiresAt := signedAt.Add(ttl)
+		download.URL, download.ExpiresAt = url, &expiresAt
+	case errors.Is(err, dfs.ErrPresignUnsupported):
+		download.URL = fmt.Sprintf("%s/v2/%s/blobs/%s", r.config.Endpoint(), namespace, layer.Digest)
+		download.Proxied = true
+	default:
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{"digest": dig})
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, download)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// repositoryLayer returns the layer when a manifest of the repository uses it, postgres.ErrNotFound otherwise
+func (r *registry) repositoryLayer(ctx echo.Context, namespace, dig string) (*types.LayerV2, error) {
+	found, err := r.store.RepositoryHasLayer(ctx.Request().Context(), namespace, dig)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s isn't used by %s", postgres.ErrNotFound, dig, namespace)
+	}
+
+	return r.store.GetLayer(ctx.Request().Context(), dig)
+}
+
+func (r *registry) downloadURLTTL() time.Duration {
+	if r.config.Registry.DownloadURLTTL > 0 {
+		return r.config.Registry.DownloadURLTTL
+	}
+
+	return defaultDownloadURLTTL
+}
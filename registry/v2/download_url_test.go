@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/dfs/filebase"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type (
+	// downloadStore has the layers used by the manifests of testNamespace, compressed holds the layers stored
+	// compressed
+	downloadStore struct {
+		*integrityStore
+		used       map[string]bool
+		compressed map[string]bool
+	}
+
+	// signingDFS signs the URLs like S3 does, the objects are kept in memory
+	signingDFS struct {
+		*memory.DFS
+		signer dfs.DFS
+	}
+)
+
+func (s *downloadStore) RepositoryHasLayer(_ context.Context, namespace, dig string) (bool, error) {
+	return namespace == testNamespace && s.used[dig], nil
+}
+
+func (s *downloadStore) GetCompressedLayer(_ context.Context, dig string) (*types.CompressedLayer, error) {
+	if !s.compressed[dig] {
+		return nil, postgres.ErrNotFound
+	}
+	return &types.CompressedLayer{Digest: dig, UUID: "compressed", Encoding: "zstd"}, nil
+}
+
+func (d *signingDFS) PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return d.signer.PresignedURL(ctx, key, expires)
+}
+
+func downloadURL(t *testing.T, r *registry, dig string) (int, *types.BlobDownloadURL) {
+	t.Helper()
+
+	ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/blobs/"+dig+"/download-url", testNamespace)
+	ctx.SetParamNames("username", "imagename", "digest")
+	ctx.SetParamValues("johndoe", "alpine", dig)
+	if err := r.BlobDownloadURL(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+
+	var download types.BlobDownloadURL
+	if err := json.Unmarshal(rec.Body.Bytes(), &download); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, &download
+}
+
+func withinSeconds(got, want time.Time, seconds int) bool {
+	diff := got.Sub(want)
+	return diff <= time.Duration(seconds)*time.Second && diff >= -time.Duration(seconds)*time.Second
+}
+
+func newDownloadRegistry(storage dfs.DFS) (*registry, *downloadStore, []string) {
+	store := &downloadStore{integrityStore: newIntegrityStore(), used: map[string]bool{}, compressed: map[string]bool{}}
+	memoryDFS := memory.New()
+	_, layers := pushTestImage(store.integrityStore, memoryDFS)
+	store.used[layers[0]] = true
+	store.used[layers[1]] = true
+
+	r := newTestRegistry(store, memoryDFS)
+	r.config = &config.OpenRegistryConfig{
+		Registry: &config.Registry{DNSAddress: "registry.test", FQDN: "registry.test", DownloadURLTTL: time.Minute * 5},
+	}
+	if storage != nil {
+		r.dfs = &signingDFS{DFS: memoryDFS, signer: storage}
+	}
+	return r, store, layers
+}
+
+func TestBlobDownloadURLSigned(t *testing.T) {
+	r, store, layers := newDownloadRegistry(filebase.New(&config.S3CompatibleDFS{
+		Endpoint:   "https://s3.test",
+		AccessKey:  "access-key",
+		SecretKey:  "secret-key",
+		BucketName: "layers",
+	}))
+
+	before := time.Now()
+	code, download := downloadURL(t, r, layers[0])
+	if code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if download.Proxied || download.Digest != layers[0] || download.Size != store.layers[layers[0]].Size {
+		t.Errorf("got %+v, want the signed URL of the layer", download)
+	}
+
+	signed, err := url.Parse(download.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(signed.Path, "/"+GetLayerIdentifier(store.layers[layers[0]].UUID)) {
+		t.Errorf("got the URL %s, want it to point to the layer object", signed)
+	}
+	query := signed.Query()
+	if query.Get("X-Amz-Signature") == "" || !strings.HasPrefix(query.Get("X-Amz-Credential"), "access-key/") {
+		t.Errorf("got the URL %s, want it signed with the access key", signed)
+	}
+
+	// the URL expires after the configured TTL, which the response tells the client
+	if got := query.Get("X-Amz-Expires"); got != strconv.Itoa(int((time.Minute * 5).Seconds())) {
+		t.Errorf("got X-Amz-Expires %s, want 300", got)
+	}
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if download.ExpiresAt == nil || !withinSeconds(*download.ExpiresAt, signedAt.Add(time.Minute*5), 2) {
+		t.Errorf("got expires_at %v, want 5 minutes after the URL was signed at %s", download.ExpiresAt, signedAt)
+	}
+	if download.ExpiresAt != nil && download.ExpiresAt.Before(before.Add(time.Minute*5)) {
+		t.Errorf("got expires_at %s, want 5 minutes from now", download.ExpiresAt)
+	}
+}
+
+func TestBlobDownloadURLProxied(t *testing.T) {
+	// the memory DFS can't sign URLs
+	r, _, layers := newDownloadRegistry(nil)
+	code, download := downloadURL(t, r, layers[0])
+	want := "https://registry.test/v2/" + testNamespace + "/blobs/" + layers[0]
+	if code != http.StatusOK || !download.Proxied || download.URL != want || download.ExpiresAt != nil {
+		t.Errorf("got status %d and %+v, want the registry URL %s", code, download, want)
+	}
+
+	// the compressed layers are sent by the registry, which decodes them
+	r, store, layers := newDownloadRegistry(filebase.New(&config.S3CompatibleDFS{Endpoint: "https://s3.test"}))
+	store.compressed[layers[1]] = true
+	if code, download = downloadURL(t, r, layers[1]); code != http.StatusOK || !download.Proxied {
+		t.Errorf("got status %d and %+v for a compressed layer, want the registry URL", code, download)
+	}
+
+	// a blob the repository doesn't use isn't signed
+	unused, _ := pushTestImage(store.integrityStore, memory.New())
+	if code, _ = downloadURL(t, r, unused); code != http.StatusNotFound {
+		t.Errorf("got status %d for a blob the repository doesn't use, want %d", code, http.StatusNotFound)
+	}
+}
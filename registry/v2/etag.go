@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// contentETag is the strong ETag of the content with the given digest, the digest never changes with the content
+func contentETag(digest string) string {
+	return `"` + digest + `"`
+}
+
+// setETag sets the ETag of the content with the given digest and reports whether the client already has it, i.e.
+// If-None-Match lists the ETag or is *. The handler responds with 304 Not Modified then
+func setETag(ctx echo.Context, digest string) bool {
+	etag := contentETag(digest)
+	ctx.Response().Header().Set("ETag", etag)
+
+	ifNoneMatch := ctx.Request().Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// If-None-Match uses the weak comparison, the W/ prefix is ignored
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified responds with 304 Not Modified, along with the headers which identify the content
+func (r *registry) notModified(ctx echo.Context, digest string) error {
+	ctx.Response().Header().Set(HeaderDockerContentDigest, digest)
+	echoErr := ctx.NoContent(http.StatusNotModified)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// setManifestHeaders sets the headers of the successful manifest GET and HEAD responses. Docker-Content-Digest is the
+// digest the manifest is stored by, i.e. the canonical digest of its content, whether the client asked for a tag or a
+// digest. Last-Modified is the time the reference was last pushed
+func setManifestHeaders(ctx echo.Context, manifest *types.ConfigV2, size int64) {
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = echo.MIMEApplicationJSON
+	}
+
+	header := ctx.Response().Header()
+	header.Set(HeaderDockerContentDigest, manifest.Digest)
+	header.Set(echo.HeaderContentType, mediaType)
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(size, 10))
+	// a tag which is pushed again is modified, even if its digest is the same
+	if !manifest.UpdatedAt.IsZero() {
+		header.Set(echo.HeaderLastModified, manifest.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+}
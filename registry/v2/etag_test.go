@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/labstack/echo/v4"
+)
+
+func TestConditionalManifestPull(t *testing.T) {
+	store, storage := newIntegrityStore(), memory.New()
+	pushTestImage(store, storage)
+	etag := contentETag(store.manifests["latest"].Digest)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "no If-None-Match", want: http.StatusOK},
+		{name: "matching", ifNoneMatch: etag, want: http.StatusNotModified},
+		{name: "weak matching", ifNoneMatch: "W/" + etag, want: http.StatusNotModified},
+		{name: "matching in a list", ifNoneMatch: `"sha256:abc", ` + etag, want: http.StatusNotModified},
+		{name: "any", ifNoneMatch: "*", want: http.StatusNotModified},
+		{name: "not matching", ifNoneMatch: `"sha256:abc"`, want: http.StatusOK},
+		{name: "digest without quotes", ifNoneMatch: store.manifests["latest"].Digest, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := newTestRegistry(store, storage)
+		ctx, rec := manifestContext(http.MethodGet, "latest")
+		if tt.ifNoneMatch != "" {
+			ctx.Request().Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		if err := r.PullManifest(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("%s: got ETag %s, want %s", tt.name, got, etag)
+		}
+		if got := rec.Header().Get(HeaderDockerContentDigest); got != store.manifests["latest"].Digest {
+			t.Errorf("%s: got %s %s, want the manifest digest", tt.name, HeaderDockerContentDigest, got)
+		}
+		if notModified := tt.want == http.StatusNotModified; notModified != (rec.Body.Len() == 0) {
+			t.Errorf("%s: got a body of %d bytes", tt.name, rec.Body.Len())
+		}
+	}
+}
+
+func TestConditionalBlobPull(t *testing.T) {
+	store, storage := newIntegrityStore(), memory.New()
+	config, _ := pushTestImage(store, storage)
+	store.layers[config].DFSLink = "link"
+
+	for ifNoneMatch, want := range map[string]int{
+		contentETag(config):        http.StatusNotModified,
+		`"sha256:abc"`:             http.StatusOK,
+		"":                         http.StatusOK,
+		"W/" + contentETag(config): http.StatusNotModified,
+	} {
+		r := newTestRegistry(store, storage)
+		ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/blobs/"+config, testNamespace)
+		ctx.SetParamNames("username", "imagename", "digest")
+		ctx.SetParamValues("johndoe", "alpine", config)
+		if ifNoneMatch != "" {
+			ctx.Request().Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if err := r.PullLayer(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != want {
+			t.Errorf("If-None-Match %q: got status %d, want %d", ifNoneMatch, rec.Code, want)
+		}
+		if got := rec.Header().Get("ETag"); got != contentETag(config) {
+			t.Errorf("If-None-Match %q: got ETag %s, want %s", ifNoneMatch, got, contentETag(config))
+		}
+	}
+}
+
+// TestManifestDigestHeader pushes a manifest by tag, the pulls by tag and by digest all get its canonical digest
+func TestManifestDigestHeader(t *testing.T) {
+	store, storage := newPushStore(), memory.New()
+	r := newPushRegistry(t, store, storage)
+	content := artifactManifest("application/vnd.example.sbom.v1+json", "application/vnd.example.sbom.v1+json")
+	want := digest.FromBytes(content)
+
+	rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, content)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d pushing the manifest, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if got := rec.Header().Get(HeaderDockerContentDigest); got != want {
+		t.Errorf("push: got %s %s, want %s", HeaderDockerContentDigest, got, want)
+	}
+
+	for _, ref := range []string{"v1", want} {
+		for method, handler := range map[string]echo.HandlerFunc{
+			http.MethodGet:  r.PullManifest,
+			http.MethodHead: r.ManifestExists,
+		} {
+			ctx, rec := manifestContext(method, ref)
+			if err := handler(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s: got status %d, want %d: %s", method, ref, rec.Code, http.StatusOK, rec.Body)
+			}
+			if got := rec.Header().Get(HeaderDockerContentDigest); got != want {
+				t.Errorf("%s %s: got %s %s, want %s", method, ref, HeaderDockerContentDigest, got, want)
+			}
+			if got := rec.Header().Get(echo.HeaderContentLength); got != strconv.Itoa(len(content)) {
+				t.Errorf("%s %s: got Content-Length %s, want %d", method, ref, got, len(content))
+			}
+			if got := rec.Header().Get(echo.HeaderContentType); got != mediaTypeOCIManifest {
+				t.Errorf("%s %s: got Content-Type %s, want %s", method, ref, got, mediaTypeOCIManifest)
+			}
+		}
+	}
+}
+
+func TestManifestLastModified(t *testing.T) {
+	store, storage := newPushStore(), memory.New()
+	r := newPushRegistry(t, store, storage)
+	content := artifactManifest("application/vnd.example.sbom.v1+json", "application/vnd.example.sbom.v1+json")
+
+	before := time.Now()
+	if rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, content); rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d pushing the manifest, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	pushed := store.manifests["v1"]
+	for name, at := range map[string]time.Time{"created_at": pushed.CreatedAt, "updated_at": pushed.UpdatedAt} {
+		if at.Before(before) || at.After(time.Now()) {
+			t.Errorf("got %s %s, want the time of the push", name, at)
+		}
+	}
+
+	want := pushed.UpdatedAt.UTC().Format(http.TimeFormat)
+	for method, handler := range map[string]echo.HandlerFunc{
+		http.MethodGet:  r.PullManifest,
+		http.MethodHead: r.ManifestExists,
+	} {
+		ctx, rec := manifestContext(method, "v1")
+		if err := handler(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.Header().Get(echo.HeaderLastModified); got != want {
+			t.Errorf("%s: got Last-Modified %q, want %q", method, got, want)
+		}
+	}
+}
@@ -15,6 +15,9 @@ import (
 type Extenion interface {
 	CatalogDetail(ctx echo.Context) error
 	RepositoryDetail(ctx echo.Context) error
+	PublicRepositories(ctx echo.Context) error
+	PublicRepository(ctx echo.Context) error
+	UserRepositories(ctx echo.Context) error
 }
 
 type extension struct {
@@ -61,12 +64,6 @@ func (ext *extension) CatalogDetail(ctx echo.Context) error {
 		offset = o
 	}
 
-	total, err := ext.store.GetCatalogCount(ctx.Request().Context(), namespace)
-	if err != nil {
-		ext.logger.Log(ctx, err)
-		return ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
-	}
-
 	switch sortBy {
 	case "last_updated":
 		sortBy = "updated_at desc"
@@ -75,14 +72,21 @@ func (ext *extension) CatalogDetail(ctx echo.Context) error {
 	case "":
 		sortBy = "namespace asc"
 	default:
-		err = fmt.Errorf("invalid choice of sort_by element")
+		err := fmt.Errorf("invalid choice of sort_by element")
 		ext.logger.Log(ctx, err)
 		return ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error": err.Error(),
 		})
 	}
 
-	catalogWithDetail, err := ext.store.GetCatalogDetail(ctx.Request().Context(), namespace, pageSize, offset, sortBy)
+	var viewer string
+	if user, ok := ctx.Get(types.UserContextKey).(*types.User); ok {
+		viewer = user.Username
+	}
+
+	catalogWithDetail, total, err := ext.store.GetCatalogDetail(
+		ctx.Request().Context(), viewer, namespace, pageSize, offset, sortBy,
+	)
 	if err != nil {
 		ext.logger.Log(ctx, err)
 		return ctx.JSON(http.StatusInternalServerError, echo.Map{
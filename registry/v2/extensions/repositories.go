@@ -0,0 +1,155 @@
+package extensions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultRepositoriesPageSize = 10
+
+// PublicRepositories - GET /api/v1/repositories?sort=<popular|recent>&n=<page size>&last=<offset>
+// only the public repositories are listed, whoever makes the request
+func (ext *extension) PublicRepositories(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	pageSize, offset, err := pagination(ctx)
+	if err != nil {
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var sortBy string
+	switch ctx.QueryParam("sort") {
+	case "recent", "":
+		sortBy = "updated_at desc, namespace asc"
+	case "popular":
+		sortBy = "pull_count desc, namespace asc"
+	default:
+		err = errors.New("sort must be one of popular or recent")
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	repositories, total, err := ext.store.GetPublicRepositories(ctx.Request().Context(), sortBy, pageSize, offset)
+	if err != nil {
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ext.logger.Log(ctx, nil)
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"repositories": repositories,
+		"total":        total,
+	})
+}
+
+// PublicRepository - GET /api/v1/repositories/:username/:imagename?n=<page size>&last=<offset>
+// returns the repository with a page of its tags, private repositories are reported as not found
+func (ext *extension) PublicRepository(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	pageSize, offset, err := pagination(ctx)
+	if err != nil {
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	namespace := types.Namespace(ctx)
+	repository, err := ext.store.GetPublicRepository(ctx.Request().Context(), namespace, pageSize, offset)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(status, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ext.logger.Log(ctx, nil)
+	return ctx.JSON(http.StatusOK, repository)
+}
+
+// UserRepositories - GET /api/v1/users/:username/repositories?n=<page size>&last=<offset>
+// lists the repositories of a user, the private ones are only listed for the user themselves
+func (ext *extension) UserRepositories(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	pageSize, offset, err := pagination(ctx)
+	if err != nil {
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	owner, err := ext.store.GetUser(ctx.Request().Context(), ctx.Param("username"), false)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(status, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// the request is anonymous when it has no token
+	viewer, ok := ctx.Get(types.UserContextKey).(*types.User)
+	publicOnly := !ok || viewer.Id != owner.Id
+
+	repositories, total, err := ext.store.GetRepositoriesByOwner(
+		ctx.Request().Context(), owner.Id, publicOnly, pageSize, offset,
+	)
+	if err != nil {
+		ext.logger.Log(ctx, err)
+		return ctx.JSON(http.StatusInternalServerError, echo.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ext.logger.Log(ctx, nil)
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"repositories": repositories,
+		"total":        total,
+	})
+}
+
+// pagination reads the n and last query params
+func pagination(ctx echo.Context) (int64, int64, error) {
+	pageSize := int64(defaultRepositoriesPageSize)
+	if n := ctx.QueryParam("n"); n != "" {
+		ps, err := strconv.ParseInt(n, 10, 64)
+		if err != nil || ps <= 0 {
+			return 0, 0, errors.New("n must be a positive number")
+		}
+		pageSize = ps
+	}
+
+	var offset int64
+	if last := ctx.QueryParam("last"); last != "" {
+		o, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || o < 0 {
+			return 0, 0, errors.New("last must be a positive number")
+		}
+		offset = o
+	}
+
+	return pageSize, offset, nil
+}
@@ -0,0 +1,123 @@
+package extensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	nopLogger struct{}
+
+	// ownerStore has the repositories of a single user, the private ones are hidden when publicOnly is set
+	ownerStore struct {
+		postgres.PersistentStore
+		owner        *types.User
+		repositories []*types.PublicRepository
+	}
+)
+
+func (nopLogger) Log(echo.Context, error) {}
+
+func (s *ownerStore) GetUser(_ context.Context, username string, _ bool) (*types.User, error) {
+	if username != s.owner.Username {
+		return nil, fmt.Errorf("ERR_GET_USER: %w", postgres.ErrNotFound)
+	}
+	return s.owner, nil
+}
+
+func (s *ownerStore) GetRepositoriesByOwner(
+	_ context.Context, userID string, publicOnly bool, _ int64, _ int64,
+) ([]*types.PublicRepository, int64, error) {
+	repositories := []*types.PublicRepository{}
+	for _, repository := range s.repositories {
+		if userID == s.owner.Id && (!publicOnly || repository.Visibility == types.RepositoryVisibilityPublic) {
+			repositories = append(repositories, repository)
+		}
+	}
+	return repositories, int64(len(repositories)), nil
+}
+
+func TestUserRepositories(t *testing.T) {
+	owner := &types.User{Id: "owner-id", Username: "johndoe"}
+	store := &ownerStore{owner: owner, repositories: []*types.PublicRepository{
+		{Namespace: "johndoe/public", Visibility: types.RepositoryVisibilityPublic},
+		{Namespace: "johndoe/private", Visibility: types.RepositoryVisibilityPrivate},
+	}}
+	ext, err := New(store, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		viewer   *types.User
+		username string
+		status   int
+		want     []string
+	}{
+		{name: "anonymous", username: "johndoe", status: http.StatusOK, want: []string{"johndoe/public"}},
+		{
+			name:     "another user",
+			viewer:   &types.User{Id: "other-id", Username: "janedoe"},
+			username: "johndoe",
+			status:   http.StatusOK,
+			want:     []string{"johndoe/public"},
+		},
+		{
+			name:     "owner",
+			viewer:   owner,
+			username: "johndoe",
+			status:   http.StatusOK,
+			want:     []string{"johndoe/public", "johndoe/private"},
+		},
+		{name: "unknown user", username: "nobody", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/"+tt.username+"/repositories", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("username")
+			ctx.SetParamValues(tt.username)
+			if tt.viewer != nil {
+				ctx.Set(types.UserContextKey, tt.viewer)
+			}
+
+			if err := ext.UserRepositories(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var page struct {
+				Repositories []*types.PublicRepository `json:"repositories"`
+				Total        int64                     `json:"total"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, repository := range page.Repositories {
+				got = append(got, repository.Namespace)
+			}
+			if !reflect.DeepEqual(got, tt.want) || page.Total != int64(len(tt.want)) {
+				t.Errorf("got repositories %v and total %d, want %v", got, page.Total, tt.want)
+			}
+		})
+	}
+}
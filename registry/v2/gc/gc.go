@@ -0,0 +1,123 @@
+// Package gc implements garbage collection for blobs that are no longer referenced by any manifest
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dfsImpl "github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type (
+	Collector struct {
+		store postgres.PersistentStore
+		dfs   dfsImpl.DFS
+	}
+
+	// Report lists the layer digests that were (or in dry-run mode, would be) removed
+	Report struct {
+		Removed []string `json:"removed"`
+		Scanned int      `json:"scanned"`
+	}
+)
+
+func New(store postgres.PersistentStore, dfs dfsImpl.DFS) *Collector {
+	return &Collector{store: store, dfs: dfs}
+}
+
+// Run removes the layers older than gracePeriod which aren't referenced by any manifest. The grace period makes
+// sure we don't collect blobs of an image that's being pushed right now, whose manifest isn't uploaded yet.
+func (c *Collector) Run(ctx context.Context, gracePeriod time.Duration, dryRun bool) (*Report, error) {
+	referenced, err := c.referencedDigests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := c.store.GetLayersCreatedBefore(ctx, time.Now().Add(-gracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Scanned: len(layers)}
+	for _, layer := range layers {
+		if referenced[layer.Digest] {
+			continue
+		}
+
+		if !dryRun {
+			if err = c.removeLayer(ctx, layer); err != nil {
+				return report, err
+			}
+		}
+		report.Removed = append(report.Removed, layer.Digest)
+	}
+
+	return report, nil
+}
+
+// referencedDigests collects the config and layer digests of every manifest. Config blob digests are only
+// recorded in the manifest itself, so every manifest is read back from the DFS
+func (c *Collector) referencedDigests(ctx context.Context) (map[string]bool, error) {
+	configs, err := c.store.GetAllConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, cfg := range configs {
+		for _, digest := range cfg.Layers {
+			referenced[digest] = true
+		}
+
+		resp, err := registry.DownloadManifest(ctx, c.dfs, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_GC_DOWNLOAD_MANIFEST: %s:%s: %w", cfg.Namespace, cfg.Reference, err)
+		}
+
+		var manifest registry.ImageManifest
+		err = json.NewDecoder(resp).Decode(&manifest)
+		_ = resp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ERR_GC_PARSE_MANIFEST: %s:%s: %w", cfg.Namespace, cfg.Reference, err)
+		}
+
+		referenced[manifest.Config.Digest] = true
+		for _, layer := range manifest.Layers {
+			referenced[layer.Digest] = true
+		}
+	}
+
+	return referenced, nil
+}
+
+// removeLayer deletes the rows of the layer, then its DFS objects once they're committed
+func (c *Collector) removeLayer(ctx context.Context, layer *types.LayerV2) error {
+	txn, err := c.store.NewTxn(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, blobDigest := range layer.BlobDigests {
+		if err = c.store.DeleteBlobV2(ctx, txn, blobDigest); err != nil {
+			_ = c.store.Abort(ctx, txn)
+			return fmt.Errorf("ERR_GC_DELETE_BLOB: %w", err)
+		}
+	}
+
+	if err = c.store.DeleteLayerV2(ctx, txn, layer.Digest); err != nil {
+		_ = c.store.Abort(ctx, txn)
+		return fmt.Errorf("ERR_GC_DELETE_LAYER: %w", err)
+	}
+
+	keys := registry.LayerObjectKeys(ctx, c.store, []*types.LayerV2{layer})
+	if err = c.store.Commit(ctx, txn); err != nil {
+		return err
+	}
+
+	return registry.DeleteObjects(ctx, c.dfs, keys)
+}
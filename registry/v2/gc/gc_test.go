@@ -0,0 +1,78 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// gcStore has a manifest using the layer "sha256:used", and an old layer "sha256:unused" with a compressed copy.
+// The txns are nil
+type gcStore struct {
+	postgres.PersistentStore
+}
+
+func (gcStore) NewTxn(context.Context) (pgx.Tx, error)              { return nil, nil }
+func (gcStore) Commit(context.Context, pgx.Tx) error                { return nil }
+func (gcStore) Abort(context.Context, pgx.Tx) error                 { return nil }
+func (gcStore) DeleteLayerV2(context.Context, pgx.Tx, string) error { return nil }
+func (gcStore) DeleteBlobV2(context.Context, pgx.Tx, string) error  { return nil }
+
+func (gcStore) GetAllConfigs(context.Context) ([]*types.ConfigV2, error) {
+	return []*types.ConfigV2{{
+		Namespace: "johndoe/alpine",
+		Reference: "latest",
+		Digest:    "sha256:manifest",
+		Layers:    []string{"sha256:used"},
+	}}, nil
+}
+
+func (gcStore) GetLayersCreatedBefore(context.Context, time.Time) ([]*types.LayerV2, error) {
+	return []*types.LayerV2{
+		{Digest: "sha256:used", UUID: "used-uuid"},
+		{Digest: "sha256:unused", UUID: "unused-uuid", BlobDigests: []string{"sha256:blob"}},
+	}, nil
+}
+
+func (gcStore) GetCompressedLayer(_ context.Context, digest string) (*types.CompressedLayer, error) {
+	if digest == "sha256:unused" {
+		return &types.CompressedLayer{Digest: digest, UUID: "unused-compressed-uuid"}, nil
+	}
+
+	return nil, postgres.ErrNotFound
+}
+
+func TestRunDeletesObjects(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		storage := memory.New()
+		storage.Put(registry.GetManifestContentIdentifier("sha256:manifest"), []byte(`{"layers":[]}`))
+
+		report, err := New(gcStore{}, storage).Run(context.Background(), time.Hour, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Removed) != 1 || report.Removed[0] != "sha256:unused" {
+			t.Fatalf("dry run %t: got %v removed, want sha256:unused", dryRun, report.Removed)
+		}
+
+		want := map[string]int{
+			registry.GetLayerIdentifier("unused-uuid"):            1,
+			registry.GetLayerIdentifier("unused-compressed-uuid"): 1,
+			registry.GetLayerIdentifier("used-uuid"):              0,
+		}
+		for key, deletes := range want {
+			if dryRun {
+				deletes = 0
+			}
+			if got := storage.Deletes(key); got != deletes {
+				t.Errorf("dry run %t: got %d deletes of %s, want %d", dryRun, got, key, deletes)
+			}
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
 )
 
 func (r *registry) errorResponse(code, msg string, detail map[string]interface{}) []byte {
@@ -24,6 +32,98 @@ func (r *registry) errorResponse(code, msg string, detail map[string]interface{}
 	return bz
 }
 
+// uploadDigestError checks the digest an upload is completed with before the blob is hashed, it returns the error
+// response or nil. An algorithm the registry can't compute is UNSUPPORTED rather than a digest mismatch
+func (r *registry) uploadDigestError(dig string) []byte {
+	if algo := digest.AlgorithmOf(dig); strings.Contains(dig, ":") && !algo.Available() {
+		return r.errorResponse(
+			RegistryErrorCodeUnsupported,
+			fmt.Sprintf("unsupported digest algorithm: %s", algo),
+			echo.Map{"digest": dig, "supported": []digest.Algorithm{digest.SHA256, digest.SHA512}},
+		)
+	}
+
+	if err := digest.Validate(dig); err != nil {
+		return r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), echo.Map{"digest": dig})
+	}
+
+	return nil
+}
+
 func (r *registry) getDownloadableURLFromDFSLink(s string) string {
 	return fmt.Sprintf("%s/%s", r.config.DFS.S3Any.DFSLinkResolver, s)
 }
+
+// chunkSize is the size of the parts a blob is uploaded to the DFS in, S3 needs at least 5MB for every part
+// but the last one
+func (r *registry) chunkSize() int {
+	if r.config.DFS == nil || r.config.DFS.S3Any == nil || r.config.DFS.S3Any.ChunkSize == 0 {
+		return defaultChunkSize
+	}
+
+	return r.config.DFS.S3Any.ChunkSize
+}
+
+// storeErrorStatus is the status code for an error returned by the store, a database that can't be reached
+// isn't reported as a missing manifest or blob
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, postgres.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, postgres.ErrTimeout):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// manifestUnknownCode is NAME_UNKNOWN when the manifest wasn't found because nothing was ever pushed to the
+// repository, MANIFEST_UNKNOWN otherwise. The private repositories never get here without access, pullACL
+// challenges the anonymous requests for them
+func (r *registry) manifestUnknownCode(ctx context.Context, namespace string, err error) string {
+	if !errors.Is(err, postgres.ErrNotFound) {
+		return RegistryErrorCodeManifestUnknown
+	}
+
+	if exists, existsErr := r.store.RepositoryExists(ctx, namespace); existsErr == nil && !exists {
+		return RegistryErrorCodeNameUnknown
+	}
+
+	return RegistryErrorCodeManifestUnknown
+}
+
+// pageSize reads the n query param, it is Registry.DefaultPageSize when n is missing (or zero) and is capped at
+// Registry.MaxPageSize
+func (r *registry) pageSize(ctx echo.Context) (int64, error) {
+	defaultSize, maxSize := int64(defaultPageSize), int64(maxPageSize)
+	if r.config.Registry.DefaultPageSize > 0 {
+		defaultSize = r.config.Registry.DefaultPageSize
+	}
+	if r.config.Registry.MaxPageSize > 0 {
+		maxSize = r.config.Registry.MaxPageSize
+	}
+
+	n := ctx.QueryParam("n")
+	if n == "" {
+		return minInt64(defaultSize, maxSize), nil
+	}
+
+	ps, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || ps < 0 {
+		return 0, fmt.Errorf("n must be a positive number")
+	}
+	if ps == 0 {
+		return minInt64(defaultSize, maxSize), nil
+	}
+
+	return minInt64(ps, maxSize), nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+)
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry *config.Registry
+		query    string
+		want     int64
+		wantErr  bool
+	}{
+		{name: "n absent", registry: &config.Registry{}, want: defaultPageSize},
+		{name: "n zero", registry: &config.Registry{}, query: "?n=0", want: defaultPageSize},
+		{name: "n in range", registry: &config.Registry{}, query: "?n=20", want: 20},
+		{name: "n oversized", registry: &config.Registry{}, query: "?n=1000000", want: maxPageSize},
+		{name: "n negative", registry: &config.Registry{}, query: "?n=-1", wantErr: true},
+		{name: "n not a number", registry: &config.Registry{}, query: "?n=ten", wantErr: true},
+		{name: "configured default", registry: &config.Registry{DefaultPageSize: 25}, want: 25},
+		{
+			name:     "configured max",
+			registry: &config.Registry{DefaultPageSize: 25, MaxPageSize: 50},
+			query:    "?n=100",
+			want:     50,
+		},
+		{name: "default above the max", registry: &config.Registry{DefaultPageSize: 500, MaxPageSize: 50}, want: 50},
+	}
+
+	for _, tt := range tests {
+		r := newTestRegistry(nil, nil)
+		r.config.Registry = tt.registry
+		ctx, _ := newTestContext(http.MethodGet, "/v2/_catalog"+tt.query, testNamespace)
+
+		got, err := r.pageSize(ctx)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got page size %d, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got page size %d and error %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCatalogRejectsNegativePageSize(t *testing.T) {
+	r := newTestRegistry(nil, nil)
+	ctx, rec := newTestContext(http.MethodGet, "/v2/_catalog?n=-5", testNamespace)
+	if err := r.Catalog(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", rec.Code)
+	}
+}
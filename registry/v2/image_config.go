@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ImageConfig is the subset of an image config blob that's useful for inspecting an image without pulling it
+	ImageConfig struct {
+		Created      time.Time         `json:"created"`
+		Labels       map[string]string `json:"labels"`
+		Architecture string            `json:"architecture"`
+		Os           string            `json:"os"`
+		Env          []string          `json:"env"`
+		ExposedPorts []string          `json:"exposed_ports"`
+	}
+
+	// imageConfigBlob mirrors the parts of the OCI image config (application/vnd.oci.image.config.v1+json)
+	// that we care about
+	imageConfigBlob struct {
+		Created      time.Time `json:"created"`
+		Architecture string    `json:"architecture"`
+		Os           string    `json:"os"`
+		Config       struct {
+			Labels       map[string]string   `json:"Labels"`
+			ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+			Env          []string            `json:"Env"`
+		} `json:"config"`
+	}
+)
+
+// GetImageConfig
+// GET /v2/<name>/config/<reference>
+func (r *registry) GetImageConfig(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	ref := ctx.Param("reference")
+
+	manifest, err := r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if isManifestList(manifest.MediaType) {
+		detail := map[string]interface{}{"mediaType": manifest.MediaType}
+		errMsg := r.errorResponse(
+			RegistryErrorCodeUnsupported, "manifest lists have no config, use a platform specific reference", detail,
+		)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	// the config of an artifact, if it has one, isn't an image config
+	if manifest.ArtifactType != "" {
+		detail := map[string]interface{}{"artifactType": manifest.ArtifactType}
+		errMsg := r.errorResponse(RegistryErrorCodeUnsupported, "artifacts have no image config", detail)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	resp, err := DownloadManifest(ctx.Request().Context(), r.dfs, manifest)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	defer resp.Close()
+
+	var imageManifest ImageManifest
+	if err = json.NewDecoder(resp).Decode(&imageManifest); err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeManifestInvalid, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	imageConfig, err := r.getImageConfig(ctx, imageManifest.Config.Digest)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, imageConfig)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// getImageConfig returns the parsed config blob. Config blobs are content addressed, so once parsed,
+// they're cached by their digest until the cache needs the room
+func (r *registry) getImageConfig(ctx echo.Context, digest string) (*ImageConfig, error) {
+	if imageConfig, ok := r.configCache.get(digest); ok {
+		return imageConfig, nil
+	}
+
+	layer, err := r.store.GetLayer(ctx.Request().Context(), digest)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_CONFIG_BLOB: %w", err)
+	}
+
+	resp, err := r.dfs.Download(ctx.Request().Context(), GetLayerIdentifier(layer.UUID))
+	if err != nil {
+		return nil, fmt.Errorf("ERR_DOWNLOAD_CONFIG_BLOB: %w", err)
+	}
+	defer resp.Close()
+
+	imageConfig, err := parseImageConfig(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	r.configCache.add(digest, imageConfig)
+
+	return imageConfig, nil
+}
+
+func parseImageConfig(reader io.Reader) (*ImageConfig, error) {
+	var blob imageConfigBlob
+	if err := json.NewDecoder(reader).Decode(&blob); err != nil {
+		return nil, fmt.Errorf("ERR_PARSE_CONFIG_BLOB: %w", err)
+	}
+
+	exposedPorts := make([]string, 0, len(blob.Config.ExposedPorts))
+	for port := range blob.Config.ExposedPorts {
+		exposedPorts = append(exposedPorts, port)
+	}
+	sort.Strings(exposedPorts)
+
+	return &ImageConfig{
+		Created:      blob.Created,
+		Labels:       blob.Config.Labels,
+		Architecture: blob.Architecture,
+		Os:           blob.Os,
+		Env:          blob.Config.Env,
+		ExposedPorts: exposedPorts,
+	}, nil
+}
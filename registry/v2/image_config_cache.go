@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultImageConfigCacheSize is the number of parsed configs kept unless Registry.ImageConfigCacheSize is set
+const defaultImageConfigCacheSize = 1024
+
+type (
+	// imageConfigCache keeps the most recently read image configs, keyed by config digest. Configs are content
+	// addressed so an entry never goes stale, it's only evicted to make room for another one
+	imageConfigCache struct {
+		mu      *sync.Mutex
+		entries map[string]*list.Element
+		// order has the most recently read entry at the front
+		order      *list.List
+		maxEntries int
+	}
+
+	imageConfigEntry struct {
+		digest string
+		config *ImageConfig
+	}
+)
+
+func newImageConfigCache(maxEntries int) *imageConfigCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultImageConfigCacheSize
+	}
+
+	return &imageConfigCache{
+		mu:         &sync.Mutex{},
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *imageConfigCache) get(digest string) (*ImageConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[digest]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*imageConfigEntry).config, true
+}
+
+// add stores the config, evicting the least recently read one when the cache is full
+func (c *imageConfigCache) add(digest string, config *ImageConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[digest]; ok {
+		elem.Value.(*imageConfigEntry).config = config
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[digest] = c.order.PushFront(&imageConfigEntry{digest: digest, config: config})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*imageConfigEntry).digest)
+	}
+}
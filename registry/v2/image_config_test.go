@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleImageConfig = `{
+	"created": "2022-10-04T21:17:32.123456789Z",
+	"architecture": "arm64",
+	"os": "linux",
+	"config": {
+		"Env": ["PATH=/usr/local/bin:/usr/bin"],
+		"ExposedPorts": {"8080/tcp": {}, "443/tcp": {}},
+		"Labels": {
+			"org.opencontainers.image.source": "https://github.com/containerish/OpenRegistry",
+			"maintainer": "team@openregistry.dev"
+		}
+	},
+	"rootfs": {"type": "layers", "diff_ids": []}
+}`
+
+func TestParseImageConfig(t *testing.T) {
+	imageConfig, err := parseImageConfig(strings.NewReader(sampleImageConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLabels := map[string]string{
+		"org.opencontainers.image.source": "https://github.com/containerish/OpenRegistry",
+		"maintainer":                      "team@openregistry.dev",
+	}
+	if !reflect.DeepEqual(imageConfig.Labels, wantLabels) {
+		t.Errorf("got labels %v, want %v", imageConfig.Labels, wantLabels)
+	}
+	if imageConfig.Architecture != "arm64" || imageConfig.Os != "linux" {
+		t.Errorf("got platform %s/%s, want linux/arm64", imageConfig.Os, imageConfig.Architecture)
+	}
+	if imageConfig.Created.Year() != 2022 {
+		t.Errorf("got created %s", imageConfig.Created)
+	}
+	// the ports are sorted, the config has them in a map
+	if want := []string{"443/tcp", "8080/tcp"}; !reflect.DeepEqual(imageConfig.ExposedPorts, want) {
+		t.Errorf("got exposed ports %v, want %v", imageConfig.ExposedPorts, want)
+	}
+	if len(imageConfig.Env) != 1 {
+		t.Errorf("got env %v", imageConfig.Env)
+	}
+}
+
+func TestParseImageConfigInvalid(t *testing.T) {
+	if _, err := parseImageConfig(strings.NewReader(`{"config": [}`)); err == nil {
+		t.Error("got no error for an invalid config blob")
+	}
+}
+
+func TestImageConfigCacheEviction(t *testing.T) {
+	cache := newImageConfigCache(2)
+	configs := map[string]*ImageConfig{}
+	for i := 0; i < 3; i++ {
+		configs[fmt.Sprintf("sha256:%d", i)] = &ImageConfig{Os: fmt.Sprintf("os-%d", i)}
+	}
+
+	cache.add("sha256:0", configs["sha256:0"])
+	cache.add("sha256:1", configs["sha256:1"])
+	// reading sha256:0 makes sha256:1 the least recently read
+	if _, ok := cache.get("sha256:0"); !ok {
+		t.Fatal("sha256:0 is missing")
+	}
+	cache.add("sha256:2", configs["sha256:2"])
+
+	if _, ok := cache.get("sha256:1"); ok {
+		t.Error("sha256:1 wasn't evicted")
+	}
+	for _, digest := range []string{"sha256:0", "sha256:2"} {
+		if got, ok := cache.get(digest); !ok || got != configs[digest] {
+			t.Errorf("%s: got %v, want %v", digest, got, configs[digest])
+		}
+	}
+	if cache.order.Len() != 2 {
+		t.Errorf("got %d entries, want 2", cache.order.Len())
+	}
+}
+
+func TestImageConfigCacheDefaultSize(t *testing.T) {
+	cache := newImageConfigCache(0)
+	for i := 0; i < defaultImageConfigCacheSize+10; i++ {
+		cache.add(fmt.Sprintf("sha256:%d", i), &ImageConfig{})
+	}
+
+	if cache.order.Len() != defaultImageConfigCacheSize {
+		t.Errorf("got %d entries, want %d", cache.order.Len(), defaultImageConfigCacheSize)
+	}
+}
@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	blobStatusOK        = "ok"
+	blobStatusMissing   = "missing"
+	blobStatusCorrupted = "corrupted"
+)
+
+// VerifyManifest checks that every blob of the image exists, with ?deep=true the blobs are downloaded from the
+// DFS and hashed again. The manifest itself is always hashed again. A manifest list is verified one level deep,
+// only the existence of its manifests is checked
+// GET /v2/<name>/manifests/<reference>/verify?deep=true
+func (r *registry) VerifyManifest(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	ref := ctx.Param("reference")
+
+	deep := false
+	if param := ctx.QueryParam("deep"); param != "" {
+		var err error
+		if deep, err = strconv.ParseBool(param); err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeUnsupported, err.Error(), echo.Map{"deep": param})
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+	}
+
+	manifest, err := r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	report := &types.IntegrityReport{
+		Namespace: namespace,
+		Reference: ref,
+		Digest:    manifest.Digest,
+		Deep:      deep,
+	}
+
+	bz, blob := r.verifyManifestBlob(ctx.Request().Context(), manifest)
+	report.Blobs = append(report.Blobs, blob)
+	if blob.Status == blobStatusOK {
+		report.Blobs = append(report.Blobs, r.verifyReferences(ctx.Request().Context(), namespace, bz, deep)...)
+	}
+
+	report.Intact = true
+	for _, b := range report.Blobs {
+		if b.Status != blobStatusOK {
+			report.Intact = false
+			break
+		}
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, report)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (r *registry) verifyManifestBlob(ctx context.Context, manifest *types.ConfigV2) ([]byte, *types.BlobIntegrity) {
+	blob := &types.BlobIntegrity{Digest: manifest.Digest, Kind: "manifest", Status: blobStatusOK}
+
+	rc, err := DownloadManifest(ctx, r.dfs, manifest)
+	if err != nil {
+		blob.Status, blob.Error = blobStatusMissing, err.Error()
+		return nil, blob
+	}
+	bz, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		blob.Status, blob.Error = blobStatusMissing, err.Error()
+		return nil, blob
+	}
+
+	computed, err := digest.FromReader(digest.AlgorithmOf(manifest.Digest), bytes.NewReader(bz))
+	if err != nil || computed != manifest.Digest {
+		blob.Status, blob.Error = blobStatusCorrupted, fmt.Sprintf("computed digest: %s", computed)
+	}
+
+	return bz, blob
+}
+
+func (r *registry) verifyReferences(
+	ctx context.Context,
+	namespace string,
+	bz []byte,
+	deep bool,
+) []*types.BlobIntegrity {
+	var descriptors struct {
+		Config    *struct{ Digest string }  `json:"config"`
+		Layers    []struct{ Digest string } `json:"layers"`
+		Manifests []struct{ Digest string } `json:"manifests"`
+	}
+	if err := json.Unmarshal(bz, &descriptors); err != nil {
+		return []*types.BlobIntegrity{{Kind: "manifest", Status: blobStatusCorrupted, Error: err.Error()}}
+	}
+
+	var blobs []*types.BlobIntegrity
+	if descriptors.Config != nil {
+		blobs = append(blobs, r.verifyBlob(ctx, descriptors.Config.Digest, "config", deep))
+	}
+	for _, layer := range descriptors.Layers {
+		blobs = append(blobs, r.verifyBlob(ctx, layer.Digest, "layer", deep))
+	}
+	for _, m := range descriptors.Manifests {
+		blob := &types.BlobIntegrity{Digest: m.Digest, Kind: "manifest", Status: blobStatusOK}
+		if _, err := r.store.GetManifestByReference(ctx, namespace, m.Digest); err != nil {
+			blob.Status, blob.Error = blobStatusMissing, err.Error()
+		}
+		blobs = append(blobs, blob)
+	}
+
+	return blobs
+}
+
+func (r *registry) verifyBlob(ctx context.Context, dig, kind string, deep bool) *types.BlobIntegrity {
+	blob := &types.BlobIntegrity{Digest: dig, Kind: kind, Status: blobStatusOK}
+
+	layer, err := r.store.GetLayer(ctx, dig)
+	if err != nil {
+		blob.Status, blob.Error = blobStatusMissing, err.Error()
+		return blob
+	}
+
+	// a layer replaced by its compressed copy is checked through the copy
+	key := GetLayerIdentifier(layer.UUID)
+	compressed := r.compressedLayer(ctx, dig)
+	if compressed != nil {
+		key = GetLayerIdentifier(compressed.UUID)
+	}
+
+	if !deep {
+		if _, err = r.dfs.Metadata(ctx, key); err != nil {
+			blob.Status, blob.Error = blobStatusMissing, err.Error()
+		}
+		return blob
+	}
+
+	rc, err := r.dfs.Download(ctx, key)
+	if err != nil {
+		blob.Status, blob.Error = blobStatusMissing, err.Error()
+		return blob
+	}
+	defer rc.Close()
+
+	var content io.Reader = rc
+	if compressed != nil {
+		decoded, err := decodeLayer(compressed.Encoding, rc)
+		if err != nil {
+			blob.Status, blob.Error = blobStatusCorrupted, err.Error()
+			return blob
+		}
+		defer decoded.Close()
+		content = decoded
+	}
+
+	computed, err := digest.FromReader(digest.AlgorithmOf(dig), content)
+	if err != nil || computed != dig {
+		blob.Status, blob.Error = blobStatusCorrupted, fmt.Sprintf("computed digest: %s", computed)
+	}
+
+	return blob
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// integrityStore holds the manifests of testNamespace by reference, and the layers by digest
+type integrityStore struct {
+	postgres.PersistentStore
+	manifests map[string]*types.ConfigV2
+	layers    map[string]*types.LayerV2
+}
+
+func (s *integrityStore) GetManifestByReference(_ context.Context, _ string, ref string) (*types.ConfigV2, error) {
+	if m, ok := s.manifests[ref]; ok {
+		return m, nil
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (s *integrityStore) GetLayer(_ context.Context, dig string) (*types.LayerV2, error) {
+	if layer, ok := s.layers[dig]; ok {
+		return layer, nil
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (s *integrityStore) GetCompressedLayer(context.Context, string) (*types.CompressedLayer, error) {
+	return nil, postgres.ErrNotFound
+}
+
+// pushTestImage stores an image with a config and two layers, it returns their digests
+func pushTestImage(store *integrityStore, storage *memory.DFS) (config string, layers []string) {
+	blobs := [][]byte{[]byte(`{"architecture":"amd64","os":"linux"}`), []byte("layer one"), []byte("layer two")}
+	for i, blob := range blobs {
+		dig := digest.FromBytes(blob)
+		uuid := fmt.Sprintf("uuid-%d", i)
+		store.layers[dig] = &types.LayerV2{Digest: dig, UUID: uuid, Size: len(blob)}
+		storage.Put(GetLayerIdentifier(uuid), blob)
+		if i == 0 {
+			config = dig
+		} else {
+			layers = append(layers, dig)
+		}
+	}
+
+	manifest := []byte(fmt.Sprintf(
+		`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q},{"digest":%q}]}`,
+		config, layers[0], layers[1],
+	))
+	manifestDigest := digest.FromBytes(manifest)
+	m := &types.ConfigV2{Namespace: testNamespace, Reference: "latest", Digest: manifestDigest}
+	store.manifests["latest"] = m
+	storage.Put(GetManifestContentIdentifier(manifestDigest), manifest)
+
+	return config, layers
+}
+
+func verify(t *testing.T, store *integrityStore, storage *memory.DFS, query string) (int, *types.IntegrityReport) {
+	t.Helper()
+
+	r := newTestRegistry(store, storage)
+	ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/manifests/latest/verify"+query, testNamespace)
+	ctx.SetParamNames("username", "imagename", "reference")
+	ctx.SetParamValues("johndoe", "alpine", "latest")
+	if err := r.VerifyManifest(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+
+	var report types.IntegrityReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, &report
+}
+
+func blobStatuses(report *types.IntegrityReport) map[string]string {
+	statuses := map[string]string{}
+	for _, b := range report.Blobs {
+		statuses[b.Digest] = b.Status
+	}
+	return statuses
+}
+
+func newIntegrityStore() *integrityStore {
+	return &integrityStore{manifests: map[string]*types.ConfigV2{}, layers: map[string]*types.LayerV2{}}
+}
+
+func TestVerifyIntactImage(t *testing.T) {
+	for _, query := range []string{"", "?deep=true"} {
+		store, storage := newIntegrityStore(), memory.New()
+		pushTestImage(store, storage)
+
+		code, report := verify(t, store, storage, query)
+		if code != http.StatusOK {
+			t.Fatalf("%q: got status %d, want 200", query, code)
+		}
+		if !report.Intact || len(report.Blobs) != 4 {
+			t.Errorf("%q: got intact %t with %d blobs, want an intact image with 4 blobs",
+				query, report.Intact, len(report.Blobs))
+		}
+		for dig, status := range blobStatuses(report) {
+			if status != blobStatusOK {
+				t.Errorf("%q: got status %s for %s, want ok", query, status, dig)
+			}
+		}
+	}
+}
+
+func TestVerifyMissingLayer(t *testing.T) {
+	// the layer object is gone from the DFS
+	store, storage := newIntegrityStore(), memory.New()
+	config, layers := pushTestImage(store, storage)
+	if err := storage.DeleteObject(context.Background(), GetLayerIdentifier(store.layers[layers[1]].UUID)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, report := verify(t, store, storage, "")
+	statuses := blobStatuses(report)
+	if report.Intact || statuses[layers[1]] != blobStatusMissing {
+		t.Errorf("got intact %t and status %s for the deleted layer, want it missing", report.Intact, statuses[layers[1]])
+	}
+	if statuses[config] != blobStatusOK || statuses[layers[0]] != blobStatusOK {
+		t.Errorf("got statuses %v, want the other blobs ok", statuses)
+	}
+
+	// the layer isn't in the store either
+	delete(store.layers, layers[0])
+	_, report = verify(t, store, storage, "")
+	if statuses = blobStatuses(report); statuses[layers[0]] != blobStatusMissing {
+		t.Errorf("got status %s for the layer missing from the store, want missing", statuses[layers[0]])
+	}
+}
+
+func TestVerifyCorruptedLayer(t *testing.T) {
+	store, storage := newIntegrityStore(), memory.New()
+	_, layers := pushTestImage(store, storage)
+	storage.Put(GetLayerIdentifier(store.layers[layers[0]].UUID), []byte("bit rot"))
+
+	// only the deep check downloads the layer
+	_, report := verify(t, store, storage, "")
+	if !report.Intact {
+		t.Errorf("got the image not intact without a deep check: %+v", blobStatuses(report))
+	}
+
+	_, report = verify(t, store, storage, "?deep=true")
+	if status := blobStatuses(report)[layers[0]]; report.Intact || status != blobStatusCorrupted {
+		t.Errorf("got intact %t and status %s for the layer, want it corrupted", report.Intact, status)
+	}
+}
+
+func TestVerifyUnknownManifest(t *testing.T) {
+	code, _ := verify(t, newIntegrityStore(), memory.New(), "")
+	if code != http.StatusNotFound {
+		t.Errorf("got status %d, want 404", code)
+	}
+
+	store, storage := newIntegrityStore(), memory.New()
+	pushTestImage(store, storage)
+	if code, _ = verify(t, store, storage, "?deep=maybe"); code != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid deep param, want 400", code)
+	}
+}
@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+)
+
+var (
+	errConfigBlobUnknown = errors.New("config blob unknown to registry")
+	errConfigSizeInvalid = errors.New("config size does not match the size of the config blob")
+)
+
+// imageSize checks that the config blob of an image manifest was pushed with the size the manifest lists, and
+// returns the size of the image: its layers and config. Manifest lists have no config and a size of 0, the empty
+// config of the OCI artifacts doesn't have to be pushed
+func (r *registry) imageSize(ctx context.Context, manifest *ImageManifest) (int, error) {
+	if manifest.Config.Digest == "" {
+		return 0, nil
+	}
+
+	size := manifest.Config.Size
+	if !isEmptyConfig(manifest.Config) {
+		config, err := r.store.GetLayer(ctx, manifest.Config.Digest)
+		if errors.Is(err, postgres.ErrNotFound) {
+			return 0, fmt.Errorf("%w: %s", errConfigBlobUnknown, manifest.Config.Digest)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if config.Size != manifest.Config.Size {
+			return 0, fmt.Errorf("%w: expected %d, got %d", errConfigSizeInvalid, manifest.Config.Size, config.Size)
+		}
+	}
+
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+
+	return size, nil
+}
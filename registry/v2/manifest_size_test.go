@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// layeredManifest is an OCI image manifest with the config and a layer of each of the sizes
+func layeredManifest(configDigest string, configSize int, layerSizes ...int) []byte {
+	layers := ""
+	for i, size := range layerSizes {
+		if i > 0 {
+			layers += ","
+		}
+		layers += fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":%q,"size":%d}`,
+			digest.FromBytes([]byte(fmt.Sprintf("layer %d", i))), size)
+	}
+
+	return []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[%s]}`,
+		mediaTypeOCIManifest, configDigest, configSize, layers))
+}
+
+func TestPushedManifestSize(t *testing.T) {
+	configDigest := digest.FromBytes([]byte(`{"architecture":"amd64","os":"linux"}`))
+
+	tests := []struct {
+		name        string
+		contentType string
+		content     []byte
+		// storedConfigSize is the size of the config blob in the store, no config blob is stored when it's zero
+		storedConfigSize int
+		wantStatus       int
+		wantCode         string
+		wantSize         int
+		wantConfigSize   int
+	}{
+		{
+			name:             "image",
+			contentType:      mediaTypeOCIManifest,
+			content:          layeredManifest(configDigest, 1469, 2811969, 512, 33),
+			storedConfigSize: 1469,
+			wantStatus:       http.StatusCreated,
+			wantSize:         1469 + 2811969 + 512 + 33,
+			wantConfigSize:   1469,
+		},
+		{
+			name:             "image without layers",
+			contentType:      mediaTypeOCIManifest,
+			content:          layeredManifest(configDigest, 1469),
+			storedConfigSize: 1469,
+			wantStatus:       http.StatusCreated,
+			wantSize:         1469,
+			wantConfigSize:   1469,
+		},
+		{
+			// the empty config doesn't have to be pushed
+			name:           "artifact",
+			contentType:    mediaTypeOCIManifest,
+			content:        artifactManifest("application/vnd.example.sbom.v1+json", "application/vnd.example.sbom.v1+json"),
+			wantStatus:     http.StatusCreated,
+			wantSize:       emptyConfigSize + 4,
+			wantConfigSize: emptyConfigSize,
+		},
+		{
+			name:        "index",
+			contentType: MediaTypeOCIImageIndex,
+			content:     []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[]}`, MediaTypeOCIImageIndex)),
+			wantStatus:  http.StatusCreated,
+		},
+		{
+			name:        "config not pushed",
+			contentType: mediaTypeOCIManifest,
+			content:     layeredManifest(configDigest, 1469, 100),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    RegistryErrorCodeManifestBlobUnknown,
+		},
+		{
+			name:             "config size mismatch",
+			contentType:      mediaTypeOCIManifest,
+			content:          layeredManifest(configDigest, 1000, 100),
+			storedConfigSize: 1469,
+			wantStatus:       http.StatusBadRequest,
+			wantCode:         RegistryErrorCodeManifestInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPushStore()
+			if tt.storedConfigSize > 0 {
+				store.layers[configDigest] = &types.LayerV2{Digest: configDigest, Size: tt.storedConfigSize}
+			}
+			r := newPushRegistry(t, store, memory.New())
+
+			rec := pushManifest(t, r, "v1", tt.contentType, tt.content)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var errs RegistryErrors
+				if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+					t.Fatal(err)
+				}
+				if len(errs.Errors) != 1 || errs.Errors[0].Code != tt.wantCode {
+					t.Errorf("got errors %+v, want %s", errs.Errors, tt.wantCode)
+				}
+				return
+			}
+
+			// the tag and the digest reference are stored with the same sizes
+			for _, ref := range []string{"v1", digest.FromBytes(tt.content)} {
+				stored, ok := store.manifests[ref]
+				if !ok {
+					t.Fatalf("%s: the manifest wasn't stored", ref)
+				}
+				if stored.Size != tt.wantSize || stored.ConfigSize != tt.wantConfigSize {
+					t.Errorf("%s: got size %d and config size %d, want %d and %d",
+						ref, stored.Size, stored.ConfigSize, tt.wantSize, tt.wantConfigSize)
+				}
+				if (stored.ConfigDigest != "") != (tt.wantConfigSize > 0) {
+					t.Errorf("%s: got config digest %q", ref, stored.ConfigDigest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"context"
+	"io"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	"github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// storeManifest uploads the manifest to its content key and returns its DFS link. A manifest which is already
+// stored, e.g. pushed to another repository, isn't uploaded again
+func (r *registry) storeManifest(ctx context.Context, dig string, bz []byte) (string, error) {
+	key := GetManifestContentIdentifier(dig)
+	if exists, err := r.dfs.Exists(ctx, key); err == nil && exists {
+		metadata, err := r.dfs.Metadata(ctx, key)
+		if err == nil {
+			return metadata.Skylink, nil
+		}
+	}
+
+	return r.dfs.Upload(ctx, key, dig, bz)
+}
+
+// DownloadManifest reads the manifest from its content key, the manifests pushed before they were stored by digest
+// are read from the key of their repository and reference
+func DownloadManifest(ctx context.Context, storage dfs.DFS, manifest *types.ConfigV2) (io.ReadCloser, error) {
+	rc, err := storage.Download(ctx, GetManifestContentIdentifier(manifest.Digest))
+	if err == nil {
+		return rc, nil
+	}
+
+	return storage.Download(ctx, GetManifestIdentifier(manifest.Namespace, manifest.Reference))
+}
+
+// manifestMetadata is the DFS metadata of the manifest, read from the same key as DownloadManifest reads it from
+func (r *registry) manifestMetadata(ctx context.Context, manifest *types.ConfigV2) (*skynet.Metadata, error) {
+	key := GetManifestContentIdentifier(manifest.Digest)
+	if exists, err := r.dfs.Exists(ctx, key); err != nil || !exists {
+		key = GetManifestIdentifier(manifest.Namespace, manifest.Reference)
+	}
+
+	return r.dfs.Metadata(ctx, key)
+}
+
+// ManifestObjectKeys returns the DFS keys of a deleted manifest. The content key is only returned once no
+// repository uses the manifest anymore, so it must run in the txn of the delete
+func ManifestObjectKeys(
+	ctx context.Context, store postgres.RegistryStore, txn pgx.Tx, namespace, digest string,
+) ([]string, error) {
+	keys := []string{GetManifestIdentifier(namespace, digest)}
+
+	refs, err := store.GetManifestReferenceCount(ctx, txn, digest)
+	if err != nil {
+		return nil, err
+	}
+	if refs == 0 {
+		keys = append(keys, GetManifestContentIdentifier(digest))
+	}
+
+	return keys, nil
+}
+
+// TagObjectKeys returns the DFS keys of deleted tags, the manifests pushed before they were stored by digest are
+// stored at the key of the tag they were pushed with. Nothing reads that key once the tag is gone
+func TagObjectKeys(namespace string, tags ...string) []string {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, GetManifestIdentifier(namespace, tag))
+	}
+
+	return keys
+}
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"strings"
+
+	"github.com/containerish/OpenRegistry/registry/v2/schema"
+)
+
+// disallowedMediaType returns the first media type of the manifest, its artifactType included, which isn't allowed by
+// Registry.AllowedMediaTypes, or an empty string when they're all allowed. The sub-manifests of an index are checked
+// too
+func (r *registry) disallowedMediaType(contentType string, manifest *ImageManifest, index *schema.Index) string {
+	allowed := r.config.Registry.AllowedMediaTypes
+	if len(allowed) == 0 {
+		return ""
+	}
+
+	mediaTypes := []string{
+		mediaTypeOf(contentType), manifest.MediaType, manifest.ArtifactType, manifest.Config.MediaType,
+	}
+	for _, layer := range manifest.Layers {
+		mediaTypes = append(mediaTypes, layer.MediaType)
+	}
+	if index != nil {
+		for _, m := range index.Manifests {
+			mediaTypes = append(mediaTypes, m.MediaType)
+		}
+	}
+
+	for _, mediaType := range mediaTypes {
+		if mediaType != "" && !mediaTypeAllowed(allowed, mediaType) {
+			return mediaType
+		}
+	}
+
+	return ""
+}
+
+func mediaTypeAllowed(allowed []string, mediaType string) bool {
+	for _, a := range allowed {
+		if prefix := strings.TrimSuffix(a, "*"); prefix != a {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+			continue
+		}
+		if a == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mediaTypeOf drops the parameters of a Content-Type header
+func mediaTypeOf(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	return strings.TrimSpace(contentType)
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/registry/v2/schema"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// pushStore keeps the manifests pushed to it by reference, so that they can be pulled back
+type pushStore struct {
+	*integrityStore
+	commits int
+	aborts  int
+}
+
+func newPushStore() *pushStore {
+	return &pushStore{integrityStore: newIntegrityStore()}
+}
+
+func (s *pushStore) NewTxn(context.Context) (pgx.Tx, error) { return nil, nil }
+
+func (s *pushStore) Commit(context.Context, pgx.Tx) error {
+	s.commits++
+	return nil
+}
+
+func (s *pushStore) Abort(context.Context, pgx.Tx) error {
+	s.aborts++
+	return nil
+}
+
+func (s *pushStore) AddNamespaceLayers(context.Context, pgx.Tx, string, []string) error { return nil }
+
+func (s *pushStore) SetManifest(context.Context, pgx.Tx, *types.ImageManifestV2) error { return nil }
+
+func (s *pushStore) SetConfig(_ context.Context, _ pgx.Tx, cfg types.ConfigV2) error {
+	s.manifests[cfg.Reference] = &cfg
+	return nil
+}
+
+// newPushRegistry has what PushManifest needs on top of newTestRegistry
+func newPushRegistry(t *testing.T, store *pushStore, storage *memory.DFS) *registry {
+	t.Helper()
+
+	schemas, err := schema.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRegistry(store, storage)
+	r.schemas = schemas
+	r.verifier = NewNoopVerifier()
+	r.webhooks = &webhookRecorder{}
+	return r
+}
+
+func pushManifest(t *testing.T, r *registry, ref, contentType string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	ctx, rec := manifestContext(http.MethodPut, ref)
+	ctx.SetRequest(httptest.NewRequest(http.MethodPut, "/v2/"+testNamespace+"/manifests/"+ref, bytes.NewReader(content)))
+	ctx.Request().Header.Set("Content-Type", contentType)
+	if err := r.PushManifest(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// artifactManifest is an OCI artifact with the empty config and a single layer
+func artifactManifest(artifactType, layerMediaType string) []byte {
+	return []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"artifactType":%q,`+
+		`"config":{"mediaType":%q,"digest":%q,"size":%d},`+
+		`"layers":[{"mediaType":%q,"digest":%q,"size":4}]}`,
+		mediaTypeOCIManifest, artifactType, MediaTypeOCIEmpty, emptyConfigDigest, emptyConfigSize,
+		layerMediaType, digest.FromBytes([]byte("sbom"))))
+}
+
+func TestAllowedMediaTypes(t *testing.T) {
+	const sbom = "application/vnd.example.sbom.v1+json"
+
+	tests := []struct {
+		name         string
+		allowed      []string
+		artifactType string
+		layerType    string
+		wantStatus   int
+		wantRejected string
+	}{
+		{
+			name:         "permissive by default",
+			artifactType: "application/vnd.example.anything",
+			layerType:    "application/octet-stream",
+			wantStatus:   http.StatusCreated,
+		},
+		{
+			name:         "allowed artifact",
+			allowed:      []string{mediaTypeOCIManifest, MediaTypeOCIEmpty, sbom},
+			artifactType: sbom,
+			layerType:    sbom,
+			wantStatus:   http.StatusCreated,
+		},
+		{
+			name:         "allowed by prefix",
+			allowed:      []string{"application/vnd.oci.*", "application/vnd.example.*"},
+			artifactType: sbom,
+			layerType:    sbom,
+			wantStatus:   http.StatusCreated,
+		},
+		{
+			name:         "disallowed artifact type",
+			allowed:      []string{mediaTypeOCIManifest, MediaTypeOCIEmpty, sbom},
+			artifactType: "application/vnd.example.malware",
+			layerType:    sbom,
+			wantStatus:   http.StatusBadRequest,
+			wantRejected: "application/vnd.example.malware",
+		},
+		{
+			name:         "disallowed layer type",
+			allowed:      []string{mediaTypeOCIManifest, MediaTypeOCIEmpty, sbom},
+			artifactType: sbom,
+			layerType:    "application/octet-stream",
+			wantStatus:   http.StatusBadRequest,
+			wantRejected: "application/octet-stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPushStore()
+			r := newPushRegistry(t, store, memory.New())
+			r.config.Registry.AllowedMediaTypes = tt.allowed
+
+			rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, artifactManifest(tt.artifactType, tt.layerType))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusCreated {
+				if _, ok := store.manifests["v1"]; !ok {
+					t.Error("the manifest wasn't stored")
+				}
+				return
+			}
+
+			var errs RegistryErrors
+			if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			if len(errs.Errors) != 1 || errs.Errors[0].Code != RegistryErrorCodeManifestInvalid {
+				t.Fatalf("got errors %+v, want MANIFEST_INVALID", errs.Errors)
+			}
+			if errs.Errors[0].Detail["mediaType"] != tt.wantRejected {
+				t.Errorf("got detail %v, want the rejected media type %s", errs.Errors[0].Detail, tt.wantRejected)
+			}
+			if len(store.manifests) != 0 || store.commits != 0 {
+				t.Errorf("got %d manifests and %d commits, want the push rejected", len(store.manifests), store.commits)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxRepositoryLabels bounds the cardinality of the repository label, the repositories seen after the first
+	// maxRepositoryLabels are reported as otherRepositoryLabel
+	maxRepositoryLabels  = 100
+	otherRepositoryLabel = "other"
+
+	transferKindBlob      = "blob"
+	transferKindManifest  = "manifest"
+	transferDirectionPush = "push"
+	transferDirectionPull = "pull"
+)
+
+// transferMetrics holds the histograms for the push and pull lifecycle, on top of the per-endpoint metrics
+type transferMetrics struct {
+	mu              sync.Mutex
+	repositories    map[string]struct{}
+	uploadDuration  *prometheus.HistogramVec
+	transferLatency *prometheus.HistogramVec
+	transferSize    *prometheus.HistogramVec
+}
+
+func newTransferMetrics() *transferMetrics {
+	return &transferMetrics{
+		repositories: make(map[string]struct{}),
+		uploadDuration: registerHistogram(prometheus.HistogramOpts{
+			Namespace: "OpenRegistry",
+			Subsystem: "registry",
+			Name:      "upload_session_duration_seconds",
+			Help:      "Time from the start of a blob upload session to its completion",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, []string{"repository"}),
+		transferLatency: registerHistogram(prometheus.HistogramOpts{
+			Namespace: "OpenRegistry",
+			Subsystem: "registry",
+			Name:      "transfer_duration_seconds",
+			Help:      "Time spent serving a blob or manifest push or pull",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"repository", "kind", "direction"}),
+		transferSize: registerHistogram(prometheus.HistogramOpts{
+			Namespace: "OpenRegistry",
+			Subsystem: "registry",
+			Name:      "transfer_size_bytes",
+			Help:      "Size of the blobs and manifests pushed or pulled",
+			Buckets:   prometheus.ExponentialBuckets(512, 4, 12),
+		}, []string{"repository", "kind", "direction"}),
+	}
+}
+
+func registerHistogram(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(opts, labels)
+	if err := prometheus.Register(histogram); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(*prometheus.HistogramVec); ok {
+				return existing
+			}
+		}
+		color.Red("error registering registry metric %s: %s", opts.Name, err)
+	}
+
+	return histogram
+}
+
+// repositoryLabel returns the label value for namespace, only the first maxRepositoryLabels repositories get one
+func (m *transferMetrics) repositoryLabel(namespace string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.repositories[namespace]; ok {
+		return namespace
+	}
+	if len(m.repositories) >= maxRepositoryLabels {
+		return otherRepositoryLabel
+	}
+	m.repositories[namespace] = struct{}{}
+	return namespace
+}
+
+// observeUploadSession records the duration of an upload session, the sessions without a start time are skipped
+func (m *transferMetrics) observeUploadSession(namespace string, startedAt time.Time) {
+	if startedAt.IsZero() {
+		return
+	}
+
+	m.uploadDuration.WithLabelValues(m.repositoryLabel(namespace)).Observe(time.Since(startedAt).Seconds())
+}
+
+// observeTransfer records the duration of the request, from types.HandlerStartTime, and the bytes transferred
+func (m *transferMetrics) observeTransfer(ctx echo.Context, namespace, kind, direction string, size int64) {
+	repository := m.repositoryLabel(namespace)
+	if start, ok := ctx.Get(types.HandlerStartTime).(time.Time); ok {
+		m.transferLatency.WithLabelValues(repository, kind, direction).Observe(time.Since(start).Seconds())
+	}
+	m.transferSize.WithLabelValues(repository, kind, direction).Observe(float64(size))
+}
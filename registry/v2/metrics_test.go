@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrape returns the samples served by the metrics endpoint, keyed by the name and labels of the sample
+func scrape(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	samples := map[string]float64{}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndex(line, " ")
+		if strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid sample %q: %s", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestTransferHistogramsAfterPush(t *testing.T) {
+	const (
+		uploadCount = `OpenRegistry_registry_upload_session_duration_seconds_count{repository="johndoe/alpine"}`
+		pushCount   = `OpenRegistry_registry_transfer_duration_seconds_count{direction="push",kind="blob",` +
+			`repository="johndoe/alpine"}`
+		pushSize = `OpenRegistry_registry_transfer_size_bytes_sum{direction="push",kind="blob",` +
+			`repository="johndoe/alpine"}`
+	)
+
+	r := newTestRegistry(newUploadStore(), memory.New())
+	before := scrape(t)
+
+	layer := []byte("the layer pushed in two chunks")
+	uuid := startUpload(t, r, testNamespace, "")
+	patchChunk(t, r, uuid, 0, layer[:10])
+	patchChunk(t, r, uuid, 10, layer[10:])
+	if code := completeUpload(t, r, uuid, digest.FromBytes(layer), nil); code != http.StatusCreated {
+		t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+	}
+
+	after := scrape(t)
+	if got := after[uploadCount] - before[uploadCount]; got != 1 {
+		t.Errorf("got %v more upload sessions observed, want 1", got)
+	}
+	if got := after[pushCount] - before[pushCount]; got != 1 {
+		t.Errorf("got %v more blob pushes observed, want 1", got)
+	}
+	if got := after[pushSize] - before[pushSize]; got != float64(len(layer)) {
+		t.Errorf("got %v more bytes pushed, want %d", got, len(layer))
+	}
+}
@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRepositoryNameLength - the name, including the slashes, must be less than 256 chars
+const maxRepositoryNameLength = 255
+
+// validateRepositoryName checks the name against the OCI grammar, i.e. path components matching
+// [a-z0-9]+((\.|_|__|-+)[a-z0-9]+)* separated by forward slashes
+func validateRepositoryName(name string) error {
+	if len(name) > maxRepositoryNameLength {
+		return fmt.Errorf("repository name must be at most %d characters long", maxRepositoryNameLength)
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if !types.IsValidNamespaceComponent(component) {
+			return fmt.Errorf("invalid repository name component: %q", component)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRepositoryName runs before every /v2/<name>/ handler (and the ACL), the requests for names which
+// don't follow the OCI grammar are rejected with 400 NAME_INVALID
+func (r *registry) ValidateRepositoryName() echo.MiddlewareFunc {
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			namespace := types.Namespace(ctx)
+			if err := validateRepositoryName(namespace); err != nil {
+				ctx.Set(types.HandlerStartTime, time.Now())
+				errMsg := r.errorResponse(RegistryErrorCodeNameInvalid, err.Error(), echo.Map{
+					"name": namespace,
+				})
+				echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+				r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+				return echoErr
+			}
+
+			return hf(ctx)
+		}
+	}
+}
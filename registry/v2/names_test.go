@@ -0,0 +1,31 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRepositoryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "johndoe/alpine"},
+		{name: "johndoe/team__a/my--app"},
+		{name: "johndoe/group/sub/image"},
+		{name: "johndoe/" + strings.Repeat("a", maxRepositoryNameLength-len("johndoe/"))},
+		{name: "johndoe/" + strings.Repeat("a", maxRepositoryNameLength), wantErr: true},
+		{name: "johndoe/Alpine", wantErr: true},
+		{name: "johndoe//alpine", wantErr: true},
+		{name: "johndoe/alpine/", wantErr: true},
+		{name: "johndoe/my___app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRepositoryName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
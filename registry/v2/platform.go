@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// isManifestList reports whether the media type is a Docker manifest list or an OCI image index
+func isManifestList(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIImageIndex
+}
+
+// resolvePlatformDigest picks the digest of the sub-manifest matching platform (os/arch[/variant])
+// from a manifest list. Variant is only compared when the client asks for one.
+func resolvePlatformDigest(manifestList []byte, platform string) (string, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("ERR_INVALID_PLATFORM: platform must be in os/arch[/variant] format")
+	}
+
+	var ml ManifestList
+	if err := json.Unmarshal(manifestList, &ml); err != nil {
+		return "", fmt.Errorf("ERR_PARSE_MANIFEST_LIST: %w", err)
+	}
+
+	for _, m := range ml.Manifests {
+		if m.Platform.Os != parts[0] || m.Platform.Architecture != parts[1] {
+			continue
+		}
+
+		if len(parts) == 3 && m.Platform.Variant != parts[2] {
+			continue
+		}
+
+		return m.Digest, nil
+	}
+
+	return "", fmt.Errorf("ERR_PLATFORM_NOT_FOUND: no manifest found for platform: %s", platform)
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+const testManifestList = `{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+	"manifests": [
+		{"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}},
+		{"digest": "sha256:armv7", "platform": {"os": "linux", "architecture": "arm", "variant": "v7"}},
+		{"digest": "sha256:arm64", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}}
+	]
+}`
+
+func TestResolvePlatformDigest(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  string
+	}{
+		{platform: "linux/arm64", want: "sha256:arm64"},
+		{platform: "linux/arm64/v8", want: "sha256:arm64"},
+		{platform: "linux/amd64", want: "sha256:amd64"},
+		{platform: "linux/arm/v7", want: "sha256:armv7"},
+		{platform: "linux/arm/v6", wantErr: "ERR_PLATFORM_NOT_FOUND"},
+		{platform: "windows/amd64", wantErr: "ERR_PLATFORM_NOT_FOUND"},
+		{platform: "linux/s390x", wantErr: "ERR_PLATFORM_NOT_FOUND"},
+		{platform: "linux", wantErr: "ERR_INVALID_PLATFORM"},
+		{platform: "linux/arm64/v8/extra", wantErr: "ERR_INVALID_PLATFORM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := resolvePlatformDigest([]byte(testManifestList), tt.platform)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("got %s and error %v, want error %s", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %s and error %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+var errQuotaExceeded = errors.New("ERR_QUOTA_EXCEEDED") //nolint
+
+type (
+	QuotaUsage struct {
+		Used int64 `json:"used"`
+		// Limit is 0 when there's no limit
+		Limit int64 `json:"limit"`
+	}
+
+	Quota struct {
+		Namespace QuotaUsage `json:"namespace"`
+		User      QuotaUsage `json:"user"`
+	}
+)
+
+// GetQuota
+// GET /v2/<name>/quota
+func (r *registry) GetQuota(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	username := ctx.Param("username")
+	namespace := types.Namespace(ctx)
+	namespaceLimit, userLimit := r.quotaLimits(namespace)
+
+	nsUsed, err := r.store.GetNamespaceUsage(ctx.Request().Context(), nil, namespace)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	userUsed, err := r.store.GetUserUsage(ctx.Request().Context(), nil, username)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, Quota{
+		Namespace: QuotaUsage{Used: nsUsed, Limit: namespaceLimit},
+		User:      QuotaUsage{Used: userUsed, Limit: userLimit},
+	})
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (r *registry) quotaLimits(namespace string) (namespaceLimit int64, userLimit int64) {
+	quota := r.config.Quota
+	if quota == nil {
+		return 0, 0
+	}
+
+	namespaceLimit = quota.DefaultNamespaceLimit
+	if limit, ok := quota.Namespaces[namespace]; ok {
+		namespaceLimit = limit
+	}
+
+	userLimit = quota.DefaultUserLimit
+	if limit, ok := quota.Users[strings.Split(namespace, "/")[0]]; ok {
+		userLimit = limit
+	}
+
+	return namespaceLimit, userLimit
+}
+
+// chargeQuota records the layers (which must be stored already, e.g. by the same txn) as stored in namespace, and
+// returns errQuotaExceeded if the namespace or its user now use more than their quota. A layer already stored in the
+// namespace isn't counted twice. The quotas are locked until txn ends, so the concurrent pushes to a namespace (or
+// to the repositories of a user) are checked one after the other, each seeing the layers the others stored
+func (r *registry) chargeQuota(ctx context.Context, txn pgx.Tx, namespace string, digests []string) error {
+	namespaceLimit, userLimit := r.quotaLimits(namespace)
+	username := strings.Split(namespace, "/")[0]
+
+	// the namespace is always locked before its user, so that two pushes can't wait for each other
+	if namespaceLimit > 0 {
+		if err := r.store.LockQuota(ctx, txn, namespace); err != nil {
+			return err
+		}
+	}
+	if userLimit > 0 {
+		if err := r.store.LockQuota(ctx, txn, username); err != nil {
+			return err
+		}
+	}
+
+	if err := r.store.AddNamespaceLayers(ctx, txn, namespace, digests); err != nil {
+		return err
+	}
+
+	if namespaceLimit > 0 {
+		used, err := r.store.GetNamespaceUsage(ctx, txn, namespace)
+		if err != nil {
+			return err
+		}
+
+		if used > namespaceLimit {
+			return fmt.Errorf("%w: namespace %s would use %d bytes, limit is %d bytes",
+				errQuotaExceeded, namespace, used, namespaceLimit)
+		}
+	}
+
+	if userLimit > 0 {
+		used, err := r.store.GetUserUsage(ctx, txn, username)
+		if err != nil {
+			return err
+		}
+
+		if used > userLimit {
+			return fmt.Errorf("%w: user %s would use %d bytes, limit is %d bytes",
+				errQuotaExceeded, username, used, userLimit)
+		}
+	}
+
+	return nil
+}
+
+// quotaErrorResponse is 403 DENIED when the quota is exceeded, any other error is the store failing
+func (r *registry) quotaErrorResponse(ctx echo.Context, err error) error {
+	status, code, reason := http.StatusInternalServerError, RegistryErrorCodeUnknown, "quota check failed"
+	if errors.Is(err, errQuotaExceeded) {
+		status, code, reason = http.StatusForbidden, RegistryErrorCodeDenied, "quota exceeded"
+	}
+
+	errMsg := r.errorResponse(code, err.Error(), echo.Map{
+		"reason": reason,
+	})
+	echoErr := ctx.JSONBlob(status, errMsg)
+	r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+	return echoErr
+}
@@ -0,0 +1,197 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// quotaStore records the quota locks taken, in order
+type quotaStore struct {
+	*uploadStore
+	locks []string
+}
+
+func (s *quotaStore) LockQuota(_ context.Context, _ pgx.Tx, key string) error {
+	s.locks = append(s.locks, key)
+	return nil
+}
+
+func (s *quotaStore) GetNamespaceUsage(_ context.Context, _ pgx.Tx, namespace string) (int64, error) {
+	return s.usage(func(ns string) bool { return ns == namespace }), nil
+}
+
+func (s *quotaStore) GetUserUsage(_ context.Context, _ pgx.Tx, username string) (int64, error) {
+	return s.usage(func(ns string) bool { return strings.HasPrefix(ns, username+"/") }), nil
+}
+
+// usage sums the layers stored in the namespaces matching match, once each
+func (s *quotaStore) usage(match func(namespace string) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digests := map[string]bool{}
+	for namespace, stored := range s.namespaceLayers {
+		for dig := range stored {
+			digests[dig] = digests[dig] || match(namespace)
+		}
+	}
+
+	var used int64
+	for dig, counted := range digests {
+		if counted {
+			used += int64(s.layers[dig].Size)
+		}
+	}
+	return used
+}
+
+func (s *quotaStore) GetLayer(_ context.Context, dig string) (*types.LayerV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	layer, ok := s.layers[dig]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return layer, nil
+}
+
+func (s *quotaStore) GetLayerReferenceCount(context.Context, pgx.Tx, string) (int64, error) {
+	return 0, nil
+}
+
+// DeleteLayerV2 drops the layer from the namespaces it's stored in, like the foreign key does
+func (s *quotaStore) DeleteLayerV2(_ context.Context, _ pgx.Tx, dig string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.layers, dig)
+	for _, stored := range s.namespaceLayers {
+		delete(stored, dig)
+	}
+	return nil
+}
+
+func (s *quotaStore) GetCompressedLayer(context.Context, string) (*types.CompressedLayer, error) {
+	return nil, postgres.ErrNotFound
+}
+
+func newQuotaRegistry(quota *config.Quota) (*registry, *quotaStore) {
+	store := &quotaStore{uploadStore: newUploadStore()}
+	r := newTestRegistry(store, memory.New())
+	r.config.Quota = quota
+
+	return r, store
+}
+
+// pushLayer uploads the layer to namespace with a POST and a PUT, and returns the status and the registry error code
+func pushLayer(t *testing.T, r *registry, namespace string, layer []byte) (int, string) {
+	t.Helper()
+
+	ctx, rec := newTestContext(http.MethodPost, "/v2/"+namespace+"/blobs/uploads/", namespace)
+	if err := r.StartUpload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d starting the upload, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	ctx, rec = uploadContext(http.MethodPut, namespace, rec.Header().Get("Docker-Upload-UUID"), layer)
+	ctx.QueryParams().Set("digest", digest.FromBytes(layer))
+	if err := r.CompleteUpload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs RegistryErrors
+	if rec.Code != http.StatusCreated {
+		_ = json.Unmarshal(rec.Body.Bytes(), &errs)
+	}
+	if len(errs.Errors) > 0 {
+		return rec.Code, errs.Errors[0].Code
+	}
+	return rec.Code, ""
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	const namespace = "johndoe/alpine"
+	r, store := newQuotaRegistry(&config.Quota{Namespaces: map[string]int64{namespace: 30}})
+	first, second, third := bytes.Repeat([]byte("a"), 20), bytes.Repeat([]byte("b"), 10), []byte("c")
+
+	if code, _ := pushLayer(t, r, namespace, first); code != http.StatusCreated {
+		t.Fatalf("got status %d for a push under the limit, want %d", code, http.StatusCreated)
+	}
+	// the layer is already stored in the namespace, pushing it again doesn't use more storage
+	if code, _ := pushLayer(t, r, namespace, first); code != http.StatusCreated {
+		t.Fatalf("got status %d pushing a stored layer again, want %d", code, http.StatusCreated)
+	}
+	if code, _ := pushLayer(t, r, namespace, second); code != http.StatusCreated {
+		t.Fatalf("got status %d for a push up to the limit, want %d", code, http.StatusCreated)
+	}
+
+	code, errCode := pushLayer(t, r, namespace, third)
+	if code != http.StatusForbidden || errCode != RegistryErrorCodeDenied {
+		t.Fatalf("got status %d and code %s for a push over the limit, want %d and %s",
+			code, errCode, http.StatusForbidden, RegistryErrorCodeDenied)
+	}
+	if _, ok := store.layers[digest.FromBytes(third)]; ok {
+		t.Error("the layer over the limit was stored")
+	}
+	if used, _ := store.GetNamespaceUsage(context.Background(), nil, namespace); used != 30 {
+		t.Errorf("got %d bytes used after the denied push, want 30", used)
+	}
+
+	// deleting a layer frees its storage
+	ctx, rec := newTestContext(http.MethodDelete, "/v2/"+namespace+"/blobs/"+digest.FromBytes(second), namespace)
+	ctx.SetParamNames("username", "imagename", "digest")
+	ctx.SetParamValues("johndoe", "alpine", digest.FromBytes(second))
+	if err := r.DeleteLayer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d deleting the layer, want %d", rec.Code, http.StatusAccepted)
+	}
+	if code, _ := pushLayer(t, r, namespace, third); code != http.StatusCreated {
+		t.Errorf("got status %d for a push after the delete, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestUserQuota(t *testing.T) {
+	r, store := newQuotaRegistry(&config.Quota{
+		DefaultNamespaceLimit: 100,
+		Users:                 map[string]int64{"johndoe": 25},
+	})
+	layer := bytes.Repeat([]byte("a"), 20)
+
+	if code, _ := pushLayer(t, r, "johndoe/alpine", layer); code != http.StatusCreated {
+		t.Fatalf("got status %d for a push under the limit, want %d", code, http.StatusCreated)
+	}
+	// the layer is stored once, whichever repositories of the user it's in
+	if code, _ := pushLayer(t, r, "johndoe/ubuntu", layer); code != http.StatusCreated {
+		t.Fatalf("got status %d pushing the layer to another repository, want %d", code, http.StatusCreated)
+	}
+
+	store.locks = nil
+	if code, _ := pushLayer(t, r, "johndoe/ubuntu", bytes.Repeat([]byte("b"), 10)); code != http.StatusForbidden {
+		t.Errorf("got status %d for a push over the user limit, want %d", code, http.StatusForbidden)
+	}
+	// the quotas are locked before the usage is read, the namespace first
+	if strings.Join(store.locks, ",") != "johndoe/ubuntu,johndoe" {
+		t.Errorf("got the locks %v, want the namespace then the user", store.locks)
+	}
+
+	// another user has no limit
+	if code, _ := pushLayer(t, r, "janedoe/alpine", bytes.Repeat([]byte("b"), 50)); code != http.StatusCreated {
+		t.Errorf("got status %d for a push of another user, want %d", code, http.StatusCreated)
+	}
+}
@@ -2,25 +2,34 @@ package registry
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/audit"
 	"github.com/containerish/OpenRegistry/config"
 	dfsImpl "github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/registry/v2/schema"
+	"github.com/containerish/OpenRegistry/stats"
 	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/telemetry"
 	"github.com/containerish/OpenRegistry/types"
+	"github.com/containerish/OpenRegistry/webhooks"
+	"github.com/jackc/pgx/v4"
 	"github.com/labstack/echo/v4"
-	"github.com/opencontainers/go-digest"
 )
 
 func NewRegistry(
@@ -28,7 +37,15 @@ func NewRegistry(
 	dfs dfsImpl.DFS,
 	logger telemetry.Logger,
 	config *config.OpenRegistryConfig,
+	auditLogger audit.Logger,
+	webhookNotifier webhooks.Notifier,
+	statsRecorder stats.Recorder,
 ) (Registry, error) {
+	manifestSchemas, err := schema.New()
+	if err != nil {
+		return nil, err
+	}
+
 	mu := &sync.RWMutex{}
 	r := &registry{
 		debug:  true,
@@ -36,20 +53,41 @@ func NewRegistry(
 		mu:     mu,
 		config: config,
 		b: blobs{
-			contents:           make(map[string][]byte),
-			uploads:            make(map[string][]byte),
-			layers:             make(map[string][]string),
 			blobCounter:        make(map[string]int64),
 			layerLengthCounter: make(map[string]int64),
 			layerParts:         make(map[string][]s3types.CompletedPart),
+			layerTails:         make(map[string][]byte),
 			mu:                 mu,
 		},
-		logger: logger,
-		store:  pgStore,
-		txnMap: map[string]TxnStore{},
+		logger:      logger,
+		store:       pgStore,
+		uploads:     map[string]uploadState{},
+		uploadKeys:  map[string]uploadKey{},
+		configCache: newImageConfigCache(config.Registry.ImageConfigCacheSize),
+		auditLogger: auditLogger,
+		webhooks:    webhookNotifier,
+		verifier:    NewManifestVerifier(config.ContentTrust, pgStore),
+		schemas:     manifestSchemas,
+		stats:       statsRecorder,
+		metrics:     newTransferMetrics(),
 	}
 
 	r.b.registry = r
+	if config.Registry.RecompressLayers {
+		r.compressor = NewGzipCompressor(gzip.DefaultCompression)
+		r.startCompressor()
+	}
+
+	if config.Registry.UploadStagingDir != "" {
+		if r.stager, err = newUploadStager(config.Registry.UploadStagingDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.restoreUploadSessions(context.Background()); err != nil {
+		return nil, err
+	}
+	r.startReaper(uploadReapInterval)
 
 	return r, nil
 }
@@ -70,7 +108,7 @@ func (r *registry) LayerExists(ctx echo.Context) error {
 func (r *registry) ManifestExists(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	ref := ctx.Param("reference") // ref can be either tag or digest
 
 	manifest, err := r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
@@ -82,10 +120,14 @@ func (r *registry) ManifestExists(ctx echo.Context) error {
 
 		errMsg := r.errorResponse(RegistryErrorCodeManifestBlobUnknown, err.Error(), details)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
-		return ctx.NoContent(http.StatusNotFound)
+		return ctx.NoContent(storeErrorStatus(err))
+	}
+
+	if setETag(ctx, manifest.Digest) {
+		return r.notModified(ctx, manifest.Digest)
 	}
 
-	metadata, err := r.dfs.Metadata(GetManifestIdentifier(namespace, manifest.Reference))
+	metadata, err := r.manifestMetadata(ctx.Request().Context(), manifest)
 	if err != nil {
 		detail := map[string]interface{}{
 			"error":   err.Error(),
@@ -109,9 +151,7 @@ func (r *registry) ManifestExists(ctx echo.Context) error {
 		return echoErr
 	}
 
-	ctx.Response().Header().Set("Content-Type", "application/json")
-	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", metadata.ContentLength))
-	ctx.Response().Header().Set("Docker-Content-Digest", manifest.Digest)
+	setManifestHeaders(ctx, manifest, int64(metadata.ContentLength))
 	ctx.Response().WriteHeader(http.StatusOK)
 	r.logger.Log(ctx, nil)
 	// nil is okay here since all the required information has been set above
@@ -120,25 +160,20 @@ func (r *registry) ManifestExists(ctx echo.Context) error {
 
 // Catalog - The list of available repositories is made available through the catalog.
 // GET /v2/_catalog?n=10&last=10&ns=johndoe
-// OK
+// HEAD is served by the same handler, the response has the same headers without a body
 func (r *registry) Catalog(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	queryParamPageSize := ctx.QueryParam("n")
 	queryParamOffset := ctx.QueryParam("last")
 	namespace := ctx.QueryParam("ns")
-	var pageSize int64
 	var offset int64
-	if queryParamPageSize != "" {
-		ps, err := strconv.ParseInt(ctx.QueryParam("n"), 10, 64)
-		if err != nil {
-			echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
-				"error": err.Error(),
-			})
-			r.logger.Log(ctx, err)
-			return echoErr
-		}
-		pageSize = ps
+	pageSize, err := r.pageSize(ctx)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error": err.Error(),
+		})
+		r.logger.Log(ctx, err)
+		return echoErr
 	}
 
 	if queryParamOffset != "" {
@@ -153,16 +188,12 @@ func (r *registry) Catalog(ctx echo.Context) error {
 		offset = o
 	}
 
-	catalogList, err := r.store.GetCatalog(ctx.Request().Context(), namespace, pageSize, offset)
-	if err != nil {
-		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
-			"error": err.Error(),
-		})
-		r.logger.Log(ctx, err)
-		return echoErr
+	var viewer string
+	if user, ok := ctx.Get(types.UserContextKey).(*types.User); ok {
+		viewer = user.Username
 	}
-	// empty namespace to pull the full catalog list
-	total, err := r.store.GetCatalogCount(ctx.Request().Context(), "")
+
+	catalogList, total, err := r.store.GetCatalog(ctx.Request().Context(), viewer, namespace, pageSize, offset)
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
 			"error": err.Error(),
@@ -170,6 +201,15 @@ func (r *registry) Catalog(ctx echo.Context) error {
 		r.logger.Log(ctx, err)
 		return echoErr
 	}
+
+	ctx.Response().Header().Set(HeaderTotalCount, strconv.FormatInt(total, 10))
+	if next := offset + int64(len(catalogList)); next < total {
+		link := fmt.Sprintf(`</v2/_catalog?n=%d&last=%d>; rel="next"`, pageSize, next)
+		if namespace != "" {
+			link = fmt.Sprintf(`</v2/_catalog?n=%d&last=%d&ns=%s>; rel="next"`, pageSize, next, url.QueryEscape(namespace))
+		}
+		ctx.Response().Header().Set("Link", link)
+	}
 	echoErr := ctx.JSON(http.StatusOK, echo.Map{
 		"repositories": catalogList,
 		"total":        total,
@@ -181,12 +221,23 @@ func (r *registry) Catalog(ctx echo.Context) error {
 
 // ListTags Content discovery
 // GET /v2/<name>/tags/list
+// HEAD is served by the same handler, the response has the same headers without a body
 // OK
 func (r *registry) ListTags(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
-	limit := ctx.QueryParam("n")
+	namespace := types.Namespace(ctx)
+	last := ctx.QueryParam("last")
+
+	pageSize, err := r.pageSize(ctx)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodePaginationNumberInvalid, err.Error(), echo.Map{
+			"n": ctx.QueryParam("n"),
+		})
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
 
 	tags, err := r.store.GetImageTags(ctx.Request().Context(), namespace)
 	if err != nil {
@@ -196,22 +247,7 @@ func (r *registry) ListTags(ctx echo.Context) error {
 		return echoErr
 	}
 
-	if limit != "" {
-		n, err := strconv.ParseInt(limit, 10, 32)
-		if err != nil {
-			errMsg := r.errorResponse(RegistryErrorCodeTagInvalid, err.Error(), nil)
-			echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
-			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
-			return echoErr
-		}
-		if n > 0 {
-			tags = tags[0:n]
-		}
-		if n == 0 {
-			tags = nil
-		}
-	}
-
+	tags = tagsPage(ctx, "/v2/"+namespace+"/tags/list", tags, last, pageSize)
 	echoErr := ctx.JSON(http.StatusOK, echo.Map{
 		"name": namespace,
 		"tags": tags,
@@ -219,6 +255,29 @@ func (r *registry) ListTags(ctx echo.Context) error {
 	r.logger.Log(ctx, nil)
 	return echoErr
 }
+
+// tagsPage sets the total count of the tags and returns the page of tags after last, the Link header points to the
+// next page, if any
+func tagsPage(ctx echo.Context, listPath string, tags []string, last string, pageSize int64) []string {
+	ctx.Response().Header().Set(HeaderTotalCount, strconv.Itoa(len(tags)))
+
+	// tags are listed in lexical order, last is the final tag of the previous page
+	sort.Strings(tags)
+	if last != "" {
+		tags = tags[sort.SearchStrings(tags, last):]
+		if len(tags) > 0 && tags[0] == last {
+			tags = tags[1:]
+		}
+	}
+	if int64(len(tags)) > pageSize {
+		tags = tags[:pageSize]
+		ctx.Response().Header().Set("Link", fmt.Sprintf(
+			`<%s?n=%d&last=%s>; rel="next"`, listPath, pageSize, url.QueryEscape(tags[len(tags)-1]),
+		))
+	}
+
+	return tags
+}
 func (r *registry) List(ctx echo.Context) error {
 	return fmt.Errorf("not implemented")
 }
@@ -229,17 +288,23 @@ func (r *registry) List(ctx echo.Context) error {
 func (r *registry) PullManifest(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	ref := ctx.Param("reference")
 
 	manifest, err := r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
 	if err != nil {
-		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
-		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		errMsg := r.errorResponse(r.manifestUnknownCode(ctx.Request().Context(), namespace, err), err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
-	resp, err := r.dfs.Download(ctx.Request().Context(), GetManifestIdentifier(namespace, manifest.Reference))
+
+	// a platform is resolved to another manifest, that response has no ETag of its own
+	if ctx.QueryParam("platform") == "" && setETag(ctx, manifest.Digest) {
+		return r.notModified(ctx, manifest.Digest)
+	}
+
+	resp, err := DownloadManifest(ctx.Request().Context(), r.dfs, manifest)
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeManifestInvalid, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
@@ -255,11 +320,39 @@ func (r *registry) PullManifest(ctx echo.Context) error {
 		return echoErr
 	}
 	_ = resp.Close()
-	ctx.Response().Header().Set("Docker-Content-Digest", manifest.Digest)
+
+	// ?platform=os/arch[/variant] resolves a manifest list to the matching image manifest
+	if platform := ctx.QueryParam("platform"); platform != "" {
+		if !isManifestList(manifest.MediaType) {
+			detail := map[string]interface{}{"mediaType": manifest.MediaType}
+			errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, "manifest is not a manifest list", detail)
+			echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+
+		digest, err := resolvePlatformDigest(bz, platform)
+		if err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), nil)
+			echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+
+		location := fmt.Sprintf("/v2/%s/manifests/%s", namespace, digest)
+		ctx.Response().Header().Set(HeaderDockerContentDigest, digest)
+		echoErr := ctx.Redirect(http.StatusFound, location)
+		r.logger.Log(ctx, nil)
+		return echoErr
+	}
+
+	setManifestHeaders(ctx, manifest, int64(len(bz)))
 	ctx.Response().Header().Set("X-Docker-Content-ID", manifest.DFSLink)
-	ctx.Response().Header().Set("Content-Type", manifest.MediaType)
-	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", len(bz)))
-	echoErr := ctx.JSONBlob(http.StatusOK, bz)
+	r.auditLogger.Record(ctx, types.AuditActionPull, namespace, ref)
+	r.stats.RecordPull(namespace)
+	r.metrics.observeTransfer(ctx, namespace, transferKindManifest, transferDirectionPull, int64(len(bz)))
+	// the stored media type is the Content-Type, artifact manifests aren't necessarily JSON
+	echoErr := ctx.Blob(http.StatusOK, manifest.MediaType, bz)
 	r.logger.Log(ctx, nil)
 	return echoErr
 }
@@ -274,7 +367,7 @@ func (r *registry) PullLayer(ctx echo.Context) error {
 	layer, err := r.store.GetLayer(ctx.Request().Context(), clientDigest)
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
-		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
@@ -289,7 +382,34 @@ func (r *registry) PullLayer(ctx echo.Context) error {
 		return echoErr
 	}
 
-	size, err := r.dfs.Metadata(GetLayerIdentifier(layer.UUID))
+	if setETag(ctx, layer.Digest) {
+		return r.notModified(ctx, layer.Digest)
+	}
+
+	// the compressed copy keeps the digest of the uncompressed layer valid, the client undoes the Content-Encoding.
+	// The clients which don't accept the encoding get the copy decoded
+	if compressed := r.compressedLayer(ctx.Request().Context(), layer.Digest); compressed != nil {
+		if !acceptsEncoding(ctx.Request().Header.Get("Accept-Encoding"), compressed.Encoding) {
+			return r.serveBlob(ctx, &blobObject{
+				key:           GetLayerIdentifier(compressed.UUID),
+				digest:        layer.Digest,
+				contentDigest: layer.Digest,
+				decode:        compressed.Encoding,
+				size:          int64(layer.Size),
+			})
+		}
+
+		return r.serveBlob(ctx, &blobObject{
+			key:           GetLayerIdentifier(compressed.UUID),
+			dfsLink:       compressed.DFSLink,
+			digest:        layer.Digest,
+			contentDigest: compressed.CompressedDigest,
+			encoding:      compressed.Encoding,
+			size:          compressed.Size,
+		})
+	}
+
+	size, err := r.dfs.Metadata(ctx.Request().Context(), GetLayerIdentifier(layer.UUID))
 	if err != nil {
 		detail := map[string]interface{}{
 			"error":          err.Error(),
@@ -301,13 +421,13 @@ func (r *registry) PullLayer(ctx echo.Context) error {
 		return ctx.JSONBlob(http.StatusNotFound, errMsg)
 	}
 
-	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", size.ContentLength))
-	ctx.Response().Header().Set("Docker-Content-Digest", layer.Digest)
-	ctx.Response().Header().Set("status", "307")
-
-	url := r.getDownloadableURLFromDFSLink(layer.DFSLink)
-	r.logger.Log(ctx, nil)
-	return ctx.Redirect(http.StatusTemporaryRedirect, url)
+	return r.serveBlob(ctx, &blobObject{
+		key:           GetLayerIdentifier(layer.UUID),
+		dfsLink:       layer.DFSLink,
+		digest:        layer.Digest,
+		contentDigest: layer.Digest,
+		size:          int64(size.ContentLength),
+	})
 }
 
 // MonolithicUpload
@@ -316,20 +436,27 @@ func (r *registry) MonolithicUpload(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
 	imageDigest := ctx.QueryParam("digest")
+	if errMsg := r.uploadDigestError(imageDigest); errMsg != nil {
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
 	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, ctx.Request().Body); err != nil {
+	digester := digest.NewDigester(digest.AlgorithmOf(imageDigest))
+	if _, err := io.Copy(io.MultiWriter(buf, digester), ctx.Request().Body); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadInvalid, "error while reading request body", nil)
 		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 	_ = ctx.Request().Body.Close() // why defer? body is already read :)
-	computedDigest := digest.FromBytes(buf.Bytes())
+	computedDigest := digester.Digest()
 
-	if computedDigest.String() != imageDigest {
+	if computedDigest != imageDigest {
 		details := map[string]interface{}{
 			"clientDigest":   imageDigest,
-			"computedDigest": computedDigest.String(),
+			"computedDigest": computedDigest,
 		}
 		errMsg := r.errorResponse(
 			RegistryErrorCodeDigestInvalid,
@@ -376,6 +503,13 @@ func (r *registry) MonolithicUpload(ctx echo.Context) error {
 		return echoErr
 	}
 
+	committed := false
+	defer func() {
+		if !committed {
+			_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		}
+	}()
+
 	if err := r.store.SetLayer(ctx.Request().Context(), txnOp, layerV2); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadInvalid, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
@@ -389,9 +523,11 @@ func (r *registry) MonolithicUpload(ctx echo.Context) error {
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	committed = true
 
 	link := r.getDownloadableURLFromDFSLink(dfsLink)
 	ctx.Response().Header().Set("Location", link)
+	r.metrics.observeTransfer(ctx, types.Namespace(ctx), transferKindBlob, transferDirectionPush, int64(buf.Len()))
 	echoErr := ctx.NoContent(http.StatusCreated)
 	r.logger.Log(ctx, nil)
 	return echoErr
@@ -412,7 +548,7 @@ registry.tnxMap[uuid] = {txn,blobs[],timeout}
 func (r *registry) StartUpload(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	imageDigest := ctx.QueryParam("digest")
 
 	// Do a Single POST monolithic upload if the digest is present
@@ -421,6 +557,46 @@ func (r *registry) StartUpload(ctx echo.Context) error {
 		return r.MonolithicUpload(ctx)
 	}
 
+	// a mount which isn't allowed falls back to the upload below
+	if r.canMountBlob(ctx) {
+		return r.BlobMount(ctx)
+	}
+
+	// a retried request with the same Idempotency-Key continues the session the first one started
+	key := ctx.Request().Header.Get(HeaderIdempotencyKey)
+	if len(key) > maxIdempotencyKeyLength {
+		errMsg := r.errorResponse(
+			RegistryErrorCodeBlobUploadInvalid,
+			fmt.Sprintf("%s must be at most %d characters long", HeaderIdempotencyKey, maxIdempotencyKeyLength),
+			nil,
+		)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	if key != "" {
+		trackingID, received, reserved, err := r.reserveUpload(ctx.Request().Context(), namespace, key)
+		if err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+			echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+		if !reserved {
+			locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, trackingID)
+			ctx.Response().Header().Set("Location", locationHeader)
+			ctx.Response().Header().Set("Content-Length", "0")
+			ctx.Response().Header().Set("Docker-Upload-UUID", trackingID)
+			ctx.Response().Header().Set("Range", uploadedRange(received))
+			echoErr := ctx.NoContent(http.StatusAccepted)
+			r.logger.Log(ctx, nil)
+			return echoErr
+		}
+
+		// the key is reserved until the session below is remembered, it's released if that never happens
+		defer r.releaseUpload(namespace, key)
+	}
+
 	layerIdentifier, err := CreateIdentifier()
 	if err != nil {
 		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{
@@ -431,7 +607,12 @@ func (r *registry) StartUpload(ctx echo.Context) error {
 		return echoErr
 	}
 
-	uploadId, err := r.dfs.CreateMultipartUpload(GetLayerIdentifier(layerIdentifier))
+	var uploadId string
+	if r.stager != nil {
+		uploadId, err = r.stager.start()
+	} else {
+		uploadId, err = r.dfs.CreateMultipartUpload(ctx.Request().Context(), GetLayerIdentifier(layerIdentifier))
+	}
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadUnknown, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
@@ -439,27 +620,25 @@ func (r *registry) StartUpload(ctx echo.Context) error {
 		return echoErr
 	}
 
-	txn, err := r.store.NewTxn(ctx.Request().Context())
-	if err != nil {
-		errMsg := r.errorResponse(
-			RegistryErrorCodeUnknown,
-			err.Error(),
-			nil,
-		)
-		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
-		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
-		return echoErr
-	}
-
-	r.mu.Lock()
-	r.txnMap[uploadId] = TxnStore{
-		txn:         txn,
+	upload := uploadState{
+		layerKey:    layerIdentifier,
 		blobDigests: []string{},
 		timeout:     time.Minute * 10,
+		startedAt:   time.Now(),
+		updatedAt:   time.Now(),
 	}
+	if r.stager == nil {
+		upload.digest = newUploadDigest()
+	}
+	r.mu.Lock()
+	r.uploads[uploadId] = upload
 	r.mu.Unlock()
 
 	uploadTrackingID := CreateUploadTrackingIdentifier(uploadId, layerIdentifier)
+	r.saveUploadSession(ctx.Request().Context(), namespace, uploadTrackingID)
+	if key != "" {
+		r.rememberUpload(namespace, key, uploadId, uploadTrackingID, upload.timeout)
+	}
 	locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, uploadTrackingID)
 	ctx.Response().Header().Set("Location", locationHeader)
 	ctx.Response().Header().Set("Content-Length", "0")
@@ -470,29 +649,32 @@ func (r *registry) StartUpload(ctx echo.Context) error {
 	return echoErr
 }
 
-// UploadProgress TODO
+// UploadProgress reports the bytes received so far for a chunked upload, from the in-memory upload session
+// GET /v2/<name>/blobs/uploads/<uuid>
 func (r *registry) UploadProgress(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	uuid := ctx.Param("uuid")
-	layerkey := GetLayerIdentifierFromTrakcingID(uuid)
 	uploadID := GetUploadIDFromTrakcingID(uuid)
 
-	metadata, err := r.dfs.GetUploadProgress(GetLayerIdentifier(layerkey), uploadID)
-	if err != nil {
-		locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, uuid)
-		ctx.Response().Header().Set("Location", locationHeader)
-		ctx.Response().Header().Set("Range", "bytes=0-0")
-		ctx.Response().Header().Set("Docker-Upload-UUID", uuid)
-		echoErr := ctx.NoContent(http.StatusNoContent)
-		r.logger.Log(ctx, err)
+	r.mu.RLock()
+	_, ok := r.uploads[uploadID]
+	received := r.b.layerLengthCounter[uploadID]
+	r.mu.RUnlock()
+
+	if !ok {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadUnknown, "upload session not found", echo.Map{
+			"uuid": uuid,
+		})
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
 	locationHeader := fmt.Sprintf("/v2/%s/blobs/uploads/%s", namespace, uuid)
 	ctx.Response().Header().Set("Location", locationHeader)
-	ctx.Response().Header().Set("Range", fmt.Sprintf("bytes=0-%d", metadata.ContentLength))
+	ctx.Response().Header().Set("Range", uploadedRange(received))
 	ctx.Response().Header().Set("Docker-Upload-UUID", uuid)
 	echoErr := ctx.NoContent(http.StatusNoContent)
 	r.logger.Log(ctx, nil)
@@ -506,28 +688,46 @@ func (r *registry) MonolithicPut(ctx echo.Context) error {
 	identifier := ctx.Param("uuid")
 	layerKey := GetLayerIdentifierFromTrakcingID(identifier)
 	uploadID := GetUploadIDFromTrakcingID(identifier)
+	if errMsg := r.uploadDigestError(dig); errMsg != nil {
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	upload, ok := r.upload(uploadID)
+	if !ok {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, "transaction does not exist for uuid -"+identifier, nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	// the upload ends with this request, whether the layer is stored or not
+	defer r.endUpload(ctx.Request().Context(), uploadID)
 
 	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, ctx.Request().Body); err != nil {
+	digester := digest.NewDigester(digest.AlgorithmOf(dig))
+	if _, err := io.Copy(io.MultiWriter(buf, digester), ctx.Request().Body); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 	_ = ctx.Request().Body.Close()
-	ourHash := digest.FromBytes(buf.Bytes())
-
-	dfsLink, err := r.dfs.Upload(ctx.Request().Context(), GetLayerIdentifier(layerKey), ourHash.String(), buf.Bytes())
-	if err != nil {
-		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), nil)
+	ourHash := digester.Digest()
+	if ourHash != dig {
+		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, "client digest does not meet computed digest", echo.Map{
+			"clientDigest":   dig,
+			"computedDigest": ourHash,
+		})
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	txnOp, ok := r.txnMap[uploadID]
-	if !ok {
-		errMsg := r.errorResponse(RegistryErrorCodeUnknown, "transaction does not exist for uuid -"+identifier, nil)
+	dfsLink, err := r.dfs.Upload(ctx.Request().Context(), GetLayerIdentifier(layerKey), ourHash, buf.Bytes())
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
@@ -538,13 +738,27 @@ func (r *registry) MonolithicPut(ctx echo.Context) error {
 		Digest:      dig,
 		DFSLink:     dfsLink,
 		UUID:        layerKey,
-		BlobDigests: txnOp.blobDigests,
+		BlobDigests: upload.blobDigests,
 		Size:        buf.Len(),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := r.store.SetLayer(ctx.Request().Context(), txnOp.txn, layer); err != nil {
+	txn, err := r.store.NewTxn(ctx.Request().Context())
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = r.store.Abort(ctx.Request().Context(), txn)
+		}
+	}()
+
+	if err := r.store.SetLayer(ctx.Request().Context(), txn, layer); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"error_detail": "set layer issues",
 		})
@@ -552,8 +766,11 @@ func (r *registry) MonolithicPut(ctx echo.Context) error {
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	if err = r.chargeQuota(ctx.Request().Context(), txn, types.Namespace(ctx), []string{dig}); err != nil {
+		return r.quotaErrorResponse(ctx, err)
+	}
 
-	if err := r.store.Commit(ctx.Request().Context(), txnOp.txn); err != nil {
+	if err := r.store.Commit(ctx.Request().Context(), txn); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"error_detail": "commitment issue",
 		})
@@ -561,10 +778,13 @@ func (r *registry) MonolithicPut(ctx echo.Context) error {
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	committed = true
 
 	downlaodableLink := r.getDownloadableURLFromDFSLink(dfsLink)
-	ctx.Response().Header().Set("Docker-Content-Digest", ourHash.String())
+	ctx.Response().Header().Set("Docker-Content-Digest", ourHash)
 	ctx.Response().Header().Set("Location", downlaodableLink)
+	r.metrics.observeTransfer(ctx, types.Namespace(ctx), transferKindBlob, transferDirectionPush, int64(buf.Len()))
+	r.metrics.observeUploadSession(types.Namespace(ctx), upload.startedAt)
 	echoErr := ctx.NoContent(http.StatusCreated)
 	r.logger.Log(ctx, nil)
 	return echoErr
@@ -582,51 +802,60 @@ func (r *registry) CompleteUpload(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
 	dig := ctx.QueryParam("digest")
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	identifier := ctx.Param("uuid")
 	layerKey := GetLayerIdentifierFromTrakcingID(identifier)
 	uploadID := GetUploadIDFromTrakcingID(identifier)
-
-	if r.b.blobCounter[uploadID] == 0 {
-		return r.MonolithicPut(ctx)
+	if errMsg := r.uploadDigestError(dig); errMsg != nil {
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
 	}
 
-	buf := &bytes.Buffer{}
-	if _, err := io.Copy(buf, ctx.Request().Body); err != nil {
-		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), nil)
+	upload, ok := r.upload(uploadID)
+	if !ok {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, "transaction does not exist for uuid -"+identifier, nil)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+
+	// the upload ends with this request, whether the layer is stored or not
+	defer r.endUpload(ctx.Request().Context(), uploadID)
+
+	// the final chunk (or the whole blob, for a POST + PUT upload) is streamed to the DFS like the PATCH chunks,
+	// the tail left by the last PATCH is uploaded along with it as the last part
+	parts, n, _, err := r.b.uploadParts(ctx.Request().Context(), uploadID, layerKey, ctx.Request().Body, true)
 	_ = ctx.Request().Body.Close()
-	ourHash := digest.FromBytes(buf.Bytes())
-
-	if buf.Len() > 0 {
-		part, err := r.dfs.UploadPart(
-			ctx.Request().Context(),
-			uploadID,
-			GetLayerIdentifier(layerKey),
-			ourHash.String(),
-			r.b.blobCounter[uploadID],
-			bytes.NewReader(buf.Bytes()),
-			int64(buf.Len()),
-		)
-		if err != nil {
-			errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
-			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
-			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
-			return echoErr
-		}
-		r.b.layerParts[uploadID] = append(r.b.layerParts[uploadID], part)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
 	}
+	r.b.addParts(uploadID, parts, n, nil)
 
-	dfsLink, err := r.dfs.CompleteMultipartUploadInput(
-		ctx.Request().Context(),
-		uploadID,
-		GetLayerIdentifier(layerKey),
-		dig,
-		r.b.layerParts[uploadID],
-	)
+	r.b.mu.RLock()
+	partCount := r.b.blobCounter[uploadID]
+	r.b.mu.RUnlock()
+	if partCount == 0 && r.b.received(uploadID) == 0 {
+		// an empty blob, a multipart upload needs at least one part. The body is drained by now, MonolithicPut
+		// stores the layer and ends the upload
+		return r.MonolithicPut(ctx)
+	}
+
+	var dfsLink string
+	if r.stager != nil {
+		dfsLink, err = r.uploadStagedLayer(ctx.Request().Context(), uploadID, layerKey, dig)
+	} else {
+		dfsLink, err = r.completeMultipartLayer(ctx.Request().Context(), uploadID, layerKey, dig)
+	}
+	if errors.Is(err, errUploadDigestMismatch) {
+		errMsg := r.errorResponse(RegistryErrorCodeDigestInvalid, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadInvalid, err.Error(), echo.Map{
 			"reason": "ERR_SKYNET_UPLOAD",
@@ -638,26 +867,35 @@ func (r *registry) CompleteUpload(ctx echo.Context) error {
 		return echoErr
 	}
 
-	txnOp, ok := r.txnMap[uploadID]
-	if !ok {
-		errMsg := r.errorResponse(RegistryErrorCodeUnknown, "transaction does not exist for uuid -"+identifier, nil)
-		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+	txn, err := r.store.NewTxn(ctx.Request().Context())
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = r.store.Abort(ctx.Request().Context(), txn)
+		}
+	}()
 
+	r.b.mu.RLock()
+	layerSize := r.b.layerLengthCounter[uploadID]
+	r.b.mu.RUnlock()
 	layer := &types.LayerV2{
 		MediaType:   ctx.Request().Header.Get("content-type"),
 		Digest:      dig,
 		DFSLink:     dfsLink,
 		UUID:        layerKey,
-		BlobDigests: txnOp.blobDigests,
-		Size:        buf.Len(),
+		BlobDigests: upload.blobDigests,
+		Size:        int(layerSize),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := r.store.SetLayer(ctx.Request().Context(), txnOp.txn, layer); err != nil {
+	if err := r.store.SetLayer(ctx.Request().Context(), txn, layer); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"error_detail": "set layer issues",
 		})
@@ -665,8 +903,11 @@ func (r *registry) CompleteUpload(ctx echo.Context) error {
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	if err = r.chargeQuota(ctx.Request().Context(), txn, namespace, []string{dig}); err != nil {
+		return r.quotaErrorResponse(ctx, err)
+	}
 
-	if err := r.store.Commit(ctx.Request().Context(), txnOp.txn); err != nil {
+	if err := r.store.Commit(ctx.Request().Context(), txn); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"error_detail": "commitment issue",
 		})
@@ -674,19 +915,53 @@ func (r *registry) CompleteUpload(ctx echo.Context) error {
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	committed = true
+	r.queueCompression(layer)
 
-	locationHeader := fmt.Sprintf("/v2/%s/blobs/%s", namespace, ourHash)
+	locationHeader := fmt.Sprintf("/v2/%s/blobs/%s", namespace, dig)
 	ctx.Response().Header().Set("Content-Length", "0")
-	ctx.Response().Header().Set("Docker-Content-Digest", ourHash.String())
+	ctx.Response().Header().Set("Docker-Content-Digest", dig)
 	ctx.Response().Header().Set("Location", locationHeader)
+	r.metrics.observeTransfer(ctx, namespace, transferKindBlob, transferDirectionPush, layerSize)
+	r.metrics.observeUploadSession(namespace, upload.startedAt)
 	echoErr := ctx.NoContent(http.StatusCreated)
 	r.logger.Log(ctx, nil)
 	return echoErr
 }
 
-// BlobMount to be implemented by guacamole at a later stage
+// BlobMount gives the repository the blob in the mount query param, which another repository already has, so
+// that the client doesn't upload it again. Blobs are stored once whichever repository they're pushed to, mounting
+// doesn't copy anything. StartUpload only calls it once canMountBlob has checked the mount
+// POST /v2/<name>/blobs/uploads/?mount=<digest>&from=<other name>
 func (r *registry) BlobMount(ctx echo.Context) error {
-	return nil
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	dig := ctx.QueryParam("mount")
+	locationHeader := fmt.Sprintf("/v2/%s/blobs/%s", types.Namespace(ctx), dig)
+	ctx.Response().Header().Set("Location", locationHeader)
+	ctx.Response().Header().Set(HeaderDockerContentDigest, dig)
+	ctx.Response().Header().Set("Content-Length", "0")
+	echoErr := ctx.NoContent(http.StatusCreated)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// canMountBlob reports whether the blob in the mount query param can be mounted from the repository in the from
+// query param. The ACL only allows a mount from a repository the user can pull from, and the blob must be used by
+// one of its manifests. Otherwise the spec wants a regular upload to be started, which also means that the response
+// doesn't reveal whether a repository the user can't access has the blob
+func (r *registry) canMountBlob(ctx echo.Context) bool {
+	dig, from := ctx.QueryParam("mount"), ctx.QueryParam("from")
+	if dig == "" || from == "" {
+		return false
+	}
+
+	if allowed, _ := ctx.Get(types.BlobMountAllowedKey).(bool); !allowed {
+		return false
+	}
+
+	exists, err := r.store.RepositoryHasLayer(ctx.Request().Context(), from, dig)
+	return err == nil && exists
 }
 
 // PushImage is already implemented through StartUpload and ChunkedUpload
@@ -697,13 +972,14 @@ func (r *registry) PushImage(ctx echo.Context) error {
 func (r *registry) PushManifest(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	ref := ctx.Param("reference")
 	contentType := ctx.Request().Header.Get("Content-Type")
 
 	var manifest ImageManifest
 	buf := &bytes.Buffer{}
-	_, err := io.Copy(buf, ctx.Request().Body)
+	digester := digest.NewDigester(digest.Canonical)
+	_, err := io.Copy(io.MultiWriter(buf, digester), ctx.Request().Body)
 	if err != nil {
 		return ctx.JSON(http.StatusBadRequest, echo.Map{
 			"error":   err.Error(),
@@ -712,16 +988,96 @@ func (r *registry) PushManifest(ctx echo.Context) error {
 	}
 	_ = ctx.Request().Body.Close()
 
-	err = json.Unmarshal(buf.Bytes(), &manifest)
+	// the client digest is checked with the algorithm the client used, the manifest is still stored by its
+	// canonical digest
+	if clientDigest := ctx.Request().Header.Get(HeaderDockerContentDigest); clientDigest != "" {
+		computed, digestErr := digest.FromReader(digest.AlgorithmOf(clientDigest), bytes.NewReader(buf.Bytes()))
+		if digestErr != nil || computed != clientDigest {
+			errMsg := r.errorResponse(
+				RegistryErrorCodeDigestInvalid,
+				"manifest digest does not match the Docker-Content-Digest header",
+				echo.Map{
+					"clientDigest":   clientDigest,
+					"computedDigest": computed,
+				},
+			)
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+	}
+
+	// indexes are validated as they're decoded, large ones aren't decoded a second time into a generic document
+	var index *schema.Index
+	if isManifestList(mediaTypeOf(contentType)) {
+		index, err = r.schemas.ValidateIndex(bytes.NewReader(buf.Bytes()))
+		if index != nil {
+			manifest = ImageManifest{MediaType: index.MediaType, ArtifactType: index.ArtifactType, SchemaVersion: 2}
+		}
+	} else {
+		err = r.schemas.Validate(contentType, buf.Bytes())
+	}
 	if err != nil {
-		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+		detail := echo.Map{}
+		if schemaErr, ok := err.(*schema.Error); ok {
+			detail["pointer"] = schemaErr.Pointer
+		}
+		errMsg := r.errorResponse(RegistryErrorCodeManifestInvalid, err.Error(), detail)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if index == nil {
+		err = json.Unmarshal(buf.Bytes(), &manifest)
+		if err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+	}
+
+	if mediaType := r.disallowedMediaType(contentType, &manifest, index); mediaType != "" {
+		errMsg := r.errorResponse(
+			RegistryErrorCodeManifestInvalid,
+			"media type is not allowed by this registry",
+			echo.Map{"mediaType": mediaType},
+		)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	dig := digest.FromBytes(buf.Bytes())
-	dfsLink, err := r.dfs.Upload(ctx.Request().Context(), GetManifestIdentifier(namespace, ref), dig.String(), buf.Bytes())
+	dig := digester.Digest()
+	if err = r.verifier.Verify(ctx.Request().Context(), namespace, ref, dig); err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeDenied, err.Error(), map[string]interface{}{
+			"namespace": namespace,
+			"reference": ref,
+			"digest":    dig,
+		})
+		echoErr := ctx.JSONBlob(http.StatusForbidden, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	imageSize, err := r.imageSize(ctx.Request().Context(), &manifest)
+	if err != nil {
+		code, status := RegistryErrorCodeUnknown, http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errConfigBlobUnknown):
+			code, status = RegistryErrorCodeManifestBlobUnknown, http.StatusBadRequest
+		case errors.Is(err, errConfigSizeInvalid):
+			code, status = RegistryErrorCodeManifestInvalid, http.StatusBadRequest
+		}
+		errMsg := r.errorResponse(code, err.Error(), echo.Map{"digest": manifest.Config.Digest})
+		echoErr := ctx.JSONBlob(status, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	// the manifest is stored once by its digest, the tags and repositories only map to the digest in the store
+	dfsLink, err := r.storeManifest(ctx.Request().Context(), dig, buf.Bytes())
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeManifestBlobUnknown, err.Error(), nil)
 		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
@@ -748,13 +1104,17 @@ func (r *registry) PushManifest(ctx echo.Context) error {
 		UUID:      uuid,
 		Namespace: namespace,
 		Reference: ref,
-		Digest:    dig.String(),
+		Digest:    dig,
 		DFSLink:   dfsLink,
 		MediaType: contentType,
 		Layers:    layerIDs,
-		Size:      0,
+		Size:      imageSize,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		// the config digest is empty for manifest lists
+		ConfigDigest: manifest.Config.Digest,
+		ConfigSize:   manifest.Config.Size,
+		ArtifactType: manifest.ArtifactType,
 	}
 
 	val := &types.ImageManifestV2{
@@ -766,20 +1126,30 @@ func (r *registry) PushManifest(ctx echo.Context) error {
 		UpdatedAt:     time.Now(),
 	}
 
-	txnOp, err := r.store.NewTxn(context.Background())
+	txnOp, err := r.store.NewTxn(ctx.Request().Context())
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"reason": "PG_ERR_CREATE_NEW_TXN",
 		})
-		_ = r.store.Abort(ctx.Request().Context(), txnOp)
 		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
+	// the txn is rolled back on every error, once committed the rollback is a no-op
+	committed := false
+	defer func() {
+		if !committed {
+			_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		}
+	}()
+
+	if err = r.chargeQuota(ctx.Request().Context(), txnOp, namespace, layerIDs); err != nil {
+		return r.quotaErrorResponse(ctx, err)
+	}
+
 	if err = r.store.SetManifest(ctx.Request().Context(), txnOp, val); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
-		_ = r.store.Abort(ctx.Request().Context(), txnOp)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
@@ -787,26 +1157,51 @@ func (r *registry) PushManifest(ctx echo.Context) error {
 
 	if err = r.store.SetConfig(ctx.Request().Context(), txnOp, mfc); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
-		_ = r.store.Abort(ctx.Request().Context(), txnOp)
 		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
+	if !isDigest(ref) {
+		digestConfig := mfc
+		digestConfig.Reference = dig
+		digestConfig.DFSLink = dfsLink
+		digestConfig.UUID, err = CreateIdentifier()
+		if err == nil {
+			err = r.store.SetConfig(ctx.Request().Context(), txnOp, digestConfig)
+		}
+		if err != nil {
+			errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+	}
+
 	if err = r.store.Commit(ctx.Request().Context(), txnOp); err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
 			"reason": "ERR_PG_COMMIT_TXN",
 		})
-		_ = r.store.Abort(ctx.Request().Context(), txnOp)
 		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
+	committed = true
 
 	locationHeader := fmt.Sprintf("https://openregsitry-test.s3.amazonaws.com/%s", dfsLink)
 	ctx.Response().Header().Set("Location", locationHeader)
-	ctx.Response().Header().Set("Docker-Content-Digest", dig.String())
+	ctx.Response().Header().Set("Docker-Content-Digest", dig)
 	ctx.Response().Header().Set("X-Docker-Content-ID", dfsLink)
+	r.auditLogger.Record(ctx, types.AuditActionPush, namespace, ref)
+	r.stats.RecordPush(namespace)
+	r.metrics.observeTransfer(ctx, namespace, transferKindManifest, transferDirectionPush, int64(buf.Len()))
+	r.webhooks.Notify(&types.WebhookEvent{
+		Timestamp:  time.Now(),
+		Type:       types.WebhookEventPush,
+		Repository: namespace,
+		Tag:        ref,
+		Digest:     dig,
+	})
 	echoErr := ctx.String(http.StatusCreated, "Created")
 	r.logger.Log(ctx, nil)
 	return echoErr
@@ -850,8 +1245,30 @@ func (r *registry) PushLayer(ctx echo.Context) error {
 	return echoErr
 }
 
+// CancelUpload
+// DELETE /v2/<name>/blobs/uploads/<uuid>
+// drops the upload along with its staging file, the parts already uploaded to the DFS are aborted
 func (r *registry) CancelUpload(ctx echo.Context) error {
-	return nil
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	identifier := ctx.Param("uuid")
+	uploadID := GetUploadIDFromTrakcingID(identifier)
+
+	upload, ok := r.upload(uploadID)
+	if !ok {
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUploadUnknown, "upload session not found", echo.Map{
+			"uuid": identifier,
+		})
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	r.reapUpload(ctx.Request().Context(), uploadID, upload.layerKey)
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	r.logger.Log(ctx, nil)
+	return echoErr
 }
 
 // DeleteTagOrManifest
@@ -859,7 +1276,7 @@ func (r *registry) CancelUpload(ctx echo.Context) error {
 func (r *registry) DeleteTagOrManifest(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
-	namespace := ctx.Param("username") + "/" + ctx.Param("imagename")
+	namespace := types.Namespace(ctx)
 	ref := ctx.Param("reference")
 
 	if ref == "" {
@@ -868,24 +1285,138 @@ func (r *registry) DeleteTagOrManifest(ctx echo.Context) error {
 			ref = reqURI[5]
 		}
 	}
-	txnOp, _ := r.store.NewTxn(context.Background())
-	if err := r.store.DeleteManifestOrTag(ctx.Request().Context(), txnOp, ref); err != nil {
-		details := map[string]interface{}{
-			"namespace": namespace,
-			"digest":    ref,
+	txnOp, err := r.store.NewTxn(ctx.Request().Context())
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
+			"reason": "PG_ERR_CREATE_NEW_TXN",
+		})
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	details := map[string]interface{}{
+		"namespace": namespace,
+		"reference": ref,
+	}
+
+	// the DFS objects of the deleted manifest and layers, they're deleted once the txn is committed
+	var orphans []string
+
+	// deleting a tag leaves the manifest in place, a manifest can only be deleted by its digest,
+	// once no tags point to it
+	if isDigest(ref) {
+		tags, tagsErr := r.store.GetTagsByDigest(ctx.Request().Context(), txnOp, namespace, ref)
+		if tagsErr != nil {
+			_ = r.store.Abort(ctx.Request().Context(), txnOp)
+			errMsg := r.errorResponse(RegistryErrorCodeUnknown, tagsErr.Error(), details)
+			echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+
+		if len(tags) > 0 {
+			_ = r.store.Abort(ctx.Request().Context(), txnOp)
+			details["tags"] = tags
+			errMsg := r.errorResponse(
+				RegistryErrorCodeDenied, "manifest is referenced by tags, delete the tags first", details,
+			)
+			echoErr := ctx.JSONBlob(http.StatusConflict, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+
+		var manifest *types.ConfigV2
+		manifest, err = r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
+		if err == nil {
+			err = r.store.DeleteManifest(ctx.Request().Context(), txnOp, namespace, ref)
+		}
+		var layers []*types.LayerV2
+		if err == nil {
+			layers, err = DeleteUnreferencedLayers(ctx.Request().Context(), r.store, txnOp, manifest.Layers)
+		}
+		if err == nil {
+			orphans, err = ManifestObjectKeys(ctx.Request().Context(), r.store, txnOp, namespace, ref)
+			orphans = append(orphans, LayerObjectKeys(ctx.Request().Context(), r.store, layers)...)
+		}
+	} else {
+		var manifest *types.ConfigV2
+		manifest, err = r.store.GetManifestByReference(ctx.Request().Context(), namespace, ref)
+		if err == nil {
+			err = r.store.DeleteTag(ctx.Request().Context(), txnOp, namespace, ref)
 		}
+		if err == nil && r.config.Registry.DeleteUntaggedManifests {
+			orphans, err = r.deleteUntaggedManifest(ctx.Request().Context(), txnOp, namespace, manifest)
+		}
+		if err == nil {
+			orphans = append(orphans, TagObjectKeys(namespace, ref)...)
+		}
+	}
+
+	if err != nil {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
 		errMsg := r.errorResponse(RegistryErrorCodeManifestUnknown, err.Error(), details)
 		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	err := r.store.Commit(ctx.Request().Context(), txnOp)
+	err = r.store.Commit(ctx.Request().Context(), txnOp)
+	if err == nil {
+		r.auditLogger.Record(ctx, types.AuditActionDelete, namespace, ref)
+		event := &types.WebhookEvent{
+			Timestamp:  time.Now(),
+			Type:       types.WebhookEventDelete,
+			Repository: namespace,
+		}
+		if isDigest(ref) {
+			event.Digest = ref
+		} else {
+			event.Tag = ref
+		}
+		r.webhooks.Notify(event)
+		err = DeleteObjects(ctx.Request().Context(), r.dfs, orphans)
+	}
 	echoErr := ctx.NoContent(http.StatusAccepted)
 	r.logger.Log(ctx, err)
 	return echoErr
 }
 
+// deleteUntaggedManifest deletes the manifest once its last tag is gone. Manifests of a repository which has
+// manifest lists are kept, since they might be referenced by one of the lists. The DFS keys of the deleted
+// manifest and layers are returned
+func (r *registry) deleteUntaggedManifest(
+	ctx context.Context, txn pgx.Tx, namespace string, manifest *types.ConfigV2,
+) ([]string, error) {
+	tags, err := r.store.GetTagsByDigest(ctx, txn, namespace, manifest.Digest)
+	if err != nil || len(tags) > 0 {
+		return nil, err
+	}
+
+	hasLists, err := r.store.HasManifestLists(
+		ctx, txn, namespace, []string{MediaTypeDockerManifestList, MediaTypeOCIImageIndex},
+	)
+	if err != nil || hasLists {
+		return nil, err
+	}
+
+	if err = r.store.DeleteManifest(ctx, txn, namespace, manifest.Digest); err != nil {
+		return nil, err
+	}
+
+	layers, err := DeleteUnreferencedLayers(ctx, r.store, txn, manifest.Layers)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ManifestObjectKeys(ctx, r.store, txn, namespace, manifest.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, LayerObjectKeys(ctx, r.store, layers)...), nil
+}
+
 func (r *registry) DeleteLayer(ctx echo.Context) error {
 	ctx.Set(types.HandlerStartTime, time.Now())
 
@@ -893,39 +1424,147 @@ func (r *registry) DeleteLayer(ctx echo.Context) error {
 	layer, err := r.store.GetLayer(ctx.Request().Context(), dig)
 	if err != nil {
 		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
-		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
-	blobs := layer.BlobDigests
 
-	txnOp, _ := r.store.NewTxn(context.Background())
-	err = r.store.DeleteLayerV2(ctx.Request().Context(), txnOp, dig)
+	txnOp, err := r.store.NewTxn(ctx.Request().Context())
 	if err != nil {
-		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
+			"reason": "PG_ERR_CREATE_NEW_TXN",
+		})
 		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
 		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
 		return echoErr
 	}
 
-	for i := range blobs {
-		if err = r.store.DeleteBlobV2(ctx.Request().Context(), txnOp, blobs[i]); err != nil {
-			errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
-			echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
-			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
-			return echoErr
-		}
+	// layers are shared between images, a layer can only be deleted once no manifest uses it
+	refs, err := r.store.GetLayerReferenceCount(ctx.Request().Context(), txnOp, dig)
+	if err != nil {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if refs > 0 {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		errMsg := r.errorResponse(RegistryErrorCodeDenied, "blob is referenced by other manifests", echo.Map{
+			"digest":     dig,
+			"references": refs,
+		})
+		echoErr := ctx.JSONBlob(http.StatusConflict, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if err = deleteLayer(ctx.Request().Context(), r.store, txnOp, layer); err != nil {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		errMsg := r.errorResponse(RegistryErrorCodeBlobUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
 	}
+
+	// the keys are looked up before the commit, the compressed copy of the layer is deleted along with it
+	orphans := LayerObjectKeys(ctx.Request().Context(), r.store, []*types.LayerV2{layer})
 	err = r.store.Commit(ctx.Request().Context(), txnOp)
+	if err == nil {
+		namespace := types.Namespace(ctx)
+		r.auditLogger.Record(ctx, types.AuditActionDelete, namespace, dig)
+		err = DeleteObjects(ctx.Request().Context(), r.dfs, orphans)
+	}
 	echoErr := ctx.NoContent(http.StatusAccepted)
 	r.logger.Log(ctx, err)
 	return echoErr
 }
 
+func deleteLayer(ctx context.Context, store postgres.RegistryStore, txn pgx.Tx, layer *types.LayerV2) error {
+	if err := store.DeleteLayerV2(ctx, txn, layer.Digest); err != nil {
+		return err
+	}
+
+	for _, blobDigest := range layer.BlobDigests {
+		if err := store.DeleteBlobV2(ctx, txn, blobDigest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteUnreferencedLayers deletes the layers of a deleted manifest which aren't used by any other manifest and
+// returns them, so that their DFS objects can be deleted once the txn is committed (see LayerObjectKeys). It must run
+// in the same txn as the manifest delete, so that the reference counts don't include it anymore
+func DeleteUnreferencedLayers(
+	ctx context.Context,
+	store postgres.RegistryStore,
+	txn pgx.Tx,
+	digests []string,
+) ([]*types.LayerV2, error) {
+	var deleted []*types.LayerV2
+	for _, dig := range digests {
+		refs, err := store.GetLayerReferenceCount(ctx, txn, dig)
+		if err != nil {
+			return deleted, err
+		}
+		if refs > 0 {
+			continue
+		}
+
+		layer, err := store.GetLayer(ctx, dig)
+		if err != nil {
+			// the layer was already deleted
+			continue
+		}
+
+		if err = deleteLayer(ctx, store, txn, layer); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, layer)
+	}
+
+	return deleted, nil
+}
+
+// LayerObjectKeys returns the DFS keys of the layers, including the keys of their compressed copies. The compressed
+// copies are looked up in the store, so it must run before the txn deleting the layers is committed
+func LayerObjectKeys(ctx context.Context, store postgres.PersistentStore, layers []*types.LayerV2) []string {
+	keys := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		keys = append(keys, GetLayerIdentifier(layer.UUID))
+		if compressed, err := store.GetCompressedLayer(ctx, layer.Digest); err == nil {
+			keys = append(keys, GetLayerIdentifier(compressed.UUID))
+		}
+	}
+
+	return keys
+}
+
+// DeleteObjects deletes the DFS objects of the deleted layers and manifests. It runs once the txn is committed,
+// an object which fails to be deleted is only leaked, whereas deleting it before the commit could leave rows
+// pointing to a missing object. The failures are returned so that they're logged
+func DeleteObjects(ctx context.Context, storage dfsImpl.DFS, keys []string) error {
+	var failed []string
+	for _, key := range keys {
+		if err := storage.DeleteObject(ctx, key); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", key, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("ERR_DELETE_DFS_OBJECTS: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
 // Should also look into 401 Code
 // https://docs.docker.com/registry/spec/api/
 func (r *registry) ApiVersion(ctx echo.Context) error {
-	ctx.Response().Header().Set(HeaderDockerDistributionApiVersion, "registry/2.0")
+	ctx.Response().Header().Set(HeaderDockerDistributionApiVersion, DockerDistributionApiVersion)
 	return ctx.String(http.StatusOK, "OK\n")
 }
 
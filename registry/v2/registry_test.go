@@ -0,0 +1,484 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/audit"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/stats"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	nopLogger struct{}
+
+	nopStats struct{ stats.Recorder }
+
+	nopAudit struct{ audit.Logger }
+
+	// uploadStore is the part of the store the upload handlers use. The txns are nil, aborting one restores the
+	// layers as they were when it was opened. saveDelay makes SaveUploadSession slow, to widen the window between
+	// starting an upload and remembering its Idempotency-Key
+	uploadStore struct {
+		postgres.PersistentStore
+		mu              sync.Mutex
+		sessions        map[string]*types.UploadSession
+		layers          map[string]*types.LayerV2
+		namespaceLayers map[string]map[string]bool
+		snapshot        *uploadStore
+		saveDelay       time.Duration
+	}
+)
+
+func newUploadStore() *uploadStore {
+	return &uploadStore{
+		sessions:        map[string]*types.UploadSession{},
+		layers:          map[string]*types.LayerV2{},
+		namespaceLayers: map[string]map[string]bool{},
+	}
+}
+
+func (nopLogger) Log(echo.Context, error) {}
+
+func (nopStats) RecordLayerPull(string) {}
+
+func (nopStats) RecordPull(string) {}
+
+func (nopStats) RecordPush(string) {}
+
+func (nopAudit) Record(echo.Context, types.AuditAction, string, string) {}
+
+func (s *uploadStore) NewTxn(context.Context) (pgx.Tx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = &uploadStore{layers: map[string]*types.LayerV2{}, namespaceLayers: map[string]map[string]bool{}}
+	for dig, layer := range s.layers {
+		s.snapshot.layers[dig] = layer
+	}
+	for namespace, digests := range s.namespaceLayers {
+		s.snapshot.namespaceLayers[namespace] = map[string]bool{}
+		for dig := range digests {
+			s.snapshot.namespaceLayers[namespace][dig] = true
+		}
+	}
+	return nil, nil
+}
+
+func (s *uploadStore) Commit(context.Context, pgx.Tx) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = nil
+	return nil
+}
+
+func (s *uploadStore) Abort(context.Context, pgx.Tx) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshot != nil {
+		s.layers, s.namespaceLayers, s.snapshot = s.snapshot.layers, s.snapshot.namespaceLayers, nil
+	}
+	return nil
+}
+
+func (s *uploadStore) AddNamespaceLayers(_ context.Context, _ pgx.Tx, namespace string, digests []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.namespaceLayers[namespace] == nil {
+		s.namespaceLayers[namespace] = map[string]bool{}
+	}
+	for _, dig := range digests {
+		if _, ok := s.layers[dig]; ok {
+			s.namespaceLayers[namespace][dig] = true
+		}
+	}
+	return nil
+}
+
+func (s *uploadStore) SetLayer(_ context.Context, _ pgx.Tx, layer *types.LayerV2) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.layers[layer.Digest] = layer
+	return nil
+}
+
+func (s *uploadStore) SaveUploadSession(_ context.Context, session *types.UploadSession) error {
+	time.Sleep(s.saveDelay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.UploadID] = session
+	return nil
+}
+
+func (s *uploadStore) AppendUploadSessionParts(_ context.Context, session *types.UploadSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *session
+	if prev, ok := s.sessions[session.UploadID]; ok {
+		stored.CreatedAt = prev.CreatedAt
+		stored.Parts = append(append([]types.UploadSessionPart{}, prev.Parts...), session.Parts...)
+	}
+	s.sessions[session.UploadID] = &stored
+	return nil
+}
+
+func (s *uploadStore) GetUploadSessionParts(_ context.Context, uploadID string) ([]types.UploadSessionPart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[uploadID]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return session.Parts, nil
+}
+
+func (s *uploadStore) GetUploadSessions(context.Context) ([]*types.UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]*types.UploadSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (s *uploadStore) DeleteUploadSession(_ context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, uploadID)
+	return nil
+}
+
+func (s *uploadStore) sessionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sessions)
+}
+
+// newTestRegistry has only what the handlers under test use, without webhooks or audit logs
+func newTestRegistry(store postgres.PersistentStore, storage *memory.DFS) *registry {
+	mu := &sync.RWMutex{}
+	r := &registry{
+		config:  &config.OpenRegistryConfig{Registry: &config.Registry{}},
+		logger:  nopLogger{},
+		store:   store,
+		dfs:     storage,
+		uploads: map[string]uploadState{},
+		mu:      mu,
+		b: blobs{
+			blobCounter:        map[string]int64{},
+			layerLengthCounter: map[string]int64{},
+			layerParts:         map[string][]s3types.CompletedPart{},
+			layerTails:         map[string][]byte{},
+			mu:                 mu,
+		},
+		uploadKeys:  map[string]uploadKey{},
+		stats:       nopStats{},
+		auditLogger: nopAudit{},
+		metrics:     newTransferMetrics(),
+	}
+	r.b.registry = r
+
+	return r
+}
+
+// newTestContext routes the request to the namespace, e.g. "user/image"
+func newTestContext(method, target, namespace string) (echo.Context, *httptest.ResponseRecorder) {
+	return newTestContextWithBody(method, target, namespace, nil)
+}
+
+func newTestContextWithBody(
+	method, target, namespace string,
+	body io.Reader,
+) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(method, target, body), rec)
+
+	parts := strings.SplitN(namespace, "/", 2)
+	ctx.SetParamNames("username", "imagename")
+	ctx.SetParamValues(parts[0], parts[1])
+
+	return ctx, rec
+}
+
+// uploadContext routes the request to the upload, the uuid is its Docker-Upload-UUID
+func uploadContext(method, namespace, uuid string, body []byte) (echo.Context, *httptest.ResponseRecorder) {
+	target := "/v2/" + namespace + "/blobs/uploads/" + uuid
+	ctx, rec := newTestContextWithBody(method, target, namespace, bytes.NewReader(body))
+	parts := strings.SplitN(namespace, "/", 2)
+	ctx.SetParamNames("username", "imagename", "uuid")
+	ctx.SetParamValues(parts[0], parts[1], uuid)
+
+	return ctx, rec
+}
+
+// manifestContext routes the request to the manifest reference of testNamespace
+func manifestContext(method, reference string) (echo.Context, *httptest.ResponseRecorder) {
+	ctx, rec := newTestContext(method, "/v2/"+testNamespace+"/manifests/"+reference, testNamespace)
+	ctx.SetParamNames("username", "imagename", "reference")
+	ctx.SetParamValues("johndoe", "alpine", reference)
+
+	return ctx, rec
+}
+
+func TestPullManifestContentType(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		content   string
+		want      string
+	}{
+		{
+			mediaType: "application/vnd.oci.image.manifest.v1+json",
+			content:   `{"schemaVersion":2}`,
+			want:      "application/vnd.oci.image.manifest.v1+json",
+		},
+		{
+			mediaType: "application/vnd.docker.distribution.manifest.list.v2+json",
+			content:   `{"schemaVersion":2,"manifests":[]}`,
+			want:      "application/vnd.docker.distribution.manifest.list.v2+json",
+		},
+		{
+			mediaType: "application/vnd.example.sbom.v1+yaml",
+			content:   "schemaVersion: 2\n",
+			want:      "application/vnd.example.sbom.v1+yaml",
+		},
+		{mediaType: "", content: `{"schemaVersion":2}`, want: echo.MIMEApplicationJSON},
+	}
+
+	for _, tt := range tests {
+		store, storage := newIntegrityStore(), memory.New()
+		dig := digest.FromBytes([]byte(tt.content))
+		store.manifests["latest"] = &types.ConfigV2{
+			Namespace: testNamespace,
+			Reference: "latest",
+			Digest:    dig,
+			MediaType: tt.mediaType,
+		}
+		storage.Put(GetManifestContentIdentifier(dig), []byte(tt.content))
+
+		r := newTestRegistry(store, storage)
+		ctx, rec := manifestContext(http.MethodGet, "latest")
+		if err := r.PullManifest(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want 200: %s", tt.mediaType, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); got != tt.want {
+			t.Errorf("%s: got Content-Type %s, want %s", tt.mediaType, got, tt.want)
+		}
+		if rec.Body.String() != tt.content {
+			t.Errorf("%s: got %q, want the stored manifest %q", tt.mediaType, rec.Body, tt.content)
+		}
+	}
+}
+
+// repositoryStore knows which repositories had something pushed to them
+type repositoryStore struct {
+	*integrityStore
+	repositories map[string]bool
+}
+
+func (s *repositoryStore) RepositoryExists(_ context.Context, namespace string) (bool, error) {
+	return s.repositories[namespace], nil
+}
+
+// TestPullManifestUnknown pulls from public repositories, a private one challenges the anonymous pulls before they
+// get here (see pullACL)
+func TestPullManifestUnknown(t *testing.T) {
+	tests := []struct {
+		name     string
+		exists   bool
+		wantCode string
+	}{
+		{name: "repository never pushed to", wantCode: RegistryErrorCodeNameUnknown},
+		{name: "manifest missing from the repository", exists: true, wantCode: RegistryErrorCodeManifestUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &repositoryStore{integrityStore: newIntegrityStore(), repositories: map[string]bool{}}
+			store.repositories[testNamespace] = tt.exists
+			r := newTestRegistry(store, memory.New())
+
+			ctx, rec := manifestContext(http.MethodGet, "missing")
+			if err := r.PullManifest(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusNotFound)
+			}
+			var errs RegistryErrors
+			if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			if len(errs.Errors) != 1 || errs.Errors[0].Code != tt.wantCode {
+				t.Errorf("got errors %+v, want %s", errs.Errors, tt.wantCode)
+			}
+			if rec.Header().Get(echo.HeaderWWWAuthenticate) != "" {
+				t.Error("got a challenge for a public repository")
+			}
+		})
+	}
+}
+
+// listingStore has the tags of testNamespace and the repositories of the catalog
+type listingStore struct {
+	postgres.PersistentStore
+	tags         []string
+	repositories []string
+}
+
+func (s *listingStore) GetImageTags(context.Context, string) ([]string, error) {
+	return append([]string{}, s.tags...), nil
+}
+
+func (s *listingStore) GetCatalog(_ context.Context, _, _ string, pageSize, offset int64) ([]string, int64, error) {
+	total := int64(len(s.repositories))
+	end := offset + pageSize
+	if end > total {
+		end = total
+	}
+	return s.repositories[offset:end], total, nil
+}
+
+func TestHeadListingsMatchGet(t *testing.T) {
+	r := newTestRegistry(&listingStore{
+		tags:         []string{"v3", "v1", "latest", "v2"},
+		repositories: []string{"johndoe/alpine", "johndoe/busybox", "janedoe/nginx"},
+	}, nil)
+	e := echo.New()
+	e.GET("/v2/_catalog", r.Catalog)
+	e.HEAD("/v2/_catalog", r.Catalog)
+	e.GET("/v2/:username/:imagename/tags/list", r.ListTags)
+	e.HEAD("/v2/:username/:imagename/tags/list", r.ListTags)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	paths := []string{
+		"/v2/johndoe/alpine/tags/list",
+		"/v2/johndoe/alpine/tags/list?n=2",
+		"/v2/johndoe/alpine/tags/list?n=2&last=v1",
+		"/v2/_catalog",
+		"/v2/_catalog?n=2",
+	}
+	for _, path := range paths {
+		get, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		getBody, _ := io.ReadAll(get.Body)
+		get.Body.Close()
+
+		head, err := http.Head(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headBody, _ := io.ReadAll(head.Body)
+		head.Body.Close()
+
+		if head.StatusCode != http.StatusOK || get.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %d for HEAD and %d for GET, want 200", path, head.StatusCode, get.StatusCode)
+		}
+		if len(headBody) != 0 || len(getBody) == 0 {
+			t.Errorf("%s: got a body of %d bytes for HEAD and %d for GET, want none for HEAD only",
+				path, len(headBody), len(getBody))
+		}
+		for _, header := range []string{HeaderTotalCount, "Link", echo.HeaderContentType} {
+			if head.Header.Get(header) != get.Header.Get(header) {
+				t.Errorf("%s: got %s %q for HEAD, want %q as for GET",
+					path, header, head.Header.Get(header), get.Header.Get(header))
+			}
+		}
+	}
+
+	// the count covers every tag, whatever the page size
+	head, err := http.Head(server.URL + "/v2/johndoe/alpine/tags/list?n=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.Body.Close()
+	if head.Header.Get(HeaderTotalCount) != "4" || head.Header.Get("Link") == "" {
+		t.Errorf("got %s %s and Link %q, want 4 and the next page", HeaderTotalCount,
+			head.Header.Get(HeaderTotalCount), head.Header.Get("Link"))
+	}
+}
+
+// mountStore has the layers used by the manifests of other repositories
+type mountStore struct {
+	*uploadStore
+	repositoryLayers map[string]map[string]bool
+}
+
+func (s *mountStore) RepositoryHasLayer(_ context.Context, namespace, dig string) (bool, error) {
+	return s.repositoryLayers[namespace][dig], nil
+}
+
+func TestBlobMount(t *testing.T) {
+	dig := digest.FromBytes([]byte("a shared layer"))
+	tests := []struct {
+		name    string
+		from    string
+		allowed bool
+		want    int
+	}{
+		{name: "accessible repository", from: "janedoe/public", allowed: true, want: http.StatusCreated},
+		{name: "inaccessible repository", from: "janedoe/private", want: http.StatusAccepted},
+		{name: "accessible repository without the blob", from: "janedoe/empty", allowed: true, want: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		store := &mountStore{uploadStore: newUploadStore(), repositoryLayers: map[string]map[string]bool{
+			"janedoe/public":  {dig: true},
+			"janedoe/private": {dig: true},
+		}}
+		r := newTestRegistry(store, memory.New())
+		target := "/v2/" + testNamespace + "/blobs/uploads/?mount=" + dig + "&from=" + tt.from
+		ctx, rec := newTestContext(http.MethodPost, target, testNamespace)
+		if tt.allowed {
+			ctx.Set(types.BlobMountAllowedKey, true)
+		}
+		if err := r.StartUpload(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if tt.want == http.StatusCreated {
+			if location := rec.Header().Get("Location"); location != "/v2/"+testNamespace+"/blobs/"+dig {
+				t.Errorf("%s: got Location %s, want the mounted blob", tt.name, location)
+			}
+			continue
+		}
+		// the fallback is a regular upload, nothing tells that the blob exists
+		if rec.Header().Get(HeaderDockerContentDigest) != "" || rec.Header().Get("Docker-Upload-UUID") == "" {
+			t.Errorf("%s: got headers %v, want those of a new upload", tt.name, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// GetRepository returns the repository with its tags and manifests, including the config and layers of the image
+// manifests
+// GET /v2/<name>/repository
+func (r *registry) GetRepository(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	repo, err := r.store.GetRepository(ctx.Request().Context(), namespace)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeNameUnknown, err.Error(), echo.Map{"namespace": namespace})
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, repo)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// nestedRepositoryStore returns repo for testNamespace, the other repositories aren't found
+type nestedRepositoryStore struct {
+	postgres.PersistentStore
+	repo *types.Repository
+}
+
+func (s *nestedRepositoryStore) GetRepository(_ context.Context, namespace string) (*types.Repository, error) {
+	if namespace != testNamespace {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY: %w", postgres.ErrNotFound)
+	}
+	return s.repo, nil
+}
+
+func TestGetRepository(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	shared := &types.Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: "sha256:aaa", Size: 512}
+	repo := &types.Repository{
+		CreatedAt:  &now,
+		UpdatedAt:  &now,
+		Namespace:  testNamespace,
+		Visibility: types.RepositoryVisibilityPublic,
+		Tags:       []*types.ConfigV2{{Namespace: testNamespace, Reference: "latest", Digest: "sha256:m1"}},
+		Manifests: []*types.ManifestDescriptor{
+			{
+				CreatedAt: now,
+				UpdatedAt: now,
+				Config:    &types.Descriptor{Digest: "sha256:c1", Size: 64},
+				MediaType: "application/vnd.oci.image.manifest.v1+json",
+				Digest:    "sha256:m1",
+				Tags:      []string{"latest"},
+				Layers:    []*types.Descriptor{shared, {Digest: "sha256:bbb", Size: 256}},
+				Size:      832,
+			},
+			{
+				CreatedAt: now,
+				UpdatedAt: now,
+				MediaType: "application/vnd.oci.image.manifest.v1+json",
+				Digest:    "sha256:m2",
+				Tags:      []string{},
+				Layers:    []*types.Descriptor{shared},
+				Size:      512,
+			},
+		},
+	}
+	r := newTestRegistry(&nestedRepositoryStore{repo: repo}, memory.New())
+
+	ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/repository", testNamespace)
+	if err := r.GetRepository(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got types.Repository
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, repo) {
+		t.Errorf("got repository %+v, want %+v", got, repo)
+	}
+
+	ctx, rec = newTestContext(http.MethodGet, "/v2/johndoe/missing/repository", "johndoe/missing")
+	if err := r.GetRepository(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d for a missing repository, want %d", rec.Code, http.StatusNotFound)
+	}
+	var errs RegistryErrors
+	if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs.Errors) != 1 || errs.Errors[0].Code != RegistryErrorCodeNameUnknown {
+		t.Errorf("got errors %+v, want %s", errs.Errors, RegistryErrorCodeNameUnknown)
+	}
+}
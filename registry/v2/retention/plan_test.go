@@ -0,0 +1,161 @@
+package retention
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// planRefs is a repository with tags and untagged manifests, most recent first. v4 is also pushed by digest, v3
+// was pushed by digest before it was tagged
+func planRefs(now time.Time) []*types.ConfigV2 {
+	ref := func(reference, digest string, days int) *types.ConfigV2 {
+		return &types.ConfigV2{
+			Reference: reference,
+			Digest:    digest,
+			Layers:    []string{"layer-" + digest},
+			UpdatedAt: now.AddDate(0, 0, -days),
+		}
+	}
+
+	return []*types.ConfigV2{
+		ref("v5", "sha256:v5", 1),
+		ref("sha256:u2", "sha256:u2", 2),
+		ref("v4", "sha256:v4", 5),
+		ref("sha256:v4", "sha256:v4", 5),
+		ref("dev-1", "sha256:dev", 20),
+		ref("sha256:u1", "sha256:u1", 30),
+		ref("v3", "sha256:v3", 40),
+		ref("sha256:v3", "sha256:v3", 45),
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        types.RetentionPolicy
+		wantTags      []string
+		wantManifests []string
+		wantLayers    []string
+	}{
+		{
+			name:       "keep last",
+			policy:     types.RetentionPolicy{KeepLast: 2},
+			wantTags:   []string{"dev-1", "v3"},
+			wantLayers: []string{"layer-sha256:dev", "layer-sha256:v3"},
+		},
+		{
+			name:       "tag age",
+			policy:     types.RetentionPolicy{MaxTagAgeDays: 10},
+			wantTags:   []string{"dev-1", "v3"},
+			wantLayers: []string{"layer-sha256:dev", "layer-sha256:v3"},
+		},
+		{
+			name:       "keep last or recent enough",
+			policy:     types.RetentionPolicy{KeepLast: 1, MaxTagAgeDays: 10},
+			wantTags:   []string{"dev-1", "v3"},
+			wantLayers: []string{"layer-sha256:dev", "layer-sha256:v3"},
+		},
+		{
+			name:       "glob tag pattern",
+			policy:     types.RetentionPolicy{TagPattern: "v*", KeepLast: 1},
+			wantTags:   []string{"v4", "v3"},
+			wantLayers: []string{"layer-sha256:v4", "layer-sha256:v3"},
+		},
+		{
+			name:       "regex tag pattern",
+			policy:     types.RetentionPolicy{TagPattern: "/^dev-/", MaxTagAgeDays: 10},
+			wantTags:   []string{"dev-1"},
+			wantLayers: []string{"layer-sha256:dev"},
+		},
+		{
+			name:          "untagged age",
+			policy:        types.RetentionPolicy{UntaggedMaxAgeDays: 7},
+			wantManifests: []string{"sha256:u1"},
+			wantLayers:    []string{"layer-sha256:u1"},
+		},
+		{
+			// v3 is untagged once its tag is deleted, v4 is too but isn't old enough
+			name:          "untagged once the tags are deleted",
+			policy:        types.RetentionPolicy{KeepLast: 1, UntaggedMaxAgeDays: 7},
+			wantTags:      []string{"v4", "dev-1", "v3"},
+			wantManifests: []string{"sha256:u1", "sha256:v3"},
+			wantLayers: []string{
+				"layer-sha256:v4", "layer-sha256:dev", "layer-sha256:v3", "layer-sha256:u1", "layer-sha256:v3",
+			},
+		},
+		{name: "no rules", policy: types.RetentionPolicy{}},
+	}
+
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := registry.TagMatcher(tt.policy.TagPattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tags, manifests, layers := plan(&tt.policy, match, planRefs(now), now)
+			if tt.wantTags == nil {
+				tt.wantTags = []string{}
+			}
+			if tt.wantManifests == nil {
+				tt.wantManifests = []string{}
+			}
+			if !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("got tags %v, want %v", tags, tt.wantTags)
+			}
+			if !reflect.DeepEqual(manifests, tt.wantManifests) {
+				t.Errorf("got manifests %v, want %v", manifests, tt.wantManifests)
+			}
+			if !reflect.DeepEqual(layers, tt.wantLayers) {
+				t.Errorf("got layers %v, want %v", layers, tt.wantLayers)
+			}
+		})
+	}
+}
+
+// TestApplyDryRun checks that a dry run reports what a run deletes, without committing anything
+func TestApplyDryRun(t *testing.T) {
+	now := time.Now()
+	policy := &types.RetentionPolicy{Namespace: "johndoe/alpine", KeepLast: 1, UntaggedMaxAgeDays: 7}
+
+	reports := make(map[bool]*types.RetentionReport)
+	for _, dryRun := range []bool{true, false} {
+		store := &retentionStore{refs: planRefs(now)}
+		storage := memory.New()
+		e := &evaluator{store: store, dfs: storage}
+
+		report, err := e.apply(context.Background(), policy, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports[dryRun] = report
+
+		wantCommits := 1
+		if dryRun {
+			wantCommits = 0
+		}
+		if store.commits != wantCommits {
+			t.Errorf("dry run %t: got %d commits, want %d", dryRun, store.commits, wantCommits)
+		}
+		if dryRun && storage.Calls("DeleteObject") != 0 {
+			t.Errorf("got %d DFS objects deleted in a dry run, want none", storage.Calls("DeleteObject"))
+		}
+	}
+
+	dry, run := reports[true], reports[false]
+	if !reflect.DeepEqual(dry.DeletedTags, run.DeletedTags) ||
+		!reflect.DeepEqual(dry.DeletedManifests, run.DeletedManifests) ||
+		!reflect.DeepEqual(dry.DeletedLayers, run.DeletedLayers) {
+		t.Errorf("got dry run report %+v, want the report of the run %+v", dry, run)
+	}
+	if !dry.DryRun || run.DryRun {
+		t.Errorf("got dry run %t and %t in the reports, want true and false", dry.DryRun, run.DryRun)
+	}
+}
@@ -0,0 +1,426 @@
+// Package retention deletes the tags and untagged manifests of a repository according to its retention policy
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	dfsImpl "github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/telemetry"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultInterval = time.Hour * 24
+
+type Evaluator interface {
+	// Apply evaluates the policy of a repository. In dry-run mode everything is deleted in a txn which is
+	// rolled back, so the report is exactly what a real run would delete
+	Apply(ctx context.Context, namespace string, dryRun bool) (*types.RetentionReport, error)
+	// ApplyAll evaluates the policies of every repository, a failing repository doesn't stop the others
+	ApplyAll(ctx context.Context, dryRun bool) ([]*types.RetentionReport, error)
+
+	// GetPolicy - GET /admin/retention/:username/:imagename
+	GetPolicy(ctx echo.Context) error
+	// SetPolicy - PUT /admin/retention/:username/:imagename
+	SetPolicy(ctx echo.Context) error
+	// DeletePolicy - DELETE /admin/retention/:username/:imagename
+	DeletePolicy(ctx echo.Context) error
+	// ApplyPolicy - POST /admin/retention/:username/:imagename/apply?dry_run=true
+	ApplyPolicy(ctx echo.Context) error
+	// ApplyPolicies - POST /admin/retention/apply?dry_run=true
+	ApplyPolicies(ctx echo.Context) error
+
+	// Close stops the scheduled runs, waiting for the current one to finish
+	Close()
+}
+
+type evaluator struct {
+	store  postgres.PersistentStore
+	dfs    dfsImpl.DFS
+	logger telemetry.Logger
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New starts the scheduled runs when they're enabled in the config. The DFS objects of the deleted manifests and
+// layers are deleted from dfs
+func New(
+	cfg *config.Retention,
+	store postgres.PersistentStore,
+	dfs dfsImpl.DFS,
+	logger telemetry.Logger,
+) Evaluator {
+	e := &evaluator{
+		store:  store,
+		dfs:    dfs,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if cfg == nil || !cfg.Enabled {
+		close(e.done)
+		return e
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	go e.run(interval, cfg.DryRun)
+	return e
+}
+
+func (e *evaluator) Close() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *evaluator) run(interval time.Duration, dryRun bool) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reports, err := e.ApplyAll(context.Background(), dryRun)
+			if err != nil {
+				color.Red("error applying retention policies: %s", err)
+			}
+			for _, report := range reports {
+				color.Yellow(
+					"retention: %s: deleted %d tags, %d manifests and %d layers (dry run: %t)",
+					report.Namespace,
+					len(report.DeletedTags),
+					len(report.DeletedManifests),
+					len(report.DeletedLayers),
+					report.DryRun,
+				)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *evaluator) Apply(ctx context.Context, namespace string, dryRun bool) (*types.RetentionReport, error) {
+	policy, err := e.store.GetRetentionPolicy(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.apply(ctx, policy, dryRun)
+}
+
+func (e *evaluator) ApplyAll(ctx context.Context, dryRun bool) ([]*types.RetentionReport, error) {
+	policies, err := e.store.GetRetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*types.RetentionReport
+	for _, policy := range policies {
+		report, applyErr := e.apply(ctx, policy, dryRun)
+		if applyErr != nil {
+			color.Red("error applying retention policy of %s: %s", policy.Namespace, applyErr)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (e *evaluator) apply(
+	ctx context.Context,
+	policy *types.RetentionPolicy,
+	dryRun bool,
+) (*types.RetentionReport, error) {
+	match, err := registry.TagMatcher(policy.TagPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := e.store.NewTxn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := e.store.GetReferencesByPushTime(ctx, txn, policy.Namespace)
+	if err != nil {
+		_ = e.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	report := &types.RetentionReport{
+		Namespace:        policy.Namespace,
+		DryRun:           dryRun,
+		DeletedTags:      []string{},
+		DeletedManifests: []string{},
+		DeletedLayers:    []string{},
+	}
+
+	var layers []string
+	report.DeletedTags, report.DeletedManifests, layers = plan(policy, match, refs, time.Now())
+	keys, err := e.delete(ctx, txn, report, layers)
+	if err != nil {
+		_ = e.store.Abort(ctx, txn)
+		return nil, err
+	}
+
+	if dryRun {
+		return report, e.store.Abort(ctx, txn)
+	}
+
+	if err = e.store.Commit(ctx, txn); err != nil {
+		return report, err
+	}
+
+	// a DFS object which fails to be deleted is only leaked, the rows pointing to it are gone already
+	if err = registry.DeleteObjects(ctx, e.dfs, keys); err != nil {
+		color.Red("error deleting the DFS objects of %s: %s", report.Namespace, err)
+	}
+
+	return report, nil
+}
+
+// delete deletes the rows of the report and returns the DFS keys of the deleted manifests and layers, to be deleted
+// once the txn is committed
+func (e *evaluator) delete(
+	ctx context.Context,
+	txn pgx.Tx,
+	report *types.RetentionReport,
+	layers []string,
+) ([]string, error) {
+	if len(report.DeletedTags) > 0 {
+		if err := e.store.DeleteTags(ctx, txn, report.Namespace, report.DeletedTags); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := registry.TagObjectKeys(report.Namespace, report.DeletedTags...)
+	for _, dig := range report.DeletedManifests {
+		if err := e.store.DeleteManifest(ctx, txn, report.Namespace, dig); err != nil {
+			return nil, err
+		}
+
+		manifestKeys, err := registry.ManifestObjectKeys(ctx, e.store, txn, report.Namespace, dig)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, manifestKeys...)
+	}
+
+	deleted, err := registry.DeleteUnreferencedLayers(ctx, e.store, txn, layers)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_RETENTION_DELETE_LAYERS: %w", err)
+	}
+	for _, layer := range deleted {
+		report.DeletedLayers = append(report.DeletedLayers, layer.Digest)
+	}
+
+	return append(keys, registry.LayerObjectKeys(ctx, e.store, deleted)...), nil
+}
+
+// plan picks the tags and untagged manifests to delete, refs must be sorted by push time, most recent first.
+// The layers of everything that's deleted are returned too, the ones which end up unreferenced get deleted
+func plan(
+	policy *types.RetentionPolicy,
+	match func(tag string) bool,
+	refs []*types.ConfigV2,
+	now time.Time,
+) (tags []string, manifests []string, layers []string) {
+	tags, manifests = []string{}, []string{}
+	tagRules := policy.KeepLast > 0 || policy.MaxTagAgeDays > 0
+
+	tagged := make(map[string]bool)
+	matched := 0
+	for _, ref := range refs {
+		if ref.Reference == ref.Digest {
+			continue
+		}
+
+		if !tagRules || !match(ref.Reference) {
+			tagged[ref.Digest] = true
+			continue
+		}
+
+		matched++
+		if matched <= policy.KeepLast ||
+			(policy.MaxTagAgeDays > 0 && !olderThan(ref.UpdatedAt, policy.MaxTagAgeDays, now)) {
+			tagged[ref.Digest] = true
+			continue
+		}
+
+		tags = append(tags, ref.Reference)
+		layers = append(layers, ref.Layers...)
+	}
+
+	// a manifest pushed by digest is untagged once none of the remaining tags point to it
+	for _, ref := range refs {
+		if ref.Reference != ref.Digest || tagged[ref.Digest] {
+			continue
+		}
+
+		if policy.UntaggedMaxAgeDays > 0 && olderThan(ref.UpdatedAt, policy.UntaggedMaxAgeDays, now) {
+			manifests = append(manifests, ref.Digest)
+			layers = append(layers, ref.Layers...)
+		}
+	}
+
+	return tags, manifests, layers
+}
+
+func olderThan(t time.Time, days int, now time.Time) bool {
+	return t.Before(now.AddDate(0, 0, -days))
+}
+
+func (e *evaluator) GetPolicy(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	policy, err := e.store.GetRetentionPolicy(ctx.Request().Context(), namespace)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, policy)
+	e.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (e *evaluator) SetPolicy(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	var policy types.RetentionPolicy
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&policy); err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid retention policy",
+		})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+	_ = ctx.Request().Body.Close()
+
+	err := policy.Validate()
+	if err == nil {
+		_, err = registry.TagMatcher(policy.TagPattern)
+	}
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "invalid retention policy",
+		})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	policy.Namespace = types.Namespace(ctx)
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = time.Now()
+	if err = e.store.SetRetentionPolicy(ctx.Request().Context(), &policy); err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, policy)
+	e.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (e *evaluator) DeletePolicy(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	if err := e.store.DeleteRetentionPolicy(ctx.Request().Context(), namespace); err != nil {
+		echoErr := ctx.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.NoContent(http.StatusNoContent)
+	e.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (e *evaluator) ApplyPolicy(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	dryRun, err := dryRunParam(ctx)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	namespace := types.Namespace(ctx)
+	report, err := e.Apply(ctx.Request().Context(), namespace, dryRun)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, postgres.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		echoErr := ctx.JSON(status, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, report)
+	e.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func (e *evaluator) ApplyPolicies(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	dryRun, err := dryRunParam(ctx)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	reports, err := e.ApplyAll(ctx.Request().Context(), dryRun)
+	if err != nil {
+		echoErr := ctx.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		e.logger.Log(ctx, err)
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"reports": reports,
+	})
+	e.logger.Log(ctx, nil)
+	return echoErr
+}
+
+func dryRunParam(ctx echo.Context) (bool, error) {
+	param := ctx.QueryParam("dry_run")
+	if param == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(param)
+}
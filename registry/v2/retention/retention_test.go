@@ -0,0 +1,132 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// retentionStore has a repository with one old untagged manifest, whose layer nothing else uses. The txns are nil
+type retentionStore struct {
+	postgres.PersistentStore
+	refs    []*types.ConfigV2
+	layers  map[string]*types.LayerV2
+	commits int
+}
+
+func (s *retentionStore) NewTxn(context.Context) (pgx.Tx, error)              { return nil, nil }
+func (s *retentionStore) Commit(context.Context, pgx.Tx) error                { s.commits++; return nil }
+func (s *retentionStore) Abort(context.Context, pgx.Tx) error                 { return nil }
+func (s *retentionStore) DeleteLayerV2(context.Context, pgx.Tx, string) error { return nil }
+func (s *retentionStore) DeleteBlobV2(context.Context, pgx.Tx, string) error  { return nil }
+
+func (s *retentionStore) GetReferencesByPushTime(context.Context, pgx.Tx, string) ([]*types.ConfigV2, error) {
+	return s.refs, nil
+}
+
+func (s *retentionStore) DeleteManifest(context.Context, pgx.Tx, string, string) error { return nil }
+func (s *retentionStore) DeleteTags(context.Context, pgx.Tx, string, []string) error   { return nil }
+
+func (s *retentionStore) GetManifestReferenceCount(context.Context, pgx.Tx, string) (int64, error) {
+	return 0, nil
+}
+
+func (s *retentionStore) GetLayerReferenceCount(context.Context, pgx.Tx, string) (int64, error) {
+	return 0, nil
+}
+
+func (s *retentionStore) GetLayer(_ context.Context, digest string) (*types.LayerV2, error) {
+	if layer, ok := s.layers[digest]; ok {
+		return layer, nil
+	}
+
+	return nil, postgres.ErrNotFound
+}
+
+func (s *retentionStore) GetCompressedLayer(context.Context, string) (*types.CompressedLayer, error) {
+	return nil, postgres.ErrNotFound
+}
+
+func TestApplyDeletesObjects(t *testing.T) {
+	const namespace = "johndoe/alpine"
+	manifest := &types.ConfigV2{
+		Namespace: namespace,
+		Reference: "sha256:manifest",
+		Digest:    "sha256:manifest",
+		Layers:    []string{"sha256:layer"},
+		UpdatedAt: time.Now().AddDate(0, 0, -10),
+	}
+	wantDeleted := []string{
+		registry.GetManifestIdentifier(namespace, manifest.Digest),
+		registry.GetManifestContentIdentifier(manifest.Digest),
+		registry.GetLayerIdentifier("layer-uuid"),
+	}
+	policy := &types.RetentionPolicy{Namespace: namespace, UntaggedMaxAgeDays: 7}
+
+	for _, dryRun := range []bool{true, false} {
+		storage := memory.New()
+		for _, key := range wantDeleted {
+			storage.Put(key, []byte(key))
+		}
+		e := &evaluator{
+			store: &retentionStore{
+				refs:   []*types.ConfigV2{manifest},
+				layers: map[string]*types.LayerV2{"sha256:layer": {Digest: "sha256:layer", UUID: "layer-uuid"}},
+			},
+			dfs: storage,
+		}
+
+		report, err := e.apply(context.Background(), policy, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.DeletedManifests) != 1 || len(report.DeletedLayers) != 1 {
+			t.Fatalf("dry run %t: got report %+v, want the manifest and its layer deleted", dryRun, report)
+		}
+
+		for _, key := range wantDeleted {
+			want := 1
+			if dryRun {
+				want = 0
+			}
+			if got := storage.Deletes(key); got != want {
+				t.Errorf("dry run %t: got %d deletes of %s, want %d", dryRun, got, key, want)
+			}
+		}
+	}
+}
+
+// TestApplyDeletesLegacyTagObjects checks that the objects of the tags pushed before the manifests were stored by
+// digest are deleted with the tags
+func TestApplyDeletesLegacyTagObjects(t *testing.T) {
+	const namespace = "johndoe/alpine"
+	refs := []*types.ConfigV2{
+		{Namespace: namespace, Reference: "v2", Digest: "sha256:v2", UpdatedAt: time.Now()},
+		{Namespace: namespace, Reference: "v1", Digest: "sha256:v1", UpdatedAt: time.Now().AddDate(0, 0, -10)},
+	}
+	storage := memory.New()
+	for _, ref := range refs {
+		storage.Put(registry.GetManifestIdentifier(namespace, ref.Reference), []byte(ref.Digest))
+	}
+	e := &evaluator{store: &retentionStore{refs: refs}, dfs: storage}
+
+	report, err := e.apply(context.Background(), &types.RetentionPolicy{Namespace: namespace, KeepLast: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DeletedTags) != 1 || report.DeletedTags[0] != "v1" {
+		t.Fatalf("got tags %v deleted, want v1", report.DeletedTags)
+	}
+	if got := storage.Deletes(registry.GetManifestIdentifier(namespace, "v1")); got != 1 {
+		t.Errorf("got %d deletes of the object of v1, want 1", got)
+	}
+	if got := storage.Deletes(registry.GetManifestIdentifier(namespace, "v2")); got != 0 {
+		t.Errorf("got %d deletes of the object of v2, want none", got)
+	}
+}
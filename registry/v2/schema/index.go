@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+// mediaTypePattern is the pattern of the mediaType of descriptor.json
+var mediaTypePattern = regexp.MustCompile( //nolint
+	`^[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}/[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}$`,
+)
+
+type (
+	// Index is what the registry keeps of an image index or a manifest list once it's validated
+	Index struct {
+		MediaType    string
+		ArtifactType string
+		Manifests    []Descriptor
+	}
+
+	// Descriptor is a sub-manifest of an index
+	Descriptor struct {
+		Platform  *Platform `json:"platform,omitempty"`
+		MediaType string    `json:"mediaType"`
+		Digest    string    `json:"digest"`
+		Size      int64     `json:"size"`
+	}
+
+	Platform struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	}
+)
+
+// ValidateIndex checks an image index or a manifest list against the rules of image-index.json while it's decoded,
+// one sub-manifest at a time, instead of decoding the whole index into a generic document first like Validate does.
+// Large indexes, with hundreds of platforms, are validated without holding a second copy of them in memory. The
+// mediaType field, if any, must be an index media type. The returned error is an *Error
+func (v *Validator) ValidateIndex(r io.Reader) (*Index, error) {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{', "/"); err != nil {
+		return nil, err
+	}
+
+	index := &Index{}
+	hasSchemaVersion, hasManifests := false, false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, &Error{Pointer: "/", Message: err.Error()}
+		}
+		key, _ := token.(string)
+		pointer := "/" + key
+
+		switch key {
+		case "schemaVersion":
+			var schemaVersion int
+			if err = decoder.Decode(&schemaVersion); err != nil || schemaVersion != 2 {
+				return nil, &Error{Pointer: pointer, Message: "value must be 2"}
+			}
+			hasSchemaVersion = true
+		case "mediaType":
+			if err = decoder.Decode(&index.MediaType); err != nil {
+				return nil, &Error{Pointer: pointer, Message: err.Error()}
+			}
+			if index.MediaType != "" && index.MediaType != mediaTypeDockerManifestList &&
+				index.MediaType != mediaTypeOCIImageIndex {
+				return nil, &Error{Pointer: pointer, Message: "must be an image index or a manifest list"}
+			}
+		case "artifactType":
+			if err = decoder.Decode(&index.ArtifactType); err != nil || !mediaTypePattern.MatchString(index.ArtifactType) {
+				return nil, &Error{Pointer: pointer, Message: "must be a media type"}
+			}
+		case "manifests":
+			if index.Manifests, err = decodeDescriptors(decoder, pointer); err != nil {
+				return nil, err
+			}
+			hasManifests = true
+		case "subject":
+			var subject Descriptor
+			if err = decoder.Decode(&subject); err != nil {
+				return nil, &Error{Pointer: pointer, Message: err.Error()}
+			}
+			if err = validateDescriptor(pointer, &subject); err != nil {
+				return nil, err
+			}
+		case "annotations":
+			var annotations map[string]string
+			if err = decoder.Decode(&annotations); err != nil {
+				return nil, &Error{Pointer: pointer, Message: err.Error()}
+			}
+		default:
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return nil, &Error{Pointer: pointer, Message: err.Error()}
+			}
+		}
+	}
+
+	if err := expectDelim(decoder, '}', "/"); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, &Error{Pointer: "/", Message: "unexpected data after the index"}
+	}
+
+	switch {
+	case !hasSchemaVersion:
+		return nil, &Error{Pointer: "/", Message: "missing properties: 'schemaVersion'"}
+	case !hasManifests:
+		return nil, &Error{Pointer: "/", Message: "missing properties: 'manifests'"}
+	}
+
+	return index, nil
+}
+
+// decodeDescriptors decodes the manifests array, a descriptor at a time
+func decodeDescriptors(decoder *json.Decoder, pointer string) ([]Descriptor, error) {
+	if err := expectDelim(decoder, '[', pointer); err != nil {
+		return nil, err
+	}
+
+	descriptors := []Descriptor{}
+	for i := 0; decoder.More(); i++ {
+		descriptorPointer := fmt.Sprintf("%s/%d", pointer, i)
+
+		var descriptor Descriptor
+		if err := decoder.Decode(&descriptor); err != nil {
+			return nil, &Error{Pointer: descriptorPointer, Message: err.Error()}
+		}
+		if err := validateDescriptor(descriptorPointer, &descriptor); err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+
+	if err := expectDelim(decoder, ']', pointer); err != nil {
+		return nil, err
+	}
+
+	return descriptors, nil
+}
+
+// validateDescriptor checks the fields descriptor.json requires, the unknown fields are ignored
+func validateDescriptor(pointer string, descriptor *Descriptor) error {
+	if !mediaTypePattern.MatchString(descriptor.MediaType) {
+		return &Error{Pointer: pointer + "/mediaType", Message: "must be a media type"}
+	}
+	if descriptor.Size < 0 {
+		return &Error{Pointer: pointer + "/size", Message: "must be >= 0"}
+	}
+	if err := digest.Validate(descriptor.Digest); err != nil {
+		return &Error{Pointer: pointer + "/digest", Message: err.Error()}
+	}
+	if p := descriptor.Platform; p != nil {
+		var missing []string
+		if p.Architecture == "" {
+			missing = append(missing, "'architecture'")
+		}
+		if p.OS == "" {
+			missing = append(missing, "'os'")
+		}
+		if len(missing) > 0 {
+			return &Error{Pointer: pointer + "/platform", Message: "missing properties: " + strings.Join(missing, ", ")}
+		}
+	}
+
+	return nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim, pointer string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return &Error{Pointer: pointer, Message: err.Error()}
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return &Error{Pointer: pointer, Message: fmt.Sprintf("expected %s, got %v", delim, token)}
+	}
+
+	return nil
+}
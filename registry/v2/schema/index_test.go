@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+// testIndex is an OCI image index with n platform manifests
+func testIndex(tb testing.TB, n int) []byte {
+	tb.Helper()
+
+	manifests := make([]Descriptor, 0, n)
+	for i := 0; i < n; i++ {
+		manifests = append(manifests, Descriptor{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Digest:    digest.FromBytes([]byte(fmt.Sprintf("manifest-%d", i))),
+			Size:      int64(512 + i),
+			Platform:  &Platform{Architecture: fmt.Sprintf("arch%d", i), OS: "linux"},
+		})
+	}
+
+	bz, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIImageIndex,
+		"manifests":     manifests,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return bz
+}
+
+func TestValidateIndex(t *testing.T) {
+	v, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := testIndex(t, 3)
+	tests := []struct {
+		name    string
+		index   []byte
+		wantErr bool
+	}{
+		{name: "valid", index: valid},
+		{name: "unsupported digest", index: bytes.Replace(valid, []byte("sha256:"), []byte("md5:"), 1), wantErr: true},
+		{name: "manifest media type", index: bytes.Replace(
+			valid, []byte(mediaTypeOCIImageIndex), []byte("application/vnd.oci.image.manifest.v1+json"), 1,
+		), wantErr: true},
+		{name: "no manifests", index: []byte(`{"schemaVersion":2}`), wantErr: true},
+		{name: "not an object", index: []byte(`[]`), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := v.ValidateIndex(bytes.NewReader(tt.index))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && len(index.Manifests) != 3 {
+				t.Errorf("got %d manifests, want 3", len(index.Manifests))
+			}
+		})
+	}
+}
+
+// BenchmarkValidateIndex compares the streaming validation of an index with decoding it into a generic document
+// for the JSON schema
+func BenchmarkValidateIndex(b *testing.B) {
+	v, err := New()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, n := range []int{10, 1000} {
+		index := testIndex(b, n)
+
+		b.Run(fmt.Sprintf("ValidateIndex/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(index)))
+			for i := 0; i < b.N; i++ {
+				if _, err := v.ValidateIndex(bytes.NewReader(index)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Validate/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(index)))
+			for i := 0; i < b.N; i++ {
+				if err := v.Validate(mediaTypeOCIImageIndex, index); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Package schema validates the manifests pushed to the registry against the OCI and Docker JSON schemas,
+// they are embedded in the binary
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS //nolint
+
+// baseURL is the $id prefix of the embedded schemas, nothing is fetched from it
+const baseURL = "https://openregistry.dev/schemas/"
+
+const (
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIImageIndex      = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerSchema1      = "application/vnd.docker.distribution.manifest.v1+json"
+	mediaTypeDockerSchema1JWS   = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+)
+
+// Error points to the offending field of the manifest with a JSON pointer, e.g. /layers/0/size
+type Error struct {
+	Pointer string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pointer, e.Message)
+}
+
+type Validator struct {
+	manifest *jsonschema.Schema
+	index    *jsonschema.Schema
+}
+
+// New compiles the embedded schemas
+func New() (*Validator, error) {
+	compiler := jsonschema.NewCompiler()
+	err := fs.WalkDir(schemas, "schemas", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		bz, err := schemas.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return compiler.AddResource(baseURL+path.Base(p), bytes.NewReader(bz))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERR_LOAD_MANIFEST_SCHEMAS: %w", err)
+	}
+
+	v := &Validator{}
+	if v.manifest, err = compiler.Compile(baseURL + "image-manifest.json"); err != nil {
+		return nil, fmt.Errorf("ERR_COMPILE_MANIFEST_SCHEMA: %w", err)
+	}
+	if v.index, err = compiler.Compile(baseURL + "image-index.json"); err != nil {
+		return nil, fmt.Errorf("ERR_COMPILE_INDEX_SCHEMA: %w", err)
+	}
+
+	return v, nil
+}
+
+// Validate checks the manifest against the schema for its media type, the mediaType field of the manifest
+// takes precedence over the Content-Type it was pushed with. Every descriptor digest must be a digest the
+// registry supports. Docker schema 1 manifests are not validated. The returned error is an *Error
+func (v *Validator) Validate(mediaType string, bz []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(bz))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return &Error{Pointer: "/", Message: err.Error()}
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return &Error{Pointer: "/", Message: "manifest must be a JSON object"}
+	}
+
+	if mt, ok := obj["mediaType"].(string); ok && mt != "" {
+		mediaType = mt
+	}
+
+	s := v.manifest
+	switch mediaType {
+	case mediaTypeDockerSchema1, mediaTypeDockerSchema1JWS:
+		return nil
+	case mediaTypeDockerManifestList, mediaTypeOCIImageIndex:
+		s = v.index
+	default:
+		if _, isIndex := obj["manifests"]; isIndex {
+			s = v.index
+		}
+	}
+
+	if err := s.Validate(doc); err != nil {
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			return leafError(ve)
+		}
+		return &Error{Pointer: "/", Message: err.Error()}
+	}
+
+	return validateDigests(obj)
+}
+
+// leafError follows the first cause down to the error which names the actual field
+func leafError(ve *jsonschema.ValidationError) *Error {
+	for len(ve.Causes) > 0 {
+		ve = ve.Causes[0]
+	}
+
+	pointer := ve.InstanceLocation
+	if pointer == "" {
+		pointer = "/"
+	}
+
+	return &Error{Pointer: pointer, Message: ve.Message}
+}
+
+// validateDigests runs after the schema validation, so the descriptors are known to be well formed objects
+func validateDigests(obj map[string]interface{}) error {
+	check := func(pointer string, descriptor interface{}) error {
+		d, ok := descriptor.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		dig, _ := d["digest"].(string)
+		if err := digest.Validate(dig); err != nil {
+			return &Error{Pointer: pointer + "/digest", Message: err.Error()}
+		}
+		return nil
+	}
+
+	for _, field := range []string{"config", "subject"} {
+		if descriptor, ok := obj[field]; ok {
+			if err := check("/"+field, descriptor); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, field := range []string{"layers", "manifests"} {
+		descriptors, _ := obj[field].([]interface{})
+		for i, descriptor := range descriptors {
+			if err := check(fmt.Sprintf("/%s/%d", field, i), descriptor); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testConfig = `{"mediaType":"application/vnd.oci.image.config.v1+json",` +
+		`"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":1469}`
+	testLayer = `{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip",` +
+		`"digest":"sha256:2db29710123e3e53a794f2694094b9b4338aa9ee5c40b930cb8063a1be392c54","size":%s}`
+)
+
+func testManifest(config, layerSize string) []byte {
+	fields := []string{`"schemaVersion":2`, `"mediaType":"application/vnd.oci.image.manifest.v1+json"`}
+	if config != "" {
+		fields = append(fields, `"config":`+config)
+	}
+	fields = append(fields, `"layers":[`+strings.Replace(testLayer, "%s", layerSize, 1)+`]`)
+
+	return []byte("{" + strings.Join(fields, ",") + "}")
+}
+
+func TestValidateManifest(t *testing.T) {
+	v, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		manifest    []byte
+		wantPointer string
+		wantMessage string
+	}{
+		{name: "valid", manifest: testManifest(testConfig, "3370706")},
+		{name: "negative layer size", manifest: testManifest(testConfig, "-1"), wantPointer: "/layers/0/size"},
+		{name: "missing config", manifest: testManifest("", "3370706"), wantPointer: "/", wantMessage: "config"},
+		{
+			name:        "negative config size",
+			manifest:    testManifest(strings.Replace(testConfig, "1469", "-1469", 1), "3370706"),
+			wantPointer: "/config/size",
+		},
+		{
+			name:        "malformed config digest",
+			manifest:    testManifest(strings.Replace(testConfig, "sha256:4413", "sha256:XY13", 1), "3370706"),
+			wantPointer: "/config/digest",
+		},
+		{name: "not JSON", manifest: []byte("{"), wantPointer: "/"},
+		{
+			name:     "docker schema 1 is not validated",
+			manifest: []byte(`{"schemaVersion":1,"mediaType":"application/vnd.docker.distribution.manifest.v1+json"}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate("application/vnd.oci.image.manifest.v1+json", tt.manifest)
+			if tt.wantPointer == "" {
+				if err != nil {
+					t.Fatalf("got error %s, want the manifest to be valid", err)
+				}
+				return
+			}
+
+			schemaErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("got error %v, want a schema error", err)
+			}
+			if schemaErr.Pointer != tt.wantPointer {
+				t.Errorf("got pointer %s (%s), want %s", schemaErr.Pointer, schemaErr.Message, tt.wantPointer)
+			}
+			if !strings.Contains(schemaErr.Message, tt.wantMessage) {
+				t.Errorf("got message %s, want it to mention %s", schemaErr.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// GetRepositoryStats
+// GET /v2/<name>/stats
+func (r *registry) GetRepositoryStats(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+
+	stats, err := r.stats.Get(ctx.Request().Context(), namespace)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, stats)
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,202 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// TagMatcher parses a tag pattern, a pattern wrapped in slashes (/^v1\..*$/) is a regular expression,
+// anything else is a glob (ci-*). An empty pattern matches every tag
+func TagMatcher(pattern string) (func(tag string) bool, error) {
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("ERR_INVALID_TAG_REGEX: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	// check the glob once, path.Match only reports a bad pattern when it gets that far in the name
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("ERR_INVALID_TAG_GLOB: %w", err)
+	}
+
+	return func(tag string) bool {
+		ok, _ := path.Match(pattern, tag)
+		return ok
+	}, nil
+}
+
+// DeleteTags removes the tags matching the pattern, except for the keep_last most recently pushed ones.
+// Only tags are removed, the manifests they point to stay pullable by digest and through the surviving tags
+// DELETE /v2/<name>/tags?match=<pattern>&keep_last=<n>
+func (r *registry) DeleteTags(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	pattern := ctx.QueryParam("match")
+	keepLastParam := ctx.QueryParam("keep_last")
+
+	if pattern == "" && keepLastParam == "" {
+		errMsg := r.errorResponse(RegistryErrorCodeTagInvalid, "one of match or keep_last is required", nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	keepLast := 0
+	if keepLastParam != "" {
+		n, err := strconv.Atoi(keepLastParam)
+		if err != nil || n < 0 {
+			errMsg := r.errorResponse(RegistryErrorCodeTagInvalid, "keep_last must be a positive number", echo.Map{
+				"keep_last": keepLastParam,
+			})
+			echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+			r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+			return echoErr
+		}
+		keepLast = n
+	}
+
+	match, err := TagMatcher(pattern)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeTagInvalid, err.Error(), echo.Map{
+			"match": pattern,
+		})
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	txnOp, err := r.store.NewTxn(ctx.Request().Context())
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), echo.Map{
+			"reason": "PG_ERR_CREATE_NEW_TXN",
+		})
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	tags, err := r.store.GetTagsByPushTime(ctx.Request().Context(), txnOp, namespace)
+	if err != nil {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	// tags are sorted by push time, the first keepLast matching ones are the ones to keep
+	deleted := []string{}
+	kept := 0
+	for _, tag := range tags {
+		if !match(tag) {
+			continue
+		}
+		if kept < keepLast {
+			kept++
+			continue
+		}
+		deleted = append(deleted, tag)
+	}
+
+	if len(deleted) > 0 {
+		err = r.store.DeleteTags(ctx.Request().Context(), txnOp, namespace, deleted)
+	}
+	if err == nil {
+		err = r.store.Commit(ctx.Request().Context(), txnOp)
+	}
+	if err != nil {
+		_ = r.store.Abort(ctx.Request().Context(), txnOp)
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusInternalServerError, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	for _, tag := range deleted {
+		r.auditLogger.Record(ctx, types.AuditActionDelete, namespace, tag)
+		r.webhooks.Notify(&types.WebhookEvent{
+			Timestamp:  time.Now(),
+			Type:       types.WebhookEventDelete,
+			Repository: namespace,
+			Tag:        tag,
+		})
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"deleted": deleted,
+	})
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// ListTagsDetail lists the tags like ListTags, along with the manifest each of them points to and the time it was
+// first pushed (created_at) and last pushed (updated_at)
+// GET /v2/<name>/tags/detail?n=<n>&last=<tag>
+func (r *registry) ListTagsDetail(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+	pageSize, err := r.pageSize(ctx)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodePaginationNumberInvalid, err.Error(), echo.Map{
+			"n": ctx.QueryParam("n"),
+		})
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	configs, err := r.store.GetConfig(ctx.Request().Context(), namespace)
+	if err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(storeErrorStatus(err), errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	// the manifests pushed by digest are listed by their digest, they aren't tags
+	byTag := make(map[string]*types.ConfigV2, len(configs))
+	tags := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		if cfg.Reference != cfg.Digest {
+			byTag[cfg.Reference] = cfg
+			tags = append(tags, cfg.Reference)
+		}
+	}
+
+	details := []*types.ConfigV2{}
+	for _, tag := range tagsPage(ctx, "/v2/"+namespace+"/tags/detail", tags, ctx.QueryParam("last"), pageSize) {
+		cfg := byTag[tag]
+		details = append(details, &types.ConfigV2{
+			Reference:    cfg.Reference,
+			Digest:       cfg.Digest,
+			MediaType:    cfg.MediaType,
+			ArtifactType: cfg.ArtifactType,
+			Size:         cfg.Size,
+			CreatedAt:    cfg.CreatedAt,
+			UpdatedAt:    cfg.UpdatedAt,
+		})
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"name": namespace,
+		"tags": details,
+	})
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,227 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+type (
+	// tagStore holds the tags of a single repository, most recently pushed first
+	tagStore struct {
+		postgres.PersistentStore
+		tags    []string
+		commits int
+		aborts  int
+	}
+
+	webhookRecorder struct {
+		mu     sync.Mutex
+		events []*types.WebhookEvent
+	}
+)
+
+func (s *tagStore) NewTxn(context.Context) (pgx.Tx, error) { return nil, nil }
+
+func (s *tagStore) Commit(context.Context, pgx.Tx) error {
+	s.commits++
+	return nil
+}
+
+func (s *tagStore) Abort(context.Context, pgx.Tx) error {
+	s.aborts++
+	return nil
+}
+
+func (s *tagStore) GetTagsByPushTime(context.Context, pgx.Tx, string) ([]string, error) {
+	return append([]string{}, s.tags...), nil
+}
+
+func (s *tagStore) DeleteTags(_ context.Context, _ pgx.Tx, _ string, tags []string) error {
+	deleted := map[string]bool{}
+	for _, tag := range tags {
+		deleted[tag] = true
+	}
+
+	kept := []string{}
+	for _, tag := range s.tags {
+		if !deleted[tag] {
+			kept = append(kept, tag)
+		}
+	}
+	s.tags = kept
+	return nil
+}
+
+func (w *webhookRecorder) Notify(event *types.WebhookEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = append(w.events, event)
+}
+
+func (w *webhookRecorder) Close() {}
+
+func deleteTags(t *testing.T, store *tagStore, query url.Values) (int, []string) {
+	t.Helper()
+
+	r := newTestRegistry(store, nil)
+	hooks := &webhookRecorder{}
+	r.webhooks = hooks
+	ctx, rec := newTestContext(http.MethodDelete, "/v2/"+testNamespace+"/tags?"+query.Encode(), testNamespace)
+	if err := r.DeleteTags(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+
+	var body struct {
+		Deleted []string `json:"deleted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks.events) != len(body.Deleted) {
+		t.Errorf("got %d webhook events, want one for each of the %d deleted tags", len(hooks.events), len(body.Deleted))
+	}
+	return rec.Code, body.Deleted
+}
+
+func TestDeleteTags(t *testing.T) {
+	pushed := []string{"ci-5", "v1.2", "ci-4", "latest", "ci-3", "v1.1", "ci-2", "ci-1"}
+
+	tests := []struct {
+		name        string
+		query       url.Values
+		wantDeleted []string
+		wantKept    []string
+	}{
+		{
+			name:        "glob",
+			query:       url.Values{"match": {"ci-*"}},
+			wantDeleted: []string{"ci-5", "ci-4", "ci-3", "ci-2", "ci-1"},
+			wantKept:    []string{"v1.2", "latest", "v1.1"},
+		},
+		{
+			name:        "glob with keep last",
+			query:       url.Values{"match": {"ci-*"}, "keep_last": {"2"}},
+			wantDeleted: []string{"ci-3", "ci-2", "ci-1"},
+			wantKept:    []string{"ci-5", "v1.2", "ci-4", "latest", "v1.1"},
+		},
+		{
+			name:        "regex",
+			query:       url.Values{"match": {`/^v1\.\d+$/`}},
+			wantDeleted: []string{"v1.2", "v1.1"},
+			wantKept:    []string{"ci-5", "ci-4", "latest", "ci-3", "ci-2", "ci-1"},
+		},
+		{
+			name:        "keep last only",
+			query:       url.Values{"keep_last": {"3"}},
+			wantDeleted: []string{"latest", "ci-3", "v1.1", "ci-2", "ci-1"},
+			wantKept:    []string{"ci-5", "v1.2", "ci-4"},
+		},
+		{
+			name:        "keep more than matching",
+			query:       url.Values{"match": {"v1.*"}, "keep_last": {"5"}},
+			wantDeleted: []string{},
+			wantKept:    pushed,
+		},
+	}
+
+	for _, tt := range tests {
+		store := &tagStore{tags: append([]string{}, pushed...)}
+		code, deleted := deleteTags(t, store, tt.query)
+		if code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want 200", tt.name, code)
+		}
+		if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+			t.Errorf("%s: got deleted tags %v, want %v", tt.name, deleted, tt.wantDeleted)
+		}
+		if !reflect.DeepEqual(store.tags, tt.wantKept) {
+			t.Errorf("%s: got remaining tags %v, want %v", tt.name, store.tags, tt.wantKept)
+		}
+		if store.commits != 1 || store.aborts != 0 {
+			t.Errorf("%s: got %d commits and %d aborts, want one commit", tt.name, store.commits, store.aborts)
+		}
+	}
+}
+
+func TestDeleteTagsInvalidParams(t *testing.T) {
+	for _, query := range []url.Values{
+		{},
+		{"keep_last": {"-1"}},
+		{"keep_last": {"many"}},
+		{"match": {"ci-["}},
+		{"match": {"/(/"}},
+	} {
+		store := &tagStore{tags: []string{"latest"}}
+		if code, _ := deleteTags(t, store, query); code != http.StatusBadRequest {
+			t.Errorf("%v: got status %d, want 400", query, code)
+		}
+		if len(store.tags) != 1 || store.commits != 0 {
+			t.Errorf("%v: got tags %v and %d commits, want nothing deleted", query, store.tags, store.commits)
+		}
+	}
+}
+
+// configStore lists the manifests pushed to it
+type configStore struct {
+	postgres.PersistentStore
+	configs []*types.ConfigV2
+}
+
+func (s *configStore) GetConfig(context.Context, string) ([]*types.ConfigV2, error) {
+	return s.configs, nil
+}
+
+func TestListTagsDetail(t *testing.T) {
+	created := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	store := &configStore{configs: []*types.ConfigV2{
+		{Reference: "v2", Digest: "sha256:bbb", MediaType: mediaTypeOCIManifest, CreatedAt: updated, UpdatedAt: updated},
+		{Reference: "sha256:bbb", Digest: "sha256:bbb", MediaType: mediaTypeOCIManifest},
+		{Reference: "v1", Digest: "sha256:aaa", MediaType: mediaTypeOCIManifest, CreatedAt: created, UpdatedAt: updated},
+	}}
+	r := newTestRegistry(store, memory.New())
+
+	ctx, rec := newTestContext(http.MethodGet, "/v2/"+testNamespace+"/tags/detail?n=1", testNamespace)
+	if err := r.ListTagsDetail(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var body struct {
+		Name string            `json:"name"`
+		Tags []*types.ConfigV2 `json:"tags"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	// the tags are in lexical order, the manifest pushed by digest isn't a tag
+	if len(body.Tags) != 1 || body.Tags[0].Reference != "v1" {
+		t.Fatalf("got tags %+v, want v1", body.Tags)
+	}
+	tag := body.Tags[0]
+	if tag.Digest != "sha256:aaa" || !tag.CreatedAt.Equal(created) || !tag.UpdatedAt.Equal(updated) {
+		t.Errorf("got %s created at %s and updated at %s, want sha256:aaa created at %s and updated at %s",
+			tag.Digest, tag.CreatedAt, tag.UpdatedAt, created, updated)
+	}
+	if got := rec.Header().Get(HeaderTotalCount); got != "2" {
+		t.Errorf("got %s %s, want 2", HeaderTotalCount, got)
+	}
+	if link := rec.Header().Get("Link"); link != `</v2/`+testNamespace+`/tags/detail?n=1&last=v1>; rel="next"` {
+		t.Errorf("got Link %s, want the next page after v1", link)
+	}
+}
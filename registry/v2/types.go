@@ -5,11 +5,15 @@ import (
 	"time"
 
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/audit"
 	"github.com/containerish/OpenRegistry/config"
 	dfsImpl "github.com/containerish/OpenRegistry/dfs"
+	"github.com/containerish/OpenRegistry/registry/v2/schema"
+	"github.com/containerish/OpenRegistry/stats"
 	"github.com/containerish/OpenRegistry/store/postgres"
 	"github.com/containerish/OpenRegistry/telemetry"
-	"github.com/jackc/pgx/v4"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/containerish/OpenRegistry/webhooks"
 	"github.com/labstack/echo/v4"
 )
 
@@ -64,6 +68,27 @@ type RegistryError struct {
 const (
 	HeaderDockerContentDigest          = "Docker-Content-Digest"
 	HeaderDockerDistributionApiVersion = "Docker-Distribution-API-Version"
+
+	// DockerDistributionApiVersion is the Docker-Distribution-API-Version of every /v2 response
+	DockerDistributionApiVersion = "registry/2.0"
+
+	// HeaderTotalCount is the number of tags or repositories across all the pages of a list, it's not in the spec
+	HeaderTotalCount = "X-Total-Count"
+)
+
+// defaultChunkSize matches the default DFS chunk size set while reading the config
+const defaultChunkSize = 1024 * 1024 * 20
+
+// page sizes of the catalog and tags list, unless the config sets them
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Manifest media types that can reference other manifests
+const (
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIImageIndex      = "application/vnd.oci.image.index.v1+json"
 )
 
 // // OCI - Distribution Spec compliant Error Codes
@@ -84,6 +109,13 @@ const (
 	RegistryErrorCodeUnauthorized        = "UNAUTHORIZED"          // authentication is required
 	RegistryErrorCodeDenied              = "DENIED"                // request access to resource is denied
 	RegistryErrorCodeUnsupported         = "UNSUPPORTED"           // operation is not supported
+	RegistryErrorCodeTooManyRequests     = "TOOMANYREQUESTS"       // too many requests
+	// invalid number of results requested, not part of the spec but returned by the docker registry too
+	RegistryErrorCodePaginationNumberInvalid = "PAGINATION_NUMBER_INVALID"
+	// the registry is overloaded, the request can be retried later
+	RegistryErrorCodeUnavailable = "UNAVAILABLE"
+	// the Range of a blob request can't be satisfied, not part of the spec either
+	RegistryErrorCodeRangeInvalid = "RANGE_INVALID"
 )
 
 type (
@@ -93,26 +125,59 @@ type (
 		logger telemetry.Logger
 		store  postgres.PersistentStore
 		dfs    dfsImpl.DFS
-		txnMap map[string]TxnStore
-		mu     *sync.RWMutex
-		debug  bool
+		// uploads are the uploads in progress, by upload id
+		uploads map[string]uploadState
+		mu      *sync.RWMutex
+		debug   bool
+		// uploadKeys are the upload sessions started with an Idempotency-Key, by repository and key
+		uploadKeys map[string]uploadKey
+		// configCache holds the recently parsed image configs, keyed by config digest
+		configCache *imageConfigCache
+		auditLogger audit.Logger
+		webhooks    webhooks.Notifier
+		verifier    ManifestVerifier
+		schemas     *schema.Validator
+		stats       stats.Recorder
+		// compressor is only set when RecompressLayers is enabled
+		compressor LayerCompressor
+		// stager is only set when UploadStagingDir is, the chunks are staged on disk rather than uploaded as parts
+		stager *uploadStager
+		// metrics records the push and pull durations and sizes
+		metrics *transferMetrics
+		// stopReaper and reaperDone stop the reaping of the abandoned uploads, see Close
+		stopReaper chan struct{}
+		reaperDone chan struct{}
+		// compressions are the layers waiting to be compressed, stopCompressor and compressorDone stop compressing
+		// them, see Close
+		compressions   chan *types.LayerV2
+		stopCompressor chan struct{}
+		compressorDone chan struct{}
 	}
 
-	TxnStore struct {
-		txn         pgx.Tx
+	// uploadState is an upload in progress. It holds no txn, the layer is written in the txn of the request which
+	// completes the upload
+	uploadState struct {
+		layerKey    string
 		blobDigests []string
 		timeout     time.Duration
+		// startedAt is when the upload session started, for the upload duration metric
+		startedAt time.Time
+		// updatedAt is when the last chunk was accepted, the upload is reaped once it's idle for uploadSessionTTL
+		updatedAt time.Time
+		// digest is the running digest of the chunks, nil for the staged uploads and the restored ones
+		digest *uploadDigest
 	}
 
 	blobs struct {
 		mu                 *sync.RWMutex
-		contents           map[string][]byte
-		uploads            map[string][]byte
-		layers             map[string][]string
 		registry           *registry
 		blobCounter        map[string]int64
 		layerLengthCounter map[string]int64
-		layerParts         map[string][]s3types.CompletedPart
+		// layerParts are the DFS parts of the uploads. With UploadPartsInStore, only the parts which aren't
+		// appended to the upload session yet are kept here
+		layerParts map[string][]s3types.CompletedPart
+		// layerTails are the bytes of the uploads past their last full part, uploaded as the last part
+		layerTails map[string][]byte
 	}
 
 	ManifestList struct {
@@ -123,6 +188,7 @@ type (
 			Platform  struct {
 				Architecture string   `json:"architecture"`
 				Os           string   `json:"os"`
+				Variant      string   `json:"variant,omitempty"`
 				Features     []string `json:"features"`
 			} `json:"platform"`
 			Size int `json:"size"`
@@ -131,8 +197,10 @@ type (
 	}
 
 	ImageManifest struct {
-		Config        Config `json:"config"`
-		MediaType     string `json:"mediaType"`
+		Config    Config `json:"config"`
+		MediaType string `json:"mediaType"`
+		// ArtifactType is set by the OCI artifacts, e.g. SBOMs, signatures and Helm charts
+		ArtifactType  string `json:"artifactType,omitempty"`
 		Layers        Layers `json:"layers"`
 		SchemaVersion int    `json:"schemaVersion"`
 	}
@@ -151,11 +219,17 @@ type (
 )
 
 type Registry interface {
+	// ValidateRepositoryName is the middleware for the /v2/<name>/ routes
+	ValidateRepositoryName() echo.MiddlewareFunc
+
 	UploadProgress(ctx echo.Context) error
 
 	// GET /v2/<name>/blobs/<digest>
 	PullLayer(ctx echo.Context) error
 
+	// GET /v2/<name>/blobs/<digest>/download-url
+	BlobDownloadURL(ctx echo.Context) error
+
 	// GET /v2/
 	ApiVersion(ctx echo.Context) error
 
@@ -165,10 +239,34 @@ type Registry interface {
 	// HEAD /v2/<name>/blobs/<digest>
 	LayerExists(ctx echo.Context) error
 
+	// POST /v2/<name>/blobs/exists
+	BlobsExist(ctx echo.Context) error
+
 	// GET /v2/<name>/manifests/<ref>
 
 	PullManifest(ctx echo.Context) error
 
+	// GET /v2/<name>/manifests/<ref>/verify
+	VerifyManifest(ctx echo.Context) error
+
+	// GET /v2/<name>/manifests/<ref>/tree
+	ManifestTree(ctx echo.Context) error
+
+	// GET /v2/<name>/config/<ref>
+	GetImageConfig(ctx echo.Context) error
+
+	// GET /v2/<name>/quota
+	GetQuota(ctx echo.Context) error
+
+	// PUT /v2/<name>/visibility
+	UpdateRepositoryVisibility(ctx echo.Context) error
+
+	// GET /v2/<name>/stats
+	GetRepositoryStats(ctx echo.Context) error
+
+	// GET /v2/<name>/repository
+	GetRepository(ctx echo.Context) error
+
 	// PUT /v2/<name>/manifests/<reference>
 
 	PushManifest(ctx echo.Context) error
@@ -267,15 +365,25 @@ type Registry interface {
 	// GET /v2/<name>/tags/list
 	ListTags(ctx echo.Context) error
 
+	// GET /v2/<name>/tags/detail
+	ListTagsDetail(ctx echo.Context) error
+
 	// DELETE /v2/<name>/manifests/<reference>
 	// here ref is digest
 
 	// Success : 202
 	DeleteTagOrManifest(ctx echo.Context) error
+
+	// DELETE /v2/<name>/tags?match=<pattern>&keep_last=<n>
+	DeleteTags(ctx echo.Context) error
 	//The list of available repositories is made available through the catalog
 	Catalog(ctx echo.Context) error
 	GetImageNamespace(ctx echo.Context) error
 
 	// MonolithicPut is used as the second operation for MonolithicUpload with POST + Put
 	MonolithicPut(ctx echo.Context) error
+
+	// Close stops reaping the abandoned uploads and compressing the layers, waiting for the current run to finish.
+	// The layers still queued stay as they were pushed
+	Close()
 }
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"context"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+var errUploadDigestMismatch = errors.New("ERR_DIGEST_MISMATCH") //nolint
+
+// uploadDigest is the canonical digest of the chunks accepted so far for an upload whose chunks are uploaded to the
+// DFS as parts, so that completing the upload doesn't read the layer again. A chunk is hashed into a copy of the
+// state, which replaces it once the chunk is accepted
+type uploadDigest struct {
+	mu      sync.Mutex
+	hash    hash.Hash
+	pending hash.Hash
+}
+
+func newUploadDigest() *uploadDigest {
+	return &uploadDigest{hash: digest.New(digest.Canonical)}
+}
+
+// begin returns the writer the next chunk is hashed with, a chunk which was neither committed nor rolled back is
+// dropped
+func (d *uploadDigest) begin() (io.Writer, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, err := d.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("ERR_UPLOAD_DIGEST_STATE: %w", err)
+	}
+	pending := digest.New(digest.Canonical)
+	if err = pending.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("ERR_UPLOAD_DIGEST_STATE: %w", err)
+	}
+
+	d.pending = pending
+	return pending, nil
+}
+
+func (d *uploadDigest) commit() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pending != nil {
+		d.hash, d.pending = d.pending, nil
+	}
+}
+
+func (d *uploadDigest) rollback() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = nil
+}
+
+// sum doesn't change the state of the hash
+func (d *uploadDigest) sum() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return string(digest.Canonical) + ":" + hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// uploadDigestFor returns nil for the staged uploads, which hash their chunks themselves, and for the uploads
+// restored after a restart
+func (r *registry) uploadDigestFor(uploadID string) *uploadDigest {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.uploads[uploadID].digest
+}
+
+// completeMultipartLayer checks the digest of an upload made of DFS parts and completes it. The running digest is
+// canonical, the layers pushed with another algorithm, or without a running digest, are read back from the DFS to
+// be checked, and deleted when they don't match
+func (r *registry) completeMultipartLayer(ctx context.Context, uploadID, layerKey, dig string) (string, error) {
+	running := r.uploadDigestFor(uploadID)
+	algo := digest.AlgorithmOf(dig)
+	if running != nil && algo == digest.Canonical {
+		if computed := running.sum(); computed != dig {
+			return "", fmt.Errorf("%w: expected %s, got %s", errUploadDigestMismatch, dig, computed)
+		}
+	}
+
+	key := GetLayerIdentifier(layerKey)
+	parts, err := r.completedParts(ctx, uploadID)
+	if err != nil {
+		return "", err
+	}
+	dfsLink, err := r.dfs.CompleteMultipartUploadInput(ctx, uploadID, key, dig, parts)
+	if err != nil || (running != nil && algo == digest.Canonical) {
+		return dfsLink, err
+	}
+
+	rc, err := r.dfs.Download(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	computed, err := digest.FromReader(algo, rc)
+	_ = rc.Close()
+	if err != nil {
+		return "", err
+	}
+	if computed != dig {
+		if err = r.dfs.DeleteObject(ctx, key); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: expected %s, got %s", errUploadDigestMismatch, dig, computed)
+	}
+
+	return dfsLink, nil
+}
@@ -0,0 +1,199 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+)
+
+// completeUploadError completes the upload like completeUpload, it returns the code of the error the registry
+// responded with too
+func completeUploadError(t *testing.T, r *registry, uuid, dig string, body []byte) (int, string) {
+	t.Helper()
+
+	ctx, rec := uploadContext(http.MethodPut, testNamespace, uuid, body)
+	ctx.QueryParams().Set("digest", dig)
+	if err := r.CompleteUpload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs RegistryErrors
+	if rec.Code != http.StatusCreated {
+		_ = json.Unmarshal(rec.Body.Bytes(), &errs)
+	}
+	if len(errs.Errors) > 0 {
+		return rec.Code, errs.Errors[0].Code
+	}
+	return rec.Code, ""
+}
+
+func TestUploadDigestAlgorithm(t *testing.T) {
+	first, second := []byte("the first chunk, "), []byte("the second chunk")
+	layer := append(append([]byte(nil), first...), second...)
+	sha512, err := digest.FromReader(digest.SHA512, bytes.NewReader(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSHA512, err := digest.FromReader(digest.SHA512, bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		digest   string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "sha256", digest: digest.FromBytes(layer), wantCode: http.StatusCreated},
+		{name: "sha512", digest: sha512, wantCode: http.StatusCreated},
+		{
+			name:     "sha512 mismatch",
+			digest:   otherSHA512,
+			wantCode: http.StatusBadRequest,
+			wantErr:  RegistryErrorCodeDigestInvalid,
+		},
+		{
+			name:     "unknown algorithm",
+			digest:   "sha384:" + string(bytes.Repeat([]byte("a"), 96)),
+			wantCode: http.StatusBadRequest,
+			wantErr:  RegistryErrorCodeUnsupported,
+		},
+		{
+			name:     "malformed sha512",
+			digest:   "sha512:abc",
+			wantCode: http.StatusBadRequest,
+			wantErr:  RegistryErrorCodeDigestInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memory.New()
+			store := newUploadStore()
+			r := newTestRegistry(store, storage)
+
+			uuid := startUpload(t, r, testNamespace, "")
+			patchChunk(t, r, uuid, 0, first)
+			code, errCode := completeUploadError(t, r, uuid, tt.digest, second)
+			if code != tt.wantCode || errCode != tt.wantErr {
+				t.Fatalf("got status %d and error %q, want %d and %q", code, errCode, tt.wantCode, tt.wantErr)
+			}
+
+			stored, ok := store.layers[tt.digest]
+			if tt.wantCode != http.StatusCreated {
+				if ok {
+					t.Errorf("the layer was stored with the rejected digest %s", tt.digest)
+				}
+				if tt.wantErr == RegistryErrorCodeDigestInvalid && len(storage.Keys()) != 0 {
+					t.Errorf("got the DFS objects %v after the mismatch, want none", storage.Keys())
+				}
+				return
+			}
+
+			if !ok {
+				t.Fatalf("the layer wasn't stored with the digest %s", tt.digest)
+			}
+			rc, err := storage.Download(context.Background(), GetLayerIdentifier(stored.UUID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if computed, _ := digest.FromReader(digest.AlgorithmOf(tt.digest), rc); computed != tt.digest {
+				t.Errorf("got the digest %s for the stored layer, want %s", computed, tt.digest)
+			}
+		})
+	}
+}
+
+func TestUploadDigestCommitAndRollback(t *testing.T) {
+	chunks := [][]byte{[]byte("first "), []byte("second "), []byte("third")}
+	d := newUploadDigest()
+	for _, chunk := range chunks {
+		w, err := d.begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(chunk)
+		d.commit()
+
+		// a rejected chunk leaves the digest as it was
+		w, err = d.begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte("rejected"))
+		d.rollback()
+	}
+
+	if got, want := d.sum(), digest.FromBytes(bytes.Join(chunks, nil)); got != want {
+		t.Errorf("got digest %s, want the digest of the whole layer %s", got, want)
+	}
+	// sum doesn't finalize the hash
+	if got, want := d.sum(), digest.FromBytes(bytes.Join(chunks, nil)); got != want {
+		t.Errorf("got digest %s the second time, want %s", got, want)
+	}
+}
+
+// TestIncrementalUploadDigest uploads a layer in chunks which don't line up with the DFS parts, the digest is
+// computed as they arrive so that completing the upload doesn't read the layer back
+func TestIncrementalUploadDigest(t *testing.T) {
+	const chunkSize = 16
+	storage := memory.New()
+	store := newUploadStore()
+	r := newTestRegistry(store, storage)
+	withChunkSize(r, storage, chunkSize)
+
+	chunks := [][]byte{
+		bytes.Repeat([]byte("a"), 5),
+		bytes.Repeat([]byte("b"), 23),
+		bytes.Repeat([]byte("c"), 16),
+		bytes.Repeat([]byte("d"), 9),
+	}
+	layer := bytes.Join(chunks, nil)
+	uuid := startUpload(t, r, testNamespace, "")
+	uploadID := GetUploadIDFromTrakcingID(uuid)
+
+	offset := 0
+	for i, chunk := range chunks[:len(chunks)-1] {
+		patchChunk(t, r, uuid, offset, chunk)
+		offset += len(chunk)
+
+		running := r.uploadDigestFor(uploadID)
+		if running == nil {
+			t.Fatal("the upload has no running digest")
+		}
+		if got, want := running.sum(), digest.FromBytes(layer[:offset]); got != want {
+			t.Errorf("chunk %d: got the running digest %s, want %s", i, got, want)
+		}
+	}
+
+	// a chunk past the end of the upload is rejected, and not hashed
+	ctx, rec := uploadContext(http.MethodPatch, testNamespace, uuid, []byte("out of order"))
+	ctx.Request().Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset+10, offset+21))
+	if err := r.b.UploadBlob(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code == http.StatusAccepted {
+		t.Fatal("the out of order chunk was accepted")
+	}
+	if got, want := r.uploadDigestFor(uploadID).sum(), digest.FromBytes(layer[:offset]); got != want {
+		t.Errorf("got the running digest %s after the rejected chunk, want %s", got, want)
+	}
+
+	if code := completeUpload(t, r, uuid, digest.FromBytes(layer), chunks[len(chunks)-1]); code != http.StatusCreated {
+		t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+	}
+	if got := storage.Calls("Download"); got != 0 {
+		t.Errorf("got %d downloads completing the upload, want the layer not to be read back", got)
+	}
+	if _, ok := store.layers[digest.FromBytes(layer)]; !ok {
+		t.Error("the layer wasn't stored")
+	}
+}
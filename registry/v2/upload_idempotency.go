@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// HeaderIdempotencyKey lets a client retry POST /v2/<name>/blobs/uploads/ without starting a second upload
+	// session, the retry gets the session the first request started
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// uploadKey is the upload session started with an idempotency key, the key expires along with the session. While
+// the first request with the key starts the session the key is reserved: it has no uploadID yet and ready is closed
+// once the session is remembered or the reservation released
+type uploadKey struct {
+	expiresAt  time.Time
+	ready      chan struct{}
+	uploadID   string
+	trackingID string
+}
+
+// idempotencyKey scopes the key of the client to the repository, the same key can be used for another one
+func idempotencyKey(namespace, key string) string {
+	return namespace + "\x00" + key
+}
+
+// reserveUpload returns the tracking id of the upload session started with the key, and the bytes received so far,
+// as long as the session is still open. Otherwise the key is reserved for the caller (reserved is true), which must
+// either rememberUpload the session it starts or releaseUpload the key. The lookup and the reservation are made
+// under the same lock, a request with the key the session is being started for waits for it
+func (r *registry) reserveUpload(
+	ctx context.Context,
+	namespace string,
+	key string,
+) (trackingID string, received int64, reserved bool, err error) {
+	k := idempotencyKey(namespace, key)
+	for {
+		r.mu.Lock()
+		upload, ok := r.uploadKeys[k]
+		if ok && upload.uploadID == "" {
+			r.mu.Unlock()
+			select {
+			case <-upload.ready:
+				continue
+			case <-ctx.Done():
+				return "", 0, false, ctx.Err()
+			}
+		}
+
+		if ok {
+			if _, open := r.uploads[upload.uploadID]; open && time.Now().Before(upload.expiresAt) {
+				received = r.b.layerLengthCounter[upload.uploadID]
+				r.mu.Unlock()
+				return upload.trackingID, received, false, nil
+			}
+		}
+
+		// the expired keys are dropped along the way
+		r.dropExpiredUploadKeys(time.Now())
+		r.uploadKeys[k] = uploadKey{ready: make(chan struct{})}
+		r.mu.Unlock()
+		return "", 0, true, nil
+	}
+}
+
+// rememberUpload maps the reserved key to the upload session until the session times out
+func (r *registry) rememberUpload(namespace, key, uploadID, trackingID string, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey(namespace, key)
+	upload := r.uploadKeys[k]
+	upload.expiresAt = time.Now().Add(timeout)
+	upload.uploadID = uploadID
+	upload.trackingID = trackingID
+	r.uploadKeys[k] = upload
+	if upload.ready != nil {
+		close(upload.ready)
+	}
+}
+
+// releaseUpload drops the reservation of the key when the session couldn't be started, one of the requests waiting
+// for it reserves it next. A key mapped to a session is left alone
+func (r *registry) releaseUpload(namespace, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey(namespace, key)
+	upload, ok := r.uploadKeys[k]
+	if !ok || upload.uploadID != "" {
+		return
+	}
+
+	delete(r.uploadKeys, k)
+	close(upload.ready)
+}
+
+// dropExpiredUploadKeys must be called with the lock held, the reserved keys are released by their request
+func (r *registry) dropExpiredUploadKeys(now time.Time) {
+	for k, upload := range r.uploadKeys {
+		if upload.uploadID != "" && now.After(upload.expiresAt) {
+			delete(r.uploadKeys, k)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/dfs/memory"
+)
+
+func startUpload(t *testing.T, r *registry, namespace, key string) string {
+	t.Helper()
+
+	ctx, rec := newTestContext(http.MethodPost, "/v2/"+namespace+"/blobs/uploads/", namespace)
+	if key != "" {
+		ctx.Request().Header.Set(HeaderIdempotencyKey, key)
+	}
+	if err := r.StartUpload(ctx); err != nil {
+		t.Error(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+
+	return rec.Header().Get("Docker-Upload-UUID")
+}
+
+func TestStartUploadIdempotent(t *testing.T) {
+	storage := memory.New()
+	r := newTestRegistry(newUploadStore(), storage)
+
+	first := startUpload(t, r, "johndoe/alpine", "retry-1")
+	if again := startUpload(t, r, "johndoe/alpine", "retry-1"); again != first {
+		t.Errorf("a retry started upload %s, want %s", again, first)
+	}
+	if other := startUpload(t, r, "johndoe/busybox", "retry-1"); other == first {
+		t.Error("the key of another repository continued the same upload")
+	}
+	if other := startUpload(t, r, "johndoe/alpine", ""); other == first {
+		t.Error("a request without a key continued the upload")
+	}
+	if got := storage.Calls("CreateMultipartUpload"); got != 3 {
+		t.Errorf("got %d uploads created, want 3", got)
+	}
+}
+
+func TestStartUploadIdempotentConcurrent(t *testing.T) {
+	storage := memory.New()
+	store := newUploadStore()
+	store.saveDelay = 20 * time.Millisecond
+	r := newTestRegistry(store, storage)
+
+	const requests = 8
+	ids := make([]string, requests)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = startUpload(t, r, "johndoe/alpine", "retry-1")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Fatalf("overlapping requests with the same key started uploads %v", ids)
+		}
+	}
+	if got := storage.Calls("CreateMultipartUpload"); got != 1 {
+		t.Errorf("got %d uploads created, want 1", got)
+	}
+}
+
+func TestReleaseUploadReservation(t *testing.T) {
+	r := newTestRegistry(newUploadStore(), memory.New())
+	ctx, _ := newTestContext(http.MethodPost, "/", "johndoe/alpine")
+
+	if _, _, reserved, err := r.reserveUpload(ctx.Request().Context(), "johndoe/alpine", "k"); err != nil || !reserved {
+		t.Fatalf("got reserved %t and error %v, want the key reserved", reserved, err)
+	}
+	r.releaseUpload("johndoe/alpine", "k")
+	if _, _, reserved, err := r.reserveUpload(ctx.Request().Context(), "johndoe/alpine", "k"); err != nil || !reserved {
+		t.Errorf("got reserved %t and error %v after the release, want the key reserved again", reserved, err)
+	}
+}
@@ -0,0 +1,277 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+)
+
+const (
+	// uploadSessionTTL is how long an upload can be resumed for after its last chunk, idle uploads are reaped
+	uploadSessionTTL = time.Hour * 24
+	// uploadReapInterval is how often the idle uploads are looked for
+	uploadReapInterval = time.Hour
+)
+
+// saveUploadSession persists the state of a chunked upload, so that it can be resumed after a restart.
+// Failing to persist it only affects resuming, so the error is logged and the upload carries on. With
+// UploadPartsInStore the parts are appended to the stored ones instead, and dropped from memory once they're saved.
+// The tail of the upload is only held in memory, so the session counts the bytes in the parts: an upload resumed
+// after a restart carries on from the end of its last part
+func (r *registry) saveUploadSession(ctx context.Context, namespace, identifier string) {
+	uploadID := GetUploadIDFromTrakcingID(identifier)
+
+	r.mu.RLock()
+	session := &types.UploadSession{
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UploadID:  uploadID,
+		LayerKey:  GetLayerIdentifierFromTrakcingID(identifier),
+		Namespace: namespace,
+		PartCount: r.b.blobCounter[uploadID],
+		Received:  r.b.layerLengthCounter[uploadID] - int64(len(r.b.layerTails[uploadID])),
+	}
+	pending := r.b.layerParts[uploadID]
+	session.Parts = sessionParts(pending)
+	r.mu.RUnlock()
+
+	if !r.config.Registry.UploadPartsInStore {
+		if err := r.store.SaveUploadSession(ctx, session); err != nil {
+			color.Red("error saving upload session %s: %s", uploadID, err)
+		}
+		return
+	}
+
+	if err := r.store.AppendUploadSessionParts(ctx, session); err != nil {
+		// the parts stay in memory, they're appended along with the ones of the next chunk
+		color.Red("error saving upload session %s: %s", uploadID, err)
+		return
+	}
+
+	r.mu.Lock()
+	if parts := r.b.layerParts[uploadID]; len(parts) == len(pending) {
+		delete(r.b.layerParts, uploadID)
+	} else {
+		r.b.layerParts[uploadID] = parts[len(pending):]
+	}
+	r.mu.Unlock()
+}
+
+// completedParts returns all the DFS parts of an upload, to complete it. With UploadPartsInStore they're the stored
+// parts followed by the ones which aren't appended yet, e.g. the parts of the final chunk
+func (r *registry) completedParts(ctx context.Context, uploadID string) ([]s3types.CompletedPart, error) {
+	r.b.mu.RLock()
+	pending := r.b.layerParts[uploadID]
+	r.b.mu.RUnlock()
+
+	if !r.config.Registry.UploadPartsInStore {
+		return pending, nil
+	}
+
+	stored, err := r.store.GetUploadSessionParts(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]s3types.CompletedPart, 0, len(stored)+len(pending))
+	for _, part := range stored {
+		parts = append(parts, s3types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: part.PartNumber,
+		})
+	}
+
+	return append(parts, pending...), nil
+}
+
+// upload returns the state of an upload in progress
+func (r *registry) upload(uploadID string) (uploadState, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	upload, ok := r.uploads[uploadID]
+	return upload, ok
+}
+
+// endUpload drops an upload which is complete, failed or cancelled, along with its session and staging file
+func (r *registry) endUpload(ctx context.Context, uploadID string) {
+	r.deleteUploadSession(ctx, uploadID)
+	r.forgetUpload(uploadID)
+	if r.stager != nil {
+		r.stager.remove(uploadID)
+	}
+}
+
+// forgetUpload drops everything held in memory for an upload, once it's complete or cancelled
+func (r *registry) forgetUpload(uploadID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.uploads, uploadID)
+	delete(r.b.layerParts, uploadID)
+	delete(r.b.blobCounter, uploadID)
+	delete(r.b.layerLengthCounter, uploadID)
+	delete(r.b.layerTails, uploadID)
+}
+
+func sessionParts(parts []s3types.CompletedPart) []types.UploadSessionPart {
+	sessionParts := make([]types.UploadSessionPart, 0, len(parts))
+	for _, part := range parts {
+		sessionParts = append(sessionParts, types.UploadSessionPart{
+			ETag:       aws.ToString(part.ETag),
+			PartNumber: part.PartNumber,
+		})
+	}
+
+	return sessionParts
+}
+
+func (r *registry) deleteUploadSession(ctx context.Context, uploadID string) {
+	if err := r.store.DeleteUploadSession(ctx, uploadID); err != nil {
+		color.Red("error deleting upload session %s: %s", uploadID, err)
+	}
+}
+
+// restoreUploadSessions rebuilds the in-memory state (uploads, part list and counters) of the uploads
+// that were in progress when the server stopped. The sessions which expired meanwhile are reaped
+func (r *registry) restoreUploadSessions(ctx context.Context) error {
+	sessions, err := r.store.GetUploadSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if time.Since(session.UpdatedAt) > uploadSessionTTL {
+			r.reapUpload(ctx, session.UploadID, session.LayerKey)
+			continue
+		}
+
+		if r.stager != nil {
+			if err = r.stager.restore(session.UploadID, session.Received); err != nil {
+				color.Red("error restoring upload session %s: %s", session.UploadID, err)
+				r.deleteUploadSession(ctx, session.UploadID)
+				continue
+			}
+		}
+
+		r.mu.Lock()
+		r.uploads[session.UploadID] = uploadState{
+			layerKey:    session.LayerKey,
+			blobDigests: []string{},
+			timeout:     time.Minute * 10,
+			startedAt:   session.CreatedAt,
+			updatedAt:   session.UpdatedAt,
+		}
+		// the stored parts are read back when the upload is complete
+		if !r.config.Registry.UploadPartsInStore {
+			parts := make([]s3types.CompletedPart, 0, len(session.Parts))
+			for _, part := range session.Parts {
+				parts = append(parts, s3types.CompletedPart{
+					ETag:       aws.String(part.ETag),
+					PartNumber: part.PartNumber,
+				})
+			}
+			r.b.layerParts[session.UploadID] = parts
+		}
+		r.b.blobCounter[session.UploadID] = session.PartCount
+		r.b.layerLengthCounter[session.UploadID] = session.Received
+		r.mu.Unlock()
+	}
+
+	if len(sessions) > 0 {
+		color.Green("restored %d upload sessions", len(r.uploads))
+	}
+
+	// the staging files of the expired sessions, and of the uploads which were never saved, are reaped here
+	if r.stager != nil {
+		if err = r.stager.removeOrphans(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startReaper reaps the abandoned uploads every interval, until Close
+func (r *registry) startReaper(interval time.Duration) {
+	r.stopReaper = make(chan struct{})
+	r.reaperDone = make(chan struct{})
+
+	go func() {
+		defer close(r.reaperDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reap(context.Background(), time.Now())
+			case <-r.stopReaper:
+				return
+			}
+		}
+	}()
+}
+
+func (r *registry) Close() {
+	if r.stopReaper != nil {
+		close(r.stopReaper)
+		<-r.reaperDone
+	}
+	if r.stopCompressor != nil {
+		close(r.stopCompressor)
+		<-r.compressorDone
+	}
+}
+
+// reap ends the uploads which are idle for longer than uploadSessionTTL and drops what's left of the ended ones:
+// the expired idempotency keys and the orphaned staging files. Nothing an upload holds outlives it until a restart
+func (r *registry) reap(ctx context.Context, now time.Time) {
+	r.reapUploads(ctx, now.Add(-uploadSessionTTL))
+
+	r.mu.Lock()
+	r.dropExpiredUploadKeys(now)
+	r.mu.Unlock()
+
+	if r.stager != nil {
+		if err := r.stager.removeOrphans(); err != nil {
+			color.Red("error removing the orphaned staging files: %s", err)
+		}
+	}
+}
+
+// reapUploads ends the uploads whose last chunk was accepted before idleSince, a client resuming one of them gets
+// BLOB_UPLOAD_UNKNOWN and starts over
+func (r *registry) reapUploads(ctx context.Context, idleSince time.Time) {
+	expired := map[string]string{}
+	r.mu.RLock()
+	for uploadID, upload := range r.uploads {
+		if upload.updatedAt.Before(idleSince) {
+			expired[uploadID] = upload.layerKey
+		}
+	}
+	r.mu.RUnlock()
+
+	for uploadID, layerKey := range expired {
+		r.reapUpload(ctx, uploadID, layerKey)
+	}
+	if len(expired) > 0 {
+		color.Yellow("reaped %d abandoned uploads", len(expired))
+	}
+}
+
+// reapUpload aborts the DFS upload of an abandoned upload (the staged ones have none) and ends it
+func (r *registry) reapUpload(ctx context.Context, uploadID, layerKey string) {
+	if r.stager == nil {
+		if err := r.dfs.AbortMultipartUpload(ctx, uploadID, GetLayerIdentifier(layerKey)); err != nil {
+			color.Red("error aborting upload %s: %s", uploadID, err)
+		}
+	}
+
+	r.endUpload(ctx, uploadID)
+}
@@ -0,0 +1,474 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/registry/v2/schema"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const testNamespace = "johndoe/alpine"
+
+// patchChunk sends the chunk of the upload, starting at start, and checks that it's accepted
+func patchChunk(t *testing.T, r *registry, uuid string, start int, chunk []byte) {
+	t.Helper()
+
+	ctx, rec := uploadContext(http.MethodPatch, testNamespace, uuid, chunk)
+	ctx.Request().Header.Set("Content-Range", fmt.Sprintf("%d-%d", start, start+len(chunk)-1))
+	if err := r.b.UploadBlob(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("PATCH %d-%d: got status %d, want %d: %s", start, start+len(chunk)-1, rec.Code,
+			http.StatusAccepted, rec.Body)
+	}
+}
+
+// completeUpload sends the PUT completing the upload, with the final chunk in body
+func completeUpload(t *testing.T, r *registry, uuid, dig string, body []byte) int {
+	t.Helper()
+
+	ctx, rec := uploadContext(http.MethodPut, testNamespace, uuid, body)
+	ctx.QueryParams().Set("digest", dig)
+	if err := r.CompleteUpload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Code
+}
+
+func uploadProgress(t *testing.T, r *registry, uuid string) (int, string) {
+	t.Helper()
+
+	ctx, rec := uploadContext(http.MethodGet, testNamespace, uuid, nil)
+	if err := r.UploadProgress(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Code, rec.Header().Get("Range")
+}
+
+// withChunkSize makes the DFS parts of the uploads size bytes big, the DFS rejects smaller ones but for the last
+func withChunkSize(r *registry, storage *memory.DFS, size int) {
+	r.config.DFS = &config.DFS{S3Any: &config.S3CompatibleDFS{ChunkSize: size}}
+	storage.MinPartSize = size
+}
+
+// TestResumeUploadAfterRestart restarts the registry between two chunks, the DFS and the store outlive it. The
+// tail of the first chunk isn't in the DFS yet, so it's lost with the restart and the client sends it again
+func TestResumeUploadAfterRestart(t *testing.T) {
+	const chunkSize = 16
+	storage := memory.New()
+	store := newUploadStore()
+	layer := []byte("the first chunk of the layer, and the second one")
+
+	before := newTestRegistry(store, storage)
+	withChunkSize(before, storage, chunkSize)
+	uuid := startUpload(t, before, testNamespace, "")
+	patchChunk(t, before, uuid, 0, layer[:30])
+
+	after := newTestRegistry(store, storage)
+	withChunkSize(after, storage, chunkSize)
+	if err := after.restoreUploadSessions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, received := uploadProgress(t, after, uuid); code != http.StatusNoContent ||
+		received != uploadedRange(chunkSize) {
+		t.Fatalf("got status %d and Range %s after the restart, want %d and %s",
+			code, received, http.StatusNoContent, uploadedRange(chunkSize))
+	}
+
+	patchChunk(t, after, uuid, chunkSize, layer[chunkSize:])
+	dig := digest.FromBytes(layer)
+	if code := completeUpload(t, after, uuid, dig, nil); code != http.StatusCreated {
+		t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+	}
+
+	stored, ok := store.layers[dig]
+	if !ok {
+		t.Fatal("the layer wasn't stored")
+	}
+	rc, err := storage.Download(context.Background(), GetLayerIdentifier(stored.UUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if computed, err := digest.FromReader(digest.Canonical, rc); err != nil || computed != dig {
+		t.Errorf("got digest %s and error %v for the stored layer, want %s", computed, err, dig)
+	}
+	if store.sessionCount() != 0 {
+		t.Errorf("got %d upload sessions left, want none", store.sessionCount())
+	}
+}
+
+func TestReapAbandonedUploads(t *testing.T) {
+	storage := memory.New()
+	store := newUploadStore()
+	r := newTestRegistry(store, storage)
+
+	uuid := startUpload(t, r, testNamespace, "")
+	patchChunk(t, r, uuid, 0, []byte("an abandoned chunk"))
+
+	// the upload is still active
+	r.reapUploads(context.Background(), time.Now().Add(-time.Minute))
+	if code, _ := uploadProgress(t, r, uuid); code != http.StatusNoContent {
+		t.Fatalf("got status %d for an active upload, want %d", code, http.StatusNoContent)
+	}
+
+	r.reapUploads(context.Background(), time.Now().Add(time.Minute))
+	if code, _ := uploadProgress(t, r, uuid); code != http.StatusNotFound {
+		t.Errorf("got status %d for a reaped upload, want %d", code, http.StatusNotFound)
+	}
+	if storage.Uploads() != 0 {
+		t.Errorf("got %d DFS uploads left, want the upload aborted", storage.Uploads())
+	}
+	if store.sessionCount() != 0 {
+		t.Errorf("got %d upload sessions left, want none", store.sessionCount())
+	}
+	if len(r.uploads) != 0 || len(r.b.layerParts) != 0 || len(r.b.layerLengthCounter) != 0 {
+		t.Error("the reaped upload is still held in memory")
+	}
+}
+
+func TestRestoreReapsExpiredSessions(t *testing.T) {
+	storage := memory.New()
+	store := newUploadStore()
+	uploadID, err := storage.CreateMultipartUpload(context.Background(), GetLayerIdentifier("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.sessions[uploadID] = &types.UploadSession{
+		CreatedAt: time.Now().Add(-uploadSessionTTL * 2),
+		UpdatedAt: time.Now().Add(-uploadSessionTTL * 2),
+		UploadID:  uploadID,
+		LayerKey:  "expired",
+		Namespace: testNamespace,
+	}
+
+	r := newTestRegistry(store, storage)
+	if err = r.restoreUploadSessions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.upload(uploadID); ok {
+		t.Error("the expired session was restored")
+	}
+	if storage.Uploads() != 0 || store.sessionCount() != 0 {
+		t.Errorf("got %d DFS uploads and %d sessions left, want the expired upload reaped",
+			storage.Uploads(), store.sessionCount())
+	}
+}
+
+// assertNoResidualState checks that nothing is held for an upload once it has ended
+func assertNoResidualState(t *testing.T, r *registry, store *uploadStore) {
+	t.Helper()
+
+	r.mu.RLock()
+	held := len(r.uploads) + len(r.b.layerParts) + len(r.b.blobCounter) + len(r.b.layerLengthCounter) +
+		len(r.b.layerTails)
+	r.mu.RUnlock()
+	if held != 0 {
+		t.Errorf("got %d uploads, %d part lists, %d part counters, %d length counters and %d tails held, want none",
+			len(r.uploads), len(r.b.layerParts), len(r.b.blobCounter), len(r.b.layerLengthCounter), len(r.b.layerTails))
+	}
+	if store.sessionCount() != 0 {
+		t.Errorf("got %d upload sessions left, want none", store.sessionCount())
+	}
+	if r.stager == nil {
+		return
+	}
+
+	r.stager.mu.Lock()
+	staged := len(r.stager.uploads)
+	r.stager.mu.Unlock()
+	entries, err := os.ReadDir(r.stager.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged != 0 || len(entries) != 0 {
+		t.Errorf("got %d staged uploads and %d staging files left, want none", staged, len(entries))
+	}
+}
+
+func TestNoResidualStateAfterUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		inStore bool
+		staged  bool
+	}{
+		{name: "parts in memory"},
+		{name: "parts in store", inStore: true},
+		{name: "staged", staged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memory.New()
+			store := newUploadStore()
+			r := newTestRegistry(store, storage)
+			r.config.Registry.UploadPartsInStore = tt.inStore
+			if tt.staged {
+				stager, err := newUploadStager(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.stager = stager
+			}
+
+			first, second := []byte("the first chunk, "), []byte("the second chunk")
+			uuid := startUpload(t, r, testNamespace, "")
+			patchChunk(t, r, uuid, 0, first)
+			patchChunk(t, r, uuid, len(first), second)
+			dig := digest.FromBytes(append(append([]byte(nil), first...), second...))
+			if code := completeUpload(t, r, uuid, dig, nil); code != http.StatusCreated {
+				t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+			}
+			if _, ok := store.layers[dig]; !ok {
+				t.Fatal("the layer wasn't stored")
+			}
+			assertNoResidualState(t, r, store)
+
+			// an abandoned upload is dropped by the reaper, without a restart
+			uuid = startUpload(t, r, testNamespace, "abandoned")
+			patchChunk(t, r, uuid, 0, first)
+			r.reap(context.Background(), time.Now().Add(uploadSessionTTL+time.Minute))
+			assertNoResidualState(t, r, store)
+			if storage.Uploads() != 0 {
+				t.Errorf("got %d DFS uploads left, want none", storage.Uploads())
+			}
+			if len(r.uploadKeys) != 0 {
+				t.Errorf("got %d idempotency keys left, want none", len(r.uploadKeys))
+			}
+		})
+	}
+}
+
+func TestReapRemovesOrphanedStagingFiles(t *testing.T) {
+	r := newTestRegistry(newUploadStore(), memory.New())
+	stager, err := newUploadStager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.stager = stager
+
+	uuid := startUpload(t, r, testNamespace, "")
+	orphan := filepath.Join(stager.dir, "orphan")
+	if err = os.WriteFile(orphan, []byte("left behind"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r.reap(context.Background(), time.Now())
+	if _, err = os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("got error %v for the orphaned staging file, want it removed", err)
+	}
+	// the upload in progress keeps its staging file
+	if _, err = os.Stat(filepath.Join(stager.dir, GetUploadIDFromTrakcingID(uuid))); err != nil {
+		t.Errorf("the staging file of the upload in progress is gone: %s", err)
+	}
+}
+
+func TestUploadProgress(t *testing.T) {
+	r := newTestRegistry(newUploadStore(), memory.New())
+	uuid := startUpload(t, r, testNamespace, "")
+
+	if code, received := uploadProgress(t, r, uuid); code != http.StatusNoContent || received != "0-0" {
+		t.Fatalf("got status %d and Range %s before any chunk, want %d and 0-0", code, received, http.StatusNoContent)
+	}
+
+	first, second := []byte("the first chunk, "), []byte("the second chunk")
+	patchChunk(t, r, uuid, 0, first)
+	if _, received := uploadProgress(t, r, uuid); received != uploadedRange(int64(len(first))) {
+		t.Errorf("got Range %s after the first chunk, want %s", received, uploadedRange(int64(len(first))))
+	}
+	patchChunk(t, r, uuid, len(first), second)
+	total := int64(len(first) + len(second))
+	if _, received := uploadProgress(t, r, uuid); received != uploadedRange(total) {
+		t.Errorf("got Range %s after the second chunk, want %s", received, uploadedRange(total))
+	}
+
+	ctx, rec := uploadContext(http.MethodGet, testNamespace, uuid, nil)
+	if err := r.UploadProgress(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if location := rec.Header().Get("Location"); location != "/v2/"+testNamespace+"/blobs/uploads/"+uuid {
+		t.Errorf("got Location %s, want the upload", location)
+	}
+	if rec.Header().Get("Docker-Upload-UUID") != uuid {
+		t.Errorf("got Docker-Upload-UUID %s, want %s", rec.Header().Get("Docker-Upload-UUID"), uuid)
+	}
+
+	if code, _ := uploadProgress(t, r, "unknown"); code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown upload, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestPatchResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentRange bool
+		chunks       [][]byte
+		wantRange    string
+	}{
+		{name: "empty stream", chunks: [][]byte{{}}, wantRange: "0-0"},
+		{name: "stream", chunks: [][]byte{[]byte("a streamed layer")}, wantRange: "0-15"},
+		{name: "empty stream after a chunk", chunks: [][]byte{[]byte("a layer"), {}}, wantRange: "0-6"},
+		{name: "chunk", contentRange: true, chunks: [][]byte{[]byte("a chunked layer")}, wantRange: "0-14"},
+		{name: "chunks", contentRange: true, chunks: [][]byte{[]byte("first "), []byte("second")}, wantRange: "0-11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRegistry(newUploadStore(), memory.New())
+			uuid := startUpload(t, r, testNamespace, "")
+
+			var rec *httptest.ResponseRecorder
+			start := 0
+			for _, chunk := range tt.chunks {
+				var ctx echo.Context
+				ctx, rec = uploadContext(http.MethodPatch, testNamespace, uuid, chunk)
+				if tt.contentRange {
+					ctx.Request().Header.Set("Content-Range", fmt.Sprintf("%d-%d", start, start+len(chunk)-1))
+				}
+				if err := r.b.UploadBlob(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if rec.Code != http.StatusAccepted {
+					t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+				}
+				start += len(chunk)
+			}
+
+			if got := rec.Header().Get("Range"); got != tt.wantRange {
+				t.Errorf("got Range %s, want %s", got, tt.wantRange)
+			}
+			if got := rec.Header().Get("Docker-Upload-UUID"); got != uuid {
+				t.Errorf("got Docker-Upload-UUID %s, want %s", got, uuid)
+			}
+			if got := rec.Header().Get("Location"); got != "/v2/"+testNamespace+"/blobs/uploads/"+uuid {
+				t.Errorf("got Location %s, want the upload", got)
+			}
+		})
+	}
+}
+
+// failingTxnStore fails SetLayer after the layer is written to the txn, or Commit, so that only aborting the txn
+// drops the layer
+type failingTxnStore struct {
+	*uploadStore
+	failSetLayer bool
+	failCommit   bool
+	txns         int
+	aborts       int
+}
+
+var errInjected = errors.New("injected store failure")
+
+func (s *failingTxnStore) NewTxn(ctx context.Context) (pgx.Tx, error) {
+	s.txns++
+	return s.uploadStore.NewTxn(ctx)
+}
+
+func (s *failingTxnStore) SetLayer(ctx context.Context, txn pgx.Tx, layer *types.LayerV2) error {
+	if err := s.uploadStore.SetLayer(ctx, txn, layer); err != nil || !s.failSetLayer {
+		return err
+	}
+	return errInjected
+}
+
+func (s *failingTxnStore) Commit(ctx context.Context, txn pgx.Tx) error {
+	if s.failCommit {
+		return errInjected
+	}
+	return s.uploadStore.Commit(ctx, txn)
+}
+
+func (s *failingTxnStore) Abort(ctx context.Context, txn pgx.Tx) error {
+	s.aborts++
+	return s.uploadStore.Abort(ctx, txn)
+}
+
+func TestStoreFailureAbortsTxn(t *testing.T) {
+	tests := []struct {
+		name         string
+		failSetLayer bool
+		failCommit   bool
+		chunk        []byte
+		final        []byte
+	}{
+		{name: "SetLayer fails", failSetLayer: true, chunk: []byte("the first chunk"), final: []byte(", the last")},
+		{name: "Commit fails", failCommit: true, chunk: []byte("the first chunk"), final: []byte(", the last")},
+		// an empty blob is stored by MonolithicPut
+		{name: "SetLayer fails for an empty blob", failSetLayer: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &failingTxnStore{
+				uploadStore:  newUploadStore(),
+				failSetLayer: tt.failSetLayer,
+				failCommit:   tt.failCommit,
+			}
+			r := newTestRegistry(store, memory.New())
+
+			uuid := startUpload(t, r, testNamespace, "")
+			if len(tt.chunk) > 0 {
+				patchChunk(t, r, uuid, 0, tt.chunk)
+			}
+			layer := append(append([]byte(nil), tt.chunk...), tt.final...)
+			if code := completeUpload(t, r, uuid, digest.FromBytes(layer), tt.final); code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d", code, http.StatusBadRequest)
+			}
+
+			if store.txns != 1 || store.aborts != 1 {
+				t.Errorf("got %d txns and %d aborts, want the txn aborted once", store.txns, store.aborts)
+			}
+			if len(store.layers) != 0 {
+				t.Errorf("got %d layers after the failure, want the layer rolled back", len(store.layers))
+			}
+			assertNoResidualState(t, r, store.uploadStore)
+		})
+	}
+}
+
+// failingConfigStore fails the SetConfig of the digest reference, after the tag was written to the txn
+type failingConfigStore struct {
+	*pushStore
+}
+
+func (s *failingConfigStore) SetConfig(ctx context.Context, txn pgx.Tx, cfg types.ConfigV2) error {
+	if isDigest(cfg.Reference) {
+		return errInjected
+	}
+	return s.pushStore.SetConfig(ctx, txn, cfg)
+}
+
+func TestPushManifestFailureAbortsTxn(t *testing.T) {
+	store := &failingConfigStore{pushStore: newPushStore()}
+	schemas, err := schema.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRegistry(store, memory.New())
+	r.schemas, r.verifier, r.webhooks = schemas, NewNoopVerifier(), &webhookRecorder{}
+
+	content := artifactManifest("application/vnd.example.sbom.v1+json", "application/vnd.example.sbom.v1+json")
+	if rec := pushManifest(t, r, "v1", mediaTypeOCIManifest, content); rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if store.commits != 0 || store.aborts != 1 {
+		t.Errorf("got %d commits and %d aborts, want the txn aborted", store.commits, store.aborts)
+	}
+}
@@ -0,0 +1,271 @@
+package registry
+
+import (
+	"context"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/google/uuid"
+)
+
+// uploadStager stages the chunks of the uploads in a local directory, one append-only file per upload, instead of
+// uploading every chunk to the DFS as a part. The canonical digest is computed while the chunks are written, and the
+// file is uploaded to the DFS once the upload is complete
+type uploadStager struct {
+	mu      sync.Mutex
+	uploads map[string]*stagedUpload
+	dir     string
+}
+
+type stagedUpload struct {
+	mu   sync.Mutex
+	file *os.File
+	hash hash.Hash
+	// size is the bytes received in the chunks that were accepted
+	size int64
+	// pending is the state of the hash before the last write, the write is undone with it unless it's committed
+	pending  []byte
+	pendingN int64
+}
+
+func newUploadStager(dir string) (*uploadStager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("ERR_CREATE_UPLOAD_STAGING_DIR: %w", err)
+	}
+
+	return &uploadStager{dir: dir, uploads: make(map[string]*stagedUpload)}, nil
+}
+
+// start creates the staging file of a new upload and returns the upload id
+func (s *uploadStager) start() (string, error) {
+	uploadID, err := CreateIdentifier()
+	if err != nil {
+		return "", err
+	}
+
+	// the file is created under the lock, so that removeOrphans never sees it before the upload is known
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(filepath.Join(s.dir, uploadID), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("ERR_CREATE_STAGING_FILE: %w", err)
+	}
+	s.uploads[uploadID] = &stagedUpload{file: file, hash: digest.New(digest.Canonical)}
+
+	return uploadID, nil
+}
+
+// restore reopens the staging file of an upload that was in progress when the server stopped. The bytes past size
+// weren't accepted, so they're dropped, and the hash is rebuilt from the file
+func (s *uploadStager) restore(uploadID string, size int64) error {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return fmt.Errorf("ERR_INVALID_UPLOAD_ID: %s", uploadID)
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, uploadID), os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("ERR_OPEN_STAGING_FILE: %w", err)
+	}
+
+	h := digest.New(digest.Canonical)
+	if err = file.Truncate(size); err == nil {
+		_, err = io.Copy(h, io.NewSectionReader(file, 0, size))
+	}
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("ERR_RESTORE_STAGING_FILE: %w", err)
+	}
+
+	s.mu.Lock()
+	s.uploads[uploadID] = &stagedUpload{file: file, hash: h, size: size}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *uploadStager) get(uploadID string) (*stagedUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("ERR_UPLOAD_NOT_STAGED: %s", uploadID)
+	}
+
+	return upload, nil
+}
+
+// write appends body to the staging file, the write is undone by rollback or kept by commit. A write which fails
+// half way is undone right away
+func (s *uploadStager) write(uploadID string, body io.Reader) (int64, error) {
+	upload, err := s.get(uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	// a write which was neither committed nor rolled back is overwritten
+	upload.undo()
+	state, err := upload.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	upload.pending = state
+
+	if _, err = upload.file.Seek(upload.size, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(io.MultiWriter(upload.file, upload.hash), body)
+	upload.pendingN = n
+	if err != nil {
+		upload.undo()
+		return 0, fmt.Errorf("ERR_WRITE_STAGING_FILE: %w", err)
+	}
+
+	return n, nil
+}
+
+func (s *uploadStager) commit(uploadID string) {
+	upload, err := s.get(uploadID)
+	if err != nil {
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	upload.size += upload.pendingN
+	upload.pending = nil
+	upload.pendingN = 0
+}
+
+func (s *uploadStager) rollback(uploadID string) {
+	upload, err := s.get(uploadID)
+	if err != nil {
+		return
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	upload.undo()
+}
+
+// undo must be called with the lock held
+func (u *stagedUpload) undo() {
+	if u.pending != nil {
+		_ = u.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(u.pending)
+	}
+	_ = u.file.Truncate(u.size)
+	u.pending = nil
+	u.pendingN = 0
+}
+
+// content returns the staged bytes along with their canonical digest
+func (s *uploadStager) content(uploadID string) (*io.SectionReader, string, error) {
+	upload, err := s.get(uploadID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+
+	// Sum doesn't change the state of the hash
+	dig := string(digest.Canonical) + ":" + hex.EncodeToString(upload.hash.Sum(nil))
+	return io.NewSectionReader(upload.file, 0, upload.size), dig, nil
+}
+
+// remove deletes the staging file, it's called once the upload is complete or cancelled
+func (s *uploadStager) remove(uploadID string) {
+	s.mu.Lock()
+	upload, ok := s.uploads[uploadID]
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+
+	if ok {
+		_ = upload.file.Close()
+		_ = os.Remove(upload.file.Name())
+	}
+}
+
+// removeOrphans deletes the staging files of no known upload, e.g. the ones whose session expired while the server
+// was down or which couldn't be removed when their upload ended
+func (s *uploadStager) removeOrphans() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, ok := s.uploads[entry.Name()]; !ok && !entry.IsDir() {
+			_ = os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+// uploadStagedLayer checks the digest of the staged upload and uploads it to the DFS. The parts are read from the
+// staging file as they're uploaded, so the layer is never held in memory
+func (r *registry) uploadStagedLayer(ctx context.Context, uploadID, layerKey, dig string) (string, error) {
+	content, computed, err := r.stager.content(uploadID)
+	if err != nil {
+		return "", err
+	}
+	// the digest was computed with the canonical algorithm while the chunks were written
+	if algo := digest.AlgorithmOf(dig); algo != digest.Canonical {
+		if computed, err = digest.FromReader(algo, content); err != nil {
+			return "", err
+		}
+	}
+	if computed != dig {
+		return "", fmt.Errorf("%w: expected %s, got %s", errUploadDigestMismatch, dig, computed)
+	}
+
+	key := GetLayerIdentifier(layerKey)
+	dfsUploadID, err := r.dfs.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []s3types.CompletedPart
+	chunkSize := int64(r.chunkSize())
+	for offset := int64(0); offset < content.Size(); offset += chunkSize {
+		partNumber := offset/chunkSize + 1
+		partSize := chunkSize
+		if remaining := content.Size() - offset; remaining < partSize {
+			partSize = remaining
+		}
+		part := io.NewSectionReader(content, offset, partSize)
+		partDigest, err := digest.FromReader(digest.Canonical, part)
+		if err != nil {
+			return "", err
+		}
+		if _, err = part.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+
+		completed, err := r.dfs.UploadPart(ctx, dfsUploadID, key, partDigest, partNumber, part, partSize)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, completed)
+	}
+
+	return r.dfs.CompleteMultipartUploadInput(ctx, dfsUploadID, key, dig, parts)
+}
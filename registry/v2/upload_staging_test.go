@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/containerish/OpenRegistry/dfs/memory"
+)
+
+// discardDFS drops the parts it's sent, so that the layer isn't held in memory by the DFS either
+type discardDFS struct {
+	*memory.DFS
+	received int64
+}
+
+func (d *discardDFS) UploadPart(
+	_ context.Context,
+	_, _, _ string,
+	partNumber int64,
+	content io.ReadSeeker,
+	_ int64,
+) (s3types.CompletedPart, error) {
+	n, err := io.Copy(io.Discard, content)
+	d.received += n
+	return s3types.CompletedPart{PartNumber: int32(partNumber)}, err
+}
+
+func (d *discardDFS) CompleteMultipartUploadInput(
+	_ context.Context,
+	_, key, _ string,
+	_ []s3types.CompletedPart,
+) (string, error) {
+	return key, nil
+}
+
+const pattern = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// patternReader reads the n bytes of a repeating pattern starting at offset, without holding them in memory
+func patternReader(offset, n int64) io.Reader {
+	return io.LimitReader(&repeatReader{offset: int(offset % int64(len(pattern)))}, n)
+}
+
+type repeatReader struct {
+	offset int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = pattern[(r.offset+i)%len(pattern)]
+	}
+	r.offset = (r.offset + len(p)) % len(pattern)
+	return len(p), nil
+}
+
+func TestStagedUploadMemoryCeiling(t *testing.T) {
+	const (
+		chunkSize = 8 << 20
+		chunks    = 8
+		ceiling   = 4 << 20
+	)
+
+	store := newUploadStore()
+	r := newTestRegistry(store, memory.New())
+	storage := &discardDFS{DFS: memory.New()}
+	r.dfs = storage
+	stager, err := newUploadStager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.stager = stager
+
+	h := sha256.New()
+	if _, err = io.Copy(h, patternReader(0, chunkSize*chunks)); err != nil {
+		t.Fatal(err)
+	}
+	dig := "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+	uuid := startUpload(t, r, testNamespace, "")
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	for i := int64(0); i < chunks; i++ {
+		ctx, rec := uploadContext(http.MethodPatch, testNamespace, uuid, nil)
+		ctx.Request().Body = io.NopCloser(patternReader(i*chunkSize, chunkSize))
+		ctx.Request().ContentLength = chunkSize
+		ctx.Request().Header.Set("Content-Range", fmt.Sprintf("%d-%d", i*chunkSize, (i+1)*chunkSize-1))
+		if err = r.b.UploadBlob(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("chunk %d: got status %d, want %d: %s", i, rec.Code, http.StatusAccepted, rec.Body)
+		}
+	}
+	if code := completeUpload(t, r, uuid, dig, nil); code != http.StatusCreated {
+		t.Fatalf("got status %d completing the upload, want %d", code, http.StatusCreated)
+	}
+
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > ceiling {
+		t.Errorf("allocated %d bytes for a %d bytes upload, want at most %d", allocated, chunkSize*chunks, ceiling)
+	}
+	if storage.received != chunkSize*chunks {
+		t.Errorf("got %d bytes uploaded to the DFS, want %d", storage.received, chunkSize*chunks)
+	}
+	if _, ok := store.layers[dig]; !ok {
+		t.Error("the layer wasn't stored")
+	}
+	assertNoResidualState(t, r, store)
+}
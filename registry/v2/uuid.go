@@ -38,6 +38,14 @@ func GetLayerIdentifier(identifier string) string {
 	return fmt.Sprintf("layers/%s", identifier)
 }
 
+// GetManifestContentIdentifier is the key of a manifest, manifests are stored once whichever repositories they're
+// pushed to
+func GetManifestContentIdentifier(digest string) string {
+	return fmt.Sprintf("manifests/%s", digest)
+}
+
+// GetManifestIdentifier is the key manifests were stored at before they were stored by digest only, they're
+// still read from it when they aren't stored by digest
 func GetManifestIdentifier(namespace, reference string) string {
 	return fmt.Sprintf("%s/manifests/%s", namespace, reference)
 }
@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/registry/v2/digest"
+	"github.com/containerish/OpenRegistry/store/postgres"
+)
+
+const (
+	PolicyNone             = "none"
+	PolicyRequireSignature = "require-signature"
+
+	// cosign stores the signature of <subject digest> as a manifest tagged sha256-<hex>.sig
+	cosignSignatureSuffix = ".sig"
+)
+
+// cosignSignatureTag only matches the tags cosign pushes the signatures with, any other tag must be signed, even
+// one ending with .sig
+var cosignSignatureTag = regexp.MustCompile(`^sha256-[a-f0-9]{64}\.sig$`) //nolint
+
+type (
+	// ManifestVerifier is called during PushManifest, before the manifest is stored.
+	// A non nil error rejects the push with 403 DENIED
+	ManifestVerifier interface {
+		Verify(ctx context.Context, namespace, ref, dig string) error
+	}
+
+	noopVerifier struct{}
+
+	// signatureVerifier only lets a tag point to a manifest that has a cosign signature in the same repository.
+	// Pushing by digest and pushing the signature itself is always allowed, so the expected flow is:
+	// push by digest -> cosign sign -> push the tag
+	signatureVerifier struct {
+		store postgres.RegistryStore
+	}
+
+	// policyVerifier picks the verifier from the policy configured for the repository
+	policyVerifier struct {
+		verifiers     map[string]ManifestVerifier
+		repositories  map[string]string
+		defaultPolicy string
+	}
+)
+
+func NewNoopVerifier() ManifestVerifier {
+	return &noopVerifier{}
+}
+
+func NewSignatureVerifier(store postgres.RegistryStore) ManifestVerifier {
+	return &signatureVerifier{store: store}
+}
+
+// NewManifestVerifier returns the verifier for the content trust config, a nil config means no policy is enforced
+func NewManifestVerifier(cfg *config.ContentTrust, store postgres.RegistryStore) ManifestVerifier {
+	if cfg == nil {
+		return NewNoopVerifier()
+	}
+
+	defaultPolicy := cfg.DefaultPolicy
+	if defaultPolicy == "" {
+		defaultPolicy = PolicyNone
+	}
+
+	return &policyVerifier{
+		defaultPolicy: defaultPolicy,
+		repositories:  cfg.Repositories,
+		verifiers: map[string]ManifestVerifier{
+			PolicyNone:             NewNoopVerifier(),
+			PolicyRequireSignature: NewSignatureVerifier(store),
+		},
+	}
+}
+
+func (v *noopVerifier) Verify(ctx context.Context, namespace, ref, dig string) error {
+	return nil
+}
+
+func (v *signatureVerifier) Verify(ctx context.Context, namespace, ref, dig string) error {
+	if isDigest(ref) || cosignSignatureTag.MatchString(ref) {
+		return nil
+	}
+
+	signatureTag := strings.Replace(dig, ":", "-", 1) + cosignSignatureSuffix
+	if _, err := v.store.GetManifestByReference(ctx, namespace, signatureTag); err != nil {
+		return fmt.Errorf("ERR_MANIFEST_UNSIGNED: no signature (%s) found for %s", signatureTag, dig)
+	}
+
+	return nil
+}
+
+func (v *policyVerifier) Verify(ctx context.Context, namespace, ref, dig string) error {
+	policy, ok := v.repositories[namespace]
+	if !ok {
+		policy = v.defaultPolicy
+	}
+
+	verifier, ok := v.verifiers[policy]
+	if !ok {
+		return fmt.Errorf("ERR_UNKNOWN_SIGNING_POLICY: %s", policy)
+	}
+
+	return verifier.Verify(ctx, namespace, ref, dig)
+}
+
+func isDigest(ref string) bool {
+	return digest.Validate(ref) == nil
+}
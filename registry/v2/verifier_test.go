@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// signatureStore has the manifests of refs in every repository
+type signatureStore struct {
+	postgres.PersistentStore
+	refs map[string]bool
+}
+
+func (s *signatureStore) GetManifestByReference(_ context.Context, namespace, ref string) (*types.ConfigV2, error) {
+	if !s.refs[ref] {
+		return nil, postgres.ErrNotFound
+	}
+	return &types.ConfigV2{Namespace: namespace, Reference: ref}, nil
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	signed := "sha256:" + strings.Repeat("a", 64)
+	unsigned := "sha256:" + strings.Repeat("b", 64)
+	signature := "sha256-" + strings.Repeat("a", 64) + ".sig"
+	store := &signatureStore{refs: map[string]bool{signature: true}}
+
+	v := NewManifestVerifier(&config.ContentTrust{
+		DefaultPolicy: PolicyRequireSignature,
+		Repositories:  map[string]string{"johndoe/unsigned": PolicyNone, "johndoe/unknown": "unknown"},
+	}, store)
+
+	tests := []struct {
+		name      string
+		namespace string
+		ref       string
+		dig       string
+		wantErr   string
+	}{
+		{name: "signed tag", namespace: "johndoe/alpine", ref: "latest", dig: signed},
+		{name: "unsigned tag", namespace: "johndoe/alpine", ref: "latest", dig: unsigned, wantErr: "ERR_MANIFEST_UNSIGNED"},
+		{name: "push by digest", namespace: "johndoe/alpine", ref: unsigned, dig: unsigned},
+		{
+			name:      "cosign signature",
+			namespace: "johndoe/alpine",
+			ref:       "sha256-" + strings.Repeat("b", 64) + ".sig",
+			dig:       unsigned,
+		},
+		{
+			name:      "tag ending with .sig",
+			namespace: "johndoe/alpine",
+			ref:       "latest.sig",
+			dig:       unsigned,
+			wantErr:   "ERR_MANIFEST_UNSIGNED",
+		},
+		{
+			name:      "short cosign like tag",
+			namespace: "johndoe/alpine",
+			ref:       "sha256-abc.sig",
+			dig:       unsigned,
+			wantErr:   "ERR_MANIFEST_UNSIGNED",
+		},
+		{name: "repository without a policy", namespace: "johndoe/unsigned", ref: "latest", dig: unsigned},
+		{
+			name:      "unknown policy",
+			namespace: "johndoe/unknown",
+			ref:       "latest",
+			dig:       signed,
+			wantErr:   "ERR_UNKNOWN_SIGNING_POLICY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(context.Background(), tt.namespace, tt.ref, tt.dig)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("got error %v, want the push accepted", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNoPolicy(t *testing.T) {
+	v := NewManifestVerifier(nil, &signatureStore{})
+	if err := v.Verify(context.Background(), "johndoe/alpine", "latest", "sha256:"+strings.Repeat("b", 64)); err != nil {
+		t.Errorf("got error %v without a content trust config", err)
+	}
+}
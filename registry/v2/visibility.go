@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdateRepositoryVisibility
+// PUT /v2/<name>/visibility {"visibility": "public" | "private"}
+func (r *registry) UpdateRepositoryVisibility(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	namespace := types.Namespace(ctx)
+
+	var body struct {
+		Visibility types.RepositoryVisibility `json:"visibility"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeUnsupported, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if !body.Visibility.IsValid() {
+		errMsg := r.errorResponse(RegistryErrorCodeUnsupported, "visibility must be either public or private", nil)
+		echoErr := ctx.JSONBlob(http.StatusBadRequest, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	if err := r.store.SetRepositoryVisibility(ctx.Request().Context(), namespace, body.Visibility); err != nil {
+		errMsg := r.errorResponse(RegistryErrorCodeNameUnknown, err.Error(), nil)
+		echoErr := ctx.JSONBlob(http.StatusNotFound, errMsg)
+		r.logger.Log(ctx, fmt.Errorf("%s", errMsg))
+		return echoErr
+	}
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"namespace":  namespace,
+		"visibility": body.Visibility,
+	})
+	r.logger.Log(ctx, nil)
+	return echoErr
+}
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// ApiVersionHeader sets Docker-Distribution-API-Version on every /v2 response, the errors of the auth
+// middlewares and unknown routes included. It must run before the router (echo.Pre)
+func ApiVersionHeader() echo.MiddlewareFunc {
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if p := ctx.Request().URL.Path; p == V2 || strings.HasPrefix(p, V2+"/") {
+				ctx.Response().Header().Set(
+					registry.HeaderDockerDistributionApiVersion, registry.DockerDistributionApiVersion,
+				)
+			}
+
+			return hf(ctx)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func TestApiVersionHeader(t *testing.T) {
+	e := echo.New()
+	e.Pre(ApiVersionHeader())
+	e.GET(V2+Namespace+ManifestsReference, func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	})
+	e.GET(V2+Namespace+TagsList, func(ctx echo.Context) error {
+		return echo.ErrUnauthorized
+	})
+	e.GET(Readiness, func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/v2/johndoe/alpine/manifests/latest", want: registry.DockerDistributionApiVersion},
+		{path: "/v2/johndoe/alpine/tags/list", want: registry.DockerDistributionApiVersion},
+		{path: "/v2/unknown/route", want: registry.DockerDistributionApiVersion},
+		{path: "/v2", want: registry.DockerDistributionApiVersion},
+		{path: Readiness},
+		{path: "/v20/johndoe"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := rec.Header().Get(registry.HeaderDockerDistributionApiVersion); got != tt.want {
+			t.Errorf("%s: got %s %q, want %q", tt.path, registry.HeaderDockerDistributionApiVersion, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultMaxBodySize = 1024 * 1024
+	// minManifestBodySize is the manifest size the distribution spec asks registries to accept at least
+	minManifestBodySize = 4 * 1024 * 1024
+)
+
+// blobUploadRoutes stream their body to the DFS, the body limit doesn't apply to them
+var blobUploadRoutes = map[string]bool{ //nolint
+	V2 + Namespace + BlobsUploads:       true,
+	V2 + Namespace + BlobsUploadsUUID:   true,
+	V2 + Namespace + BlobsMonolithicPut: true,
+}
+
+// BodyLimit rejects the request bodies over limit bytes with 413, except for the blob uploads. The body is read
+// up front, so that a chunked body over the limit is rejected before the handler runs. Manifests can always be
+// up to minManifestBodySize. It must run after the router (echo.Use), the routes are matched by their path
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	if limit <= 0 {
+		limit = defaultMaxBodySize
+	}
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			if req.Body == nil || req.ContentLength == 0 || blobUploadRoutes[ctx.Path()] {
+				return hf(ctx)
+			}
+
+			maxSize := limit
+			if ctx.Path() == V2+Namespace+ManifestsReference && maxSize < minManifestBodySize {
+				maxSize = minManifestBodySize
+			}
+			if req.ContentLength > maxSize {
+				return bodyTooLarge(ctx, maxSize)
+			}
+
+			bz, err := io.ReadAll(io.LimitReader(req.Body, maxSize+1))
+			_ = req.Body.Close()
+			if err != nil {
+				return ctx.JSON(http.StatusBadRequest, echo.Map{
+					"error": err.Error(),
+				})
+			}
+			if int64(len(bz)) > maxSize {
+				return bodyTooLarge(ctx, maxSize)
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(bz))
+			return hf(ctx)
+		}
+	}
+}
+
+func bodyTooLarge(ctx echo.Context, limit int64) error {
+	msg := fmt.Sprintf("request body is larger than %d bytes", limit)
+	if strings.HasPrefix(ctx.Path(), V2) {
+		return ctx.JSON(http.StatusRequestEntityTooLarge, registry.RegistryErrors{
+			Errors: []registry.RegistryError{{Code: registry.RegistryErrorCodeSizeInvalid, Message: msg}},
+		})
+	}
+
+	return ctx.JSON(http.StatusRequestEntityTooLarge, echo.Map{
+		"error": msg,
+	})
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newBodyLimitServer(limit int64) *echo.Echo {
+	e := echo.New()
+	e.Use(BodyLimit(limit))
+
+	signIn := func(ctx echo.Context) error {
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&body); err != nil {
+			return ctx.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		return ctx.String(http.StatusOK, body.Email)
+	}
+	readAll := func(ctx echo.Context) error {
+		n, err := io.Copy(io.Discard, ctx.Request().Body)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(http.StatusOK, n)
+	}
+	e.POST(Auth+"/signin", signIn)
+	e.PUT(V2+Namespace+ManifestsReference, readAll)
+	e.PATCH(V2+Namespace+BlobsUploadsUUID, readAll)
+	return e
+}
+
+// sendBody sends the body with its Content-Length, or chunked when chunked is set
+func sendBody(e *echo.Echo, method, path, body string, chunked bool) *httptest.ResponseRecorder {
+	var reader io.Reader = strings.NewReader(body)
+	if chunked {
+		// a reader of unknown length, the request is sent without a Content-Length
+		reader = io.MultiReader(reader)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if chunked {
+		req.ContentLength = -1
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBodyLimit(t *testing.T) {
+	e := newBodyLimitServer(1024)
+	login := `{"email":"johndoe@example.com","password":"Tr0ub4dor&3"}`
+	oversized := `{"email":"johndoe@example.com","password":"` + strings.Repeat("a", 2048) + `"}`
+
+	for _, chunked := range []bool{false, true} {
+		rec := sendBody(e, http.MethodPost, "/auth/signin", login, chunked)
+		if rec.Code != http.StatusOK || rec.Body.String() != "johndoe@example.com" {
+			t.Errorf("chunked %t: got status %d and %s for a normal login, want it to pass", chunked, rec.Code, rec.Body)
+		}
+
+		rec = sendBody(e, http.MethodPost, "/auth/signin", oversized, chunked)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked %t: got status %d for an oversized login, want %d", chunked, rec.Code,
+				http.StatusRequestEntityTooLarge)
+		}
+		if want := `{"error":"request body is larger than 1024 bytes"}` + "\n"; rec.Body.String() != want {
+			t.Errorf("chunked %t: got body %s, want %s", chunked, rec.Body, want)
+		}
+	}
+
+	// the manifests can be up to 4MiB, whatever the limit
+	const manifestPath = "/v2/johndoe/alpine/manifests/latest"
+	manifest := strings.Repeat("m", minManifestBodySize)
+	if rec := sendBody(e, http.MethodPut, manifestPath, manifest, false); rec.Code != http.StatusOK {
+		t.Errorf("got status %d for a 4MiB manifest, want %d", rec.Code, http.StatusOK)
+	}
+	rec := sendBody(e, http.MethodPut, manifestPath, manifest+"m", true)
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "SIZE_INVALID") {
+		t.Errorf("got status %d and %s for a manifest over 4MiB, want %d and SIZE_INVALID", rec.Code, rec.Body,
+			http.StatusRequestEntityTooLarge)
+	}
+
+	// the blob uploads have no limit
+	chunk := strings.Repeat("b", minManifestBodySize*2)
+	rec = sendBody(e, http.MethodPatch, "/v2/johndoe/alpine/blobs/uploads/some-uuid", chunk, true)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d for a blob chunk, want %d", rec.Code, http.StatusOK)
+	}
+}
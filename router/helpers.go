@@ -1,9 +1,14 @@
 package router
 
 import (
+	"expvar"
 	"net/http"
+	"net/http/pprof"
 
+	"github.com/containerish/OpenRegistry/audit"
 	"github.com/containerish/OpenRegistry/auth"
+	"github.com/containerish/OpenRegistry/registry/v2/extensions"
+	"github.com/containerish/OpenRegistry/registry/v2/retention"
 	"github.com/labstack/echo/v4"
 )
 
@@ -21,8 +26,64 @@ func RegisterAuthRoutes(authRouter *echo.Group, authSvc auth.Authentication) {
 	authRouter.Add(http.MethodDelete, "/signout", authSvc.SignOut)
 	authRouter.Add(http.MethodGet, "/sessions/me", authSvc.ReadUserWithSession)
 	authRouter.Add(http.MethodDelete, "/sessions", authSvc.ExpireSessions)
+	authRouter.Add(http.MethodGet, "/sessions", authSvc.ListSessions, authSvc.JWT())
+	authRouter.Add(http.MethodDelete, "/sessions/:id", authSvc.RevokeSession, authSvc.JWT())
 	authRouter.Add(http.MethodGet, "/renew", authSvc.RenewAccessToken)
 	authRouter.Add(http.MethodPost, "/reset-password", authSvc.ResetPassword, authSvc.JWT())
 	authRouter.Add(http.MethodPost, "/reset-forgotten-password", authSvc.ResetForgottenPassword, authSvc.JWT())
 	authRouter.Add(http.MethodGet, "/forgot-password", authSvc.ForgotPassword)
 }
+
+// RegisterOrganizationRoutes includes the endpoints to create organizations and manage their members
+func RegisterOrganizationRoutes(orgRouter *echo.Group, authSvc auth.Authentication) {
+	orgRouter.Add(http.MethodPost, Root, authSvc.CreateOrganization)
+	orgRouter.Add(http.MethodGet, OrganizationMembers, authSvc.ListOrganizationMembers)
+	orgRouter.Add(http.MethodPut, OrganizationMember, authSvc.SetOrganizationMember)
+	orgRouter.Add(http.MethodDelete, OrganizationMember, authSvc.DeleteOrganizationMember)
+}
+
+// RegisterAdminRoutes includes all the endpoints only available to the registry admins
+func RegisterAdminRoutes(
+	adminRouter *echo.Group,
+	authSvc auth.Authentication,
+	auditLogger audit.Logger,
+	retentionEvaluator retention.Evaluator,
+) {
+	adminRouter.Add(http.MethodGet, AuditLog, auditLogger.AuditLog)
+
+	adminRouter.Add(http.MethodGet, Users, authSvc.ListUsers)
+	adminRouter.Add(http.MethodDelete, User, authSvc.DeleteUser)
+	adminRouter.Add(http.MethodPost, UserDeactivate, authSvc.DeactivateUser)
+	adminRouter.Add(http.MethodPost, UserReactivate, authSvc.ReactivateUser)
+
+	adminRouter.Add(http.MethodGet, RetentionPolicy, retentionEvaluator.GetPolicy)
+	adminRouter.Add(http.MethodPut, RetentionPolicy, retentionEvaluator.SetPolicy)
+	adminRouter.Add(http.MethodDelete, RetentionPolicy, retentionEvaluator.DeletePolicy)
+	adminRouter.Add(http.MethodPost, RetentionApply, retentionEvaluator.ApplyPolicy)
+	adminRouter.Add(http.MethodPost, RetentionApplyAll, retentionEvaluator.ApplyPolicies)
+}
+
+// RegisterPublicRoutes includes the JSON browse APIs, they need no authentication. The optional authentication lets
+// the users see their own private repositories
+func RegisterPublicRoutes(apiRouter *echo.Group, ext extensions.Extenion, optionalAuth echo.MiddlewareFunc) {
+	apiRouter.Add(http.MethodGet, Repositories, ext.PublicRepositories)
+	apiRouter.Add(http.MethodGet, PublicRepository, ext.PublicRepository)
+	apiRouter.Add(http.MethodGet, UserRepositories, ext.UserRepositories, optionalAuth)
+}
+
+// RegisterProfilingRoutes includes the pprof profiles and the runtime metrics behind the middlewares, pprof.Index
+// expects them under /debug/pprof/. Nothing is registered unless the profiling is enabled
+func RegisterProfilingRoutes(e *echo.Echo, enabled bool, middlewares ...echo.MiddlewareFunc) {
+	if !enabled {
+		return
+	}
+
+	debugRouter := e.Group(Debug, middlewares...)
+	debugRouter.Add(http.MethodGet, Profiling+"/*", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	debugRouter.Add(http.MethodGet, Profiling+"/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	debugRouter.Add(http.MethodGet, Profiling+"/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	debugRouter.Add(http.MethodGet, Profiling+"/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debugRouter.Add(http.MethodPost, Profiling+"/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debugRouter.Add(http.MethodGet, Profiling+"/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	debugRouter.Add(http.MethodGet, Vars, echo.WrapHandler(expvar.Handler()))
+}
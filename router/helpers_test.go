@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// adminOnly stands in for the authentication of the admins, only the requests with the admin token pass
+func adminOnly(hf echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if ctx.Request().Header.Get(echo.HeaderAuthorization) != "Bearer admin" {
+			return ctx.NoContent(http.StatusUnauthorized)
+		}
+		return hf(ctx)
+	}
+}
+
+func TestProfilingRoutes(t *testing.T) {
+	paths := []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline", "/debug/vars"}
+
+	disabled := echo.New()
+	RegisterProfilingRoutes(disabled, false, adminOnly)
+	for _, path := range paths {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer admin")
+		rec := httptest.NewRecorder()
+		disabled.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d with the profiling disabled, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+
+	enabled := echo.New()
+	RegisterProfilingRoutes(enabled, true, adminOnly)
+	for _, path := range paths {
+		rec := httptest.NewRecorder()
+		enabled.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d without the admin token, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer admin")
+		rec = httptest.NewRecorder()
+		enabled.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d for the admin, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+}
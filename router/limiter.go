@@ -0,0 +1,183 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/ratelimiter"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// ConcurrencyLimiter sheds the requests over the limits with 503, once they've waited for QueueTimeout.
+// Reads (GET and HEAD) and writes are counted separately, so a burst of pulls doesn't block pushes
+func ConcurrencyLimiter(limit *config.ConcurrencyLimit) echo.MiddlewareFunc {
+	if limit == nil {
+		limit = &config.ConcurrencyLimit{}
+	}
+
+	var reads, writes chan struct{}
+	if limit.Reads > 0 {
+		reads = make(chan struct{}, limit.Reads)
+	}
+	if limit.Writes > 0 {
+		writes = make(chan struct{}, limit.Writes)
+	}
+
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(limit.QueueTimeout.Seconds()))))
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			slots := writes
+			if m := ctx.Request().Method; m == http.MethodGet || m == http.MethodHead {
+				slots = reads
+			}
+			if slots == nil {
+				return hf(ctx)
+			}
+
+			if !acquire(ctx, slots, limit.QueueTimeout) {
+				ctx.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+				return ctx.JSON(http.StatusServiceUnavailable, registry.RegistryErrors{
+					Errors: []registry.RegistryError{{
+						Code:    registry.RegistryErrorCodeUnavailable,
+						Message: fmt.Sprintf("too many requests in flight, retry in %s seconds", retryAfter),
+					}},
+				})
+			}
+			defer func() { <-slots }()
+
+			return hf(ctx)
+		}
+	}
+}
+
+// DownloadLimiter caps the blob downloads served at once to every client, the user for the authenticated requests
+// and the IP for the other ones, and to all of them together. A download over a limit waits up to
+// DownloadQueueTimeout for another one to finish, then gets 429 when the client is over its own limit, or 503 when
+// the registry is. It must run after the authentication middlewares, so that userID can tell who made the request
+func DownloadLimiter(cfg *config.Registry, userID ratelimiter.UserIdentifier) echo.MiddlewareFunc {
+	var global chan struct{}
+	if cfg.MaxConcurrentDownloads > 0 {
+		global = make(chan struct{}, cfg.MaxConcurrentDownloads)
+	}
+
+	var clients *clientSlots
+	if cfg.MaxConcurrentDownloadsPerClient > 0 {
+		clients = &clientSlots{limit: cfg.MaxConcurrentDownloadsPerClient, slots: map[string]*clientSlot{}}
+	}
+
+	timeout := cfg.DownloadQueueTimeout
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(timeout.Seconds()))))
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if clients != nil {
+				client := "ip:" + ctx.RealIP()
+				if id, ok := userID(ctx); ok {
+					client = "user:" + id
+				}
+
+				slots := clients.get(client)
+				defer clients.put(client)
+
+				if !acquire(ctx, slots, timeout) {
+					ctx.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+					return ctx.JSON(http.StatusTooManyRequests, registry.RegistryErrors{
+						Errors: []registry.RegistryError{{
+							Code: registry.RegistryErrorCodeTooManyRequests,
+							Message: fmt.Sprintf(
+								"too many downloads in flight for this client, retry in %s seconds", retryAfter,
+							),
+						}},
+					})
+				}
+				defer func() { <-slots }()
+			}
+
+			if global != nil {
+				if !acquire(ctx, global, timeout) {
+					ctx.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+					return ctx.JSON(http.StatusServiceUnavailable, registry.RegistryErrors{
+						Errors: []registry.RegistryError{{
+							Code:    registry.RegistryErrorCodeUnavailable,
+							Message: fmt.Sprintf("too many downloads in flight, retry in %s seconds", retryAfter),
+						}},
+					})
+				}
+				defer func() { <-global }()
+			}
+
+			return hf(ctx)
+		}
+	}
+}
+
+// clientSlots are the download slots of the clients with a download in flight or waiting, the others are forgotten
+type clientSlots struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]*clientSlot
+}
+
+type clientSlot struct {
+	slots chan struct{}
+	// refs are the downloads of the client, in flight or waiting for a slot
+	refs int
+}
+
+func (c *clientSlots) get(client string) chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.slots[client]
+	if !ok {
+		s = &clientSlot{slots: make(chan struct{}, c.limit)}
+		c.slots[client] = s
+	}
+	s.refs++
+
+	return s.slots
+}
+
+func (c *clientSlots) put(client string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.slots[client]; ok {
+		s.refs--
+		if s.refs <= 0 {
+			delete(c.slots, client)
+		}
+	}
+}
+
+// acquire takes a slot, waiting at most for timeout. It gives up when the client goes away
+func acquire(ctx echo.Context, slots chan struct{}, timeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Request().Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/labstack/echo/v4"
+)
+
+// blockingHandler holds every request until it's released, started gets a value once a request is being served
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *blockingHandler) serve(ctx echo.Context) error {
+	b.started <- struct{}{}
+	<-b.release
+	return ctx.NoContent(http.StatusOK)
+}
+
+// serveInBackground serves the request in a goroutine and waits until the handler is serving it
+func serveInBackground(
+	t *testing.T,
+	e *echo.Echo,
+	b *blockingHandler,
+	req *http.Request,
+) chan *httptest.ResponseRecorder {
+	t.Helper()
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		done <- rec
+	}()
+
+	select {
+	case <-b.started:
+	case <-time.After(time.Second):
+		t.Fatal("the request didn't reach the handler")
+	}
+	return done
+}
+
+func TestConcurrencyLimiterShedsAndRecovers(t *testing.T) {
+	b := newBlockingHandler()
+	e := echo.New()
+	e.Use(ConcurrencyLimiter(&config.ConcurrencyLimit{Reads: 1, Writes: 1, QueueTimeout: time.Millisecond * 50}))
+	e.GET("/", b.serve)
+	e.PUT("/", b.serve)
+
+	inFlight := serveInBackground(t, e, b, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d over the limit, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if retryAfter := rec.Header().Get(echo.HeaderRetryAfter); retryAfter != "1" {
+		t.Errorf("got Retry-After %q, want 1", retryAfter)
+	}
+
+	// the writes have their own slots
+	write := serveInBackground(t, e, b, httptest.NewRequest(http.MethodPut, "/", nil))
+
+	b.release <- struct{}{}
+	if rec = <-inFlight; rec.Code != http.StatusOK {
+		t.Fatalf("got status %d for the request in flight, want %d", rec.Code, http.StatusOK)
+	}
+	b.release <- struct{}{}
+	if rec = <-write; rec.Code != http.StatusOK {
+		t.Fatalf("got status %d for the write, want %d", rec.Code, http.StatusOK)
+	}
+
+	// the slot is free again
+	next := serveInBackground(t, e, b, httptest.NewRequest(http.MethodGet, "/", nil))
+	b.release <- struct{}{}
+	if rec = <-next; rec.Code != http.StatusOK {
+		t.Errorf("got status %d once the slot is free, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestConcurrencyLimiterQueuesUntilTimeout(t *testing.T) {
+	b := newBlockingHandler()
+	e := echo.New()
+	e.Use(ConcurrencyLimiter(&config.ConcurrencyLimit{Reads: 1, QueueTimeout: time.Second}))
+	e.GET("/", b.serve)
+
+	inFlight := serveInBackground(t, e, b, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// the queued request gets the slot once the one in flight finishes, before the queue timeout
+	queued := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		queued <- rec
+	}()
+	time.Sleep(time.Millisecond * 20)
+	b.release <- struct{}{}
+	<-inFlight
+
+	select {
+	case <-b.started:
+	case <-time.After(time.Second):
+		t.Fatal("the queued request didn't reach the handler")
+	}
+	b.release <- struct{}{}
+	if rec := <-queued; rec.Code != http.StatusOK {
+		t.Errorf("got status %d for the queued request, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestDownloadLimiter(t *testing.T) {
+	b := newBlockingHandler()
+	e := echo.New()
+	cfg := &config.Registry{
+		MaxConcurrentDownloads:          3,
+		MaxConcurrentDownloadsPerClient: 2,
+		DownloadQueueTimeout:            time.Millisecond * 50,
+	}
+	// the client is the user named by the header
+	userID := func(ctx echo.Context) (string, bool) {
+		user := ctx.Request().Header.Get("X-User")
+		return user, user != ""
+	}
+	e.Use(DownloadLimiter(cfg, userID))
+	e.GET("/", b.serve)
+
+	pull := func(user string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", user)
+		return req
+	}
+	expectLimited := func(user string, status int, code string) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, pull(user))
+		if rec.Code != status {
+			t.Fatalf("%s: got status %d, want %d", user, rec.Code, status)
+		}
+		if retryAfter := rec.Header().Get(echo.HeaderRetryAfter); retryAfter != "1" {
+			t.Errorf("%s: got Retry-After %q, want 1", user, retryAfter)
+		}
+		var errs registry.RegistryErrors
+		if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+			t.Fatal(err)
+		}
+		if len(errs.Errors) != 1 || errs.Errors[0].Code != code {
+			t.Errorf("%s: got errors %+v, want %s", user, errs.Errors, code)
+		}
+	}
+
+	inFlight := []chan *httptest.ResponseRecorder{
+		serveInBackground(t, e, b, pull("johndoe")),
+		serveInBackground(t, e, b, pull("johndoe")),
+	}
+	expectLimited("johndoe", http.StatusTooManyRequests, registry.RegistryErrorCodeTooManyRequests)
+
+	// the other clients have slots of their own, up to the global limit
+	inFlight = append(inFlight, serveInBackground(t, e, b, pull("janedoe")))
+	expectLimited("janedoe", http.StatusServiceUnavailable, registry.RegistryErrorCodeUnavailable)
+
+	for range inFlight {
+		b.release <- struct{}{}
+	}
+	for _, done := range inFlight {
+		if rec := <-done; rec.Code != http.StatusOK {
+			t.Fatalf("got status %d for a download in flight, want %d", rec.Code, http.StatusOK)
+		}
+	}
+
+	// the slots are free again
+	next := serveInBackground(t, e, b, pull("johndoe"))
+	b.release <- struct{}{}
+	if rec := <-next; rec.Code != http.StatusOK {
+		t.Errorf("got status %d once the slots are free, want %d", rec.Code, http.StatusOK)
+	}
+}
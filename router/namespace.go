@@ -0,0 +1,156 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultMaxNamespaceDepth = 5
+
+// namespacePrefix is a path which is followed by a repository name, routes are the rest of the path after the name,
+// split in path segments, the longest first. A segment starting with : is a route param, an empty route is the name
+// alone
+type namespacePrefix struct {
+	path    string
+	routes  [][]string
+	invalid func(ctx echo.Context, msg string) error
+}
+
+// namespacePrefixes are the /v2/<name>/ routes, the retention policy routes of the admins and the public
+// repository of the JSON API
+var namespacePrefixes = []namespacePrefix{ //nolint
+	{
+		path: V2,
+		routes: newNamespaceRoutes(
+			ManifestsVerify, ManifestsTree, ManifestsReference, ImageConfig,
+			BlobsMonolithicPut, BlobsDownloadURL, BlobsUploadsUUID, BlobsUploads, BlobsExist, BlobsDigest,
+			TagsList, TagsDetail, Tags, Build, Builds, Quota, Visibility, Stats, Repository,
+		),
+		invalid: nameInvalid,
+	},
+	{
+		path:    Admin + strings.TrimSuffix(RetentionPolicy, Namespace),
+		routes:  newNamespaceRoutes(strings.TrimPrefix(RetentionApply, RetentionPolicy), ""),
+		invalid: apiNameInvalid,
+	},
+	{
+		path:    APIV1 + strings.TrimSuffix(PublicRepository, Namespace),
+		routes:  newNamespaceRoutes(""),
+		invalid: apiNameInvalid,
+	},
+}
+
+func newNamespaceRoutes(routes ...string) [][]string {
+	segments := make([][]string, 0, len(routes))
+	for _, route := range routes {
+		if route == "" {
+			segments = append(segments, []string{})
+			continue
+		}
+		segments = append(segments, strings.Split(strings.TrimPrefix(route, "/"), "/"))
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return len(segments[i]) > len(segments[j])
+	})
+
+	return segments
+}
+
+// nameLength returns the number of leading segments which make up the repository name, the rest of the path being
+// one of the routes. Like distribution, the route is matched from the end of the path, so that name components
+// which are also route segments (e.g. team/app/config/manifests/latest) stay in the name. The name is as short as
+// possible when the path matches several routes
+func nameLength(routes [][]string, segments []string) int {
+	for _, route := range routes {
+		length := len(segments) - len(route)
+		if length < 2 {
+			continue
+		}
+
+		matches := true
+		for i, segment := range route {
+			path := segments[length+i]
+			if strings.HasPrefix(segment, ":") {
+				matches = path != ""
+			} else {
+				matches = path == segment
+			}
+			if !matches {
+				break
+			}
+		}
+		if matches {
+			return length
+		}
+	}
+
+	return 0
+}
+
+// NestedNamespaces lets repository names have up to maxDepth path components, e.g.
+// /v2/team/project/app/manifests/latest. The routes only match /:username/:imagename, so the components after the
+// first one are escaped into a single path segment for the router, types.Namespace unescapes them. Besides /v2, it
+// applies to the namespacePrefixes of the admin and JSON APIs. It must run before the router (echo.Pre)
+func NestedNamespaces(maxDepth int) echo.MiddlewareFunc {
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxNamespaceDepth
+	}
+
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			for _, prefix := range namespacePrefixes {
+				if !strings.HasPrefix(req.URL.Path, prefix.path+"/") {
+					continue
+				}
+
+				segments := strings.Split(strings.TrimPrefix(req.URL.EscapedPath(), prefix.path+"/"), "/")
+				depth := nameLength(prefix.routes, segments)
+				// names with two components are routed as they are
+				if depth <= 2 {
+					return hf(ctx)
+				}
+
+				if depth > maxDepth {
+					return prefix.invalid(
+						ctx, fmt.Sprintf("repository name can have at most %d path components", maxDepth),
+					)
+				}
+				for _, component := range segments[:depth] {
+					if !types.IsValidNamespaceComponent(component) {
+						return prefix.invalid(ctx, fmt.Sprintf("invalid repository name component: %s", component))
+					}
+				}
+
+				req.URL.RawPath = fmt.Sprintf(
+					"%s/%s/%s", prefix.path, segments[0], strings.Join(segments[1:depth], "%2F"),
+				)
+				if rest := segments[depth:]; len(rest) > 0 {
+					req.URL.RawPath += "/" + strings.Join(rest, "/")
+				}
+				return hf(ctx)
+			}
+
+			return hf(ctx)
+		}
+	}
+}
+
+func nameInvalid(ctx echo.Context, msg string) error {
+	return ctx.JSON(http.StatusBadRequest, registry.RegistryErrors{
+		Errors: []registry.RegistryError{{Code: registry.RegistryErrorCodeNameInvalid, Message: msg}},
+	})
+}
+
+// apiNameInvalid answers like the handlers of the admin and JSON APIs
+func apiNameInvalid(ctx echo.Context, msg string) error {
+	return ctx.JSON(http.StatusBadRequest, echo.Map{
+		"error": msg,
+	})
+}
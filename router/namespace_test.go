@@ -0,0 +1,97 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// newNamespaceServer answers the namespace routes with the repository name and the route param the handler got
+func newNamespaceServer() *echo.Echo {
+	e := echo.New()
+	e.Pre(NestedNamespaces(5))
+
+	v2Router := e.Group(V2 + Namespace)
+	handler := func(param string) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			return ctx.String(http.StatusOK, types.Namespace(ctx)+" "+ctx.Param(param))
+		}
+	}
+	v2Router.GET(ManifestsReference, handler("reference"))
+	v2Router.GET(ImageConfig, handler("reference"))
+	v2Router.GET(BlobsDigest, handler("digest"))
+	v2Router.POST(BlobsUploads, handler("uuid"))
+	v2Router.PATCH(BlobsUploadsUUID, handler("uuid"))
+	v2Router.GET(TagsList, handler("none"))
+	v2Router.GET(Build, handler("id"))
+
+	e.GET(Admin+RetentionPolicy, handler("none"))
+	e.POST(Admin+RetentionApply, handler("none"))
+	e.POST(Admin+RetentionApplyAll, func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "all")
+	})
+	e.GET(APIV1+PublicRepository, handler("none"))
+
+	return e
+}
+
+func TestNestedNamespaces(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/v2/user/image/manifests/latest", want: "user/image latest"},
+		{method: http.MethodGet, path: "/v2/user/group/sub/image/manifests/tag", want: "user/group/sub/image tag"},
+		{method: http.MethodGet, path: "/v2/team/proj/config/manifests/latest", want: "team/proj/config latest"},
+		{method: http.MethodGet, path: "/v2/team/proj/builds/tags/list", want: "team/proj/builds "},
+		{method: http.MethodGet, path: "/v2/team/proj/app/manifests/config", want: "team/proj/app config"},
+		{method: http.MethodGet, path: "/v2/team/proj/app/config/sha256:abc", want: "team/proj/app sha256:abc"},
+		{method: http.MethodGet, path: "/v2/team/blobs/app/blobs/sha256:abc", want: "team/blobs/app sha256:abc"},
+		{method: http.MethodPost, path: "/v2/team/proj/app/blobs/uploads/", want: "team/proj/app "},
+		{method: http.MethodPatch, path: "/v2/team/proj/app/blobs/uploads/some-uuid", want: "team/proj/app some-uuid"},
+		{method: http.MethodGet, path: "/v2/team/proj/stats/builds/42", want: "team/proj/stats 42"},
+		{method: http.MethodGet, path: "/admin/retention/user/image", want: "user/image "},
+		{method: http.MethodGet, path: "/admin/retention/team/proj/app", want: "team/proj/app "},
+		{method: http.MethodPost, path: "/admin/retention/team/proj/app/apply", want: "team/proj/app "},
+		{method: http.MethodPost, path: "/admin/retention/apply", want: "all"},
+		{method: http.MethodGet, path: "/api/v1/repositories/team/proj/app?n=5", want: "team/proj/app "},
+		{method: http.MethodGet, path: "/api/v1/repositories/team/proj/apply", want: "team/proj/apply "},
+	}
+
+	e := newNamespaceServer()
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedNamespacesInvalid(t *testing.T) {
+	paths := []string{
+		"/v2/a/b/c/d/e/f/manifests/latest",
+		"/v2/team/Proj/app/manifests/latest",
+		"/v2/team/proj/app_/manifests/latest",
+		"/admin/retention/a/b/c/d/e/f",
+		"/api/v1/repositories/team/Proj/app",
+	}
+
+	e := newNamespaceServer()
+	for _, path := range paths {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", path, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
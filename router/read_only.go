@@ -0,0 +1,118 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/telemetry"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/labstack/echo/v4"
+)
+
+// ReadOnlyMode rejects the writes to /v2 while it's enabled, e.g. during migrations or DFS maintenance. The pulls
+// are served as usual. It's toggled by the admins at runtime, or by reloading the config (SIGHUP)
+type ReadOnlyMode struct {
+	logger  telemetry.Logger
+	enabled int32
+}
+
+func NewReadOnlyMode(enabled bool, logger telemetry.Logger) *ReadOnlyMode {
+	m := &ReadOnlyMode{logger: logger}
+	m.Set(enabled)
+	return m
+}
+
+func (m *ReadOnlyMode) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+func (m *ReadOnlyMode) Set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.enabled, v)
+}
+
+// Middleware must be used on the /v2 routes, the requests which only read, like the batch blob existence check,
+// pass through
+func (m *ReadOnlyMode) Middleware() echo.MiddlewareFunc {
+	return func(hf echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if !m.Enabled() || !isWrite(ctx.Request()) {
+				return hf(ctx)
+			}
+
+			return ctx.JSON(http.StatusMethodNotAllowed, registry.RegistryErrors{
+				Errors: []registry.RegistryError{{
+					Code:    registry.RegistryErrorCodeUnsupported,
+					Message: "the registry is in read-only mode for maintenance, pulls still work",
+				}},
+			})
+		}
+	}
+}
+
+// Status - GET /admin/read-only
+func (m *ReadOnlyMode) Status(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"enabled": m.Enabled(),
+	})
+	m.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// Update - PUT /admin/read-only with {"enabled": true|false}
+func (m *ReadOnlyMode) Update(ctx echo.Context) error {
+	ctx.Set(types.HandlerStartTime, time.Now())
+
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&body); err != nil || body.Enabled == nil {
+		if err == nil {
+			err = fmt.Errorf("enabled is required")
+		}
+		echoErr := ctx.JSON(http.StatusBadRequest, echo.Map{
+			"error":   err.Error(),
+			"message": "request body must be {\"enabled\": true|false}",
+		})
+		m.logger.Log(ctx, err)
+		return echoErr
+	}
+	_ = ctx.Request().Body.Close()
+
+	m.Set(*body.Enabled)
+
+	echoErr := ctx.JSON(http.StatusOK, echo.Map{
+		"enabled": m.Enabled(),
+	})
+	m.logger.Log(ctx, nil)
+	return echoErr
+}
+
+// Readiness - GET /ready
+func (m *ReadOnlyMode) Readiness(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, echo.Map{
+		"status":    "ready",
+		"read_only": m.Enabled(),
+	})
+}
+
+func isWrite(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	case http.MethodPost:
+		return !strings.HasSuffix(req.URL.Path, BlobsExist)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Log(echo.Context, error) {}
+
+func newReadOnlyServer(m *ReadOnlyMode) *echo.Echo {
+	e := echo.New()
+	v2Router := e.Group(V2+Namespace, m.Middleware())
+	ok := func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}
+	v2Router.GET(ManifestsReference, ok)
+	v2Router.HEAD(BlobsDigest, ok)
+	v2Router.PUT(ManifestsReference, ok)
+	v2Router.POST(BlobsUploads, ok)
+	v2Router.POST(BlobsExist, ok)
+	v2Router.DELETE(ManifestsReference, ok)
+
+	adminRouter := e.Group(Admin)
+	adminRouter.PUT(ReadOnly, m.Update)
+	return e
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	m := NewReadOnlyMode(false, nopLogger{})
+	e := newReadOnlyServer(m)
+
+	requests := []struct {
+		method string
+		path   string
+		write  bool
+	}{
+		{method: http.MethodGet, path: "/v2/johndoe/alpine/manifests/latest"},
+		{method: http.MethodHead, path: "/v2/johndoe/alpine/blobs/sha256:abc"},
+		{method: http.MethodPost, path: "/v2/johndoe/alpine/blobs/exists"},
+		{method: http.MethodPut, path: "/v2/johndoe/alpine/manifests/latest", write: true},
+		{method: http.MethodPost, path: "/v2/johndoe/alpine/blobs/uploads/", write: true},
+		{method: http.MethodDelete, path: "/v2/johndoe/alpine/manifests/latest", write: true},
+	}
+	serve := func(enabled bool) {
+		for _, req := range requests {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(req.method, req.path, nil))
+			want := http.StatusOK
+			if enabled && req.write {
+				want = http.StatusMethodNotAllowed
+			}
+			if rec.Code != want {
+				t.Errorf("read-only %t, %s %s: got status %d, want %d", enabled, req.method, req.path, rec.Code, want)
+			}
+			if want == http.StatusMethodNotAllowed && !strings.Contains(rec.Body.String(), "UNSUPPORTED") {
+				t.Errorf("%s %s: got body %s, want the UNSUPPORTED error", req.method, req.path, rec.Body)
+			}
+		}
+	}
+
+	serve(false)
+
+	// the admins enable it at runtime
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, Admin+ReadOnly, strings.NewReader(`{"enabled": true}`)))
+	if rec.Code != http.StatusOK || !m.Enabled() {
+		t.Fatalf("got status %d and enabled %t, want the read-only mode enabled", rec.Code, m.Enabled())
+	}
+	serve(true)
+
+	m.Set(false)
+	serve(false)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, Admin+ReadOnly, strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest || m.Enabled() {
+		t.Errorf("got status %d and enabled %t without enabled in the body, want %d", rec.Code, m.Enabled(),
+			http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RealIP returns the IP extractor behind ctx.RealIP, which the rate limiter, the logs and the audit log use.
+// X-Forwarded-For and X-Real-IP are only read when the connection comes from one of the trusted proxies, otherwise
+// any client could set them. X-Forwarded-For is read from the right, skipping the trusted proxies, so that the
+// addresses the client prepended are ignored. Invalid entries in trustedProxies are skipped, the config validation
+// rejects them
+func RealIP(trustedProxies []string) echo.IPExtractor {
+	var trusted []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if ipNet := parseCIDR(proxy); ipNet != nil {
+			trusted = append(trusted, ipNet)
+		}
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(req *http.Request) string {
+		directIP, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			directIP = req.RemoteAddr
+		}
+		if ip := net.ParseIP(directIP); ip == nil || !isTrusted(ip) {
+			return directIP
+		}
+
+		if xff := req.Header.Values(echo.HeaderXForwardedFor); len(xff) > 0 {
+			hops := strings.Split(strings.Join(xff, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				if !isTrusted(ip) || i == 0 {
+					return ip.String()
+				}
+			}
+			return directIP
+		}
+
+		if ip := net.ParseIP(strings.TrimSpace(req.Header.Get(echo.HeaderXRealIP))); ip != nil {
+			return ip.String()
+		}
+
+		return directIP
+	}
+}
+
+// parseCIDR also accepts a single IP, as a /32 or /128
+func parseCIDR(s string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(s); err == nil {
+		return ipNet
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	bits := net.IPv6len * 8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, net.IPv4len*8
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRealIP(t *testing.T) {
+	extract := RealIP([]string{"10.0.0.0/8", "192.168.1.1", "invalid"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		xRealIP    string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4242", want: "203.0.113.7"},
+		{
+			name:       "spoofed X-Forwarded-For from an untrusted client",
+			remoteAddr: "203.0.113.7:4242",
+			xff:        []string{"198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed X-Real-IP from an untrusted client",
+			remoteAddr: "203.0.113.7:4242",
+			xRealIP:    "198.51.100.1",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For from a trusted proxy",
+			remoteAddr: "10.1.2.3:4242",
+			xff:        []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "address prepended by the client",
+			remoteAddr: "10.1.2.3:4242",
+			xff:        []string{"198.51.100.1, 203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:4242",
+			xff:        []string{"198.51.100.1, 203.0.113.7", "192.168.1.1, 10.9.9.9"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Real-IP from a trusted proxy",
+			remoteAddr: "192.168.1.1:4242",
+			xRealIP:    "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "invalid X-Forwarded-For from a trusted proxy",
+			remoteAddr: "10.1.2.3:4242",
+			xff:        []string{"not-an-ip"},
+			want:       "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v2/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, xff := range tt.xff {
+			req.Header.Add(echo.HeaderXForwardedFor, xff)
+		}
+		if tt.xRealIP != "" {
+			req.Header.Set(echo.HeaderXRealIP, tt.xRealIP)
+		}
+
+		if got := extract(req); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRealIPOfRequests checks that ctx.RealIP, which the rate limiter and the logs use, goes through the extractor
+func TestRealIPOfRequests(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = RealIP(nil)
+	e.GET("/", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, ctx.RealIP())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4242"
+	req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Body.String() != "203.0.113.7" {
+		t.Errorf("got %s, want the IP of the connection", rec.Body)
+	}
+}
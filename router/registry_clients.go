@@ -0,0 +1,52 @@
+package router
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// defaultRegistryClientUserAgents are the User-Agent prefixes of the docker, containerd and OCI clients
+var defaultRegistryClientUserAgents = []string{ //nolint
+	"docker/",
+	"containerd/",
+	"buildkit/",
+	"go-containerregistry/",
+	"podman/",
+	"cri-o/",
+	"skopeo/",
+	"oras/",
+	"crane/",
+	"helm/",
+}
+
+// RegistryClientSkipper skips the browser-oriented middlewares (e.g. CORS) for the requests registry clients send to
+// the /v2 routes. The clients don't send the headers browsers do, so they'd be rejected. The User-Agent is matched
+// case-insensitively against the prefixes in userAgents, the default clients are matched without them
+func RegistryClientSkipper(userAgents []string) middleware.Skipper {
+	if len(userAgents) == 0 {
+		userAgents = defaultRegistryClientUserAgents
+	}
+
+	prefixes := make([]string, 0, len(userAgents))
+	for _, ua := range userAgents {
+		prefixes = append(prefixes, strings.ToLower(ua))
+	}
+
+	return func(ctx echo.Context) bool {
+		path := ctx.Request().URL.Path
+		if path != V2 && !strings.HasPrefix(path, V2+"/") {
+			return false
+		}
+
+		userAgent := strings.ToLower(ctx.Request().UserAgent())
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(userAgent, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
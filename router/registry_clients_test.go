@@ -0,0 +1,117 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	testWebApp           = "https://app.openregistry.test"
+	testBrowserUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0"
+)
+
+func newCORSServer(userAgents []string) *echo.Echo {
+	e := echo.New()
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		Skipper:          RegistryClientSkipper(userAgents),
+		AllowOrigins:     []string{testWebApp},
+		AllowCredentials: true,
+	}))
+	ok := func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}
+	e.GET(V2+"/", ok)
+	e.GET(V2+Namespace+ManifestsReference, ok)
+	e.GET(Auth+"/signin", ok)
+	return e
+}
+
+func TestRegistryClientSkipsCORS(t *testing.T) {
+	tests := []struct {
+		name       string
+		userAgents []string
+		userAgent  string
+		path       string
+		preflight  bool
+		wantCORS   bool
+	}{
+		{
+			name:      "docker preflight",
+			userAgent: "docker/20.10.21 go/go1.18.7 git-commit/3056208 kernel/5.15.0 os/linux arch/amd64",
+			path:      "/v2/",
+			preflight: true,
+		},
+		{
+			name:      "docker pull",
+			userAgent: "docker/20.10.21 go/go1.18.7",
+			path:      "/v2/johndoe/alpine/manifests/latest",
+		},
+		{name: "containerd pull", userAgent: "containerd/1.6.10", path: "/v2/johndoe/alpine/manifests/latest"},
+		{
+			name:      "browser preflight",
+			userAgent: testBrowserUserAgent,
+			path:      "/v2/",
+			preflight: true,
+			wantCORS:  true,
+		},
+		{
+			name:      "browser pull",
+			userAgent: testBrowserUserAgent,
+			path:      "/v2/johndoe/alpine/manifests/latest",
+			wantCORS:  true,
+		},
+		{
+			// the web API keeps its protections whoever calls it
+			name:      "docker on the web API",
+			userAgent: "docker/20.10.21",
+			path:      Auth + "/signin",
+			preflight: true,
+			wantCORS:  true,
+		},
+		{
+			name:       "configured client",
+			userAgents: []string{"My-Client/"},
+			userAgent:  "my-client/1.0",
+			path:       "/v2/",
+			preflight:  true,
+		},
+		{
+			name:       "default client not configured",
+			userAgents: []string{"my-client/"},
+			userAgent:  "docker/20.10.21",
+			path:       "/v2/",
+			preflight:  true,
+			wantCORS:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newCORSServer(tt.userAgents)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.preflight {
+				req.Method = http.MethodOptions
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodGet)
+			}
+			req.Header.Set(echo.HeaderOrigin, testWebApp)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			allowOrigin := rec.Header().Get(echo.HeaderAccessControlAllowOrigin)
+			if gotCORS := allowOrigin != ""; gotCORS != tt.wantCORS {
+				t.Errorf("got Access-Control-Allow-Origin %q, want CORS handled: %t", allowOrigin, tt.wantCORS)
+			}
+			// the router answers the OPTIONS requests the CORS middleware skips, without the CORS headers
+			allowMethods := rec.Header().Get(echo.HeaderAccessControlAllowMethods)
+			if tt.preflight && tt.wantCORS != (allowMethods != "") {
+				t.Errorf("got Access-Control-Allow-Methods %q, want the preflight handled by CORS: %t",
+					allowMethods, tt.wantCORS)
+			}
+		})
+	}
+}
@@ -10,10 +10,59 @@ const (
 	// Internal endpoint refers to the internal APIs not supposed to be exposed
 	Internal = "/internal"
 
+	// CapturedEmails endpoint lists the emails kept in the capture email mode to admins, it's only registered in
+	// that mode
+	CapturedEmails = "/emails"
+
 	// Auth endpoint Authenticates user through basic auth or any supported
 	// authentication mechanisms
 	Auth = "/auth"
 
+	// Admin endpoint groups the APIs only available to the registry admins
+	Admin = "/admin"
+
+	// AuditLog endpoint lists the push, pull, delete and login events
+	AuditLog = "/audit"
+
+	// RetentionPolicy endpoint reads, sets and deletes the retention policy of a repository
+	RetentionPolicy = "/retention/:username/:imagename"
+
+	// RetentionApply endpoints apply the retention policy of a repository, or of all the repositories
+	RetentionApply    = RetentionPolicy + "/apply"
+	RetentionApplyAll = "/retention/apply"
+
+	// ReadOnly endpoint reads and toggles the read-only (maintenance) mode
+	ReadOnly = "/read-only"
+
+	// Readiness endpoint reports whether the registry is ready to serve, and if it's read-only
+	Readiness = "/ready"
+
+	// Users endpoint lists the users, User deletes one and the others (de)activate them
+	Users          = "/users"
+	User           = Users + "/:username"
+	UserDeactivate = User + "/deactivate"
+	UserReactivate = User + "/reactivate"
+
+	// Organizations endpoint creates organizations, their members are managed with the OrganizationMembers endpoints
+	Organizations       = "/orgs"
+	OrganizationMembers = "/:org/members"
+	OrganizationMember  = OrganizationMembers + "/:username"
+
+	// APIV1 groups the JSON APIs meant for browsing the registry, they don't follow the distribution spec
+	APIV1 = "/api/v1"
+
+	// Repositories endpoint lists the public repositories, PublicRepository shows one of them with its tags
+	Repositories     = "/repositories"
+	PublicRepository = Repositories + Namespace
+
+	// UserRepositories endpoint lists the repositories of a user, the private ones are only listed for the user
+	UserRepositories = User + Repositories
+
+	// Debug endpoint serves the pprof profiles (Profiling) and the runtime metrics (Vars) when profiling is enabled
+	Debug     = "/debug"
+	Profiling = "/pprof"
+	Vars      = "/vars"
+
 	//Beta endpoint refers to the experimental code and features under observation
 	// not to be released or exposed to public
 	Beta = "/beta"
@@ -26,10 +75,54 @@ const (
 	//used by methods: LayerExists, PullLayer, DeleteLayer
 	BlobsDigest = "/blobs/:digest"
 
+	//BlobsDownloadURL endpoint returns a short-lived URL the blob can be downloaded from directly
+	//used by method: BlobDownloadURL
+	BlobsDownloadURL = BlobsDigest + "/download-url"
+
 	//ManifestsReference endpoint is a reference to the json document which defines an artifact
 	//used by methods: ManifestExists, PushManifest, PullManifest, DeleteTagOrManifest
 	ManifestsReference = "/manifests/:reference"
 
+	//ManifestsVerify endpoint checks that every blob of an image exists and optionally hashes them again
+	//used by method: VerifyManifest
+	ManifestsVerify = ManifestsReference + "/verify"
+
+	//ManifestsTree endpoint returns the descriptors of a manifest and, recursively, of the manifests of an index
+	//used by method: ManifestTree
+	ManifestsTree = ManifestsReference + "/tree"
+
+	//ImageConfig endpoint returns the parsed config (labels, env, platform, etc) of the image referenced by a manifest
+	//used by method: GetImageConfig
+	ImageConfig = "/config/:reference"
+
+	//Quota endpoint reports the storage used by a repository and its owner, along with their limits
+	//used by method: GetQuota
+	Quota = "/quota"
+
+	//Visibility endpoint makes a repository public or private, private repositories can only be pulled by their owner
+	//used by method: UpdateRepositoryVisibility
+	Visibility = "/visibility"
+
+	//Stats endpoint reports the pull and push counts of a repository, along with the size of its layers
+	//used by method: GetRepositoryStats
+	Stats = "/stats"
+
+	//Repository endpoint returns a repository with its tags, manifests, configs and layers
+	//used by method: GetRepository
+	Repository = "/repository"
+
+	//Builds endpoint lists the builds of a repository and queues new ones
+	//used by methods: ListBuilds, CreateBuild
+	Builds = "/builds"
+
+	//Build endpoint reports the status of a build, the builder updates it as the build progresses
+	//used by methods: GetBuild, UpdateBuild
+	Build = Builds + "/:id"
+
+	//BlobsExist endpoint checks which of the digests in the request body the registry already has
+	//used by method: BlobsExist
+	BlobsExist = "/blobs/exists"
+
 	//BlobsUploads endpoint is used to start and complete blob uploads to the registry
 	//by the methods : StartUpload and CompleteUpload
 	BlobsUploads = "/blobs/uploads/"
@@ -45,6 +138,14 @@ const (
 	// this is also a part of catalog api
 	TagsList = "/tags/list"
 
+	//TagsDetail endpoint lists the tags along with their digest and push times
+	//used by method: ListTagsDetail
+	TagsDetail = "/tags/detail"
+
+	//Tags endpoint deletes the tags matching a pattern, or all but the most recently pushed ones
+	//used by method: DeleteTags
+	Tags = "/tags"
+
 	// Catalog is used to list the available repositories
 	Catalog = "/_catalog"
 
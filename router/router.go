@@ -5,10 +5,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/containerish/OpenRegistry/audit"
 	"github.com/containerish/OpenRegistry/auth"
 	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/ratelimiter"
 	"github.com/containerish/OpenRegistry/registry/v2"
+	"github.com/containerish/OpenRegistry/registry/v2/builds"
 	"github.com/containerish/OpenRegistry/registry/v2/extensions"
+	"github.com/containerish/OpenRegistry/registry/v2/retention"
+	"github.com/containerish/OpenRegistry/telemetry/tracing"
+	"github.com/containerish/OpenRegistry/types"
 	"github.com/google/uuid"
 	"github.com/labstack/echo-contrib/prometheus"
 	"github.com/labstack/echo/v4"
@@ -23,9 +29,17 @@ func Register(
 	reg registry.Registry,
 	authSvc auth.Authentication,
 	ext extensions.Extenion,
+	auditLogger audit.Logger,
+	retentionEvaluator retention.Evaluator,
+	buildTracker builds.Tracker,
+	readOnly *ReadOnlyMode,
 ) {
+	e.IPExtractor = RealIP(cfg.Registry.TrustedProxies)
+	e.Pre(ApiVersionHeader())
+	e.Pre(NestedNamespaces(cfg.Registry.MaxNamespaceDepth))
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		Skipper:          RegistryClientSkipper(cfg.Registry.RegistryClientUserAgents),
 		AllowOrigins:     strings.Split(cfg.WebAppEndpoint, ","),
 		AllowMethods:     middleware.DefaultCORSConfig.AllowMethods,
 		AllowHeaders:     middleware.DefaultCORSConfig.AllowHeaders,
@@ -44,27 +58,57 @@ func Register(
 		},
 	}))
 
+	if tracing.Enabled() {
+		e.Use(tracing.Middleware())
+	}
+	e.Use(BodyLimit(cfg.Registry.MaxBodySize))
+
 	e.HideBanner = true
 
 	p := prometheus.NewPrometheus("OpenRegistry", nil)
 	p.Use(e)
 
-	v2Router := e.Group(V2, authSvc.BasicAuth(), authSvc.JWT())
-	nsRouter := v2Router.Group(Namespace, authSvc.ACL())
+	v2Router := e.Group(
+		V2,
+		ConcurrencyLimiter(cfg.Registry.MaxConcurrentRequests),
+		readOnly.Middleware(),
+		ratelimiter.Unauthorized(cfg.Registry.RateLimit),
+		authSvc.BasicAuth(),
+		authSvc.JWT(),
+		ratelimiter.New(cfg.Registry.RateLimit, auth.UserID),
+	)
+	nsRouter := v2Router.Group(Namespace, reg.ValidateRepositoryName(), authSvc.ACL())
 
 	authRouter := e.Group(Auth)
+	adminRouter := e.Group(Admin, authSvc.JWTRest(), authSvc.RequireRole(types.RoleAdmin))
+	orgRouter := e.Group(Organizations, authSvc.JWTRest())
+	apiRouter := e.Group(APIV1)
 	githubRouter := authRouter.Group("/github")
 
 	v2Router.Add(http.MethodGet, Root, reg.ApiVersion)
 
 	e.Add(http.MethodGet, TokenAuth, authSvc.Token)
+	e.Add(http.MethodGet, Readiness, readOnly.Readiness)
 
 	githubRouter.Add(http.MethodGet, "/callback", authSvc.GithubLoginCallbackHandler)
 	githubRouter.Add(http.MethodGet, "/login", authSvc.LoginWithGithub)
+	githubRouter.Add(http.MethodGet, "/link", authSvc.LinkGithub, authSvc.JWT())
+	githubRouter.Add(http.MethodDelete, "/link", authSvc.UnlinkGithub, authSvc.JWT())
 
-	RegisterNSRoutes(nsRouter, reg)
+	RegisterNSRoutes(nsRouter, reg, DownloadLimiter(cfg.Registry, auth.UserID))
+	RegisterBuildRoutes(nsRouter, buildTracker)
 	RegisterAuthRoutes(authRouter, authSvc)
+	RegisterOrganizationRoutes(orgRouter, authSvc)
+	RegisterAdminRoutes(adminRouter, authSvc, auditLogger, retentionEvaluator)
+	adminRouter.Add(http.MethodGet, ReadOnly, readOnly.Status)
+	adminRouter.Add(http.MethodPut, ReadOnly, readOnly.Update)
 	Extensions(v2Router, reg, ext, authSvc.JWT())
+	RegisterPublicRoutes(apiRouter, ext, authSvc.JWTOptional())
+	if cfg.Email.Mode == config.EmailModeCapture {
+		internalRouter := e.Group(Internal, authSvc.JWTRest(), authSvc.RequireRole(types.RoleAdmin))
+		internalRouter.Add(http.MethodGet, CapturedEmails, authSvc.CapturedEmails)
+	}
+	RegisterProfilingRoutes(e, cfg.Registry.EnableProfiling, authSvc.JWTRest(), authSvc.RequireRole(types.RoleAdmin))
 
 	//catch-all will redirect user back to web interface
 	e.Add(http.MethodGet, "/", func(ctx echo.Context) error {
@@ -73,8 +117,8 @@ func Register(
 }
 
 // RegisterNSRoutes is one of the helper functions to Register
-// it works directly with registry endpoints
-func RegisterNSRoutes(nsRouter *echo.Group, reg registry.Registry) {
+// it works directly with registry endpoints, the blob downloads go through downloadLimiter
+func RegisterNSRoutes(nsRouter *echo.Group, reg registry.Registry, downloadLimiter echo.MiddlewareFunc) {
 
 	// ALL THE HEAD METHODS //
 	// HEAD /v2/<name>/blobs/<digest>
@@ -97,6 +141,9 @@ func RegisterNSRoutes(nsRouter *echo.Group, reg registry.Registry) {
 
 	// POST METHODS
 
+	// POST /v2/<name>/blobs/exists
+	nsRouter.Add(http.MethodPost, BlobsExist, reg.BlobsExist)
+
 	// POST /v2/<name>/blobs/uploads/
 	nsRouter.Add(http.MethodPost, BlobsUploads, reg.StartUpload)
 
@@ -114,8 +161,29 @@ func RegisterNSRoutes(nsRouter *echo.Group, reg registry.Registry) {
 	// GET /v2/<name>/manifests/<reference>
 	nsRouter.Add(http.MethodGet, ManifestsReference, reg.PullManifest)
 
+	// GET /v2/<name>/manifests/<reference>/verify
+	nsRouter.Add(http.MethodGet, ManifestsVerify, reg.VerifyManifest)
+	nsRouter.Add(http.MethodGet, ManifestsTree, reg.ManifestTree)
+
+	// GET /v2/<name>/config/<reference>
+	nsRouter.Add(http.MethodGet, ImageConfig, reg.GetImageConfig)
+
+	// GET /v2/<name>/quota
+	nsRouter.Add(http.MethodGet, Quota, reg.GetQuota)
+
+	// PUT /v2/<name>/visibility
+	nsRouter.Add(http.MethodPut, Visibility, reg.UpdateRepositoryVisibility)
+
+	// GET /v2/<name>/stats
+	nsRouter.Add(http.MethodGet, Stats, reg.GetRepositoryStats)
+
+	// GET /v2/<name>/repository
+	nsRouter.Add(http.MethodGet, Repository, reg.GetRepository)
+
 	// GET /v2/<name>/blobs/<digest>
-	nsRouter.Add(http.MethodGet, BlobsDigest, reg.PullLayer)
+	nsRouter.Add(http.MethodGet, BlobsDigest, reg.PullLayer, downloadLimiter)
+	// GET /v2/<name>/blobs/<digest>/download-url
+	nsRouter.Add(http.MethodGet, BlobsDownloadURL, reg.BlobDownloadURL)
 
 	// GET /v2/<name>/blobs/uploads/<uuid>
 	nsRouter.Add(http.MethodGet, BlobsUploadsUUID, reg.UploadProgress)
@@ -124,10 +192,31 @@ func RegisterNSRoutes(nsRouter *echo.Group, reg registry.Registry) {
 
 	///GET /v2/<name>/tags/list
 	nsRouter.Add(http.MethodGet, TagsList, reg.ListTags)
+	nsRouter.Add(http.MethodHead, TagsList, reg.ListTags)
+	// GET /v2/<name>/tags/detail
+	nsRouter.Add(http.MethodGet, TagsDetail, reg.ListTagsDetail)
 
 	/// mf/sha -> mf/latest
 	nsRouter.Add(http.MethodDelete, BlobsDigest, reg.DeleteLayer)
+	// DELETE /v2/<name>/blobs/uploads/<uuid>
+	nsRouter.Add(http.MethodDelete, BlobsUploadsUUID, reg.CancelUpload)
 	nsRouter.Add(http.MethodDelete, ManifestsReference, reg.DeleteTagOrManifest)
+
+	// DELETE /v2/<name>/tags?match=<pattern>&keep_last=<n>
+	nsRouter.Add(http.MethodDelete, Tags, reg.DeleteTags)
+}
+
+// RegisterBuildRoutes registers the build status endpoints of a repository, the builds are reported by the
+// builder with push access, and read with pull access
+func RegisterBuildRoutes(nsRouter *echo.Group, buildTracker builds.Tracker) {
+	// GET /v2/<name>/builds
+	nsRouter.Add(http.MethodGet, Builds, buildTracker.ListBuilds)
+	// POST /v2/<name>/builds
+	nsRouter.Add(http.MethodPost, Builds, buildTracker.CreateBuild)
+	// GET /v2/<name>/builds/<id>
+	nsRouter.Add(http.MethodGet, Build, buildTracker.GetBuild)
+	// PATCH /v2/<name>/builds/<id>
+	nsRouter.Add(http.MethodPatch, Build, buildTracker.UpdateBuild)
 }
 
 // Extensions for teh OCI dist spec
@@ -135,6 +224,7 @@ func Extensions(group *echo.Group, reg registry.Registry, ext extensions.Extenio
 
 	// GET /v2/_catalog
 	group.Add(http.MethodGet, Catalog, reg.Catalog)
+	group.Add(http.MethodHead, Catalog, reg.Catalog)
 	// Auto-complete image search
 	group.Add(http.MethodGet, Search, reg.GetImageNamespace)
 	group.Add(http.MethodGet, CatalogDetail, ext.CatalogDetail, middlewares...)
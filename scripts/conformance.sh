@@ -0,0 +1,43 @@
+#!/bin/bash
+# Runs the OCI distribution-spec conformance suite against a running OpenRegistry server.
+# The settings come from conformance.vars, any of them can be overridden from the environment, e.g:
+#   OCI_ROOT_URL=http://127.0.0.1:5000 OCI_TEST_PUSH=0 ./scripts/conformance.sh
+# CONFORMANCE_BIN can point to a prebuilt conformance binary, otherwise it's built from the given version.
+
+set -euo pipefail
+
+ROOT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+DIST_SPEC_VERSION="${DIST_SPEC_VERSION:-v1.0.1}"
+OUT_DIR="${OUT_DIR:-${ROOT_DIR}/.out}"
+
+while IFS='=' read -r key value; do
+	[[ -z "${key}" || "${key}" == \#* ]] && continue
+	# values set in the environment take precedence over conformance.vars
+	if [[ -z "${!key:-}" ]]; then
+		export "${key}=${value}"
+	fi
+done < "${ROOT_DIR}/conformance.vars"
+
+export OCI_HIDE_SKIPPED_WORKFLOWS="${OCI_HIDE_SKIPPED_WORKFLOWS:-1}"
+export OCI_DELETE_MANIFEST_BEFORE_BLOBS="${OCI_DELETE_MANIFEST_BEFORE_BLOBS:-0}"
+export OCI_DEBUG="${OCI_DEBUG:-0}"
+
+if [[ -z "${CONFORMANCE_BIN:-}" ]]; then
+	BUILD_DIR="$(mktemp -d)"
+	trap 'rm -rf "${BUILD_DIR}"' EXIT
+	git clone --quiet --depth 1 --branch "${DIST_SPEC_VERSION}" \
+		https://github.com/opencontainers/distribution-spec.git "${BUILD_DIR}/distribution-spec"
+	(cd "${BUILD_DIR}/distribution-spec/conformance" && go test -c -o "${BUILD_DIR}/conformance.test")
+	CONFORMANCE_BIN="${BUILD_DIR}/conformance.test"
+fi
+
+if ! curl -sSf -o /dev/null "${OCI_ROOT_URL}/v2/" -u "${OCI_USERNAME}:${OCI_PASSWORD}"; then
+	# the test user is created on the first run, signup fails harmlessly when the user already exists
+	curl -sS -o /dev/null -X POST "${OCI_ROOT_URL}/auth/signup" \
+		-d "{\"username\":\"${OCI_USERNAME}\",\"email\":\"${OCI_USERNAME}@openregistry.dev\",\"password\":\"${OCI_PASSWORD}\"}"
+fi
+
+mkdir -p "${OUT_DIR}"
+cd "${OUT_DIR}"
+# the suite writes report.html and junit.xml to the working directory
+"${CONFORMANCE_BIN}"
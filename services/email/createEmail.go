@@ -4,45 +4,29 @@ import (
 	"fmt"
 
 	"github.com/containerish/OpenRegistry/types"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
-func (e *email) CreateEmail(u *types.User, kind EmailKind, token string) (*mail.SGMailV3, error) {
-	mailReq := &Mail{}
-	m := mail.NewV3Mail()
-
-	mailReq.To = append(mailReq.To, u.Email)
-	mailReq.Data.Username = u.Username
+func (e *email) CreateEmail(u *types.User, kind EmailKind, token string) (*Message, error) {
+	msg := &Message{
+		From: Address{Name: "Team OpenRegistry", Email: e.config.SendAs},
+		To:   []Address{{Name: u.Username, Email: u.Email}},
+		Kind: kind,
+		Data: MailData{Username: u.Username},
+	}
 
-	mailReq.Name = "Team OpenRegistry"
 	switch kind {
 	case VerifyEmailKind:
-		m.SetTemplateID(e.config.VerifyEmailTemplateId)
-		mailReq.Subject = "Verify Email"
-		mailReq.Data.Link = fmt.Sprintf("%s/auth/verify?token=%s", e.baseURL, token)
+		msg.Subject = "Verify Email"
+		msg.Data.Link = fmt.Sprintf("%s/auth/verify?token=%s", e.baseURL, token)
 
 	case ResetPasswordEmailKind:
-		m.SetTemplateID(e.config.ForgotPasswordTemplateId)
-		mailReq.Subject = "Forgot Password"
-		mailReq.Data.Link = fmt.Sprintf("%s/auth/forgot-password?token=%s", e.baseURL, token)
+		msg.Subject = "Forgot Password"
+		msg.Data.Link = fmt.Sprintf("%s/auth/forgot-password?token=%s", e.baseURL, token)
 
 	default:
 		return nil, fmt.Errorf("incorrect email kind")
 	}
 
-	email := mail.NewEmail(mailReq.Name, e.config.SendAs)
-	m.SetFrom(email)
-	p := mail.NewPersonalization()
-
-	tos := []*mail.Email{
-		mail.NewEmail(u.Username, mailReq.To[0]),
-	}
-
-	p.AddTos(tos...)
-
-	p.SetDynamicTemplateData("user", mailReq.Data.Username)
-	p.SetDynamicTemplateData("link", mailReq.Data.Link)
-
-	m.AddPersonalizations(p)
-	return m, nil
+	msg.TemplateID = e.templateID(kind)
+	return msg, nil
 }
@@ -1,23 +1,31 @@
 package email
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/containerish/OpenRegistry/config"
 	"github.com/containerish/OpenRegistry/types"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+const (
+	ProviderSendGrid = "sendgrid"
+	ProviderSMTP     = "smtp"
+	ProviderSES      = "ses"
 )
 
 type email struct {
-	client  *sendgrid.Client
-	config  *config.Email
-	baseURL string
+	sender   EmailSender
+	renderer TemplateRenderer
+	config   *config.Email
+	baseURL  string
 }
 
 type MailType int
 
 type MailData struct {
-	Username string
-	Link     string
+	Username string `json:"username,omitempty"`
+	Link     string `json:"link"`
 }
 
 type Mail struct {
@@ -30,12 +38,105 @@ type Mail struct {
 }
 
 type MailService interface {
-	CreateEmail(u *types.User, kind EmailKind, token string) (*mail.SGMailV3, error)
+	CreateEmail(u *types.User, kind EmailKind, token string) (*Message, error)
 	SendEmail(u *types.User, token string, kind EmailKind) error
 	WelcomeEmail(list []string) error
+	// CapturedEmails returns the emails kept in the capture mode, false in the other modes
+	CapturedEmails(to string) ([]*Message, bool)
+}
+
+// New returns the MailService sending the emails with the provider set in the config, or logging or capturing them
+// depending on the mode
+func New(cfg *config.Email, baseURL string) (MailService, error) {
+	var sender EmailSender
+	switch cfg.Mode {
+	case config.EmailModeLog:
+		sender = NewLogSender()
+	case config.EmailModeCapture:
+		sender = NewCaptureSender(cfg.CaptureSize)
+	default:
+		var err error
+		if sender, err = newSender(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	renderer, err := NewRenderer(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithSender(cfg, baseURL, sender, renderer), nil
 }
 
-func New(config *config.Email, baseURL string) MailService {
-	client := sendgrid.NewSendClient(config.ApiKey)
-	return &email{client: client, config: config, baseURL: baseURL}
+// NewWithSender lets the sender and the renderer of the emails without template ids be replaced
+func NewWithSender(config *config.Email, baseURL string, sender EmailSender, renderer TemplateRenderer) MailService {
+	return &email{sender: sender, renderer: renderer, config: config, baseURL: baseURL}
+}
+
+func newSender(config *config.Email) (EmailSender, error) {
+	switch config.Provider {
+	case "", ProviderSendGrid:
+		return NewSendGridSender(config.ApiKey), nil
+	case ProviderSMTP:
+		if config.SMTP == nil {
+			return nil, fmt.Errorf("ERR_EMAIL_CONFIG: smtp provider needs the smtp config")
+		}
+		return NewSMTPSender(config.SMTP), nil
+	case ProviderSES:
+		if config.SES == nil {
+			return nil, fmt.Errorf("ERR_EMAIL_CONFIG: ses provider needs the ses config")
+		}
+		return NewSESSender(config.SES)
+	default:
+		return nil, fmt.Errorf("ERR_EMAIL_CONFIG: unknown email provider: %s", config.Provider)
+	}
+}
+
+// templateID returns the template id of the kind, only SendGrid has template ids. The emails without one are
+// rendered from the local templates, as are the emails which are logged or captured
+func (e *email) templateID(kind EmailKind) string {
+	if e.config.Provider != "" && e.config.Provider != ProviderSendGrid {
+		return ""
+	}
+	if e.config.Mode == config.EmailModeLog || e.config.Mode == config.EmailModeCapture {
+		return ""
+	}
+
+	switch kind {
+	case WelcomeEmailKind:
+		return e.config.WelcomeEmailTemplateId
+	case VerifyEmailKind:
+		return e.config.VerifyEmailTemplateId
+	case ResetPasswordEmailKind:
+		return e.config.ForgotPasswordTemplateId
+	default:
+		return ""
+	}
+}
+
+// send renders the messages which don't have a template id before handing them to the sender
+func (e *email) send(ctx context.Context, msg *Message) error {
+	if msg.TemplateID == "" {
+		html, err := e.renderer.Render(msg.Kind, msg.Data)
+		if err != nil {
+			return fmt.Errorf("ERR_RENDER_EMAIL: %w", err)
+		}
+		msg.HTML = html
+	}
+
+	if err := e.sender.Send(ctx, msg); err != nil {
+		return fmt.Errorf("ERR_SEND_EMAIL: %w", err)
+	}
+
+	return nil
+}
+
+func (e *email) CapturedEmails(to string) ([]*Message, bool) {
+	capture, ok := e.sender.(*CaptureSender)
+	if !ok {
+		return nil, false
+	}
+
+	return capture.Messages(to), true
 }
@@ -0,0 +1,306 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type (
+	// fakeSender keeps the messages it's handed
+	fakeSender struct {
+		messages []*Message
+	}
+
+	// senderFunc is a sender which fails or succeeds as the test needs
+	senderFunc func(*Message) error
+
+	// fakeRenderer renders the kind and the data, so that the tests can tell which template was used
+	fakeRenderer struct{}
+)
+
+func (s *fakeSender) Send(_ context.Context, msg *Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (fakeRenderer) Render(kind EmailKind, data MailData) (string, error) {
+	return templateFiles[kind] + ":" + data.Username + ":" + data.Link, nil
+}
+
+func TestNewSelectsProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *config.Email
+		want    EmailSender
+		wantErr bool
+	}{
+		{name: "default", config: &config.Email{ApiKey: "key"}, want: &sendGridSender{}},
+		{name: "sendgrid", config: &config.Email{Provider: ProviderSendGrid, ApiKey: "key"}, want: &sendGridSender{}},
+		{
+			name:   "smtp",
+			config: &config.Email{Provider: ProviderSMTP, SMTP: &config.SMTP{Host: "smtp.test", Port: 587}},
+			want:   &smtpSender{},
+		},
+		{
+			name: "ses",
+			config: &config.Email{
+				Provider: ProviderSES,
+				SES:      &config.SES{Region: "us-east-1", AccessKey: "access-key", SecretKey: "secret-key"},
+			},
+			want: &sesSender{},
+		},
+		{name: "smtp without its config", config: &config.Email{Provider: ProviderSMTP}, wantErr: true},
+		{name: "ses without its config", config: &config.Email{Provider: ProviderSES}, wantErr: true},
+		{name: "unknown provider", config: &config.Email{Provider: "mailgun"}, wantErr: true},
+		{name: "log mode", config: &config.Email{Mode: config.EmailModeLog}, want: &logSender{}},
+		{name: "capture mode", config: &config.Email{Mode: config.EmailModeCapture}, want: &CaptureSender{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := New(tt.config, "https://openregistry.test")
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "ERR_EMAIL_CONFIG") {
+					t.Fatalf("got error %v, want ERR_EMAIL_CONFIG", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := svc.(*email).sender; reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("got sender %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendEmailPayload(t *testing.T) {
+	user := &types.User{Username: "johndoe", Email: "johndoe@example.com"}
+
+	tests := []struct {
+		name         string
+		config       *config.Email
+		kind         EmailKind
+		wantTemplate string
+		wantHTML     string
+		wantSubject  string
+	}{
+		{
+			name: "sendgrid template",
+			config: &config.Email{
+				Provider:              ProviderSendGrid,
+				SendAs:                "team@openregistry.test",
+				VerifyEmailTemplateId: "verify-template",
+			},
+			kind:         VerifyEmailKind,
+			wantTemplate: "verify-template",
+			wantSubject:  "Verify Email",
+		},
+		{
+			name:        "smtp rendered",
+			config:      &config.Email{Provider: ProviderSMTP, SendAs: "team@openregistry.test"},
+			kind:        VerifyEmailKind,
+			wantHTML:    "verify_email.html:johndoe:https://openregistry.test/auth/verify?token=token",
+			wantSubject: "Verify Email",
+		},
+		{
+			name:        "ses rendered",
+			config:      &config.Email{Provider: ProviderSES, SendAs: "team@openregistry.test"},
+			kind:        ResetPasswordEmailKind,
+			wantHTML:    "reset_password.html:johndoe:https://openregistry.test/auth/forgot-password?token=token",
+			wantSubject: "Forgot Password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{}
+			svc := NewWithSender(tt.config, "https://openregistry.test", sender, fakeRenderer{})
+			if err := svc.SendEmail(user, "token", tt.kind); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sender.messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(sender.messages))
+			}
+			msg := sender.messages[0]
+			if msg.TemplateID != tt.wantTemplate || msg.HTML != tt.wantHTML || msg.Subject != tt.wantSubject {
+				t.Errorf("got template %q, subject %q and HTML %q, want %q, %q and %q",
+					msg.TemplateID, msg.Subject, msg.HTML, tt.wantTemplate, tt.wantSubject, tt.wantHTML)
+			}
+			if msg.From.Email != tt.config.SendAs || !reflect.DeepEqual(recipients(msg), []string{user.Email}) {
+				t.Errorf("got the message from %s to %v, want from %s to %s",
+					msg.From.Email, recipients(msg), tt.config.SendAs, user.Email)
+			}
+		})
+	}
+}
+
+// requestRecorder is the API of the email provider, it keeps the last request
+type requestRecorder struct {
+	header http.Header
+	body   []byte
+	path   string
+}
+
+func (r *requestRecorder) serve(status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.header = req.Header.Clone()
+		r.path = req.URL.Path
+		r.body, _ = io.ReadAll(req.Body)
+		w.WriteHeader(status)
+	}))
+}
+
+func TestSendGridPayload(t *testing.T) {
+	recorder := &requestRecorder{}
+	server := recorder.serve(http.StatusAccepted)
+	defer server.Close()
+
+	sender := NewSendGridSender("api-key").(*sendGridSender)
+	sender.client.BaseURL = server.URL + "/v3/mail/send"
+	err := sender.Send(context.Background(), &Message{
+		From:       Address{Name: "Team OpenRegistry", Email: "team@openregistry.test"},
+		To:         []Address{{Name: "johndoe", Email: "johndoe@example.com"}},
+		Subject:    "Verify Email",
+		TemplateID: "verify-template",
+		Data:       MailData{Username: "johndoe", Link: "https://openregistry.test/auth/verify?token=token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := recorder.header.Get("Authorization"); got != "Bearer api-key" {
+		t.Errorf("got Authorization %q, want the API key", got)
+	}
+	var payload struct {
+		TemplateID       string `json:"template_id"`
+		Personalizations []struct {
+			To   []Address              `json:"to"`
+			Data map[string]interface{} `json:"dynamic_template_data"`
+		} `json:"personalizations"`
+	}
+	if err = json.Unmarshal(recorder.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.TemplateID != "verify-template" || len(payload.Personalizations) != 1 {
+		t.Fatalf("got the payload %s, want the template with one personalization", recorder.body)
+	}
+	p := payload.Personalizations[0]
+	if p.Data["user"] != "johndoe" || p.Data["link"] != "https://openregistry.test/auth/verify?token=token" {
+		t.Errorf("got the template data %v, want the user and the link", p.Data)
+	}
+	if len(p.To) != 1 || p.To[0].Email != "johndoe@example.com" {
+		t.Errorf("got the recipients %v, want johndoe@example.com", p.To)
+	}
+
+	// an error response is an error
+	failing := (&requestRecorder{}).serve(http.StatusUnauthorized)
+	defer failing.Close()
+	sender.client.BaseURL = failing.URL + "/v3/mail/send"
+	if err = sender.Send(context.Background(), &Message{HTML: "<p>hi</p>"}); err == nil {
+		t.Error("got no error for a rejected email")
+	}
+}
+
+func TestSESPayload(t *testing.T) {
+	recorder := &requestRecorder{}
+	server := recorder.serve(http.StatusOK)
+	defer server.Close()
+
+	s, err := NewSESSender(&config.SES{Region: "eu-west-1", AccessKey: "access-key", SecretKey: "secret-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := s.(*sesSender)
+	if sender.endpoint != "https://email.eu-west-1.amazonaws.com/v2/email/outbound-emails" {
+		t.Errorf("got the endpoint %s, want the SES v2 endpoint of the region", sender.endpoint)
+	}
+	sender.endpoint = server.URL + "/v2/email/outbound-emails"
+
+	err = sender.Send(context.Background(), &Message{
+		From:    Address{Name: "Team OpenRegistry", Email: "team@openregistry.test"},
+		To:      []Address{{Name: "johndoe", Email: "johndoe@example.com"}},
+		Subject: "Forgot Password",
+		HTML:    "<p>reset</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := recorder.header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access-key/") || !strings.Contains(auth, "/eu-west-1/ses/") {
+		t.Errorf("got Authorization %q, want a SigV4 signature for ses in eu-west-1", auth)
+	}
+	var input sesSendEmailInput
+	if err = json.Unmarshal(recorder.body, &input); err != nil {
+		t.Fatal(err)
+	}
+	if input.FromEmailAddress != `"Team OpenRegistry" <team@openregistry.test>` ||
+		!reflect.DeepEqual(input.Destination.ToAddresses, []string{"johndoe@example.com"}) {
+		t.Errorf("got the addresses %s to %v", input.FromEmailAddress, input.Destination.ToAddresses)
+	}
+	if input.Content.Simple.Subject.Data != "Forgot Password" || input.Content.Simple.Body.Html.Data != "<p>reset</p>" {
+		t.Errorf("got the content %+v, want the subject and the HTML", input.Content.Simple)
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	body, err := mimeMessage(&Message{
+		From: Address{Name: "Team OpenRegistry", Email: "team@openregistry.test"},
+		// the name can't add a header
+		To:      []Address{{Name: "johndoe\r\nBcc: attacker@example.com", Email: "johndoe@example.com"}},
+		Subject: "Verify Email",
+		HTML:    `<a href="https://openregistry.test/auth/verify?token=token">verify</a>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, content, ok := strings.Cut(string(body), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("got the message %q, want headers and a body", body)
+	}
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("got the headers %q, want the name encoded", header)
+	}
+	for _, want := range []string{
+		`From: "Team OpenRegistry" <team@openregistry.test>`,
+		"Subject: Verify Email",
+		"Content-Type: text/html; charset=UTF-8",
+		"Content-Transfer-Encoding: quoted-printable",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("got the headers %q, want %q", header, want)
+		}
+	}
+	if !strings.Contains(content, "token=3Dtoken") {
+		t.Errorf("got the body %q, want the quoted-printable link", content)
+	}
+}
+
+func TestSendErrorIsWrapped(t *testing.T) {
+	svc := NewWithSender(&config.Email{Provider: ProviderSMTP}, "", senderFunc(func(*Message) error {
+		return errors.New("connection refused")
+	}), fakeRenderer{})
+	err := svc.SendEmail(&types.User{Username: "johndoe"}, "token", VerifyEmailKind)
+	if err == nil || !strings.Contains(err.Error(), "ERR_SEND_EMAIL") {
+		t.Errorf("got error %v, want ERR_SEND_EMAIL", err)
+	}
+}
+
+func (f senderFunc) Send(_ context.Context, msg *Message) error {
+	return f(msg)
+}
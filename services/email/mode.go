@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultCaptureSize = 100
+
+type logSender struct {
+	logger zerolog.Logger
+}
+
+// NewLogSender writes the messages to stdout instead of sending them, for the local and CI environments
+func NewLogSender() EmailSender {
+	return &logSender{
+		logger: zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger(),
+	}
+}
+
+func (s *logSender) Send(_ context.Context, msg *Message) error {
+	s.logger.Info().
+		Str("from", msg.From.Email).
+		Strs("to", recipients(msg)).
+		Str("subject", msg.Subject).
+		Str("template_id", msg.TemplateID).
+		Str("link", msg.Data.Link).
+		Str("html", msg.HTML).
+		Msg("email not sent, email mode is log")
+
+	return nil
+}
+
+// CaptureSender keeps the last messages in memory instead of sending them, so that the tests can read them
+type CaptureSender struct {
+	mu       sync.Mutex
+	messages []*Message
+	size     int
+}
+
+// NewCaptureSender keeps the last size messages, zero keeps the last 100
+func NewCaptureSender(size int) *CaptureSender {
+	if size <= 0 {
+		size = defaultCaptureSize
+	}
+
+	return &CaptureSender{size: size}
+}
+
+func (s *CaptureSender) Send(_ context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *msg
+	copied.To = append([]Address(nil), msg.To...)
+	s.messages = append(s.messages, &copied)
+	if len(s.messages) > s.size {
+		s.messages = s.messages[len(s.messages)-s.size:]
+	}
+
+	return nil
+}
+
+// Messages returns the captured messages sent to the address, or all of them when it's empty, oldest first
+func (s *CaptureSender) Messages(to string) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]*Message, 0, len(s.messages))
+	for _, msg := range s.messages {
+		if to == "" || sentTo(msg, to) {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+func recipients(msg *Message) []string {
+	to := make([]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		to = append(to, addr.Email)
+	}
+
+	return to
+}
+
+func sentTo(msg *Message, email string) bool {
+	for _, addr := range msg.To {
+		if strings.EqualFold(addr.Email, email) {
+			return true
+		}
+	}
+
+	return false
+}
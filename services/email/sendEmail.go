@@ -1,8 +1,8 @@
 package email
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 
 	"github.com/containerish/OpenRegistry/types"
 )
@@ -22,10 +22,5 @@ func (e *email) SendEmail(u *types.User, token string, kind EmailKind) error {
 		return fmt.Errorf("ERR_CREATE_EMAIL: %w", err)
 	}
 
-	resp, err := e.client.Send(mailMsg)
-	if err != nil && resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("ERR_SEND_EMAIL: %w", err)
-	}
-
-	return nil
+	return e.send(context.Background(), mailMsg)
 }
@@ -0,0 +1,27 @@
+package email
+
+import (
+	"context"
+)
+
+// EmailSender delivers a message with one of the email providers
+type EmailSender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type Address struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Message is an email before it's handed to the provider. Messages with a TemplateID are rendered by the provider
+// from Data, the other ones are rendered to HTML by the TemplateRenderer
+type Message struct {
+	From       Address   `json:"from"`
+	Subject    string    `json:"subject"`
+	TemplateID string    `json:"template_id,omitempty"`
+	HTML       string    `json:"html,omitempty"`
+	Data       MailData  `json:"data"`
+	To         []Address `json:"to"`
+	Kind       EmailKind `json:"kind"`
+}
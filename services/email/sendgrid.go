@@ -0,0 +1,52 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type sendGridSender struct {
+	client *sendgrid.Client
+}
+
+func NewSendGridSender(apiKey string) EmailSender {
+	return &sendGridSender{client: sendgrid.NewSendClient(apiKey)}
+}
+
+// Send uses the dynamic template of the message when it has one, the rendered HTML otherwise
+func (s *sendGridSender) Send(ctx context.Context, msg *Message) error {
+	m := mail.NewV3Mail()
+	m.SetFrom(mail.NewEmail(msg.From.Name, msg.From.Email))
+
+	p := mail.NewPersonalization()
+	for _, to := range msg.To {
+		p.AddTos(mail.NewEmail(to.Name, to.Email))
+	}
+	p.Subject = msg.Subject
+
+	if msg.TemplateID != "" {
+		m.SetTemplateID(msg.TemplateID)
+		if msg.Data.Username != "" {
+			p.SetDynamicTemplateData("user", msg.Data.Username)
+		}
+		p.SetDynamicTemplateData("link", msg.Data.Link)
+	} else {
+		m.Subject = msg.Subject
+		m.AddContent(mail.NewContent("text/html", msg.HTML))
+	}
+	m.AddPersonalizations(p)
+
+	resp, err := s.client.SendWithContext(ctx, m)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("sendgrid responded with %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
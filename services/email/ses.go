@@ -0,0 +1,117 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/containerish/OpenRegistry/config"
+)
+
+type sesSender struct {
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+	region      string
+	endpoint    string
+}
+
+// NewSESSender sends the rendered HTML of the messages with the SendEmail call of the SES v2 API, the requests are
+// signed with SigV4
+func NewSESSender(cfg *config.SES) (EmailSender, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.Region)}
+	if cfg.AccessKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
+		))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_LOAD_SES_CONFIG: %w", err)
+	}
+
+	return &sesSender{
+		credentials: awsCfg.Credentials,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: time.Second * 30},
+		region:      cfg.Region,
+		endpoint:    fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", cfg.Region),
+	}, nil
+}
+
+type (
+	sesContent struct {
+		Data    string
+		Charset string
+	}
+
+	sesSendEmailInput struct {
+		FromEmailAddress string
+		Destination      struct {
+			ToAddresses []string
+		}
+		Content struct {
+			Simple struct {
+				Subject sesContent
+				Body    struct {
+					Html sesContent
+				}
+			}
+		}
+	}
+)
+
+func (s *sesSender) Send(ctx context.Context, msg *Message) error {
+	input := &sesSendEmailInput{
+		FromEmailAddress: (&mail.Address{Name: msg.From.Name, Address: msg.From.Email}).String(),
+	}
+	input.Destination.ToAddresses = recipients(msg)
+	input.Content.Simple.Subject = sesContent{Data: msg.Subject, Charset: "UTF-8"}
+	input.Content.Simple.Body.Html = sesContent{Data: msg.HTML, Charset: "UTF-8"}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("ERR_RETRIEVE_SES_CREDENTIALS: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+	err = s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "ses", s.region, time.Now())
+	if err != nil {
+		return fmt.Errorf("ERR_SIGN_SES_REQUEST: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ses responded with %d: %s", resp.StatusCode, errBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+)
+
+type smtpSender struct {
+	auth smtp.Auth
+	addr string
+}
+
+// NewSMTPSender sends the rendered HTML of the messages, SMTP has no template ids
+func NewSMTPSender(cfg *config.SMTP) EmailSender {
+	s := &smtpSender{addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return s
+}
+
+// Send doesn't take the context into account, net/smtp has no support for it
+func (s *smtpSender) Send(_ context.Context, msg *Message) error {
+	body, err := mimeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.addr, s.auth, msg.From.Email, recipients(msg), body)
+}
+
+// mimeMessage builds a quoted-printable HTML message, the headers are encoded so that the user input in the names
+// can't add headers
+func mimeMessage(msg *Message) ([]byte, error) {
+	to := make([]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		to = append(to, (&mail.Address{Name: addr.Name, Address: addr.Email}).String())
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", (&mail.Address{Name: msg.From.Name, Address: msg.From.Email}).String())
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(msg.HTML)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
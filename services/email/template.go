@@ -0,0 +1,74 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+// TemplateRenderer renders the HTML body of the emails sent without a template id
+type TemplateRenderer interface {
+	Render(kind EmailKind, data MailData) (string, error)
+}
+
+//go:embed templates/*.html
+var embeddedTemplates embed.FS //nolint
+
+// templateFiles are the names of the templates of each kind, in the templates dir and the override dir
+var templateFiles = map[EmailKind]string{ //nolint
+	WelcomeEmailKind:       "welcome.html",
+	VerifyEmailKind:        "verify_email.html",
+	ResetPasswordEmailKind: "reset_password.html",
+}
+
+type htmlRenderer struct {
+	templates map[EmailKind]*template.Template
+}
+
+// NewRenderer renders the emails with the templates embedded in OpenRegistry. The templates with the same file name
+// in overrideDir replace the embedded ones, the dir may override only some of them. They're parsed on startup, so a
+// broken template fails it
+func NewRenderer(overrideDir string) (TemplateRenderer, error) {
+	r := &htmlRenderer{templates: make(map[EmailKind]*template.Template, len(templateFiles))}
+	for kind, name := range templateFiles {
+		content, err := embeddedTemplates.ReadFile("templates/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_READ_EMAIL_TEMPLATE: %w", err)
+		}
+
+		if overrideDir != "" {
+			override, err := os.ReadFile(filepath.Join(overrideDir, name))
+			switch {
+			case err == nil:
+				content = override
+			case !os.IsNotExist(err):
+				return nil, fmt.Errorf("ERR_READ_EMAIL_TEMPLATE: %w", err)
+			}
+		}
+
+		tmpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("ERR_PARSE_EMAIL_TEMPLATE: %s: %w", name, err)
+		}
+		r.templates[kind] = tmpl
+	}
+
+	return r, nil
+}
+
+func (r *htmlRenderer) Render(kind EmailKind, data MailData) (string, error) {
+	tmpl, ok := r.templates[kind]
+	if !ok {
+		return "", fmt.Errorf("no template for email kind %d", kind)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,114 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+func TestRenderSubstitutions(t *testing.T) {
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := MailData{Username: "johndoe", Link: "https://openregistry.test/auth/verify?token=token&id=1"}
+	for kind, name := range templateFiles {
+		t.Run(name, func(t *testing.T) {
+			html, err := r.Render(kind, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(html, "https://openregistry.test/auth/verify?token=token&amp;id=1") {
+				t.Errorf("got %q, want the link", html)
+			}
+			if kind != WelcomeEmailKind && !strings.Contains(html, "Hi johndoe,") {
+				t.Errorf("got %q, want the username", html)
+			}
+			if strings.Contains(html, "{{") {
+				t.Errorf("got %q, want every placeholder substituted", html)
+			}
+		})
+	}
+
+	// the user input is escaped
+	html, err := r.Render(VerifyEmailKind, MailData{Username: "<script>alert(1)</script>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<script>") || !strings.Contains(html, "&lt;script&gt;") {
+		t.Errorf("got %q, want the username escaped", html)
+	}
+}
+
+func TestRenderOverrides(t *testing.T) {
+	dir := t.TempDir()
+	override := `<p>Custom {{.Username}}: {{.Link}}</p>`
+	if err := os.WriteFile(filepath.Join(dir, "verify_email.html"), []byte(override), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := MailData{Username: "johndoe", Link: "https://openregistry.test/verify"}
+	html, err := r.Render(VerifyEmailKind, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != "<p>Custom johndoe: https://openregistry.test/verify</p>" {
+		t.Errorf("got %q, want the override", html)
+	}
+
+	// the templates which aren't overridden are the embedded ones
+	html, err = r.Render(ResetPasswordEmailKind, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "Custom") || !strings.Contains(html, "Hi johndoe,") {
+		t.Errorf("got %q, want the embedded template", html)
+	}
+
+	// a broken override fails the startup
+	if err = os.WriteFile(filepath.Join(dir, "welcome.html"), []byte("{{.Link"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewRenderer(dir); err == nil || !strings.Contains(err.Error(), "ERR_PARSE_EMAIL_TEMPLATE") {
+		t.Errorf("got error %v, want ERR_PARSE_EMAIL_TEMPLATE", err)
+	}
+}
+
+// TestMissingTemplateIDFallsBack sends with SendGrid without a template id for the kind, the email is rendered from
+// the embedded template
+func TestMissingTemplateIDFallsBack(t *testing.T) {
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &fakeSender{}
+	cfg := &config.Email{Provider: ProviderSendGrid, SendAs: "team@openregistry.test", VerifyEmailTemplateId: "verify"}
+	svc := NewWithSender(cfg, "https://openregistry.test", sender, r)
+
+	user := &types.User{Username: "johndoe", Email: "johndoe@example.com"}
+	if err = svc.SendEmail(user, "token", ResetPasswordEmailKind); err != nil {
+		t.Fatal(err)
+	}
+	if err = svc.SendEmail(user, "token", VerifyEmailKind); err != nil {
+		t.Fatal(err)
+	}
+
+	reset, verify := sender.messages[0], sender.messages[1]
+	if reset.TemplateID != "" ||
+		!strings.Contains(reset.HTML, "https://openregistry.test/auth/forgot-password?token=token") ||
+		!strings.Contains(reset.HTML, "Hi johndoe,") {
+		t.Errorf("got template %q and HTML %q, want the embedded template", reset.TemplateID, reset.HTML)
+	}
+	if verify.TemplateID != "verify" || verify.HTML != "" {
+		t.Errorf("got template %q and HTML %q, want the template id", verify.TemplateID, verify.HTML)
+	}
+}
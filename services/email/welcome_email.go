@@ -1,37 +1,22 @@
 package email
 
 import (
+	"context"
 	"fmt"
-	"net/http"
-
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 func (e *email) WelcomeEmail(list []string) error {
+	msg := &Message{
+		From:       Address{Name: "Team OpenRegistry", Email: e.config.SendAs},
+		Subject:    "Welcome to OpenRegistry",
+		Kind:       WelcomeEmailKind,
+		TemplateID: e.templateID(WelcomeEmailKind),
+		Data:       MailData{Link: fmt.Sprintf("%s/send-email/welcome", e.baseURL)},
+	}
 
-	mailReq := &Mail{}
-	m := mail.NewV3Mail()
-
-	m.SetTemplateID(e.config.WelcomeEmailTemplateId)
-	mailReq.Subject = "Welcome to OpenRegistry"
-	mailReq.Data.Link = fmt.Sprintf("%s/send-email/welcome", e.baseURL)
-
-	email := mail.NewEmail("Team OpenRegistry", e.config.SendAs)
-	m.SetFrom(email)
-	p := mail.NewPersonalization()
-
-	var tos []*mail.Email
 	for _, v := range list {
-		tos = append(tos, mail.NewEmail(v, v))
+		msg.To = append(msg.To, Address{Name: v, Email: v})
 	}
 
-	p.AddTos(tos...)
-	m.AddPersonalizations(p)
-	p.Subject = mailReq.Subject
-
-	resp, err := e.client.Send(m)
-	if err != nil && resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("ERR_SEND_EMAIL: %w", err)
-	}
-	return nil
+	return e.send(context.Background(), msg)
 }
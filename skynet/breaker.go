@@ -0,0 +1,111 @@
+package skynet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/fatih/color"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = time.Second * 30
+)
+
+// ErrPortalUnavailable is returned without calling the portal while the circuit breaker is open, RetryAfter is
+// how long the breaker stays open.
+//
+// Mapping it to a response is deferred: the registry serves blobs through the S3 compatible DFS and never builds a
+// Client, so no handler can get this error. Whichever DFS is backed by this client should answer it with
+// 503 UNAVAILABLE and a Retry-After of RetryAfter (see IsPortalUnavailable)
+type ErrPortalUnavailable struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrPortalUnavailable) Error() string {
+	return fmt.Sprintf("SKYNET_PORTAL_UNAVAILABLE: retry after %s", e.RetryAfter)
+}
+
+// IsPortalUnavailable returns the retry delay if err was caused by the circuit breaker being open
+func IsPortalUnavailable(err error) (time.Duration, bool) {
+	var e *ErrPortalUnavailable
+	if errors.As(err, &e) {
+		return e.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+type breaker struct {
+	cb          *gobreaker.CircuitBreaker
+	openTimeout time.Duration
+}
+
+func newBreaker(cfg *config.CircuitBreaker, portalURL string) *breaker {
+	threshold := uint32(defaultFailureThreshold)
+	openTimeout := defaultOpenTimeout
+	if cfg != nil {
+		if cfg.FailureThreshold > 0 {
+			threshold = cfg.FailureThreshold
+		}
+		if cfg.OpenTimeout > 0 {
+			openTimeout = cfg.OpenTimeout
+		}
+	}
+
+	state := breakerStateGauge().WithLabelValues(portalURL)
+	state.Set(float64(gobreaker.StateClosed))
+	settings := gobreaker.Settings{
+		Name:        portalURL,
+		MaxRequests: 1,
+		Timeout:     openTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			color.Yellow("skynet portal %s circuit breaker: %s -> %s", name, from, to)
+			state.Set(float64(to))
+		},
+	}
+
+	return &breaker{
+		cb:          gobreaker.NewCircuitBreaker(settings),
+		openTimeout: openTimeout,
+	}
+}
+
+// execute calls fn unless the breaker is open (or already probing the portal while half-open)
+func (b *breaker) execute(fn func() (interface{}, error)) (interface{}, error) {
+	res, err := b.cb.Execute(fn)
+	if err == gobreaker.ErrOpenState || err == gobreaker.ErrTooManyRequests {
+		return nil, &ErrPortalUnavailable{RetryAfter: b.openTimeout}
+	}
+
+	return res, err
+}
+
+// breakerStateGauge reports the breaker state of every portal as 0 (closed), 1 (half-open) or 2 (open)
+func breakerStateGauge() *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "OpenRegistry",
+		Subsystem: "skynet",
+		Name:      "circuit_breaker_state",
+		Help:      "State of the Skynet portal circuit breakers: 0 closed, 1 half-open, 2 open",
+	}, []string{"portal"})
+
+	if err := prometheus.Register(gauge); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(*prometheus.GaugeVec); ok {
+				return existing
+			}
+		}
+		color.Red("error registering skynet circuit breaker metric: %s", err)
+	}
+
+	return gauge
+}
@@ -0,0 +1,107 @@
+package skynet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/sony/gobreaker"
+)
+
+const testOpenTimeout = time.Millisecond * 50
+
+var errPortalDown = errors.New("portal is down")
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b := newBreaker(&config.CircuitBreaker{FailureThreshold: 2, OpenTimeout: testOpenTimeout}, "http://portal.test")
+
+	calls := 0
+	fail := func() (interface{}, error) {
+		calls++
+		return nil, errPortalDown
+	}
+	succeed := func() (interface{}, error) {
+		calls++
+		return "skylink", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.execute(fail); !errors.Is(err, errPortalDown) {
+			t.Fatalf("call %d: got error %v, want the portal error", i, err)
+		}
+	}
+	if state := b.cb.State(); state != gobreaker.StateOpen {
+		t.Fatalf("got state %s after the failures, want open", state)
+	}
+
+	// the portal isn't called while the breaker is open
+	_, err := b.execute(succeed)
+	retryAfter, ok := IsPortalUnavailable(err)
+	if !ok || retryAfter != testOpenTimeout {
+		t.Fatalf("got error %v, want ErrPortalUnavailable with a retry after %s", err, testOpenTimeout)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d calls to the portal, want 2", calls)
+	}
+
+	// a failed probe opens the breaker again
+	time.Sleep(testOpenTimeout + time.Millisecond*10)
+	if _, err = b.execute(fail); !errors.Is(err, errPortalDown) {
+		t.Fatalf("got error %v from the probe, want the portal error", err)
+	}
+	if state := b.cb.State(); state != gobreaker.StateOpen {
+		t.Fatalf("got state %s after the failed probe, want open", state)
+	}
+
+	// the portal healed, the probe closes the breaker
+	time.Sleep(testOpenTimeout + time.Millisecond*10)
+	res, err := b.execute(succeed)
+	if err != nil || res != "skylink" {
+		t.Fatalf("got %v and error %v from the probe, want the skylink", res, err)
+	}
+	if state := b.cb.State(); state != gobreaker.StateClosed {
+		t.Fatalf("got state %s after the probe, want closed", state)
+	}
+	if _, err = b.execute(succeed); err != nil {
+		t.Fatalf("got error %v after the recovery", err)
+	}
+}
+
+func TestClientFailsFastWhenPortalsAreOpen(t *testing.T) {
+	c := NewClient(&config.OpenRegistryConfig{
+		Registry: &config.Registry{},
+		SkynetConfig: &config.Skynet{
+			SkynetPortalURL: "http://primary.test",
+			PortalURLs:      []string{"http://failover.test"},
+			CircuitBreaker:  &config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Minute},
+		},
+	})
+
+	calls := 0
+	fail := func(*skynet.SkynetClient) (interface{}, error) {
+		calls++
+		return nil, errPortalDown
+	}
+
+	// both portals are tried once, which opens both of their breakers
+	if _, err := c.call(fail); !errors.Is(err, errPortalDown) {
+		t.Fatalf("got error %v, want the portal error", err)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d calls, want each portal to be called once", calls)
+	}
+
+	start := time.Now()
+	_, err := c.call(fail)
+	if _, ok := IsPortalUnavailable(err); !ok {
+		t.Fatalf("got error %v, want ErrPortalUnavailable", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want no portal called while the breakers are open", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("failing with the breakers open took %s", elapsed)
+	}
+}
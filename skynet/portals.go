@@ -0,0 +1,97 @@
+package skynet
+
+import (
+	"sync/atomic"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/fatih/color"
+	"github.com/sony/gobreaker"
+)
+
+// portal is a Skynet portal along with its own circuit breaker, the breaker state is the portal health
+type portal struct {
+	client  *skynet.SkynetClient
+	breaker *breaker
+	url     string
+}
+
+func newPortals(cfg *config.Skynet) []*portal {
+	opts := skynet.Options{
+		CustomUserAgent: cfg.CustomUserAgent,
+		SkynetAPIKey:    cfg.ApiKey,
+		HttpClient:      newHttpClientForSkynet(),
+	}
+
+	urls := []string{cfg.SkynetPortalURL}
+	for _, url := range cfg.PortalURLs {
+		if url != cfg.SkynetPortalURL {
+			urls = append(urls, url)
+		}
+	}
+
+	portals := make([]*portal, 0, len(urls))
+	for _, url := range urls {
+		color.Green("Skynet Portal: %s", url)
+		client := skynet.NewCustom(url, opts)
+		portals = append(portals, &portal{
+			url:     url,
+			client:  &client,
+			breaker: newBreaker(cfg.CircuitBreaker, url),
+		})
+	}
+
+	return portals
+}
+
+func (p *portal) healthy() bool {
+	return p.breaker.cb.State() != gobreaker.StateOpen
+}
+
+// portalOrder returns the portals in the order they should be tried: the primary portal if it's healthy,
+// then the healthy failover portals starting from the next one in round robin, then the unhealthy ones
+func (c *Client) portalOrder() []*portal {
+	order := make([]*portal, 0, len(c.portals))
+	var unhealthy []*portal
+
+	primary := c.portals[0]
+	if primary.healthy() {
+		order = append(order, primary)
+	} else {
+		unhealthy = append(unhealthy, primary)
+	}
+
+	failover := c.portals[1:]
+	if len(failover) > 0 {
+		start := int(atomic.AddUint32(&c.next, 1)) % len(failover)
+		for i := range failover {
+			p := failover[(start+i)%len(failover)]
+			if p.healthy() {
+				order = append(order, p)
+			} else {
+				unhealthy = append(unhealthy, p)
+			}
+		}
+	}
+
+	return append(order, unhealthy...)
+}
+
+// call tries fn on every portal until one succeeds, the error of the last portal is returned if all of them fail.
+// fn may be called more than once, so it must not reuse readers between calls
+func (c *Client) call(fn func(client *skynet.SkynetClient) (interface{}, error)) (interface{}, error) {
+	var err error
+	for _, p := range c.portalOrder() {
+		var res interface{}
+		res, err = p.breaker.execute(func() (interface{}, error) {
+			return fn(p.client)
+		})
+		if err == nil {
+			return res, nil
+		}
+
+		color.Yellow("skynet portal %s failed: %s", p.url, err)
+	}
+
+	return nil, err
+}
@@ -0,0 +1,136 @@
+package skynet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SkynetLabs/go-skynet/v2"
+	"github.com/containerish/OpenRegistry/config"
+)
+
+// testPortal serves body over TLS for every download, or 502 while it's down
+type testPortal struct {
+	*httptest.Server
+	body  string
+	down  int32
+	calls int32
+}
+
+func newTestPortal(t *testing.T, body string) *testPortal {
+	p := &testPortal{body: body}
+	p.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&p.calls, 1)
+		if atomic.LoadInt32(&p.down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = io.WriteString(w, p.body)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *testPortal) setDown(down bool) {
+	var v int32
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&p.down, v)
+}
+
+func (p *testPortal) callCount() int {
+	return int(atomic.LoadInt32(&p.calls))
+}
+
+// newTestClient returns a client of the portals, which trusts their test certificate
+func newTestClient(cfg *config.Skynet, portal *testPortal) *Client {
+	c := NewClient(&config.OpenRegistryConfig{Registry: &config.Registry{}, SkynetConfig: cfg})
+	for _, p := range c.portals {
+		client := skynet.NewCustom(p.url, skynet.Options{HttpClient: portal.Client()})
+		p.client = &client
+	}
+	return c
+}
+
+func download(t *testing.T, c *Client) string {
+	t.Helper()
+
+	body, err := c.Download("skylink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	bz, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bz)
+}
+
+func TestFailoverToSecondaryPortal(t *testing.T) {
+	primary := newTestPortal(t, "primary")
+	secondary := newTestPortal(t, "secondary")
+	c := newTestClient(&config.Skynet{
+		SkynetPortalURL: primary.URL,
+		PortalURLs:      []string{primary.URL, secondary.URL},
+		CircuitBreaker:  &config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: testOpenTimeout},
+	}, primary)
+	if len(c.portals) != 2 {
+		t.Fatalf("got %d portals, want the primary portal listed once", len(c.portals))
+	}
+
+	if got := download(t, c); got != "primary" {
+		t.Fatalf("got %s, want the primary portal to serve the healthy downloads", got)
+	}
+
+	primary.setDown(true)
+	if got := download(t, c); got != "secondary" {
+		t.Fatalf("got %s, want the secondary portal to serve the download the primary portal failed", got)
+	}
+	if primary.callCount() != 2 {
+		t.Fatalf("got %d calls to the primary portal, want 2", primary.callCount())
+	}
+
+	// the primary portal isn't tried while its breaker is open
+	if got := download(t, c); got != "secondary" {
+		t.Fatalf("got %s, want the secondary portal", got)
+	}
+	if primary.callCount() != 2 {
+		t.Errorf("got %d calls to the primary portal, want none while it's open", primary.callCount())
+	}
+
+	// the primary portal is back once its breaker closes
+	primary.setDown(false)
+	time.Sleep(testOpenTimeout + time.Millisecond*10)
+	if got := download(t, c); got != "primary" {
+		t.Errorf("got %s, want the primary portal once it recovered", got)
+	}
+}
+
+func TestAllPortalsDown(t *testing.T) {
+	primary := newTestPortal(t, "primary")
+	secondary := newTestPortal(t, "secondary")
+	primary.setDown(true)
+	secondary.setDown(true)
+	c := newTestClient(&config.Skynet{
+		SkynetPortalURL: primary.URL,
+		PortalURLs:      []string{secondary.URL},
+		CircuitBreaker:  &config.CircuitBreaker{FailureThreshold: 3, OpenTimeout: time.Minute},
+	}, primary)
+
+	_, err := c.Download("skylink")
+	if err == nil {
+		t.Fatal("got no error with every portal down")
+	}
+	if _, ok := IsPortalUnavailable(err); ok {
+		t.Errorf("got %v, want the error of the last portal while the breakers are closed", err)
+	}
+	if primary.callCount() != 1 || secondary.callCount() != 1 {
+		t.Errorf("got %d and %d calls, want each portal tried once", primary.callCount(), secondary.callCount())
+	}
+}
@@ -9,23 +9,12 @@ import (
 
 	"github.com/SkynetLabs/go-skynet/v2"
 	"github.com/containerish/OpenRegistry/config"
-	"github.com/fatih/color"
 	tar "github.com/whyrusleeping/tar-utils"
 )
 
 func NewClient(oc *config.OpenRegistryConfig) *Client {
-
-	opts := skynet.Options{
-		CustomUserAgent: oc.SkynetConfig.CustomUserAgent,
-		SkynetAPIKey:    oc.SkynetConfig.ApiKey,
-		HttpClient:      newHttpClientForSkynet(),
-	}
-
-	color.Green("Skynet Portal: %s", oc.SkynetConfig.SkynetPortalURL)
-	skynetClient := skynet.NewCustom(oc.SkynetConfig.SkynetPortalURL, opts)
-
 	return &Client{
-		skynet:     &skynetClient,
+		portals:    newPortals(oc.SkynetConfig),
 		isRemote:   false,
 		host:       oc.Registry.Host,
 		gatewayURL: oc.SkynetConfig.SkynetPortalURL,
@@ -35,37 +24,47 @@ func NewClient(oc *config.OpenRegistryConfig) *Client {
 
 func (c *Client) Upload(namespace, digest string, content []byte, pin bool) (string, error) {
 	opts := skynet.DefaultUploadOptions
-	opts.SkynetAPIKey = c.skynet.Options.SkynetAPIKey
+	opts.SkynetAPIKey = c.config.SkynetConfig.ApiKey
 	opts.CustomDirname = namespace
 
-	data := make(skynet.UploadData)
-	buf := bytes.NewBuffer(content)
+	res, err := c.call(func(client *skynet.SkynetClient) (interface{}, error) {
+		data := make(skynet.UploadData)
+		data[digest] = bytes.NewBuffer(content)
+
+		skylink, err := client.Upload(data, opts)
+		if err != nil {
+			return nil, err
+		}
 
-	data[digest] = buf
+		// enable pinning only in Prod Environment
+		if pin && c.config.Environment == config.Production {
+			return client.PinSkylink(skylink)
+		}
 
-	skylink, err := c.skynet.Upload(data, opts)
+		return skylink, nil
+	})
 	if err != nil {
 		return "", err
 	}
 
-	// enable pinning only in Prod Environment
-	if pin && c.config.Environment == config.Production {
-		return c.skynet.PinSkylink(skylink)
-	}
-
-	return skylink, nil
+	return res.(string), nil
 }
 
 func (c *Client) Download(path string) (io.ReadCloser, error) {
 	opts := skynet.DefaultDownloadOptions
 
-	return c.skynet.Download(path, opts)
+	res, err := c.call(func(client *skynet.SkynetClient) (interface{}, error) {
+		return client.Download(path, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(io.ReadCloser), nil
 }
 
 func (c *Client) DownloadDir(skynetLink, dir string) error {
-	opts := skynet.DefaultDownloadOptions
-
-	tarball, err := c.skynet.Download(skynetLink, opts)
+	tarball, err := c.Download(skynetLink)
 	if err != nil {
 		return err
 	}
@@ -85,30 +84,42 @@ func (c *Client) AddImage(ns string, mf, l map[string][]byte) (string, error) {
 	opts := skynet.DefaultUploadOptions
 	opts.CustomDirname = ns
 
-	uploadData := make(skynet.UploadData)
+	res, err := c.call(func(client *skynet.SkynetClient) (interface{}, error) {
+		imageReader, err := Image{mf, l}.Reader()
+		if err != nil {
+			return nil, err
+		}
 
-	imageReader, err := Image{mf, l}.Reader()
+		uploadData := make(skynet.UploadData)
+		uploadData["image"] = imageReader
+		return client.Upload(uploadData, opts)
+	})
 	if err != nil {
 		return "", err
 	}
 
-	uploadData["image"] = imageReader
-
-	link, err := c.skynet.Upload(uploadData, opts)
-	return link, err
+	return res.(string), nil
 }
 
 func (c *Client) Metadata(skylink string) (*skynet.Metadata, error) {
 	var err error
 	var metadata *skynet.Metadata
 	for i := 3; i != 0; i-- {
-		metadata, err = c.skynet.Metadata(skylink, skynet.DefaultMetadataOptions)
+		var res interface{}
+		res, err = c.call(func(client *skynet.SkynetClient) (interface{}, error) {
+			return client.Metadata(skylink, skynet.DefaultMetadataOptions)
+		})
+		if _, ok := IsPortalUnavailable(err); ok {
+			// every portal is down, retrying can't succeed before a breaker half-opens
+			return nil, err
+		}
 		if err != nil {
 			err = fmt.Errorf("SKYNET_METADATA_ERR: %w", err)
 			// cool off
 			time.Sleep(time.Second * 3)
 			continue
 		}
+		metadata = res.(*skynet.Metadata)
 		break
 	}
 
@@ -5,17 +5,19 @@ import (
 	"encoding/json"
 	"io"
 
-	skynet "github.com/SkynetLabs/go-skynet/v2"
 	"github.com/containerish/OpenRegistry/config"
 )
 
 type (
 	Client struct {
-		skynet     *skynet.SkynetClient
-		config     *config.OpenRegistryConfig
+		config *config.OpenRegistryConfig
+		// portals[0] is the primary portal, the others are only used when it fails
+		portals    []*portal
 		host       string
 		gatewayURL string
-		isRemote   bool
+		// next is the round robin index into the failover portals
+		next     uint32
+		isRemote bool
 	}
 	Config struct {
 		Host       string
@@ -0,0 +1,172 @@
+// Package stats counts the pulls and pushes of every repository
+package stats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+)
+
+const flushInterval = time.Second * 30
+
+type Recorder interface {
+	// RecordPull, RecordLayerPull and RecordPush only update the in memory counters, they never block the
+	// request path on the database
+	RecordPull(namespace string)
+	RecordLayerPull(namespace string)
+	RecordPush(namespace string)
+
+	// Get returns the stored stats of the repository, including the counters that are not flushed yet
+	Get(ctx context.Context, namespace string) (*types.RepositoryStats, error)
+
+	// Close flushes the pending counters and stops the background writer
+	Close()
+}
+
+type recorder struct {
+	store   postgres.StatsStore
+	pending map[string]*types.RepositoryStats
+	mu      *sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func New(store postgres.StatsStore) Recorder {
+	r := &recorder{
+		store:   store,
+		pending: make(map[string]*types.RepositoryStats),
+		mu:      &sync.Mutex{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go r.run()
+	return r
+}
+
+func (r *recorder) RecordPull(namespace string) {
+	now := time.Now()
+	r.update(namespace, func(s *types.RepositoryStats) {
+		s.PullCount++
+		s.LastPulledAt = &now
+	})
+}
+
+func (r *recorder) RecordLayerPull(namespace string) {
+	now := time.Now()
+	r.update(namespace, func(s *types.RepositoryStats) {
+		s.LayerPullCount++
+		s.LastPulledAt = &now
+	})
+}
+
+func (r *recorder) RecordPush(namespace string) {
+	now := time.Now()
+	r.update(namespace, func(s *types.RepositoryStats) {
+		s.PushCount++
+		s.LastPushedAt = &now
+	})
+}
+
+func (r *recorder) update(namespace string, fn func(s *types.RepositoryStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.pending[namespace]
+	if !ok {
+		s = &types.RepositoryStats{Namespace: namespace}
+		r.pending[namespace] = s
+	}
+	fn(s)
+}
+
+func (r *recorder) Get(ctx context.Context, namespace string) (*types.RepositoryStats, error) {
+	stats, err := r.store.GetRepositoryStats(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if pending, ok := r.pending[namespace]; ok {
+		merge(stats, pending)
+	}
+	r.mu.Unlock()
+
+	stats.LastActivity = latest(stats.LastPulledAt, stats.LastPushedAt)
+	return stats, nil
+}
+
+func (r *recorder) Close() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.stop:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush writes the pending counters, they are kept for the next flush if the write fails
+func (r *recorder) flush() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]*types.RepositoryStats)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	stats := make([]*types.RepositoryStats, 0, len(pending))
+	for _, s := range pending {
+		stats = append(stats, s)
+	}
+
+	if err := r.store.AddRepositoryStats(context.Background(), stats); err != nil {
+		color.Red("error writing repository stats: %s", err)
+
+		r.mu.Lock()
+		for namespace, s := range pending {
+			if current, ok := r.pending[namespace]; ok {
+				merge(s, current)
+			}
+			r.pending[namespace] = s
+		}
+		r.mu.Unlock()
+	}
+}
+
+// merge adds the counters of src to dst
+func merge(dst, src *types.RepositoryStats) {
+	dst.PullCount += src.PullCount
+	dst.LayerPullCount += src.LayerPullCount
+	dst.PushCount += src.PushCount
+	dst.LastPulledAt = latest(dst.LastPulledAt, src.LastPulledAt)
+	dst.LastPushedAt = latest(dst.LastPushedAt, src.LastPushedAt)
+}
+
+func latest(a, b *time.Time) *time.Time {
+	if a == nil {
+		return b
+	}
+	if b == nil || a.After(*b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type statsStore struct {
+	stats map[string]*types.RepositoryStats
+	err   error
+	mu    sync.Mutex
+}
+
+func (s *statsStore) AddRepositoryStats(_ context.Context, stats []*types.RepositoryStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	for _, st := range stats {
+		stored, ok := s.stats[st.Namespace]
+		if !ok {
+			stored = &types.RepositoryStats{Namespace: st.Namespace}
+			s.stats[st.Namespace] = stored
+		}
+		merge(stored, st)
+	}
+	return nil
+}
+
+func (s *statsStore) GetRepositoryStats(_ context.Context, namespace string) (*types.RepositoryStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := types.RepositoryStats{Namespace: namespace}
+	if stored, ok := s.stats[namespace]; ok {
+		stats = *stored
+	}
+	return &stats, nil
+}
+
+func assertCounts(t *testing.T, stats *types.RepositoryStats, pulls, layerPulls, pushes int64) {
+	t.Helper()
+
+	if stats.PullCount != pulls || stats.LayerPullCount != layerPulls || stats.PushCount != pushes {
+		t.Errorf("got %d pulls, %d layer pulls and %d pushes, want %d, %d and %d",
+			stats.PullCount, stats.LayerPullCount, stats.PushCount, pulls, layerPulls, pushes)
+	}
+}
+
+func TestCountsAcrossOperations(t *testing.T) {
+	ctx := context.Background()
+	store := &statsStore{stats: make(map[string]*types.RepositoryStats)}
+	r := New(store)
+
+	r.RecordPush("johndoe/alpine")
+	r.RecordPull("johndoe/alpine")
+	r.RecordPull("johndoe/alpine")
+	r.RecordLayerPull("johndoe/alpine")
+	r.RecordPull("johndoe/busybox")
+
+	// the pending counters are included before they are flushed
+	stats, err := r.Get(ctx, "johndoe/alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, stats, 2, 1, 1)
+	if stats.LastPulledAt == nil || stats.LastPushedAt == nil || stats.LastActivity == nil ||
+		!stats.LastActivity.Equal(*stats.LastPulledAt) {
+		t.Errorf("got last pull %v, last push %v and last activity %v, want the last activity to be the last pull",
+			stats.LastPulledAt, stats.LastPushedAt, stats.LastActivity)
+	}
+
+	r.(*recorder).flush()
+	if len(store.stats) != 2 {
+		t.Fatalf("got stats of %d repositories in the store, want 2", len(store.stats))
+	}
+	assertCounts(t, store.stats["johndoe/alpine"], 2, 1, 1)
+	assertCounts(t, store.stats["johndoe/busybox"], 1, 0, 0)
+
+	// the flushed and the pending counters add up
+	r.RecordPush("johndoe/alpine")
+	r.RecordPull("johndoe/alpine")
+	if stats, err = r.Get(ctx, "johndoe/alpine"); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, stats, 3, 1, 2)
+
+	r.Close()
+	assertCounts(t, store.stats["johndoe/alpine"], 3, 1, 2)
+}
+
+func TestFailedFlushKeepsCounters(t *testing.T) {
+	store := &statsStore{stats: make(map[string]*types.RepositoryStats), err: errors.New("database is down")}
+	r := New(store)
+
+	r.RecordPull("johndoe/alpine")
+	r.(*recorder).flush()
+	r.RecordPull("johndoe/alpine")
+
+	store.mu.Lock()
+	store.err = nil
+	store.mu.Unlock()
+
+	r.Close()
+	assertCounts(t, store.stats["johndoe/alpine"], 2, 0, 0)
+}
+
+func TestUnknownRepository(t *testing.T) {
+	r := New(&statsStore{stats: make(map[string]*types.RepositoryStats)})
+	defer r.Close()
+
+	stats, err := r.Get(context.Background(), "johndoe/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, stats, 0, 0, 0)
+	if stats.LastActivity != nil {
+		t.Errorf("got last activity %v, want none", stats.LastActivity)
+	}
+}
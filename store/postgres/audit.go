@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// AddAuditEvents inserts all the events in a single round trip
+func (p *pg) AddAuditEvents(ctx context.Context, events []*types.AuditEvent) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue(queries.AddAuditEvent, e.ActorId, e.Action, e.Namespace, e.Reference, e.SourceIP, e.CreatedAt)
+	}
+
+	if err := p.conn.SendBatch(childCtx, batch).Close(); err != nil {
+		return fmt.Errorf("ERR_ADD_AUDIT_EVENTS: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) GetAuditEvents(
+	ctx context.Context, filter *types.AuditLogFilter, pageSize, offset int64,
+) ([]*types.AuditEvent, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := p.conn.Query(
+		childCtx, queries.GetAuditEvents, filter.Namespace, filter.ActorId, filter.Since, pageSize, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_QUERY_AUDIT_EVENTS: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*types.AuditEvent, 0)
+	for rows.Next() {
+		var e types.AuditEvent
+		if err := rows.Scan(
+			&e.Id,
+			&e.ActorId,
+			&e.Action,
+			&e.Namespace,
+			&e.Reference,
+			&e.SourceIP,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_AUDIT_EVENTS: %w", err)
+		}
+		events = append(events, &e)
+	}
+
+	return events, nil
+}
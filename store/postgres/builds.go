@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+func (p *pg) CreateBuild(ctx context.Context, build *types.Build) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := p.conn.Exec(
+		childCtx,
+		queries.CreateBuild,
+		build.ID,
+		build.Namespace,
+		build.Commit,
+		build.Status,
+		build.LogsURL,
+		build.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("ERR_CREATE_BUILD: %w", classify(err))
+	}
+
+	return nil
+}
+
+func (p *pg) GetBuild(ctx context.Context, namespace, id string) (*types.Build, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	build, err := scanBuild(p.conn.QueryRow(childCtx, queries.GetBuild, namespace, id))
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_BUILD: %w", classify(err))
+	}
+
+	return build, nil
+}
+
+func (p *pg) GetBuilds(
+	ctx context.Context,
+	namespace string,
+	status types.BuildStatus,
+	limit int,
+) ([]*types.Build, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetBuilds, namespace, string(status), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_BUILDS: %w", classify(err))
+	}
+	defer rows.Close()
+
+	builds := make([]*types.Build, 0)
+	for rows.Next() {
+		build, scanErr := scanBuild(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("ERR_SCAN_BUILD: %w", scanErr)
+		}
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+func (p *pg) UpdateBuildStatus(ctx context.Context, build *types.Build, previous types.BuildStatus) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	result, err := p.conn.Exec(
+		childCtx,
+		queries.UpdateBuildStatus,
+		build.Namespace,
+		build.ID,
+		build.Status,
+		previous,
+		build.LogsURL,
+		build.UpdatedAt,
+		build.StartedAt,
+		build.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("ERR_UPDATE_BUILD_STATUS: %w", classify(err))
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_UPDATE_BUILD_STATUS: %w", &storeError{
+			kind: ErrConflict,
+			err:  fmt.Errorf("build %s is no longer %s", build.ID, previous),
+		})
+	}
+
+	return nil
+}
+
+func scanBuild(row pgx.Row) (*types.Build, error) {
+	var build types.Build
+	err := row.Scan(
+		&build.ID,
+		&build.Namespace,
+		&build.Commit,
+		&build.Status,
+		&build.LogsURL,
+		&build.CreatedAt,
+		&build.UpdatedAt,
+		&build.StartedAt,
+		&build.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &build, nil
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// SetCompressedLayer records the compressed copy which replaces the layer, it fails once the layer is deleted.
+// It's done in a savepoint so that a failure doesn't abort the txn
+func (p *pg) SetCompressedLayer(ctx context.Context, txn pgx.Tx, l *types.CompressedLayer) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	savepoint, err := txn.Begin(childCtx)
+	if err != nil {
+		return fmt.Errorf("ERR_SET_COMPRESSED_LAYER: %w", err)
+	}
+
+	_, err = savepoint.Exec(
+		childCtx,
+		queries.SetCompressedLayer,
+		l.Digest,
+		l.CompressedDigest,
+		l.UUID,
+		l.DFSLink,
+		l.Encoding,
+		l.Size,
+		l.CreatedAt,
+	)
+	if err != nil {
+		_ = savepoint.Rollback(childCtx)
+		return fmt.Errorf("ERR_SET_COMPRESSED_LAYER: %w", err)
+	}
+
+	return savepoint.Commit(childCtx)
+}
+
+// GetCompressedLayer returns pgx.ErrNoRows when the layer is stored as it was pushed
+func (p *pg) GetCompressedLayer(ctx context.Context, digest string) (*types.CompressedLayer, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var l types.CompressedLayer
+	err := p.conn.QueryRow(childCtx, queries.GetCompressedLayer, digest).Scan(
+		&l.Digest,
+		&l.CompressedDigest,
+		&l.UUID,
+		&l.DFSLink,
+		&l.Encoding,
+		&l.Size,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ERR_GET_COMPRESSED_LAYER: %w", err)
+	}
+
+	return &l, nil
+}
@@ -14,7 +14,7 @@ import (
 )
 
 func (p *pg) GetLayer(ctx context.Context, digest string) (*types.LayerV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	row := p.conn.QueryRow(childCtx, queries.GetLayer, digest)
@@ -29,15 +29,37 @@ func (p *pg) GetLayer(ctx context.Context, digest string) (*types.LayerV2, error
 		&layer.CreatedAt,
 		&layer.UpdatedAt,
 	); err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
 
 	return &layer, nil
 
 }
 
+func (p *pg) GetExistingLayers(ctx context.Context, digests []string) ([]string, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetExistingLayers, digests)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_EXISTING_LAYERS: %w", classify(err))
+	}
+	defer rows.Close()
+
+	existing := []string{}
+	for rows.Next() {
+		var dig string
+		if err = rows.Scan(&dig); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_EXISTING_LAYER: %w", err)
+		}
+		existing = append(existing, dig)
+	}
+
+	return existing, rows.Err()
+}
+
 func (p *pg) GetContentHashById(ctx context.Context, uuid string) (string, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	var contentHash string
@@ -50,7 +72,7 @@ func (p *pg) GetContentHashById(ctx context.Context, uuid string) (string, error
 }
 
 func (p *pg) SetLayer(ctx context.Context, txn pgx.Tx, l *types.LayerV2) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	_, err := txn.Exec(
@@ -70,7 +92,7 @@ func (p *pg) SetLayer(ctx context.Context, txn pgx.Tx, l *types.LayerV2) error {
 }
 
 func (p *pg) GetManifest(ctx context.Context, namespace string) (*types.ImageManifestV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	row := p.conn.QueryRow(childCtx, queries.GetManifest, namespace)
@@ -83,12 +105,12 @@ func (p *pg) GetManifest(ctx context.Context, namespace string) (*types.ImageMan
 		&im.CreatedAt,
 		&im.UpdatedAt,
 	); err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
 	return &im, nil
 }
 func (p *pg) GetManifestByReference(ctx context.Context, namespace string, ref string) (*types.ConfigV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	query := queries.GetManifestByRef
@@ -109,6 +131,9 @@ func (p *pg) GetManifestByReference(ctx context.Context, namespace string, ref s
 		&im.Size,
 		&im.CreatedAt,
 		&im.UpdatedAt,
+		&im.ConfigDigest,
+		&im.ConfigSize,
+		&im.ArtifactType,
 	); err != nil {
 		return nil, err
 	}
@@ -116,7 +141,7 @@ func (p *pg) GetManifestByReference(ctx context.Context, namespace string, ref s
 }
 
 func (p *pg) SetManifest(ctx context.Context, txn pgx.Tx, im *types.ImageManifestV2) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	_, err := txn.Exec(
@@ -135,7 +160,7 @@ func (p *pg) SetManifest(ctx context.Context, txn pgx.Tx, im *types.ImageManifes
 
 func (p *pg) GetBlob(ctx context.Context, digest string) ([]*types.Blob, error) {
 
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	rows, err := p.conn.Query(childCtx, queries.GetBlob, digest)
@@ -165,7 +190,7 @@ func (p *pg) GetBlob(ctx context.Context, digest string) ([]*types.Blob, error)
 }
 
 func (p *pg) SetBlob(ctx context.Context, txn pgx.Tx, b *types.Blob) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	_, err := txn.Exec(childCtx, queries.SetBlob, b.UUID, b.Digest, b.Skylink, b.RangeStart, b.RangeEnd, b.CreatedAt)
@@ -175,7 +200,7 @@ func (p *pg) SetBlob(ctx context.Context, txn pgx.Tx, b *types.Blob) error {
 }
 
 func (p *pg) GetConfig(ctx context.Context, namespace string) ([]*types.ConfigV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	rows, err := p.conn.Query(childCtx, queries.GetConfig, namespace)
@@ -198,6 +223,9 @@ func (p *pg) GetConfig(ctx context.Context, namespace string) ([]*types.ConfigV2
 			&cfg.Size,
 			&cfg.CreatedAt,
 			&cfg.UpdatedAt,
+			&cfg.ConfigDigest,
+			&cfg.ConfigSize,
+			&cfg.ArtifactType,
 		); err != nil {
 			return nil, err
 		}
@@ -208,7 +236,7 @@ func (p *pg) GetConfig(ctx context.Context, namespace string) ([]*types.ConfigV2
 	return cfgList, nil
 }
 func (p *pg) GetImageTags(ctx context.Context, namespace string) ([]string, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	rows, err := p.conn.Query(childCtx, queries.GetImageTags, namespace)
@@ -231,7 +259,7 @@ func (p *pg) GetImageTags(ctx context.Context, namespace string) ([]string, erro
 }
 
 func (p *pg) SetConfig(ctx context.Context, txn pgx.Tx, cfg types.ConfigV2) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	if _, err := txn.Exec(
@@ -247,6 +275,9 @@ func (p *pg) SetConfig(ctx context.Context, txn pgx.Tx, cfg types.ConfigV2) erro
 		cfg.Size,
 		cfg.CreatedAt,
 		cfg.UpdatedAt,
+		cfg.ConfigDigest,
+		cfg.ConfigSize,
+		cfg.ArtifactType,
 	); err != nil {
 		return err
 	}
@@ -254,7 +285,7 @@ func (p *pg) SetConfig(ctx context.Context, txn pgx.Tx, cfg types.ConfigV2) erro
 }
 
 func (p *pg) GetCatalogCount(ctx context.Context, ns string) (int64, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 	var count int64
 
@@ -275,102 +306,81 @@ func (p *pg) GetCatalogCount(ctx context.Context, ns string) (int64, error) {
 
 }
 
-func (p *pg) GetCatalog(ctx context.Context, ns string, pageSize, offset int64) ([]string, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+// GetCatalog lists the repositories the viewer (a username, empty for anonymous requests) can pull, all of
+// them when pageSize is 0. The total is the number of repositories visible to the viewer
+func (p *pg) GetCatalog(ctx context.Context, viewer, ns string, pageSize, offset int64) ([]string, int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
-	var rows pgx.Rows
-	var err error
-
+	var limit interface{}
 	if pageSize != 0 {
-		rows, err = p.conn.Query(childCtx, queries.GetCatalogWithPagination, pageSize, offset)
-		if err != nil {
-			err = fmt.Errorf("ERR_CATALOG_WITH_PAGINATION: %w", err)
-		}
-	} else {
-		rows, err = p.conn.Query(childCtx, queries.GetCatalog)
-		if err != nil {
-			err = fmt.Errorf("ERR_CATALOG: %w", err)
-		}
+		limit = pageSize
 	}
-	if ns != "" {
-		rows, err = p.conn.Query(childCtx, queries.GetUserCatalogWithPagination, ns+"/%", pageSize, offset)
-		if err != nil {
-			err = fmt.Errorf("ERR_USER_CATALOG: %w", err)
-		}
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
 
+	var total int64
 	var repositories []string
-	for i := 0; rows.Next(); i++ {
-		var repo string
-		if err := rows.Scan(&repo); err != nil {
-			return nil, err
-		}
-
-		repositories = append(repositories, repo)
+	row := p.conn.QueryRow(childCtx, queries.GetCatalog, viewer, catalogPattern(ns), limit, offset)
+	if err := row.Scan(&total, &repositories); err != nil {
+		return nil, 0, fmt.Errorf("ERR_CATALOG: %w", err)
 	}
 
-	return repositories, nil
+	return repositories, total, nil
 }
 
-// GetCatalogDetail - ns -> Namespace; ps -> PageSize
+// GetCatalogDetail - ns -> Namespace; ps -> PageSize. Only the repositories the viewer can pull are listed
 func (p *pg) GetCatalogDetail(
-	ctx context.Context, ns string, ps, offset int64, sortBy string,
-) ([]*types.ImageManifestV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx context.Context, viewer, ns string, ps, offset int64, sortBy string,
+) ([]*types.ImageManifestV2, int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
-	var rows pgx.Rows
-	var err error
 	pageSize := int64(10)
 	if ps > 0 {
 		pageSize = ps
 	}
 
-	if ns != "" {
-		q := fmt.Sprintf(queries.GetUserCatalogDetailWithPagination, sortBy)
-		rows, err = p.conn.Query(childCtx, q, ns+"/%", ps, offset)
-		if err != nil {
-			err = fmt.Errorf("ERR_USER_CATALOG: %w", err)
-		}
-	} else {
-		q := fmt.Sprintf(queries.GetCatalogDetailWithPagination, sortBy)
-		rows, err = p.conn.Query(childCtx, q, pageSize, offset)
-		if err != nil {
-			err = fmt.Errorf("ERR_CATALOG_WITH_PAGINATION: %w", err)
-		}
-	}
-
+	q := fmt.Sprintf(queries.GetCatalogDetailWithPagination, sortBy)
+	rows, err := p.conn.Query(childCtx, q, viewer, catalogPattern(ns), pageSize, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, fmt.Errorf("ERR_CATALOG_WITH_PAGINATION: %w", err)
 	}
 	defer rows.Close()
 
-	var catalog []*types.ImageManifestV2
+	var total int64
+	catalog := []*types.ImageManifestV2{}
 	for i := 0; rows.Next(); i++ {
-		var mf types.ImageManifestV2
+		var namespace *string
+		var createdAt, updatedAt *time.Time
 
-		if err := rows.Scan(
-			&mf.Namespace,
-			&mf.CreatedAt,
-			&mf.UpdatedAt,
-		); err != nil {
-			return nil, err
+		if err := rows.Scan(&namespace, &createdAt, &updatedAt, &total); err != nil {
+			return nil, 0, err
+		}
+		// the page is empty
+		if namespace == nil {
+			continue
 		}
 
-		catalog = append(catalog, &mf)
+		catalog = append(catalog, &types.ImageManifestV2{
+			Namespace: *namespace,
+			CreatedAt: *createdAt,
+			UpdatedAt: *updatedAt,
+		})
 	}
 
-	return catalog, nil
+	return catalog, total, nil
+}
+
+// catalogPattern matches the repositories of the user ns, or every repository
+func catalogPattern(ns string) string {
+	if ns == "" {
+		return "%"
+	}
+
+	return ns + "/%"
 }
 
 func (p *pg) GetRepoDetail(ctx context.Context, ns string, pageSize, offset int64) (*types.Repository, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
 	var rows pgx.Rows
@@ -418,7 +428,7 @@ func (p *pg) GetRepoDetail(ctx context.Context, ns string, pageSize, offset int6
 }
 
 func (p *pg) DeleteLayerV2(ctx context.Context, txn pgx.Tx, digest string) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	if _, err := txn.Exec(childCtx, queries.DeleteLayer, digest); err != nil {
@@ -428,7 +438,7 @@ func (p *pg) DeleteLayerV2(ctx context.Context, txn pgx.Tx, digest string) error
 }
 
 func (p *pg) DeleteBlobV2(ctx context.Context, txn pgx.Tx, digest string) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	if _, err := txn.Exec(childCtx, queries.DeleteBlob, digest); err != nil {
@@ -437,40 +447,193 @@ func (p *pg) DeleteBlobV2(ctx context.Context, txn pgx.Tx, digest string) error
 	return nil
 }
 
-func (p *pg) DeleteManifestOrTag(ctx context.Context, txn pgx.Tx, reference string) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+func (p *pg) DeleteTag(ctx context.Context, txn pgx.Tx, namespace, tag string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
-	query := queries.DeleteManifestByRef
-	if strings.HasPrefix(reference, "sha256") {
-		query = queries.DeleteManifestByDig
+
+	result, err := txn.Exec(childCtx, queries.DeleteTag, namespace, tag)
+	if err != nil {
+		return fmt.Errorf("ERR_DELETE_TAG: %w", err)
 	}
-	if _, err := txn.Exec(childCtx, query, reference); err != nil {
-		return err
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_TAG_NOT_FOUND: %s:%s", namespace, tag)
 	}
+
+	return nil
+}
+
+func (p *pg) DeleteManifest(ctx context.Context, txn pgx.Tx, namespace, digest string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	result, err := txn.Exec(childCtx, queries.DeleteManifestByDigest, namespace, digest)
+	if err != nil {
+		return fmt.Errorf("ERR_DELETE_MANIFEST: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_MANIFEST_NOT_FOUND: %s@%s", namespace, digest)
+	}
+
 	return nil
 }
 
+// GetTagsByDigest returns the tags pointing to the manifest, the reference of a manifest pushed by digest isn't a tag
+func (p *pg) GetTagsByDigest(ctx context.Context, txn pgx.Tx, namespace, digest string) ([]string, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := txn.Query(childCtx, queries.GetTagsByDigest, namespace, digest)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_TAGS_BY_DIGEST: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_TAGS_BY_DIGEST: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (p *pg) HasManifestLists(ctx context.Context, txn pgx.Tx, namespace string, mediaTypes []string) (bool, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var exists bool
+	if err := txn.QueryRow(childCtx, queries.HasManifestLists, namespace, mediaTypes).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ERR_HAS_MANIFEST_LISTS: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (p *pg) GetTagsByPushTime(ctx context.Context, txn pgx.Tx, namespace string) ([]string, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := txn.Query(childCtx, queries.GetTagsByPushTime, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_TAGS_BY_PUSH_TIME: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_TAGS_BY_PUSH_TIME: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (p *pg) DeleteTags(ctx context.Context, txn pgx.Tx, namespace string, tags []string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if _, err := txn.Exec(childCtx, queries.DeleteTags, namespace, tags); err != nil {
+		return fmt.Errorf("ERR_DELETE_TAGS: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) GetLayerReferenceCount(ctx context.Context, txn pgx.Tx, digest string) (int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var count int64
+	if err := txn.QueryRow(childCtx, queries.GetLayerReferenceCount, digest).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ERR_GET_LAYER_REFERENCE_COUNT: %w", err)
+	}
+
+	return count, nil
+}
+
+func (p *pg) GetManifestReferenceCount(ctx context.Context, txn pgx.Tx, digest string) (int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var count int64
+	if err := txn.QueryRow(childCtx, queries.GetManifestReferenceCount, digest).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ERR_GET_MANIFEST_REFERENCE_COUNT: %w", err)
+	}
+
+	return count, nil
+}
+
+func (p *pg) RepositoryHasLayer(ctx context.Context, namespace, digest string) (bool, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var exists bool
+	if err := p.conn.QueryRow(childCtx, queries.RepositoryHasLayer, namespace, digest).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ERR_REPOSITORY_HAS_LAYER: %w", classify(err))
+	}
+
+	return exists, nil
+}
+
+func (p *pg) RepositoryExists(ctx context.Context, namespace string) (bool, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var exists bool
+	if err := p.conn.QueryRow(childCtx, queries.RepositoryExists, namespace).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ERR_REPOSITORY_EXISTS: %w", classify(err))
+	}
+
+	return exists, nil
+}
+
+// NewTxn only uses ctx to begin the txn, which can outlive the request that began it, e.g. the txn of an upload.
+// Abort and Commit don't use their ctx, so that a cancelled request still ends its txn
 func (p *pg) NewTxn(ctx context.Context) (pgx.Tx, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute*10)
 	defer cancel()
 
 	return p.conn.Begin(childCtx)
 }
 
+// Abort and Commit finish the transaction even when the request which ends it is cancelled, e.g. the client went
+// away after the blob was uploaded, so they only keep the values of ctx
 func (p *pg) Abort(ctx context.Context, txn pgx.Tx) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	childCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, time.Minute*10)
 	defer cancel()
 
 	return txn.Rollback(childCtx)
 }
 
 func (p *pg) Commit(ctx context.Context, txn pgx.Tx) error {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	childCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, time.Minute*10)
 	defer cancel()
 
 	return txn.Commit(childCtx)
 }
 
+// detachedContext has the values of its parent, e.g. the trace span of the request, without its deadline and
+// cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
 func (p *pg) Metadata(ctx echo.Context) error {
 	rows, err := p.conn.Query(ctx.Request().Context(), "select uuid, namespace from image_manifest")
 	if err != nil {
@@ -492,7 +655,7 @@ func (p *pg) Metadata(ctx echo.Context) error {
 }
 
 func (p *pg) GetImageNamespace(ctx context.Context, search string) ([]*types.ImageManifestV2, error) {
-	childCtx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute*30)
 	defer cancel()
 	rows, err := p.conn.Query(childCtx, queries.GetImageNamespace, "%"+search+"%")
 	if err != nil {
@@ -515,3 +678,84 @@ func (p *pg) GetImageNamespace(ctx context.Context, search string) ([]*types.Ima
 	}
 	return result, nil
 }
+
+// GetAllConfigs returns the namespace, reference, digest and layers of every manifest in the registry
+func (p *pg) GetAllConfigs(ctx context.Context) ([]*types.ConfigV2, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetAllConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_QUERY_GET_ALL_CONFIGS: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []*types.ConfigV2
+	for rows.Next() {
+		var cfg types.ConfigV2
+		if err := rows.Scan(&cfg.Namespace, &cfg.Reference, &cfg.Digest, &cfg.Layers); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_ALL_CONFIGS: %w", err)
+		}
+		configs = append(configs, &cfg)
+	}
+
+	return configs, nil
+}
+
+// GetLayersCreatedBefore returns the uuid, digest and blobs of every layer created before t
+func (p *pg) GetLayersCreatedBefore(ctx context.Context, t time.Time) ([]*types.LayerV2, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetLayersCreatedBefore, t)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_QUERY_GET_LAYERS_CREATED_BEFORE: %w", err)
+	}
+	defer rows.Close()
+
+	var layers []*types.LayerV2
+	for rows.Next() {
+		var layer types.LayerV2
+		if err := rows.Scan(&layer.UUID, &layer.Digest, &layer.BlobDigests, &layer.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_LAYERS_CREATED_BEFORE: %w", err)
+		}
+		layers = append(layers, &layer)
+	}
+
+	return layers, nil
+}
+
+// GetRepositoryVisibility returns the visibility of the repository, repositories which don't exist yet are public
+func (p *pg) GetRepositoryVisibility(ctx context.Context, namespace string) (types.RepositoryVisibility, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var visibility types.RepositoryVisibility
+	err := p.conn.QueryRow(childCtx, queries.GetRepositoryVisibility, namespace).Scan(&visibility)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return types.RepositoryVisibilityPublic, nil
+		}
+		return "", fmt.Errorf("ERR_GET_REPOSITORY_VISIBILITY: %w", err)
+	}
+
+	return visibility, nil
+}
+
+func (p *pg) SetRepositoryVisibility(
+	ctx context.Context, namespace string, visibility types.RepositoryVisibility,
+) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	result, err := p.conn.Exec(childCtx, queries.SetRepositoryVisibility, visibility, time.Now(), namespace)
+	if err != nil {
+		return fmt.Errorf("ERR_SET_REPOSITORY_VISIBILITY: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_REPOSITORY_NOT_FOUND: %s", namespace)
+	}
+
+	return nil
+}
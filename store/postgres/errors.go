@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Handlers use errors.Is with these to pick the status code, the original pg error stays in the chain too
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	ErrTimeout  = errors.New("timeout")
+)
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation
+const uniqueViolation = "23505"
+
+// storeError matches its kind with errors.Is and unwraps to the pg error
+type storeError struct {
+	kind error
+	err  error
+}
+
+func (e *storeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *storeError) Unwrap() error {
+	return e.err
+}
+
+func (e *storeError) Is(target error) bool {
+	return target == e.kind
+}
+
+// classify marks the errors handlers care about with ErrNotFound, ErrConflict or ErrTimeout,
+// every other error is returned as is
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return &storeError{kind: ErrNotFound, err: err}
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return &storeError{kind: ErrConflict, err: err}
+	case errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err):
+		return &storeError{kind: ErrTimeout, err: err}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestClassify(t *testing.T) {
+	duplicate := &pgconn.PgError{Code: uniqueViolation, Message: "duplicate key value violates unique constraint"}
+	other := &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no rows", err: pgx.ErrNoRows, want: ErrNotFound},
+		{name: "wrapped no rows", err: fmt.Errorf("ERR_GET_USER: %w", pgx.ErrNoRows), want: ErrNotFound},
+		{name: "unique violation", err: duplicate, want: ErrConflict},
+		{name: "deadline", err: context.DeadlineExceeded, want: ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		err := classify(tt.err)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want it to match %v", tt.name, err, tt.want)
+		}
+		// the pg error is still in the chain
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want it to unwrap to %v", tt.name, err, tt.err)
+		}
+		if err.Error() != tt.err.Error() {
+			t.Errorf("%s: got message %q, want %q", tt.name, err.Error(), tt.err.Error())
+		}
+		for _, kind := range []error{ErrNotFound, ErrConflict, ErrTimeout} {
+			if kind != tt.want && errors.Is(err, kind) {
+				t.Errorf("%s: got %v matching %v too", tt.name, err, kind)
+			}
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if err := classify(duplicate); !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		t.Errorf("got %v, want the pg error through errors.As", err)
+	}
+
+	if err := classify(other); err != other {
+		t.Errorf("got %v, want the other pg errors as they are", err)
+	}
+	if err := classify(nil); err != nil {
+		t.Errorf("got %v for no error", err)
+	}
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/fatih/color"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// schema_migrations uses the same layout as golang-migrate, so databases migrated with the migrate cli
+// (see Makefile) can be upgraded with Migrate and vice versa
+const (
+	createSchemaMigrations = `create table if not exists schema_migrations (version bigint not null primary key,
+dirty boolean not null);`
+	getSchemaVersion   = `select version, dirty from schema_migrations limit 1;`
+	clearSchemaVersion = `delete from schema_migrations;`
+	setSchemaVersion   = `insert into schema_migrations (version, dirty) values ($1, $2);`
+)
+
+type migration struct {
+	up      string
+	down    string
+	version uint64
+}
+
+// Migrate applies all the pending up migrations found in migrations, in the order of their version.
+// Migration files must be named <version>_<title>.up.sql and <version>_<title>.down.sql.
+// It returns the schema version after migrating.
+func Migrate(ctx context.Context, cfg *config.Store, migrations fs.FS) (uint64, error) {
+	return runMigrations(ctx, cfg, migrations, func(conn *pgxpool.Pool, all []migration, current uint64) (uint64, error) {
+		for _, m := range all {
+			if m.version <= current {
+				continue
+			}
+
+			if err := applyMigration(ctx, conn, migrations, m.up, m.version, true); err != nil {
+				return current, err
+			}
+			current = m.version
+			color.Green("applied migration: %s", m.up)
+		}
+
+		return current, nil
+	})
+}
+
+// MigrateDown rolls back the last steps applied migrations. It returns the schema version after rolling back,
+// zero means that all the migrations were rolled back
+func MigrateDown(ctx context.Context, cfg *config.Store, migrations fs.FS, steps int) (uint64, error) {
+	return runMigrations(ctx, cfg, migrations, func(conn *pgxpool.Pool, all []migration, current uint64) (uint64, error) {
+		for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+			m := all[i]
+			if m.version > current {
+				continue
+			}
+
+			var previous uint64
+			if i > 0 {
+				previous = all[i-1].version
+			}
+
+			if err := applyMigration(ctx, conn, migrations, m.down, previous, previous != 0); err != nil {
+				return current, err
+			}
+			current = previous
+			steps--
+			color.Yellow("rolled back migration: %s", m.down)
+		}
+
+		return current, nil
+	})
+}
+
+// CheckSchema returns an error unless all the migrations found in migrations are applied, e.g. when the server
+// starts against a database which was never migrated
+func CheckSchema(ctx context.Context, cfg *config.Store, migrations fs.FS) error {
+	_, err := runMigrations(ctx, cfg, migrations, func(_ *pgxpool.Pool, all []migration, current uint64) (uint64, error) {
+		if len(all) > 0 && all[len(all)-1].version > current {
+			return current, fmt.Errorf(
+				"ERR_SCHEMA_OUTDATED: schema is at version %d, expected %d, run the migrate command or enable "+
+					"auto_migrate", current, all[len(all)-1].version,
+			)
+		}
+
+		return current, nil
+	})
+	return err
+}
+
+func runMigrations(
+	ctx context.Context,
+	cfg *config.Store,
+	migrations fs.FS,
+	run func(conn *pgxpool.Pool, all []migration, current uint64) (uint64, error),
+) (uint64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	conn, err := pgxpool.Connect(childCtx, cfg.Endpoint())
+	if err != nil {
+		return 0, fmt.Errorf("ERR_MIGRATE_CONNECT: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Exec(childCtx, createSchemaMigrations); err != nil {
+		return 0, fmt.Errorf("ERR_CREATE_SCHEMA_MIGRATIONS: %w", err)
+	}
+
+	var current uint64
+	var dirty bool
+	err = conn.QueryRow(childCtx, getSchemaVersion).Scan(&current, &dirty)
+	if err != nil && err != pgx.ErrNoRows {
+		return 0, fmt.Errorf("ERR_GET_SCHEMA_VERSION: %w", err)
+	}
+	if dirty {
+		return current, fmt.Errorf("ERR_DIRTY_SCHEMA: version %d is dirty, fix it manually before migrating", current)
+	}
+
+	all, err := listMigrations(migrations)
+	if err != nil {
+		return current, err
+	}
+
+	return run(conn, all, current)
+}
+
+// applyMigration runs the migration file and records the new schema version in the same transaction,
+// when setVersion is false, the schema_migrations table is left empty (everything rolled back)
+func applyMigration(
+	ctx context.Context, conn *pgxpool.Pool, migrations fs.FS, name string, version uint64, setVersion bool,
+) error {
+	if name == "" {
+		return fmt.Errorf("ERR_MISSING_MIGRATION: no migration file for version %d", version)
+	}
+
+	bz, err := fs.ReadFile(migrations, name)
+	if err != nil {
+		return fmt.Errorf("ERR_READ_MIGRATION: %w", err)
+	}
+
+	txn, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ERR_MIGRATION_TXN: %w", err)
+	}
+	defer txn.Rollback(ctx) //nolint
+
+	if _, err = txn.Exec(ctx, string(bz)); err != nil {
+		return fmt.Errorf("ERR_APPLY_MIGRATION: %s: %w", name, err)
+	}
+
+	if _, err = txn.Exec(ctx, clearSchemaVersion); err != nil {
+		return fmt.Errorf("ERR_CLEAR_SCHEMA_VERSION: %w", err)
+	}
+
+	if setVersion {
+		if _, err = txn.Exec(ctx, setSchemaVersion, version, false); err != nil {
+			return fmt.Errorf("ERR_SET_SCHEMA_VERSION: %w", err)
+		}
+	}
+
+	return txn.Commit(ctx)
+}
+
+// listMigrations returns all the migrations, sorted by version
+func listMigrations(migrations fs.FS) ([]migration, error) {
+	files, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("ERR_LIST_MIGRATIONS: %w", err)
+	}
+
+	byVersion := make(map[uint64]*migration)
+	for _, name := range files {
+		version, err := strconv.ParseUint(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_INVALID_MIGRATION_NAME: %s: %w", name, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			m.up = name
+		case strings.HasSuffix(name, ".down.sql"):
+			m.down = name
+		default:
+			return nil, fmt.Errorf("ERR_INVALID_MIGRATION_NAME: %s: must end with .up.sql or .down.sql", name)
+		}
+	}
+
+	all := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		all = append(all, *m)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].version < all[j].version
+	})
+
+	return all, nil
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/containerish/OpenRegistry/db"
+)
+
+func TestListMigrations(t *testing.T) {
+	migrations := fstest.MapFS{
+		"000010_add_index.up.sql":       {Data: []byte("create index;")},
+		"000010_add_index.down.sql":     {Data: []byte("drop index;")},
+		"000002_create_table.up.sql":    {Data: []byte("create table;")},
+		"000002_create_table.down.sql":  {Data: []byte("drop table;")},
+		"000001_create_schema.up.sql":   {Data: []byte("create schema;")},
+		"000001_create_schema.down.sql": {Data: []byte("drop schema;")},
+		"README.md":                     {Data: []byte("not a migration")},
+	}
+
+	all, err := listMigrations(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []migration{
+		{version: 1, up: "000001_create_schema.up.sql", down: "000001_create_schema.down.sql"},
+		{version: 2, up: "000002_create_table.up.sql", down: "000002_create_table.down.sql"},
+		{version: 10, up: "000010_add_index.up.sql", down: "000010_add_index.down.sql"},
+	}
+	if len(all) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(all), len(want))
+	}
+	for i := range want {
+		if all[i] != want[i] {
+			t.Errorf("migration %d: got %+v, want %+v", i, all[i], want[i])
+		}
+	}
+}
+
+func TestListMigrationsInvalidName(t *testing.T) {
+	tests := map[string]string{
+		"unversioned":  "create_table.up.sql",
+		"no direction": "000001_create_table.sql",
+	}
+
+	for name, file := range tests {
+		_, err := listMigrations(fstest.MapFS{file: {Data: []byte("select 1;")}})
+		if err == nil || !strings.HasPrefix(err.Error(), "ERR_INVALID_MIGRATION_NAME") {
+			t.Errorf("%s: got error %v, want ERR_INVALID_MIGRATION_NAME", name, err)
+		}
+	}
+}
+
+// TestEmbeddedMigrations checks that every embedded migration can be rolled back, and that the versions follow each
+// other, so that MigrateDown steps back one version at a time
+func TestEmbeddedMigrations(t *testing.T) {
+	all, err := listMigrations(db.Migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+
+	for i, m := range all {
+		if m.up == "" || m.down == "" {
+			t.Errorf("version %d: got up %q and down %q, want both", m.version, m.up, m.down)
+		}
+		if m.version != uint64(i+1) {
+			t.Errorf("got version %d at position %d, want %d", m.version, i, i+1)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+// CreateOrganization creates the organization with the user as its owner, it returns ErrConflict when a user or
+// another organization has the name already
+func (p *pg) CreateOrganization(ctx context.Context, org *types.Organization, owner *types.User) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	txn, err := p.conn.Begin(childCtx)
+	if err != nil {
+		return fmt.Errorf("ERR_CREATE_ORGANIZATION_TXN: %w", err)
+	}
+	defer txn.Rollback(childCtx) //nolint
+
+	tag, err := txn.Exec(childCtx, queries.CreateOrganization, org.Name, org.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ERR_CREATE_ORGANIZATION: %w", classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_CREATE_ORGANIZATION: a user named %s exists: %w", org.Name, ErrConflict)
+	}
+
+	_, err = txn.Exec(
+		childCtx, queries.SetOrganizationMember, org.Name, owner.Id, types.OrganizationRoleOwner, org.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("ERR_ADD_ORGANIZATION_OWNER: %w", err)
+	}
+
+	if err = txn.Commit(childCtx); err != nil {
+		return fmt.Errorf("ERR_CREATE_ORGANIZATION_COMMIT: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) GetOrganization(ctx context.Context, name string) (*types.Organization, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var org types.Organization
+	if err := p.conn.QueryRow(childCtx, queries.GetOrganization, name).Scan(&org.Name, &org.CreatedAt); err != nil {
+		return nil, fmt.Errorf("ERR_GET_ORGANIZATION: %w", classify(err))
+	}
+
+	return &org, nil
+}
+
+// SetOrganizationMember adds the user to the organization, or changes their role if they're a member already
+func (p *pg) SetOrganizationMember(ctx context.Context, org, userId string, role types.OrganizationRole) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if _, err := p.conn.Exec(childCtx, queries.SetOrganizationMember, org, userId, role, time.Now()); err != nil {
+		return fmt.Errorf("ERR_SET_ORGANIZATION_MEMBER: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) DeleteOrganizationMember(ctx context.Context, org, userId string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	tag, err := p.conn.Exec(childCtx, queries.DeleteOrganizationMember, org, userId)
+	if err != nil {
+		return fmt.Errorf("ERR_DELETE_ORGANIZATION_MEMBER: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_DELETE_ORGANIZATION_MEMBER: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+func (p *pg) GetOrganizationMembers(ctx context.Context, org string) ([]*types.OrganizationMember, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetOrganizationMembers, org)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_ORGANIZATION_MEMBERS: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*types.OrganizationMember{}
+	for rows.Next() {
+		var m types.OrganizationMember
+		if err = rows.Scan(&m.UserId, &m.Username, &m.Role, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_ORGANIZATION_MEMBER: %w", err)
+		}
+
+		members = append(members, &m)
+	}
+
+	return members, nil
+}
+
+// GetOrganizationRole returns ErrNotFound when the user isn't a member of the organization, or when the
+// organization doesn't exist
+func (p *pg) GetOrganizationRole(ctx context.Context, org, username string) (types.OrganizationRole, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var role types.OrganizationRole
+	if err := p.conn.QueryRow(childCtx, queries.GetOrganizationRole, org, username).Scan(&role); err != nil {
+		return "", fmt.Errorf("ERR_GET_ORGANIZATION_ROLE: %w", classify(err))
+	}
+
+	return role, nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/telemetry/tracing"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/fatih/color"
 	"github.com/jackc/pgx/v4"
@@ -15,12 +16,100 @@ type PersistentStore interface {
 	UserStore
 	RegistryStore
 	SessionStore
+	AuditStore
+	WebhookStore
+	QuotaStore
+	UploadSessionStore
+	StatsStore
+	CompressionStore
+	RetentionStore
+	OrganizationStore
+	BuildStore
 	Close()
 }
 
+type BuildStore interface {
+	CreateBuild(ctx context.Context, build *types.Build) error
+	// GetBuild returns ErrNotFound when the repository has no build with the id
+	GetBuild(ctx context.Context, namespace, id string) (*types.Build, error)
+	// GetBuilds returns the last limit builds of the repository, most recent first, only the ones with the status
+	// when it's set
+	GetBuilds(ctx context.Context, namespace string, status types.BuildStatus, limit int) ([]*types.Build, error)
+	// UpdateBuildStatus stores the status, logs link and times of the build. It returns ErrConflict when the build
+	// isn't in the previous status anymore, i.e. it was updated concurrently
+	UpdateBuildStatus(ctx context.Context, build *types.Build, previous types.BuildStatus) error
+}
+
+type OrganizationStore interface {
+	CreateOrganization(ctx context.Context, org *types.Organization, owner *types.User) error
+	GetOrganization(ctx context.Context, name string) (*types.Organization, error)
+	SetOrganizationMember(ctx context.Context, org, userId string, role types.OrganizationRole) error
+	DeleteOrganizationMember(ctx context.Context, org, userId string) error
+	GetOrganizationMembers(ctx context.Context, org string) ([]*types.OrganizationMember, error)
+	GetOrganizationRole(ctx context.Context, org, username string) (types.OrganizationRole, error)
+}
+
+type RetentionStore interface {
+	SetRetentionPolicy(ctx context.Context, policy *types.RetentionPolicy) error
+	// GetRetentionPolicy returns ErrNotFound when the repository has no policy
+	GetRetentionPolicy(ctx context.Context, namespace string) (*types.RetentionPolicy, error)
+	GetRetentionPolicies(ctx context.Context) ([]*types.RetentionPolicy, error)
+	DeleteRetentionPolicy(ctx context.Context, namespace string) error
+	// GetReferencesByPushTime returns the tags and digest references of the repository, most recently pushed
+	// first. The rows stay locked until the txn is done
+	GetReferencesByPushTime(ctx context.Context, txn pgx.Tx, namespace string) ([]*types.ConfigV2, error)
+}
+
+type CompressionStore interface {
+	SetCompressedLayer(ctx context.Context, txn pgx.Tx, l *types.CompressedLayer) error
+	GetCompressedLayer(ctx context.Context, digest string) (*types.CompressedLayer, error)
+}
+
+type StatsStore interface {
+	AddRepositoryStats(ctx context.Context, stats []*types.RepositoryStats) error
+	GetRepositoryStats(ctx context.Context, namespace string) (*types.RepositoryStats, error)
+}
+
+type UploadSessionStore interface {
+	SaveUploadSession(ctx context.Context, session *types.UploadSession) error
+	// AppendUploadSessionParts saves the session like SaveUploadSession, except that its parts are appended to the
+	// stored ones rather than replacing them
+	AppendUploadSessionParts(ctx context.Context, session *types.UploadSession) error
+	GetUploadSessionParts(ctx context.Context, uploadID string) ([]types.UploadSessionPart, error)
+	GetUploadSessions(ctx context.Context) ([]*types.UploadSession, error)
+	DeleteUploadSession(ctx context.Context, uploadID string) error
+}
+
+// QuotaStore reports the storage used by the layers stored in a repository (or in all the repositories of a user),
+// whether a manifest references them or not. A layer is stored in the repositories it's pushed to or referenced
+// from, until it's deleted. A nil txn reads outside any transaction
+type QuotaStore interface {
+	// AddNamespaceLayers records the layers as stored in the namespace, the digests which aren't layers are skipped
+	AddNamespaceLayers(ctx context.Context, txn pgx.Tx, namespace string, digests []string) error
+	// LockQuota serializes the quota checks made for key (a namespace or a user) until txn ends
+	LockQuota(ctx context.Context, txn pgx.Tx, key string) error
+	GetNamespaceUsage(ctx context.Context, txn pgx.Tx, namespace string) (int64, error)
+	GetUserUsage(ctx context.Context, txn pgx.Tx, username string) (int64, error)
+}
+
+type WebhookStore interface {
+	AddWebhookDeadLetter(ctx context.Context, dl *types.WebhookDeadLetter) error
+}
+
+type AuditStore interface {
+	AddAuditEvents(ctx context.Context, events []*types.AuditEvent) error
+	GetAuditEvents(
+		ctx context.Context, filter *types.AuditLogFilter, pageSize, offset int64,
+	) ([]*types.AuditEvent, error)
+}
+
 type UserStore interface {
 	AddUser(ctx context.Context, u *types.User) error
+	// AddOAuthUser sets the id of the user it adds
 	AddOAuthUser(ctx context.Context, u *types.User) error
+	GetUserByOAuthIdentity(ctx context.Context, provider string, oauthId int) (*types.User, error)
+	LinkOAuthIdentity(ctx context.Context, userId, provider string, oauthId int) error
+	UnlinkOAuthIdentity(ctx context.Context, userId, provider string) error
 	UserExists(ctx context.Context, id string) bool
 	GetUser(ctx context.Context, identifier string, wihtPassword bool) (*types.User, error)
 	GetUserById(ctx context.Context, userId string, wihtPassword bool) (*types.User, error)
@@ -28,8 +117,14 @@ type UserStore interface {
 	UpdateUser(ctx context.Context, identifier string, u *types.User) error
 	UpdateUserPWD(ctx context.Context, identifier string, newPassword string) error
 	DeleteUser(ctx context.Context, identifier string) error
+	// DeleteUserWithRepositories returns the deleted manifests, one per repository and digest, with their layers
+	DeleteUserWithRepositories(ctx context.Context, txn pgx.Tx, user *types.User) ([]*types.ConfigV2, error)
+	GetUsers(ctx context.Context, search string, pageSize, offset int64) ([]*types.User, int64, error)
+	SetUserActive(ctx context.Context, userId string, active bool) error
+	GrantRole(ctx context.Context, username, role string) error
+	GrantRoleToFirstUser(ctx context.Context, role string) error
 	IsActive(ctx context.Context, identifier string) bool
-	AddSession(ctx context.Context, sessionId, refreshToken, owner string) error
+	AddSession(ctx context.Context, sessionId, refreshToken, owner, userAgent, ipAddress string) error
 	DeleteSession(ctx context.Context, sessionId, userId string) error
 	DeleteAllSessions(ctx context.Context, userId string) error
 	AddVerifyEmail(ctx context.Context, userId, token string) error
@@ -48,25 +143,72 @@ type RegistryStore interface {
 	GetManifest(ctx context.Context, ref string) (*types.ImageManifestV2, error)
 	GetManifestByReference(ctx context.Context, namespace string, ref string) (*types.ConfigV2, error)
 	GetLayer(ctx context.Context, digest string) (*types.LayerV2, error)
+	// GetExistingLayers returns the digests, out of the given ones, which have a layer
+	GetExistingLayers(ctx context.Context, digests []string) ([]string, error)
 	GetContentHashById(ctx context.Context, uuid string) (string, error)
 	GetBlob(ctx context.Context, digest string) ([]*types.Blob, error)
 	GetConfig(ctx context.Context, namespace string) ([]*types.ConfigV2, error)
 	GetImageTags(ctx context.Context, namespace string) ([]string, error)
-	GetCatalog(ctx context.Context, namespace string, pageSize int64, offset int64) ([]string, error)
+	// GetCatalog and GetCatalogDetail only list the public repositories and the private ones owned by the viewer
+	// or their organizations, the viewer is a username (empty for anonymous requests). Both return the total
+	// number of visible repositories
+	GetCatalog(ctx context.Context, viewer, namespace string, pageSize int64, offset int64) ([]string, int64, error)
 	GetCatalogDetail(
-		ctx context.Context, namespace string, pageSize int64, offset int64, sortBy string,
-	) ([]*types.ImageManifestV2, error)
+		ctx context.Context, viewer, namespace string, pageSize int64, offset int64, sortBy string,
+	) ([]*types.ImageManifestV2, int64, error)
 	GetRepoDetail(ctx context.Context, namespace string, pageSize int64, offset int64) (*types.Repository, error)
+	// GetPublicRepositories lists the public repositories only, sortBy is an order by clause
+	GetPublicRepositories(
+		ctx context.Context, sortBy string, pageSize int64, offset int64,
+	) ([]*types.PublicRepository, int64, error)
+	// GetRepositoriesByOwner lists the repositories under the username of the user, publicOnly hides the private
+	// ones. They're sorted by push time, most recent first
+	GetRepositoriesByOwner(
+		ctx context.Context, userID string, publicOnly bool, pageSize int64, offset int64,
+	) ([]*types.PublicRepository, int64, error)
+	// GetPublicRepository returns ErrNotFound for private repositories too, tags are paginated
+	GetPublicRepository(
+		ctx context.Context, namespace string, pageSize int64, offset int64,
+	) (*types.PublicRepository, error)
 	GetCatalogCount(ctx context.Context, ns string) (int64, error)
 	GetImageNamespace(ctx context.Context, search string) ([]*types.ImageManifestV2, error)
 	DeleteLayerV2(ctx context.Context, txn pgx.Tx, digest string) error
 	DeleteBlobV2(ctx context.Context, txn pgx.Tx, digest string) error
-	DeleteManifestOrTag(ctx context.Context, txn pgx.Tx, reference string) error
+	// DeleteTag only removes the tag, the manifest stays pullable by its digest or the other tags
+	DeleteTag(ctx context.Context, txn pgx.Tx, namespace, tag string) error
+	// DeleteManifest removes the manifest, callers must make sure no tags reference it (see GetTagsByDigest)
+	DeleteManifest(ctx context.Context, txn pgx.Tx, namespace, digest string) error
+	GetTagsByDigest(ctx context.Context, txn pgx.Tx, namespace, digest string) ([]string, error)
+	// GetTagsByPushTime returns the tags of the repository, most recently pushed first. The rows stay locked
+	// until the txn is done
+	GetTagsByPushTime(ctx context.Context, txn pgx.Tx, namespace string) ([]string, error)
+	// DeleteTags removes the tags in one statement, references which are digests are never deleted
+	DeleteTags(ctx context.Context, txn pgx.Tx, namespace string, tags []string) error
+	// GetLayerReferenceCount returns the number of manifests (in any repository) which use the blob, as a layer or
+	// as their config
+	GetLayerReferenceCount(ctx context.Context, txn pgx.Tx, digest string) (int64, error)
+	// GetManifestReferenceCount returns the number of tags and digests (in any repository) which use the manifest
+	GetManifestReferenceCount(ctx context.Context, txn pgx.Tx, digest string) (int64, error)
+	// RepositoryHasLayer reports whether a manifest of the repository uses the layer
+	RepositoryHasLayer(ctx context.Context, namespace, digest string) (bool, error)
+	// RepositoryExists reports whether anything was pushed to the repository
+	RepositoryExists(ctx context.Context, namespace string) (bool, error)
+	// GetRepository returns the repository with its tags and manifests, and the config and layers of every image
+	// manifest. It returns ErrNotFound when nothing was pushed to the repository
+	GetRepository(ctx context.Context, namespace string) (*types.Repository, error)
+	// HasManifestLists reports whether the repository has a manifest with one of the given (list) media types
+	HasManifestLists(ctx context.Context, txn pgx.Tx, namespace string, mediaTypes []string) (bool, error)
+	GetAllConfigs(ctx context.Context) ([]*types.ConfigV2, error)
+	GetLayersCreatedBefore(ctx context.Context, t time.Time) ([]*types.LayerV2, error)
+	GetRepositoryVisibility(ctx context.Context, namespace string) (types.RepositoryVisibility, error)
+	SetRepositoryVisibility(ctx context.Context, namespace string, visibility types.RepositoryVisibility) error
 }
 
 type SessionStore interface {
-	AddSession(ctx context.Context, id, refreshToken, username string) error
+	AddSession(ctx context.Context, id, refreshToken, username, userAgent, ipAddress string) error
 	GetSession(ctx context.Context, sessionId string) (*types.Session, error)
+	ListSessions(ctx context.Context, userId string) ([]*types.Session, error)
+	TouchSession(ctx context.Context, refreshToken string) error
 	DeleteSession(ctx context.Context, sessionId, userId string) error
 	DeleteAllSessions(ctx context.Context, userId string) error
 }
@@ -88,6 +230,11 @@ func New(cfg *config.Store) (PersistentStore, error) {
 		return nil, err
 	}
 
+	if tracing.Enabled() {
+		pgxCofig.ConnConfig.Logger = tracing.NewQueryTracer()
+		pgxCofig.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
 	conn, err := pgxpool.ConnectConfig(ctx, pgxCofig)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,10 @@
+//nolint
+package queries
+
+var (
+	AddAuditEvent = `insert into audit_log (actor, action, namespace, reference, source_ip, created_at)
+	values ($1, $2, $3, $4, $5, $6);`
+	GetAuditEvents = `select id, actor, action, namespace, reference, source_ip, created_at::timestamptz from audit_log
+	where ($1 = '' or namespace = $1) and ($2 = '' or actor = $2) and created_at >= $3
+	order by created_at desc limit $4 offset $5;`
+)
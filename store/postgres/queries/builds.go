@@ -0,0 +1,19 @@
+//nolint
+package queries
+
+var (
+	CreateBuild = `insert into builds (id, namespace, commit_sha, status, logs_url, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $6);`
+
+	GetBuild = `select id, namespace, commit_sha, status, logs_url, created_at, updated_at, started_at, finished_at
+	from builds where namespace=$1 and id=$2;`
+
+	// the most recent builds first, $3 is the limit
+	GetBuilds = `select id, namespace, commit_sha, status, logs_url, created_at, updated_at, started_at, finished_at
+	from builds where namespace=$1 and ($2::text='' or status=$2) order by created_at desc limit $3;`
+
+	// the update only applies when the build still has the status it was read with ($4), so that two concurrent
+	// transitions can't both succeed
+	UpdateBuildStatus = `update builds set status=$3, logs_url=$5, updated_at=$6, started_at=$7, finished_at=$8
+	where namespace=$1 and id=$2 and status=$4;`
+)
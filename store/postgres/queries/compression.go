@@ -0,0 +1,11 @@
+//nolint
+package queries
+
+var (
+	SetCompressedLayer = `insert into compressed_layer
+	(digest, compressed_digest, uuid, sky_link, encoding, size, created_at) values ($1, $2, $3, $4, $5, $6, $7)
+	on conflict (digest) do nothing;`
+
+	GetCompressedLayer = `select digest, compressed_digest, uuid, sky_link, encoding, size, created_at
+	from compressed_layer where digest=$1;`
+)
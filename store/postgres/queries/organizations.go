@@ -0,0 +1,21 @@
+//nolint
+package queries
+
+var (
+	// the organization isn't created when a user already has its name, both share the namespace
+	CreateOrganization = `insert into organizations (name, created_at) select $1, $2
+	where not exists (select 1 from users where username=$1);`
+
+	GetOrganization = `select name, created_at from organizations where name=$1;`
+
+	SetOrganizationMember = `insert into organization_members (organization, user_id, role, created_at, updated_at)
+	values ($1, $2, $3, $4, $4) on conflict (organization, user_id) do update set role=$3, updated_at=$4;`
+
+	DeleteOrganizationMember = `delete from organization_members where organization=$1 and user_id=$2;`
+
+	GetOrganizationMembers = `select m.user_id, u.username, m.role, m.created_at, m.updated_at
+	from organization_members m join users u on u.id=m.user_id where m.organization=$1 order by u.username;`
+
+	GetOrganizationRole = `select m.role from organization_members m join users u on u.id=m.user_id
+	where m.organization=$1 and u.username=$2;`
+)
@@ -0,0 +1,16 @@
+//nolint
+package queries
+
+var (
+	AddNamespaceLayers = `insert into namespace_layers (namespace, digest, created_at)
+	select $1, digest, $3 from layer where digest = any($2::text[]) on conflict do nothing;`
+
+	// the keys of the quota locks are scoped, so that they don't collide with the other advisory locks
+	LockQuota = `select pg_advisory_xact_lock(hashtext('quota'), hashtext($1));`
+
+	GetNamespaceUsage = `select coalesce(sum(size), 0) from layer where digest in (
+	select digest from namespace_layers where namespace=$1);`
+
+	GetUserUsage = `select coalesce(sum(size), 0) from layer where digest in (
+	select digest from namespace_layers where left(namespace, length($1))=$1);`
+)
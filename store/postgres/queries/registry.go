@@ -13,44 +13,76 @@ var (
 	values ($1, $2, $3, $4, $5, $6) on conflict (digest) do nothing;`
 
 	SetConfig = `insert into config (uuid, namespace, reference, digest, sky_link, media_type, layers, size,
-	created_at, updated_at) values ($1, $2, $3, $4, $5, $6,$7, $8, $9, $10) on conflict (namespace,reference) 
-	do update set digest=$4, sky_link=$5,layers=$7,updated_at=$10;`
+	created_at, updated_at, config_digest, config_size, artifact_type)
+	values ($1, $2, $3, $4, $5, $6,$7, $8, $9, $10, $11, $12, $13)
+	on conflict (namespace,reference) do update set digest=$4, sky_link=$5,layers=$7,size=$8,updated_at=$10,
+	config_digest=$11, config_size=$12, artifact_type=$13;`
 )
 
 // select queries
 var (
-	GetDigest                    = `select digest from layers where digest=$1;`
-	ReadMetadata                 = `select * from metadata where namespace=$1;`
-	GetLayer                     = `select * from layer where digest=$1;`
-	GetContentHashById           = `select sky_link from layer where uuid=$1;`
-	GetManifest                  = `select * from image_manifest where namespace=$1;`
-	GetBlob                      = `select * from blob where digest=$1;`
-	GetConfig                    = `select * from config where namespace=$1;`
-	GetImageTags                 = `select reference from config where namespace=$1;`
-	GetManifestByRef             = `select * from config where namespace=$1 and reference=$2;`
-	GetManifestByDig             = `select * from config where namespace=$1 and digest=$2;`
-	GetCatalogCount              = `select count(namespace) from image_manifest;`
-	GetUserCatalogCount          = `select count(namespace) from image_manifest where namespace like $1;`
-	GetCatalog                   = `select namespace from image_manifest;`
-	GetCatalogWithPagination     = `select namespace from image_manifest limit $1 offset $2;`
-	GetUserCatalogWithPagination = `select namespace from image_manifest where namespace like $1 limit $2 offset $3;`
-	GetImageNamespace            = `select uuid,namespace,created_at::timestamptz,updated_at::timestamptz from 
+	GetDigest          = `select digest from layers where digest=$1;`
+	ReadMetadata       = `select * from metadata where namespace=$1;`
+	GetLayer           = `select * from layer where digest=$1;`
+	GetExistingLayers  = `select digest from layer where digest=any($1);`
+	GetContentHashById = `select sky_link from layer where uuid=$1;`
+	GetManifest        = `select uuid, namespace, media_type, schema_version, created_at, updated_at from image_manifest where namespace=$1;`
+	GetBlob            = `select * from blob where digest=$1;`
+	GetConfig          = `select uuid, namespace, reference, digest, sky_link, media_type, layers, size,
+	created_at, updated_at, config_digest, config_size, artifact_type from config where namespace=$1;`
+	GetImageTags     = `select reference from config where namespace=$1 and reference<>digest;`
+	GetManifestByRef = `select uuid, namespace, reference, digest, sky_link, media_type, layers, size,
+	created_at, updated_at, config_digest, config_size, artifact_type from config where namespace=$1 and reference=$2;`
+	GetManifestByDig = `select uuid, namespace, reference, digest, sky_link, media_type, layers, size,
+	created_at, updated_at, config_digest, config_size, artifact_type from config where namespace=$1 and digest=$2
+	order by reference=digest desc limit 1;`
+	GetCatalogCount     = `select count(namespace) from image_manifest;`
+	GetUserCatalogCount = `select count(namespace) from image_manifest where namespace like $1;`
+	// the catalog only lists the public repositories and the private ones owned by the viewer ($1, empty for
+	// anonymous requests) or their organizations, $2 is the namespace pattern and a null limit lists everything.
+	// The total counts every visible repository, not just the ones on the page
+	GetCatalog = `with visible as (select namespace from image_manifest where (visibility='public' or
+	split_part(namespace, '/', 1)=$1 or split_part(namespace, '/', 1) in (select m.organization from
+	organization_members m join users u on u.id=m.user_id where u.username=$1)) and namespace like $2)
+	select (select count(*) from visible), array(select namespace from visible order by namespace limit $3 offset $4);`
+	GetImageNamespace = `select uuid,namespace,created_at::timestamptz,updated_at::timestamptz from 
 		image_manifest where substr(namespace, 1, 50) like $1;`
+	GetAllConfigs             = `select namespace, reference, digest, layers from config;`
+	GetLayersCreatedBefore    = `select uuid, digest, blob_ids, created_at from layer where created_at < $1;`
+	GetRepositoryVisibility   = `select visibility from image_manifest where namespace=$1;`
+	GetTagsByDigest           = `select reference from config where namespace=$1 and digest=$2 and reference<>$2;`
+	GetLayerReferenceCount    = `select count(*) from config where $1=any(layers) or config_digest=$1;`
+	GetManifestReferenceCount = `select count(*) from config where digest=$1;`
+	RepositoryHasLayer        = `select exists(select 1 from config where namespace=$1 and $2=any(layers));`
+	RepositoryExists          = `select exists(select 1 from image_manifest where namespace=$1);`
+	HasManifestLists          = `select exists(select 1 from config where namespace=$1 and media_type=any($2));`
+	GetTagsByPushTime         = `select reference from config where namespace=$1 and reference<>digest
+	order by updated_at desc, created_at desc for update;`
 
 	// be very careful using this one
-	GetCatalogDetailWithPagination     = `select namespace,created_at::timestamptz,updated_at::timestamptz from
-	image_manifest order by %s limit $1 offset $2;`
-	GetUserCatalogDetailWithPagination = `select namespace,created_at::timestamptz,updated_at::timestamptz from 
-		image_manifest where namespace like $1 order by %s limit $2 offset $3;`
+	// a page past the end still returns one row with the total and null repository columns
+	GetCatalogDetailWithPagination = `with visible as (select namespace,created_at,updated_at from image_manifest
+	where (visibility='public' or split_part(namespace, '/', 1)=$1 or split_part(namespace, '/', 1) in
+	(select m.organization from organization_members m join users u on u.id=m.user_id where u.username=$1))
+	and namespace like $2)
+	select page.namespace,page.created_at::timestamptz,page.updated_at::timestamptz,total.count from
+	(select count(*) from visible) total left join lateral
+	(select * from visible order by %s limit $3 offset $4) page on true;`
 	GetRepoDetailWithPagination = `select reference, digest, sky_link, (select sum(size) from layer where digest = 
 		ANY(layers)) as size, created_at::timestamptz, updated_at::timestamptz from config where namespace=$1 
-		limit $2 offset $3;`
+		and reference<>digest limit $2 offset $3;`
 )
 
 // delete queries
 var (
-	DeleteLayer         = `delete from layer where digest=$1;`
-	DeleteBlob          = `delete from blob where digest=$1;`
-	DeleteManifestByRef = `delete from config where reference=$1;`
-	DeleteManifestByDig = `delete from config where digest=$1;`
+	DeleteLayer            = `delete from layer where digest=$1;`
+	DeleteBlob             = `delete from blob where digest=$1;`
+	DeleteTag              = `delete from config where namespace=$1 and reference=$2;`
+	DeleteTags             = `delete from config where namespace=$1 and reference=any($2) and reference<>digest;`
+	DeleteManifestByDigest = `delete from config where namespace=$1 and digest=$2;`
+)
+
+// update queries
+var (
+	SetRepositoryVisibility = `update image_manifest set visibility=$1, updated_at=$2 where namespace=$3;`
 )
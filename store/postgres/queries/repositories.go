@@ -0,0 +1,37 @@
+//nolint
+package queries
+
+var (
+	GetPublicRepositories = `with visible as (select im.namespace, im.updated_at, coalesce(rs.pull_count, 0) as pull_count
+	from image_manifest im left join repository_stats rs on rs.namespace=im.namespace where im.visibility='public')
+	select page.namespace,page.updated_at::timestamptz,page.pull_count,total.count from
+	(select count(*) from visible) total left join lateral
+	(select * from visible order by %s limit $1 offset $2) page on true;`
+
+	GetPublicRepository = `select im.namespace, im.updated_at::timestamptz, coalesce(rs.pull_count, 0) from image_manifest im
+	left join repository_stats rs on rs.namespace=im.namespace where im.namespace=$1 and im.visibility='public';`
+
+	// the repositories of a user are the ones under their username, $2 hides the private ones
+	GetRepositoriesByOwner = `with owned as (select im.namespace, im.visibility, im.updated_at,
+	coalesce(rs.pull_count, 0) as pull_count from image_manifest im join users u on left(im.namespace,
+	length(u.username)+1)=u.username || '/' left join repository_stats rs on rs.namespace=im.namespace
+	where u.id=$1 and (not $2::boolean or im.visibility='public'))
+	select page.namespace,page.visibility,page.updated_at::timestamptz,page.pull_count,total.count from
+	(select count(*) from owned) total left join lateral
+	(select * from owned order by updated_at desc, namespace asc limit $3 offset $4) page on true;`
+
+	GetRepository = `select namespace, visibility, created_at::timestamptz, updated_at::timestamptz from image_manifest
+	where namespace=$1;`
+
+	// the tags come before the manifests pushed by digest, so that they're grouped under their manifest
+	GetRepositoryReferences = `select reference, digest, coalesce(media_type, ''), coalesce(layers, '{}'),
+	coalesce(size, 0), config_digest, config_size, artifact_type,
+	created_at::timestamptz, updated_at::timestamptz from config where namespace=$1
+	order by reference=digest asc, updated_at desc, reference asc;`
+
+	GetLayerDescriptors = `select digest, coalesce(media_type, ''), coalesce(size, 0) from layer where digest=any($1);`
+
+	GetPublicRepositoryTags = `select reference, digest, coalesce((select sum(size) from layer where digest=any(layers)), 0),
+	created_at::timestamptz, updated_at::timestamptz from config where namespace=$1 and reference<>digest
+	order by updated_at desc, reference asc limit $2 offset $3;`
+)
@@ -0,0 +1,20 @@
+//nolint
+package queries
+
+var (
+	SetRetentionPolicy = `insert into retention_policy
+	(namespace, tag_pattern, keep_last, max_tag_age_days, untagged_max_age_days, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7) on conflict (namespace) do update set tag_pattern=$2, keep_last=$3,
+	max_tag_age_days=$4, untagged_max_age_days=$5, updated_at=$7;`
+
+	GetRetentionPolicy = `select namespace, tag_pattern, keep_last, max_tag_age_days, untagged_max_age_days,
+	created_at, updated_at from retention_policy where namespace=$1;`
+
+	GetRetentionPolicies = `select namespace, tag_pattern, keep_last, max_tag_age_days, untagged_max_age_days,
+	created_at, updated_at from retention_policy;`
+
+	DeleteRetentionPolicy = `delete from retention_policy where namespace=$1;`
+
+	GetReferencesByPushTime = `select reference, digest, layers, created_at, updated_at from config
+	where namespace=$1 order by updated_at desc, created_at desc for update;`
+)
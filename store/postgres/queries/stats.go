@@ -0,0 +1,17 @@
+//nolint
+package queries
+
+var (
+	AddRepositoryStats = `insert into repository_stats as s
+	(namespace, pull_count, layer_pull_count, push_count, last_pulled_at, last_pushed_at) values ($1, $2, $3, $4, $5, $6)
+	on conflict (namespace) do update set pull_count = s.pull_count + excluded.pull_count,
+	layer_pull_count = s.layer_pull_count + excluded.layer_pull_count, push_count = s.push_count + excluded.push_count,
+	last_pulled_at = greatest(s.last_pulled_at, excluded.last_pulled_at),
+	last_pushed_at = greatest(s.last_pushed_at, excluded.last_pushed_at);`
+
+	GetRepositoryStats = `select pull_count, layer_pull_count, push_count, last_pulled_at, last_pushed_at
+	from repository_stats where namespace=$1;`
+
+	GetRepositoryLayerStats = `select count(*), coalesce(sum(size), 0) from layer where digest in (
+	select unnest(layers) from config where namespace=$1);`
+)
@@ -0,0 +1,20 @@
+//nolint
+package queries
+
+var (
+	SaveUploadSession = `insert into upload_sessions (upload_id, layer_key, namespace, parts, part_count, received,
+	created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8) on conflict (upload_id) do update set parts=$4,
+	part_count=$5, received=$6, updated_at=$8;`
+
+	GetUploadSessions = `select upload_id, layer_key, namespace, parts, part_count, received, created_at, updated_at
+	from upload_sessions;`
+
+	// the parts are appended to the stored ones, the session is created when the first save failed
+	AppendUploadSessionParts = `insert into upload_sessions (upload_id, layer_key, namespace, parts, part_count,
+	received, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8) on conflict (upload_id) do update set
+	parts=upload_sessions.parts || excluded.parts, part_count=$5, received=$6, updated_at=$8;`
+
+	GetUploadSessionParts = `select parts from upload_sessions where upload_id=$1;`
+
+	DeleteUploadSession = `delete from upload_sessions where upload_id=$1;`
+)
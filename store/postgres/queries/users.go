@@ -4,24 +4,55 @@ package queries
 var (
 	AddUser = `insert into users (id, is_active, username, name, email, password, hireable, html_url, created_at, updated_at)
 values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
-	GetUser                 = `select id, is_active, username, email, created_at, updated_at from users where email=$1 or username=$1;`
-	GetUserWithPassword     = `select id, is_active, username, email, password, created_at, updated_at from users where email=$1 or username=$1;`
-	GetUserById             = `select id, is_active, username, email, created_at, updated_at from users where id=$1;`
-	GetUserByIdWithPassword = `select id, is_active, username, email, password, created_at, updated_at from users where id=$1;`
+	GetUser                 = `select id, is_active, username, email, token_version, created_at, updated_at, roles from users where email=$1 or username=$1;`
+	GetUserWithPassword     = `select id, is_active, username, email, coalesce(password, ''), token_version, created_at, updated_at, roles from users where email=$1 or username=$1;`
+	GetUserById             = `select id, is_active, username, email, token_version, created_at, updated_at, roles from users where id=$1;`
+	GetUserByIdWithPassword = `select id, is_active, username, email, coalesce(password, ''), token_version, created_at, updated_at, roles from users where id=$1;`
 	GetUserWithSession      = `select id, is_active, name, username, email, hireable, html_url, created_at, updated_at from users where id=(select owner from session where id=$1);`
 	UpdateUser              = `update users set is_active = $1, updated_at = $2 where id = $3;`
-	SetUserActive           = `update users set is_active=true where id=$1`
+	SetUserActive           = `update users set is_active=$2, updated_at=$3 where id=$1;`
+	GetUsers                = `select id, is_active, username, email, token_version, created_at, updated_at, roles, count(*) over() from users
+where username ilike $1 or email ilike $1 order by username limit $2 offset $3;`
 	DeleteUser              = `delete from users where username = $1;`
-	UpdateUserPwd           = `update users set password=$1 where id=$2;`
+	UpdateUserPwd           = `update users set password=$1, token_version=token_version+1 where id=$2;`
 	GetAllEmails            = `select email from users;`
 	AddOAuthUser            = `insert into users (id, username, email, html_url, created_at, updated_at,
-bio, type, gravatar_id, login, name, node_id, avatar_url, oauth_id, is_active, hireable)
-values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) on conflict (email) do update set username=$2, email=$3`
+bio, type, gravatar_id, login, name, node_id, avatar_url, oauth_id, is_active, hireable, oauth_provider)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);`
 )
 
+// an oauth identity is the provider along with the user's id at the provider
 var (
-	AddSession        = `insert into session (id,refresh_token,owner) values($1, $2, (select id from users where username=$3));`
-	GetSession        = `select id,refresh_token,owner from session where id=$1;`
+	GetUserByOAuthIdentity = `select id, is_active, username, email, token_version, created_at, updated_at, roles from users
+where oauth_provider=$1 and oauth_id=$2;`
+	LinkOAuthIdentity   = `update users set oauth_provider=$2, oauth_id=$3, updated_at=$4 where id=$1;`
+	UnlinkOAuthIdentity = `update users set oauth_provider=null, oauth_id=null, updated_at=$3 where id=$1 and oauth_provider=$2;`
+)
+
+var (
+	AddSession        = `insert into session (id,refresh_token,owner,user_agent,ip_address,created_at,last_used_at)
+values($1, $2, (select id from users where username=$3), $4, $5, $6, $6);`
+	GetSession        = `select id,refresh_token,owner,user_agent,ip_address,created_at,last_used_at from session where id=$1;`
+	ListSessions      = `select id,user_agent,ip_address,created_at,last_used_at from session where owner=$1
+order by last_used_at desc;`
+	TouchSession      = `update session set last_used_at=$2 where refresh_token=$1;`
 	DeleteSession     = `delete from session where id=$1 and owner=$2;`
 	DeleteAllSessions = `delete from session where owner=$1;`
 )
+
+var (
+	GrantRole = `update users set roles=array_append(roles, $2) where username=$1 and not $2=any(roles);`
+	// the role is granted to the oldest user, unless a user has it already
+	GrantRoleToFirstUser = `update users set roles=array_append(roles, $1) where id=(select id from users
+order by created_at limit 1) and not exists (select 1 from users where $1=any(roles));`
+)
+
+// deleting a user deletes everything under their namespace too, $1 is the username. The namespaces are matched on
+// their first component rather than with like, the _ of a username would match any character
+var (
+	DeleteUserVerifyEmails      = `delete from verify_emails where user_id=$1;`
+	DeleteUserConfigs           = `delete from config where left(namespace, length($1)+1)=$1||'/' returning namespace, digest, layers;`
+	DeleteUserManifests         = `delete from image_manifest where left(namespace, length($1)+1)=$1||'/';`
+	DeleteUserRetentionPolicies = `delete from retention_policy where left(namespace, length($1)+1)=$1||'/';`
+	DeleteUserRepositoryStats   = `delete from repository_stats where left(namespace, length($1)+1)=$1||'/';`
+)
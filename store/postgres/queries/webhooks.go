@@ -0,0 +1,7 @@
+//nolint
+package queries
+
+var (
+	AddWebhookDeadLetter = `insert into webhook_dead_letters (url, event_type, payload, error, attempts, created_at)
+	values ($1, $2, $3, $4, $5, $6);`
+)
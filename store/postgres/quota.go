@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/jackc/pgx/v4"
+)
+
+func (p *pg) AddNamespaceLayers(ctx context.Context, txn pgx.Tx, namespace string, digests []string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	if _, err := txn.Exec(childCtx, queries.AddNamespaceLayers, namespace, digests, time.Now()); err != nil {
+		return fmt.Errorf("ERR_ADD_NAMESPACE_LAYERS: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) LockQuota(ctx context.Context, txn pgx.Tx, key string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	if _, err := txn.Exec(childCtx, queries.LockQuota, key); err != nil {
+		return fmt.Errorf("ERR_LOCK_QUOTA: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) GetNamespaceUsage(ctx context.Context, txn pgx.Tx, namespace string) (int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var used int64
+	if err := p.queryRow(childCtx, txn, queries.GetNamespaceUsage, namespace).Scan(&used); err != nil {
+		return 0, fmt.Errorf("ERR_GET_NAMESPACE_USAGE: %w", err)
+	}
+
+	return used, nil
+}
+
+func (p *pg) GetUserUsage(ctx context.Context, txn pgx.Tx, username string) (int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var used int64
+	if err := p.queryRow(childCtx, txn, queries.GetUserUsage, username+"/").Scan(&used); err != nil {
+		return 0, fmt.Errorf("ERR_GET_USER_USAGE: %w", err)
+	}
+
+	return used, nil
+}
+
+func (p *pg) queryRow(ctx context.Context, txn pgx.Tx, query string, args ...interface{}) pgx.Row {
+	if txn != nil {
+		return txn.QueryRow(ctx, query, args...)
+	}
+
+	return p.conn.QueryRow(ctx, query, args...)
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+func (p *pg) GetPublicRepositories(
+	ctx context.Context, sortBy string, pageSize, offset int64,
+) ([]*types.PublicRepository, int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, fmt.Sprintf(queries.GetPublicRepositories, sortBy), pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ERR_GET_PUBLIC_REPOSITORIES: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var total int64
+	repositories := []*types.PublicRepository{}
+	for rows.Next() {
+		var namespace *string
+		var updatedAt *time.Time
+		var pullCount *int64
+
+		if err = rows.Scan(&namespace, &updatedAt, &pullCount, &total); err != nil {
+			return nil, 0, fmt.Errorf("ERR_SCAN_PUBLIC_REPOSITORY: %w", err)
+		}
+		// the page is empty
+		if namespace == nil {
+			continue
+		}
+
+		repositories = append(repositories, &types.PublicRepository{
+			Namespace: *namespace,
+			UpdatedAt: *updatedAt,
+			PullCount: *pullCount,
+		})
+	}
+
+	return repositories, total, rows.Err()
+}
+
+func (p *pg) GetRepositoriesByOwner(
+	ctx context.Context, userID string, publicOnly bool, pageSize, offset int64,
+) ([]*types.PublicRepository, int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetRepositoriesByOwner, userID, publicOnly, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ERR_GET_REPOSITORIES_BY_OWNER: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var total int64
+	repositories := []*types.PublicRepository{}
+	for rows.Next() {
+		var namespace *string
+		var visibility *types.RepositoryVisibility
+		var updatedAt *time.Time
+		var pullCount *int64
+
+		if err = rows.Scan(&namespace, &visibility, &updatedAt, &pullCount, &total); err != nil {
+			return nil, 0, fmt.Errorf("ERR_SCAN_OWNER_REPOSITORY: %w", err)
+		}
+		// the page is empty
+		if namespace == nil {
+			continue
+		}
+
+		repo := &types.PublicRepository{
+			Namespace:  *namespace,
+			Visibility: *visibility,
+			PullCount:  *pullCount,
+		}
+		if updatedAt != nil {
+			repo.UpdatedAt = *updatedAt
+		}
+		repositories = append(repositories, repo)
+	}
+
+	return repositories, total, rows.Err()
+}
+
+func (p *pg) GetPublicRepository(
+	ctx context.Context, namespace string, pageSize, offset int64,
+) (*types.PublicRepository, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	repo := &types.PublicRepository{Tags: []*types.ConfigV2{}}
+	row := p.conn.QueryRow(childCtx, queries.GetPublicRepository, namespace)
+	if err := row.Scan(&repo.Namespace, &repo.UpdatedAt, &repo.PullCount); err != nil {
+		return nil, fmt.Errorf("ERR_GET_PUBLIC_REPOSITORY: %w", classify(err))
+	}
+
+	rows, err := p.conn.Query(childCtx, queries.GetPublicRepositoryTags, namespace, pageSize, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_PUBLIC_REPOSITORY_TAGS: %w", classify(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag types.ConfigV2
+		if err = rows.Scan(&tag.Reference, &tag.Digest, &tag.Size, &tag.CreatedAt, &tag.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_PUBLIC_REPOSITORY_TAG: %w", err)
+		}
+		repo.Tags = append(repo.Tags, &tag)
+	}
+
+	return repo, rows.Err()
+}
+
+func (p *pg) GetRepository(ctx context.Context, namespace string) (*types.Repository, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	repo := &types.Repository{Tags: []*types.ConfigV2{}, Manifests: []*types.ManifestDescriptor{}}
+	row := p.conn.QueryRow(childCtx, queries.GetRepository, namespace)
+	if err := row.Scan(&repo.Namespace, &repo.Visibility, &repo.CreatedAt, &repo.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY: %w", classify(err))
+	}
+
+	rows, err := p.conn.Query(childCtx, queries.GetRepositoryReferences, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY_REFERENCES: %w", classify(err))
+	}
+	defer rows.Close()
+
+	manifests := make(map[string]*types.ManifestDescriptor)
+	layers := make(map[string]*types.Descriptor)
+	var digests []string
+	for rows.Next() {
+		ref := &types.ConfigV2{Namespace: namespace}
+		if err = rows.Scan(
+			&ref.Reference,
+			&ref.Digest,
+			&ref.MediaType,
+			&ref.Layers,
+			&ref.Size,
+			&ref.ConfigDigest,
+			&ref.ConfigSize,
+			&ref.ArtifactType,
+			&ref.CreatedAt,
+			&ref.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_REPOSITORY_REFERENCE: %w", err)
+		}
+
+		manifest, ok := manifests[ref.Digest]
+		if !ok {
+			manifest = newManifestDescriptor(ref, layers)
+			manifests[ref.Digest] = manifest
+			repo.Manifests = append(repo.Manifests, manifest)
+			digests = append(digests, ref.Layers...)
+		}
+		if ref.Reference != ref.Digest {
+			manifest.Tags = append(manifest.Tags, ref.Reference)
+			repo.Tags = append(repo.Tags, ref)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY_REFERENCES: %w", classify(err))
+	}
+	rows.Close()
+
+	if len(digests) == 0 {
+		return repo, nil
+	}
+
+	layerRows, err := p.conn.Query(childCtx, queries.GetLayerDescriptors, digests)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY_LAYERS: %w", classify(err))
+	}
+	defer layerRows.Close()
+
+	for layerRows.Next() {
+		var layer types.Descriptor
+		if err = layerRows.Scan(&layer.Digest, &layer.MediaType, &layer.Size); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_REPOSITORY_LAYER: %w", err)
+		}
+		// the manifests which share a layer share its descriptor
+		if descriptor, ok := layers[layer.Digest]; ok {
+			*descriptor = layer
+		}
+	}
+
+	return repo, layerRows.Err()
+}
+
+// newManifestDescriptor adds the layers of the manifest to layers, by digest, for them to be filled once they're
+// read from the layer table
+func newManifestDescriptor(ref *types.ConfigV2, layers map[string]*types.Descriptor) *types.ManifestDescriptor {
+	manifest := &types.ManifestDescriptor{
+		CreatedAt:    ref.CreatedAt,
+		UpdatedAt:    ref.UpdatedAt,
+		MediaType:    ref.MediaType,
+		ArtifactType: ref.ArtifactType,
+		Digest:       ref.Digest,
+		Tags:         []string{},
+		Size:         int64(ref.Size),
+	}
+	if ref.ConfigDigest != "" {
+		manifest.Config = &types.Descriptor{Digest: ref.ConfigDigest, Size: int64(ref.ConfigSize)}
+	}
+
+	for _, dig := range ref.Layers {
+		layer, ok := layers[dig]
+		if !ok {
+			layer = &types.Descriptor{Digest: dig}
+			layers[dig] = layer
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+
+	return manifest
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+func (p *pg) SetRetentionPolicy(ctx context.Context, policy *types.RetentionPolicy) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := p.conn.Exec(
+		childCtx,
+		queries.SetRetentionPolicy,
+		policy.Namespace,
+		policy.TagPattern,
+		policy.KeepLast,
+		policy.MaxTagAgeDays,
+		policy.UntaggedMaxAgeDays,
+		policy.CreatedAt,
+		policy.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("ERR_SET_RETENTION_POLICY: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) GetRetentionPolicy(ctx context.Context, namespace string) (*types.RetentionPolicy, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	policy, err := scanRetentionPolicy(p.conn.QueryRow(childCtx, queries.GetRetentionPolicy, namespace))
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_RETENTION_POLICY: %w", classify(err))
+	}
+
+	return policy, nil
+}
+
+func (p *pg) GetRetentionPolicies(ctx context.Context) ([]*types.RetentionPolicy, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetRetentionPolicies)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_RETENTION_POLICIES: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []*types.RetentionPolicy
+	for rows.Next() {
+		policy, scanErr := scanRetentionPolicy(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("ERR_SCAN_RETENTION_POLICY: %w", scanErr)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+func (p *pg) DeleteRetentionPolicy(ctx context.Context, namespace string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	result, err := p.conn.Exec(childCtx, queries.DeleteRetentionPolicy, namespace)
+	if err != nil {
+		return fmt.Errorf("ERR_DELETE_RETENTION_POLICY: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_RETENTION_POLICY_NOT_FOUND: %s", namespace)
+	}
+
+	return nil
+}
+
+func (p *pg) GetReferencesByPushTime(ctx context.Context, txn pgx.Tx, namespace string) ([]*types.ConfigV2, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := txn.Query(childCtx, queries.GetReferencesByPushTime, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_REFERENCES_BY_PUSH_TIME: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []*types.ConfigV2
+	for rows.Next() {
+		ref := &types.ConfigV2{Namespace: namespace}
+		if err = rows.Scan(&ref.Reference, &ref.Digest, &ref.Layers, &ref.CreatedAt, &ref.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_REFERENCES_BY_PUSH_TIME: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+func scanRetentionPolicy(row pgx.Row) (*types.RetentionPolicy, error) {
+	var policy types.RetentionPolicy
+	err := row.Scan(
+		&policy.Namespace,
+		&policy.TagPattern,
+		&policy.KeepLast,
+		&policy.MaxTagAgeDays,
+		&policy.UntaggedMaxAgeDays,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
@@ -7,14 +7,13 @@ import (
 
 	"github.com/containerish/OpenRegistry/store/postgres/queries"
 	"github.com/containerish/OpenRegistry/types"
-	"github.com/jackc/pgx/v4"
 )
 
-func (p *pg) AddSession(ctx context.Context, id, refreshToken, username string) error {
+func (p *pg) AddSession(ctx context.Context, id, refreshToken, username, userAgent, ipAddress string) error {
 	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	_, err := p.conn.Exec(childCtx, queries.AddSession, id, refreshToken, username)
+	_, err := p.conn.Exec(childCtx, queries.AddSession, id, refreshToken, username, userAgent, ipAddress, time.Now())
 	if err != nil {
 		return fmt.Errorf("ERR_CREATE_SESSION: %w", err)
 	}
@@ -27,12 +26,60 @@ func (p *pg) GetSession(ctx context.Context, sessionId string) (*types.Session,
 
 	row := p.conn.QueryRow(childCtx, queries.GetSession, sessionId)
 	var session types.Session
-	if err := row.Scan(&session.Id, &session.RefreshToken, &session.Owner); err != nil || err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("ERROR_SESSION_LOOKUP: %w", err)
+	err := row.Scan(
+		&session.Id,
+		&session.RefreshToken,
+		&session.Owner,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR_SESSION_LOOKUP: %w", classify(err))
 	}
 	return &session, nil
 }
 
+// ListSessions returns the user's sessions, the most recently used first. The refresh tokens are left out
+func (p *pg) ListSessions(ctx context.Context, userId string) ([]*types.Session, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.ListSessions, userId)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_LIST_SESSIONS: %w", classify(err))
+	}
+	defer rows.Close()
+
+	sessions := []*types.Session{}
+	for rows.Next() {
+		session := types.Session{Owner: userId}
+		err = rows.Scan(&session.Id, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_SESSION: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession marks the session the refresh token belongs to as used, ErrNotFound means it has been revoked
+func (p *pg) TouchSession(ctx context.Context, refreshToken string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	result, err := p.conn.Exec(childCtx, queries.TouchSession, refreshToken, time.Now())
+	if err != nil {
+		return fmt.Errorf("ERR_TOUCH_SESSION: %w", classify(err))
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_TOUCH_SESSION: %w", ErrNotFound)
+	}
+	return nil
+}
+
 func (p *pg) DeleteSession(ctx context.Context, sessionId, userId string) error {
 	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
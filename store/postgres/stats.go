@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/jackc/pgx/v4"
+)
+
+// AddRepositoryStats adds the counters to the stored ones, in a single round trip
+func (p *pg) AddRepositoryStats(ctx context.Context, stats []*types.RepositoryStats) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, s := range stats {
+		batch.Queue(
+			queries.AddRepositoryStats,
+			s.Namespace,
+			s.PullCount,
+			s.LayerPullCount,
+			s.PushCount,
+			s.LastPulledAt,
+			s.LastPushedAt,
+		)
+	}
+
+	if err := p.conn.SendBatch(childCtx, batch).Close(); err != nil {
+		return fmt.Errorf("ERR_ADD_REPOSITORY_STATS: %w", err)
+	}
+
+	return nil
+}
+
+// GetRepositoryStats returns zero counters for a repository that has never been pulled or pushed
+func (p *pg) GetRepositoryStats(ctx context.Context, namespace string) (*types.RepositoryStats, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	stats := &types.RepositoryStats{Namespace: namespace}
+	row := p.conn.QueryRow(childCtx, queries.GetRepositoryStats, namespace)
+	err := row.Scan(
+		&stats.PullCount,
+		&stats.LayerPullCount,
+		&stats.PushCount,
+		&stats.LastPulledAt,
+		&stats.LastPushedAt,
+	)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY_STATS: %w", err)
+	}
+
+	row = p.conn.QueryRow(childCtx, queries.GetRepositoryLayerStats, namespace)
+	if err = row.Scan(&stats.UniqueLayers, &stats.TotalSize); err != nil {
+		return nil, fmt.Errorf("ERR_GET_REPOSITORY_LAYER_STATS: %w", err)
+	}
+
+	return stats, nil
+}
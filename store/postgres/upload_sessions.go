@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+func (p *pg) SaveUploadSession(ctx context.Context, session *types.UploadSession) error {
+	if err := p.saveUploadSession(ctx, queries.SaveUploadSession, session); err != nil {
+		return fmt.Errorf("ERR_SAVE_UPLOAD_SESSION: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) AppendUploadSessionParts(ctx context.Context, session *types.UploadSession) error {
+	if err := p.saveUploadSession(ctx, queries.AppendUploadSessionParts, session); err != nil {
+		return fmt.Errorf("ERR_APPEND_UPLOAD_SESSION_PARTS: %w", err)
+	}
+
+	return nil
+}
+
+func (p *pg) saveUploadSession(ctx context.Context, query string, session *types.UploadSession) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	parts, err := json.Marshal(session.Parts)
+	if err != nil {
+		return fmt.Errorf("ERR_MARSHAL_UPLOAD_SESSION_PARTS: %w", err)
+	}
+
+	_, err = p.conn.Exec(
+		childCtx,
+		query,
+		session.UploadID,
+		session.LayerKey,
+		session.Namespace,
+		parts,
+		session.PartCount,
+		session.Received,
+		session.CreatedAt,
+		session.UpdatedAt,
+	)
+
+	return err
+}
+
+func (p *pg) GetUploadSessionParts(ctx context.Context, uploadID string) ([]types.UploadSessionPart, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var raw []byte
+	if err := p.conn.QueryRow(childCtx, queries.GetUploadSessionParts, uploadID).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("ERR_GET_UPLOAD_SESSION_PARTS: %w", classify(err))
+	}
+
+	var parts []types.UploadSessionPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("ERR_UNMARSHAL_UPLOAD_SESSION_PARTS: %w", err)
+	}
+
+	return parts, nil
+}
+
+func (p *pg) GetUploadSessions(ctx context.Context) ([]*types.UploadSession, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetUploadSessions)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_QUERY_UPLOAD_SESSIONS: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*types.UploadSession
+	for rows.Next() {
+		var session types.UploadSession
+		var parts []byte
+		if err = rows.Scan(
+			&session.UploadID,
+			&session.LayerKey,
+			&session.Namespace,
+			&parts,
+			&session.PartCount,
+			&session.Received,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ERR_SCAN_UPLOAD_SESSION: %w", err)
+		}
+
+		if err = json.Unmarshal(parts, &session.Parts); err != nil {
+			return nil, fmt.Errorf("ERR_UNMARSHAL_UPLOAD_SESSION_PARTS: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, nil
+}
+
+func (p *pg) DeleteUploadSession(ctx context.Context, uploadID string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	if _, err := p.conn.Exec(childCtx, queries.DeleteUploadSession, uploadID); err != nil {
+		return fmt.Errorf("ERR_DELETE_UPLOAD_SESSION: %w", err)
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/containerish/OpenRegistry/store/postgres/queries"
 	"github.com/containerish/OpenRegistry/types"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 )
 
 func (p *pg) AddUser(ctx context.Context, u *types.User) error {
@@ -41,7 +42,7 @@ func (p *pg) AddUser(ctx context.Context, u *types.User) error {
 		t,
 	)
 	if err != nil {
-		return fmt.Errorf("error adding user to database: %w", err)
+		return fmt.Errorf("error adding user to database: %w", classify(err))
 	}
 
 	return nil
@@ -60,11 +61,12 @@ func (p *pg) AddOAuthUser(ctx context.Context, u *types.User) error {
 	if err != nil {
 		return fmt.Errorf("error creating id for oauth user")
 	}
+	u.Id = id.String()
 
 	_, err = p.conn.Exec(
 		childCtx,
 		queries.AddOAuthUser,
-		id.String(),
+		u.Id,
 		u.Username,
 		u.Email,
 		u.HTMLURL,
@@ -80,9 +82,10 @@ func (p *pg) AddOAuthUser(ctx context.Context, u *types.User) error {
 		u.OAuthID,
 		u.IsActive,
 		u.Hireable,
+		u.OAuthProvider,
 	)
 	if err != nil {
-		return fmt.Errorf("error adding user to database: %w", err)
+		return fmt.Errorf("error adding user to database: %w", classify(err))
 	}
 
 	return nil
@@ -102,11 +105,13 @@ func (p *pg) GetUser(ctx context.Context, identifier string, withPassword bool)
 			&user.Username,
 			&user.Email,
 			&user.Password,
+			&user.TokenVersion,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.Roles,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("ERR_GET_USER_WITH_PASSWORD_FROM_DB: %w", err)
+			return nil, fmt.Errorf("ERR_GET_USER_WITH_PASSWORD_FROM_DB: %w", classify(err))
 		}
 
 		return &user, nil
@@ -118,11 +123,13 @@ func (p *pg) GetUser(ctx context.Context, identifier string, withPassword bool)
 		&user.IsActive,
 		&user.Username,
 		&user.Email,
+		&user.TokenVersion,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Roles,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("ERR_GET_USER_FROM_DB: %w", err)
+		return nil, fmt.Errorf("ERR_GET_USER_FROM_DB: %w", classify(err))
 	}
 
 	return &user, nil
@@ -142,10 +149,12 @@ func (p *pg) GetUserById(ctx context.Context, userId string, withPassword bool)
 			&user.Username,
 			&user.Email,
 			&user.Password,
+			&user.TokenVersion,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.Roles,
 		); err != nil {
-			return nil, fmt.Errorf("ERR_GET_USER_BY_ID_PWD_HASH: %w", err)
+			return nil, fmt.Errorf("ERR_GET_USER_BY_ID_PWD_HASH: %w", classify(err))
 		}
 
 		return &user, nil
@@ -158,11 +167,13 @@ func (p *pg) GetUserById(ctx context.Context, userId string, withPassword bool)
 		&user.IsActive,
 		&user.Username,
 		&user.Email,
+		&user.TokenVersion,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Roles,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("ERR_GET_USER_BY_ID: %w", err)
+		return nil, fmt.Errorf("ERR_GET_USER_BY_ID: %w", classify(err))
 	}
 
 	return &user, nil
@@ -186,7 +197,7 @@ func (p *pg) GetUserWithSession(ctx context.Context, sessionId string) (*types.U
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	); err != nil {
-		return nil, fmt.Errorf("ERR_SESSION_NOT_FOUND: %w", err)
+		return nil, fmt.Errorf("ERR_SESSION_NOT_FOUND: %w", classify(err))
 	}
 
 	return &user, nil
@@ -292,3 +303,174 @@ func (p *pg) UserExists(ctx context.Context, id string) bool {
 
 	return true
 }
+
+// GetUsers lists the users whose username or email contains search, along with the total number of matching users
+func (p *pg) GetUsers(ctx context.Context, search string, pageSize, offset int64) ([]*types.User, int64, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	rows, err := p.conn.Query(childCtx, queries.GetUsers, "%"+search+"%", pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ERR_GET_USERS: %w", err)
+	}
+	defer rows.Close()
+
+	var total int64
+	users := []*types.User{}
+	for rows.Next() {
+		var user types.User
+		if err := rows.Scan(
+			&user.Id,
+			&user.IsActive,
+			&user.Username,
+			&user.Email,
+			&user.TokenVersion,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.Roles,
+			&total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("ERR_SCAN_USERS: %w", err)
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, total, nil
+}
+
+func (p *pg) SetUserActive(ctx context.Context, userId string, active bool) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+
+	_, err := p.conn.Exec(childCtx, queries.SetUserActive, userId, active, time.Now())
+	if err != nil {
+		return fmt.Errorf("ERR_SET_USER_ACTIVE: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUserWithRepositories deletes the user along with their sessions and repositories, it returns the manifests
+// of the deleted repositories, so that the caller can delete the layers nothing else uses and the DFS objects
+func (p *pg) DeleteUserWithRepositories(ctx context.Context, txn pgx.Tx, user *types.User) ([]*types.ConfigV2, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := txn.Query(childCtx, queries.DeleteUserConfigs, user.Username)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_DELETE_USER_CONFIGS: %w", err)
+	}
+
+	// a manifest has a row for each of its tags
+	seen := make(map[string]bool)
+	var manifests []*types.ConfigV2
+	for rows.Next() {
+		manifest := &types.ConfigV2{}
+		if err = rows.Scan(&manifest.Namespace, &manifest.Digest, &manifest.Layers); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ERR_SCAN_USER_CONFIGS: %w", err)
+		}
+
+		if key := manifest.Namespace + "@" + manifest.Digest; !seen[key] {
+			seen[key] = true
+			manifests = append(manifests, manifest)
+		}
+	}
+	rows.Close()
+
+	batch := &pgx.Batch{}
+	batch.Queue(queries.DeleteUserManifests, user.Username)
+	batch.Queue(queries.DeleteUserRetentionPolicies, user.Username)
+	batch.Queue(queries.DeleteUserRepositoryStats, user.Username)
+	batch.Queue(queries.DeleteAllSessions, user.Id)
+	batch.Queue(queries.DeleteUserVerifyEmails, user.Id)
+	batch.Queue(queries.DeleteUser, user.Username)
+
+	if err = txn.SendBatch(childCtx, batch).Close(); err != nil {
+		return nil, fmt.Errorf("ERR_DELETE_USER: %w", err)
+	}
+
+	return manifests, nil
+}
+
+// GrantRole is a no-op when the user has the role already
+func (p *pg) GrantRole(ctx context.Context, username, role string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if _, err := p.conn.Exec(childCtx, queries.GrantRole, username, role); err != nil {
+		return fmt.Errorf("ERR_GRANT_ROLE: %w", err)
+	}
+
+	return nil
+}
+
+// GrantRoleToFirstUser grants the role to the oldest user, only if no user has it yet
+func (p *pg) GrantRoleToFirstUser(ctx context.Context, role string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	if _, err := p.conn.Exec(childCtx, queries.GrantRoleToFirstUser, role); err != nil {
+		return fmt.Errorf("ERR_GRANT_ROLE_TO_FIRST_USER: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserByOAuthIdentity returns ErrNotFound when no user has linked the identity
+func (p *pg) GetUserByOAuthIdentity(ctx context.Context, provider string, oauthId int) (*types.User, error) {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	var user types.User
+	err := p.conn.QueryRow(childCtx, queries.GetUserByOAuthIdentity, provider, oauthId).Scan(
+		&user.Id,
+		&user.IsActive,
+		&user.Username,
+		&user.Email,
+		&user.TokenVersion,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Roles,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_GET_USER_BY_OAUTH_IDENTITY: %w", classify(err))
+	}
+
+	user.OAuthProvider = provider
+	user.OAuthID = oauthId
+	return &user, nil
+}
+
+// LinkOAuthIdentity replaces the identity linked to the user, ErrConflict means another user has linked it
+func (p *pg) LinkOAuthIdentity(ctx context.Context, userId, provider string, oauthId int) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := p.conn.Exec(childCtx, queries.LinkOAuthIdentity, userId, provider, oauthId, time.Now())
+	if err != nil {
+		return fmt.Errorf("ERR_LINK_OAUTH_IDENTITY: %w", classify(err))
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_LINK_OAUTH_IDENTITY: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// UnlinkOAuthIdentity returns ErrNotFound when the user has no identity linked for the provider
+func (p *pg) UnlinkOAuthIdentity(ctx context.Context, userId, provider string) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	result, err := p.conn.Exec(childCtx, queries.UnlinkOAuthIdentity, userId, provider, time.Now())
+	if err != nil {
+		return fmt.Errorf("ERR_UNLINK_OAUTH_IDENTITY: %w", classify(err))
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("ERR_UNLINK_OAUTH_IDENTITY: %w", ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerish/OpenRegistry/store/postgres/queries"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+func (p *pg) AddWebhookDeadLetter(ctx context.Context, dl *types.WebhookDeadLetter) error {
+	childCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := p.conn.Exec(
+		childCtx,
+		queries.AddWebhookDeadLetter,
+		dl.URL,
+		dl.EventType,
+		dl.Payload,
+		dl.Error,
+		dl.Attempts,
+		dl.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("ERR_ADD_WEBHOOK_DEAD_LETTER: %w", err)
+	}
+
+	return nil
+}
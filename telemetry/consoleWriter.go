@@ -2,21 +2,15 @@ package telemetry
 
 import (
 	"bytes"
-	"os"
 	"strings"
-	"time"
 
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-multierror"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 func (l logger) consoleWriter(ctx echo.Context, errMsg error) {
-	l.zlog = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC822})
-	l.zlog = l.zlog.With().Logger()
-
 	buf := l.pool.Get().(*bytes.Buffer)
 	buf.Reset()
 	defer l.pool.Put(buf)
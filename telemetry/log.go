@@ -22,21 +22,44 @@ type Logger interface {
 	Log(ctx echo.Context, err error)
 }
 
-func SetupLogger(env config.Environment) zerolog.Logger {
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	l := zerolog.New(os.Stdout)
-	l = l.With().Caller().Logger()
+// SetupLogger applies the log level and time format from the config, cfg can be nil. Trace and debug lines are
+// sampled when DebugSampleRate is set
+func SetupLogger(env config.Environment, cfg *config.Log) zerolog.Logger {
+	if cfg == nil {
+		cfg = &config.Log{}
+	}
+
+	zerolog.TimeFieldFormat = time.RFC3339
+	if cfg.TimeFormat == "unix" {
+		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	}
+
+	level := zerolog.TraceLevel
+	if env == config.Production {
+		level = zerolog.InfoLevel
+	}
+	if cfg.Level != "" {
+		if l, err := zerolog.ParseLevel(cfg.Level); err == nil {
+			level = l
+		}
+	}
+	zerolog.SetGlobalLevel(level)
+
+	var out io.Writer = os.Stdout
 	if env != config.Production {
-		zerolog.SetGlobalLevel(zerolog.TraceLevel)
-		consoleWriter := zerolog.ConsoleWriter{
+		out = zerolog.ConsoleWriter{
 			Out:        os.Stdout,
 			NoColor:    false,
 			TimeFormat: time.RFC3339,
 		}
-		l.Output(consoleWriter)
-		return l
 	}
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+
+	l := zerolog.New(out).With().Timestamp().Caller().Logger()
+	if cfg.DebugSampleRate > 1 {
+		sampler := &zerolog.BasicSampler{N: cfg.DebugSampleRate}
+		l = l.Sample(zerolog.LevelSampler{TraceSampler: sampler, DebugSampler: sampler})
+	}
+
 	return l
 }
 
@@ -49,7 +72,7 @@ type logger struct {
 	env       config.Environment
 }
 
-func ZLogger(fluentbitClient fluentbit.FluentBit, env config.Environment) Logger {
+func ZLogger(fluentbitClient fluentbit.FluentBit, env config.Environment, cfg *config.Log) Logger {
 	pool := &sync.Pool{
 		New: func() interface{} {
 			return bytes.NewBuffer(make([]byte, 256))
@@ -60,7 +83,7 @@ func ZLogger(fluentbitClient fluentbit.FluentBit, env config.Environment) Logger
 		`"status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}"` +
 		`,"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n"
 
-	baseLogger := SetupLogger(env)
+	baseLogger := SetupLogger(env, cfg)
 
 	return &logger{
 		zlog:      baseLogger,
@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/rs/zerolog"
+)
+
+// restoreLogging undoes the global settings SetupLogger changes
+func restoreLogging(t *testing.T) {
+	level, timeFormat := zerolog.GlobalLevel(), zerolog.TimeFieldFormat
+	t.Cleanup(func() {
+		zerolog.SetGlobalLevel(level)
+		zerolog.TimeFieldFormat = timeFormat
+	})
+}
+
+func TestInfoLevelSuppressesDebug(t *testing.T) {
+	restoreLogging(t)
+	SetupLogger(config.Local, &config.Log{Level: "info"})
+
+	var buf bytes.Buffer
+	l := zerolog.New(&buf)
+	l.Debug().Msg("debug line")
+	l.Trace().Msg("trace line")
+	l.Info().Msg("info line")
+	l.Error().Msg("error line")
+
+	out := buf.String()
+	if strings.Contains(out, "debug line") || strings.Contains(out, "trace line") {
+		t.Errorf("got %s, want the debug and trace lines suppressed", out)
+	}
+	if !strings.Contains(out, "info line") || !strings.Contains(out, "error line") {
+		t.Errorf("got %s, want the info and error lines", out)
+	}
+}
+
+func TestDefaultLevels(t *testing.T) {
+	restoreLogging(t)
+
+	tests := []struct {
+		env  config.Environment
+		cfg  *config.Log
+		want zerolog.Level
+	}{
+		{env: config.Production, cfg: nil, want: zerolog.InfoLevel},
+		{env: config.Local, cfg: &config.Log{}, want: zerolog.TraceLevel},
+		{env: config.Staging, cfg: &config.Log{}, want: zerolog.TraceLevel},
+		{env: config.Production, cfg: &config.Log{Level: "debug"}, want: zerolog.DebugLevel},
+		{env: config.Local, cfg: &config.Log{Level: "warn"}, want: zerolog.WarnLevel},
+	}
+
+	for _, tt := range tests {
+		SetupLogger(tt.env, tt.cfg)
+		if got := zerolog.GlobalLevel(); got != tt.want {
+			t.Errorf("%s %+v: got level %s, want %s", tt.env, tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	restoreLogging(t)
+
+	SetupLogger(config.Production, &config.Log{TimeFormat: "unix"})
+	if zerolog.TimeFieldFormat != zerolog.TimeFormatUnix {
+		t.Errorf("got time format %q, want unix timestamps", zerolog.TimeFieldFormat)
+	}
+
+	SetupLogger(config.Production, &config.Log{})
+	if zerolog.TimeFieldFormat != time.RFC3339 {
+		t.Errorf("got time format %q, want RFC3339", zerolog.TimeFieldFormat)
+	}
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer turns the pgx query logs into spans. pgx v4 has no tracing hooks, but it logs every query
+// once it's done along with the time it took, which is enough to create the span after the fact.
+// Query args are never recorded since they contain passwords, tokens, etc
+type QueryTracer struct{}
+
+func NewQueryTracer() pgx.Logger {
+	return &QueryTracer{}
+}
+
+func (t *QueryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	elapsed, ok := data["time"].(time.Duration)
+	if !ok {
+		// connection lifecycle logs, nothing to trace
+		return
+	}
+
+	end := time.Now()
+	_, span := Tracer().Start(
+		ctx,
+		"postgres "+msg,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-elapsed)),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+
+	if sql, ok := data["sql"].(string); ok {
+		span.SetAttributes(semconv.DBStatementKey.String(sql))
+	}
+
+	var err error
+	if e, ok := data["err"].(error); ok {
+		err = e
+	} else if level == pgx.LogLevelError {
+		err = fmt.Errorf("%s failed", msg)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,187 @@
+// Package tracing exports OpenTelemetry traces of the HTTP handlers, database queries and DFS calls
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/containerish/OpenRegistry"
+	defaultServiceName  = "openregistry"
+	otlpTracesPath      = "/v1/traces"
+
+	AttributeNamespace = attribute.Key("openregistry.namespace")
+	AttributeReference = attribute.Key("openregistry.reference")
+	AttributeDigest    = attribute.Key("openregistry.digest")
+)
+
+var enabled bool //nolint
+
+// Setup registers the global tracer provider and the W3C trace context propagator. Nothing is exported
+// when telemetry is disabled, the returned func flushes the pending spans and must be called on shutdown
+func Setup(cfg *config.Telemetry) (func(ctx context.Context) error, error) {
+	if cfg == nil || !cfg.Enabled {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("ERR_TELEMETRY_CONFIG: endpoint is required when telemetry is enabled")
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	enabled = true
+	color.Green("exporting traces to: %s", cfg.Endpoint)
+	return provider.Shutdown, nil
+}
+
+// newExporter sends the spans to <endpoint>/v1/traces with OTLP/HTTP, the endpoint is the base URL of the collector
+func newExporter(cfg *config.Telemetry) (*otlptrace.Exporter, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("ERR_TELEMETRY_CONFIG: invalid endpoint: %s", cfg.Endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(endpoint.Path, "/") + otlpTracesPath),
+		otlptracehttp.WithHeaders(cfg.Headers),
+	}
+	if endpoint.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("ERR_TELEMETRY_EXPORTER: %w", err)
+	}
+
+	return exporter, nil
+}
+
+// Enabled reports whether Setup registered an exporting tracer provider
+func Enabled() bool {
+	return enabled
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Middleware starts a server span for every request, continuing the trace from the incoming traceparent header.
+// The span is stored in the request context so that the store and DFS spans become its children
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			parent := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			spanName := req.Method + " " + ctx.Path()
+			spanCtx, span := Tracer().Start(
+				parent,
+				spanName,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPMethodKey.String(req.Method),
+					semconv.HTTPRouteKey.String(ctx.Path()),
+					semconv.HTTPTargetKey.String(req.RequestURI),
+					semconv.HTTPClientIPKey.String(ctx.RealIP()),
+				),
+			)
+			defer span.End()
+
+			if ctx.Param("username") != "" {
+				span.SetAttributes(AttributeNamespace.String(types.Namespace(ctx)))
+			}
+			if ref := ctx.Param("reference"); ref != "" {
+				span.SetAttributes(AttributeReference.String(ref))
+			}
+
+			ctx.SetRequest(req.WithContext(spanCtx))
+			err := next(ctx)
+			if err != nil {
+				// let echo write the error response so that the status code below is the one sent to the client
+				ctx.Error(err)
+			}
+
+			// the digest is only known once the handler is done (manifest push, upload completion, etc)
+			if dig := ctx.Response().Header().Get("Docker-Content-Digest"); dig != "" {
+				span.SetAttributes(AttributeDigest.String(dig))
+			} else if dig = ctx.Param("digest"); dig != "" {
+				span.SetAttributes(AttributeDigest.String(dig))
+			}
+
+			status := ctx.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// StartSpan starts a span with the given attributes as a child of the span in ctx
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err on the span (if any) and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
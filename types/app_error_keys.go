@@ -3,4 +3,8 @@ package types
 const (
 	HttpEndpointErrorKey = "HTTP_ERROR"
 	HandlerStartTime     = "HANDLER_START_TIME"
+	// UserContextKey holds the *User authenticated for the request
+	UserContextKey = "AUTHENTICATED_USER"
+	// BlobMountAllowedKey is set by the ACL when the user can pull from the repository a blob is mounted from
+	BlobMountAllowedKey = "BLOB_MOUNT_ALLOWED"
 )
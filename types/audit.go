@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+type AuditAction string
+
+const (
+	AuditActionPush   AuditAction = "push"
+	AuditActionPull   AuditAction = "pull"
+	AuditActionDelete AuditAction = "delete"
+	AuditActionLogin  AuditAction = "login"
+)
+
+type (
+	AuditEvent struct {
+		CreatedAt time.Time   `json:"created_at"`
+		ActorId   string      `json:"actor"`
+		Action    AuditAction `json:"action"`
+		Namespace string      `json:"namespace,omitempty"`
+		Reference string      `json:"reference,omitempty"`
+		SourceIP  string      `json:"source_ip"`
+		Id        int64       `json:"id"`
+	}
+
+	// AuditLogFilter - empty fields are not used for filtering
+	AuditLogFilter struct {
+		Since     time.Time
+		Namespace string
+		ActorId   string
+	}
+)
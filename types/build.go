@@ -0,0 +1,76 @@
+package types
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type BuildStatus string
+
+const (
+	BuildStatusQueued  BuildStatus = "queued"
+	BuildStatusRunning BuildStatus = "running"
+	BuildStatusSuccess BuildStatus = "success"
+	BuildStatusFailed  BuildStatus = "failed"
+)
+
+type (
+	// Build is a build of a repository at a commit. It's queued, then running, and it ends with success or failed.
+	// StartedAt is set when it starts running and FinishedAt when it ends
+	Build struct {
+		CreatedAt  time.Time   `json:"created_at"`
+		UpdatedAt  time.Time   `json:"updated_at"`
+		StartedAt  *time.Time  `json:"started_at,omitempty"`
+		FinishedAt *time.Time  `json:"finished_at,omitempty"`
+		ID         string      `json:"id"`
+		Namespace  string      `json:"namespace"`
+		Commit     string      `json:"commit" validate:"required,max=64"`
+		Status     BuildStatus `json:"status"`
+		LogsURL    string      `json:"logs_url" validate:"omitempty,url"`
+	}
+
+	// BuildUpdate moves a build to Status, LogsURL replaces the logs link when it's set
+	BuildUpdate struct {
+		Status  BuildStatus `json:"status" validate:"required"`
+		LogsURL string      `json:"logs_url" validate:"omitempty,url"`
+	}
+)
+
+func (b *Build) Validate() error {
+	v := validator.New()
+	return v.Struct(b)
+}
+
+func (u *BuildUpdate) Validate() error {
+	v := validator.New()
+	return v.Struct(u)
+}
+
+// CanTransitionTo reports whether a build can move from s to next: queued to running, then running to success or
+// failed. The finished builds don't change anymore
+func (s BuildStatus) CanTransitionTo(next BuildStatus) bool {
+	switch s {
+	case BuildStatusQueued:
+		return next == BuildStatusRunning
+	case BuildStatusRunning:
+		return next == BuildStatusSuccess || next == BuildStatusFailed
+	default:
+		return false
+	}
+}
+
+// IsValid reports whether s is one of the build statuses
+func (s BuildStatus) IsValid() bool {
+	switch s {
+	case BuildStatusQueued, BuildStatusRunning, BuildStatusSuccess, BuildStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFinished reports whether the build ended, successfully or not
+func (s BuildStatus) IsFinished() bool {
+	return s == BuildStatusSuccess || s == BuildStatusFailed
+}
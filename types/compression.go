@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+type (
+	// CompressedLayer maps a layer pushed uncompressed to the compressed copy the registry stores and serves.
+	// Digest is the digest of the uncompressed content, the one manifests reference
+	CompressedLayer struct {
+		CreatedAt        time.Time `json:"created_at"`
+		Digest           string    `json:"digest"`
+		CompressedDigest string    `json:"compressed_digest"`
+		UUID             string    `json:"uuid"`
+		DFSLink          string    `json:"skynetLink"`
+		Encoding         string    `json:"encoding"`
+		Size             int64     `json:"size"`
+	}
+)
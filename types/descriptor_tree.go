@@ -0,0 +1,16 @@
+package types
+
+type (
+	// DescriptorNode - Kind is one of index, manifest, config, layer. Children are the manifests of an index, or the
+	// config and layers of an image manifest. Error is set when the node couldn't be resolved, e.g. the manifest is
+	// missing or the depth limit was reached
+	DescriptorNode struct {
+		MediaType string            `json:"mediaType"`
+		Digest    string            `json:"digest"`
+		Kind      string            `json:"kind"`
+		Platform  string            `json:"platform,omitempty"`
+		Error     string            `json:"error,omitempty"`
+		Children  []*DescriptorNode `json:"children,omitempty"`
+		Size      int64             `json:"size"`
+	}
+)
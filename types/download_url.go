@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+type (
+	// BlobDownloadURL - URL is a pre-signed DFS URL, or the registry blob endpoint when Proxied is true, in which case
+	// the usual credentials are needed and ExpiresAt is nil
+	BlobDownloadURL struct {
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		URL       string     `json:"url"`
+		Digest    string     `json:"digest"`
+		Size      int        `json:"size"`
+		Proxied   bool       `json:"proxied"`
+	}
+)
@@ -0,0 +1,22 @@
+package types
+
+type (
+	// IntegrityReport lists the blobs an image references and whether they can be pulled.
+	// Intact is true when every blob is ok
+	IntegrityReport struct {
+		Namespace string           `json:"namespace"`
+		Reference string           `json:"reference"`
+		Digest    string           `json:"digest"`
+		Blobs     []*BlobIntegrity `json:"blobs"`
+		Deep      bool             `json:"deep"`
+		Intact    bool             `json:"intact"`
+	}
+
+	// BlobIntegrity - Kind is one of manifest, config, layer. Status is ok, missing or corrupted
+	BlobIntegrity struct {
+		Digest string `json:"digest"`
+		Kind   string `json:"kind"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+)
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"net/url"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+)
+
+// namespaceComponentRegex matches a single path component of a repository name. The separators are those of the
+// OCI distribution spec: a period, one or two underscores, or any number of dashes
+var namespaceComponentRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`) //nolint
+
+func IsValidNamespaceComponent(component string) bool {
+	return namespaceComponentRegex.MatchString(component)
+}
+
+// Namespace returns the repository name of the /v2/<name>/ routes. The routes only have the username and
+// imagename params, the components of a nested name after the first one reach the handlers escaped into
+// imagename (see router.NestedNamespaces)
+func Namespace(ctx echo.Context) string {
+	imagename := ctx.Param("imagename")
+	if unescaped, err := url.PathUnescape(imagename); err == nil {
+		imagename = unescaped
+	}
+
+	return ctx.Param("username") + "/" + imagename
+}
@@ -0,0 +1,43 @@
+package types
+
+import "testing"
+
+func TestIsValidNamespaceComponent(t *testing.T) {
+	tests := []struct {
+		component string
+		want      bool
+	}{
+		{component: "alpine", want: true},
+		{component: "a", want: true},
+		{component: "0", want: true},
+		{component: "my.app", want: true},
+		{component: "my_app", want: true},
+		{component: "my__app", want: true},
+		{component: "my-app", want: true},
+		{component: "my---app", want: true},
+		{component: "a.b_c__d-e--f", want: true},
+		{component: "v1.2.3", want: true},
+		{component: "", want: false},
+		{component: "Alpine", want: false},
+		{component: "my___app", want: false},
+		{component: "my..app", want: false},
+		{component: "my._app", want: false},
+		{component: "my-.app", want: false},
+		{component: "_app", want: false},
+		{component: "app_", want: false},
+		{component: "-app", want: false},
+		{component: "app-", want: false},
+		{component: ".app", want: false},
+		{component: "my app", want: false},
+		{component: "my/app", want: false},
+		{component: "my:app", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.component, func(t *testing.T) {
+			if got := IsValidNamespaceComponent(tt.component); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
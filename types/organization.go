@@ -0,0 +1,53 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrganizationRole - owners manage the members and push, members push and readers only pull.
+// Every role can pull the private repositories of the organization
+type OrganizationRole string
+
+const (
+	OrganizationRoleOwner  OrganizationRole = "owner"
+	OrganizationRoleMember OrganizationRole = "member"
+	OrganizationRoleReader OrganizationRole = "reader"
+)
+
+type (
+	// Organization is a namespace shared by its members, it can't have the name of an existing user
+	Organization struct {
+		CreatedAt time.Time `json:"created_at"`
+		Name      string    `json:"name"`
+	}
+
+	OrganizationMember struct {
+		CreatedAt time.Time        `json:"created_at"`
+		UpdatedAt time.Time        `json:"updated_at"`
+		UserId    string           `json:"user_id"`
+		Username  string           `json:"username"`
+		Role      OrganizationRole `json:"role"`
+	}
+)
+
+func (r OrganizationRole) IsValid() bool {
+	return r == OrganizationRoleOwner || r == OrganizationRoleMember || r == OrganizationRoleReader
+}
+
+func (r OrganizationRole) CanPush() bool {
+	return r == OrganizationRoleOwner || r == OrganizationRoleMember
+}
+
+func (r OrganizationRole) CanPull() bool {
+	return r.IsValid()
+}
+
+func (o *Organization) Validate() error {
+	if len(o.Name) > 64 || !IsValidNamespaceComponent(o.Name) {
+		return fmt.Errorf("organization name must be at most 64 lowercase alphanumeric characters, " +
+			"optionally separated by periods, dashes or underscores")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	PasswordClassLowercase = "lowercase"
+	PasswordClassUppercase = "uppercase"
+	PasswordClassNumber    = "number"
+	PasswordClassSpecial   = "special"
+
+	defaultMinPasswordLength = 8
+	defaultMaxPasswordLength = 64
+)
+
+// PasswordPolicy is what the passwords must meet when users sign up or change them
+type PasswordPolicy struct {
+	// CommonPasswords can't be used, whatever else they meet. The keys are lowercase
+	CommonPasswords  map[string]struct{}
+	MinLength        int
+	MaxLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireNumber    bool
+	RequireSpecial   bool
+}
+
+// PasswordPolicyError lists every requirement the password doesn't meet
+type PasswordPolicyError struct {
+	Unmet []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Unmet, ", ")
+}
+
+// DefaultPasswordPolicy requires 8 to 64 characters with a lowercase and an uppercase letter, a number and a
+// special character
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:        defaultMinPasswordLength,
+		MaxLength:        defaultMaxPasswordLength,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireNumber:    true,
+		RequireSpecial:   true,
+	}
+}
+
+// Validate returns a *PasswordPolicyError when the password doesn't meet the policy
+func (p *PasswordPolicy) Validate(password string) error {
+	var lowercasePresent, uppercasePresent, numberPresent, specialCharPresent bool
+	for _, ch := range password {
+		switch {
+		case unicode.IsNumber(ch):
+			numberPresent = true
+		case unicode.IsUpper(ch):
+			uppercasePresent = true
+		case unicode.IsLower(ch):
+			lowercasePresent = true
+		case unicode.IsPunct(ch) || unicode.IsSymbol(ch):
+			specialCharPresent = true
+		}
+	}
+
+	var unmet []string
+	if p.RequireLowercase && !lowercasePresent {
+		unmet = append(unmet, "lowercase letter missing")
+	}
+	if p.RequireUppercase && !uppercasePresent {
+		unmet = append(unmet, "uppercase letter missing")
+	}
+	if p.RequireNumber && !numberPresent {
+		unmet = append(unmet, "atleast one numeric character required")
+	}
+	if p.RequireSpecial && !specialCharPresent {
+		unmet = append(unmet, "special character missing")
+	}
+
+	passLen := utf8.RuneCountInString(password)
+	if passLen < p.MinLength || (p.MaxLength > 0 && passLen > p.MaxLength) {
+		unmet = append(unmet, fmt.Sprintf(
+			"password length must be between %d to %d characters long", p.MinLength, p.MaxLength,
+		))
+	}
+
+	if _, ok := p.CommonPasswords[strings.ToLower(password)]; ok {
+		unmet = append(unmet, "password is too common")
+	}
+
+	if len(unmet) != 0 {
+		return &PasswordPolicyError{Unmet: unmet}
+	}
+	return nil
+}
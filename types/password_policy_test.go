@@ -0,0 +1,50 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	policy.CommonPasswords = map[string]struct{}{"p@ssw0rd123": {}}
+
+	tests := []struct {
+		name     string
+		password string
+		unmet    []string
+	}{
+		{name: "meets the policy", password: "Tr0ub4dor&3"},
+		{
+			name:     "too short",
+			password: "Ab1!",
+			unmet:    []string{"password length must be between 8 to 64 characters long"},
+		},
+		{name: "no uppercase letter", password: "tr0ub4dor&3", unmet: []string{"uppercase letter missing"}},
+		{name: "no special character", password: "Tr0ub4dor33", unmet: []string{"special character missing"}},
+		{
+			name:     "missing classes",
+			password: "troubadour",
+			unmet: []string{
+				"uppercase letter missing", "atleast one numeric character required", "special character missing",
+			},
+		},
+		{name: "common password", password: "P@ssw0rd123", unmet: []string{"password is too common"}},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password)
+		if tt.unmet == nil {
+			if err != nil {
+				t.Errorf("%s: got error %v, want none", tt.name, err)
+			}
+			continue
+		}
+
+		var policyErr *PasswordPolicyError
+		if !errors.As(err, &policyErr) || !reflect.DeepEqual(policyErr.Unmet, tt.unmet) {
+			t.Errorf("%s: got error %v, want the unmet requirements %v", tt.name, err, tt.unmet)
+		}
+	}
+}
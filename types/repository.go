@@ -0,0 +1,38 @@
+package types
+
+import "time"
+
+type (
+	// Repository is a repository with its tags. GetRepository fills Manifests too, Tags is then the tags of the
+	// manifests
+	Repository struct {
+		CreatedAt  *time.Time            `json:"created_at,omitempty"`
+		UpdatedAt  *time.Time            `json:"updated_at,omitempty"`
+		Namespace  string                `json:"namespace"`
+		Visibility RepositoryVisibility  `json:"visibility,omitempty"`
+		Tags       []*ConfigV2           `json:"tags"`
+		Manifests  []*ManifestDescriptor `json:"manifests,omitempty"`
+	}
+
+	// ManifestDescriptor is a manifest of a repository, along with the tags which point to it. Config and Layers are
+	// only set for the image manifests, a layer which isn't known to the registry only has its digest. ArtifactType
+	// is only set for OCI artifacts
+	ManifestDescriptor struct {
+		CreatedAt    time.Time     `json:"created_at"`
+		UpdatedAt    time.Time     `json:"updated_at"`
+		Config       *Descriptor   `json:"config,omitempty"`
+		MediaType    string        `json:"mediaType"`
+		ArtifactType string        `json:"artifactType,omitempty"`
+		Digest       string        `json:"digest"`
+		Tags         []string      `json:"tags"`
+		Layers       []*Descriptor `json:"layers,omitempty"`
+		// Size is the size of the image, its layers and config
+		Size int64 `json:"size"`
+	}
+
+	Descriptor struct {
+		MediaType string `json:"mediaType,omitempty"`
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+	}
+)
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type (
+	// RetentionPolicy - TagPattern is a glob, or a regular expression wrapped in slashes, an empty pattern
+	// matches every tag. The KeepLast most recently pushed matching tags are always kept, the other matching
+	// tags are deleted once they're older than MaxTagAgeDays (right away when it's 0). Manifests only pushed
+	// by digest are deleted once they're older than UntaggedMaxAgeDays. A zero limit disables the rule
+	RetentionPolicy struct {
+		CreatedAt          time.Time `json:"created_at"`
+		UpdatedAt          time.Time `json:"updated_at"`
+		Namespace          string    `json:"namespace"`
+		TagPattern         string    `json:"tag_pattern"`
+		KeepLast           int       `json:"keep_last" validate:"gte=0"`
+		MaxTagAgeDays      int       `json:"max_tag_age_days" validate:"gte=0"`
+		UntaggedMaxAgeDays int       `json:"untagged_max_age_days" validate:"gte=0"`
+	}
+
+	// RetentionReport lists what was (or in dry-run mode, would be) deleted from a repository
+	RetentionReport struct {
+		Namespace        string   `json:"namespace"`
+		DeletedTags      []string `json:"deleted_tags"`
+		DeletedManifests []string `json:"deleted_manifests"`
+		DeletedLayers    []string `json:"deleted_layers"`
+		DryRun           bool     `json:"dry_run"`
+	}
+)
+
+func (p *RetentionPolicy) Validate() error {
+	v := validator.New()
+	return v.Struct(p)
+}
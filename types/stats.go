@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+type (
+	// RepositoryStats - the counters are aggregated in memory and periodically added to the stored ones
+	RepositoryStats struct {
+		LastPulledAt   *time.Time `json:"last_pulled_at,omitempty"`
+		LastPushedAt   *time.Time `json:"last_pushed_at,omitempty"`
+		LastActivity   *time.Time `json:"last_activity,omitempty"`
+		Namespace      string     `json:"namespace"`
+		PullCount      int64      `json:"pull_count"`
+		LayerPullCount int64      `json:"layer_pull_count"`
+		PushCount      int64      `json:"push_count"`
+		UniqueLayers   int64      `json:"unique_layers"`
+		TotalSize      int64      `json:"total_size"`
+	}
+)
@@ -87,16 +87,27 @@ type (
 		Reference string    `json:"reference"`
 		Digest    string    `json:"digest"`
 		Layers    []string  `json:"layers,omitempty"`
-		Size      int       `json:"size,omitempty"`
+		// Size is the size of the image, its layers and config, as listed in the manifest
+		Size int `json:"size,omitempty"`
+		// ConfigDigest and ConfigSize describe the config blob of an image manifest, manifest lists have none
+		ConfigDigest string `json:"config_digest,omitempty"`
+		ConfigSize   int    `json:"config_size,omitempty"`
+		// ArtifactType is the artifactType of an OCI artifact manifest, e.g. an SBOM or a signature
+		ArtifactType string `json:"artifact_type,omitempty"`
 	}
 
 	Catalog struct {
 		Repositories []*Repository `json:"repositories"`
 	}
 
-	Repository struct {
-		Namespace string      `json:"namespace"`
-		Tags      []*ConfigV2 `json:"tags"`
+	// PublicRepository is what the public browse API shows about a repository, Tags is only set for a single one.
+	// Visibility is only set in the repositories of a user, where the owner sees the private ones too
+	PublicRepository struct {
+		UpdatedAt  time.Time            `json:"updated_at"`
+		Namespace  string               `json:"namespace"`
+		Visibility RepositoryVisibility `json:"visibility,omitempty"`
+		Tags       []*ConfigV2          `json:"tags,omitempty"`
+		PullCount  int64                `json:"pull_count"`
 	}
 
 	Password struct {
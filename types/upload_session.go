@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+type (
+	// UploadSession is the state of a chunked upload, persisted after every chunk so that an upload can be
+	// resumed after a restart. The chunks themselves are already stored as multipart upload parts in the DFS
+	UploadSession struct {
+		CreatedAt time.Time           `json:"created_at"`
+		UpdatedAt time.Time           `json:"updated_at"`
+		UploadID  string              `json:"upload_id"`
+		LayerKey  string              `json:"layer_key"`
+		Namespace string              `json:"namespace"`
+		Parts     []UploadSessionPart `json:"parts"`
+		PartCount int64               `json:"part_count"`
+		Received  int64               `json:"received"`
+	}
+
+	UploadSessionPart struct {
+		ETag       string `json:"etag"`
+		PartNumber int32  `json:"part_number"`
+	}
+)
@@ -3,9 +3,7 @@ package types
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
-	"unicode"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -33,8 +31,13 @@ type (
 		OrganizationsURL  string    `json:"organizations_url,omitempty"`
 		AvatarURL         string    `json:"avatar_url,omitempty"`
 		OAuthID           int       `json:"id,omitempty"`
+		TokenVersion      int       `json:"-" validate:"-"`
 		IsActive          bool      `json:"is_active,omitempty" validate:"-"`
 		Hireable          bool      `json:"hireable,omitempty"`
+		// OAuthProvider is set along with OAuthID once the user links an identity, e.g. OAuthProviderGithub
+		OAuthProvider string `json:"oauth_provider,omitempty" validate:"-"`
+		// Roles grant access to the APIs outside of the user's own namespace, e.g. RoleAdmin
+		Roles []string `json:"roles,omitempty" validate:"-"`
 	}
 
 	OAuthUser struct {
@@ -60,82 +63,36 @@ type (
 		Hireable          bool `json:"hireable"`
 	}
 	Session struct {
-		Id           string `json:"id"`
-		RefreshToken string `json:"refresh_token"`
-		Owner        string `json:"-"`
+		CreatedAt    time.Time `json:"created_at"`
+		LastUsedAt   time.Time `json:"last_used_at"`
+		Id           string    `json:"id"`
+		RefreshToken string    `json:"refresh_token,omitempty"`
+		Owner        string    `json:"-"`
+		UserAgent    string    `json:"user_agent"`
+		IPAddress    string    `json:"ip_address"`
+		// Current is set for the session the request was made with
+		Current bool `json:"current"`
 	}
 )
 
+// RoleAdmin can use the /admin APIs
+const RoleAdmin = "admin"
+
+const OAuthProviderGithub = "github"
+
+// Validate doesn't check the password, it's checked against the password policy before it's hashed
 func (u *User) Validate() error {
 	if u == nil {
 		return fmt.Errorf("user is nil")
 	}
 
-	if err := ValidatePassword(u.Password); err != nil {
-		return err
-	}
-
 	v := validator.New()
 	return v.Struct(u)
 }
 
+// ValidatePassword checks the password against the default policy
 func ValidatePassword(password string) error {
-	var uppercasePresent bool
-	var lowercasePresent bool
-	var numberPresent bool
-	var specialCharPresent bool
-	const minPassLength = 8
-	const maxPassLength = 64
-	var passLen int
-	var errorString string
-
-	for _, ch := range password {
-		switch {
-		case unicode.IsNumber(ch):
-			numberPresent = true
-			passLen++
-		case unicode.IsUpper(ch):
-			uppercasePresent = true
-			passLen++
-		case unicode.IsLower(ch):
-			lowercasePresent = true
-			passLen++
-		case unicode.IsPunct(ch) || unicode.IsSymbol(ch):
-			specialCharPresent = true
-			passLen++
-		case ch == ' ':
-			passLen++
-		}
-	}
-	appendError := func(err string) {
-		if len(strings.TrimSpace(errorString)) != 0 {
-			errorString += ", " + err
-		} else {
-			errorString = err
-		}
-	}
-	if !lowercasePresent {
-		appendError("lowercase letter missing")
-	}
-	if !uppercasePresent {
-		appendError("uppercase letter missing")
-	}
-	if !numberPresent {
-		appendError("atleast one numeric character required")
-	}
-	if !specialCharPresent {
-		appendError("special character missing")
-	}
-
-	if minPassLength > passLen || passLen > maxPassLength {
-		appendError(fmt.Sprintf("password length must be between %d to %d characters long", minPassLength, maxPassLength))
-	}
-
-	if len(errorString) != 0 {
-		return fmt.Errorf(errorString)
-	}
-
-	return nil
+	return DefaultPasswordPolicy().Validate(password)
 }
 
 func (u *User) Bytes() ([]byte, error) {
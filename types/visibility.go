@@ -0,0 +1,14 @@
+package types
+
+type RepositoryVisibility string
+
+const (
+	// RepositoryVisibilityPublic repositories can be pulled by anyone, including anonymous users
+	RepositoryVisibilityPublic RepositoryVisibility = "public"
+	// RepositoryVisibilityPrivate repositories can only be pulled by their owner
+	RepositoryVisibilityPrivate RepositoryVisibility = "private"
+)
+
+func (v RepositoryVisibility) IsValid() bool {
+	return v == RepositoryVisibilityPublic || v == RepositoryVisibilityPrivate
+}
@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+type WebhookEventType string
+
+const (
+	WebhookEventPush   WebhookEventType = "push"
+	WebhookEventDelete WebhookEventType = "delete"
+)
+
+type (
+	// WebhookEvent is the payload sent to the configured webhooks
+	WebhookEvent struct {
+		Timestamp  time.Time        `json:"timestamp"`
+		Type       WebhookEventType `json:"event"`
+		Repository string           `json:"repository"`
+		Tag        string           `json:"tag,omitempty"`
+		Digest     string           `json:"digest,omitempty"`
+	}
+
+	// WebhookDeadLetter is an event that couldn't be delivered even after all the retries
+	WebhookDeadLetter struct {
+		CreatedAt time.Time
+		URL       string
+		EventType WebhookEventType
+		Error     string
+		Payload   []byte
+		Attempts  int
+	}
+)
@@ -0,0 +1,241 @@
+// Package webhooks delivers registry events (push, delete) to the webhooks configured by the operator
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/store/postgres"
+	"github.com/containerish/OpenRegistry/types"
+	"github.com/fatih/color"
+)
+
+const (
+	// HeaderSignature carries the hex encoded HMAC-SHA256 of the request body, prefixed by "sha256="
+	HeaderSignature = "X-OpenRegistry-Signature"
+	HeaderEvent     = "X-OpenRegistry-Event"
+
+	defaultBufferSize = 256
+	maxAttempts       = 5
+	initialBackoff    = time.Second
+	deliveryTimeout   = time.Second * 10
+)
+
+type Notifier interface {
+	// Notify queues the event for delivery, it never blocks the request path
+	Notify(event *types.WebhookEvent)
+
+	// Close waits for the queued events to be delivered
+	Close()
+}
+
+type (
+	notifier struct {
+		events    chan *types.WebhookEvent
+		done      chan struct{}
+		endpoints []*endpoint
+	}
+
+	// endpoint delivers the events of one webhook from its own queue, so that a slow or failing webhook only
+	// delays its own events. The retries wait off the queue, the next events are sent meanwhile
+	endpoint struct {
+		webhook *config.Webhook
+		store   postgres.WebhookStore
+		client  *http.Client
+		queue   chan *delivery
+		// pending counts the deliveries that are queued or waiting to be retried
+		pending *sync.WaitGroup
+		done    chan struct{}
+		backoff time.Duration
+	}
+
+	delivery struct {
+		eventType types.WebhookEventType
+		payload   []byte
+		attempt   int
+	}
+)
+
+func New(webhooks []*config.Webhook, store postgres.WebhookStore) Notifier {
+	return newNotifier(webhooks, store, initialBackoff)
+}
+
+func newNotifier(webhooks []*config.Webhook, store postgres.WebhookStore, backoff time.Duration) *notifier {
+	n := &notifier{
+		events: make(chan *types.WebhookEvent, defaultBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	client := &http.Client{Timeout: deliveryTimeout}
+	for _, webhook := range webhooks {
+		e := &endpoint{
+			webhook: webhook,
+			store:   store,
+			client:  client,
+			queue:   make(chan *delivery, defaultBufferSize),
+			pending: &sync.WaitGroup{},
+			done:    make(chan struct{}),
+			backoff: backoff,
+		}
+		n.endpoints = append(n.endpoints, e)
+		go e.run()
+	}
+
+	go n.run()
+	return n
+}
+
+func (n *notifier) Notify(event *types.WebhookEvent) {
+	if len(n.endpoints) == 0 {
+		return
+	}
+
+	select {
+	case n.events <- event:
+	default:
+		color.Red("webhook buffer is full, dropping event: %s %s", event.Type, event.Repository)
+	}
+}
+
+// Close waits for the retries too, the events which still fail are stored as dead letters
+func (n *notifier) Close() {
+	close(n.events)
+	<-n.done
+}
+
+// run hands every event to the queues of the webhooks subscribed to it
+func (n *notifier) run() {
+	defer close(n.done)
+
+	for event := range n.events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			color.Red("error marshalling webhook event: %s", err)
+			continue
+		}
+
+		for _, e := range n.endpoints {
+			if subscribed(e.webhook, event.Type) {
+				e.enqueue(&delivery{eventType: event.Type, payload: payload, attempt: 1})
+			}
+		}
+	}
+
+	for _, e := range n.endpoints {
+		e.close()
+	}
+}
+
+// enqueue never blocks, the event is dropped for this webhook only when its queue is full
+func (e *endpoint) enqueue(d *delivery) {
+	e.pending.Add(1)
+	select {
+	case e.queue <- d:
+	default:
+		e.pending.Done()
+		color.Red("webhook queue of %s is full, dropping event: %s", e.webhook.URL, d.eventType)
+	}
+}
+
+func (e *endpoint) run() {
+	defer close(e.done)
+
+	for d := range e.queue {
+		e.deliver(d)
+	}
+}
+
+// close waits for the pending deliveries, retries included, then stops the worker
+func (e *endpoint) close() {
+	e.pending.Wait()
+	close(e.queue)
+	<-e.done
+}
+
+// deliver makes one attempt, a failed delivery is queued again after an exponential backoff. Deliveries that still
+// fail after maxAttempts are stored as dead letters
+func (e *endpoint) deliver(d *delivery) {
+	err := e.send(d.eventType, d.payload)
+	if err == nil {
+		e.pending.Done()
+		return
+	}
+
+	if d.attempt < maxAttempts {
+		backoff := e.backoff << (d.attempt - 1)
+		d.attempt++
+		// the queue stays open while the delivery is pending, see close
+		time.AfterFunc(backoff, func() { e.queue <- d })
+		return
+	}
+
+	defer e.pending.Done()
+	color.Red("webhook delivery to %s failed after %d attempts: %s", e.webhook.URL, maxAttempts, err)
+	dl := &types.WebhookDeadLetter{
+		CreatedAt: time.Now(),
+		URL:       e.webhook.URL,
+		EventType: d.eventType,
+		Error:     err.Error(),
+		Payload:   d.payload,
+		Attempts:  maxAttempts,
+	}
+	if err = e.store.AddWebhookDeadLetter(context.Background(), dl); err != nil {
+		color.Red("error storing webhook dead letter: %s", err)
+	}
+}
+
+func (e *endpoint) send(eventType types.WebhookEventType, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("ERR_WEBHOOK_NEW_REQUEST: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(eventType))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(e.webhook.Secret, payload))
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ERR_WEBHOOK_DELIVERY: %w", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("ERR_WEBHOOK_DELIVERY: unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload, receivers compute the same to verify the request
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(webhook *config.Webhook, eventType types.WebhookEventType) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+
+	for _, e := range webhook.Events {
+		if e == string(eventType) {
+			return true
+		}
+	}
+
+	return false
+}
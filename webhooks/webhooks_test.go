@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerish/OpenRegistry/config"
+	"github.com/containerish/OpenRegistry/types"
+)
+
+type deadLetterStore struct {
+	mu          sync.Mutex
+	deadLetters []*types.WebhookDeadLetter
+}
+
+func (s *deadLetterStore) AddWebhookDeadLetter(_ context.Context, dl *types.WebhookDeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLetters = append(s.deadLetters, dl)
+	return nil
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int, delay time.Duration) (*httptest.Server, chan receivedRequest) {
+	received := make(chan receivedRequest, 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error reading the webhook body: %s", err)
+		}
+		time.Sleep(delay)
+		received <- receivedRequest{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, received
+}
+
+func TestDeliverySignedPayload(t *testing.T) {
+	server, received := newReceiver(t, http.StatusNoContent, 0)
+	webhook := &config.Webhook{URL: server.URL, Secret: "webhook-secret"}
+	n := newNotifier([]*config.Webhook{webhook}, &deadLetterStore{}, time.Millisecond)
+
+	event := &types.WebhookEvent{
+		Timestamp:  time.Date(2022, 10, 4, 12, 0, 0, 0, time.UTC),
+		Type:       types.WebhookEventPush,
+		Repository: "johndoe/alpine",
+		Tag:        "latest",
+		Digest:     "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+	}
+	n.Notify(event)
+	n.Close()
+
+	req := <-received
+	if got := req.header.Get(HeaderSignature); got != "sha256="+Sign(webhook.Secret, req.body) {
+		t.Errorf("got signature %s, it doesn't match the body", got)
+	}
+	if got := req.header.Get(HeaderEvent); got != string(types.WebhookEventPush) {
+		t.Errorf("got event header %s, want %s", got, types.WebhookEventPush)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"timestamp":  "2022-10-04T12:00:00Z",
+		"event":      "push",
+		"repository": event.Repository,
+		"tag":        event.Tag,
+		"digest":     event.Digest,
+	}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("payload %s: got %v, want %v", key, payload[key], value)
+		}
+	}
+}
+
+func TestDeliverySubscribedEventsOnly(t *testing.T) {
+	server, received := newReceiver(t, http.StatusOK, 0)
+	webhook := &config.Webhook{URL: server.URL, Secret: "secret", Events: []string{string(types.WebhookEventDelete)}}
+	n := newNotifier([]*config.Webhook{webhook}, &deadLetterStore{}, time.Millisecond)
+
+	n.Notify(&types.WebhookEvent{Type: types.WebhookEventPush, Repository: "johndoe/alpine"})
+	n.Notify(&types.WebhookEvent{Type: types.WebhookEventDelete, Repository: "johndoe/alpine"})
+	n.Close()
+
+	if len(received) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(received))
+	}
+	if got := (<-received).header.Get(HeaderEvent); got != string(types.WebhookEventDelete) {
+		t.Errorf("got event %s, want %s", got, types.WebhookEventDelete)
+	}
+}
+
+// TestFailingWebhookDoesNotDelayOthers has a slow failing webhook first, the healthy one must get every event
+// without waiting for its retries
+func TestFailingWebhookDoesNotDelayOthers(t *testing.T) {
+	var failedAttempts int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failedAttempts, 1)
+		time.Sleep(time.Millisecond * 50)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	healthy, received := newReceiver(t, http.StatusOK, 0)
+
+	store := &deadLetterStore{}
+	n := newNotifier([]*config.Webhook{
+		{URL: failing.URL, Secret: "secret"},
+		{URL: healthy.URL, Secret: "secret"},
+	}, store, time.Millisecond*20)
+
+	const events = 3
+	for i := 0; i < events; i++ {
+		n.Notify(&types.WebhookEvent{Type: types.WebhookEventPush, Repository: "johndoe/alpine"})
+	}
+
+	// delivering inline, the failing webhook would hold every event for 5 attempts (about 550ms)
+	deadline := time.After(time.Millisecond * 400)
+	for i := 0; i < events; i++ {
+		select {
+		case <-received:
+		case <-deadline:
+			t.Fatalf("the healthy webhook got %d of %d events, it waits for the failing one", i, events)
+		}
+	}
+
+	n.Close()
+
+	if got := atomic.LoadInt32(&failedAttempts); got != events*maxAttempts {
+		t.Errorf("got %d attempts to the failing webhook, want %d", got, events*maxAttempts)
+	}
+	if len(store.deadLetters) != events {
+		t.Fatalf("got %d dead letters, want %d", len(store.deadLetters), events)
+	}
+	for _, dl := range store.deadLetters {
+		if dl.URL != failing.URL || dl.Attempts != maxAttempts {
+			t.Errorf("got dead letter for %s after %d attempts", dl.URL, dl.Attempts)
+		}
+	}
+}
+
+func TestDeliveryRetriedUntilSuccess(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	store := &deadLetterStore{}
+	n := newNotifier([]*config.Webhook{{URL: server.URL, Secret: "secret"}}, store, time.Millisecond)
+	n.Notify(&types.WebhookEvent{Type: types.WebhookEventDelete, Repository: "johndoe/alpine"})
+	n.Close()
+
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+	if len(store.deadLetters) != 0 {
+		t.Errorf("got %d dead letters, want none", len(store.deadLetters))
+	}
+}